@@ -0,0 +1,243 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// actions of job mutations and manual operations
+const (
+	ActionCreate  = "create"
+	ActionModify  = "modify"
+	ActionDelete  = "delete"
+	ActionOnce    = "once"
+	ActionTrigger = "trigger"
+	ActionKill    = "kill"
+	ActionDefer   = "defer" // best-effort job fire deferred under host pressure
+	ActionShed    = "shed"  // best-effort job fire dropped under host pressure
+
+	// programs controlled through a process manager, Key is <manager>:<program>
+	ActionStart   = "start"
+	ActionStop    = "stop"
+	ActionRestart = "restart"
+	ActionReload  = "reload"
+
+	ActionTail  = "tail"  // log file read through the api, Key is the path
+	ActionPush  = "push"  // file written by the admin, Key is the path
+	ActionFetch = "fetch" // file downloaded by the admin, Key is the path
+
+	// shells of the web terminal, Key is the session id, Reason of close is why it ended
+	ActionTerminalOpen  = "terminal_open"
+	ActionTerminalClose = "terminal_close"
+)
+
+// sources of entries
+const (
+	SourceEtcd  = "etcd"  // mutations observed by watching etcd
+	SourceAPI   = "api"   // operations requested by the agent api
+	SourceRedis = "redis" // once jobs popped from the redis queue
+	SourceAgent = "agent" // decisions made by the agent itself
+)
+
+// Entry an audit record
+type Entry struct {
+	Time     time.Time       `json:"time"`
+	Action   string          `json:"action"`
+	Source   string          `json:"source"`
+	Node     string          `json:"node"`
+	JobID    string          `json:"job_id"`
+	TaskID   uint64          `json:"task_id,omitempty"`
+	Key      string          `json:"key,omitempty"`
+	Revision int64           `json:"revision,omitempty"`
+	Before   json.RawMessage `json:"before,omitempty"`
+	After    json.RawMessage `json:"after,omitempty"`
+	Diff     []Change        `json:"diff,omitempty"`
+	Reason   string          `json:"reason,omitempty"`
+}
+
+// Change a changed top level field between before and after
+type Change struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// Log writes audit entries to an append-only file and optionally forwards them
+type Log struct {
+	config  *Config
+	mu      sync.Mutex
+	file    *os.File
+	forward chan []byte
+}
+
+// Start open the file for appending and start forwarding
+func (l *Log) Start() error {
+	if !l.config.Enable {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.config.Path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	l.file = file
+
+	if l.config.ForwardAddr != "" {
+		xgo.Go(l.forwardLoop)
+	}
+	return nil
+}
+
+// Close ...
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// Record append an entry, time defaults to now and diff is computed from before and after.
+// it is safe to call on a nil Log
+func (l *Log) Record(entry Entry) {
+	if l == nil || !l.config.Enable {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if entry.Diff == nil && (len(entry.Before) > 0 || len(entry.After) > 0) {
+		entry.Diff = Diff(entry.Before, entry.After)
+	}
+	entry.Before, entry.After = validJSON(entry.Before), validJSON(entry.After)
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		xlog.Error("audit marshal", xlog.FieldErr(err))
+		return
+	}
+
+	l.mu.Lock()
+	if l.file != nil {
+		if _, err := l.file.Write(append(line, '\n')); err != nil {
+			xlog.Error("audit record", xlog.FieldErr(err))
+		}
+	}
+	l.mu.Unlock()
+
+	if l.config.ForwardAddr != "" {
+		select {
+		case l.forward <- line:
+		default:
+			xlog.Warn("audit forward queue is full", xlog.String("action", entry.Action), xlog.String("jobId", entry.JobID))
+		}
+	}
+}
+
+func (l *Log) forwardLoop() {
+	client := &http.Client{Timeout: l.config.ForwardTimeout}
+	for line := range l.forward {
+		if err := l.post(client, line); err != nil {
+			xlog.Warn("audit forward", xlog.String("addr", l.config.ForwardAddr), xlog.FieldErr(err))
+		}
+	}
+}
+
+func (l *Log) post(client *http.Client, line []byte) error {
+	resp, err := client.Post(l.config.ForwardAddr, "application/json", bytes.NewReader(line))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Diff compares top level fields of two json objects, fields are sorted by name.
+// if either side is not an object, the whole value is reported as one change
+func Diff(before, after []byte) []Change {
+	var b, a map[string]json.RawMessage
+	if len(before) > 0 && json.Unmarshal(before, &b) != nil || len(after) > 0 && json.Unmarshal(after, &a) != nil {
+		if bytes.Equal(before, after) {
+			return nil
+		}
+		return []Change{{Before: validJSON(before), After: validJSON(after)}}
+	}
+
+	fields := make(map[string]struct{})
+	for k := range b {
+		fields[k] = struct{}{}
+	}
+	for k := range a {
+		fields[k] = struct{}{}
+	}
+
+	changes := make([]Change, 0)
+	for field := range fields {
+		if jsonEqual(b[field], a[field]) {
+			continue
+		}
+		changes = append(changes, Change{Field: field, Before: b[field], After: a[field]})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+// validJSON keeps value which is not json as a json string, so that the entry can still be encoded
+func validJSON(value json.RawMessage) json.RawMessage {
+	if len(value) == 0 || json.Valid(value) {
+		return value
+	}
+	quoted, _ := json.Marshal(string(value))
+	return quoted
+}
+
+// jsonEqual compares decoded values so that formatting differences are ignored
+func jsonEqual(x, y json.RawMessage) bool {
+	if len(x) == 0 || len(y) == 0 {
+		return len(x) == len(y)
+	}
+	var vx, vy interface{}
+	if json.Unmarshal(x, &vx) != nil || json.Unmarshal(y, &vy) != nil {
+		return bytes.Equal(x, y)
+	}
+	return reflect.DeepEqual(vx, vy)
+}
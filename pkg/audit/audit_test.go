@@ -0,0 +1,94 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	before := []byte(`{"id":"1","script":"/bin/a","timers":[{"cron":"* * * * *"}],"enable":true}`)
+	after := []byte(`{"id": "1", "script":"/bin/b","timers":[{"cron":"* * * * *"}],"timeout":10}`)
+
+	changes := Diff(before, after)
+	fields := make([]string, 0)
+	for _, c := range changes {
+		fields = append(fields, c.Field)
+	}
+	assert.Equal(t, []string{"enable", "script", "timeout"}, fields)
+	assert.Nil(t, changes[0].After)
+	assert.Nil(t, changes[2].Before)
+
+	assert.Len(t, Diff(nil, after), 4)
+	assert.Len(t, Diff([]byte("not json"), after), 1)
+}
+
+func TestLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	forwarded := make(chan Entry, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var entry Entry
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&entry))
+		forwarded <- entry
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.Enable = true
+	config.Path = filepath.Join(dir, "audit.log")
+	config.ForwardAddr = server.URL
+	log := config.Build()
+	assert.Nil(t, log.Start())
+
+	log.Record(Entry{
+		Action:   ActionModify,
+		Source:   SourceEtcd,
+		JobID:    "1",
+		Key:      "/juno/cronjob/job/1",
+		Revision: 42,
+		Before:   json.RawMessage(`{"script":"/bin/a"}`),
+		After:    json.RawMessage(`{"script":"/bin/b"}`),
+	})
+	assert.Nil(t, log.Close())
+
+	file, err := os.Open(config.Path)
+	assert.Nil(t, err)
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	assert.True(t, scanner.Scan())
+	var entry Entry
+	assert.Nil(t, json.Unmarshal(scanner.Bytes(), &entry))
+	assert.Equal(t, int64(42), entry.Revision)
+	assert.Equal(t, "script", entry.Diff[0].Field)
+	assert.False(t, entry.Time.IsZero())
+
+	assert.Equal(t, ActionModify, (<-forwarded).Action)
+
+	var disabled *Log
+	disabled.Record(Entry{Action: ActionCreate})
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/util/xtime"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config audit log config
+type Config struct {
+	Enable         bool          `json:"enable"`
+	Path           string        `json:"path"`            // append-only file which entries are written to
+	ForwardAddr    string        `json:"forward_addr"`    // entries are also posted to this admin api if not empty
+	ForwardTimeout time.Duration `json:"forward_timeout"` // timeout of each forward request
+	QueueSize      int           `json:"queue_size"`      // entries waiting to be forwarded, new entries are not forwarded when full
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadAuditConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable:         false,
+		Path:           "/tmp/juno-agent/audit.log",
+		ForwardTimeout: xtime.Duration("5s"),
+		QueueSize:      1024,
+	}
+}
+
+// Build new a instance
+func (c *Config) Build() *Log {
+	if c.Enable {
+		xlog.Info("plugin", xlog.String("audit", "start"))
+	}
+	return &Log{
+		config:  c,
+		forward: make(chan []byte, c.QueueSize),
+	}
+}
@@ -17,6 +17,7 @@ package tcp
 import (
 	"encoding/json"
 	"github.com/douyu/juno-agent/pkg/check/view"
+	"github.com/douyu/juno-agent/pkg/logging"
 	"github.com/douyu/jupiter/pkg/xlog"
 	"net"
 )
@@ -47,16 +48,16 @@ func (t *TCPHealthCheck) LoadExtConfig(extConfig string) (err error) {
 func (t *TCPHealthCheck) DoHealthCheck() (resHealthCheck *view.ResHealthCheck, err error) {
 	tcpAddr, err := net.ResolveTCPAddr(t.Network, t.Addr)
 	if err != nil {
-		xlog.Error("ResolveTCPAddr", xlog.Any("tcp addr err", err))
+		logging.Logger("check").Error("ResolveTCPAddr", xlog.Any("tcp addr err", err))
 		return
 	}
 	conn, err := net.DialTCP(t.Network, nil, tcpAddr)
 	if err != nil {
-		xlog.Error("DailTcp", xlog.Any("DailTcp err", err))
+		logging.Logger("check").Error("DailTcp", xlog.Any("DailTcp err", err))
 		return
 	}
 	if err = conn.Close(); err != nil {
-		xlog.Error("Conn close", xlog.Any("Connection Close err", err))
+		logging.Logger("check").Error("Conn close", xlog.Any("Connection Close err", err))
 		return
 	}
 	resHealthCheck = view.HealthCheckResult("tcp", true, "success")
@@ -15,17 +15,36 @@
 package core
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"time"
 
-	pb "github.com/coreos/etcd/etcdserver/etcdserverpb"
+	"github.com/douyu/juno-agent/pkg/audit"
 	"github.com/douyu/juno-agent/pkg/file"
+	"github.com/douyu/juno-agent/pkg/job"
+	"github.com/douyu/juno-agent/pkg/job/jobpb"
+	"github.com/douyu/juno-agent/pkg/logging"
+	"github.com/douyu/juno-agent/pkg/logtail"
 	"github.com/douyu/juno-agent/pkg/model"
+	"github.com/douyu/juno-agent/pkg/platform"
 	"github.com/douyu/juno-agent/pkg/pmt"
+	"github.com/douyu/juno-agent/pkg/pmt/container"
+	"github.com/douyu/juno-agent/pkg/pprof"
+	"github.com/douyu/juno-agent/pkg/procstat"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/configpb"
 	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/pkg/timeline"
 	"github.com/douyu/juno-agent/util"
 	"github.com/douyu/jupiter/pkg/server/xecho"
 	"github.com/douyu/jupiter/pkg/server/xgrpc"
+	"github.com/douyu/jupiter/pkg/xlog"
 	"github.com/labstack/echo/v4"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
 	"google.golang.org/grpc/examples/helloworld/helloworld"
 )
 
@@ -33,21 +52,104 @@ func (eng *Engine) serveHTTP() error {
 
 	s := xecho.StdConfig("http").Build()
 
+	// probes for load balancers and systemd watchdog, status code reflects the result
+	s.GET("/healthz", eng.healthz)
+	s.GET("/readyz", eng.readyz)
+
 	group := s.Group("/api")
 	group.GET("/agent/reload", eng.agentReload)           // restart confd monitoring
 	group.GET("/agent/process/status", eng.processStatus) // real time process status
 	group.POST("/agent/process/shell", eng.pmtShell)
+	group.GET("/agent/capabilities", eng.capabilities)
+	group.GET("/agent/tunnel", eng.tunnelStatus)
 	group.GET("/agent/file", eng.readFile) // 文件读取
+	group.GET("/agent/reboot", eng.rebootStatus)
+	group.POST("/agent/reboot", eng.requestReboot, requireToken) // drain, reboot and verify services after restart
+	group.GET("/agent/profile", eng.profileStatus)               // host profiles synced from git and drifted settings
+
+	// programs of supervisord queried and controlled over xml-rpc, control limited to plugin.supervisor.rpc.allow
+	group.GET("/agent/supervisor/programs", eng.supervisorPrograms)
+	group.POST("/agent/supervisor/programs/:name/:op", eng.controlSupervisorProgram) // op is start, stop or restart
+	// units of systemd queried and controlled over D-Bus, control limited to plugin.systemd.dbus.allow
+	group.GET("/agent/systemd/units", eng.systemdUnitStates)
+	group.POST("/agent/systemd/units/:name/:op", eng.controlSystemdUnit) // op is start, stop, restart or reload
+	// app containers of docker or cri runtimes, restart only if plugin.container.restart is set
+	group.GET("/agent/containers", eng.containerStatuses)
+	group.POST("/agent/containers/:id/restart", eng.restartContainer) // id may be a prefix or the container name
+	// cpu, rss, fds and threads of app processes and job tasks, time series of one process with kind and name
+	group.GET("/agent/procstat", eng.procstatSamples)
+	// os, hardware, addresses, container runtimes and installed apps, also published under plugin.facts.prefix
+	group.GET("/agent/facts", eng.hostFacts)         // ?refresh=true collects them again
+	group.GET("/agent/heartbeat", eng.heartbeatBeat) // payload registered under the lease of plugin.heartbeat
+
+	// log levels of agent modules (job, proxy, check), changed at runtime until the agent restarts
+	group.GET("/agent/log/levels", eng.logLevels)
+	group.POST("/agent/log/level", eng.setLogLevel) // e.g. {"module":"job","level":"debug"}
+
+	// apps long-poll the local agent for new versions of their config files instead of watching etcd,
+	// the decrypted content is only served over loopback
+	group.GET("/config/watch", eng.watchConfig, requireLoopback) // ?app=&file=&version=&timeout=30, 304 when nothing changed
+	group.GET("/config/diff", eng.diffConfig, requireToken)      // ?app=&file=&from=&to=, versions listed by /api/v1/conf/history
+
+	// cron job management on current node, available when etcd is degraded,
+	// mutations require api.token like the JobService calls
+	group.GET("/jobs", eng.listJobs)
+	group.POST("/jobs/:id/trigger", eng.triggerJob, requireToken)
+	group.POST("/jobs/:id/kill", eng.killJob, requireToken)
+	group.GET("/jobs/:id/runs", eng.jobRuns)
+	group.POST("/job/lint", eng.lintJob)                              // validate a job definition before it is written to etcd
+	group.GET("/job/preview", eng.previewTimer)                       // next fire times of a timer rule
+	group.GET("/job/tasks/:taskId/logs", eng.taskLogs, requireToken)  // output of a task, ?follow=true streams until it finishes
+	group.POST("/job/tasks/:taskId/kill", eng.killTask, requireToken) // kill the process group of a running task
+
+	// probe results of the instances registered through the registry proxy
+	group.GET("/registry/health", eng.registryHealth)
+
+	group.GET("/timeline", eng.listTimeline)                   // host state transitions
+	group.POST("/timeline/maintenance", eng.recordMaintenance) // mark maintenance windows
+
+	// last lines of a file under plugin.logtail.dirs, rate limited per client, audited and requires api.token
+	group.GET("/logs/tail", eng.tailLog, requireToken) // ?path=&lines=&grep=
+	// distribute files such as certificates and collect dumps, limited to plugin.file.pushDirs and fetchDirs
+	// both require api.token in the Authorization header
+	group.POST("/files", eng.pushFile, requireToken) // ?path=&sha256=&mode=&owner=&group=, body is the content
+	group.GET("/files", eng.fetchFile, requireToken) // ?path=, sha256 of the content in X-Content-Sha256
+
+	// shell of the local user mapped by plugin.terminal.users from the console user of an admin-signed ticket, recorded and audited
+	group.GET("/terminal", echo.WrapHandler(eng.terminal.Handler())) // ?ticket=&cols=&rows=
+	group.GET("/terminal/sessions", eng.terminalSessions)
+
+	group.GET("/incidents", eng.listIncidents)          // captured evidence bundles
+	group.GET("/incidents/:name", eng.downloadIncident) // download an evidence bundle
+	group.POST("/pprof", eng.capturePprof)              // fetch profiles from the governance port of an app
+	group.GET("/pprof", eng.listPprof)                  // profiles kept on disk
+	group.GET("/pprof/:name", eng.downloadPprof)        // download a profile
+
+	group.GET("/keys", eng.listKeys)                                // data key versions of tenants
+	group.POST("/keys/:tenant/rotate", eng.rotateKey, requireToken) // create a new data key for tenant
+
+	// gateway mode, proxy and aggregate api calls to downstream agents. Calls are forwarded with
+	// the token of each agent, so the gateway requires api.token itself
+	gateway := group.Group("/gateway", requireToken)
+	gateway.GET("/agents", eng.gatewayAgents)
+	gateway.Any("/agents/:agent/*", eng.gatewayProxy)
+	gateway.Any("/fanout/*", eng.gatewayFanout)
 
 	v1Group := s.Group("/api/v1")
 	v1Group.GET("/agent/:target", eng.getAppConfig) // get app config
 	v1Group.GET("/agent/config", eng.listenConfig)  // listenConfig
 	v1Group.POST("/agent/check", eng.agentCheck)    // 加入依赖探活检测
 	v1Group.POST("/conf/command_line/status", eng.confStatus)
+	v1Group.GET("/conf/explain", eng.explainConfig) // trace sections of a rendered config back to template, variables, secrets and facts
+
+	// versions of a config file kept in .history before it was overwritten
+	v1Group.GET("/conf/history", eng.configHistory)
+	v1Group.POST("/conf/rollback", eng.rollbackConfig) // e.g. {"path":"/home/www/app/config.toml","version":""}
 
 	v1Group.GET("/agent/rawKey/getConfig", eng.getRawAppConfig)       // 根据原生key获取配置信息
 	v1Group.GET("/agent/rawKey/listenConfig", eng.listenRawKeyConfig) // 根据原生key长轮训监听配置
 
+	eng.startTunnel(s)
 	return eng.Serve(s)
 }
 
@@ -58,6 +160,8 @@ func (eng *Engine) serveGRPC() error {
 	pb.RegisterWatchServer(server.Server, eng.regProxy)
 	pb.RegisterLeaseServer(server.Server, eng.regProxy)
 	helloworld.RegisterGreeterServer(server.Server, eng.regProxy)
+	jobpb.RegisterJobServiceServer(server.Server, &jobService{eng: eng})
+	configpb.RegisterConfigServiceServer(server.Server, &configService{eng: eng})
 
 	return eng.Serve(server)
 }
@@ -114,6 +218,54 @@ func (eng *Engine) listenConfig(ctx echo.Context) error {
 	return reply200(ctx, config)
 }
 
+// watchConfig reply the latest config file of app as soon as its version differs from version,
+// or 304 if no newer version arrives before timeout (in seconds, default 30, at most 120)
+func (eng *Engine) watchConfig(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, "confProxy is disabled")
+	}
+	app := ctx.QueryParam("app")
+	file := ctx.QueryParam("file")
+	if app == "" || file == "" {
+		return reply400(ctx, "app and file are required")
+	}
+	timeout := 30 * time.Second
+	if value := ctx.QueryParam("timeout"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return reply400(ctx, "invalid timeout: "+value)
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+	if timeout > 2*time.Minute {
+		timeout = 2 * time.Minute
+	}
+
+	node, ok := eng.confProxy.WatchConfig(ctx.Request().Context(), app, file, ctx.QueryParam("version"), timeout)
+	if !ok {
+		return ctx.NoContent(http.StatusNotModified)
+	}
+	return reply200(ctx, node)
+}
+
+// diffConfig unified diff between saved versions of an app config file,
+// the latest saved version and the current content are compared by default
+func (eng *Engine) diffConfig(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, "confProxy is disabled")
+	}
+	app := ctx.QueryParam("app")
+	file := ctx.QueryParam("file")
+	if app == "" || file == "" {
+		return reply400(ctx, "app and file are required")
+	}
+	diff, err := eng.confProxy.Diff(app, file, ctx.QueryParam("from"), ctx.QueryParam("to"))
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, diff)
+}
+
 // listenRawKeyConfig record the change of config
 // if the config change in internal time(default 60s),return the changed config
 // other return the status 400
@@ -139,6 +291,76 @@ func (eng *Engine) listenRawKeyConfig(ctx echo.Context) error {
 	return reply200(ctx, config)
 }
 
+// explainConfig explain the config file written to path, line is optional
+func (eng *Engine) explainConfig(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, "confProxy is disabled")
+	}
+	path := ctx.QueryParam("path")
+	if path == "" {
+		return reply400(ctx, "path is required")
+	}
+	line := 0
+	if value := ctx.QueryParam("line"); value != "" {
+		var err error
+		if line, err = strconv.Atoi(value); err != nil {
+			return reply400(ctx, "invalid line: "+err.Error())
+		}
+	}
+
+	explanation, ok := eng.confProxy.Explain(path, line)
+	if !ok {
+		return reply400(ctx, "no provenance recorded for "+path)
+	}
+	return reply200(ctx, explanation)
+}
+
+// configHistory list the saved versions of the config file written to path
+func (eng *Engine) configHistory(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, "confProxy is disabled")
+	}
+	path := ctx.QueryParam("path")
+	if path == "" {
+		return reply400(ctx, "path is required")
+	}
+	versions, err := eng.confProxy.History(path)
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, versions)
+}
+
+type rollbackBind struct {
+	Path    string `json:"path"`
+	Version string `json:"version"` // the latest saved version if empty
+}
+
+// rollbackConfig restore the config file to a saved version, the content replaced is saved as well
+func (eng *Engine) rollbackConfig(ctx echo.Context) error {
+	if eng.confProxy == nil {
+		return reply400(ctx, "confProxy is disabled")
+	}
+	bind := rollbackBind{}
+	if err := ctx.Bind(&bind); err != nil {
+		return reply400(ctx, err.Error())
+	}
+	if bind.Path == "" {
+		return reply400(ctx, "path is required")
+	}
+	version, err := eng.confProxy.Rollback(bind.Path, bind.Version)
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	eng.timeline.Record(timeline.Event{
+		Kind:    timeline.KindConfigChange,
+		Target:  bind.Path,
+		Message: "config " + bind.Path + " rolled back",
+		Meta:    map[string]string{"version": version},
+	})
+	return reply200(ctx, map[string]string{"path": bind.Path, "version": version})
+}
+
 // getAppConfig get the app config data
 func (eng *Engine) getAppConfig(ctx echo.Context) error {
 	appName := ctx.QueryParam("name")
@@ -173,6 +395,41 @@ func (eng *Engine) processStatus(ctx echo.Context) error {
 	return reply200(ctx, list)
 }
 
+// registryHealth list the latest probe result of every probed instance
+func (eng *Engine) registryHealth(ctx echo.Context) error {
+	if eng.regProxy == nil {
+		return reply400(ctx, "regProxy is not enabled")
+	}
+	return reply200(ctx, eng.regProxy.Health())
+}
+
+// capabilities show features available on current platform
+func (eng *Engine) capabilities(ctx echo.Context) error {
+	return reply200(ctx, platform.Report())
+}
+
+type logLevelBind struct {
+	Module string `json:"module"` // job, proxy, check
+	Level  string `json:"level"`  // debug, info, warn, error
+}
+
+// logLevels list modules having a logger of their own and their levels
+func (eng *Engine) logLevels(ctx echo.Context) error {
+	return reply200(ctx, logging.Levels())
+}
+
+// setLogLevel change the level of a module until the agent restarts
+func (eng *Engine) setLogLevel(ctx echo.Context) error {
+	bind := logLevelBind{}
+	if err := ctx.Bind(&bind); err != nil {
+		return reply400(ctx, err.Error())
+	}
+	if err := logging.SetLevel(bind.Module, bind.Level); err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, logging.Levels())
+}
+
 // agentCheck add the health check of relies
 func (eng *Engine) agentCheck(ctx echo.Context) error {
 	checkDatas := model.CheckReq{}
@@ -200,6 +457,130 @@ func (eng *Engine) pmtShell(ctx echo.Context) error {
 	return reply200(ctx, reply)
 }
 
+// supervisorPrograms states and uptime of the programs run by supervisord
+func (eng *Engine) supervisorPrograms(ctx echo.Context) error {
+	if eng.supervisorRPC == nil {
+		return reply400(ctx, "supervisor rpc is not enabled")
+	}
+	programs, err := eng.supervisorRPC.Programs(ctx.Request().Context())
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, programs)
+}
+
+// controlSupervisorProgram start, stop or restart a program and wait until it is done
+func (eng *Engine) controlSupervisorProgram(ctx echo.Context) error {
+	if eng.supervisorRPC == nil {
+		return reply400(ctx, "supervisor rpc is not enabled")
+	}
+	name, op := ctx.Param("name"), ctx.Param("op")
+	if err := eng.supervisorRPC.Control(ctx.Request().Context(), name, op); err != nil {
+		return reply400(ctx, err.Error())
+	}
+	eng.audit.Record(audit.Entry{
+		Action: op,
+		Source: audit.SourceAPI,
+		Key:    "supervisor:" + name,
+	})
+	return reply200(ctx, nil)
+}
+
+// systemdUnitStates active state, sub state and restart count of the managed units
+func (eng *Engine) systemdUnitStates(ctx echo.Context) error {
+	if eng.systemdUnits == nil {
+		return reply400(ctx, "systemd dbus is not enabled")
+	}
+	units, err := eng.systemdUnits.Units(ctx.Request().Context())
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, units)
+}
+
+// controlSystemdUnit start, stop, restart or reload a unit and wait for its job to finish
+func (eng *Engine) controlSystemdUnit(ctx echo.Context) error {
+	if eng.systemdUnits == nil {
+		return reply400(ctx, "systemd dbus is not enabled")
+	}
+	name, op := ctx.Param("name"), ctx.Param("op")
+	err := eng.systemdUnits.Control(ctx.Request().Context(), name, op)
+	// denied and failed attempts are audited too, a failed job may leave the unit stopped
+	entry := audit.Entry{Action: op, Source: audit.SourceAPI, Key: "systemd:" + name}
+	if err != nil {
+		entry.Reason = err.Error()
+	}
+	eng.audit.Record(entry)
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, nil)
+}
+
+// containerStatuses app containers collected last time, refreshed when refresh=true
+func (eng *Engine) containerStatuses(ctx echo.Context) error {
+	if eng.containers == nil {
+		return reply400(ctx, "container inspection is not enabled")
+	}
+	if ctx.QueryParam("refresh") != "true" {
+		return reply200(ctx, eng.containers.Statuses())
+	}
+	statuses, err := eng.containers.Collect(ctx.Request().Context())
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, statuses)
+}
+
+// restartContainer restart an app container and wait until the runtime returns
+func (eng *Engine) restartContainer(ctx echo.Context) error {
+	if eng.containers == nil {
+		return reply400(ctx, "container inspection is not enabled")
+	}
+	status, err := eng.containers.Restart(ctx.Request().Context(), ctx.Param("id"))
+	if err == container.ErrRestartDisabled || err == container.ErrNotFound {
+		return reply400(ctx, err.Error())
+	}
+	entry := audit.Entry{Action: audit.ActionRestart, Source: audit.SourceAPI, Key: "container:" + status.Name}
+	if err != nil {
+		entry.Reason = err.Error()
+	}
+	eng.audit.Record(entry)
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, status)
+}
+
+// procstatSamples latest sample of every process, or the kept series of the process given by kind and name
+func (eng *Engine) procstatSamples(ctx echo.Context) error {
+	name := ctx.QueryParam("name")
+	if name == "" {
+		return reply200(ctx, eng.procstat.Latest())
+	}
+	kind := ctx.QueryParam("kind")
+	if kind == "" {
+		kind = procstat.KindApp
+	}
+	return reply200(ctx, eng.procstat.Series(kind, name))
+}
+
+// hostFacts facts of the last collection, collected now when refresh=true or none is collected yet
+func (eng *Engine) hostFacts(ctx echo.Context) error {
+	if latest := eng.facts.Latest(); latest != nil && ctx.QueryParam("refresh") != "true" {
+		return reply200(ctx, latest)
+	}
+	return reply200(ctx, eng.facts.Collect())
+}
+
+// heartbeatBeat the heartbeat payload as of now and the key it is written to
+func (eng *Engine) heartbeatBeat(ctx echo.Context) error {
+	return reply200(ctx, map[string]interface{}{
+		"key":  eng.heartbeat.Key(),
+		"beat": eng.heartbeat.Beat(),
+	})
+}
+
 func (eng *Engine) readFile(c echo.Context) error {
 	var param model.GetFileReq
 	err := c.Bind(&param)
@@ -212,13 +593,445 @@ func (eng *Engine) readFile(c echo.Context) error {
 		return reply400(c, err.Error())
 	}
 
-	content = util.EncryptAPIResp(content)
+	if param.Tenant != "" && eng.keyring != nil {
+		if content, err = eng.keyring.Encrypt(param.Tenant, []byte(content)); err != nil {
+			return reply400(c, err.Error())
+		}
+	} else {
+		content = util.EncryptAPIResp(content)
+	}
 
 	return reply200(c, map[string]interface{}{
 		"content": content,
 	})
 }
 
+// listKeys list data key versions without key material
+func (eng *Engine) listKeys(ctx echo.Context) error {
+	if eng.keyring == nil {
+		return reply400(ctx, "keyring is not enabled")
+	}
+	return reply200(ctx, eng.keyring.Keys())
+}
+
+// rotateKey create a new data key version for tenant, older versions are kept for decryption
+func (eng *Engine) rotateKey(ctx echo.Context) error {
+	if eng.keyring == nil {
+		return reply400(ctx, "keyring is not enabled")
+	}
+	version, err := eng.keyring.Rotate(ctx.Param("tenant"))
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, map[string]interface{}{
+		"tenant":  ctx.Param("tenant"),
+		"version": version,
+	})
+}
+
+// listJobs list cron jobs scheduled on current node
+func (eng *Engine) listJobs(ctx echo.Context) error {
+	if eng.worker == nil {
+		return reply400(ctx, "worker is not running")
+	}
+	return reply200(ctx, eng.worker.Jobs())
+}
+
+// lintJob check a job definition and return all problems found
+func (eng *Engine) lintJob(ctx echo.Context) error {
+	if eng.worker == nil {
+		return reply400(ctx, "worker is not running")
+	}
+	definition := &job.Job{}
+	if err := ctx.Bind(definition); err != nil {
+		return reply400(ctx, err.Error())
+	}
+
+	problems := eng.worker.Lint(definition)
+	valid := true
+	for _, problem := range problems {
+		if problem.Severity == job.LintError {
+			valid = false
+		}
+	}
+	return reply200(ctx, map[string]interface{}{
+		"valid":    valid,
+		"problems": problems,
+	})
+}
+
+// previewTimer validate a timer rule and return its next fire times, e.g. ?timer=0 */5 * * * *&count=10
+func (eng *Engine) previewTimer(ctx echo.Context) error {
+	count, _ := strconv.Atoi(ctx.QueryParam("count"))
+	preview, err := job.PreviewTimer(ctx.QueryParam("timer"), count, time.Now())
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, preview)
+}
+
+// taskLogs write the output of a task as plain text. with ?follow=true the response is chunked
+// and new output is flushed as it is produced until the task finishes or the client disconnects
+func (eng *Engine) taskLogs(ctx echo.Context) error {
+	if eng.worker == nil {
+		return reply400(ctx, "worker is not running")
+	}
+	taskID, err := strconv.ParseUint(ctx.Param("taskId"), 10, 64)
+	if err != nil {
+		return reply400(ctx, "invalid task id")
+	}
+
+	history, ch, cancel, err := eng.worker.SubscribeOutput(taskID)
+	if err != nil {
+		// task has finished, reply its stored output
+		run, err := eng.worker.TaskRun(taskID)
+		if err != nil {
+			return reply400(ctx, err.Error())
+		}
+		ctx.Response().Header().Set("X-Task-Status", string(run.Status))
+		return ctx.String(http.StatusOK, run.Logs)
+	}
+	defer cancel()
+
+	resp := ctx.Response()
+	resp.Header().Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.Header().Set("X-Accel-Buffering", "no") // disable buffering of nginx in front of the agent
+	resp.WriteHeader(http.StatusOK)
+	if _, err := resp.Write(history); err != nil || ctx.QueryParam("follow") != "true" {
+		return err
+	}
+	resp.Flush()
+
+	for {
+		select {
+		case chunk, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if _, err := resp.Write(chunk); err != nil {
+				return err
+			}
+			resp.Flush()
+		case <-ctx.Request().Context().Done():
+			return nil
+		}
+	}
+}
+
+// triggerJob run a job immediately on current node
+func (eng *Engine) triggerJob(ctx echo.Context) error {
+	if eng.worker == nil {
+		return reply400(ctx, "worker is not running")
+	}
+	taskID, err := eng.worker.TriggerJob(ctx.Param("id"))
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, map[string]interface{}{
+		"task_id": taskID,
+	})
+}
+
+// killTask kill a running task by task id without knowing its job
+func (eng *Engine) killTask(ctx echo.Context) error {
+	if eng.worker == nil {
+		return reply400(ctx, "worker is not running")
+	}
+	taskID, err := strconv.ParseUint(ctx.Param("taskId"), 10, 64)
+	if err != nil {
+		return reply400(ctx, "invalid task id")
+	}
+	killed, err := eng.worker.KillTask("", taskID)
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, map[string]interface{}{
+		"killed": killed,
+	})
+}
+
+// killJob kill running processes of a job on current node
+func (eng *Engine) killJob(ctx echo.Context) error {
+	if eng.worker == nil {
+		return reply400(ctx, "worker is not running")
+	}
+	killed, err := eng.worker.KillJob(ctx.Param("id"))
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, map[string]interface{}{
+		"killed": killed,
+	})
+}
+
+// jobRuns recent runs of a job on current node
+func (eng *Engine) jobRuns(ctx echo.Context) error {
+	if eng.worker == nil {
+		return reply400(ctx, "worker is not running")
+	}
+	runs, err := eng.worker.JobRuns(ctx.Param("id"))
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, runs)
+}
+
+// listTimeline query host state transitions, from/to accept RFC3339 or unix seconds
+func (eng *Engine) listTimeline(ctx echo.Context) error {
+	from, err := parseTime(ctx.QueryParam("from"))
+	if err != nil {
+		return reply400(ctx, "invalid from: "+err.Error())
+	}
+	to, err := parseTime(ctx.QueryParam("to"))
+	if err != nil {
+		return reply400(ctx, "invalid to: "+err.Error())
+	}
+	return reply200(ctx, eng.timeline.Query(from, to, ctx.QueryParam("kind")))
+}
+
+type maintenanceBind struct {
+	Action  string `json:"action"` // start|end
+	Message string `json:"message"`
+}
+
+// recordMaintenance record the start or end of a maintenance window
+func (eng *Engine) recordMaintenance(ctx echo.Context) error {
+	bind := maintenanceBind{}
+	if err := ctx.Bind(&bind); err != nil {
+		return reply400(ctx, err.Error())
+	}
+	if bind.Action != "start" && bind.Action != "end" {
+		return reply400(ctx, "action should be start or end")
+	}
+	eng.timeline.Record(timeline.Event{
+		Kind:    timeline.KindMaintenance,
+		Message: bind.Message,
+		Meta: map[string]string{
+			"action": bind.Action,
+		},
+	})
+	return reply200(ctx, nil)
+}
+
+type rebootBind struct {
+	Reason   string `json:"reason"`
+	Downtime string `json:"downtime"` // expected time the host takes to come back, e.g. 5m
+}
+
+// requestReboot start the reboot workflow
+func (eng *Engine) requestReboot(ctx echo.Context) error {
+	bind := rebootBind{}
+	if err := ctx.Bind(&bind); err != nil {
+		return reply400(ctx, err.Error())
+	}
+	downtime := 5 * time.Minute
+	if bind.Downtime != "" {
+		var err error
+		if downtime, err = time.ParseDuration(bind.Downtime); err != nil {
+			return reply400(ctx, "invalid downtime: "+err.Error())
+		}
+	}
+
+	xlog.Info("reboot requested", xlog.String("reason", bind.Reason), xlog.Duration("downtime", downtime), xlog.String("client", ctx.RealIP()))
+	state, err := eng.reboot.Request(bind.Reason, downtime)
+	if err != nil {
+		xlog.Warn("reboot refused", xlog.String("client", ctx.RealIP()), xlog.FieldErr(err))
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, state)
+}
+
+// rebootStatus query the latest reboot workflow
+func (eng *Engine) rebootStatus(ctx echo.Context) error {
+	state, ok := eng.reboot.Status()
+	if !ok {
+		return reply200(ctx, nil)
+	}
+	return reply200(ctx, state)
+}
+
+// profileStatus query the latest host profile sync
+func (eng *Engine) profileStatus(ctx echo.Context) error {
+	status, ok := eng.profile.Status()
+	if !ok {
+		return reply200(ctx, nil)
+	}
+	return reply200(ctx, status)
+}
+
+// tailLog last lines of a log file matching grep, the read is audited even if it is refused
+func (eng *Engine) tailLog(ctx echo.Context) error {
+	req := logtail.Request{
+		Path:   ctx.QueryParam("path"),
+		Grep:   ctx.QueryParam("grep"),
+		Client: peerIP(ctx),
+	}
+	if lines := ctx.QueryParam("lines"); lines != "" {
+		n, err := strconv.Atoi(lines)
+		if err != nil {
+			return reply400(ctx, "invalid lines")
+		}
+		req.Lines = n
+	}
+	result, err := eng.logtail.Tail(req)
+	if err == logtail.ErrDisabled {
+		return reply400(ctx, err.Error())
+	}
+	entry := audit.Entry{Action: audit.ActionTail, Source: audit.SourceAPI, Key: req.Path}
+	entry.After, _ = json.Marshal(map[string]interface{}{
+		"grep":   req.Grep,
+		"lines":  req.Lines,
+		"client": req.Client,
+	})
+	if err != nil {
+		entry.Reason = err.Error()
+	}
+	eng.audit.Record(entry)
+	if err == logtail.ErrRateLimited {
+		return ctx.JSON(http.StatusTooManyRequests, map[string]interface{}{
+			"code": http.StatusTooManyRequests,
+			"msg":  err.Error(),
+		})
+	}
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, result)
+}
+
+// pushFile write the request body to path, the write is audited even if it is refused
+func (eng *Engine) pushFile(ctx echo.Context) error {
+	req := file.PushRequest{
+		Path:   ctx.QueryParam("path"),
+		SHA256: ctx.QueryParam("sha256"),
+		Owner:  ctx.QueryParam("owner"),
+		Group:  ctx.QueryParam("group"),
+	}
+	if mode := ctx.QueryParam("mode"); mode != "" {
+		n, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			return reply400(ctx, "invalid mode")
+		}
+		req.Mode = os.FileMode(n)
+	}
+	info, err := eng.files.Push(req, ctx.Request().Body)
+	if err == file.ErrDisabled {
+		return reply400(ctx, err.Error())
+	}
+	entry := audit.Entry{Action: audit.ActionPush, Source: audit.SourceAPI, Key: req.Path}
+	entry.After, _ = json.Marshal(map[string]interface{}{
+		"sha256": req.SHA256,
+		"mode":   ctx.QueryParam("mode"),
+		"owner":  req.Owner,
+		"group":  req.Group,
+		"client": peerIP(ctx),
+	})
+	if err != nil {
+		entry.Reason = err.Error()
+	}
+	eng.audit.Record(entry)
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, info)
+}
+
+// fetchFile download a file, the read is audited even if it is refused
+func (eng *Engine) fetchFile(ctx echo.Context) error {
+	path := ctx.QueryParam("path")
+	f, info, err := eng.files.Fetch(path)
+	if err == file.ErrDisabled {
+		return reply400(ctx, err.Error())
+	}
+	entry := audit.Entry{Action: audit.ActionFetch, Source: audit.SourceAPI, Key: path}
+	if err != nil {
+		entry.Reason = err.Error()
+	} else {
+		entry.After, _ = json.Marshal(map[string]interface{}{
+			"size":   info.Size,
+			"sha256": info.SHA256,
+			"client": peerIP(ctx),
+		})
+	}
+	eng.audit.Record(entry)
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	defer f.Close()
+
+	header := ctx.Response().Header()
+	header.Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filepath.Base(info.Path)))
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(info.Size, 10))
+	header.Set("X-Content-Sha256", info.SHA256)
+	return ctx.Stream(http.StatusOK, echo.MIMEOctetStream, io.LimitReader(f, info.Size))
+}
+
+// terminalSessions running web terminal sessions
+func (eng *Engine) terminalSessions(ctx echo.Context) error {
+	return reply200(ctx, eng.terminal.Sessions())
+}
+
+// listIncidents list captured evidence bundles
+func (eng *Engine) listIncidents(ctx echo.Context) error {
+	bundles, err := eng.incident.Bundles()
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, bundles)
+}
+
+// downloadIncident download an evidence bundle
+func (eng *Engine) downloadIncident(ctx echo.Context) error {
+	path, err := eng.incident.BundlePath(ctx.Param("name"))
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return ctx.Attachment(path, ctx.Param("name"))
+}
+
+// capturePprof capture profiles of an app and wait until they are written,
+// a cpu profile takes the requested seconds
+func (eng *Engine) capturePprof(ctx echo.Context) error {
+	var req pprof.Request
+	if err := ctx.Bind(&req); err != nil {
+		return reply400(ctx, err.Error())
+	}
+	profiles, err := eng.pprof.Capture(ctx.Request().Context(), req)
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, profiles)
+}
+
+// listPprof list captured profiles
+func (eng *Engine) listPprof(ctx echo.Context) error {
+	profiles, err := eng.pprof.Profiles()
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, profiles)
+}
+
+// downloadPprof download a profile
+func (eng *Engine) downloadPprof(ctx echo.Context) error {
+	path, err := eng.pprof.ProfilePath(ctx.Param("name"))
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return ctx.Attachment(path, ctx.Param("name"))
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
 func reply200(ctx echo.Context, data interface{}) error {
 	return ctx.JSON(200, map[string]interface{}{
 		"code": 200,
@@ -0,0 +1,83 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/labstack/echo/v4"
+)
+
+// validToken checks value of an "authorization" header or metadata against api.token,
+// every value is refused if api.token is empty
+func validToken(value string) bool {
+	token := conf.GetString("api.token")
+	if token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(value, "Bearer ")), []byte(token)) == 1
+}
+
+// requireToken guards http routes that change the host or read data off it,
+// the token is the one downstream agents are configured with in gateway mode
+func requireToken(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		if !validToken(ctx.Request().Header.Get(echo.HeaderAuthorization)) {
+			return ctx.JSON(http.StatusUnauthorized, map[string]interface{}{
+				"code": http.StatusUnauthorized,
+				"msg":  "invalid token",
+			})
+		}
+		return next(ctx)
+	}
+}
+
+// requireLoopback guards http routes serving decrypted app configs, which are only for apps
+// on the same host and never leave it
+func requireLoopback(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		if !isLoopback(ctx.Request().RemoteAddr) {
+			return ctx.JSON(http.StatusForbidden, map[string]interface{}{
+				"code": http.StatusForbidden,
+				"msg":  "only served to local apps",
+			})
+		}
+		return next(ctx)
+	}
+}
+
+// isLoopback whether the peer address of a connection is on the same host
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// peerIP address of the connected peer recorded in audit entries, X-Real-IP and
+// X-Forwarded-For are set by the client and can not be trusted
+func peerIP(ctx echo.Context) string {
+	host, _, err := net.SplitHostPort(ctx.Request().RemoteAddr)
+	if err != nil {
+		return ctx.Request().RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/configpb"
+	"github.com/douyu/juno-agent/pkg/structs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// configService implements configpb.ConfigServiceServer on top of the config files written by confProxy
+type configService struct {
+	eng *Engine
+}
+
+// Subscribe sends every version of the app config file after req.Version until the client goes away.
+// the stream waits for the first version if the file has not been written by the agent yet.
+// the content is decrypted and the grpc server has no tls, so it is only streamed to local apps
+func (s *configService) Subscribe(req *configpb.SubscribeRequest, stream configpb.ConfigService_SubscribeServer) error {
+	ctx := stream.Context()
+	if err := authorizeGRPC(ctx); err != nil {
+		return err
+	}
+	if p, ok := peer.FromContext(ctx); !ok || !isLoopback(p.Addr.String()) {
+		return status.Error(codes.PermissionDenied, "only served to local apps")
+	}
+	if s.eng.confProxy == nil {
+		return status.Error(codes.Unavailable, "confProxy is disabled")
+	}
+	if req.App == "" || req.File == "" {
+		return status.Error(codes.InvalidArgument, "app and file are required")
+	}
+
+	version := req.Version
+	for {
+		node, err := s.eng.confProxy.NextConfig(ctx, req.App, req.File, version)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(configUpdate(node)); err != nil {
+			return err
+		}
+		version = node.Configuration.Metadata.Version
+	}
+}
+
+func configUpdate(node *structs.ConfNode) *configpb.ConfigUpdate {
+	return &configpb.ConfigUpdate{
+		App:       node.AppName,
+		Env:       node.AppEnvi,
+		File:      node.FileName,
+		Port:      node.Port,
+		Content:   node.Configuration.Content,
+		Version:   node.Configuration.Metadata.Version,
+		Format:    node.Configuration.Metadata.Format,
+		Timestamp: node.Configuration.Metadata.Timestamp,
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/configpb"
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// versionSource keeps the latest version of one config file and wakes up the waiting watchers
+// when a new one is put, only WatchVersion of confProxy.DataSource is implemented
+type versionSource struct {
+	confProxy.DataSource
+
+	mu       sync.Mutex
+	node     *structs.ConfNode
+	changed  chan struct{}
+	watchers int
+}
+
+func newVersionSource() *versionSource {
+	return &versionSource{changed: make(chan struct{})}
+}
+
+func (s *versionSource) put(version, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.node = &structs.ConfNode{
+		AppName:  "app",
+		AppEnvi:  "dev",
+		Port:     "9999",
+		FileName: "config.toml",
+		Configuration: &structs.AppConfiguration{
+			Content:  content,
+			Metadata: structs.Metadata{Format: "toml", Version: version, Timestamp: 1600000000},
+		},
+	}
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *versionSource) WatchVersion(ctx context.Context, app, file, version string) (*structs.ConfNode, error) {
+	s.mu.Lock()
+	s.watchers++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.watchers--
+		s.mu.Unlock()
+	}()
+
+	for {
+		s.mu.Lock()
+		node, changed := s.node, s.changed
+		s.mu.Unlock()
+		if node != nil && node.Configuration.Metadata.Version != version {
+			return node, nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *versionSource) watching() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.watchers
+}
+
+// subscribeStream collects the updates sent by Subscribe
+type subscribeStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	updates chan *configpb.ConfigUpdate
+}
+
+func (s *subscribeStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *subscribeStream) Send(update *configpb.ConfigUpdate) error {
+	s.updates <- update
+	return nil
+}
+
+// subscribeContext is the context of a stream opened by a client at addr with token
+func subscribeContext(addr, token string) context.Context {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	return peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(addr), Port: 50000}})
+}
+
+func TestConfigServiceSubscribe(t *testing.T) {
+	assert.Nil(t, conf.Set("api.token", "secret"))
+	defer func() {
+		_ = conf.Set("api.token", "")
+	}()
+
+	source := newVersionSource()
+	s := &configService{eng: &Engine{confProxy: confProxy.NewConfProxy(true, source)}}
+
+	// subscribe starts a stream and returns the channel receiving the error Subscribe returns with
+	subscribe := func(ctx context.Context, req *configpb.SubscribeRequest) (*subscribeStream, <-chan error) {
+		stream := &subscribeStream{ctx: ctx, updates: make(chan *configpb.ConfigUpdate, 10)}
+		done := make(chan error, 1)
+		go func() {
+			done <- s.Subscribe(req, stream)
+		}()
+		return stream, done
+	}
+	receive := func(t *testing.T, stream *subscribeStream) *configpb.ConfigUpdate {
+		select {
+		case update := <-stream.updates:
+			return update
+		case <-time.After(time.Second):
+			t.Fatal("no update received")
+			return nil
+		}
+	}
+
+	t.Run("latest version first, then every update", func(t *testing.T) {
+		source.put("v1", "a = 1")
+		ctx, cancel := context.WithCancel(subscribeContext("127.0.0.1", "secret"))
+		defer cancel()
+		stream, done := subscribe(ctx, &configpb.SubscribeRequest{App: "app", File: "config.toml"})
+
+		update := receive(t, stream)
+		assert.Equal(t, &configpb.ConfigUpdate{
+			App:       "app",
+			Env:       "dev",
+			File:      "config.toml",
+			Port:      "9999",
+			Content:   "a = 1",
+			Version:   "v1",
+			Format:    "toml",
+			Timestamp: 1600000000,
+		}, update)
+
+		source.put("v2", "a = 2")
+		update = receive(t, stream)
+		assert.Equal(t, "v2", update.Version)
+		assert.Equal(t, "a = 2", update.Content)
+
+		// the client goes away, the stream stops waiting for new versions
+		cancel()
+		select {
+		case err := <-done:
+			assert.Equal(t, context.Canceled, err)
+		case <-time.After(time.Second):
+			t.Fatal("Subscribe is not returned after the client goes away")
+		}
+		assert.Equal(t, 0, source.watching())
+		source.put("v3", "a = 3")
+		assert.Len(t, stream.updates, 0)
+	})
+
+	t.Run("starts from the version known by the client", func(t *testing.T) {
+		source.put("v4", "a = 4")
+		ctx, cancel := context.WithCancel(subscribeContext("127.0.0.1", "secret"))
+		defer cancel()
+		stream, _ := subscribe(ctx, &configpb.SubscribeRequest{App: "app", File: "config.toml", Version: "v4"})
+
+		assert.Eventually(t, func() bool {
+			return source.watching() == 1
+		}, time.Second, 10*time.Millisecond)
+		assert.Len(t, stream.updates, 0)
+
+		source.put("v5", "a = 5")
+		assert.Equal(t, "v5", receive(t, stream).Version)
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		tests := []struct {
+			name string
+			ctx  context.Context
+			req  *configpb.SubscribeRequest
+			eng  *Engine
+			code codes.Code
+		}{
+			{"invalid token", subscribeContext("127.0.0.1", "wrong"), &configpb.SubscribeRequest{App: "app", File: "config.toml"}, s.eng, codes.Unauthenticated},
+			{"remote client", subscribeContext("10.0.0.1", "secret"), &configpb.SubscribeRequest{App: "app", File: "config.toml"}, s.eng, codes.PermissionDenied},
+			{"confProxy disabled", subscribeContext("127.0.0.1", "secret"), &configpb.SubscribeRequest{App: "app", File: "config.toml"}, &Engine{}, codes.Unavailable},
+			{"file missing", subscribeContext("127.0.0.1", "secret"), &configpb.SubscribeRequest{App: "app"}, s.eng, codes.InvalidArgument},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				stream := &subscribeStream{ctx: tt.ctx, updates: make(chan *configpb.ConfigUpdate, 1)}
+				err := (&configService{eng: tt.eng}).Subscribe(tt.req, stream)
+				assert.Equal(t, tt.code, status.Code(err))
+				assert.Len(t, stream.updates, 0)
+			})
+		}
+	})
+}
@@ -17,23 +17,50 @@ package core
 import (
 	"context"
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/douyu/juno-agent/pkg/audit"
 	"github.com/douyu/juno-agent/pkg/check"
+	"github.com/douyu/juno-agent/pkg/envelope"
+	"github.com/douyu/juno-agent/pkg/etcdv3"
+	"github.com/douyu/juno-agent/pkg/facts"
+	"github.com/douyu/juno-agent/pkg/file"
+	"github.com/douyu/juno-agent/pkg/gateway"
+	"github.com/douyu/juno-agent/pkg/heartbeat"
+	"github.com/douyu/juno-agent/pkg/incident"
 	"github.com/douyu/juno-agent/pkg/job"
+	"github.com/douyu/juno-agent/pkg/keyring"
+	"github.com/douyu/juno-agent/pkg/logtail"
 	"github.com/douyu/juno-agent/pkg/mbus"
 	"github.com/douyu/juno-agent/pkg/mbus/rocketmq"
 	"github.com/douyu/juno-agent/pkg/nginx"
+	"github.com/douyu/juno-agent/pkg/pmt/container"
 	"github.com/douyu/juno-agent/pkg/pmt/supervisor"
 	"github.com/douyu/juno-agent/pkg/pmt/systemd"
+	"github.com/douyu/juno-agent/pkg/pprof"
+	"github.com/douyu/juno-agent/pkg/pressure"
 	"github.com/douyu/juno-agent/pkg/process"
+	"github.com/douyu/juno-agent/pkg/procstat"
+	"github.com/douyu/juno-agent/pkg/profile"
 	"github.com/douyu/juno-agent/pkg/proxy/confProxy"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/etcd"
 	"github.com/douyu/juno-agent/pkg/proxy/regProxy"
+	"github.com/douyu/juno-agent/pkg/reaper"
+	"github.com/douyu/juno-agent/pkg/reboot"
 	"github.com/douyu/juno-agent/pkg/report"
+	"github.com/douyu/juno-agent/pkg/secret"
 	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/pkg/terminal"
+	"github.com/douyu/juno-agent/pkg/timeline"
+	"github.com/douyu/juno-agent/pkg/tracing"
+	"github.com/douyu/juno-agent/pkg/tunnel"
 	"github.com/douyu/jupiter"
-	"github.com/douyu/jupiter/pkg/client/etcdv3"
+	"github.com/douyu/jupiter/pkg/conf"
 	"github.com/douyu/jupiter/pkg/util/xgo"
 	"github.com/douyu/jupiter/pkg/xlog"
 	"golang.org/x/sync/errgroup"
@@ -57,13 +84,38 @@ type Engine struct {
 	regProxy          *regProxy.RegProxy
 	report            *report.Report
 	supervisorScanner *supervisor.Scanner
+	supervisorRPC     *supervisor.Client // nil unless plugin.supervisor.rpc is enabled
 	systemdScanner    *systemd.Scanner
+	systemdUnits      *systemd.Manager // nil unless plugin.systemd.dbus is enabled
+	containers        *container.Inspector
+	procstat          *procstat.Collector
+	facts             *facts.Collector
+	heartbeat         *heartbeat.Heartbeat
+	pprof             *pprof.Capturer
+	logtail           *logtail.Tailer
+	files             *file.Transfer
+	terminal          *terminal.Server
 	nginxScanner      *nginx.ConfScanner
+	worker            job.Manager
+	timeline          *timeline.Timeline
+	pressure          *pressure.Monitor
+	reaper            *reaper.Reaper
+	profile           *profile.Syncer
+	reboot            *reboot.Orchestrator
+	incident          *incident.Recorder
+	audit             *audit.Log
+	keyring           *keyring.Keyring
+	gateway           *gateway.Gateway
+	tunnel            *tunnel.Tunnel
+	runningApps       map[string]struct{} // commands seen in last process scan
+	stop              chan struct{}       // closed when the engine stops
 }
 
 // NewEngine new the engine
 func NewEngine() *Engine {
-	eng := &Engine{}
+	eng := &Engine{
+		stop: make(chan struct{}),
+	}
 	//eng.SetRegistry(
 	//	compound_registry.New(
 	//		etcdv3_registry.StdConfig("test").Build(),
@@ -72,7 +124,19 @@ func NewEngine() *Engine {
 
 	if err := eng.Startup(
 		eng.startLogRecord,
-		eng.startReportStatus, // start report agent status
+		eng.startProfile,            // apply plugin settings declared in git before plugins start
+		eng.startTimeline,           // record host state transitions
+		eng.startIncident,           // capture evidence on high-severity events
+		eng.startPprof,              // capture profiles of local apps on demand
+		eng.startLogtail,            // serve the end of app log files to the admin
+		eng.startFileTransfer,       // write and read files for the admin under allowed dirs
+		eng.startAudit,              // audit log of job mutations
+		eng.startKeyring,            // per-tenant data keys
+		eng.startTerminal,           // web terminal sessions, audited so started after the audit log
+		eng.startPressure,           // shed best-effort work under host pressure
+		eng.startReaper,             // reap zombie children when running as PID 1
+		eng.startContainerInspector, // collect app containers, included in the status report
+		eng.startReportStatus,       // start report agent status
 		eng.startNginxConfScanner,
 		eng.loadServiceNode, // load service nodes, and init configurations
 		eng.startProcessScanner,
@@ -84,21 +148,189 @@ func NewEngine() *Engine {
 		eng.startShellProxy,        // start shell execution proxy,
 		eng.startHealthScanner,     // start health scanner,
 		eng.startHealCheck,
+		eng.startGateway, // proxy api calls to downstream agents in gateway mode
 		eng.serveGRPC,
 		eng.serveHTTP,
 		eng.startWorker,
+		eng.startProcstat,  // sample resource usage of app processes and job tasks
+		eng.startFacts,     // publish the host inventory once the installed apps are known
+		eng.startHeartbeat, // register the agent under a lease, status of the worker included
+		eng.startReboot,    // resume the reboot workflow after the host comes back
+		eng.startReload,    // apply config changes on SIGHUP without restart
 	); err != nil {
 		xlog.Panic("new engine", xlog.Any("err", err))
 	}
 	return eng
 }
 
+// Run run the engine until it is stopped, then close the stop channel of the engine
+func (eng *Engine) Run() error {
+	defer close(eng.stop)
+	return eng.Application.Run()
+}
+
 // startLogRecord start log record
 func (eng *Engine) startLogRecord() error {
 	xlog.DefaultLogger = xlog.StdConfig("default").Build()
 	return nil
 }
 
+// startProfile sync host profiles from git, settings changed after startup are recorded to timeline as drift
+func (eng *Engine) startProfile() error {
+	config := profile.StdConfig("profile")
+	if len(config.Groups) == 0 {
+		config.Groups = conf.GetStringSlice("plugin.worker.nodeGroups")
+	}
+	eng.profile = config.Build()
+	eng.profile.OnDrift = func(status profile.Status) {
+		keys := make([]string, 0, len(status.Drift))
+		for _, drift := range status.Drift {
+			keys = append(keys, drift.Key)
+		}
+		message := "plugin settings match host profiles"
+		if len(keys) > 0 {
+			message = "plugin settings drifted from host profiles, restart agent to apply: " + strings.Join(keys, ", ")
+		}
+		eng.timeline.Record(timeline.Event{
+			Kind:    timeline.KindProfile,
+			Message: message,
+			Meta:    map[string]string{"commit": status.Commit},
+		})
+	}
+	return eng.profile.Start()
+}
+
+// startTimeline open the local host state timeline and record agent start
+func (eng *Engine) startTimeline() error {
+	eng.timeline = timeline.StdConfig("timeline").Build()
+	if err := eng.timeline.Start(); err != nil {
+		return err
+	}
+	eng.timeline.Record(timeline.Event{
+		Kind:    timeline.KindAgentStart,
+		Message: "juno-agent started",
+		Meta: map[string]string{
+			"pid": strconv.Itoa(os.Getpid()),
+		},
+	})
+	return nil
+}
+
+// startPprof profiles are only captured when requested through the api
+func (eng *Engine) startPprof() error {
+	eng.pprof = pprof.StdConfig("pprof").Build()
+	return nil
+}
+
+// startLogtail log files are only read when requested through the api
+func (eng *Engine) startLogtail() error {
+	eng.logtail = logtail.StdConfig("logtail").Build()
+	return nil
+}
+
+// startFileTransfer files are only written or read when requested through the api
+func (eng *Engine) startFileTransfer() error {
+	eng.files = file.StdConfig("file").Build()
+	return nil
+}
+
+// startIncident start incident evidence recorder
+func (eng *Engine) startIncident() error {
+	eng.incident = incident.StdConfig("incident").Build()
+	return nil
+}
+
+// startAudit open the audit log of job mutations and manual operations
+func (eng *Engine) startAudit() error {
+	eng.audit = audit.StdConfig("audit").Build()
+	return eng.audit.Start()
+}
+
+// startTerminal shells are only spawned when the console connects
+func (eng *Engine) startTerminal() error {
+	config := terminal.StdConfig("terminal")
+	config.Audit = eng.audit
+	eng.terminal = config.Build()
+	return nil
+}
+
+// startKeyring load per-tenant data keys wrapped by the master key
+func (eng *Engine) startKeyring() (err error) {
+	eng.keyring, err = keyring.StdConfig("keyring").Build()
+	return err
+}
+
+// startReaper collect zombie children nobody waits for, only when the agent is PID 1 or a subreaper
+func (eng *Engine) startReaper() error {
+	eng.reaper = reaper.StdConfig("reaper").Build()
+	if err := eng.reaper.Start(); err != nil {
+		return err
+	}
+	xgo.Go(func() {
+		<-eng.stop
+		eng.reaper.Stop()
+	})
+	return nil
+}
+
+// startPressure sample pressure stall information and record pressure transitions to timeline
+func (eng *Engine) startPressure() error {
+	eng.pressure = pressure.StdConfig("pressure").Build()
+	eng.pressure.OnChange = func(pressured bool, reason string, sample pressure.Sample) {
+		message := "host pressure cleared"
+		if pressured {
+			message = "host under pressure: " + reason
+		}
+		eng.timeline.Record(timeline.Event{
+			Kind:    timeline.KindPressure,
+			Message: message,
+			Meta: map[string]string{
+				"cpu":    strconv.FormatFloat(sample.CPU, 'f', 2, 64),
+				"memory": strconv.FormatFloat(sample.Memory, 'f', 2, 64),
+				"io":     strconv.FormatFloat(sample.IO, 'f', 2, 64),
+			},
+		})
+	}
+	return eng.pressure.Start()
+}
+
+// recordIncident record the captured evidence bundle to timeline
+func (eng *Engine) recordIncident(bundle *incident.Bundle, target, message string) {
+	eng.timeline.Record(timeline.Event{
+		Kind:    timeline.KindIncident,
+		Target:  target,
+		Message: message,
+		Meta: map[string]string{
+			"bundle": bundle.Name,
+		},
+	})
+}
+
+// onJobFailure capture evidence when a job keeps failing
+func (eng *Engine) onJobFailure(result *job.TaskResult, failures int) {
+	bundle, ok := eng.incident.JobFailed(result.Job.ID, failures, map[string]string{
+		"task_id": strconv.FormatUint(result.TaskID, 10),
+		"status":  string(result.Status),
+	})
+	if ok {
+		eng.recordIncident(bundle, result.Job.ID, fmt.Sprintf("job failed %d times in a row", failures))
+	}
+}
+
+// onJobAnomaly record runs that took abnormally long to timeline, before slow jobs start to overlap
+func (eng *Engine) onJobAnomaly(result *job.TaskResult, anomaly *job.DurationAnomaly) {
+	eng.timeline.Record(timeline.Event{
+		Kind:    timeline.KindJobAnomaly,
+		Target:  result.Job.ID,
+		Message: "job " + anomaly.Reason,
+		Meta: map[string]string{
+			"task_id": strconv.FormatUint(result.TaskID, 10),
+			"median":  strconv.FormatFloat(anomaly.Median, 'f', 1, 64),
+			"stddev":  strconv.FormatFloat(anomaly.StdDev, 'f', 1, 64),
+		},
+	})
+}
+
 // loadServiceNode ... TODO
 func (eng *Engine) loadServiceNode() error { // load service node from local storage
 	// recover fast when run fail
@@ -107,12 +339,27 @@ func (eng *Engine) loadServiceNode() error { // load service node from local sto
 
 // startConfProxy start app conf plugin
 func (eng *Engine) startConfProxy() error {
-	eng.confProxy = confProxy.StdConfig("confProxy").Build()
+	config := confProxy.StdConfig("confProxy")
+	config.Keyring = eng.keyring
+	config.Drift.OnDrift = eng.onConfigDrift
+	config.Facts = eng.nodeFacts()
+	eng.confProxy = config.Build()
 	eng.confProxy.Start()
 	xgo.Go(func() {
 		for node := range eng.confProxy.C() {
 			// Monitor the confNode information of confProxy and bring the node into the Engine for management
 			eng.upsertConfClient(node)
+			if node.Configuration != nil {
+				eng.timeline.Record(timeline.Event{
+					Kind:    timeline.KindConfigChange,
+					Target:  node.AppName,
+					Message: "config " + node.FileName + " changed",
+					Meta: map[string]string{
+						"version": node.Configuration.Metadata.Version,
+						"env":     node.AppEnvi,
+					},
+				})
+			}
 			// 1.0 Prefetch the registration configuration information for the pull configuration client application
 			if err := eng.loadServiceConfiguration(node.AppName); err != nil {
 				xlog.Error("load service configuration")
@@ -122,6 +369,40 @@ func (eng *Engine) startConfProxy() error {
 	return nil
 }
 
+// nodeFacts node information that config templates are rendered with
+func (eng *Engine) nodeFacts() etcd.Facts {
+	node := eng.report.Config()
+	return etcd.Facts{
+		IP:       report.ReturnAppIp(),
+		Hostname: node.HostName,
+		Env:      node.Env,
+		Region:   node.RegionCode,
+		Zone:     node.ZoneCode,
+		Labels:   conf.GetStringMapString("plugin.worker.labels"),
+	}
+}
+
+// onConfigDrift record config files modified outside of the agent, and when they are consistent again
+func (eng *Engine) onConfigDrift(drift etcd.Drift) {
+	message := "config " + drift.Path + " is consistent again"
+	switch {
+	case drift.Healed:
+		message = "config " + drift.Path + " was " + drift.Reason + ", rewritten"
+	case drift.Reason != "":
+		message = "config " + drift.Path + " was " + drift.Reason
+	}
+	eng.timeline.Record(timeline.Event{
+		Kind:    timeline.KindConfigDrift,
+		Target:  drift.AppName,
+		Message: message,
+		Meta: map[string]string{
+			"version":  drift.Version,
+			"expected": drift.Expected,
+			"actual":   drift.Actual,
+		},
+	})
+}
+
 // startRegProxy start app regist proxy plugin
 func (eng *Engine) startRegProxy() error {
 	eng.regProxy = regProxy.StdConfig("regProxy").Build()
@@ -151,7 +432,9 @@ func (eng *Engine) startHealthScanner() error {
 
 // startSupervisorScanner check and scan supervisor config
 func (eng *Engine) startSupervisorScanner() error {
-	eng.supervisorScanner = supervisor.StdConfig("supervisor").Build()
+	config := supervisor.StdConfig("supervisor")
+	eng.supervisorScanner = config.Build()
+	eng.supervisorRPC = config.RPC.Build()
 	if err := eng.supervisorScanner.Start(); err != nil {
 		return err
 	}
@@ -173,7 +456,9 @@ func (eng *Engine) startSupervisorScanner() error {
 
 // startSystemdScanner check and scan systemd cofig
 func (eng *Engine) startSystemdScanner() error {
-	eng.systemdScanner = systemd.StdConfig("systemd").Build()
+	config := systemd.StdConfig("systemd")
+	eng.systemdScanner = config.Build()
+	eng.systemdUnits = config.DBus.Build(config.Dir)
 	if err := eng.systemdScanner.Start(); err != nil {
 		return err
 	}
@@ -196,6 +481,7 @@ func (eng *Engine) startSystemdScanner() error {
 // startProcessScanner check go process
 func (eng *Engine) startProcessScanner() error {
 	eng.process = process.StdConfig("process").Build()
+	eng.process.Pressure = eng.pressure
 	if err := eng.process.Start(); err != nil {
 		return err
 	}
@@ -252,9 +538,21 @@ func (eng *Engine) startNginxConfScanner() error {
 	return nil
 }
 
+// startContainerInspector collect docker or cri containers of apps on the node
+func (eng *Engine) startContainerInspector() error {
+	eng.containers = container.StdConfig("container").Build()
+	if eng.containers == nil {
+		return nil
+	}
+	return eng.containers.Start()
+}
+
 // startReportStatus monitor the health status of the machine deployed by the agent, and regularly report the health information to the caller
 func (eng *Engine) startReportStatus() error {
 	eng.report = report.StdConfig("report").Build()
+	if eng.containers != nil {
+		eng.report.SetContainers(eng.containers.Statuses)
+	}
 	err := eng.report.ReportAgentStatus()
 	return err
 }
@@ -265,11 +563,156 @@ func (eng *Engine) startHealCheck() error {
 	return nil
 }
 
+// startProcstat sample the processes of managed apps and running job tasks
+func (eng *Engine) startProcstat() error {
+	eng.procstat = procstat.StdConfig("procstat").Build()
+	eng.procstat.Targets = eng.procstatTargets
+	return eng.procstat.Start()
+}
+
+// startFacts collect host facts and publish them under the node key
+func (eng *Engine) startFacts() error {
+	config := facts.StdConfig("facts")
+	node := eng.report.Config()
+	config.Node = facts.Node{
+		Hostname: node.HostName,
+		IP:       report.ReturnAppIp(),
+		Env:      node.Env,
+		Region:   node.RegionCode,
+		Zone:     node.ZoneCode,
+		Labels:   conf.GetStringMapString("plugin.worker.labels"),
+	}
+	eng.facts = config.Build()
+	eng.facts.Apps = eng.installedApps
+	return eng.facts.Start()
+}
+
 func (eng *Engine) startWorker() error {
-	worker := job.StdConfig("worker").Build()
+	config := job.StdConfig("worker")
+	config.OnFailure = eng.onJobFailure
+	config.OnAnomaly = eng.onJobAnomaly
+	config.Tracer = tracing.StdConfig("tracing").Build()
+	config.Audit = eng.audit
+	config.Keyring = eng.keyring
+	config.Pressure = eng.pressure
+	writer, err := envelope.StdConfig("envelope").Build()
+	if err != nil {
+		return err
+	}
+	config.Envelope = writer
+	secrets, err := secret.StdConfig("secret").Build()
+	if err != nil {
+		return err
+	}
+	config.Secrets = secrets
+	worker := config.Build()
+	eng.worker = worker
 	return worker.Run()
 }
 
+// startHeartbeat keep the node key alive, it is deleted by etcd when the agent is down
+func (eng *Engine) startHeartbeat() error {
+	config := heartbeat.StdConfig("heartbeat")
+	node := eng.report.Config()
+	config.Hostname = node.HostName
+	config.IP = report.ReturnAppIp()
+	config.Env = node.Env
+	eng.heartbeat = config.Build()
+	eng.heartbeat.Status = eng.heartbeatStatus
+	return eng.heartbeat.Start()
+}
+
+// heartbeatStatus readiness and load of the job worker
+func (eng *Engine) heartbeatStatus() heartbeat.Status {
+	var status heartbeat.Status
+	if eng.worker == nil {
+		return status
+	}
+	health := eng.worker.Health()
+	status.Ready = health.Ready
+	status.Jobs = health.Jobs
+	status.Watches = len(health.Watches)
+	for _, watch := range health.Watches {
+		if !watch.Established {
+			status.WatchesDown = append(status.WatchesDown, watch.Prefix)
+		}
+	}
+	status.RunningTasks = len(eng.worker.RunningProcesses())
+	return status
+}
+
+// startReboot drain jobs and registrations before reboot, and verify services after the host comes back
+func (eng *Engine) startReboot() error {
+	eng.reboot = reboot.StdConfig("reboot").Build()
+	eng.reboot.Drain = eng.drain
+	eng.reboot.Undrain = eng.undrain
+	eng.reboot.Services = eng.runningServices
+	eng.reboot.OnChange = eng.recordReboot
+	return eng.reboot.Start()
+}
+
+// drain stop service registrations and jobs on current host
+func (eng *Engine) drain(ctx context.Context) error {
+	if eng.regProxy != nil {
+		deleted, err := eng.regProxy.Deregister(ctx)
+		if err != nil {
+			return err
+		}
+		xlog.Info("drain registrations", xlog.Int("deleted", deleted))
+	}
+	if eng.worker != nil {
+		return eng.worker.Drain(ctx)
+	}
+	return nil
+}
+
+// undrain resume registrations and jobs when the host does not go down after drain
+func (eng *Engine) undrain() {
+	if eng.regProxy != nil {
+		eng.regProxy.Resume()
+	}
+	if eng.worker != nil {
+		eng.worker.Undrain()
+	}
+	xlog.Info("drain cancelled, registrations and jobs resumed")
+}
+
+// runningServices commands of processes found in the last process scan
+func (eng *Engine) runningServices() []string {
+	var services []string
+	eng.processMap.Range(func(key, _ interface{}) bool {
+		services = append(services, key.(string))
+		return true
+	})
+	sort.Strings(services)
+	return services
+}
+
+// recordReboot mark the maintenance window of reboot in timeline
+func (eng *Engine) recordReboot(state reboot.State) {
+	event := timeline.Event{
+		Kind:    timeline.KindMaintenance,
+		Target:  "reboot",
+		Message: state.Reason,
+		Meta: map[string]string{
+			"phase": state.Phase,
+		},
+	}
+	switch state.Phase {
+	case reboot.PhaseDraining:
+		event.Meta["action"] = "start"
+		event.Meta["expected_back"] = state.ExpectedBack.Format(time.RFC3339)
+	case reboot.PhaseCompleted, reboot.PhaseFailed:
+		event.Meta["action"] = "end"
+		if state.Error != "" {
+			event.Meta["error"] = state.Error
+		}
+	default:
+		return
+	}
+	eng.timeline.Record(event)
+}
+
 func (eng *Engine) loadServiceConfiguration(name string) interface{} {
 	return nil
 }
@@ -0,0 +1,80 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/douyu/juno-agent/pkg/gateway"
+	"github.com/labstack/echo/v4"
+)
+
+// max request body forwarded to every agent in a fan-out call
+const gatewayMaxBody = 1 << 20
+
+// startGateway build the gateway to downstream agents when gateway mode is enabled
+func (eng *Engine) startGateway() (err error) {
+	eng.gateway, err = gateway.StdConfig("gateway").Build()
+	return err
+}
+
+// gatewayAgents list downstream agents
+func (eng *Engine) gatewayAgents(ctx echo.Context) error {
+	if eng.gateway == nil {
+		return reply400(ctx, "gateway mode is not enabled")
+	}
+	return reply200(ctx, eng.gateway.Agents())
+}
+
+// gatewayProxy forward the request to api of a downstream agent, e.g.
+// POST /api/gateway/agents/edge-1/jobs/1/trigger -> POST {edge-1}/api/jobs/1/trigger
+func (eng *Engine) gatewayProxy(ctx echo.Context) error {
+	if eng.gateway == nil {
+		return reply400(ctx, "gateway mode is not enabled")
+	}
+	if err := eng.gateway.Proxy(ctx.Response(), ctx.Request(), ctx.Param("agent"), ctx.Param("*")); err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return nil
+}
+
+// gatewayFanout send the request to all downstream agents, or agents in query "agents" separated by comma,
+// and aggregate the responses, e.g. GET /api/gateway/fanout/jobs?agents=edge-1,edge-2
+func (eng *Engine) gatewayFanout(ctx echo.Context) error {
+	if eng.gateway == nil {
+		return reply400(ctx, "gateway mode is not enabled")
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(ctx.Request().Body, gatewayMaxBody))
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+
+	var agents []string
+	if v := ctx.QueryParam("agents"); v != "" {
+		agents = strings.Split(v, ",")
+	}
+	query := ctx.QueryParams()
+	query.Del("agents")
+
+	req := ctx.Request()
+	results, err := eng.gateway.Fanout(req.Context(), req.Header, req.Method, ctx.Param("*"), query.Encode(), body, agents)
+	if err != nil {
+		return reply400(ctx, err.Error())
+	}
+	return reply200(ctx, results)
+}
@@ -17,15 +17,19 @@ package core
 import (
 	"context"
 	"github.com/cenkalti/backoff"
+	"net/http"
 	"time"
 
 	"github.com/douyu/juno-agent/pkg/structs"
 	"github.com/douyu/jupiter/pkg/util/xnet"
+	"github.com/labstack/echo/v4"
 )
 
 var (
 	dialer = xnet.Dial
 	now    = time.Now
+
+	startedAt = time.Now()
 )
 
 func ping(ctx context.Context, node *structs.ServiceNode) error {
@@ -38,3 +42,28 @@ func ping(ctx context.Context, node *structs.ServiceNode) error {
 		return dialer(node.Address(), time.Second*1)
 	}, bo)
 }
+
+// healthz liveness of the agent process, answered as long as the http server is serving
+func (eng *Engine) healthz(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"status": "ok",
+		"uptime": now().Sub(startedAt).Round(time.Second).String(),
+	})
+}
+
+// readyz ready only when the job watches are established, the job store is reachable and the cron engine is running,
+// replies 503 with the same payload otherwise
+func (eng *Engine) readyz(ctx echo.Context) error {
+	if eng.worker == nil {
+		return ctx.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+			"ready": false,
+			"error": "worker is not running",
+		})
+	}
+	health := eng.worker.Health()
+	code := http.StatusOK
+	if !health.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	return ctx.JSON(code, health)
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"context"
+	"errors"
+
+	"github.com/douyu/juno-agent/pkg/job"
+	"github.com/douyu/juno-agent/pkg/job/jobpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// jobService implements jobpb.JobServiceServer on top of the local worker
+type jobService struct {
+	eng *Engine
+}
+
+// authorizeGRPC checks the token configured by api.token, which is required in
+// "authorization" metadata. job and config services refuse every call if it is empty
+func authorizeGRPC(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || !validToken(values[0]) {
+		return status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return nil
+}
+
+// worker returns the running worker, or an error if worker is not started yet
+func (s *jobService) worker(ctx context.Context) (job.Manager, error) {
+	if err := authorizeGRPC(ctx); err != nil {
+		return nil, err
+	}
+
+	if s.eng.worker == nil {
+		return nil, status.Error(codes.Unavailable, "worker is not running")
+	}
+	return s.eng.worker, nil
+}
+
+// ListJobs ...
+func (s *jobService) ListJobs(ctx context.Context, req *jobpb.ListJobsRequest) (*jobpb.ListJobsResponse, error) {
+	worker, err := s.worker(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &jobpb.ListJobsResponse{}
+	for _, j := range worker.Jobs() {
+		timers := make([]string, 0, len(j.Timers))
+		for _, timer := range j.Timers {
+			if !timer.Disabled {
+				timers = append(timers, timer.Cron)
+			}
+		}
+		resp.Jobs = append(resp.Jobs, &jobpb.Job{
+			Id:           j.ID,
+			Name:         j.Name,
+			Script:       j.Script,
+			Timers:       timers,
+			Enable:       j.Enable,
+			Timeout:      j.Timeout,
+			JobType:      int32(j.JobType),
+			RunningTasks: worker.RunningTasks(j.ID),
+		})
+	}
+	return resp, nil
+}
+
+// TriggerOnce ...
+func (s *jobService) TriggerOnce(ctx context.Context, req *jobpb.TriggerOnceRequest) (*jobpb.TriggerOnceResponse, error) {
+	worker, err := s.worker(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var taskID uint64
+	if req.JobId != "" {
+		taskID, err = worker.TriggerJob(req.JobId)
+	} else {
+		taskID, err = worker.RunOnce(req.Job, req.TaskId)
+	}
+	if err == job.ErrJobNotFound || errors.Is(err, job.ErrJobNotDefined) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if errors.Is(err, job.ErrJobUnauthorized) {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if err == job.ErrOnceQueueFull || err == job.ErrDraining {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &jobpb.TriggerOnceResponse{TaskId: taskID}, nil
+}
+
+// KillTask ...
+func (s *jobService) KillTask(ctx context.Context, req *jobpb.KillTaskRequest) (*jobpb.KillTaskResponse, error) {
+	worker, err := s.worker(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	killed, err := worker.KillTask(req.JobId, req.TaskId)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &jobpb.KillTaskResponse{Killed: killed}, nil
+}
+
+// StreamLogs sends output of a running task as it is produced, then the final status.
+// output of a finished task is sent at once
+func (s *jobService) StreamLogs(req *jobpb.StreamLogsRequest, stream jobpb.JobService_StreamLogsServer) error {
+	worker, err := s.worker(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	history, ch, cancel, err := worker.SubscribeOutput(req.TaskId)
+	if err == nil {
+		defer cancel()
+
+		if len(history) > 0 {
+			if err := stream.Send(&jobpb.LogChunk{Data: history}); err != nil {
+				return err
+			}
+		}
+		for done := false; !done; {
+			select {
+			case chunk, ok := <-ch:
+				if !ok {
+					done = true
+					break
+				}
+				if err := stream.Send(&jobpb.LogChunk{Data: chunk}); err != nil {
+					return err
+				}
+			case <-stream.Context().Done():
+				return stream.Context().Err()
+			}
+		}
+	}
+
+	runs, err := worker.JobRuns(req.JobId)
+	if err != nil {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	for _, run := range runs {
+		if run.TaskID != req.TaskId {
+			continue
+		}
+		last := &jobpb.LogChunk{Eof: true, Status: string(run.Status)}
+		if len(history) == 0 && ch == nil {
+			// task has finished before subscribing
+			last.Data = []byte(run.Logs)
+		}
+		return stream.Send(last)
+	}
+	return status.Error(codes.NotFound, "task not found")
+}
@@ -15,7 +15,17 @@
 package core
 
 import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/facts"
+	"github.com/douyu/juno-agent/pkg/procstat"
 	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/pkg/timeline"
 	"github.com/douyu/jupiter/pkg/util/xdebug"
 	"github.com/douyu/jupiter/pkg/xlog"
 )
@@ -32,14 +42,51 @@ func (eng *Engine) updateProgram(program *structs.ProgramExt) {
 	case "update":
 		eng.programs.Store(program.UUID(), program)
 	}
+	if program.Status != "list" {
+		eng.timeline.Record(timeline.Event{
+			Kind:    timeline.KindProgram,
+			Target:  program.ProgramName,
+			Message: program.Manager + " program " + program.Status,
+			Meta: map[string]string{
+				"file": program.FilePath,
+			},
+		})
+	}
 	xdebug.PrintObject("programs", program)
 }
 
 func (eng *Engine) updateProcesses(processes ...structs.ProcessStatus) {
+	running := make(map[string]struct{}, len(processes))
 	for _, info := range processes {
 		xlog.Info("process", xlog.Any("info", info))
 		eng.processMap.Store(info.Command, info)
+		running[info.Command] = struct{}{}
+
+		if _, ok := eng.runningApps[info.Command]; !ok {
+			eng.timeline.Record(timeline.Event{
+				Kind:    timeline.KindAppUp,
+				Target:  info.Command,
+				Message: "process started",
+				Meta: map[string]string{
+					"pid": info.PID,
+				},
+			})
+			if bundle, ok := eng.incident.AppRestarted(info.Command); ok {
+				eng.recordIncident(bundle, info.Command, "app is crash looping")
+			}
+		}
 	}
+	for command := range eng.runningApps {
+		if _, ok := running[command]; !ok {
+			eng.processMap.Delete(command)
+			eng.timeline.Record(timeline.Event{
+				Kind:    timeline.KindAppDown,
+				Target:  command,
+				Message: "process exited",
+			})
+		}
+	}
+	eng.runningApps = running
 }
 
 // updateNginxProgram  update nginx information to local cache
@@ -55,3 +102,60 @@ func (eng *Engine) updateNginxProgram(conf *structs.NginxConfExt) {
 		eng.programs.Store(conf.Name, conf)
 	}
 }
+
+// installedApps programs found in the conf dirs of supervisor and systemd, as kept by updateProgram
+func (eng *Engine) installedApps() []facts.App {
+	apps := make([]facts.App, 0)
+	eng.programs.Range(func(_, value interface{}) bool {
+		program := value.(*structs.ProgramExt)
+		apps = append(apps, facts.App{Name: program.ProgramName, Manager: program.Manager, File: program.FilePath})
+		return true
+	})
+	return apps
+}
+
+// procstatTargets processes to sample: go processes found by the process scanner,
+// running programs of supervisord and systemd when their apis are enabled, and job tasks
+func (eng *Engine) procstatTargets() []procstat.Target {
+	targets := make([]procstat.Target, 0)
+	eng.processMap.Range(func(_, value interface{}) bool {
+		info := value.(structs.ProcessStatus)
+		pid, err := strconv.Atoi(strings.TrimSpace(info.PID))
+		fields := strings.Fields(info.Command)
+		if err == nil && len(fields) > 0 {
+			targets = append(targets, procstat.Target{Kind: procstat.KindApp, Name: filepath.Base(fields[0]), PID: pid})
+		}
+		return true
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if eng.supervisorRPC != nil {
+		programs, err := eng.supervisorRPC.Programs(ctx)
+		if err != nil {
+			xlog.Warn("procstat list supervisor programs", xlog.FieldErr(err))
+		}
+		for _, program := range programs {
+			if program.PID > 0 {
+				targets = append(targets, procstat.Target{Kind: procstat.KindApp, Name: program.Name, PID: program.PID})
+			}
+		}
+	}
+	if eng.systemdUnits != nil {
+		units, err := eng.systemdUnits.Units(ctx)
+		if err != nil {
+			xlog.Warn("procstat list systemd units", xlog.FieldErr(err))
+		}
+		for _, unit := range units {
+			if unit.MainPID > 0 {
+				targets = append(targets, procstat.Target{Kind: procstat.KindApp, Name: unit.Name, PID: int(unit.MainPID)})
+			}
+		}
+	}
+	if eng.worker != nil {
+		for _, proc := range eng.worker.RunningProcesses() {
+			targets = append(targets, procstat.Target{Kind: procstat.KindJob, Name: fmt.Sprintf("%s/%d", proc.JobID, proc.TaskID), PID: proc.PID})
+		}
+	}
+	return targets
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/BurntSushi/toml"
+	"github.com/douyu/juno-agent/pkg/job"
+	"github.com/douyu/juno-agent/pkg/logging"
+	"github.com/douyu/juno-agent/pkg/timeline"
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/flag"
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// startReload re-read the config file on SIGHUP. Changes loaded by the file watch of jupiter
+// or applied from host profiles take effect the same way, without restarting the agent.
+func (eng *Engine) startReload() error {
+	// conf.OnChange may be notified while the configuration is locked, so reloads are queued
+	// and consecutive changes are applied once
+	reloads := make(chan struct{}, 1)
+	conf.OnChange(func(*conf.Configuration) {
+		select {
+		case reloads <- struct{}{}:
+		default:
+		}
+	})
+	xgo.Go(func() {
+		for range reloads {
+			eng.reloadConfig()
+		}
+	})
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	xgo.Go(func() {
+		for range signals {
+			if err := loadConfigFile(flag.String("config")); err != nil {
+				xlog.Error("reload config file failed", xlog.String("config", flag.String("config")), xlog.FieldErr(err))
+			}
+		}
+	})
+	return nil
+}
+
+// loadConfigFile merge the config file into the configuration, remote config sources watch by themselves
+func loadConfigFile(path string) error {
+	if path == "" || strings.Contains(path, "://") {
+		xlog.Info("config is not loaded from a local file, skip reloading", xlog.String("config", path))
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return conf.LoadFromReader(file, toml.Unmarshal)
+}
+
+// reloadConfig apply log levels and worker settings from the current configuration,
+// running jobs and established watches are kept
+func (eng *Engine) reloadConfig() {
+	for _, status := range logging.Reload() {
+		xlog.Info("log level reloaded", xlog.String("module", status.Module), xlog.String("level", status.Level))
+	}
+	if eng.worker == nil {
+		return
+	}
+
+	config, err := job.LoadConfig("worker")
+	if err != nil {
+		xlog.Error("load worker config failed", xlog.FieldErr(err))
+		return
+	}
+	result, err := eng.worker.Reload(config)
+	if err != nil {
+		xlog.Error("reload worker config failed, keep the previous one", xlog.FieldErr(err))
+		return
+	}
+	if len(result.Applied) == 0 && len(result.Restart) == 0 {
+		return
+	}
+
+	message := "agent config reloaded"
+	if len(result.Restart) > 0 {
+		message += ", restart agent to apply: " + strings.Join(result.Restart, ", ")
+	}
+	eng.timeline.Record(timeline.Event{
+		Kind:    timeline.KindConfigChange,
+		Target:  "juno-agent",
+		Message: message,
+		Meta: map[string]string{
+			"applied": strings.Join(result.Applied, ","),
+		},
+	})
+}
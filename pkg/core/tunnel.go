@@ -0,0 +1,36 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"net/http"
+
+	"github.com/douyu/juno-agent/pkg/tunnel"
+	"github.com/labstack/echo/v4"
+)
+
+// startTunnel connect to the relay and serve api over the tunnel, for hosts behind NAT
+func (eng *Engine) startTunnel(handler http.Handler) {
+	eng.tunnel = tunnel.StdConfig("tunnel").Build()
+	eng.tunnel.Start(handler)
+}
+
+// tunnelStatus whether the tunnel to the relay is established
+func (eng *Engine) tunnelStatus(ctx echo.Context) error {
+	return reply200(ctx, map[string]bool{
+		"enabled":   eng.tunnel != nil,
+		"connected": eng.tunnel.Connected(),
+	})
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envelope
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// Codec compresses the value before it is split into chunks.
+// the id is written in every chunk header, so it must never change once used
+type Codec interface {
+	ID() byte
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[byte]Codec{}
+	names    = map[string]Codec{}
+)
+
+func init() {
+	Register(noneCodec{})
+	Register(gzipCodec{})
+}
+
+// Register makes a codec available by id and name, e.g. to add zstd in a private build.
+// it panics if the id or name is already taken
+func Register(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	if _, ok := codecs[codec.ID()]; ok {
+		panic(fmt.Sprintf("envelope: codec id %d registered twice", codec.ID()))
+	}
+	if _, ok := names[codec.Name()]; ok {
+		panic(fmt.Sprintf("envelope: codec %s registered twice", codec.Name()))
+	}
+	codecs[codec.ID()] = codec
+	names[codec.Name()] = codec
+}
+
+// LookupCodec returns the codec registered with name
+func LookupCodec(name string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := names[name]
+	return codec, ok
+}
+
+func codecByID(id byte) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[id]
+	return codec, ok
+}
+
+type noneCodec struct{}
+
+func (noneCodec) ID() byte                               { return 0 }
+func (noneCodec) Name() string                           { return "none" }
+func (noneCodec) Compress(data []byte) ([]byte, error)   { return data, nil }
+func (noneCodec) Decompress(data []byte) ([]byte, error) { return data, nil }
+
+type gzipCodec struct{}
+
+func (gzipCodec) ID() byte     { return 1 }
+func (gzipCodec) Name() string { return "gzip" }
+
+func (gzipCodec) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	data, err = ioutil.ReadAll(io.LimitReader(r, MaxValueSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxValueSize {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
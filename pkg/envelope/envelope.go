@@ -0,0 +1,174 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envelope
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// Version of the chunk header
+const Version = 1
+
+// HeaderSize bytes of the header at the beginning of every chunk:
+// magic(4) version(1) codec(1) index(2) total(2) checksum(4)
+const HeaderSize = 14
+
+// MaxChunks max number of chunks of a value
+const MaxChunks = 1<<16 - 1
+
+// MaxValueSize max size of a decoded value, larger values are rejected
+// instead of exhausting memory, e.g. a crafted gzip bomb
+const MaxValueSize = 64 << 20
+
+// magic starts every chunk, the leading zero byte never starts a json or text value
+var magic = []byte{0x00, 'J', 'E', 'V'}
+
+var (
+	ErrNotEnvelope = errors.New("envelope: not an envelope")
+	ErrIncomplete  = errors.New("envelope: incomplete chunks")
+	ErrChecksum    = errors.New("envelope: checksum mismatch")
+	ErrTooLarge    = errors.New("envelope: value too large")
+)
+
+// Header of a chunk
+type Header struct {
+	Version  byte
+	Codec    byte
+	Index    uint16
+	Total    uint16
+	Checksum uint32 // crc32 (IEEE) of the whole value before compression
+}
+
+// IsEnvelope reports whether data is a chunk written in envelope,
+// values written as is by older agents or other clients are not
+func IsEnvelope(data []byte) bool {
+	return len(data) >= HeaderSize && bytes.Equal(data[:len(magic)], magic)
+}
+
+// ParseHeader returns the header and payload of a chunk
+func ParseHeader(data []byte) (Header, []byte, error) {
+	if !IsEnvelope(data) {
+		return Header{}, nil, ErrNotEnvelope
+	}
+	h := Header{
+		Version:  data[4],
+		Codec:    data[5],
+		Index:    binary.BigEndian.Uint16(data[6:8]),
+		Total:    binary.BigEndian.Uint16(data[8:10]),
+		Checksum: binary.BigEndian.Uint32(data[10:14]),
+	}
+	if h.Version != Version {
+		return h, nil, fmt.Errorf("envelope: unsupported version %d", h.Version)
+	}
+	if h.Total == 0 || h.Index >= h.Total {
+		return h, nil, fmt.Errorf("envelope: invalid chunk %d of %d", h.Index, h.Total)
+	}
+	return h, data[HeaderSize:], nil
+}
+
+func (h Header) append(dst []byte) []byte {
+	dst = append(dst, magic...)
+	dst = append(dst, h.Version, h.Codec)
+	dst = append(dst, byte(h.Index>>8), byte(h.Index), byte(h.Total>>8), byte(h.Total))
+	return append(dst, byte(h.Checksum>>24), byte(h.Checksum>>16), byte(h.Checksum>>8), byte(h.Checksum))
+}
+
+// Encode compresses value with codec and splits it into chunks of at most chunkSize bytes, headers included
+func Encode(value []byte, codec Codec, chunkSize int) ([][]byte, error) {
+	if chunkSize <= HeaderSize {
+		return nil, fmt.Errorf("envelope: chunk size %d is not larger than header", chunkSize)
+	}
+
+	if len(value) > MaxValueSize {
+		return nil, ErrTooLarge
+	}
+	compressed, err := codec.Compress(value)
+	if err != nil {
+		return nil, err
+	}
+
+	payloadSize := chunkSize - HeaderSize
+	total := (len(compressed) + payloadSize - 1) / payloadSize
+	if total == 0 {
+		total = 1
+	}
+	if total > MaxChunks {
+		return nil, fmt.Errorf("envelope: value of %d bytes needs more than %d chunks", len(value), MaxChunks)
+	}
+
+	h := Header{
+		Version:  Version,
+		Codec:    codec.ID(),
+		Total:    uint16(total),
+		Checksum: crc32.ChecksumIEEE(value),
+	}
+	chunks := make([][]byte, 0, total)
+	for i := 0; i < total; i++ {
+		payload := compressed[i*payloadSize:]
+		if len(payload) > payloadSize {
+			payload = payload[:payloadSize]
+		}
+		h.Index = uint16(i)
+		chunk := h.append(make([]byte, 0, HeaderSize+len(payload)))
+		chunks = append(chunks, append(chunk, payload...))
+	}
+	return chunks, nil
+}
+
+// Decode reassembles the value from all chunks ordered by index.
+// chunks of different writes are detected by the checksum
+func Decode(chunks [][]byte) ([]byte, error) {
+	if len(chunks) == 0 {
+		return nil, ErrIncomplete
+	}
+
+	var (
+		first      Header
+		compressed []byte
+	)
+	for i, chunk := range chunks {
+		h, payload, err := ParseHeader(chunk)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			first = h
+		}
+		if int(h.Total) != len(chunks) || int(h.Index) != i {
+			return nil, ErrIncomplete
+		}
+		if h.Codec != first.Codec || h.Checksum != first.Checksum {
+			return nil, ErrChecksum
+		}
+		compressed = append(compressed, payload...)
+	}
+
+	codec, ok := codecByID(first.Codec)
+	if !ok {
+		return nil, fmt.Errorf("envelope: unknown codec %d", first.Codec)
+	}
+	value, err := codec.Decompress(compressed)
+	if err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(value) != first.Checksum {
+		return nil, ErrChecksum
+	}
+	return value, nil
+}
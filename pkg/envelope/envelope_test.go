@@ -0,0 +1,107 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+type memKV map[string]string
+
+func (m memKV) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	m[key] = val
+	return &clientv3.PutResponse{}, nil
+}
+
+func (m memKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	resp := &clientv3.GetResponse{}
+	if val, ok := m[key]; ok {
+		resp.Kvs = []*mvccpb.KeyValue{{Key: []byte(key), Value: []byte(val)}}
+	}
+	return resp, nil
+}
+
+func (m memKV) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	resp := &clientv3.DeleteResponse{}
+	if _, ok := m[key]; ok {
+		delete(m, key)
+		resp.Deleted = 1
+	}
+	return resp, nil
+}
+
+func randomBytes(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(data)
+	return data
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, name := range []string{"none", "gzip"} {
+		codec, ok := LookupCodec(name)
+		assert.True(t, ok)
+
+		value := randomBytes(1000)
+		chunks, err := Encode(value, codec, 100)
+		assert.NoError(t, err)
+		assert.True(t, len(chunks) > 1)
+		for _, chunk := range chunks {
+			assert.True(t, IsEnvelope(chunk))
+			assert.True(t, len(chunk) <= 100)
+		}
+
+		decoded, err := Decode(chunks)
+		assert.NoError(t, err)
+		assert.Equal(t, value, decoded)
+
+		_, err = Decode(chunks[:len(chunks)-1])
+		assert.Equal(t, ErrIncomplete, err)
+	}
+
+	// chunks of another write
+	codec, _ := LookupCodec("none")
+	a, _ := Encode(bytes.Repeat([]byte("a"), 200), codec, 114)
+	b, _ := Encode(bytes.Repeat([]byte("b"), 200), codec, 114)
+	_, err := Decode([][]byte{a[0], b[1]})
+	assert.Equal(t, ErrChecksum, err)
+
+	assert.False(t, IsEnvelope([]byte(`{"id":"1"}`)))
+}
+
+func TestPutRead(t *testing.T) {
+	config := DefaultConfig()
+	config.ChunkSize = 64
+	config.Threshold = 128
+	w, err := config.Build()
+	assert.NoError(t, err)
+
+	kv := memKV{}
+	ctx := context.Background()
+	large := randomBytes(1000)
+	assert.NoError(t, w.Put(ctx, kv, "/juno/test/a", large))
+	assert.True(t, len(kv) > 2)
+
+	value, err := Read(ctx, kv, "/juno/test/a", []byte(kv["/juno/test/a"]))
+	assert.NoError(t, err)
+	assert.Equal(t, large, value)
+
+	// small value is written as is and stale chunks are removed
+	assert.NoError(t, w.Put(ctx, kv, "/juno/test/a", []byte("small")))
+	assert.Equal(t, memKV{"/juno/test/a": "small"}, kv)
+
+	value, err = Read(ctx, kv, "/juno/test/a", []byte("small"))
+	assert.NoError(t, err)
+	assert.Equal(t, "small", string(value))
+
+	assert.NoError(t, w.Put(ctx, kv, "/juno/test/a", large))
+	assert.NoError(t, Delete(ctx, kv, "/juno/test/a"))
+	assert.Empty(t, kv)
+
+	_, err = (&Config{Codec: "zstd", ChunkSize: 64}).Build()
+	assert.Error(t, err)
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envelope
+
+import (
+	"context"
+	"fmt"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ChunkKeyPrefix chunks after the first one are stored under this prefix followed by the key,
+// so that watchers of the key's prefix do not see them
+const ChunkKeyPrefix = "/juno/chunk"
+
+// KV the subset of clientv3.KV used to read and write envelopes
+type KV interface {
+	Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error)
+	Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error)
+	Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error)
+}
+
+// ChunkKey returns the key of the chunk at index, index 0 is stored at key itself
+func ChunkKey(key string, index int) string {
+	if index == 0 {
+		return key
+	}
+	return fmt.Sprintf("%s%s/%05d", ChunkKeyPrefix, key, index)
+}
+
+// Put writes value at key. the first chunk is written last, so that watchers of key
+// can read the other chunks once they see it. opts, e.g. a lease, apply to all chunks
+func (w *Writer) Put(ctx context.Context, kv KV, key string, value []byte, opts ...clientv3.OpOption) error {
+	chunks, err := w.Encode(value)
+	if err != nil {
+		return err
+	}
+
+	for i := len(chunks) - 1; i >= 0; i-- {
+		if _, err := kv.Put(ctx, ChunkKey(key, i), string(chunks[i]), opts...); err != nil {
+			return err
+		}
+	}
+	return deleteChunks(ctx, kv, key, len(chunks))
+}
+
+// Read returns the value of key given the value read from etcd, e.g. from a watch event.
+// the remaining chunks are fetched if value is the first chunk of an envelope, other values are returned as is
+func Read(ctx context.Context, kv KV, key string, value []byte) ([]byte, error) {
+	if !IsEnvelope(value) {
+		return value, nil
+	}
+	h, _, err := ParseHeader(value)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make([][]byte, h.Total)
+	chunks[0] = value
+	for i := 1; i < int(h.Total); i++ {
+		resp, err := kv.Get(ctx, ChunkKey(key, i))
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Kvs) == 0 {
+			return nil, ErrIncomplete
+		}
+		chunks[i] = resp.Kvs[0].Value
+	}
+	return Decode(chunks)
+}
+
+// Delete deletes key and its chunks
+func Delete(ctx context.Context, kv KV, key string) error {
+	if _, err := kv.Delete(ctx, key); err != nil {
+		return err
+	}
+	return deleteChunks(ctx, kv, key, 1)
+}
+
+// deleteChunks deletes chunks left by a previous larger value, starting at index from
+func deleteChunks(ctx context.Context, kv KV, key string, from int) error {
+	for i := from; i <= MaxChunks; i++ {
+		resp, err := kv.Delete(ctx, ChunkKey(key, i))
+		if err != nil {
+			return err
+		}
+		if resp.Deleted == 0 {
+			return nil
+		}
+	}
+	return nil
+}
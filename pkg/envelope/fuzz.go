@@ -0,0 +1,33 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build gofuzz
+// +build gofuzz
+
+package envelope
+
+import "bytes"
+
+// Fuzz is the go-fuzz entry of values read from etcd.
+// data is split at every magic so that multi-chunk envelopes are reached
+func Fuzz(data []byte) int {
+	var chunks [][]byte
+	for _, part := range bytes.Split(data, magic)[1:] {
+		chunks = append(chunks, append(append([]byte(nil), magic...), part...))
+	}
+	if _, err := Decode(chunks); err != nil {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envelope
+
+import (
+	"fmt"
+
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config envelope config shared by all modules writing big values to etcd
+type Config struct {
+	Codec     string `json:"codec"`     // none or gzip, or a codec added by Register
+	ChunkSize int    `json:"chunkSize"` // max bytes of a chunk, header included, must be under etcd's request limit (1.5MiB by default)
+	Threshold int    `json:"threshold"` // values not larger than threshold are written as is, readable by clients unaware of envelope
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadEnvelopeConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Codec:     "gzip",
+		ChunkSize: 1 << 20,
+		Threshold: 1 << 20,
+	}
+}
+
+// Build new a writer
+func (c *Config) Build() (*Writer, error) {
+	codec, ok := LookupCodec(c.Codec)
+	if !ok {
+		return nil, fmt.Errorf("envelope: unknown codec %s", c.Codec)
+	}
+	if c.ChunkSize <= HeaderSize {
+		return nil, fmt.Errorf("envelope: chunk size %d is not larger than header", c.ChunkSize)
+	}
+	return &Writer{
+		codec:     codec,
+		chunkSize: c.ChunkSize,
+		threshold: c.Threshold,
+	}, nil
+}
+
+// Writer encodes values larger than the threshold in envelope.
+// a nil writer writes every value as is
+type Writer struct {
+	codec     Codec
+	chunkSize int
+	threshold int
+}
+
+// Encode returns the chunks to write, a single chunk holding value as is if it is not larger than the threshold
+func (w *Writer) Encode(value []byte) ([][]byte, error) {
+	if w == nil || len(value) <= w.threshold {
+		return [][]byte{value}, nil
+	}
+	return Encode(value, w.codec, w.chunkSize)
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdv3
+
+import (
+	"context"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// maxTxnOps gets in one transaction, below the default limit of the etcd server
+const maxTxnOps = 128
+
+// Client etcd client on go.etcd.io/etcd/client/v3
+type Client struct {
+	*clientv3.Client
+}
+
+// New connects to etcd with config
+func New(config *Config) (*Client, error) {
+	c, err := config.clientv3Config()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := clientv3.New(c)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: client}, nil
+}
+
+// GetValues returns the values of keys and the keys under them, keys are read at the same revision
+func (client *Client) GetValues(ctx context.Context, keys ...string) (map[string]string, error) {
+	var (
+		revision int64
+		values   = make(map[string]string)
+	)
+	for len(keys) > 0 {
+		batch := keys
+		if len(batch) > maxTxnOps {
+			batch = batch[:maxTxnOps]
+		}
+		keys = keys[len(batch):]
+
+		ops := make([]clientv3.Op, 0, len(batch))
+		for _, key := range batch {
+			ops = append(ops, clientv3.OpGet(key, clientv3.WithPrefix(), clientv3.WithRev(revision)))
+		}
+		resp, err := client.Txn(ctx).Then(ops...).Commit()
+		if err != nil {
+			return values, err
+		}
+		for i, r := range resp.Responses {
+			key, dir := batch[i], strings.TrimSuffix(batch[i], "/")+"/"
+			for _, kv := range r.GetResponseRange().Kvs {
+				// a prefix get of /a/b also returns /a/bc
+				if k := string(kv.Key); k == key || strings.HasPrefix(k, dir) {
+					values[k] = string(kv.Value)
+				}
+			}
+		}
+		if revision == 0 {
+			revision = resp.Header.GetRevision()
+		}
+	}
+	return values, nil
+}
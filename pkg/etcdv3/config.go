@@ -0,0 +1,136 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdv3
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/xlog"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+)
+
+// ErrNoEndpoints is returned when the client config has no endpoint
+var ErrNoEndpoints = errors.New("etcd: no endpoints configured")
+
+// Config etcd client config, read from the same jupiter.etcdv3.<name> keys as the jupiter client
+type Config struct {
+	Endpoints []string `json:"endpoints"`
+	CertFile  string   `json:"certFile"`
+	KeyFile   string   `json:"keyFile"`
+	CaCert    string   `json:"caCert"`
+	BasicAuth bool     `json:"basicAuth"`
+	UserName  string   `json:"userName"`
+	Password  string   `json:"password"`
+	// dial timeout, the client fails to build when no endpoint is reachable in time
+	ConnectTimeout time.Duration `json:"connectTimeout"`
+	// interval to refresh endpoints from the cluster member list, 0 disables
+	AutoSyncInterval time.Duration `json:"autoSyncInterval"`
+}
+
+// StdConfig returns the config of the named client under jupiter.etcdv3
+func StdConfig(name string) *Config {
+	return RawConfig("jupiter.etcdv3." + name)
+}
+
+// RawConfig returns the config at key
+func RawConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(key, config); err != nil {
+		xlog.Panic("unmarshal etcd config", xlog.String("key", key), xlog.FieldErr(err))
+	}
+	return config
+}
+
+// DefaultConfig returns the default config
+func DefaultConfig() *Config {
+	return &Config{
+		ConnectTimeout: 5 * time.Second,
+	}
+}
+
+// Build connects to etcd, panics on failure like the jupiter client did
+func (config *Config) Build() *Client {
+	client, err := New(config)
+	if err != nil {
+		xlog.Panic("connect etcd", xlog.Any("endpoints", config.Endpoints), xlog.FieldErr(err))
+	}
+	return client
+}
+
+// clientv3Config converts to clientv3.Config
+func (config *Config) clientv3Config() (clientv3.Config, error) {
+	if len(config.Endpoints) == 0 {
+		return clientv3.Config{}, ErrNoEndpoints
+	}
+
+	tlsConfig, err := LoadTLS(config.CaCert, config.CertFile, config.KeyFile)
+	if err != nil {
+		return clientv3.Config{}, err
+	}
+
+	c := clientv3.Config{
+		Endpoints:            config.Endpoints,
+		DialTimeout:          config.ConnectTimeout,
+		DialKeepAliveTime:    10 * time.Second,
+		DialKeepAliveTimeout: 3 * time.Second,
+		AutoSyncInterval:     config.AutoSyncInterval,
+		// block until connected so that an unreachable cluster fails the build
+		DialOptions: []grpc.DialOption{grpc.WithBlock()},
+		TLS:         tlsConfig,
+	}
+	if config.BasicAuth {
+		c.Username, c.Password = config.UserName, config.Password
+	}
+	return c, nil
+}
+
+// LoadTLS builds the client tls config from pem files, nil if no file is given.
+// the server is verified with caCert, a client certificate is sent when certFile and keyFile are set
+func LoadTLS(caCert, certFile, keyFile string) (*tls.Config, error) {
+	if caCert == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{}
+	if caCert != "" {
+		pem, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("etcd: read ca cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("etcd: no certificate found in %s", caCert)
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("etcd: certFile and keyFile must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("etcd: load client cert: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
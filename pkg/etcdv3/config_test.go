@@ -0,0 +1,50 @@
+package etcdv3
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig(t *testing.T) {
+	_, err := DefaultConfig().clientv3Config()
+	assert.Equal(t, ErrNoEndpoints, err)
+
+	config := &Config{Endpoints: []string{"a:2379"}, UserName: "agent", Password: "secret"}
+	c, err := config.clientv3Config()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a:2379"}, c.Endpoints)
+	assert.Nil(t, c.TLS)
+	// credentials are only sent with basicAuth
+	assert.Empty(t, c.Username)
+
+	config.BasicAuth = true
+	c, err = config.clientv3Config()
+	assert.NoError(t, err)
+	assert.Equal(t, "agent", c.Username)
+	assert.Equal(t, "secret", c.Password)
+}
+
+func TestLoadTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcdv3-tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config, err := LoadTLS("", "", "")
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+
+	_, err = LoadTLS("", "client.pem", "")
+	assert.Error(t, err)
+
+	_, err = LoadTLS(filepath.Join(dir, "missing.pem"), "", "")
+	assert.Error(t, err)
+
+	invalid := filepath.Join(dir, "invalid.pem")
+	assert.NoError(t, ioutil.WriteFile(invalid, []byte("not a certificate"), 0600))
+	_, err = LoadTLS(invalid, "", "")
+	assert.Error(t, err)
+}
@@ -12,20 +12,29 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package etcd
+package etcdv3
 
 import (
 	"context"
 	"sync"
 
-	"github.com/coreos/etcd/clientv3"
-	"github.com/coreos/etcd/mvcc/mvccpb"
-	"github.com/douyu/jupiter/pkg/client/etcdv3"
 	"github.com/douyu/jupiter/pkg/ecode"
+	"github.com/douyu/jupiter/pkg/metric"
 	"github.com/douyu/jupiter/pkg/util/xgo"
 	"github.com/douyu/jupiter/pkg/xlog"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
+// watchReconnectsCounter counts re-established watches after the watch channel closed
+var watchReconnectsCounter = metric.CounterVecOpts{
+	Namespace: "juno",
+	Subsystem: "agent",
+	Name:      "watch_reconnects_total",
+	Help:      "etcd watch reconnects by prefix",
+	Labels:    []string{"prefix"},
+}.Build()
+
 // Watch A watch only tells the latest revision
 type Watch struct {
 	revision  int64
@@ -47,8 +56,9 @@ func (w *Watch) IncipientKeyValues() []*mvccpb.KeyValue {
 	return w.incipientKVs
 }
 
-// NewWatch ...
-func WatchPrefix(client *etcdv3.Client, ctx context.Context, prefix string) (*Watch, error) {
+// WatchPrefix watches the keys under prefix from the revision they are read at,
+// opts are appended to the watch, e.g. clientv3.WithPrevKV() to receive values before change
+func (client *Client) WatchPrefix(ctx context.Context, prefix string, opts ...clientv3.OpOption) (*Watch, error) {
 	resp, err := client.Get(ctx, prefix, clientv3.WithPrefix())
 	if err != nil {
 		return nil, err
@@ -60,10 +70,13 @@ func WatchPrefix(client *etcdv3.Client, ctx context.Context, prefix string) (*Wa
 		incipientKVs: resp.Kvs,
 	}
 
+	// canceled by Close, the watch is not re-established afterwards
+	watchCtx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+
 	xgo.Go(func() {
-		ctx, cancel := context.WithCancel(context.Background())
-		w.cancel = cancel
-		rch := client.Client.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithCreatedNotify(), clientv3.WithRev(w.revision))
+		watchOpts := append([]clientv3.OpOption{clientv3.WithPrefix(), clientv3.WithCreatedNotify()}, opts...)
+		rch := client.Client.Watch(watchCtx, prefix, append(watchOpts, clientv3.WithRev(w.revision))...)
 		for {
 			for n := range rch {
 				if n.CompactRevision > w.revision {
@@ -84,12 +97,14 @@ func WatchPrefix(client *etcdv3.Client, ctx context.Context, prefix string) (*Wa
 					}
 				}
 			}
-			ctx, cancel := context.WithCancel(context.Background())
-			w.cancel = cancel
+			if watchCtx.Err() != nil {
+				return
+			}
+			watchReconnectsCounter.Inc(prefix)
 			if w.revision > 0 {
-				rch = client.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithCreatedNotify(), clientv3.WithRev(w.revision))
+				rch = client.Watch(watchCtx, prefix, append(watchOpts, clientv3.WithRev(w.revision))...)
 			} else {
-				rch = client.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithCreatedNotify())
+				rch = client.Watch(watchCtx, prefix, watchOpts...)
 			}
 		}
 	})
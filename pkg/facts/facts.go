@@ -0,0 +1,202 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package facts
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Node identity of the node, resolved by the agent report config
+type Node struct {
+	Hostname string            `json:"hostname"`
+	IP       string            `json:"ip"`
+	Env      string            `json:"env"`
+	Region   string            `json:"region"`
+	Zone     string            `json:"zone"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+// Facts inventory of the host
+type Facts struct {
+	Node
+	OS         string            `json:"os"`     // e.g. CentOS Linux 7 (Core)
+	Kernel     string            `json:"kernel"` // e.g. 3.10.0-1160.el7.x86_64
+	Arch       string            `json:"arch"`
+	CPU        CPU               `json:"cpu"`
+	Memory     Memory            `json:"memory"`
+	Disks      []Disk            `json:"disks"`
+	Interfaces []Interface       `json:"interfaces"`
+	Runtimes   map[string]string `json:"runtimes"` // container runtime -> version, only installed ones
+	Apps       []App             `json:"apps"`
+	Collected  time.Time         `json:"collected"`
+}
+
+// CPU processors and their usage since the previous collection
+type CPU struct {
+	Model   string  `json:"model"`
+	Cores   int     `json:"cores"`
+	Percent float64 `json:"percent"` // of all cores
+}
+
+// Memory physical memory in bytes
+type Memory struct {
+	Total     uint64  `json:"total"`
+	Available uint64  `json:"available"`
+	Percent   float64 `json:"percent"` // used, excluding reclaimable cache
+}
+
+// Disk a mounted file system in bytes
+type Disk struct {
+	Mount   string  `json:"mount"`
+	Device  string  `json:"device"`
+	FSType  string  `json:"fs_type"`
+	Total   uint64  `json:"total"`
+	Free    uint64  `json:"free"` // available to unprivileged users
+	Percent float64 `json:"percent"`
+}
+
+// Interface a network interface which is up
+type Interface struct {
+	Name  string   `json:"name"`
+	MAC   string   `json:"mac,omitempty"`
+	Addrs []string `json:"addrs"` // in CIDR notation
+}
+
+// App an app installed under a process manager
+type App struct {
+	Name    string `json:"name"`
+	Manager string `json:"manager"` // supervisor or systemd
+	File    string `json:"file"`
+}
+
+// Collector collects facts periodically and publishes them under the node key
+type Collector struct {
+	config *Config
+
+	mu      sync.RWMutex
+	latest  *Facts
+	prevCPU cpuStat
+	stop    chan struct{}
+	put     func(ctx context.Context, key, value string) error
+
+	// Apps returns apps installed on the node, set before Start
+	Apps func() []App
+}
+
+// Start keep collecting and publishing in background
+func (c *Collector) Start() error {
+	if !c.config.Enable {
+		return nil
+	}
+	xgo.Go(func() {
+		ticker := time.NewTicker(c.config.Interval)
+		defer ticker.Stop()
+		for {
+			if err := c.publish(c.Collect()); err != nil {
+				xlog.Warn("publish facts", xlog.String("key", c.Key()), xlog.FieldErr(err))
+			}
+			select {
+			case <-ticker.C:
+			case <-c.stop:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// Stop ...
+func (c *Collector) Stop() {
+	if c.config.Enable {
+		close(c.stop)
+	}
+}
+
+// Key where facts of the node are published
+func (c *Collector) Key() string {
+	return c.config.Prefix + c.config.Node.Hostname
+}
+
+// Latest facts of the last collection, nil before the first one
+func (c *Collector) Latest() *Facts {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.latest
+}
+
+// Collect facts now, a source that fails is left empty
+func (c *Collector) Collect() *Facts {
+	facts := &Facts{
+		Node:      c.config.Node,
+		Arch:      arch(),
+		Runtimes:  c.runtimes(),
+		Apps:      make([]App, 0),
+		Collected: time.Now(),
+	}
+	var err error
+	if facts.OS, err = osName(c.config.Release); err != nil {
+		xlog.Debug("facts os", xlog.FieldErr(err))
+	}
+	if facts.Kernel, err = c.kernel(); err != nil {
+		xlog.Debug("facts kernel", xlog.FieldErr(err))
+	}
+	if facts.CPU, err = c.cpu(); err != nil {
+		xlog.Warn("facts cpu", xlog.FieldErr(err))
+	}
+	if facts.Memory, err = c.memory(); err != nil {
+		xlog.Warn("facts memory", xlog.FieldErr(err))
+	}
+	if facts.Disks, err = c.disks(); err != nil {
+		xlog.Warn("facts disks", xlog.FieldErr(err))
+	}
+	if facts.Interfaces, err = interfaces(); err != nil {
+		xlog.Warn("facts interfaces", xlog.FieldErr(err))
+	}
+	if c.Apps != nil {
+		facts.Apps = append(facts.Apps, c.Apps()...)
+		sort.Slice(facts.Apps, func(i, j int) bool {
+			if facts.Apps[i].Manager != facts.Apps[j].Manager {
+				return facts.Apps[i].Manager < facts.Apps[j].Manager
+			}
+			return facts.Apps[i].Name < facts.Apps[j].Name
+		})
+	}
+
+	c.mu.Lock()
+	c.latest = facts
+	c.mu.Unlock()
+	return facts
+}
+
+// publish write facts to the node key, overwriting the previous ones
+func (c *Collector) publish(facts *Facts) error {
+	if c.put == nil {
+		return nil
+	}
+	value, err := json.Marshal(facts)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+	return c.put(ctx, c.Key(), string(value))
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package facts
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestCollect(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("disks are read with statfs")
+	}
+	root, err := ioutil.TempDir("", "facts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	data := filepath.Join(root, "data dir")
+	assert.NoError(t, os.MkdirAll(data, 0755))
+	writeFiles(t, root, map[string]string{
+		"os-release":                "NAME=\"CentOS Linux\"\nVERSION=\"7 (Core)\"\nPRETTY_NAME=\"CentOS Linux 7 (Core)\"\n",
+		"proc/sys/kernel/osrelease": "3.10.0-1160.el7.x86_64\n",
+		"proc/cpuinfo":              "processor\t: 0\nmodel name\t: Intel(R) Xeon(R)\n\nprocessor\t: 1\nmodel name\t: Intel(R) Xeon(R)\n",
+		"proc/stat":                 "cpu  100 0 100 700 100 0 0 0 0 0\ncpu0 50 0 50 350 50 0 0 0 0 0\n",
+		"proc/meminfo":              "MemTotal:        8000 kB\nMemFree:         1000 kB\nMemAvailable:    2000 kB\n",
+		"proc/mounts": "/dev/sda1 " + filepath.Join(root, `data\040dir`) + " ext4 rw 0 0\n" +
+			"/dev/sda1 /bind ext4 rw 0 0\n" +
+			"tmpfs /run tmpfs rw 0 0\n",
+	})
+
+	config := DefaultConfig()
+	config.Path = filepath.Join(root, "proc")
+	config.Release = filepath.Join(root, "os-release")
+	config.Node = Node{Hostname: "node-1", IP: "10.0.0.1"}
+	collector := config.Build()
+	collector.Apps = func() []App {
+		return []App{{Name: "web", Manager: "systemd"}, {Name: "api", Manager: "supervisor"}}
+	}
+	var published map[string]string
+	collector.put = func(ctx context.Context, key, value string) error {
+		published = map[string]string{key: value}
+		return nil
+	}
+
+	facts := collector.Collect()
+	assert.Equal(t, "node-1", facts.Hostname)
+	assert.Equal(t, "CentOS Linux 7 (Core)", facts.OS)
+	assert.Equal(t, "3.10.0-1160.el7.x86_64", facts.Kernel)
+	assert.Equal(t, CPU{Model: "Intel(R) Xeon(R)", Cores: 2}, facts.CPU)
+	assert.Equal(t, uint64(8000<<10), facts.Memory.Total)
+	assert.Equal(t, float64(75), facts.Memory.Percent)
+	if assert.Len(t, facts.Disks, 1) {
+		assert.Equal(t, data, facts.Disks[0].Mount)
+		assert.True(t, facts.Disks[0].Total > 0)
+	}
+	assert.Equal(t, "api", facts.Apps[0].Name)
+
+	// usage since the previous collection: 200 of 1000 ticks were busy
+	writeFiles(t, root, map[string]string{"proc/stat": "cpu  200 0 200 1400 200 0 0 0 0 0\n"})
+	facts = collector.Collect()
+	assert.InDelta(t, 20, facts.CPU.Percent, 0.001)
+	assert.Equal(t, facts, collector.Latest())
+
+	assert.NoError(t, collector.publish(facts))
+	var value Facts
+	assert.NoError(t, json.Unmarshal([]byte(published["/juno-agent/facts/node-1"]), &value))
+	assert.Equal(t, "10.0.0.1", value.IP)
+}
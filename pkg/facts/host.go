@@ -0,0 +1,283 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package facts
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// cpuWindow cpu usage of the first collection is measured over it, later ones since the previous collection
+const cpuWindow = 500 * time.Millisecond
+
+// versionCommands print the version of a container runtime, runtimes not in PATH are skipped
+var versionCommands = map[string][]string{
+	"docker":     {"docker", "version", "--format", "{{.Server.Version}}"},
+	"containerd": {"containerd", "--version"},
+	"crictl":     {"crictl", "--version"},
+	"runc":       {"runc", "--version"},
+	"podman":     {"podman", "--version"},
+}
+
+// cpuStat ticks of all cpus in /proc/stat, iowait counts as idle
+type cpuStat struct {
+	total, idle uint64
+}
+
+func arch() string {
+	return runtime.GOARCH
+}
+
+// osName PRETTY_NAME of os-release, see os-release(5)
+func osName(release string) (string, error) {
+	data, err := ioutil.ReadFile(release)
+	if err != nil {
+		return "", err
+	}
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value := splitPair(line, "=")
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, "'")
+		}
+		values[key] = value
+	}
+	if name := values["PRETTY_NAME"]; name != "" {
+		return name, nil
+	}
+	return strings.TrimSpace(values["NAME"] + " " + values["VERSION"]), nil
+}
+
+func (c *Collector) kernel() (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(c.config.Path, "sys", "kernel", "osrelease"))
+	return strings.TrimSpace(string(data)), err
+}
+
+func (c *Collector) cpu() (CPU, error) {
+	cpu := CPU{Cores: runtime.NumCPU()}
+	if data, err := ioutil.ReadFile(filepath.Join(c.config.Path, "cpuinfo")); err == nil {
+		processors := 0
+		for _, line := range strings.Split(string(data), "\n") {
+			key, value := splitPair(line, ":")
+			switch key {
+			case "processor":
+				processors++
+			case "model name":
+				cpu.Model = value
+			}
+		}
+		if processors > 0 {
+			cpu.Cores = processors
+		}
+	}
+
+	cur, err := c.readCPUStat()
+	if err != nil {
+		return cpu, err
+	}
+	c.mu.Lock()
+	prev := c.prevCPU
+	c.prevCPU = cur
+	c.mu.Unlock()
+	if prev.total == 0 {
+		time.Sleep(cpuWindow)
+		prev = cur
+		if cur, err = c.readCPUStat(); err != nil {
+			return cpu, err
+		}
+		c.mu.Lock()
+		c.prevCPU = cur
+		c.mu.Unlock()
+	}
+	if cur.total > prev.total && cur.idle >= prev.idle {
+		cpu.Percent = 100 * (1 - float64(cur.idle-prev.idle)/float64(cur.total-prev.total))
+	}
+	return cpu, nil
+}
+
+// readCPUStat the aggregated cpu line of /proc/stat: user nice system idle iowait irq softirq steal ...,
+// guest time is already included in user and nice
+func (c *Collector) readCPUStat() (cpuStat, error) {
+	data, err := ioutil.ReadFile(filepath.Join(c.config.Path, "stat"))
+	if err != nil {
+		return cpuStat{}, err
+	}
+	line := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		line = data[:i]
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return cpuStat{}, errors.New("malformed stat")
+	}
+	var stat cpuStat
+	for i, field := range fields[1:] {
+		if i >= 8 {
+			break
+		}
+		n, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return cpuStat{}, err
+		}
+		stat.total += n
+		if i == 3 || i == 4 {
+			stat.idle += n
+		}
+	}
+	return stat, nil
+}
+
+func (c *Collector) memory() (Memory, error) {
+	data, err := ioutil.ReadFile(filepath.Join(c.config.Path, "meminfo"))
+	if err != nil {
+		return Memory{}, err
+	}
+	var memory Memory
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value := splitPair(line, ":")
+		kb, err := strconv.ParseUint(strings.TrimSuffix(value, " kB"), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "MemTotal":
+			memory.Total = kb << 10
+		case "MemAvailable":
+			memory.Available = kb << 10
+		}
+	}
+	if memory.Total == 0 {
+		return Memory{}, errors.New("malformed meminfo")
+	}
+	memory.Percent = 100 * float64(memory.Total-memory.Available) / float64(memory.Total)
+	return memory, nil
+}
+
+// disks mounts of the configured file system types, a device mounted more than once is reported once
+func (c *Collector) disks() ([]Disk, error) {
+	data, err := ioutil.ReadFile(filepath.Join(c.config.Path, "mounts"))
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string]bool, len(c.config.FSTypes))
+	for _, t := range c.config.FSTypes {
+		types[t] = true
+	}
+	disks := make([]Disk, 0)
+	devices := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || !types[fields[2]] || devices[fields[0]] {
+			continue
+		}
+		disk := Disk{Device: fields[0], Mount: unescapeMount(fields[1]), FSType: fields[2]}
+		if err := statDisk(&disk); err != nil {
+			xlog.Debug("facts disk", xlog.String("mount", disk.Mount), xlog.FieldErr(err))
+			continue
+		}
+		devices[disk.Device] = true
+		disks = append(disks, disk)
+	}
+	sort.Slice(disks, func(i, j int) bool {
+		return disks[i].Mount < disks[j].Mount
+	})
+	return disks, scanner.Err()
+}
+
+func interfaces() ([]Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Interface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		item := Interface{Name: iface.Name, MAC: iface.HardwareAddr.String(), Addrs: make([]string, 0, len(addrs))}
+		for _, addr := range addrs {
+			item.Addrs = append(item.Addrs, addr.String())
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// runtimes versions of installed container runtimes, the first line printed by each
+func (c *Collector) runtimes() map[string]string {
+	versions := make(map[string]string)
+	for name, command := range versionCommands {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+		out, err := exec.CommandContext(ctx, command[0], command[1:]...).Output()
+		cancel()
+		if err != nil {
+			xlog.Debug("facts runtime version", xlog.String("runtime", name), xlog.FieldErr(err))
+			continue
+		}
+		versions[name] = strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	}
+	return versions
+}
+
+// splitPair key and value of a line separated by sep, both trimmed
+func splitPair(line, sep string) (string, string) {
+	i := strings.Index(line, sep)
+	if i < 0 {
+		return strings.TrimSpace(line), ""
+	}
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+len(sep):])
+}
+
+// unescapeMount mount points in /proc/mounts escape space, tab, newline and backslash in octal
+func unescapeMount(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+4 <= len(path) {
+			if n, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package facts
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/etcdv3"
+	"github.com/douyu/juno-agent/pkg/platform"
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config host facts inventory config
+type Config struct {
+	Enable   bool          `json:"enable"`
+	Path     string        `json:"path"`     // mount point of procfs
+	Release  string        `json:"release"`  // os-release file the distribution is read from
+	Interval time.Duration `json:"interval"` // how often facts are collected and published
+	Timeout  time.Duration `json:"timeout"`  // of each runtime version command and of publishing
+	FSTypes  []string      `json:"fs_types"` // file systems of mounts reported as disks
+	Etcd     string        `json:"etcd"`     // name of the etcd client config facts are published with, empty to only serve them by api
+	Prefix   string        `json:"prefix"`   // facts are published at <prefix><hostname>
+	// Node identity of the node, included in facts
+	Node Node `json:"-"`
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadFactsConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable:   false,
+		Path:     "/proc",
+		Release:  "/etc/os-release",
+		Interval: 10 * time.Minute,
+		Timeout:  5 * time.Second,
+		FSTypes:  []string{"ext2", "ext3", "ext4", "xfs", "btrfs", "zfs"},
+		Etcd:     "default",
+		Prefix:   "/juno-agent/facts/",
+	}
+}
+
+// Build new a instance
+func (c *Config) Build() *Collector {
+	if c.Enable && !platform.Supported(platform.ProcFS) {
+		xlog.Warn("plugin", xlog.String("facts", "disabled"), xlog.FieldErr(platform.ErrNotSupported))
+		c.Enable = false
+	}
+	collector := &Collector{
+		config: c,
+		stop:   make(chan struct{}),
+	}
+	if c.Enable {
+		xlog.Info("plugin", xlog.String("facts", "start"), xlog.String("key", c.Prefix+c.Node.Hostname))
+		if c.Etcd != "" {
+			client := etcdv3.StdConfig(c.Etcd).Build()
+			collector.put = func(ctx context.Context, key, value string) error {
+				_, err := client.Put(ctx, key, value)
+				return err
+			}
+		}
+	}
+	return collector
+}
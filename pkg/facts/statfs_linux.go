@@ -0,0 +1,33 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package facts
+
+import "syscall"
+
+// statDisk fill in size and usage like df, reserved blocks count as used
+func statDisk(disk *Disk) error {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(disk.Mount, &stat); err != nil {
+		return err
+	}
+	bsize := uint64(stat.Bsize)
+	disk.Total = stat.Blocks * bsize
+	disk.Free = stat.Bavail * bsize
+	used := (stat.Blocks - stat.Bfree) * bsize
+	if used+disk.Free > 0 {
+		disk.Percent = 100 * float64(used) / float64(used+disk.Free)
+	}
+	return nil
+}
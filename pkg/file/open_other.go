@@ -0,0 +1,48 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package file
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+func openNoFollow(path string) (*os.File, error) {
+	return os.Open(path)
+}
+
+// openedPath the real path of an opened file, resolved again and compared with the file itself
+func openedPath(f *os.File) (string, error) {
+	path, err := filepath.EvalSymlinks(f.Name())
+	if err != nil {
+		return "", err
+	}
+	opened, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !os.SameFile(opened, current) {
+		return "", errors.New("file was replaced while opening")
+	}
+	return path, nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"fmt"
+
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config file push and fetch config
+type Config struct {
+	Enable       bool     `json:"enable"`
+	PushDirs     []string `json:"push_dirs"`  // files can only be written under these dirs, e.g. certificates
+	FetchDirs    []string `json:"fetch_dirs"` // files can only be read under these dirs, e.g. core dumps
+	MaxPushSize  int64    `json:"max_push_size"`
+	MaxFetchSize int64    `json:"max_fetch_size"`
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadFileConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable:       false,
+		MaxPushSize:  64 << 20,
+		MaxFetchSize: 256 << 20,
+	}
+}
+
+// Build new a instance
+func (c *Config) Build() *Transfer {
+	if c.Enable {
+		xlog.Info("plugin", xlog.String("file", "start"), xlog.Any("pushDirs", c.PushDirs), xlog.Any("fetchDirs", c.FetchDirs))
+	}
+	return &Transfer{config: c}
+}
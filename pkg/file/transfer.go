@@ -0,0 +1,258 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrDisabled file transfer is not enabled in config
+	ErrDisabled = errors.New("file transfer is not enabled")
+	// ErrNotAllowed the path is outside the configured dirs
+	ErrNotAllowed = errors.New("path is not under the allowed dirs")
+	// ErrTooLarge the content exceeds the configured size
+	ErrTooLarge = errors.New("file is too large")
+	// ErrChecksum the pushed content does not match its checksum
+	ErrChecksum = errors.New("sha256 of the content does not match")
+)
+
+// PushRequest a file to write, mode defaults to the mode of the replaced file or 0644,
+// owner and group default to the agent user
+type PushRequest struct {
+	Path   string
+	SHA256 string // hex sha256 of the content, required
+	Mode   os.FileMode
+	Owner  string
+	Group  string
+}
+
+// Info a pushed or fetched file
+type Info struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Mode   string `json:"mode"`
+	SHA256 string `json:"sha256"`
+}
+
+// Transfer writes files pushed by the admin and reads files it fetches, each limited to its own dirs
+type Transfer struct {
+	config *Config
+}
+
+// Push write content to req.Path atomically: it is written to a temporary file in the same dir,
+// which replaces the target only after the checksum, mode and owner are all set
+func (t *Transfer) Push(req PushRequest, content io.Reader) (*Info, error) {
+	if !t.config.Enable {
+		return nil, ErrDisabled
+	}
+	if len(req.SHA256) != sha256.Size*2 {
+		return nil, errors.New("sha256 is required")
+	}
+	if req.Mode&^os.ModePerm != 0 {
+		return nil, errors.New("only permission bits can be set")
+	}
+	if req.Path == "" || !filepath.IsAbs(req.Path) || strings.HasSuffix(req.Path, "/") {
+		return nil, errors.New("path should be an absolute file path")
+	}
+	// the file may not exist yet, its dir must
+	dir, err := resolve(t.config.PushDirs, filepath.Dir(req.Path))
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, filepath.Base(req.Path))
+	uid, gid, err := lookupOwner(req.Owner, req.Group)
+	if err != nil {
+		return nil, err
+	}
+	mode := req.Mode
+	if mode == 0 {
+		mode = 0644
+		if stat, err := os.Lstat(path); err == nil && stat.Mode().IsRegular() {
+			mode = stat.Mode().Perm()
+		}
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".push-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	defer tmp.Close()
+	// dir may have been replaced with a symlink since it was resolved
+	if real, err := openedPath(tmp); err != nil || !beneath(t.config.PushDirs, real) {
+		return nil, ErrNotAllowed
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(content, t.config.MaxPushSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if size > t.config.MaxPushSize {
+		return nil, ErrTooLarge
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(sum, req.SHA256) {
+		return nil, ErrChecksum
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return nil, err
+	}
+	if uid >= 0 || gid >= 0 {
+		if err := tmp.Chown(uid, gid); err != nil {
+			return nil, err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+	syncDir(dir)
+	return &Info{Path: path, Size: size, Mode: fmt.Sprintf("%04o", mode), SHA256: sum}, nil
+}
+
+// Fetch open a regular file under the fetch dirs for reading, the caller closes it
+func (t *Transfer) Fetch(path string) (*os.File, *Info, error) {
+	if !t.config.Enable {
+		return nil, nil, ErrDisabled
+	}
+	if path == "" || !filepath.IsAbs(path) {
+		return nil, nil, errors.New("path should be absolute")
+	}
+	file, err := OpenBeneath(t.config.FetchDirs, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	path = file.Name()
+	stat, err := file.Stat()
+	if err == nil && !stat.Mode().IsRegular() {
+		err = fmt.Errorf("%s is not a regular file", path)
+	}
+	if err == nil && stat.Size() > t.config.MaxFetchSize {
+		err = ErrTooLarge
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	// checksum of what is actually sent, the file may be growing
+	hash := sha256.New()
+	size, err := io.Copy(hash, io.LimitReader(file, stat.Size()))
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, &Info{
+		Path:   path,
+		Size:   size,
+		Mode:   fmt.Sprintf("%04o", stat.Mode().Perm()),
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// OpenBeneath open a file under one of dirs for reading. symlinks in path are resolved first,
+// then the path of the opened file is checked again, a dir replaced with a symlink in between
+// can not lead out of dirs
+func OpenBeneath(dirs []string, path string) (*os.File, error) {
+	path, err := resolve(dirs, path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := openNoFollow(path)
+	if err != nil {
+		return nil, err
+	}
+	if real, err := openedPath(file); err != nil || !beneath(dirs, real) {
+		file.Close()
+		return nil, ErrNotAllowed
+	}
+	return file, nil
+}
+
+// resolve the real path of path, which must lie under one of dirs
+func resolve(dirs []string, path string) (string, error) {
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if !beneath(dirs, path) {
+		return "", ErrNotAllowed
+	}
+	return path, nil
+}
+
+// beneath whether the real path lies under one of dirs
+func beneath(dirs []string, path string) bool {
+	for _, dir := range dirs {
+		dir, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupOwner uid and gid of the named owner and group, -1 keeps the current one.
+// the group defaults to the primary group of owner
+func lookupOwner(owner, group string) (int, int, error) {
+	uid, gid := -1, -1
+	if owner != "" {
+		u, err := user.Lookup(owner)
+		if err != nil {
+			return 0, 0, err
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+		gid, _ = strconv.Atoi(u.Gid)
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return 0, 0, err
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+	return uid, gid, nil
+}
+
+// syncDir persist the rename, errors are ignored as the file itself is already synced
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestPush(t *testing.T) {
+	root, err := ioutil.TempDir("", "file")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	certs := filepath.Join(root, "certs")
+	assert.NoError(t, os.MkdirAll(certs, 0755))
+	assert.NoError(t, os.Symlink(root, filepath.Join(certs, "escape")))
+
+	config := DefaultConfig()
+	config.Enable = true
+	config.PushDirs = []string{certs}
+	config.MaxPushSize = 16
+	transfer := config.Build()
+	path := filepath.Join(certs, "app.pem")
+
+	info, err := transfer.Push(PushRequest{Path: path, SHA256: checksum("v1"), Mode: 0600}, strings.NewReader("v1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "0600", info.Mode)
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "v1", string(content))
+
+	// mode of the replaced file is kept
+	_, err = transfer.Push(PushRequest{Path: path, SHA256: checksum("v2")}, strings.NewReader("v2"))
+	assert.NoError(t, err)
+	stat, _ := os.Stat(path)
+	assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+
+	// the target is untouched when the content is refused
+	_, err = transfer.Push(PushRequest{Path: path, SHA256: checksum("v3")}, strings.NewReader("corrupted"))
+	assert.Equal(t, ErrChecksum, err)
+	big := strings.Repeat("x", 17)
+	_, err = transfer.Push(PushRequest{Path: path, SHA256: checksum(big)}, strings.NewReader(big))
+	assert.Equal(t, ErrTooLarge, err)
+	content, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "v2", string(content))
+	entries, _ := ioutil.ReadDir(certs)
+	assert.Len(t, entries, 2) // app.pem and escape, temporary files are removed
+
+	_, err = transfer.Push(PushRequest{Path: filepath.Join(certs, "escape", "app.pem"), SHA256: checksum("v1")}, strings.NewReader("v1"))
+	assert.Equal(t, ErrNotAllowed, err)
+	_, err = transfer.Push(PushRequest{Path: path, SHA256: checksum("v1"), Mode: os.ModeSetuid | 0755}, strings.NewReader("v1"))
+	assert.Error(t, err)
+}
+
+func TestFetch(t *testing.T) {
+	root, err := ioutil.TempDir("", "file")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	dumps := filepath.Join(root, "dumps")
+	assert.NoError(t, os.MkdirAll(dumps, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dumps, "core.1"), []byte("dump"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dumps, "core.2"), []byte("larger dump"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "secret"), []byte("secret"), 0644))
+
+	config := DefaultConfig()
+	config.Enable = true
+	config.FetchDirs = []string{dumps}
+	config.MaxFetchSize = 8
+	transfer := config.Build()
+
+	f, info, err := transfer.Fetch(filepath.Join(dumps, "core.1"))
+	assert.NoError(t, err)
+	defer f.Close()
+	content, _ := ioutil.ReadAll(f)
+	assert.Equal(t, "dump", string(content))
+	assert.Equal(t, checksum("dump"), info.SHA256)
+	assert.Equal(t, int64(4), info.Size)
+
+	_, _, err = transfer.Fetch(filepath.Join(dumps, "core.2"))
+	assert.Equal(t, ErrTooLarge, err)
+	_, _, err = transfer.Fetch(filepath.Join(dumps, "..", "secret"))
+	assert.Equal(t, ErrNotAllowed, err)
+	_, _, err = transfer.Fetch(dumps)
+	assert.Error(t, err)
+
+	// the path of the opened file is checked again, whatever path was used to open it
+	assert.NoError(t, os.Symlink(root, filepath.Join(dumps, "link")))
+	_, _, err = transfer.Fetch(filepath.Join(dumps, "link", "secret"))
+	assert.Equal(t, ErrNotAllowed, err)
+	opened, err := os.Open(filepath.Join(dumps, "link", "secret"))
+	assert.NoError(t, err)
+	defer opened.Close()
+	real, err := openedPath(opened)
+	assert.NoError(t, err)
+	assert.False(t, beneath(config.FetchDirs, real))
+}
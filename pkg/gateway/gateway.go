@@ -0,0 +1,225 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// HeaderHops counts gateways a request has passed, used to break proxy loops
+const HeaderHops = "X-Juno-Gateway-Hops"
+
+const maxHops = 4
+
+var (
+	ErrAgentNotFound = errors.New("agent not found")
+	ErrTooManyHops   = errors.New("too many gateway hops")
+)
+
+// Gateway proxies and aggregates api calls to downstream agents
+type Gateway struct {
+	config  *Config
+	client  *http.Client
+	agents  map[string]Agent
+	proxies map[string]*httputil.ReverseProxy
+}
+
+// Result response of one agent in a fan-out call
+type Result struct {
+	Agent  string          `json:"agent"`
+	Status int             `json:"status,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// New ...
+func New(config *Config) (*Gateway, error) {
+	g := &Gateway{
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout},
+		agents:  make(map[string]Agent),
+		proxies: make(map[string]*httputil.ReverseProxy),
+	}
+	for _, agent := range config.Agents {
+		if agent.Name == "" {
+			return nil, fmt.Errorf("agent name is required, addr: %s", agent.Addr)
+		}
+		if _, ok := g.agents[agent.Name]; ok {
+			return nil, fmt.Errorf("duplicated agent: %s", agent.Name)
+		}
+		target, err := url.Parse(agent.Addr)
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			return nil, fmt.Errorf("invalid addr of agent[%s]: %s", agent.Name, agent.Addr)
+		}
+		g.agents[agent.Name] = agent
+		g.proxies[agent.Name] = newProxy(agent, target)
+	}
+	return g, nil
+}
+
+// Agents returns downstream agents sorted by name, tokens are omitted
+func (g *Gateway) Agents() []Agent {
+	agents := make([]Agent, 0, len(g.agents))
+	for _, agent := range g.agents {
+		agents = append(agents, Agent{Name: agent.Name, Addr: agent.Addr})
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].Name < agents[j].Name
+	})
+	return agents
+}
+
+// Proxy forwards r to api of the agent, apiPath is relative to /api of the agent.
+// responses are flushed immediately so that streaming apis like log tail work through the gateway
+func (g *Gateway) Proxy(w http.ResponseWriter, r *http.Request, name string, apiPath string) error {
+	proxy, ok := g.proxies[name]
+	if !ok {
+		return ErrAgentNotFound
+	}
+	hops, err := nextHops(r.Header)
+	if err != nil {
+		return err
+	}
+
+	r = r.Clone(r.Context())
+	r.URL.Path = path.Join("/api", apiPath)
+	r.URL.RawPath = ""
+	r.Header.Set(HeaderHops, hops)
+	proxy.ServeHTTP(w, r)
+	return nil
+}
+
+// Fanout sends the same request to agents concurrently, all agents are called if names is empty
+func (g *Gateway) Fanout(ctx context.Context, header http.Header, method, apiPath, rawQuery string, body []byte, names []string) ([]Result, error) {
+	hops, err := nextHops(header)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		for _, agent := range g.Agents() {
+			names = append(names, agent.Name)
+		}
+	}
+
+	results := make([]Result, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		agent, ok := g.agents[name]
+		if !ok {
+			results[i] = Result{Agent: name, Error: ErrAgentNotFound.Error()}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, agent Agent) {
+			defer wg.Done()
+			results[i] = g.call(ctx, agent, method, apiPath, rawQuery, body, hops)
+		}(i, agent)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+func (g *Gateway) call(ctx context.Context, agent Agent, method, apiPath, rawQuery string, body []byte, hops string) Result {
+	result := Result{Agent: agent.Name}
+
+	u := strings.TrimRight(agent.Addr, "/") + path.Join("/api", apiPath)
+	if rawQuery != "" {
+		u += "?" + rawQuery
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderHops, hops)
+	setToken(req.Header, agent)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	result.Status = resp.StatusCode
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if json.Valid(content) {
+		result.Data = content
+	} else {
+		result.Data, _ = json.Marshal(string(content))
+	}
+	return result
+}
+
+func newProxy(agent Agent, target *url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL.Scheme = target.Scheme
+			r.URL.Host = target.Host
+			r.Host = target.Host
+			setToken(r.Header, agent)
+		},
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"code": http.StatusBadGateway,
+				"msg":  fmt.Sprintf("agent[%s]: %s", agent.Name, err),
+			})
+		},
+	}
+}
+
+// setToken replaces the credentials of the caller, which are for the gateway, with the token of agent
+func setToken(header http.Header, agent Agent) {
+	header.Del("Authorization")
+	if agent.Token != "" {
+		header.Set("Authorization", "Bearer "+agent.Token)
+	}
+}
+
+// nextHops increases hops carried by header
+func nextHops(header http.Header) (string, error) {
+	var hops int
+	if v := header.Get(HeaderHops); v != "" {
+		if _, err := fmt.Sscanf(v, "%d", &hops); err != nil {
+			return "", fmt.Errorf("invalid %s header: %s", HeaderHops, v)
+		}
+	}
+	if hops >= maxHops {
+		return "", ErrTooManyHops
+	}
+	return fmt.Sprint(hops + 1), nil
+}
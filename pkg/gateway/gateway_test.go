@@ -0,0 +1,92 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGateway(t *testing.T) {
+	edge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		assert.Equal(t, "1", r.Header.Get(HeaderHops))
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"code": 200, "data": r.Method + " " + r.URL.RequestURI()})
+	}))
+	defer edge.Close()
+
+	g, err := New(&Config{Agents: []Agent{
+		{Name: "edge", Addr: edge.URL, Token: "secret"},
+		{Name: "down", Addr: "http://127.0.0.1:1"},
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, []Agent{{Name: "down", Addr: "http://127.0.0.1:1"}, {Name: "edge", Addr: edge.URL}}, g.Agents())
+
+	t.Run("proxy", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/gateway/agents/edge/jobs/1/trigger?x=1", nil)
+		r.Header.Set("Authorization", "Bearer gateway")
+		assert.Nil(t, g.Proxy(w, r, "edge", "jobs/1/trigger"))
+
+		body, _ := ioutil.ReadAll(w.Result().Body)
+		assert.Contains(t, string(body), "POST /api/jobs/1/trigger?x=1")
+		assert.Equal(t, ErrAgentNotFound, g.Proxy(w, r, "unknown", "jobs"))
+	})
+
+	t.Run("fanout", func(t *testing.T) {
+		results, err := g.Fanout(context.Background(), http.Header{}, http.MethodGet, "jobs", "", nil, nil)
+		assert.Nil(t, err)
+		assert.Len(t, results, 2)
+		assert.Equal(t, "down", results[0].Agent)
+		assert.NotEmpty(t, results[0].Error)
+		assert.Equal(t, "edge", results[1].Agent)
+		assert.Contains(t, string(results[1].Data), "GET /api/jobs")
+	})
+
+	t.Run("caller token", func(t *testing.T) {
+		// the token of the gateway is never passed to an agent configured without one
+		plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Empty(t, r.Header.Get("Authorization"))
+		}))
+		defer plain.Close()
+		g, err := New(&Config{Agents: []Agent{{Name: "plain", Addr: plain.URL}}})
+		assert.Nil(t, err)
+
+		r := httptest.NewRequest(http.MethodGet, "/api/gateway/agents/plain/jobs", nil)
+		r.Header.Set("Authorization", "Bearer gateway")
+		assert.Nil(t, g.Proxy(httptest.NewRecorder(), r, "plain", "jobs"))
+
+		header := http.Header{}
+		header.Set("Authorization", "Bearer gateway")
+		_, err = g.Fanout(context.Background(), header, http.MethodGet, "jobs", "", nil, nil)
+		assert.Nil(t, err)
+	})
+
+	t.Run("hops", func(t *testing.T) {
+		header := http.Header{}
+		header.Set(HeaderHops, "4")
+		_, err := g.Fanout(context.Background(), header, http.MethodGet, "jobs", "", nil, nil)
+		assert.Equal(t, ErrTooManyHops, err)
+	})
+
+	_, err = New(&Config{Agents: []Agent{{Name: "bad", Addr: "10.0.0.1"}}})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/util/xtime"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config gateway config
+type Config struct {
+	Enable  bool          `json:"enable"`
+	Timeout time.Duration `json:"timeout"` // timeout of each fan-out request, proxied requests are not limited
+	Agents  []Agent       `json:"agents"`  // downstream agents reachable from this agent
+}
+
+// Agent a downstream agent
+type Agent struct {
+	Name  string `json:"name"`
+	Addr  string `json:"addr"`            // http address of the agent, e.g. http://10.0.0.2:50010
+	Token string `json:"token,omitempty"` // sent as bearer token in authorization header if not empty
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadGatewayConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable:  false,
+		Timeout: xtime.Duration("10s"),
+	}
+}
+
+// Build new a instance, nil is returned if gateway mode is disabled
+func (c *Config) Build() (*Gateway, error) {
+	if !c.Enable {
+		return nil, nil
+	}
+	xlog.Info("plugin", xlog.String("gateway", "start"), xlog.Int("agents", len(c.Agents)))
+	return New(c)
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitsync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Source a branch or tag pinned in a git repository
+type Source struct {
+	Repo   string // repository url, nodes must be able to fetch it non-interactively
+	Ref    string // branch or tag
+	Dir    string // local checkout
+	Verify bool   // verify the gpg signature of the commit or tag, trusted keys must be imported on the node
+}
+
+// Fetch fetches the ref into the local checkout and returns the commit hash checked out
+func Fetch(ctx context.Context, src Source) (string, error) {
+	if _, err := os.Stat(filepath.Join(src.Dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(src.Dir, 0755); err != nil {
+			return "", err
+		}
+		if _, err := Run(ctx, src.Dir, "init", "-q"); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := Run(ctx, src.Dir, "fetch", "-q", "--force", "--no-tags", src.Repo, src.Ref); err != nil {
+		return "", err
+	}
+
+	if src.Verify {
+		kind, err := Run(ctx, src.Dir, "cat-file", "-t", "FETCH_HEAD")
+		if err != nil {
+			return "", err
+		}
+		verify := "verify-commit"
+		if kind == "tag" {
+			verify = "verify-tag"
+		}
+		if _, err := Run(ctx, src.Dir, verify, "FETCH_HEAD"); err != nil {
+			return "", fmt.Errorf("signature verification failed: %w", err)
+		}
+	}
+
+	commit, err := Run(ctx, src.Dir, "rev-parse", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return "", err
+	}
+	if _, err := Run(ctx, src.Dir, "-c", "advice.detachedHead=false", "checkout", "-q", "--force", "--detach", commit); err != nil {
+		return "", err
+	}
+	return commit, nil
+}
+
+// Head returns the commit of the local checkout, used when the remote is unreachable
+func Head(ctx context.Context, dir string) (string, error) {
+	return Run(ctx, dir, "rev-parse", "HEAD")
+}
+
+// Run runs a git command in dir and returns the trimmed output
+func Run(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
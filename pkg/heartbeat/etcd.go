@@ -0,0 +1,51 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package heartbeat
+
+import (
+	"context"
+
+	"github.com/douyu/juno-agent/pkg/etcdv3"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// etcdStore leases of etcd
+type etcdStore struct {
+	client *etcdv3.Client
+}
+
+func (s *etcdStore) Grant(ctx context.Context, ttl int64) (int64, error) {
+	resp, err := s.client.Grant(ctx, ttl)
+	if err != nil {
+		return 0, err
+	}
+	return int64(resp.ID), nil
+}
+
+// KeepAlive fails with lease not found once the lease expired
+func (s *etcdStore) KeepAlive(ctx context.Context, lease int64) error {
+	_, err := s.client.KeepAliveOnce(ctx, clientv3.LeaseID(lease))
+	return err
+}
+
+func (s *etcdStore) Put(ctx context.Context, key, value string, lease int64) error {
+	_, err := s.client.Put(ctx, key, value, clientv3.WithLease(clientv3.LeaseID(lease)))
+	return err
+}
+
+func (s *etcdStore) Revoke(ctx context.Context, lease int64) error {
+	_, err := s.client.Revoke(ctx, clientv3.LeaseID(lease))
+	return err
+}
@@ -0,0 +1,199 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package heartbeat
+
+import (
+	"context"
+	"encoding/json"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg"
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Beat payload of the node key
+type Beat struct {
+	Hostname  string    `json:"hostname"`
+	IP        string    `json:"ip"`
+	Env       string    `json:"env"`
+	Version   string    `json:"version"` // of the agent, compare across nodes to find version skew
+	GoVersion string    `json:"go_version"`
+	OS        string    `json:"os"`
+	Arch      string    `json:"arch"`
+	Started   time.Time `json:"started"`
+	Uptime    int64     `json:"uptime"`   // seconds when the payload was written, current uptime is now - started
+	Interval  int64     `json:"interval"` // seconds between keepalives
+	TTL       int64     `json:"ttl"`      // seconds the key outlives the last keepalive
+	Status
+}
+
+// Status state of the agent when the beat is sent
+type Status struct {
+	Ready        bool     `json:"ready"`                  // the scheduler is running and every watch is established
+	Watches      int      `json:"watches"`                // watches of the job store
+	WatchesDown  []string `json:"watches_down,omitempty"` // prefixes whose watch is not established
+	Jobs         int      `json:"jobs"`
+	RunningTasks int      `json:"running_tasks"`
+}
+
+// store keeps a key alive with a lease
+type store interface {
+	Grant(ctx context.Context, ttl int64) (int64, error)
+	KeepAlive(ctx context.Context, lease int64) error
+	Put(ctx context.Context, key, value string, lease int64) error
+	Revoke(ctx context.Context, lease int64) error
+}
+
+// Heartbeat registers the agent under a lease: the lease is kept alive every interval and
+// the payload is only rewritten when the status changes, so the admin watching the prefix
+// sees a node go offline when its key is deleted after ttl
+type Heartbeat struct {
+	config  *Config
+	store   store
+	started time.Time
+	stop    chan struct{}
+	done    chan struct{}
+
+	mu      sync.Mutex
+	lease   int64  // 0 when not registered
+	written Status // status of the last written payload
+
+	// Status returns the current state of the agent, set before Start
+	Status func() Status
+}
+
+// Start keep beating in background
+func (h *Heartbeat) Start() error {
+	if !h.config.Enable {
+		close(h.done)
+		return nil
+	}
+	xgo.Go(func() {
+		defer close(h.done)
+		ticker := time.NewTicker(h.config.Interval)
+		defer ticker.Stop()
+		for {
+			if err := h.beat(); err != nil {
+				xlog.Warn("heartbeat", xlog.String("key", h.Key()), xlog.FieldErr(err))
+			}
+			select {
+			case <-ticker.C:
+			case <-h.stop:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// Stop revoke the lease, so the node is offline at once rather than after ttl
+func (h *Heartbeat) Stop() error {
+	if !h.config.Enable {
+		return nil
+	}
+	close(h.stop)
+	<-h.done
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.lease == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.config.Timeout)
+	defer cancel()
+	err := h.store.Revoke(ctx, h.lease)
+	h.lease = 0
+	return err
+}
+
+// Key where the agent registers
+func (h *Heartbeat) Key() string {
+	return h.config.Prefix + h.config.Hostname
+}
+
+// Beat the payload written if the status were changed now
+func (h *Heartbeat) Beat() Beat {
+	beat := Beat{
+		Hostname:  h.config.Hostname,
+		IP:        h.config.IP,
+		Env:       h.config.Env,
+		Version:   pkg.AppVersion(),
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Started:   h.started,
+		Uptime:    int64(time.Since(h.started).Seconds()),
+		Interval:  int64(h.config.Interval.Seconds()),
+		TTL:       int64(h.config.TTL.Seconds()),
+	}
+	if h.Status != nil {
+		beat.Status = h.Status()
+	}
+	return beat
+}
+
+// beat keep the lease alive, a lease that expired, e.g. during a network partition,
+// is replaced by a new one and the payload is written again
+func (h *Heartbeat) beat() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), h.config.Timeout)
+	defer cancel()
+
+	beat := h.Beat()
+	if h.lease != 0 {
+		err := h.store.KeepAlive(ctx, h.lease)
+		if err == nil && statusEqual(beat.Status, h.written) {
+			return nil
+		}
+		if err != nil {
+			xlog.Warn("heartbeat keepalive, register again", xlog.String("key", h.Key()), xlog.FieldErr(err))
+			h.lease = 0
+		}
+	}
+	if h.lease == 0 {
+		lease, err := h.store.Grant(ctx, int64(h.config.TTL.Seconds()))
+		if err != nil {
+			return err
+		}
+		h.lease = lease
+	}
+
+	value, err := json.Marshal(beat)
+	if err != nil {
+		return err
+	}
+	if err := h.store.Put(ctx, h.Key(), string(value), h.lease); err != nil {
+		return err
+	}
+	h.written = beat.Status
+	return nil
+}
+
+func statusEqual(x, y Status) bool {
+	if x.Ready != y.Ready || x.Watches != y.Watches || x.Jobs != y.Jobs || x.RunningTasks != y.RunningTasks ||
+		len(x.WatchesDown) != len(y.WatchesDown) {
+		return false
+	}
+	for i := range x.WatchesDown {
+		if x.WatchesDown[i] != y.WatchesDown[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package heartbeat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memStore leases in memory, expire drops a lease together with its keys
+type memStore struct {
+	next   int64
+	leases map[int64]bool
+	keys   map[string]string
+	puts   int
+}
+
+func (s *memStore) Grant(ctx context.Context, ttl int64) (int64, error) {
+	s.next++
+	s.leases[s.next] = true
+	return s.next, nil
+}
+
+func (s *memStore) KeepAlive(ctx context.Context, lease int64) error {
+	if !s.leases[lease] {
+		return errors.New("requested lease not found")
+	}
+	return nil
+}
+
+func (s *memStore) Put(ctx context.Context, key, value string, lease int64) error {
+	s.puts++
+	s.keys[key] = value
+	return nil
+}
+
+func (s *memStore) Revoke(ctx context.Context, lease int64) error {
+	delete(s.leases, lease)
+	s.keys = make(map[string]string)
+	return nil
+}
+
+func TestBeat(t *testing.T) {
+	config := DefaultConfig()
+	config.Hostname = "node-1"
+	store := &memStore{leases: make(map[int64]bool), keys: make(map[string]string)}
+	h := config.Build()
+	h.store = store
+	status := Status{Ready: true, Watches: 2, Jobs: 3}
+	h.Status = func() Status { return status }
+
+	assert.NoError(t, h.beat())
+	var beat Beat
+	assert.NoError(t, json.Unmarshal([]byte(store.keys["/juno-agent/nodes/node-1"]), &beat))
+	assert.Equal(t, "node-1", beat.Hostname)
+	assert.Equal(t, int64(30), beat.TTL)
+	assert.Equal(t, 3, beat.Jobs)
+
+	// only the lease is kept alive while the status is unchanged
+	assert.NoError(t, h.beat())
+	assert.Equal(t, 1, store.puts)
+	status.RunningTasks = 1
+	status.WatchesDown = []string{"/juno/cronjob/"}
+	assert.NoError(t, h.beat())
+	assert.Equal(t, 2, store.puts)
+
+	// an expired lease is replaced and the payload written again
+	store.leases = make(map[int64]bool)
+	store.keys = make(map[string]string)
+	assert.NoError(t, h.beat())
+	assert.Equal(t, int64(2), h.lease)
+	assert.NoError(t, json.Unmarshal([]byte(store.keys["/juno-agent/nodes/node-1"]), &beat))
+	assert.Equal(t, []string{"/juno/cronjob/"}, beat.WatchesDown)
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package heartbeat
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/etcdv3"
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config agent heartbeat config
+type Config struct {
+	Enable   bool          `json:"enable"`
+	Interval time.Duration `json:"interval"` // how often the lease is kept alive
+	TTL      time.Duration `json:"ttl"`      // the node key is deleted when no keepalive arrives for this long
+	Timeout  time.Duration `json:"timeout"`  // of each beat
+	Etcd     string        `json:"etcd"`     // name of the etcd client config
+	Prefix   string        `json:"prefix"`   // the agent registers at <prefix><hostname>
+	// Hostname, IP and Env identify the node, set before Build
+	Hostname string `json:"-"`
+	IP       string `json:"-"`
+	Env      string `json:"-"`
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadHeartbeatConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable:   false,
+		Interval: 10 * time.Second,
+		TTL:      30 * time.Second,
+		Timeout:  3 * time.Second,
+		Etcd:     "default",
+		Prefix:   "/juno-agent/nodes/",
+	}
+}
+
+// Build new a instance
+func (c *Config) Build() *Heartbeat {
+	if c.Enable && c.TTL <= c.Interval {
+		// a single delayed keepalive would mark the node offline
+		xlog.Warn("plugin", xlog.String("heartbeat", "ttl should be longer than interval"), xlog.Duration("ttl", c.TTL))
+		c.TTL = 3 * c.Interval
+	}
+	heartbeat := &Heartbeat{
+		config:  c,
+		started: time.Now(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if c.Enable {
+		xlog.Info("plugin", xlog.String("heartbeat", "start"), xlog.String("key", heartbeat.Key()))
+		heartbeat.store = &etcdStore{client: etcdv3.StdConfig(c.Etcd).Build()}
+	}
+	return heartbeat
+}
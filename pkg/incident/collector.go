@@ -0,0 +1,139 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package incident
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/platform"
+)
+
+const collectTimeout = 10 * time.Second
+
+// Collector collects one kind of evidence, each returned file is added to the bundle
+type Collector func(ctx context.Context) (map[string][]byte, error)
+
+func defaultCollectors(c *Config) map[string]Collector {
+	collectors := map[string]Collector{
+		"netstat": netstatCollector,
+		"logs":    logCollector(c.LogFiles, c.LogTail),
+		"metrics": metricsCollector(c.MetricsURL),
+	}
+	if platform.Supported(platform.ProcessScan) {
+		collectors["processes"] = commandCollector("processes.txt", "ps", "auxww")
+	}
+	if platform.Supported(platform.ProcFS) {
+		collectors["host"] = fileCollector("/proc/loadavg", "/proc/meminfo", "/proc/stat", "/proc/diskstats", "/proc/net/dev")
+	}
+	return collectors
+}
+
+func commandCollector(name string, command string, args ...string) Collector {
+	return func(ctx context.Context) (map[string][]byte, error) {
+		out, err := exec.CommandContext(ctx, command, args...).CombinedOutput()
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{name: out}, nil
+	}
+}
+
+// netstatCollector prefers ss, falls back to netstat and raw /proc/net files
+func netstatCollector(ctx context.Context) (map[string][]byte, error) {
+	if out, err := exec.CommandContext(ctx, "ss", "-tanp").CombinedOutput(); err == nil {
+		return map[string][]byte{"netstat.txt": out}, nil
+	}
+	if out, err := exec.CommandContext(ctx, "netstat", "-tanp").CombinedOutput(); err == nil {
+		return map[string][]byte{"netstat.txt": out}, nil
+	}
+	return fileCollector("/proc/net/tcp", "/proc/net/tcp6")(ctx)
+}
+
+func fileCollector(paths ...string) Collector {
+	return func(ctx context.Context) (map[string][]byte, error) {
+		files := make(map[string][]byte)
+		for _, path := range paths {
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			files[filepath.Base(filepath.Dir(path))+"_"+filepath.Base(path)] = content
+		}
+		return files, nil
+	}
+}
+
+func logCollector(paths []string, tail int64) Collector {
+	return func(ctx context.Context) (map[string][]byte, error) {
+		files := make(map[string][]byte)
+		for _, path := range paths {
+			content, err := tailFile(path, tail)
+			if err != nil {
+				continue
+			}
+			files["logs/"+filepath.Base(path)] = content
+		}
+		return files, nil
+	}
+}
+
+func tailFile(path string, size int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > size {
+		if _, err := file.Seek(-size, io.SeekEnd); err != nil {
+			return nil, err
+		}
+	}
+	return ioutil.ReadAll(file)
+}
+
+func metricsCollector(url string) Collector {
+	return func(ctx context.Context) (map[string][]byte, error) {
+		if url == "" {
+			return nil, nil
+		}
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		content, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{"metrics.txt": content}, nil
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package incident
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+const bundleSuffix = ".tar.gz"
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// Event a high-severity event which triggers an evidence capture
+type Event struct {
+	Source string            `json:"source"` // e.g. job/{jobId}, app/{command}
+	Reason string            `json:"reason"`
+	Meta   map[string]string `json:"meta,omitempty"`
+	Time   time.Time         `json:"time"`
+}
+
+// Bundle evidence captured for an event
+type Bundle struct {
+	Name   string    `json:"name"`
+	Size   int64     `json:"size"`
+	Time   time.Time `json:"time"`
+	Errors []string  `json:"errors,omitempty"` // collectors that failed
+}
+
+// Recorder decides when to capture evidence and writes bundles to local disk
+type Recorder struct {
+	config     *Config
+	collectors map[string]Collector
+
+	mu          sync.Mutex
+	lastCapture map[string]time.Time
+	restarts    map[string][]time.Time
+}
+
+// JobFailed is called on every failed run with the number of consecutive failures,
+// evidence is captured when the threshold is reached
+func (r *Recorder) JobFailed(jobID string, failures int, meta map[string]string) (*Bundle, bool) {
+	if !r.config.Enable || failures < r.config.JobFailures {
+		return nil, false
+	}
+	return r.Capture(Event{
+		Source: "job/" + jobID,
+		Reason: fmt.Sprintf("job failed %d times in a row", failures),
+		Meta:   meta,
+	})
+}
+
+// AppRestarted is called when an app process starts,
+// evidence is captured when the app restarts too often (crash loop)
+func (r *Recorder) AppRestarted(app string) (*Bundle, bool) {
+	if !r.config.Enable {
+		return nil, false
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	restarts := []time.Time{now}
+	for _, t := range r.restarts[app] {
+		if now.Sub(t) < r.config.CrashLoopWindow {
+			restarts = append(restarts, t)
+		}
+	}
+	r.restarts[app] = restarts
+	r.mu.Unlock()
+
+	if len(restarts) < r.config.CrashLoopRestart {
+		return nil, false
+	}
+	return r.Capture(Event{
+		Source: "app/" + app,
+		Reason: fmt.Sprintf("app restarted %d times in %s", len(restarts), r.config.CrashLoopWindow),
+	})
+}
+
+// Capture collects evidence for the event synchronously.
+// returns false if capture is disabled or the source is in cooldown
+func (r *Recorder) Capture(event Event) (*Bundle, bool) {
+	if !r.config.Enable {
+		return nil, false
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	r.mu.Lock()
+	if last, ok := r.lastCapture[event.Source]; ok && event.Time.Sub(last) < r.config.Cooldown {
+		r.mu.Unlock()
+		return nil, false
+	}
+	r.lastCapture[event.Source] = event.Time
+	r.mu.Unlock()
+
+	bundle, err := r.write(event)
+	if err != nil {
+		xlog.Error("incident capture", xlog.String("source", event.Source), xlog.FieldErr(err))
+		return nil, false
+	}
+	xlog.Warn("incident evidence captured", xlog.String("source", event.Source), xlog.String("bundle", bundle.Name))
+
+	r.prune()
+	return bundle, true
+}
+
+// Bundles list captured bundles, newest first
+func (r *Recorder) Bundles() ([]Bundle, error) {
+	infos, err := ioutil.ReadDir(r.config.Dir)
+	if os.IsNotExist(err) {
+		return []Bundle{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bundles := make([]Bundle, 0, len(infos))
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), bundleSuffix) {
+			continue
+		}
+		bundles = append(bundles, Bundle{Name: info.Name(), Size: info.Size(), Time: info.ModTime()})
+	}
+	sort.Slice(bundles, func(i, j int) bool {
+		return bundles[i].Name > bundles[j].Name
+	})
+	return bundles, nil
+}
+
+// BundlePath returns the local path of a bundle, name must be one returned by Bundles
+func (r *Recorder) BundlePath(name string) (string, error) {
+	if name != filepath.Base(name) || !strings.HasSuffix(name, bundleSuffix) {
+		return "", errors.New("invalid bundle name")
+	}
+	path := filepath.Join(r.config.Dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (r *Recorder) write(event Event) (*Bundle, error) {
+	if err := os.MkdirAll(r.config.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	bundle := &Bundle{
+		Name: event.Time.Format("20060102-150405") + "-" + invalidNameChars.ReplaceAllString(event.Source, "_") + bundleSuffix,
+		Time: event.Time,
+	}
+	path := filepath.Join(r.config.Dir, bundle.Name)
+	file, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	gw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gw)
+
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		files, err := r.collectors[name](ctx)
+		if err != nil {
+			bundle.Errors = append(bundle.Errors, name+": "+err.Error())
+		}
+		for fileName, content := range files {
+			if err := addFile(tw, fileName, content, event.Time); err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+	}
+
+	meta, _ := json.MarshalIndent(map[string]interface{}{
+		"event":  event,
+		"errors": bundle.Errors,
+	}, "", "  ")
+	if err := addFile(tw, "event.json", meta, event.Time); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		bundle.Size = info.Size()
+	}
+	return bundle, nil
+}
+
+func addFile(tw *tar.Writer, name string, content []byte, modTime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(content)),
+		ModTime: modTime,
+	}); err != nil {
+		return err
+	}
+	_, err := tw.Write(content)
+	return err
+}
+
+// prune remove the oldest bundles exceeding MaxBundles
+func (r *Recorder) prune() {
+	bundles, err := r.Bundles()
+	if err != nil || len(bundles) <= r.config.MaxBundles {
+		return
+	}
+	for _, bundle := range bundles[r.config.MaxBundles:] {
+		_ = os.Remove(filepath.Join(r.config.Dir, bundle.Name))
+	}
+}
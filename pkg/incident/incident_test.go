@@ -0,0 +1,81 @@
+package incident
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "incident")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.Enable = true
+	config.Dir = dir
+	config.JobFailures = 2
+	recorder := config.Build()
+	recorder.collectors = map[string]Collector{
+		"processes": func(ctx context.Context) (map[string][]byte, error) {
+			return map[string][]byte{"processes.txt": []byte("pid 1")}, nil
+		},
+	}
+
+	_, captured := recorder.JobFailed("job-1", 1, nil)
+	assert.False(t, captured)
+
+	bundle, captured := recorder.JobFailed("job-1", 2, map[string]string{"task_id": "100"})
+	assert.True(t, captured)
+
+	// in cooldown
+	_, captured = recorder.JobFailed("job-1", 3, nil)
+	assert.False(t, captured)
+
+	path, err := recorder.BundlePath(bundle.Name)
+	assert.NoError(t, err)
+
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	gr, err := gzip.NewReader(file)
+	assert.NoError(t, err)
+
+	names := make([]string, 0)
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, header.Name)
+	}
+	assert.ElementsMatch(t, []string{"processes.txt", "event.json"}, names)
+
+	_, err = recorder.BundlePath("../" + bundle.Name)
+	assert.Error(t, err)
+}
+
+func TestCrashLoop(t *testing.T) {
+	config := DefaultConfig()
+	config.Enable = true
+	config.Dir, _ = ioutil.TempDir("", "incident")
+	defer os.RemoveAll(config.Dir)
+	config.CrashLoopRestart = 3
+	config.CrashLoopWindow = time.Minute
+	recorder := config.Build()
+	recorder.collectors = map[string]Collector{}
+
+	_, captured := recorder.AppRestarted("app")
+	assert.False(t, captured)
+	_, captured = recorder.AppRestarted("app")
+	assert.False(t, captured)
+	_, captured = recorder.AppRestarted("app")
+	assert.True(t, captured)
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package incident
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/util/xtime"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config incident evidence capture config
+type Config struct {
+	Enable     bool          `json:"enable"`
+	Dir        string        `json:"dir"`         // dir which bundles are written to
+	MaxBundles int           `json:"max_bundles"` // oldest bundles are removed when exceeded
+	Cooldown   time.Duration `json:"cooldown"`    // min interval between captures of the same source
+	LogFiles   []string      `json:"log_files"`   // log files whose tail is captured
+	LogTail    int64         `json:"log_tail"`    // bytes captured from the end of each log file
+	MetricsURL string        `json:"metrics_url"` // prometheus endpoint of the agent, e.g. http://127.0.0.1:9990/metrics
+
+	JobFailures      int           `json:"job_failures"`       // consecutive job failures which trigger a capture
+	CrashLoopRestart int           `json:"crash_loop_restart"` // app restarts within CrashLoopWindow which trigger a capture
+	CrashLoopWindow  time.Duration `json:"crash_loop_window"`
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadIncidentConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable:           false,
+		Dir:              "/tmp/juno-agent/incident",
+		MaxBundles:       50,
+		Cooldown:         xtime.Duration("10m"),
+		LogTail:          64 * 1024,
+		JobFailures:      3,
+		CrashLoopRestart: 3,
+		CrashLoopWindow:  xtime.Duration("5m"),
+	}
+}
+
+// Build new a instance
+func (c *Config) Build() *Recorder {
+	if c.Enable {
+		xlog.Info("plugin", xlog.String("incident", "start"))
+	}
+	return &Recorder{
+		config:      c,
+		lastCapture: make(map[string]time.Time),
+		restarts:    make(map[string][]time.Time),
+		collectors:  defaultCollectors(c),
+	}
+}
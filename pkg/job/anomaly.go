@@ -0,0 +1,128 @@
+package job
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/metric"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// 耗时异常的执行次数
+var jobAnomalyCounter = metric.CounterVecOpts{
+	Namespace: "juno",
+	Subsystem: "agent",
+	Name:      "job_duration_anomalies_total",
+	Help:      "successful runs that took abnormally long compared with recent runs of the job",
+	Labels:    []string{"job"},
+}.Build()
+
+// AnomalyConfig 按任务最近成功执行的耗时检测异常变慢的执行，超过 Sigma 倍标准差或 MedianFactor 倍中位数时告警
+type AnomalyConfig struct {
+	Enable       bool
+	Window       int           // 参与统计的最近成功执行次数
+	MinRuns      int           // 统计的执行次数不足时不检测
+	Sigma        float64       // 超过平均值加 Sigma 倍标准差时告警，为 0 时不按标准差检测
+	MedianFactor float64       // 超过中位数的倍数时告警，为 0 时不按中位数检测
+	MinDuration  time.Duration // 耗时低于该值的执行不告警，避免秒级任务的抖动
+}
+
+func (c *AnomalyConfig) normalize() {
+	if c.Window <= 0 {
+		c.Window = 30
+	}
+	if c.MinRuns <= 0 {
+		c.MinRuns = 5
+	}
+	if c.MinRuns > c.Window {
+		c.MinRuns = c.Window
+	}
+}
+
+// DurationAnomaly 耗时异常的执行与最近执行的统计，单位秒
+type DurationAnomaly struct {
+	Duration float64 `json:"duration"`
+	Mean     float64 `json:"mean"`
+	StdDev   float64 `json:"stddev"`
+	Median   float64 `json:"median"`
+	Runs     int     `json:"runs"` // 参与统计的执行次数
+	Reason   string  `json:"reason"`
+}
+
+// detectAnomaly 与 history 比较，duration 不异常时返回 nil
+func (c *AnomalyConfig) detectAnomaly(history []float64, duration float64) *DurationAnomaly {
+	if len(history) < c.MinRuns || duration < c.MinDuration.Seconds() {
+		return nil
+	}
+
+	var sum float64
+	for _, d := range history {
+		sum += d
+	}
+	mean := sum / float64(len(history))
+	var variance float64
+	for _, d := range history {
+		variance += (d - mean) * (d - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(history)))
+
+	sorted := append([]float64(nil), history...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + median) / 2
+	}
+
+	anomaly := &DurationAnomaly{Duration: duration, Mean: mean, StdDev: stddev, Median: median, Runs: len(history)}
+	switch {
+	case c.Sigma > 0 && stddev > 0 && duration > mean+c.Sigma*stddev:
+		anomaly.Reason = fmt.Sprintf("took %.1fs, more than %.1f sigma above mean %.1fs", duration, (duration-mean)/stddev, mean)
+	case c.MedianFactor > 0 && median > 0 && duration > median*c.MedianFactor:
+		anomaly.Reason = fmt.Sprintf("took %.1fs, %.1f times of median %.1fs", duration, duration/median, median)
+	default:
+		return nil
+	}
+	return anomaly
+}
+
+// checkDuration 成功的执行结束时调用，调用方持有 runsMutex
+// 异常的执行同样计入统计，持续变慢时统计随之调整，不会每次都告警
+func (w *worker) checkDuration(result *TaskResult) {
+	if !w.Anomaly.Enable || result.Status != CronTaskStatusSuccess || result.FinishedAt == nil {
+		return
+	}
+
+	id := result.Job.ID
+	duration := result.FinishedAt.Sub(result.ExecutedAt).Seconds()
+	history := w.durations[id]
+	if anomaly := w.Anomaly.detectAnomaly(history, duration); anomaly != nil {
+		w.reportAnomaly(result, anomaly)
+	}
+
+	history = append(history, duration)
+	if len(history) > w.Anomaly.Window {
+		history = history[len(history)-w.Anomaly.Window:]
+	}
+	w.durations[id] = history
+}
+
+func (w *worker) reportAnomaly(result *TaskResult, anomaly *DurationAnomaly) {
+	jobAnomalyCounter.Inc(result.Job.ID)
+	w.logger.Warn("job duration anomaly", fieldJob(result.Job.ID), fieldTask(result.TaskID), xlog.String("reason", anomaly.Reason))
+
+	w.emit(&CallbackEvent{
+		Event:      CallbackAnomaly,
+		JobID:      result.Job.ID,
+		JobName:    result.Job.Name,
+		TaskID:     result.TaskID,
+		Node:       w.HostName,
+		ExecutedAt: result.ExecutedAt,
+		FinishedAt: result.FinishedAt,
+		Anomaly:    anomaly,
+	})
+	if w.OnAnomaly != nil {
+		go w.OnAnomaly(result, anomaly)
+	}
+}
@@ -0,0 +1,55 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectAnomaly(t *testing.T) {
+	config := &AnomalyConfig{Sigma: 3, MedianFactor: 2, MinRuns: 5}
+	config.normalize()
+
+	history := []float64{60, 62, 58, 61, 59}
+	assert.Nil(t, config.detectAnomaly(history[:4], 600), "not enough runs")
+	assert.Nil(t, config.detectAnomaly(history, 63))
+
+	anomaly := config.detectAnomaly(history, 90)
+	assert.NotNil(t, anomaly)
+	assert.Equal(t, float64(60), anomaly.Median)
+	assert.Contains(t, anomaly.Reason, "sigma")
+
+	// 耗时完全相同时标准差为 0，按中位数检测
+	anomaly = config.detectAnomaly([]float64{10, 10, 10, 10, 10}, 25)
+	assert.NotNil(t, anomaly)
+	assert.Contains(t, anomaly.Reason, "median")
+
+	config.MinDuration = time.Minute
+	assert.Nil(t, config.detectAnomaly([]float64{10, 10, 10, 10, 10}, 25))
+}
+
+func TestCheckDuration(t *testing.T) {
+	config := DefaultConfig()
+	config.Anomaly.Enable = true
+	config.Anomaly.Window = 5
+	config.Anomaly.MinDuration = 0
+	anomalies := make(chan *DurationAnomaly, 1)
+	config.OnAnomaly = func(result *TaskResult, anomaly *DurationAnomaly) {
+		anomalies <- anomaly
+	}
+	w := &worker{Config: config, durations: make(map[string][]float64)}
+
+	run := func(seconds int) {
+		executed := time.Now()
+		finished := executed.Add(time.Duration(seconds) * time.Second)
+		w.checkDuration(&TaskResult{Job: &Job{ID: "a"}, Status: CronTaskStatusSuccess, ExecutedAt: executed, FinishedAt: &finished})
+	}
+	for i := 0; i < 7; i++ {
+		run(10)
+	}
+	assert.Len(t, w.durations["a"], 5)
+
+	run(100)
+	assert.Equal(t, float64(100), (<-anomalies).Duration)
+}
@@ -0,0 +1,370 @@
+package job
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/metric"
+	"golang.org/x/sync/singleflight"
+)
+
+// EnvJobArtifact 下载并校验后的制品路径
+const EnvJobArtifact = "JUNO_JOB_ARTIFACT"
+
+// ErrChecksumMismatch 脚本或制品的内容与声明的 SHA-256、签名不符，不执行
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// 校验不通过而没有执行的次数
+var scriptVerifyFailuresCounter = metric.CounterVecOpts{
+	Namespace: "juno",
+	Subsystem: "agent",
+	Name:      "script_verify_failures_total",
+	Help:      "job runs refused because the script or artifact failed verification",
+	Labels:    []string{"job"},
+}.Build()
+
+// ArtifactConfig 任务制品的下载及缓存
+type ArtifactConfig struct {
+	CacheDir string        // 缓存目录，文件名为内容的 SHA-256，只有 agent 用户可以访问
+	Timeout  time.Duration // 单次下载超时
+	MaxSize  int64         // 允许下载的最大字节数
+	// s3://bucket/key 及 oss://bucket/key 的访问配置，未配置密钥时匿名访问
+	S3  S3Config
+	OSS OSSConfig
+}
+
+func (c *ArtifactConfig) normalize() {
+	if c.CacheDir == "" {
+		c.CacheDir = "/var/lib/juno-agent/artifacts"
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 5 * time.Minute
+	}
+	if c.MaxSize <= 0 {
+		c.MaxSize = 512 << 20
+	}
+}
+
+// Artifact 执行前下载的制品，支持 http(s)、s3、oss 地址，必须声明 SHA-256，下载后校验并按摘要缓存
+type Artifact struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	// 工作区中的文件名，默认为 URL 路径的最后一段
+	Name string `json:"name"`
+	// 可选的签名，格式为 keyID:base64(ed25519(sha256 摘要))，使用 jobAuth 中配置的公钥校验
+	Signature string `json:"signature"`
+}
+
+func (a *Artifact) Valid() error {
+	u, err := url.Parse(a.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid artifact url %q", a.URL)
+	}
+	switch u.Scheme {
+	case "http", "https", "s3", "oss":
+	default:
+		return fmt.Errorf("unsupported artifact url scheme %q", u.Scheme)
+	}
+	if a.SHA256 == "" {
+		return errors.New("artifact: sha256 is required")
+	}
+	if err := validSHA256(a.SHA256); err != nil {
+		return fmt.Errorf("artifact: %w", err)
+	}
+	if name := a.fileName(); name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid artifact name %q", name)
+	}
+	if a.Signature != "" && !strings.Contains(a.Signature, ":") {
+		return errors.New("artifact signature should be keyID:signature")
+	}
+	return nil
+}
+
+// fileName 制品在工作区中的文件名
+func (a *Artifact) fileName() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	if u, err := url.Parse(a.URL); err == nil {
+		return path.Base(u.Path)
+	}
+	return ""
+}
+
+func validSHA256(sum string) error {
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("invalid sha256 %q", sum)
+	}
+	return nil
+}
+
+func (j *Job) validIntegrity() error {
+	if j.ScriptSHA256 != "" {
+		if j.ExecMode == ExecModeShell {
+			return errors.New("script_sha256 is not supported when exec_mode is shell")
+		}
+		if err := validSHA256(j.ScriptSHA256); err != nil {
+			return fmt.Errorf("script_sha256: %w", err)
+		}
+	}
+	if j.Artifact != nil {
+		if err := j.Artifact.Valid(); err != nil {
+			return err
+		}
+		if j.Script == "" && j.ExecMode != ExecModeScript {
+			return errors.New("script is required when exec_mode is not empty")
+		}
+	}
+	names := make(map[string]bool, len(j.Artifacts))
+	for i, a := range j.Artifacts {
+		if a == nil {
+			return fmt.Errorf("artifact[%d] is empty", i)
+		}
+		if err := a.Valid(); err != nil {
+			return err
+		}
+		if names[a.fileName()] {
+			return fmt.Errorf("duplicate artifact name %q", a.fileName())
+		}
+		names[a.fileName()] = true
+	}
+	return nil
+}
+
+// verifyScript 每次执行前下载并校验制品、校验脚本内容，不符时不执行。
+// 校验时将内容复制到私有目录，返回实际执行的副本及制品的路径，执行结束后调用 cleanup 删除副本，
+// 避免校验之后、执行之前文件被替换
+func (j *Job) verifyScript(ctx context.Context, script string) (string, string, func(), error) {
+	cleanup := func() {}
+	if j.Artifact == nil && j.ScriptSHA256 == "" {
+		return script, "", cleanup, nil
+	}
+	dir, err := j.artifacts.runDir()
+	if err != nil {
+		return "", "", cleanup, err
+	}
+	cleanup = func() { _ = os.RemoveAll(dir) }
+
+	var artifact string
+	if j.Artifact != nil {
+		path := filepath.Join(dir, j.Artifact.fileName())
+		if err := j.artifacts.checkout(ctx, j.Artifact.URL, j.Artifact.SHA256, path); err != nil {
+			cleanup()
+			return "", "", func() {}, err
+		}
+		if err := j.verifySignature(j.Artifact); err != nil {
+			cleanup()
+			return "", "", func() {}, err
+		}
+		artifact = path
+		if j.Script == "" {
+			script = path
+		}
+	}
+	if j.ScriptSHA256 != "" {
+		// 执行的是制品本身时，制品的副本已按 artifact.sha256 校验
+		if script == artifact && !strings.EqualFold(j.ScriptSHA256, j.Artifact.SHA256) {
+			cleanup()
+			return "", "", func() {}, fmt.Errorf("%w: %s is %s, expected %s", ErrChecksumMismatch, script, j.Artifact.SHA256, j.ScriptSHA256)
+		}
+		if script != artifact {
+			path := filepath.Join(dir, "script-"+filepath.Base(script))
+			if err := copyVerified(script, path, strings.ToLower(j.ScriptSHA256)); err != nil {
+				cleanup()
+				return "", "", func() {}, err
+			}
+			script = path
+		}
+	}
+	return script, artifact, cleanup, nil
+}
+
+// verifySignature 制品的摘要在下载时已校验，这里校验管理端对摘要的签名。
+// 签名使用 jobAuth 中配置的 ed25519 公钥，与任务签名共用密钥管理，agent 不依赖 cosign
+// 等外部工具及透明日志，管理端签名时对 sha256 摘要签名即可
+func (j *Job) verifySignature(a *Artifact) error {
+	if a.Signature == "" {
+		return nil
+	}
+	index := strings.Index(a.Signature, ":")
+	key := j.JobAuth.key(a.Signature[:index])
+	if key == nil || key.key == nil {
+		return fmt.Errorf("%w: unknown artifact signing key %q", ErrChecksumMismatch, a.Signature[:index])
+	}
+	signature, err := base64.StdEncoding.DecodeString(a.Signature[index+1:])
+	if err != nil {
+		return fmt.Errorf("%w: invalid artifact signature encoding", ErrChecksumMismatch)
+	}
+	digest, _ := hex.DecodeString(a.SHA256)
+	if !ed25519.Verify(key.key, digest, signature) {
+		return fmt.Errorf("%w: artifact signature mismatch", ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// fetchArtifacts 下载 artifacts 到工作区，工作区中的文件为校验过的副本
+func (j *Job) fetchArtifacts(ctx context.Context, dir string) error {
+	for _, a := range j.Artifacts {
+		err := j.artifacts.checkout(ctx, a.URL, a.SHA256, filepath.Join(dir, a.fileName()))
+		if err == nil {
+			err = j.verifySignature(a)
+		}
+		if err != nil {
+			return fmt.Errorf("artifact %s: %w", a.fileName(), err)
+		}
+	}
+	return nil
+}
+
+// copyVerified 复制 src 到新建的 dst 并在复制时计算摘要，不符时删除 dst。
+// 摘要按写入 dst 的内容计算，dst 位于私有目录中，校验后不会再被修改
+func copyVerified(src, dst, sum string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0700)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, h), in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		if actual := hex.EncodeToString(h.Sum(nil)); actual != sum {
+			err = fmt.Errorf("%w: %s is %s, expected %s", ErrChecksumMismatch, src, actual, sum)
+		}
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+	}
+	return err
+}
+
+// artifactCache 按 SHA-256 缓存下载的制品，同一制品并发执行时只下载一次
+type artifactCache struct {
+	config *ArtifactConfig
+	client *http.Client
+	group  singleflight.Group
+}
+
+func newArtifactCache(config *ArtifactConfig) *artifactCache {
+	return &artifactCache{config: config, client: &http.Client{Timeout: config.Timeout}}
+}
+
+// fetch 缓存的文件每次使用前重新计算摘要，被修改时重新下载
+func (c *artifactCache) fetch(ctx context.Context, rawURL, sha string) (string, error) {
+	sum := strings.ToLower(sha)
+	path := filepath.Join(c.config.CacheDir, sum)
+	if actual, err := fileSHA256(path); err == nil && actual == sum {
+		return path, nil
+	}
+
+	_, err, _ := c.group.Do(sum, func() (interface{}, error) {
+		return nil, c.download(ctx, rawURL, sum, path)
+	})
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// checkout 复制缓存的制品到 dst，复制的内容被修改过时重新下载一次
+func (c *artifactCache) checkout(ctx context.Context, rawURL, sha, dst string) error {
+	sum := strings.ToLower(sha)
+	path, err := c.fetch(ctx, rawURL, sum)
+	if err != nil {
+		return err
+	}
+	if err = copyVerified(path, dst, sum); errors.Is(err, ErrChecksumMismatch) {
+		_ = os.Remove(path)
+		if path, err = c.fetch(ctx, rawURL, sum); err == nil {
+			err = copyVerified(path, dst, sum)
+		}
+	}
+	return err
+}
+
+// runDir 在缓存目录中创建本次执行的私有目录，存放校验过的脚本、制品副本
+func (c *artifactCache) runDir() (string, error) {
+	if err := privateDir(c.config.CacheDir); err != nil {
+		return "", err
+	}
+	return ioutil.TempDir(c.config.CacheDir, ".run-")
+}
+
+// download 下载到 path 所在目录的临时文件，校验摘要后重命名为 path
+func (c *artifactCache) download(ctx context.Context, rawURL, sum, path string) error {
+	dir := filepath.Dir(path)
+	if err := privateDir(dir); err != nil {
+		return err
+	}
+	req, err := c.request(rawURL)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("download artifact: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download artifact: unexpected status %d", resp.StatusCode)
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".download-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(resp.Body, c.config.MaxSize+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("download artifact: %w", err)
+	}
+	if n > c.config.MaxSize {
+		return fmt.Errorf("download artifact: larger than %d bytes", c.config.MaxSize)
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != sum {
+		return fmt.Errorf("%w: artifact %s is %s, expected %s", ErrChecksumMismatch, rawURL, actual, sum)
+	}
+	if err := os.Chmod(tmp.Name(), 0700); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
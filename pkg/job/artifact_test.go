@@ -0,0 +1,159 @@
+package job
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifact")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	content := []byte("#!/bin/sh\necho ok\n")
+	digest := sha256.Sum256(content)
+	sum := hex.EncodeToString(digest[:])
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		downloads++
+		_, _ = rw.Write(content)
+	}))
+	defer server.Close()
+
+	public, private, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	config := DefaultConfig()
+	config.Artifacts.CacheDir = filepath.Join(dir, "cache")
+	config.JobAuth.Keys = []*JobAuthKey{{ID: "ops", PublicKey: base64.StdEncoding.EncodeToString(public)}}
+	assert.NoError(t, config.JobAuth.Valid())
+	w := &worker{Config: config, artifacts: newArtifactCache(&config.Artifacts)}
+
+	job := &Job{ID: "deploy", worker: w, Artifact: &Artifact{
+		URL:       server.URL + "/deploy.sh",
+		SHA256:    sum,
+		Signature: "ops:" + base64.StdEncoding.EncodeToString(ed25519.Sign(private, digest[:])),
+	}}
+	assert.NoError(t, job.ValidRules())
+	script, artifact, cleanup, err := job.verifyScript(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, script, artifact)
+	// 执行的是私有目录中校验过的副本，修改缓存不影响本次执行
+	assert.Equal(t, filepath.Join(dir, "cache"), filepath.Dir(filepath.Dir(script)))
+	stat, err := os.Stat(filepath.Join(dir, "cache"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), stat.Mode().Perm())
+	cached := filepath.Join(dir, "cache", sum)
+	assert.NoError(t, ioutil.WriteFile(cached, []byte("rm -rf /"), 0755))
+	got, _ := ioutil.ReadFile(script)
+	assert.Equal(t, content, got)
+	cleanup()
+	_, err = os.Stat(script)
+	assert.True(t, os.IsNotExist(err))
+
+	// 缓存的制品每次重新校验，被修改后重新下载
+	assert.Equal(t, 1, downloads)
+	_, _, cleanup, err = job.verifyScript(context.Background(), "")
+	assert.NoError(t, err)
+	cleanup()
+	assert.Equal(t, 2, downloads)
+	_, _, cleanup, err = job.verifyScript(context.Background(), "")
+	assert.NoError(t, err)
+	cleanup()
+	assert.Equal(t, 2, downloads)
+
+	// 摘要、签名不符时不执行
+	job.Artifact.Signature = "ops:" + base64.StdEncoding.EncodeToString(ed25519.Sign(private, []byte("other")))
+	_, _, cleanup, err = job.verifyScript(context.Background(), "")
+	cleanup()
+	assert.True(t, errors.Is(err, ErrChecksumMismatch))
+
+	local := filepath.Join(dir, "local.sh")
+	assert.NoError(t, ioutil.WriteFile(local, []byte("echo changed"), 0755))
+	job = &Job{ID: "local", worker: w, ScriptSHA256: sum}
+	_, _, cleanup, err = job.verifyScript(context.Background(), local)
+	cleanup()
+	assert.True(t, errors.Is(err, ErrChecksumMismatch))
+	assert.NoError(t, ioutil.WriteFile(local, content, 0755))
+	script, _, cleanup, err = job.verifyScript(context.Background(), local)
+	assert.NoError(t, err)
+	assert.NotEqual(t, local, script)
+	cleanup()
+}
+
+func TestPrepareWorkspace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workspace")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		_, _ = rw.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.Artifacts.CacheDir = filepath.Join(dir, "cache")
+	config.Workspaces.Dir = filepath.Join(dir, "workspaces")
+	config.Artifacts.S3 = S3Config{Endpoint: server.URL, AccessKey: "ak", SecretKey: "sk", Allowed: []string{"bucket/data/"}}
+	w := &worker{Config: config, artifacts: newArtifactCache(&config.Artifacts)}
+
+	digest := sha256.Sum256([]byte("/tool"))
+	input := sha256.Sum256([]byte("/bucket/data/input file.csv"))
+	job := &Job{ID: "once", worker: w, Artifacts: []*Artifact{
+		{URL: server.URL + "/tool", SHA256: hex.EncodeToString(digest[:])},
+		{URL: "s3://bucket/data/input file.csv", Name: "input.csv", SHA256: hex.EncodeToString(input[:])},
+	}}
+	assert.NoError(t, job.ValidRules())
+
+	workspace, cleanup, err := job.prepareWorkspace(context.Background(), 42)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "workspaces"), filepath.Dir(workspace))
+	assert.True(t, strings.HasPrefix(filepath.Base(workspace), "42-"))
+	content, _ := ioutil.ReadFile(filepath.Join(workspace, "tool"))
+	assert.Equal(t, "/tool", string(content))
+	content, _ = ioutil.ReadFile(filepath.Join(workspace, "input.csv"))
+	assert.Equal(t, "/bucket/data/input file.csv", string(content))
+	assert.Contains(t, auth, "AWS4-HMAC-SHA256 Credential=ak/")
+
+	cleanup(false)
+	_, err = os.Stat(workspace)
+	assert.True(t, os.IsNotExist(err))
+
+	// 不在允许的 bucket、前缀中的对象不下载
+	for _, rawURL := range []string{"s3://bucket/secret/key", "s3://other/data/key", "s3://bucket/data/../secret/key"} {
+		_, err = w.artifacts.request(rawURL)
+		assert.Error(t, err, rawURL)
+	}
+
+	job.Artifacts = append(job.Artifacts, &Artifact{URL: server.URL + "/other/tool", SHA256: hex.EncodeToString(digest[:])})
+	assert.Error(t, job.ValidRules())
+	job.Artifacts = job.Artifacts[:1]
+	job.Artifacts[0].SHA256 = ""
+	assert.Error(t, job.ValidRules())
+}
+
+func TestValidIntegrityNullArtifact(t *testing.T) {
+	job := &Job{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"id":"a","script":"/opt/scripts/a","artifacts":[null]}`), job))
+	assert.EqualError(t, job.validIntegrity(), "artifact[0] is empty")
+	assert.Error(t, job.ValidRules())
+
+	problems := Lint(job, &LintPolicy{})
+	assert.Equal(t, "artifact", problems[0].Field)
+	assert.Equal(t, LintError, problems[0].Severity)
+}
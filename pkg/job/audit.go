@@ -0,0 +1,41 @@
+package job
+
+import (
+	"encoding/json"
+
+	"github.com/douyu/juno-agent/pkg/audit"
+)
+
+// auditEvent 记录从任务存储观察到的任务变更，包含 key、revision 及变更前后的内容
+// 变更前后的内容遮盖环境变量、参数及 redact 匹配的敏感内容后写入
+func (w *worker) auditEvent(action string, event *StoreEvent) {
+	entry := audit.Entry{
+		Action:   action,
+		Source:   audit.SourceEtcd,
+		Node:     w.ID,
+		JobID:    GetIDFromKey(event.Key),
+		Key:      event.Key,
+		Revision: event.Revision,
+		Before:   maskJobValue(event.PrevValue, w.redact),
+		After:    maskJobValue(event.Value, w.redact), // 删除事件的 value 为空
+	}
+	// once 任务的 key 中不包含任务 id，以内容为准
+	var job struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal(event.Value, &job) == nil && job.ID != "" {
+		entry.JobID = job.ID
+	}
+	w.Audit.Record(entry)
+}
+
+// auditAPI 记录通过 agent api 手工执行的操作
+func (w *worker) auditAPI(action string, jobID string, taskID uint64) {
+	w.Audit.Record(audit.Entry{
+		Action: action,
+		Source: audit.SourceAPI,
+		Node:   w.ID,
+		JobID:  jobID,
+		TaskID: taskID,
+	})
+}
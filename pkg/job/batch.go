@@ -0,0 +1,179 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/audit"
+	"github.com/douyu/juno-agent/util"
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+const (
+	BatchKeyPrefix       = "/juno/cronjob/batch/"       // 按节点选择器下发的批量单次任务，key 的最后一段为 batch id
+	BatchResultKeyPrefix = "/juno/cronjob/batchresult/" // 批量任务各节点的执行结果，按 batch id 聚合
+)
+
+// watchBatches 监听批量单次任务，匹配当前节点的各自执行一次
+// 各节点使用自己生成的 task id，结果额外写入 batch id 下以节点名区分的 key
+// 启动时补执行 agent 停止期间创建、当前节点还没有执行结果的批量任务
+func (w *worker) watchBatches() {
+	kvs, events := w.watchPrefix(BatchKeyPrefix)
+	for _, kv := range kvs {
+		if w.batchStarted(kv.Key) {
+			continue
+		}
+		w.runBatch(&StoreEvent{Type: StorePut, Key: kv.Key, Value: kv.Value, Create: true})
+	}
+
+	xgo.Go(func() {
+		for event := range events {
+			// 批量任务只在创建时执行，修改不会重新下发
+			if !event.IsCreate() {
+				continue
+			}
+			w.runBatch(event)
+		}
+	})
+}
+
+func (w *worker) runBatch(event *StoreEvent) {
+	batchID := strings.TrimPrefix(event.Key, BatchKeyPrefix)
+	job, err := w.GetOnceJobFromKv(event.Key, event.Value)
+	if err != nil {
+		return
+	}
+	if !w.isBatchTarget(job) {
+		return
+	}
+	w.auditEvent(audit.ActionOnce, event)
+
+	if err := w.resolveOnce(job); err != nil {
+		w.logger.Error("resolve batch job failed", xlog.String("batchId", batchID), fieldJob(job.ID), xlog.FieldErr(err))
+		return
+	}
+	if job.TaskID, err = w.taskIdGen.NextID(); err != nil {
+		w.logger.Error("generate task id failed", xlog.String("batchId", batchID), fieldJob(job.ID), xlog.FieldErr(err))
+		return
+	}
+
+	job.worker = w
+	job.runOn = w.ID
+	go job.RunWithRecovery(WithTaskID(job.TaskID), WithBatch(batchID))
+}
+
+// batchStarted 当前节点是否已写入过该批量任务的执行结果，读取失败时按已执行处理，避免重复执行
+func (w *worker) batchStarted(key string) bool {
+	batchID := strings.TrimPrefix(key, BatchKeyPrefix)
+	ctx, cancel := NewEtcdTimeoutContext(w)
+	defer cancel()
+	kvs, err := w.store.List(ctx, BatchResultKey(batchID, w.HostName))
+	if err != nil {
+		w.logger.Warn("read batch result failed", xlog.String("batchId", batchID), xlog.FieldErr(err))
+		return true
+	}
+	return len(kvs) > 0
+}
+
+// isBatchTarget 选择器优先，其次为节点列表，都为空时只有设置了 All 才下发到所有节点
+func (w *worker) isBatchTarget(job *OnceJob) bool {
+	if len(job.Selector) > 0 {
+		_, labels := w.nodeSelectors()
+		return MatchSelector(job.Selector, labels)
+	}
+	if len(job.Nodes) == 0 {
+		return job.All
+	}
+	return util.InStringArray(job.Nodes, w.HostName) >= 0
+}
+
+// gcBatches 删除最近活动早于 TTL 的批量任务及其执行结果
+// 最近活动为各节点执行结果中最晚的执行时间，还没有执行结果的批量任务由清理节点在 gc 前缀下记下首次看到的时间
+func (w *worker) gcBatches(ctx context.Context) (int, error) {
+	batches, err := w.store.List(ctx, BatchKeyPrefix)
+	if err != nil {
+		return 0, err
+	}
+	results, err := w.store.List(ctx, BatchResultKeyPrefix)
+	if err != nil {
+		return 0, err
+	}
+	seen, err := w.store.List(ctx, gcBatchKeyPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	// 各批量任务的相关 key 及最近活动时间
+	keys := make(map[string][]string)
+	active := make(map[string]time.Time)
+	touch := func(batchID string, at time.Time) {
+		if at.After(active[batchID]) {
+			active[batchID] = at
+		}
+	}
+	exists := make(map[string]bool, len(batches))
+	for _, kv := range batches {
+		batchID := strings.TrimPrefix(kv.Key, BatchKeyPrefix)
+		exists[batchID] = true
+		keys[batchID] = append(keys[batchID], kv.Key)
+	}
+	for _, kv := range results {
+		path := strings.TrimPrefix(kv.Key, BatchResultKeyPrefix)
+		index := strings.LastIndex(path, "/")
+		if index < 0 {
+			continue
+		}
+		batchID := path[:index]
+		var payload struct {
+			ExecutedAt time.Time `json:"executed_at"`
+		}
+		_ = json.Unmarshal(kv.Value, &payload)
+		keys[batchID] = append(keys[batchID], kv.Key)
+		touch(batchID, payload.ExecutedAt)
+	}
+	for _, kv := range seen {
+		batchID := strings.TrimPrefix(kv.Key, gcBatchKeyPrefix)
+		at, _ := time.Parse(time.RFC3339, string(kv.Value))
+		keys[batchID] = append(keys[batchID], kv.Key)
+		touch(batchID, at)
+	}
+
+	deleted := 0
+	for batchID, batchKeys := range keys {
+		last, ok := active[batchID]
+		if !ok || last.IsZero() {
+			if !exists[batchID] {
+				continue
+			}
+			if err := w.store.Put(ctx, gcBatchKeyPrefix+batchID, []byte(time.Now().Format(time.RFC3339))); err != nil {
+				return deleted, err
+			}
+			continue
+		}
+		if time.Since(last) < w.GC.TTL {
+			continue
+		}
+		for _, key := range batchKeys {
+			if err := w.store.Delete(ctx, key); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// BatchResultKey 批量任务在节点上的执行结果
+func BatchResultKey(batchID, node string) string {
+	return fmt.Sprintf("%s%s/%s", BatchResultKeyPrefix, batchID, node)
+}
+
+func WithBatch(batchID string) TaskOption {
+	return func(t *Task) {
+		t.batch = batchID
+	}
+}
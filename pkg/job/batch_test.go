@@ -0,0 +1,66 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsBatchTarget(t *testing.T) {
+	config := DefaultConfig()
+	config.HostName = "node-1"
+	config.Labels = map[string]string{"region": "sh", "env": "prod"}
+	w := &worker{Config: config}
+
+	// 选择器及节点列表都为空时需要显式下发到所有节点
+	assert.False(t, w.isBatchTarget(&OnceJob{}))
+	assert.True(t, w.isBatchTarget(&OnceJob{All: true}))
+	assert.True(t, w.isBatchTarget(&OnceJob{Job: Job{Nodes: []string{"node-1", "node-2"}}}))
+	assert.False(t, w.isBatchTarget(&OnceJob{Job: Job{Nodes: []string{"node-2"}}}))
+	assert.True(t, w.isBatchTarget(&OnceJob{Job: Job{Selector: map[string]string{"region": "sh"}}}))
+	// 选择器不为空时忽略节点列表
+	assert.False(t, w.isBatchTarget(&OnceJob{Job: Job{
+		Nodes:    []string{"node-1"},
+		Selector: map[string]string{"env": "test"},
+	}}))
+
+	assert.Equal(t, "/juno/cronjob/batchresult/b1/node-1", BatchResultKey("b1", "node-1"))
+}
+
+func TestGCBatches(t *testing.T) {
+	config := DefaultConfig()
+	config.logger = xlog.DefaultLogger
+	config.GC.TTL = time.Hour
+	store := &replayStore{kvs: make(map[string][]byte)}
+	w := &worker{Config: config, store: store}
+	put := func(key string, value interface{}) {
+		data, _ := json.Marshal(value)
+		assert.NoError(t, store.Put(context.Background(), key, data))
+	}
+
+	put(BatchKeyPrefix+"old", OnceJob{All: true})
+	put(BatchResultKey("old", "node-1"), TaskResult{ExecutedAt: time.Now().Add(-2 * time.Hour)})
+	put(BatchKeyPrefix+"new", OnceJob{All: true})
+	put(BatchResultKey("new", "node-1"), TaskResult{ExecutedAt: time.Now().Add(-2 * time.Hour)})
+	put(BatchResultKey("new", "node-2"), TaskResult{ExecutedAt: time.Now()})
+	put(BatchKeyPrefix+"idle", OnceJob{Job: Job{Nodes: []string{"node-3"}}})
+
+	deleted, err := w.gcBatches(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	assert.NotContains(t, store.kvs, BatchKeyPrefix+"old")
+	assert.Contains(t, store.kvs, BatchKeyPrefix+"new")
+	// 没有执行结果的批量任务记下首次看到的时间，超过 TTL 后删除
+	assert.Contains(t, store.kvs, gcBatchKeyPrefix+"idle")
+
+	store.kvs[gcBatchKeyPrefix+"idle"] = []byte(time.Now().Add(-2 * time.Hour).Format(time.RFC3339))
+	deleted, err = w.gcBatches(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	assert.NotContains(t, store.kvs, BatchKeyPrefix+"idle")
+	assert.NotContains(t, store.kvs, gcBatchKeyPrefix+"idle")
+}
@@ -0,0 +1,295 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/metric"
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// BlackoutKeyPrefix 维护日历，key 为 {BlackoutKeyPrefix}{name}，值为 Calendar 的 JSON
+const BlackoutKeyPrefix = "/juno/cronjob/blackout/"
+
+const dateLayout = "2006-01-02"
+
+// CronTaskStatusSkipped 触发时处于禁止执行的时间段、节点正在排空或启动被限流，没有启动进程
+const CronTaskStatusSkipped CronTaskStatus = "skipped"
+
+// 处于禁止执行时间段而跳过的触发次数
+var jobBlackoutCounter = metric.CounterVecOpts{
+	Namespace: "juno",
+	Subsystem: "agent",
+	Name:      "job_blackout_skips_total",
+	Help:      "scheduled job fires skipped during blackout windows",
+	Labels:    []string{"job"},
+}.Build()
+
+// Blackout 禁止调度执行的时间段，只影响 cron 触发，手工执行、外部触发不受限制
+type Blackout struct {
+	Windows []*BlackoutWindow `json:"windows"`
+	// BlackoutKeyPrefix 下的日历名称，日历不存在时忽略该日历
+	Calendars []string `json:"calendars"`
+	// 判断时间段使用的时区，如 Asia/Shanghai，为空时使用节点的时区，无法加载时不禁止执行
+	Location string `json:"location"`
+}
+
+// BlackoutWindow 每天的禁止时间段，End 早于 Start 时跨零点，如 23:50 至 00:10
+type BlackoutWindow struct {
+	Start     string `json:"start"`      // HH:MM，包含，为空时为 00:00
+	End       string `json:"end"`        // HH:MM，不包含，为空时为 24:00
+	Weekdays  []int  `json:"weekdays"`   // 0 为周日，跨零点时按开始的一天判断，为空时不限
+	MonthDays []int  `json:"month_days"` // 1 至 31，负数从月末倒数，-1 为最后一天，为空时不限
+}
+
+// Calendar 维护日历，如节假日、月末关账日，由管理端写入任务存储
+type Calendar struct {
+	Dates   []string          `json:"dates"` // 整天禁止执行的日期，如 2020-12-31
+	Windows []*BlackoutWindow `json:"windows"`
+}
+
+func (b *Blackout) Valid() error {
+	if len(b.Windows) == 0 && len(b.Calendars) == 0 {
+		return errors.New("blackout should have windows or calendars")
+	}
+	if _, err := b.location(); err != nil {
+		return fmt.Errorf("invalid blackout location: %w", err)
+	}
+	for _, name := range b.Calendars {
+		if name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("invalid blackout calendar %q", name)
+		}
+	}
+	return validWindows(b.Windows)
+}
+
+func (b *Blackout) location() (*time.Location, error) {
+	if b.Location == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(b.Location)
+}
+
+func (c *Calendar) Valid() error {
+	for _, date := range c.Dates {
+		if _, err := time.Parse(dateLayout, date); err != nil {
+			return fmt.Errorf("invalid date %q, should be like 2020-12-31", date)
+		}
+	}
+	return validWindows(c.Windows)
+}
+
+func validWindows(windows []*BlackoutWindow) error {
+	for _, window := range windows {
+		if err := window.Valid(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *BlackoutWindow) Valid() error {
+	start, err := parseClock(w.Start, 0)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(w.End, 24*60)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return fmt.Errorf("invalid blackout window %s-%s, start equals end", w.Start, w.End)
+	}
+	for _, day := range w.Weekdays {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("invalid weekday %d, should be 0-6", day)
+		}
+	}
+	for _, day := range w.MonthDays {
+		if day == 0 || day > 31 || day < -31 {
+			return fmt.Errorf("invalid month day %d, should be 1-31 or -1 to -31", day)
+		}
+	}
+	return nil
+}
+
+// Contains 时间 t 是否处于该时间段
+func (w *BlackoutWindow) Contains(t time.Time) bool {
+	start, _ := parseClock(w.Start, 0)
+	end, _ := parseClock(w.End, 24*60)
+	minute := t.Hour()*60 + t.Minute()
+
+	if start < end {
+		return minute >= start && minute < end && w.matchDay(t)
+	}
+	// 跨零点，零点后的部分属于前一天开始的时间段
+	if minute >= start {
+		return w.matchDay(t)
+	}
+	return minute < end && w.matchDay(t.AddDate(0, 0, -1))
+}
+
+func (w *BlackoutWindow) matchDay(t time.Time) bool {
+	if len(w.Weekdays) > 0 {
+		matched := false
+		for _, day := range w.Weekdays {
+			if time.Weekday(day) == t.Weekday() {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(w.MonthDays) > 0 {
+		// 下个月的第 0 天即本月最后一天
+		last := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+		for _, day := range w.MonthDays {
+			if day == t.Day() || (day < 0 && last+day+1 == t.Day()) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (w *BlackoutWindow) String() string {
+	start, end := w.Start, w.End
+	if start == "" {
+		start = "00:00"
+	}
+	if end == "" {
+		end = "24:00"
+	}
+	return start + "-" + end
+}
+
+// parseClock 解析 HH:MM 为当天的分钟数，24:00 只用于结束时间
+func parseClock(clock string, empty int) (int, error) {
+	if clock == "" {
+		return empty, nil
+	}
+	parts := strings.Split(clock, ":")
+	if len(parts) == 2 {
+		hour, err1 := strconv.Atoi(parts[0])
+		minute, err2 := strconv.Atoi(parts[1])
+		if err1 == nil && err2 == nil && hour >= 0 && minute >= 0 && minute < 60 &&
+			(hour < 24 || (hour == 24 && minute == 0)) {
+			return hour*60 + minute, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid clock %q, should be HH:MM", clock)
+}
+
+// inBlackout 时间 t 处于禁止执行的时间段时返回原因
+// 时区无法加载或日历不存在时记录日志后照常执行，配置错误不会让任务永远不执行
+func (w *worker) inBlackout(b *Blackout, t time.Time) (string, bool) {
+	loc, err := b.location()
+	if err != nil {
+		w.logger.Warn("blackout location is invalid, ignore blackout", xlog.String("location", b.Location), xlog.FieldErr(err))
+		return "", false
+	}
+	t = t.In(loc)
+
+	for _, window := range b.Windows {
+		if window.Contains(t) {
+			return "window " + window.String(), true
+		}
+	}
+	for _, name := range b.Calendars {
+		calendar, ok := w.calendar(name)
+		if !ok {
+			w.logger.Warn("blackout calendar not found, ignore it", xlog.String("calendar", name))
+			continue
+		}
+		date := t.Format(dateLayout)
+		for _, d := range calendar.Dates {
+			if d == date {
+				return "calendar " + name + " " + date, true
+			}
+		}
+		for _, window := range calendar.Windows {
+			if window.Contains(t) {
+				return "calendar " + name + " window " + window.String(), true
+			}
+		}
+	}
+	return "", false
+}
+
+// blackout 节点全局及任务的禁止时间段
+func (c *Cmd) blackout(t time.Time) (string, bool) {
+	if reason, ok := c.worker.inBlackout(c.worker.nodeBlackout(), t); ok {
+		return reason, true
+	}
+	if c.Job.Blackout != nil {
+		return c.worker.inBlackout(c.Job.Blackout, t)
+	}
+	return "", false
+}
+
+// skipBlackout 记录一次跳过的执行，执行记录的状态为 skipped
+func (c *Cmd) skipBlackout(reason string) {
+	jobBlackoutCounter.Inc(c.Job.ID)
+	c.logger.Info("job skipped by blackout", fieldJob(c.Job.ID), xlog.String("reason", reason))
+
+	task := NewTask(c.Job)
+	if task.TaskID == 0 {
+		task.span.End()
+		return
+	}
+	_ = task.SetStatus(CronTaskStatusSkipped, "skipped: blackout "+reason)
+}
+
+func (w *worker) calendar(name string) (*Calendar, bool) {
+	w.calendarMutex.RLock()
+	defer w.calendarMutex.RUnlock()
+
+	calendar, ok := w.calendars[name]
+	return calendar, ok
+}
+
+func (w *worker) putCalendar(key string, value []byte) {
+	calendar := &Calendar{}
+	err := json.Unmarshal(value, calendar)
+	if err == nil {
+		err = calendar.Valid()
+	}
+	if err != nil {
+		w.logger.Warn("calendar is invalid", xlog.FieldKey(key), xlog.FieldErr(err))
+		return
+	}
+
+	w.calendarMutex.Lock()
+	w.calendars[GetIDFromKey(key)] = calendar
+	w.calendarMutex.Unlock()
+}
+
+// watchCalendars 监听任务存储中的维护日历，启动调度前加载完已有的日历
+func (w *worker) watchCalendars() {
+	kvs, events := w.watchPrefix(BlackoutKeyPrefix)
+
+	for _, kv := range kvs {
+		w.putCalendar(kv.Key, kv.Value)
+	}
+
+	xgo.Go(func() {
+		for event := range events {
+			switch {
+			case event.IsCreate(), event.IsModify():
+				w.putCalendar(event.Key, event.Value)
+			case event.Type == StoreDelete:
+				w.calendarMutex.Lock()
+				delete(w.calendars, GetIDFromKey(event.Key))
+				w.calendarMutex.Unlock()
+			}
+		}
+	})
+}
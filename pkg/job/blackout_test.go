@@ -0,0 +1,71 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlackoutWindow(t *testing.T) {
+	at := func(value string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+		assert.Nil(t, err)
+		return tm
+	}
+
+	// 跨零点
+	window := &BlackoutWindow{Start: "23:50", End: "00:10"}
+	assert.Nil(t, window.Valid())
+	assert.True(t, window.Contains(at("2020-10-30 23:55")))
+	assert.True(t, window.Contains(at("2020-10-31 00:05")))
+	assert.False(t, window.Contains(at("2020-10-31 00:10")))
+	assert.False(t, window.Contains(at("2020-10-31 12:00")))
+
+	// 月末最后两天整天，零点后的部分按前一天判断
+	monthEnd := &BlackoutWindow{MonthDays: []int{-2, -1}}
+	assert.Nil(t, monthEnd.Valid())
+	assert.True(t, monthEnd.Contains(at("2020-02-28 08:00")))
+	assert.True(t, monthEnd.Contains(at("2020-02-29 23:59")))
+	assert.False(t, monthEnd.Contains(at("2020-02-27 23:59")))
+	assert.False(t, monthEnd.Contains(at("2020-03-01 00:00")))
+
+	nightly := &BlackoutWindow{Start: "22:00", End: "02:00", Weekdays: []int{5}}
+	assert.True(t, nightly.Contains(at("2020-10-31 01:00")), "saturday 01:00 belongs to friday's window")
+	assert.False(t, nightly.Contains(at("2020-11-01 01:00")))
+
+	assert.Error(t, (&BlackoutWindow{Start: "25:00"}).Valid())
+	assert.Error(t, (&BlackoutWindow{Start: "10:00", End: "10:00"}).Valid())
+	assert.Error(t, (&BlackoutWindow{MonthDays: []int{0}}).Valid())
+	assert.Error(t, (&Blackout{}).Valid())
+	assert.Error(t, (&Blackout{Calendars: []string{"a/b"}}).Valid())
+}
+
+func TestBlackoutSkip(t *testing.T) {
+	w := newReplayWorker(t)
+
+	now := time.Now()
+	job := &Job{ID: "a", Name: "a", Script: "true", Enable: true, worker: w,
+		Blackout: &Blackout{Calendars: []string{"close"}}}
+	cmd := &Cmd{Job: job, Timer: &Timer{ID: "t"}}
+
+	// 日历未加载时照常执行
+	_, ok := cmd.blackout(now)
+	assert.False(t, ok)
+	// 时区无法加载时照常执行
+	_, ok = w.inBlackout(&Blackout{Windows: []*BlackoutWindow{{}}, Location: "Nowhere/Invalid"}, now)
+	assert.False(t, ok)
+
+	w.putCalendar(BlackoutKeyPrefix+"close", []byte(`{"dates": ["`+now.Format(dateLayout)+`"]}`))
+	assert.Nil(t, cmd.Run())
+
+	runs, err := w.JobRuns("a")
+	assert.Nil(t, err)
+	assert.Len(t, runs, 1)
+	assert.Equal(t, CronTaskStatusSkipped, runs[0].Status)
+	assert.Equal(t, "skipped: blackout calendar close "+now.Format(dateLayout), runs[0].Logs)
+
+	w.putCalendar(BlackoutKeyPrefix+"close", []byte(`{"dates": ["2000-01-01"]}`))
+	_, ok = cmd.blackout(now)
+	assert.False(t, ok)
+}
@@ -0,0 +1,202 @@
+package job
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/go-resty/resty/v2"
+)
+
+// 推送给管理端的任务事件
+const (
+	CallbackStart   = "start"
+	CallbackSuccess = "success"
+	CallbackFailure = "failure"
+	CallbackTimeout = "timeout"
+	CallbackKill    = "kill"
+	CallbackSkip    = "skip"    // 处于禁止执行的时间段，跳过本次触发
+	CallbackAnomaly = "anomaly" // 成功的执行耗时明显长于最近的执行
+	CallbackDenied  = "denied"  // 命令被节点的命令策略拒绝
+	CallbackLog     = "log"     // 任务输出中不低于 log_parser.alert_level 的事件
+)
+
+// 回调请求的签名头，签名为 hex(HMAC-SHA256(secret, timestamp + "." + body))
+const (
+	HeaderCallbackTimestamp = "X-Juno-Timestamp"
+	HeaderCallbackSignature = "X-Juno-Signature"
+)
+
+// CallbackConfig 任务状态变化时主动推送给管理端，管理端不需要轮询 proc key
+type CallbackConfig struct {
+	Addr      string        // 管理端接收事件的地址，为空时不推送
+	Secret    string        // 签名密钥，为空时不签名
+	Timeout   time.Duration // 单次请求超时
+	Retries   int           // 失败后的重试次数
+	Backoff   time.Duration // 首次重试的等待时间，之后每次翻倍
+	QueueSize int           // 待推送事件的队列长度，队列满时丢弃新事件
+}
+
+func (c *CallbackConfig) normalize() {
+	if c.Timeout <= 0 {
+		c.Timeout = 5 * time.Second
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = time.Second
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = 1024
+	}
+}
+
+// CallbackEvent 任务状态变化事件
+type CallbackEvent struct {
+	Event      string           `json:"event"`
+	JobID      string           `json:"job_id"`
+	JobName    string           `json:"job_name"`
+	TaskID     uint64           `json:"task_id"`
+	Node       string           `json:"node"`
+	Time       time.Time        `json:"time"`
+	ExecutedAt time.Time        `json:"executed_at,omitempty"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+	Log        *LogEvent        `json:"log,omitempty"`
+	Anomaly    *DurationAnomaly `json:"anomaly,omitempty"`
+}
+
+// callbackReporter 异步推送任务事件，失败时按退避重试，不阻塞任务执行
+type callbackReporter struct {
+	config *CallbackConfig
+	client *resty.Client
+	events chan *CallbackEvent
+	logger *xlog.Logger
+	quit   chan struct{}
+}
+
+// newCallbackReporter 未配置地址时返回 nil
+func newCallbackReporter(config *CallbackConfig, logger *xlog.Logger, done <-chan struct{}) *callbackReporter {
+	if config.Addr == "" {
+		return nil
+	}
+
+	r := &callbackReporter{
+		config: config,
+		client: resty.New().SetTimeout(config.Timeout).SetHeader("Content-Type", "application/json;charset=utf-8"),
+		events: make(chan *CallbackEvent, config.QueueSize),
+		logger: logger,
+		quit:   make(chan struct{}),
+	}
+	xgo.Go(func() {
+		for {
+			select {
+			case event := <-r.events:
+				r.post(event)
+			case <-done:
+				return
+			case <-r.quit:
+				// 已入队的事件推送完再退出
+				for {
+					select {
+					case event := <-r.events:
+						r.post(event)
+					default:
+						return
+					}
+				}
+			}
+		}
+	})
+	return r
+}
+
+// Stop 配置重新加载后停止旧的 reporter
+func (r *callbackReporter) Stop() {
+	if r == nil {
+		return
+	}
+	close(r.quit)
+}
+
+// Send 加入推送队列
+func (r *callbackReporter) Send(event *CallbackEvent) {
+	if r == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	select {
+	case r.events <- event:
+	default:
+		r.logger.Warn("callback queue is full, drop event", xlog.String("event", event.Event), fieldJob(event.JobID))
+	}
+}
+
+func (r *callbackReporter) post(event *CallbackEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	backoff := r.config.Backoff
+	for attempt := 0; ; attempt++ {
+		if err = r.do(body); err == nil {
+			return
+		}
+		if attempt >= r.config.Retries {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	r.logger.Warn("post callback failed", xlog.String("event", event.Event), fieldJob(event.JobID), fieldTask(event.TaskID), xlog.FieldErr(err))
+}
+
+func (r *callbackReporter) do(body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req := r.client.R().SetBody(body)
+	if r.config.Secret != "" {
+		req.SetHeader(HeaderCallbackTimestamp, timestamp)
+		req.SetHeader(HeaderCallbackSignature, SignCallback(r.config.Secret, timestamp, body))
+	}
+
+	resp, err := req.Post(r.config.Addr)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode())
+	}
+	return nil
+}
+
+// SignCallback 计算回调请求的签名，管理端用同一密钥校验
+func SignCallback(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// callbackEvent 任务状态对应的事件
+func callbackEvent(status CronTaskStatus) string {
+	switch status {
+	case CronTaskStatusProcessing:
+		return CallbackStart
+	case CronTaskStatusSuccess:
+		return CallbackSuccess
+	case CronTaskStatusTimeout:
+		return CallbackTimeout
+	case CronTaskStatusSkipped:
+		return CallbackSkip
+	default:
+		return CallbackFailure
+	}
+}
@@ -0,0 +1,54 @@
+package job
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallbackReporter(t *testing.T) {
+	attempts := 0
+	received := make(chan *CallbackEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		signature := SignCallback("secret", r.Header.Get(HeaderCallbackTimestamp), body)
+		if r.Header.Get(HeaderCallbackSignature) != signature {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// 第一次返回错误，验证重试
+		if attempts++; attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		event := &CallbackEvent{}
+		_ = json.Unmarshal(body, event)
+		received <- event
+	}))
+	defer server.Close()
+
+	config := &CallbackConfig{Addr: server.URL, Secret: "secret", Retries: 2, Backoff: time.Millisecond}
+	config.normalize()
+	done := make(chan struct{})
+	defer close(done)
+
+	reporter := newCallbackReporter(config, xlog.DefaultLogger, done)
+	reporter.Send(&CallbackEvent{Event: callbackEvent(CronTaskStatusTimeout), JobID: "backup", TaskID: 7})
+
+	select {
+	case event := <-received:
+		assert.Equal(t, CallbackTimeout, event.Event)
+		assert.Equal(t, uint64(7), event.TaskID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback not received")
+	}
+	assert.Equal(t, 2, attempts)
+
+	assert.Nil(t, newCallbackReporter(&CallbackConfig{}, xlog.DefaultLogger, done))
+}
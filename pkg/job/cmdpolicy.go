@@ -0,0 +1,287 @@
+package job
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/metric"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// ErrCommandDenied 命令被节点的命令策略拒绝，没有启动进程
+var ErrCommandDenied = errors.New("command denied by policy")
+
+// 命令策略的动作及匹配的字段
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+
+	PolicyFieldCommand     = "command"     // 完整的命令行，程序与参数以空格连接
+	PolicyFieldInterpreter = "interpreter" // 解释器名称，如 sh、bash、python3，取自 shebang，没有时为程序名
+	PolicyFieldPath        = "path"        // 执行的程序或脚本的路径
+)
+
+// 被命令策略拒绝的执行次数
+var commandDeniedCounter = metric.CounterVecOpts{
+	Namespace: "juno",
+	Subsystem: "agent",
+	Name:      "command_policy_denied_total",
+	Help:      "job executions refused by the command policy",
+	Labels:    []string{"job", "rule"},
+}.Build()
+
+// CommandPolicyConfig 每次执行前按策略文件检查命令，拒绝的命令记为失败并推送 denied 事件
+type CommandPolicyConfig struct {
+	File   string        // JSON 格式的策略文件，为空时不检查
+	Reload time.Duration // 检查策略文件是否修改的间隔
+}
+
+func (c *CommandPolicyConfig) normalize() {
+	if c.Reload < time.Second {
+		c.Reload = 30 * time.Second
+	}
+}
+
+// CommandPolicy 按顺序匹配规则，第一条匹配的规则决定是否执行，都不匹配时使用 Default
+type CommandPolicy struct {
+	Default string         `json:"default"` // allow 或 deny，为空时为 allow
+	Rules   []*CommandRule `json:"rules"`
+}
+
+// CommandRule 使用 glob 或正则匹配命令的一个字段
+type CommandRule struct {
+	Name   string `json:"name"`
+	Action string `json:"action"` // allow 或 deny
+	Field  string `json:"field"`  // command、interpreter 或 path，为空时为 command
+	Glob   string `json:"glob"`
+	Regexp string `json:"regexp"`
+
+	re *regexp.Regexp
+}
+
+// commandInfo 策略检查的对象
+type commandInfo struct {
+	Command     string
+	Interpreter string
+	Path        string
+}
+
+func (p *CommandPolicy) compile() error {
+	switch p.Default {
+	case "":
+		p.Default = PolicyAllow
+	case PolicyAllow, PolicyDeny:
+	default:
+		return fmt.Errorf("invalid default action %q", p.Default)
+	}
+
+	for i, rule := range p.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rules[%d]", i)
+		}
+		if rule.Action != PolicyAllow && rule.Action != PolicyDeny {
+			return fmt.Errorf("rule %s: invalid action %q", rule.Name, rule.Action)
+		}
+		switch rule.Field {
+		case "":
+			rule.Field = PolicyFieldCommand
+		case PolicyFieldCommand, PolicyFieldInterpreter, PolicyFieldPath:
+		default:
+			return fmt.Errorf("rule %s: invalid field %q", rule.Name, rule.Field)
+		}
+		if (rule.Glob == "") == (rule.Regexp == "") {
+			return fmt.Errorf("rule %s: one of glob and regexp is required", rule.Name)
+		}
+		if rule.Glob != "" {
+			if _, err := filepath.Match(rule.Glob, ""); err != nil {
+				return fmt.Errorf("rule %s: invalid glob: %w", rule.Name, err)
+			}
+			continue
+		}
+		re, err := regexp.Compile(rule.Regexp)
+		if err != nil {
+			return fmt.Errorf("rule %s: invalid regexp: %w", rule.Name, err)
+		}
+		rule.re = re
+	}
+	return nil
+}
+
+func (r *CommandRule) match(info *commandInfo) bool {
+	value := info.Command
+	switch r.Field {
+	case PolicyFieldInterpreter:
+		value = info.Interpreter
+	case PolicyFieldPath:
+		value = info.Path
+	}
+	if r.re != nil {
+		return r.re.MatchString(value)
+	}
+	matched, _ := filepath.Match(r.Glob, value)
+	return matched
+}
+
+// Check 返回决定结果的规则名称，为 default 时表示没有规则匹配
+func (p *CommandPolicy) Check(info *commandInfo) (bool, string) {
+	for _, rule := range p.Rules {
+		if rule.match(info) {
+			return rule.Action == PolicyAllow, rule.Name
+		}
+	}
+	return p.Default == PolicyAllow, "default"
+}
+
+// commandPolicy 策略文件的内容，文件修改后重新加载，加载失败时保留之前的策略
+type commandPolicy struct {
+	config  *CommandPolicyConfig
+	logger  *xlog.Logger
+	mu      sync.RWMutex
+	policy  *CommandPolicy
+	modTime time.Time
+	quit    chan struct{}
+}
+
+// newCommandPolicy 未配置策略文件时返回 nil
+func newCommandPolicy(config *CommandPolicyConfig, logger *xlog.Logger) (*commandPolicy, error) {
+	if config.File == "" {
+		return nil, nil
+	}
+	p := &commandPolicy{config: config, logger: logger, quit: make(chan struct{})}
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *commandPolicy) load() error {
+	stat, err := os.Stat(p.config.File)
+	if err != nil {
+		return err
+	}
+	if stat.ModTime().Equal(p.modTime) {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(p.config.File)
+	if err != nil {
+		return err
+	}
+	policy := &CommandPolicy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return err
+	}
+	if err := policy.compile(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.policy = policy
+	p.modTime = stat.ModTime()
+	p.mu.Unlock()
+	return nil
+}
+
+// run 按间隔检查策略文件，worker 停止后退出
+func (p *commandPolicy) run(done <-chan struct{}) {
+	for {
+		select {
+		case <-time.After(p.config.Reload):
+		case <-done:
+			return
+		case <-p.quit:
+			return
+		}
+		if err := p.load(); err != nil {
+			p.logger.Error("reload command policy failed, keep the previous one", xlog.String("file", p.config.File), xlog.FieldErr(err))
+		}
+	}
+}
+
+// stop 配置重新加载后停止检查旧的策略文件
+func (p *commandPolicy) stop() {
+	if p == nil {
+		return
+	}
+	close(p.quit)
+}
+
+func (p *commandPolicy) check(info *commandInfo) (bool, string) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.policy.Check(info)
+}
+
+// checkCommand 检查任务本次执行的命令，未配置策略时都允许。
+// exec_mode 为 shell 时 command 字段为渲染后的命令行，而不是 sh -c
+func (j *Job) checkCommand(script string, args []string) (bool, string) {
+	j.reloadMutex.RLock()
+	policy := j.commandPolicy
+	j.reloadMutex.RUnlock()
+	if policy == nil {
+		return true, ""
+	}
+	command := append([]string{script}, args...)
+	if j.ExecMode == ExecModeShell && script == shellPath {
+		command = shellLineArgs(args)
+	}
+	info := &commandInfo{
+		Command:     strings.Join(command, " "),
+		Interpreter: interpreter(script),
+		Path:        script,
+	}
+	return policy.check(info)
+}
+
+// allowCommand 主命令、钩子命令及创建运行环境的命令执行前检查，
+// 拒绝时记录指标及日志并推送 denied 事件
+func (j *Job) allowCommand(task *Task, stage, script string, args []string) error {
+	ok, rule := j.checkCommand(script, args)
+	if ok {
+		return nil
+	}
+	commandDeniedCounter.Inc(j.ID, rule)
+	j.logger.Warn("command denied by policy", fieldJob(j.ID), fieldTask(task.TaskID), xlog.String("stage", stage), xlog.String("rule", rule), xlog.String("script", script))
+	j.emit(&CallbackEvent{
+		Event:  CallbackDenied,
+		JobID:  j.ID,
+		TaskID: task.TaskID,
+		Node:   j.HostName,
+	})
+	return fmt.Errorf("%w: %s", ErrCommandDenied, rule)
+}
+
+// interpreter 取脚本 shebang 中的解释器，/usr/bin/env python3 取 python3，没有 shebang 时为程序名
+func interpreter(script string) string {
+	f, err := os.Open(script)
+	if err != nil {
+		return filepath.Base(script)
+	}
+	defer f.Close()
+
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	if !strings.HasPrefix(line, "#!") {
+		return filepath.Base(script)
+	}
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 {
+		return filepath.Base(script)
+	}
+	if filepath.Base(fields[0]) == "env" {
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") {
+				return filepath.Base(field)
+			}
+		}
+	}
+	return filepath.Base(fields[0])
+}
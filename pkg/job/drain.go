@@ -0,0 +1,65 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+var ErrDraining = errors.New("node is draining")
+
+// Drain 节点下线（如重启）前调用：停止调度，释放任务锁由其他节点接管，
+// 拒绝新的执行，并等待正在执行的任务结束
+func (w *worker) Drain(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&w.draining, 0, 1) {
+		return nil
+	}
+	w.logger.Info("worker draining")
+
+	_ = w.Cron.Stop()
+	w.jobsMutex.RLock()
+	for _, job := range w.jobs {
+		job.Unlock()
+	}
+	w.jobsMutex.RUnlock()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		w.runsMutex.Lock()
+		running := len(w.runningJobs)
+		w.runsMutex.Unlock()
+		if running == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			w.logger.Warn("drain timeout, jobs still running", xlog.Int("jobs", running))
+			return ctx.Err()
+		}
+	}
+}
+
+// Undrain 下线取消（如重启失败）时恢复调度及执行，任务锁在下次触发时重新获取
+func (w *worker) Undrain() {
+	if !atomic.CompareAndSwapInt32(&w.draining, 1, 0) {
+		return
+	}
+	w.logger.Info("worker undrained")
+	select {
+	case <-w.done:
+		// worker 已停止，不再恢复调度
+		return
+	default:
+	}
+	w.Cron.Run()
+}
+
+func (w *worker) isDraining() bool {
+	return atomic.LoadInt32(&w.draining) == 1
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"crypto/tls"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/etcdv3"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/namespace"
+)
+
+// ErrNoEndpoints is returned when the client config has no endpoint
+var ErrNoEndpoints = etcdv3.ErrNoEndpoints
+
+// ClientConfig connection settings of a secured etcd cluster.
+// mTLS is enabled when CertFile and KeyFile are set, server verification alone when only CaCert is set
+type ClientConfig struct {
+	Endpoints   []string
+	DialTimeout time.Duration
+	// interval to refresh endpoints from the cluster member list, 0 disables
+	AutoSyncInterval time.Duration
+	KeepAliveTime    time.Duration
+	KeepAliveTimeout time.Duration
+
+	Username string
+	Password string
+
+	CaCert             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// Enabled reports whether endpoints are configured
+func (c *ClientConfig) Enabled() bool {
+	return len(c.Endpoints) > 0
+}
+
+// TLS builds the client tls config, nil if no tls file is configured
+func (c *ClientConfig) TLS() (*tls.Config, error) {
+	if c.CaCert == "" && c.CertFile == "" && c.KeyFile == "" {
+		return nil, nil
+	}
+
+	config, err := etcdv3.LoadTLS(c.CaCert, c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config.ServerName = c.ServerName
+	config.InsecureSkipVerify = c.InsecureSkipVerify
+	return config, nil
+}
+
+// clientv3Config converts to clientv3.Config.
+// endpoints are shuffled so that agents do not all connect to the first member,
+// the client fails over to the next endpoint when the current one is unavailable
+func (c *ClientConfig) clientv3Config() (clientv3.Config, error) {
+	if !c.Enabled() {
+		return clientv3.Config{}, ErrNoEndpoints
+	}
+
+	tlsConfig, err := c.TLS()
+	if err != nil {
+		return clientv3.Config{}, err
+	}
+
+	endpoints := append([]string(nil), c.Endpoints...)
+	rand.Shuffle(len(endpoints), func(i, j int) {
+		endpoints[i], endpoints[j] = endpoints[j], endpoints[i]
+	})
+
+	return clientv3.Config{
+		Endpoints:            endpoints,
+		AutoSyncInterval:     c.AutoSyncInterval,
+		DialTimeout:          c.DialTimeout,
+		DialKeepAliveTime:    c.KeepAliveTime,
+		DialKeepAliveTimeout: c.KeepAliveTimeout,
+		TLS:                  tlsConfig,
+		Username:             c.Username,
+		Password:             c.Password,
+	}, nil
+}
+
+// NewClient connects to etcd with the given settings
+func NewClient(c *ClientConfig) (*etcdv3.Client, error) {
+	config, err := c.clientv3Config()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := clientv3.New(config)
+	if err != nil {
+		return nil, err
+	}
+	return &etcdv3.Client{Client: client}, nil
+}
+
+// NormalizeNamespace returns the key prefix of namespace, e.g. "prod" -> "/prod", empty for no namespace
+func NormalizeNamespace(ns string) string {
+	ns = strings.Trim(ns, "/")
+	if ns == "" {
+		return ""
+	}
+	return "/" + ns
+}
+
+// WithNamespace prefixes all keys read, written, watched and leased through client with ns,
+// so that environments sharing one etcd cluster do not see each other's keys.
+// the client is modified in place, it must not be shared with code expecting raw keys
+func WithNamespace(client *etcdv3.Client, ns string) *etcdv3.Client {
+	prefix := NormalizeNamespace(ns)
+	if prefix == "" {
+		return client
+	}
+	client.KV = namespace.NewKV(client.KV, prefix)
+	client.Watcher = namespace.NewWatcher(client.Watcher, prefix)
+	client.Lease = namespace.NewLease(client.Lease, prefix)
+	return client
+}
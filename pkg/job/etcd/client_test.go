@@ -0,0 +1,52 @@
+package etcd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientConfig(t *testing.T) {
+	_, err := (&ClientConfig{}).clientv3Config()
+	assert.Equal(t, ErrNoEndpoints, err)
+
+	c := &ClientConfig{Endpoints: []string{"a:2379", "b:2379", "c:2379"}, Username: "agent", Password: "secret"}
+	config, err := c.clientv3Config()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, c.Endpoints, config.Endpoints)
+	assert.Equal(t, []string{"a:2379", "b:2379", "c:2379"}, c.Endpoints)
+	assert.Nil(t, config.TLS)
+	assert.Equal(t, "agent", config.Username)
+}
+
+func TestClientConfigTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd-tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = (&ClientConfig{CertFile: "client.pem"}).TLS()
+	assert.Error(t, err)
+
+	_, err = (&ClientConfig{CaCert: filepath.Join(dir, "missing.pem")}).TLS()
+	assert.Error(t, err)
+
+	invalid := filepath.Join(dir, "invalid.pem")
+	assert.NoError(t, ioutil.WriteFile(invalid, []byte("not a certificate"), 0600))
+	_, err = (&ClientConfig{CaCert: invalid}).TLS()
+	assert.Error(t, err)
+
+	config, err := (&ClientConfig{ServerName: "etcd", InsecureSkipVerify: true, Endpoints: []string{"a:2379"}}).TLS()
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+}
+
+func TestNormalizeNamespace(t *testing.T) {
+	assert.Equal(t, "", NormalizeNamespace(""))
+	assert.Equal(t, "", NormalizeNamespace("/"))
+	assert.Equal(t, "/prod", NormalizeNamespace("prod"))
+	assert.Equal(t, "/prod", NormalizeNamespace("/prod/"))
+	assert.Equal(t, "/tenant-a/prod", NormalizeNamespace("tenant-a/prod"))
+}
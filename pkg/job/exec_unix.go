@@ -0,0 +1,52 @@
+//go:build !windows
+// +build !windows
+
+package job
+
+import (
+	"strings"
+	"syscall"
+)
+
+// 设置 umask、rlimit 时用于包装任务命令
+const shellPath = "/bin/sh"
+
+func makeCmdAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+}
+
+// shellCommand 脚本直接执行，由 shebang 决定解释器
+func shellCommand(script string, args []string) (string, []string) {
+	return script, args
+}
+
+// shellLine exec_mode 为 shell 时由 sh -c 执行，Args 为 $1、$2...
+func shellLine(line string, args []string) (string, []string) {
+	return shellPath, append([]string{"-c", line, "sh"}, args...)
+}
+
+// shellLineArgs shellLine 返回的参数中的命令行及 $1、$2...，命令策略检查的是渲染后的命令行
+func shellLineArgs(args []string) []string {
+	if len(args) < 3 {
+		return args
+	}
+	return append([]string{args[1]}, args[3:]...)
+}
+
+// shellQuote 参数值用单引号包裹后拼入 shell 命令行，值中的单引号先结束引号再转义
+func shellQuote(s string) (string, error) {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'", nil
+}
+
+// killProcess 任务以独立进程组启动，杀掉整个进程组以免遗留子进程
+func killProcess(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGKILL)
+}
+
+// processAlive 任务进程是进程组的组长，pid 被其他进程复用时通常不是组长
+func processAlive(pid int) bool {
+	pgid, err := syscall.Getpgid(pid)
+	return err == nil && pgid == pid
+}
@@ -1,16 +1,88 @@
 package job
 
 import (
+	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 )
 
+// windows 下不支持设置 umask、rlimit
+const shellPath = ""
+
+const (
+	processQueryLimitedInformation = 0x1000
+	stillActive                    = 259 // GetExitCodeProcess 返回的进程仍在运行的退出码
+)
+
+// makeCmdAttr 任务在新的进程组中启动，agent 收到的 Ctrl+C、Ctrl+Break 不会传给任务，也不弹出窗口
 func makeCmdAttr() *syscall.SysProcAttr {
-	return &syscall.SysProcAttr{}
+	return &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+		HideWindow:    true,
+	}
+}
+
+// shellCommand 按扩展名选择解释器，.bat、.cmd 通过 cmd /C 执行，.ps1 通过 powershell 执行，其他直接执行
+func shellCommand(script string, args []string) (string, []string) {
+	switch strings.ToLower(filepath.Ext(script)) {
+	case ".bat", ".cmd":
+		return "cmd", append([]string{"/C", script}, args...)
+	case ".ps1":
+		return "powershell", append([]string{"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", script}, args...)
+	}
+	return script, args
+}
+
+// shellLine exec_mode 为 shell 时由 cmd /C 执行，Args 追加在命令之后
+func shellLine(line string, args []string) (string, []string) {
+	return "cmd", append([]string{"/C", line}, args...)
 }
 
+// shellLineArgs shellLine 返回的参数中的命令行及追加的参数，命令策略检查的是渲染后的命令行
+func shellLineArgs(args []string) []string {
+	if len(args) < 2 {
+		return args
+	}
+	return args[1:]
+}
+
+// shellQuote cmd 没有可靠的转义方式，参数值用双引号包裹，含有特殊字符时拒绝执行
+func shellQuote(s string) (string, error) {
+	if strings.ContainsAny(s, "\"%!^&|<>\r\n") {
+		return "", fmt.Errorf("param value %q contains characters not allowed in cmd", s)
+	}
+	return `"` + s + `"`, nil
+}
+
+// killProcess taskkill /T 杀掉进程树，taskkill 不可用时只杀掉任务进程
 func killProcess(pid int) error {
-	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).Run()
+	err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).Run()
+	if err == nil {
+		return nil
+	}
+	process, findErr := os.FindProcess(pid)
+	if findErr != nil {
+		return err
+	}
+	defer process.Release()
+	return process.Kill()
 }
 
+// processAlive 进程已退出但句柄未关闭时仍能打开，需按退出码判断
+func processAlive(pid int) bool {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(handle)
+
+	var code uint32
+	if err := syscall.GetExitCodeProcess(handle, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
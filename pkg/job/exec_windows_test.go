@@ -0,0 +1,21 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellCommand(t *testing.T) {
+	name, args := shellCommand(`C:\jobs\backup.BAT`, []string{"full"})
+	assert.Equal(t, "cmd", name)
+	assert.Equal(t, []string{"/C", `C:\jobs\backup.BAT`, "full"}, args)
+
+	name, args = shellCommand(`C:\jobs\clean.ps1`, nil)
+	assert.Equal(t, "powershell", name)
+	assert.Equal(t, `C:\jobs\clean.ps1`, args[len(args)-1])
+
+	name, args = shellCommand(`C:\jobs\report.exe`, []string{"-v"})
+	assert.Equal(t, `C:\jobs\report.exe`, name)
+	assert.Equal(t, []string{"-v"}, args)
+}
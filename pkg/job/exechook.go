@@ -0,0 +1,116 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// 每条钩子命令的执行超时，同时受任务的超时限制
+const execHookTimeout = time.Minute
+
+// 钩子命令可以读取的环境变量
+const (
+	EnvJobID    = "JUNO_JOB_ID"
+	EnvTaskID   = "JUNO_TASK_ID"
+	EnvExitCode = "JUNO_EXIT_CODE"  // 主命令的退出码，未正常退出时为 -1
+	EnvStatus   = "JUNO_JOB_STATUS" // 主命令的执行结果，success、failed 或 timeout
+)
+
+// ExecHooks 在主命令前后执行的命令，每条命令按空白分隔为可执行文件及参数，不经过 shell，
+// windows 下 .bat、.cmd、.ps1 与主命令一样通过对应的解释器执行
+// 钩子命令的环境变量与主命令相同，on_success、on_failure 还可以读取主命令的执行结果
+type ExecHooks struct {
+	Pre       []string `json:"pre"` // 依次执行，任一失败时不执行主命令，本次执行记为失败
+	OnSuccess []string `json:"on_success"`
+	OnFailure []string `json:"on_failure"` // 如只在部分任务失败时告警
+}
+
+// 验证 hooks 字段
+func (h *ExecHooks) Valid() error {
+	for _, commands := range [][]string{h.Pre, h.OnSuccess, h.OnFailure} {
+		for _, command := range commands {
+			if len(strings.Fields(command)) == 0 {
+				return errors.New("invalid job hooks, empty command")
+			}
+		}
+	}
+	return nil
+}
+
+// runPreHooks 主命令执行前调用，ctx 为任务的 ctx，任务超时后正在执行的钩子命令被杀掉
+func (j *Job) runPreHooks(ctx context.Context, task *Task, env []string, log io.Writer) error {
+	if j.Hooks == nil {
+		return nil
+	}
+	return j.runExecHooks(ctx, task, "pre", j.Hooks.Pre, j.hookEnv(task, env), log)
+}
+
+// runPostHooks 主命令结束后调用，钩子失败不影响本次执行的结果
+// 主命令超时后任务的 ctx 已结束，on_failure 仍然执行以便告警，此时只受每条命令的超时限制
+func (j *Job) runPostHooks(ctx context.Context, task *Task, env []string, status CronTaskStatus, exitCode int, log io.Writer) {
+	if j.Hooks == nil {
+		return
+	}
+	if status == CronTaskStatusTimeout {
+		ctx = context.Background()
+	}
+
+	stage, commands := "on_success", j.Hooks.OnSuccess
+	if status != CronTaskStatusSuccess {
+		stage, commands = "on_failure", j.Hooks.OnFailure
+	}
+	env = append(j.hookEnv(task, env), EnvExitCode+"="+strconv.Itoa(exitCode), EnvStatus+"="+string(status))
+	_ = j.runExecHooks(ctx, task, stage, commands, env, log)
+}
+
+func (j *Job) hookEnv(task *Task, env []string) []string {
+	hookEnv := make([]string, 0, len(env)+4)
+	hookEnv = append(hookEnv, env...)
+	return append(hookEnv, EnvJobID+"="+j.ID, EnvTaskID+"="+strconv.FormatUint(task.TaskID, 10))
+}
+
+// runExecHooks 依次执行钩子命令，输出写入任务日志，遇到失败或被命令策略拒绝的命令即停止，ctx 结束时杀掉正在执行的命令
+func (j *Job) runExecHooks(ctx context.Context, task *Task, stage string, commands []string, env []string, log io.Writer) error {
+	for _, command := range commands {
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(log, "\n[hooks.%s] %s\n", stage, command)
+		path := fields[0]
+		if resolved, err := lookPath(path); err == nil {
+			path = resolved
+		}
+		if err := j.allowCommand(task, "hooks."+stage, path, fields[1:]); err != nil {
+			fmt.Fprintf(log, "[hooks.%s] denied by command policy: %s\n", stage, err)
+			return fmt.Errorf("hooks.%s [%s]: %w", stage, command, err)
+		}
+		hookCtx, cancel := context.WithTimeout(ctx, execHookTimeout)
+		name, args := shellCommand(fields[0], fields[1:])
+		cmd := exec.CommandContext(hookCtx, name, args...)
+		cmd.Env = append(os.Environ(), env...)
+		cmd.Dir = j.WorkDir
+		cmd.SysProcAttr = makeCmdAttr()
+		cmd.Stdout = log
+		cmd.Stderr = log
+		err := cmd.Run()
+		cancel()
+
+		if err != nil {
+			fmt.Fprintf(log, "[hooks.%s] failed: %s\n", stage, err)
+			j.logger.Warn("run job hook failed", fieldJob(j.ID), xlog.String("stage", stage), xlog.String("command", command), xlog.FieldErr(err))
+			return fmt.Errorf("hooks.%s [%s] failed: %w", stage, command, err)
+		}
+	}
+	return nil
+}
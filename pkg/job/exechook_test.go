@@ -0,0 +1,68 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunExecHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook scripts require sh")
+	}
+
+	dir, err := ioutil.TempDir("", "hooks")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "notify.sh")
+	assert.NoError(t, ioutil.WriteFile(script, []byte("#!/bin/sh\necho \"$1 $JUNO_JOB_ID $JUNO_EXIT_CODE $JUNO_JOB_STATUS\"\n"), 0755))
+
+	config := DefaultConfig()
+	config.logger = xlog.DefaultLogger
+	job := &Job{
+		ID:     "backup",
+		worker: &worker{Config: config},
+		Hooks: &ExecHooks{
+			Pre:       []string{filepath.Join(dir, "missing.sh")},
+			OnFailure: []string{script + " page"},
+		},
+	}
+	assert.NoError(t, job.Hooks.Valid())
+
+	var log bytes.Buffer
+	task := &Task{TaskID: 42}
+	assert.Error(t, job.runPreHooks(context.Background(), task, nil, &log))
+
+	log.Reset()
+	job.runPostHooks(context.Background(), task, nil, CronTaskStatusFailed, 2, &log)
+	assert.Contains(t, log.String(), "page backup 2 failed")
+
+	log.Reset()
+	job.runPostHooks(context.Background(), task, nil, CronTaskStatusSuccess, 0, &log)
+	assert.Empty(t, log.String())
+
+	assert.Error(t, (&ExecHooks{OnSuccess: []string{"  "}}).Valid())
+
+	// 任务超时后正在执行的钩子命令被杀掉
+	job.Hooks = &ExecHooks{Pre: []string{"sleep 5"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Error(t, job.runPreHooks(ctx, task, nil, &log))
+	assert.Less(t, int64(time.Since(start)), int64(2*time.Second))
+
+	// 主命令超时后 on_failure 仍然执行
+	log.Reset()
+	job.Hooks = &ExecHooks{OnFailure: []string{script + " page"}}
+	job.runPostHooks(ctx, task, nil, CronTaskStatusTimeout, -1, &log)
+	assert.Contains(t, log.String(), "page backup -1 timeout")
+}
@@ -0,0 +1,127 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// 任务命令的执行方式
+const (
+	ExecModeScript = ""      // Script 为可执行文件的路径，与 Args 一起直接执行，由 shebang 决定解释器
+	ExecModeShell  = "shell" // Script 为一行 shell 命令，由 sh -c 执行，可以使用管道、重定向，Args 为 $1、$2...
+	ExecModeArgv   = "argv"  // Command 或切分后的 Script 直接执行，不经过 shell，程序按 PATH 查找
+)
+
+func (j *Job) validExecMode() error {
+	switch j.ExecMode {
+	case ExecModeScript, ExecModeShell:
+		if len(j.Command) > 0 {
+			return errors.New("command is only used when exec_mode is argv")
+		}
+	case ExecModeArgv:
+		if len(j.Command) == 0 {
+			if _, err := splitWords(j.Script); err != nil {
+				return fmt.Errorf("invalid script: %w", err)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid exec_mode %q, should be shell or argv", j.ExecMode)
+	}
+	return nil
+}
+
+// argv exec_mode 为 argv 时的命令，先切分再渲染参数，参数值中的空格、引号不会产生新的参数，程序本身不渲染
+func (j *Job) argv() ([]string, error) {
+	words := j.Command
+	if len(words) == 0 {
+		var err error
+		if words, err = splitWords(j.Script); err != nil {
+			return nil, fmt.Errorf("split script: %w", err)
+		}
+	}
+	if len(words) == 0 {
+		return nil, errors.New("command is empty")
+	}
+
+	if err := literalProgram(words[0]); err != nil {
+		return nil, err
+	}
+
+	argv := make([]string, 0, len(words)+len(j.Args))
+	argv = append(argv, words[0])
+	for _, word := range append(words[1:len(words):len(words)], j.Args...) {
+		word, err := renderParams(word, j.Params)
+		if err != nil {
+			return nil, fmt.Errorf("render argv[%d]: %w", len(argv), err)
+		}
+		argv = append(argv, word)
+	}
+	return argv, nil
+}
+
+// lookPath 不含路径分隔符的程序按 PATH 查找，执行前校验文件存在
+func lookPath(name string) (string, error) {
+	if strings.ContainsAny(name, `/\`) || filepath.IsAbs(name) {
+		return name, nil
+	}
+	return exec.LookPath(name)
+}
+
+// splitWords 按空白切分命令，支持单引号、双引号及反斜杠转义，不做变量、通配符展开
+func splitWords(s string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,57 @@
+//go:build !windows
+// +build !windows
+
+package job
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitWords(t *testing.T) {
+	words, err := splitWords(`python3 -c 'print("a b")' "x \"y\"" z\ w`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"python3", "-c", `print("a b")`, `x "y"`, "z w"}, words)
+
+	_, err = splitWords(`echo 'a`)
+	assert.Error(t, err)
+}
+
+func TestArgvCommand(t *testing.T) {
+	job := &Job{
+		ExecMode: ExecModeArgv,
+		Script:   "sh -c 'echo $0' {{.name}}",
+		Params:   map[string]string{"name": "a; rm -rf /"},
+	}
+	assert.NoError(t, job.validExecMode())
+
+	script, args, err := job.command()
+	assert.NoError(t, err)
+	assert.Equal(t, "sh", filepath.Base(script))
+	assert.Equal(t, []string{"-c", "echo $0", "a; rm -rf /"}, args)
+
+	job.Command = []string{"/usr/bin/env", "{{.name}}"}
+	script, args, err = job.command()
+	assert.NoError(t, err)
+	assert.Equal(t, "/usr/bin/env", script)
+	assert.Equal(t, []string{"a; rm -rf /"}, args)
+
+	job.ExecMode = ExecModeShell
+	job.Command = nil
+	job.Script = "echo {{.name}} | wc -c"
+	script, args, err = job.command()
+	assert.NoError(t, err)
+	assert.Equal(t, shellPath, script)
+	assert.Equal(t, []string{"-c", "echo 'a; rm -rf /' | wc -c", "sh"}, args)
+
+	job.Params["name"] = "it's $(id)"
+	_, args, err = job.command()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-c", `echo 'it'\''s $(id)' | wc -c`, "sh"}, args)
+
+	job.ExecMode = ""
+	job.Command = []string{"/usr/bin/env"}
+	assert.Error(t, job.validExecMode(), "command without argv mode")
+}
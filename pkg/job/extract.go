@@ -0,0 +1,157 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/douyu/jupiter/pkg/metric"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+var (
+	extractNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	// 从任务输出中提取的数值，name 为提取规则的名称
+	jobOutputGauge = metric.GaugeVecOpts{
+		Namespace: "juno",
+		Subsystem: "agent",
+		Name:      "job_output",
+		Help:      "numeric values extracted from cron job output",
+		Labels:    []string{"job_id", "job_name", "name"},
+	}.Build()
+)
+
+// Extract 从任务输出中提取数值的规则，提取结果作为 Prometheus gauge 暴露
+// Path 与 Regexp 二选一，Path 为 JSON 路径，如 "data.rows" 或 "items[0].count"，输出整体不是 JSON 时逐行尝试；
+// Regexp 为正则表达式，取第一个分组。均以最后一个匹配为准
+type Extract struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Regexp string `json:"regexp"`
+
+	re *regexp.Regexp
+}
+
+// 验证 extract 字段
+func (e *Extract) Valid() error {
+	if !extractNameRegexp.MatchString(e.Name) {
+		return fmt.Errorf("invalid extract name[%s]", e.Name)
+	}
+
+	if (e.Path == "") == (e.Regexp == "") {
+		return fmt.Errorf("extract[%s] requires exactly one of path and regexp", e.Name)
+	}
+
+	if e.Regexp != "" {
+		re, err := regexp.Compile(e.Regexp)
+		if err != nil {
+			return fmt.Errorf("invalid extract[%s] regexp, parse err: %s", e.Name, err.Error())
+		}
+		if re.NumSubexp() < 1 {
+			return fmt.Errorf("extract[%s] regexp requires a capture group", e.Name)
+		}
+		e.re = re
+	}
+
+	return nil
+}
+
+// Value 从输出中提取数值
+func (e *Extract) Value(output string) (float64, error) {
+	if e.re != nil {
+		matches := e.re.FindAllStringSubmatch(output, -1)
+		if len(matches) == 0 {
+			return 0, errors.New("no match")
+		}
+		return strconv.ParseFloat(strings.TrimSpace(matches[len(matches)-1][1]), 64)
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal([]byte(output), &doc); err == nil {
+		return lookupJSONPath(doc, e.Path)
+	}
+
+	lines := strings.Split(output, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, "{") && !strings.HasPrefix(line, "[") {
+			continue
+		}
+		if err := json.Unmarshal([]byte(line), &doc); err != nil {
+			continue
+		}
+		if v, err := lookupJSONPath(doc, e.Path); err == nil {
+			return v, nil
+		}
+	}
+
+	return 0, errors.New("no match")
+}
+
+// lookupJSONPath 按 a.b[0].c 形式的路径取值，支持可选的 "$." 前缀
+func lookupJSONPath(doc interface{}, path string) (float64, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+
+	cur := doc
+	for _, seg := range strings.Split(path, ".") {
+		key, indexes := seg, []int(nil)
+		if i := strings.Index(seg, "["); i >= 0 {
+			key = seg[:i]
+			for _, idx := range strings.Split(strings.Trim(seg[i:], "[]"), "][") {
+				n, err := strconv.Atoi(idx)
+				if err != nil {
+					return 0, fmt.Errorf("invalid index in path segment[%s]", seg)
+				}
+				indexes = append(indexes, n)
+			}
+		}
+
+		if key != "" {
+			m, ok := cur.(map[string]interface{})
+			if !ok {
+				return 0, fmt.Errorf("path segment[%s] is not an object", seg)
+			}
+			if cur, ok = m[key]; !ok {
+				return 0, fmt.Errorf("key[%s] not found", key)
+			}
+		}
+
+		for _, n := range indexes {
+			arr, ok := cur.([]interface{})
+			if !ok || n < 0 || n >= len(arr) {
+				return 0, fmt.Errorf("index[%d] out of range in path segment[%s]", n, seg)
+			}
+			cur = arr[n]
+		}
+	}
+
+	switch v := cur.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("value of path[%s] is not a number", path)
+	}
+}
+
+// extractMetrics 按规则从输出中提取数值并更新 gauge
+func (j *Job) extractMetrics(output string) {
+	for _, e := range j.Extracts {
+		v, err := e.Value(output)
+		if err != nil {
+			j.logger.Warn("extract metric failed", fieldJob(j.ID), xlog.String("name", e.Name), xlog.FieldErr(err))
+			continue
+		}
+		jobOutputGauge.Set(v, j.ID, j.Name, e.Name)
+	}
+}
@@ -0,0 +1,50 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		extract Extract
+		output  string
+		want    float64
+		wantErr bool
+	}{
+		{"json path", Extract{Name: "rows", Path: "data.rows"}, `{"data":{"rows":42}}`, 42, false},
+		{"json path with index", Extract{Name: "rows", Path: "$.items[1].count"}, `{"items":[{"count":1},{"count":"7.5"}]}`, 7.5, false},
+		{"json line", Extract{Name: "rows", Path: "rows"}, "start\n{\"rows\":1}\n{\"rows\":3}\ndone", 3, false},
+		{"regexp", Extract{Name: "rows", Regexp: `migrated (\d+) rows`}, "migrated 10 rows\nmigrated 12 rows", 12, false},
+		{"missing key", Extract{Name: "rows", Path: "data.total"}, `{"data":{"rows":42}}`, 0, true},
+		{"no match", Extract{Name: "rows", Regexp: `migrated (\d+) rows`}, "nothing", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, tt.extract.Valid())
+
+			got, err := tt.extract.Value(tt.output)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExtractValid(t *testing.T) {
+	assert.Error(t, (&Extract{Name: "rows-migrated", Path: "rows"}).Valid())
+	assert.Error(t, (&Extract{Name: "rows"}).Valid())
+	assert.Error(t, (&Extract{Name: "rows", Path: "rows", Regexp: `(\d+)`}).Valid())
+	assert.Error(t, (&Extract{Name: "rows", Regexp: `\d+`}).Valid())
+
+	job := &Job{ID: "extract", Extracts: []*Extract{{Name: "rows", Path: "rows"}, nil}}
+	assert.Error(t, job.ValidRules())
+	job = &Job{ID: "timer", Timers: []*Timer{nil}}
+	assert.Error(t, job.ValidRules())
+}
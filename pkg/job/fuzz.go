@@ -0,0 +1,13 @@
+//go:build gofuzz
+// +build gofuzz
+
+package job
+
+// Fuzz go-fuzz 入口，输入为 etcd 中的任务、临时任务内容
+func Fuzz(data []byte) int {
+	_, err := ParseJob(data)
+	if _, onceErr := ParseOnceJob(data); err != nil && onceErr != nil {
+		return 0
+	}
+	return 1
+}
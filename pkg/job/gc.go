@@ -0,0 +1,303 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/metric"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+const (
+	GCKeyPrefix      = "/juno/cronjob/gc/" // 清理的锁、上次清理的时间及首次看到还没有执行结果的批量任务的时间
+	gcLockKey        = GCKeyPrefix + "lock"
+	gcStateKey       = GCKeyPrefix + "state"
+	gcBatchKeyPrefix = GCKeyPrefix + "batch/"
+)
+
+// sonyflake 默认的起始时间，task id 的高位是从该时间起的 10ms 数
+var sonyflakeEpoch = time.Date(2014, 9, 1, 0, 0, 0, 0, time.UTC)
+
+// 清理的 key 数
+var gcReclaimedCounter = metric.CounterVecOpts{
+	Namespace: "juno",
+	Subsystem: "agent",
+	Name:      "gc_reclaimed_total",
+	Help:      "execution records deleted by gc",
+	Labels:    []string{"kind"},
+}.Build()
+
+// GCConfig 执行记录的清理
+// 多个节点开启时通过锁及上次清理的时间保证每个间隔只有一个节点清理存储，本地的执行记录由各节点自己清理
+type GCConfig struct {
+	Enable     bool
+	Interval   time.Duration // 清理间隔
+	KeepLatest int           // 每个任务保留最近的执行结果条数
+	TTL        time.Duration // proc、once、batch key 的保留时间，需大于任务的最长执行时间
+}
+
+func (c *GCConfig) normalize() {
+	if c.Interval < time.Minute {
+		c.Interval = time.Minute
+	}
+	if c.KeepLatest <= 0 {
+		c.KeepLatest = 100
+	}
+	if c.TTL <= 0 {
+		c.TTL = 7 * 24 * time.Hour
+	}
+}
+
+// runGC 按间隔清理，worker 停止后退出
+func (w *worker) runGC() {
+	for {
+		select {
+		case <-time.After(w.GC.Interval):
+		case <-w.done:
+			return
+		}
+
+		w.gcLocal()
+		if err := w.gcStore(); err != nil {
+			w.logger.Error("gc execution records failed", xlog.FieldErr(err))
+		}
+	}
+}
+
+// gcStore 清理存储中的执行结果及过期的 proc、once key
+func (w *worker) gcStore() error {
+	claimed, err := w.claimGC()
+	if err != nil || !claimed {
+		return err
+	}
+
+	// 清理不持有锁，其他节点在本间隔内看到已写入的清理时间后跳过
+	ctx, cancel := context.WithTimeout(context.Background(), w.GC.Interval)
+	defer cancel()
+	for kind, gc := range map[string]func(context.Context) (int, error){
+		"result": w.gcResults,
+		"proc":   w.gcProcs,
+		"once":   w.gcOnces,
+		"reduce": w.gcReduces,
+		"batch":  w.gcBatches,
+	} {
+		deleted, err := gc(ctx)
+		gcReclaimedCounter.Add(float64(deleted), kind)
+		if err != nil {
+			return fmt.Errorf("gc %s: %w", kind, err)
+		}
+		if deleted > 0 {
+			w.logger.Info("execution records reclaimed", xlog.String("kind", kind), xlog.Int("deleted", deleted))
+		}
+	}
+	return nil
+}
+
+// claimGC 持锁检查上次清理的时间，本间隔内没有节点清理过时写入当前时间后释放锁，返回是否由当前节点清理
+func (w *worker) claimGC() (bool, error) {
+	ctx, cancel := NewEtcdTimeoutContext(w)
+	defer cancel()
+
+	unlock, err := w.store.Lock(ctx, gcLockKey)
+	if err != nil {
+		return false, fmt.Errorf("lock: %w", err)
+	}
+	defer func() {
+		_ = unlock()
+	}()
+
+	kvs, err := w.store.List(ctx, gcStateKey)
+	if err != nil {
+		return false, err
+	}
+	for _, kv := range kvs {
+		last, err := time.Parse(time.RFC3339, string(kv.Value))
+		if kv.Key == gcStateKey && err == nil && time.Since(last) < w.GC.Interval {
+			// 其他节点刚清理过
+			return false, nil
+		}
+	}
+	if err := w.store.Put(ctx, gcStateKey, []byte(time.Now().Format(time.RFC3339))); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// gcResults 每个任务只保留最近的 KeepLatest 条执行结果
+func (w *worker) gcResults(ctx context.Context) (int, error) {
+	kvs, err := w.store.List(ctx, ResultKeyPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	type result struct {
+		key        string
+		executedAt time.Time
+	}
+	results := make(map[string][]result)
+	for _, kv := range kvs {
+		path := strings.TrimPrefix(kv.Key, ResultKeyPrefix)
+		index := strings.LastIndex(path, "/")
+		if index < 0 {
+			continue
+		}
+		var payload struct {
+			ExecutedAt time.Time `json:"executed_at"`
+		}
+		_ = json.Unmarshal(kv.Value, &payload)
+		jobID := path[:index]
+		results[jobID] = append(results[jobID], result{key: kv.Key, executedAt: payload.ExecutedAt})
+	}
+
+	deleted := 0
+	for _, runs := range results {
+		if len(runs) <= w.GC.KeepLatest {
+			continue
+		}
+		sort.Slice(runs, func(i, j int) bool {
+			return runs[i].executedAt.After(runs[j].executedAt)
+		})
+		for _, run := range runs[w.GC.KeepLatest:] {
+			if err := w.store.Delete(ctx, run.key); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// gcProcs 删除开始执行时间早于 TTL 的 proc key，租约未生效时节点宕机会遗留这些 key
+func (w *worker) gcProcs(ctx context.Context) (int, error) {
+	kvs, err := w.store.List(ctx, ProcKeyPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, kv := range kvs {
+		proc, err := GetProcFromKey(kv.Key)
+		if err != nil {
+			continue
+		}
+		val := ProcessVal{}
+		if err := json.Unmarshal(kv.Value, &val); err != nil || val.Time.IsZero() || time.Since(val.Time) < w.GC.TTL {
+			continue
+		}
+		// 当前节点上仍在执行的进程不删除
+		if proc.NodeID == w.ID && w.isRunning(proc.JobID, proc.TaskID) {
+			continue
+		}
+		if err := w.store.DeleteProc(ctx, kv.Key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// gcOnces 删除 task id 对应的时间早于 TTL 的 once key，无法从 task id 得到时间的不删除
+func (w *worker) gcOnces(ctx context.Context) (int, error) {
+	kvs, err := w.store.List(ctx, OnceKeyPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, kv := range kvs {
+		var once struct {
+			TaskID uint64 `json:"task_id"`
+		}
+		if err := json.Unmarshal(kv.Value, &once); err != nil {
+			continue
+		}
+		created, ok := taskTime(once.TaskID)
+		if !ok || time.Since(created) < w.GC.TTL {
+			continue
+		}
+		if err := w.store.Delete(ctx, kv.Key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// gcReduces 删除计划时间早于 TTL 的分片汇总数据，轮次即计划时间的 unix 秒数
+func (w *worker) gcReduces(ctx context.Context) (int, error) {
+	kvs, err := w.store.List(ctx, ReduceKeyPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, kv := range kvs {
+		parts := strings.SplitN(strings.TrimPrefix(kv.Key, ReduceKeyPrefix), "/", 3)
+		if len(parts) < 3 {
+			continue
+		}
+		round, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || time.Since(time.Unix(round, 0)) < w.GC.TTL {
+			continue
+		}
+		if err := w.store.Delete(ctx, kv.Key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// gcLocal 清理本地的执行记录，已不在当前节点调度、且最近一次执行早于 TTL 的任务不再保留
+func (w *worker) gcLocal() {
+	w.jobsMutex.RLock()
+	scheduled := make(map[string]bool, len(w.jobs))
+	for id := range w.jobs {
+		scheduled[id] = true
+	}
+	w.jobsMutex.RUnlock()
+
+	w.runsMutex.Lock()
+	defer w.runsMutex.Unlock()
+
+	deleted := 0
+	for id, runs := range w.runs {
+		if len(runs) == 0 {
+			delete(w.runs, id)
+			continue
+		}
+		if len(runs) > w.GC.KeepLatest {
+			deleted += len(runs) - w.GC.KeepLatest
+			w.runs[id] = runs[len(runs)-w.GC.KeepLatest:]
+		}
+		last := runs[len(runs)-1]
+		if !scheduled[id] && len(w.runningJobs[id]) == 0 && time.Since(last.ExecutedAt) > w.GC.TTL {
+			deleted += len(w.runs[id])
+			delete(w.runs, id)
+			delete(w.failures, id)
+			delete(w.durations, id)
+		}
+	}
+	gcReclaimedCounter.Add(float64(deleted), "local")
+}
+
+func (w *worker) isRunning(jobID string, taskID uint64) bool {
+	w.runsMutex.Lock()
+	defer w.runsMutex.Unlock()
+	_, ok := w.runningJobs[jobID][taskID]
+	return ok
+}
+
+// taskTime sonyflake 生成的 task id 的生成时间，不是 sonyflake 生成的 id 返回 false
+func taskTime(taskID uint64) (time.Time, bool) {
+	created := sonyflakeEpoch.Add(time.Duration(taskID>>24) * 10 * time.Millisecond)
+	if taskID>>24 == 0 || created.After(time.Now().Add(time.Hour)) {
+		return time.Time{}, false
+	}
+	return created, true
+}
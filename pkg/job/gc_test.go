@@ -0,0 +1,94 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGCStore(t *testing.T) {
+	config := DefaultConfig()
+	config.HostName = "node-1"
+	config.logger = xlog.DefaultLogger
+	config.GC.KeepLatest = 2
+	config.GC.TTL = time.Hour
+	config.GC.normalize()
+	store := &replayStore{kvs: make(map[string][]byte)}
+	w := &worker{
+		Config:      config,
+		ID:          config.HostName,
+		store:       store,
+		runningJobs: make(map[string]map[uint64]context.CancelFunc),
+	}
+	put := func(key string, value interface{}) {
+		data, _ := json.Marshal(value)
+		assert.NoError(t, store.Put(context.Background(), key, data))
+	}
+
+	base := time.Now().Add(-time.Hour)
+	for i := 1; i <= 4; i++ {
+		put(fmt.Sprintf("%sbackup/%d", ResultKeyPrefix, i), TaskResult{TaskID: uint64(i), ExecutedAt: base.Add(time.Duration(i) * time.Minute)})
+	}
+	put(ResultKeyPrefix+"cleanup/1", TaskResult{TaskID: 1})
+
+	stale := &Process{ID: "100", JobID: "backup", NodeID: "node-2", TaskID: 1}
+	put(stale.Key(), ProcessVal{Time: time.Now().Add(-2 * time.Hour)})
+	fresh := &Process{ID: "101", JobID: "backup", NodeID: "node-2", TaskID: 4}
+	put(fresh.Key(), ProcessVal{Time: time.Now()})
+
+	// task id 的高位为 sonyflake 起始时间后的 10ms 数
+	oldTaskID := uint64((time.Since(sonyflakeEpoch)-2*time.Hour)/(10*time.Millisecond)) << 24
+	newTaskID := uint64(time.Since(sonyflakeEpoch)/(10*time.Millisecond)) << 24
+	put(OnceKeyPrefix+"node-1/old", OnceJob{TaskID: oldTaskID})
+	put(OnceKeyPrefix+"node-1/new", OnceJob{TaskID: newTaskID})
+	put(OnceKeyPrefix+"node-1/manual", OnceJob{TaskID: 7})
+
+	assert.NoError(t, w.gcStore())
+
+	keys := make([]string, 0)
+	for key := range store.kvs {
+		keys = append(keys, key)
+	}
+	assert.ElementsMatch(t, []string{
+		ResultKeyPrefix + "backup/3",
+		ResultKeyPrefix + "backup/4",
+		ResultKeyPrefix + "cleanup/1",
+		fresh.Key(),
+		OnceKeyPrefix + "node-1/new",
+		OnceKeyPrefix + "node-1/manual",
+		gcStateKey,
+	}, keys)
+
+	// 间隔内其他节点不重复清理
+	put(ResultKeyPrefix+"backup/5", TaskResult{TaskID: 5, ExecutedAt: time.Now()})
+	assert.NoError(t, w.gcStore())
+	assert.Contains(t, store.kvs, ResultKeyPrefix+"backup/3")
+}
+
+func TestGCLocal(t *testing.T) {
+	config := DefaultConfig()
+	config.GC.KeepLatest = 2
+	config.GC.TTL = time.Hour
+	w := &worker{
+		Config:      config,
+		jobs:        make(Jobs),
+		runningJobs: make(map[string]map[uint64]context.CancelFunc),
+		runs: map[string][]*TaskResult{
+			"empty":   {},
+			"removed": {{TaskID: 1, ExecutedAt: time.Now().Add(-2 * time.Hour)}},
+			"backup":  {{TaskID: 2}, {TaskID: 3}, {TaskID: 4, ExecutedAt: time.Now()}},
+		},
+		failures:  map[string]int{"removed": 1},
+		durations: make(map[string][]float64),
+	}
+
+	w.gcLocal()
+	assert.Len(t, w.runs, 1)
+	assert.Len(t, w.runs["backup"], 2)
+	assert.NotContains(t, w.failures, "removed")
+}
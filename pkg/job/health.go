@@ -0,0 +1,144 @@
+package job
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WatchStatus 一个前缀的 watch 状态
+type WatchStatus struct {
+	Prefix      string    `json:"prefix"`
+	Established bool      `json:"established"`          // watch 已建立且未断开
+	Since       time.Time `json:"since"`                // 建立或断开的时间
+	LastEvent   time.Time `json:"last_event,omitempty"` // 最近收到变更的时间，前缀下没有变更时为空
+	Events      int64     `json:"events"`
+}
+
+// 检查与任务存储连接的超时及结果的缓存时间，就绪探针频繁请求时不会每次都访问存储
+const (
+	storeCheckTimeout = 2 * time.Second
+	storeCheckTTL     = 5 * time.Second
+)
+
+// Health 节点的就绪状态，所有 watch 已建立、与任务存储的连接正常且调度器在运行时就绪
+type Health struct {
+	Ready    bool           `json:"ready"`
+	Cron     bool           `json:"cron"`            // 调度器是否在运行
+	Store    string         `json:"store,omitempty"` // 与任务存储的连接或租约异常时的错误
+	Draining bool           `json:"draining"`
+	Jobs     int            `json:"jobs"`
+	Watches  []*WatchStatus `json:"watches"`
+}
+
+// watchTracker 记录各前缀 watch 的状态
+type watchTracker struct {
+	mu      sync.Mutex
+	watches map[string]*WatchStatus
+}
+
+// expect 登记将要建立的 watch，建立前为未就绪
+func (t *watchTracker) expect(prefixes ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.watches == nil {
+		t.watches = make(map[string]*WatchStatus)
+	}
+	for _, prefix := range prefixes {
+		if _, ok := t.watches[prefix]; !ok {
+			t.watches[prefix] = &WatchStatus{Prefix: prefix, Since: time.Now()}
+		}
+	}
+}
+
+// track 转发 events 并记录收到变更的时间，events 关闭时标记 watch 断开
+func (t *watchTracker) track(prefix string, events <-chan *StoreEvent) <-chan *StoreEvent {
+	t.mu.Lock()
+	if t.watches == nil {
+		t.watches = make(map[string]*WatchStatus)
+	}
+	status := &WatchStatus{Prefix: prefix, Established: true, Since: time.Now()}
+	t.watches[prefix] = status
+	t.mu.Unlock()
+
+	out := make(chan *StoreEvent)
+	go func() {
+		defer close(out)
+		for event := range events {
+			t.mu.Lock()
+			status.LastEvent = time.Now()
+			status.Events++
+			t.mu.Unlock()
+			out <- event
+		}
+
+		t.mu.Lock()
+		status.Established = false
+		status.Since = time.Now()
+		t.mu.Unlock()
+	}()
+	return out
+}
+
+// snapshot 按前缀排序的状态副本
+func (t *watchTracker) snapshot() []*WatchStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	watches := make([]*WatchStatus, 0, len(t.watches))
+	for _, status := range t.watches {
+		copied := *status
+		watches = append(watches, &copied)
+	}
+	sort.Slice(watches, func(i, j int) bool { return watches[i].Prefix < watches[j].Prefix })
+	return watches
+}
+
+// storeCheck 缓存最近一次检查任务存储的结果
+type storeCheck struct {
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+// check 超过 storeCheckTTL 后重新检查，etcd 断开时 watch 不会关闭，需要主动探测
+func (c *storeCheck) check(store JobStore) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.checked) < storeCheckTTL {
+		return c.err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeCheckTimeout)
+	defer cancel()
+	c.err = store.Check(ctx)
+	c.checked = time.Now()
+	return c.err
+}
+
+// Health 启动后各 watch 在后台建立，全部建立前未就绪
+func (w *worker) Health() *Health {
+	health := &Health{
+		Cron:     w.Cron != nil && atomic.LoadInt32(&w.Cron.running) == 1,
+		Draining: w.isDraining(),
+		Watches:  w.watches.snapshot(),
+	}
+	w.jobsMutex.RLock()
+	health.Jobs = len(w.jobs)
+	w.jobsMutex.RUnlock()
+	if w.store != nil {
+		if err := w.storeCheck.check(w.store); err != nil {
+			health.Store = err.Error()
+		}
+	}
+
+	health.Ready = health.Cron && len(health.Watches) > 0 && health.Store == ""
+	for _, status := range health.Watches {
+		if !status.Established {
+			health.Ready = false
+		}
+	}
+	return health
+}
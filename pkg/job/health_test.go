@@ -0,0 +1,60 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+	w := &worker{Config: DefaultConfig()}
+	w.watches.expect(JobsKeyPrefix, LockKeyPrefix)
+	assert.False(t, w.Health().Ready)
+
+	w.Cron = &Cron{running: 1}
+	jobs := make(chan *StoreEvent)
+	events := w.watches.track(JobsKeyPrefix, jobs)
+	assert.False(t, w.Health().Ready, "lock watch is not established")
+
+	w.watches.track(LockKeyPrefix, make(chan *StoreEvent))
+	health := w.Health()
+	assert.True(t, health.Ready)
+	assert.Len(t, health.Watches, 2)
+
+	go func() { jobs <- &StoreEvent{Type: StorePut, Key: JobsKeyPrefix + "backup"} }()
+	<-events
+	health = w.Health()
+	assert.Equal(t, int64(1), health.Watches[0].Events)
+	assert.False(t, health.Watches[0].LastEvent.IsZero())
+
+	// watch 断开后未就绪
+	close(jobs)
+	_, ok := <-events
+	assert.False(t, ok)
+	assert.False(t, w.Health().Ready)
+}
+
+// downStore 与存储的连接已断开，watch 不会因此关闭
+type downStore struct {
+	JobStore
+}
+
+func (downStore) Check(ctx context.Context) error {
+	return errors.New("context deadline exceeded")
+}
+
+func TestHealthStoreDown(t *testing.T) {
+	w := &worker{Config: DefaultConfig(), store: &replayStore{kvs: make(map[string][]byte)}}
+	w.Cron = &Cron{running: 1}
+	w.watches.track(JobsKeyPrefix, make(chan *StoreEvent))
+	assert.True(t, w.Health().Ready)
+
+	w.store = downStore{}
+	w.storeCheck.checked = time.Time{}
+	health := w.Health()
+	assert.False(t, health.Ready)
+	assert.Equal(t, "context deadline exceeded", health.Store)
+}
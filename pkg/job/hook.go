@@ -0,0 +1,286 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+const (
+	HookFuncBefore    = "before"    // before(job) 返回 false, reason 时跳过本次执行
+	HookFuncAfter     = "after"     // after(result) 任务结束后调用
+	HookFuncTransform = "transform" // transform(result) 返回字符串时替换任务输出
+	HookFuncAlert     = "alert"     // alert(result) 返回告警路由，随任务结果写入 etcd
+
+	hookTimeout = 3 * time.Second
+
+	hookMaxInstructions = 10000000  // 每次调用最多执行的指令数
+	hookRegistrySize    = 1024      // 数据栈的初始槽数
+	hookRegistryMaxSize = 64 * 1024 // 数据栈最多增长到的槽数
+	hookMaxStringRep    = 1 << 20   // string.rep 生成的字符串最大长度
+)
+
+// 沙箱中不允许使用的 base 库函数，防止读取本地文件、加载任意代码、绕过元表或干预 gc
+var hookForbiddenFuncs = []string{
+	"dofile", "loadfile", "load", "loadstring", "require", "module",
+	"collectgarbage", "setmetatable", "getmetatable", "rawset", "rawget", "rawequal",
+	"setfenv", "getfenv", "newproxy",
+}
+
+var errHookInstructions = errors.New("hook exceeded instruction limit")
+
+// hookBudget 限制执行的指令数，沙箱设置 context 后虚拟机每条指令检查一次 Done
+type hookBudget struct {
+	context.Context
+	left int
+}
+
+var closedDone = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+func (b *hookBudget) Done() <-chan struct{} {
+	if b.left--; b.left < 0 {
+		return closedDone
+	}
+	return b.Context.Done()
+}
+
+func (b *hookBudget) Err() error {
+	if b.left < 0 {
+		return errHookInstructions
+	}
+	return b.Context.Err()
+}
+
+// Hook 通过 etcd 下发的 Lua 扩展脚本
+// 脚本中按需定义 before/after/transform/alert 全局函数，未定义的函数不会被调用
+type Hook struct {
+	Name  string
+	proto *lua.FunctionProto
+}
+
+// CompileHook 编译 Lua 脚本，语法错误在下发时即可发现
+func CompileHook(name, source string) (*Hook, error) {
+	chunk, err := parse.Parse(strings.NewReader(source), name)
+	if err != nil {
+		return nil, err
+	}
+
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Hook{Name: name, proto: proto}, nil
+}
+
+// Before 执行前调用，返回 false 时跳过本次执行
+func (h *Hook) Before(j *Job) (bool, string, error) {
+	var (
+		ok     = true
+		reason string
+	)
+
+	err := h.call(HookFuncBefore, 2, func(L *lua.LState) lua.LValue {
+		return jobTable(L, j)
+	}, func(L *lua.LState) {
+		if v := L.Get(-2); v == lua.LFalse {
+			ok = false
+		}
+		reason = lua.LVAsString(L.Get(-1))
+	})
+
+	return ok, reason, err
+}
+
+// After 任务结束后调用，可修改输出并返回告警路由
+func (h *Hook) After(result *TaskResult) error {
+	newTable := func(L *lua.LState) lua.LValue {
+		return resultTable(L, result)
+	}
+
+	err := h.call(HookFuncTransform, 1, newTable, func(L *lua.LState) {
+		if v, ok := L.Get(-1).(lua.LString); ok {
+			result.Logs = string(v)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	err = h.call(HookFuncAlert, 1, newTable, func(L *lua.LState) {
+		if v, ok := L.Get(-1).(lua.LString); ok {
+			result.Alert = string(v)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return h.call(HookFuncAfter, 0, newTable, nil)
+}
+
+// call 在新的沙箱中加载脚本并调用指定函数，每次调用互不影响
+func (h *Hook) call(name string, nret int, arg func(L *lua.LState) lua.LValue, ret func(L *lua.LState)) error {
+	L := newSandbox()
+	defer L.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	L.SetContext(&hookBudget{Context: ctx, left: hookMaxInstructions})
+
+	L.Push(L.NewFunctionFromProto(h.proto))
+	if err := L.PCall(0, lua.MultRet, nil); err != nil {
+		return fmt.Errorf("load hook[%s] failed: %s", h.Name, err.Error())
+	}
+
+	fn, ok := L.GetGlobal(name).(*lua.LFunction)
+	if !ok {
+		return nil
+	}
+
+	err := L.CallByParam(lua.P{Fn: fn, NRet: nret, Protect: true}, arg(L))
+	if err != nil {
+		return fmt.Errorf("call hook[%s] %s failed: %s", h.Name, name, err.Error())
+	}
+
+	if ret != nil {
+		ret(L)
+	}
+	return nil
+}
+
+// newSandbox 只打开 base、table、string、math 库，限制调用栈及数据栈的大小
+func newSandbox() *lua.LState {
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:        true,
+		CallStackSize:       64,
+		RegistrySize:        hookRegistrySize,
+		RegistryMaxSize:     hookRegistryMaxSize,
+		MinimizeStackMemory: true,
+	})
+
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+
+	for _, name := range hookForbiddenFuncs {
+		L.SetGlobal(name, lua.LNil)
+	}
+	// 字符串的方法与 string 表是同一个表，替换后 ("x"):rep(n) 同样受限
+	if str, ok := L.GetGlobal(lua.StringLibName).(*lua.LTable); ok {
+		str.RawSetString("rep", L.NewFunction(hookStringRep))
+	}
+
+	return L
+}
+
+func hookStringRep(L *lua.LState) int {
+	str := L.CheckString(1)
+	n := L.CheckInt(2)
+	if n > 0 && len(str) > 0 && n > hookMaxStringRep/len(str) {
+		L.RaiseError("string.rep result exceeds %d bytes", hookMaxStringRep)
+		return 0
+	}
+	if n <= 0 {
+		L.Push(lua.LString(""))
+	} else {
+		L.Push(lua.LString(strings.Repeat(str, n)))
+	}
+	return 1
+}
+
+func jobTable(L *lua.LState, j *Job) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("id", lua.LString(j.ID))
+	t.RawSetString("name", lua.LString(j.Name))
+	t.RawSetString("script", lua.LString(j.Script))
+	t.RawSetString("env", lua.LString(j.Env))
+	t.RawSetString("zone", lua.LString(j.Zone))
+	t.RawSetString("run_on", lua.LString(j.runOn))
+	return t
+}
+
+func resultTable(L *lua.LState, result *TaskResult) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("job", jobTable(L, result.Job))
+	t.RawSetString("task_id", lua.LString(fmt.Sprintf("%d", result.TaskID)))
+	t.RawSetString("status", lua.LString(result.Status))
+	t.RawSetString("logs", lua.LString(result.Logs))
+	t.RawSetString("run_on", lua.LString(result.RunOn))
+	if result.FinishedAt != nil {
+		t.RawSetString("duration", lua.LNumber(result.FinishedAt.Sub(result.ExecutedAt).Seconds()))
+	}
+	if result.Shard != nil {
+		t.RawSetString("shard_index", lua.LNumber(result.Shard.Index))
+		t.RawSetString("shard_total", lua.LNumber(result.Shard.Total))
+	}
+	return t
+}
+
+// hook 获取任务配置的扩展脚本，未配置或脚本不存在时返回 nil
+func (w *worker) hook(name string) *Hook {
+	if name == "" {
+		return nil
+	}
+
+	w.hookMutex.RLock()
+	defer w.hookMutex.RUnlock()
+
+	return w.hooks[name]
+}
+
+func (w *worker) putHook(key string, source []byte) {
+	name := GetIDFromKey(key)
+	hook, err := CompileHook(name, string(source))
+	if err != nil {
+		w.logger.Warn("hook is invalid", xlog.FieldKey(key), xlog.FieldErr(err))
+		return
+	}
+
+	w.hookMutex.Lock()
+	w.hooks[name] = hook
+	w.hookMutex.Unlock()
+}
+
+// watchHooks 监听任务存储中的扩展脚本
+func (w *worker) watchHooks() {
+	kvs, events := w.watchPrefix(HookKeyPrefix)
+
+	for _, kv := range kvs {
+		w.putHook(kv.Key, kv.Value)
+	}
+
+	xgo.Go(func() {
+		for event := range events {
+			switch {
+			case event.IsCreate(), event.IsModify():
+				w.putHook(event.Key, event.Value)
+			case event.Type == StoreDelete:
+				w.hookMutex.Lock()
+				delete(w.hooks, GetIDFromKey(event.Key))
+				w.hookMutex.Unlock()
+			}
+		}
+	})
+}
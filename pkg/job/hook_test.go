@@ -0,0 +1,113 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHook(t *testing.T) {
+	job := &Job{ID: "job-1", Name: "backup"}
+
+	t.Run("before can skip job", func(t *testing.T) {
+		hook, err := CompileHook("skip", `
+function before(job)
+	if job.name == "backup" then
+		return false, "maintenance"
+	end
+	return true
+end`)
+		assert.NoError(t, err)
+
+		ok, reason, err := hook.Before(job)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, "maintenance", reason)
+	})
+
+	t.Run("after transforms logs and routes alert", func(t *testing.T) {
+		hook, err := CompileHook("route", `
+function transform(result)
+	return string.upper(result.logs)
+end
+
+function alert(result)
+	if result.status == "failed" then
+		return "ops-" .. result.job.id
+	end
+end`)
+		assert.NoError(t, err)
+
+		result := &TaskResult{Job: job, Status: CronTaskStatusFailed, Logs: "disk full"}
+		assert.NoError(t, hook.After(result))
+		assert.Equal(t, "DISK FULL", result.Logs)
+		assert.Equal(t, "ops-job-1", result.Alert)
+	})
+
+	t.Run("missing functions are skipped", func(t *testing.T) {
+		hook, err := CompileHook("empty", `local x = 1`)
+		assert.NoError(t, err)
+
+		ok, _, err := hook.Before(job)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.NoError(t, hook.After(&TaskResult{Job: job, Logs: "ok"}))
+	})
+
+	t.Run("sandbox forbids loading code and files", func(t *testing.T) {
+		hook, err := CompileHook("escape", `
+function before(job)
+	return io == nil and os == nil and dofile == nil and load == nil
+end`)
+		assert.NoError(t, err)
+
+		ok, _, err := hook.Before(job)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("sandbox forbids metatables and gc", func(t *testing.T) {
+		hook, err := CompileHook("meta", `
+function before(job)
+	return setmetatable == nil and rawset == nil and collectgarbage == nil
+end`)
+		assert.NoError(t, err)
+
+		ok, _, err := hook.Before(job)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("instructions are limited", func(t *testing.T) {
+		hook, err := CompileHook("busy", `function before(job) local n = 0 while true do n = n + 1 end end`)
+		assert.NoError(t, err)
+
+		start := time.Now()
+		_, _, err = hook.Before(job)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), errHookInstructions.Error())
+		assert.True(t, time.Since(start) < hookTimeout)
+	})
+
+	t.Run("string rep is limited", func(t *testing.T) {
+		hook, err := CompileHook("rep", `function before(job) return ("x"):rep(1024 * 1024 * 1024) end`)
+		assert.NoError(t, err)
+
+		_, _, err = hook.Before(job)
+		assert.Error(t, err)
+	})
+
+	t.Run("endless loop is interrupted", func(t *testing.T) {
+		hook, err := CompileHook("loop", `function before(job) while true do end end`)
+		assert.NoError(t, err)
+
+		_, _, err = hook.Before(job)
+		assert.Error(t, err)
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		_, err := CompileHook("bad", `function before(`)
+		assert.Error(t, err)
+	})
+}
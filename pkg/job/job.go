@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -13,8 +14,8 @@ import (
 	"strings"
 	"time"
 
-	"github.com/coreos/etcd/clientv3/concurrency"
-	"github.com/douyu/jupiter/pkg/client/etcdv3"
+	"github.com/douyu/juno-agent/pkg/job/parser"
+	"github.com/douyu/juno-agent/pkg/tracing"
 	"github.com/douyu/jupiter/pkg/xlog"
 	"go.uber.org/zap"
 )
@@ -35,6 +36,7 @@ type Job struct {
 	ID      string   `json:"id"`
 	Name    string   `json:"name"`
 	Script  string   `json:"script"`
+	Args    []string `json:"args"` // 命令参数，不经过 shell 直接传给进程
 	Timers  []*Timer `json:"timers"`
 	Enable  bool     `json:"enable"`  // 可手工控制的状态
 	Timeout int64    `json:"timeout"` // 单位时间秒，任务执行时间超时设置，大于 0 时有效
@@ -42,6 +44,10 @@ type Job struct {
 	Zone    string   `json:"zone"`
 	Nodes   []string `json:"nodes"`
 
+	// 节点标签选择器，如 {"region": "sh", "env": "prod"}
+	// 不为空时按当前节点的标签匹配，忽略 Nodes
+	Selector map[string]string `json:"selector"`
+
 	// 执行任务失败重试次数
 	// 默认为 0，不重试
 	RetryCount int `json:"retry_count"`
@@ -55,6 +61,88 @@ type Job struct {
 	// 1: 单机任务，同时只能单节点在线
 	JobType int `json:"job_type"`
 
+	// 分片数量，大于 0 且指定了 NodeGroup 时启用分片模式
+	// 分片按一致性哈希分配到节点组内的存活节点，分片序号通过环境变量传给命令
+	Shards    int    `json:"shards"`
+	NodeGroup string `json:"node_group"`
+
+	// 从输出中提取数值的规则，提取结果作为 Prometheus gauge 暴露
+	Extracts []*Extract `json:"extracts"`
+
+	// 判断执行是否成功的规则，为空时按退出码是否为 0 判断
+	Success *SuccessRule `json:"success"`
+
+	// 主命令前后执行的命令，如清理、预热缓存及失败告警
+	Hooks *ExecHooks `json:"hooks"`
+
+	// 逐行解析输出为结构化事件，为空时不解析
+	LogParser *LogParser `json:"log_parser"`
+
+	// 脚本依赖的 python virtualenv 或 node_modules，按锁文件缓存，为空时直接执行
+	Runtime *RuntimeEnv `json:"runtime"`
+
+	// 分片任务所有分片执行完后的汇总命令，为空时不汇总
+	Reduce *Reducer `json:"reduce"`
+
+	// 外部系统写入的触发 key 变更时执行，为空时只按 Timers 调度
+	Trigger *Trigger `json:"trigger"`
+
+	// 禁止调度执行的时间段，如月末关账期间，处于时间段内的触发记为 skipped，为空时只受节点全局的限制
+	Blackout *Blackout `json:"blackout"`
+	// 夏令时切换时的处理方式：skip 跳过不存在的时间、重复的时间只执行一次；
+	// run-once 在不存在的时间段结束时执行一次；run-twice 同 run-once，但重复的时间执行两次。为空时使用节点配置
+	DST parser.DSTPolicy `json:"dst"`
+	// 是否把输出投递到节点配置的 loki 或 elasticsearch，为空时按节点配置 logShip.allJobs
+	ShipLogs *bool `json:"ship_logs"`
+
+	// 新增或修改后立即执行一次，之后仍按 Timers 调度，可用于发布后验证任务
+	RunOnAdd bool `json:"run_on_add"`
+
+	// 执行方式，为空时 Script 为脚本文件的路径；shell 时 Script 为 shell 命令行；
+	// argv 时执行 Command，Command 为空时按空白切分 Script，不经过 shell
+	ExecMode string   `json:"exec_mode"`
+	Command  []string `json:"command"`
+
+	// 脚本文件内容的 SHA-256，每次执行前校验，不符时不执行
+	ScriptSHA256 string `json:"script_sha256"`
+	// 执行前下载并校验的制品，Script 为空时执行该制品
+	Artifact *Artifact `json:"artifact"`
+	// 每次执行前下载到工作区的文件
+	Artifacts []*Artifact `json:"artifacts"`
+	// 是否在独立的工作区中执行，工作区为命令的默认工作目录及临时目录，为空时按节点配置 workspaces.allJobs
+	Workspace *bool `json:"workspace"`
+
+	// 命令的工作目录，为空时使用 agent 的工作目录，钩子命令同样在该目录下执行
+	WorkDir string `json:"work_dir"`
+	// 命令的 umask，八进制，如 "022"，为空时继承 agent 的 umask
+	Umask string `json:"umask"`
+	// 命令的资源限制，umask 与资源限制只在 unix 下支持
+	Rlimits *Rlimits `json:"rlimits"`
+	// 命令的 CPU 及 IO 调度优先级，如备份任务使用 idle 避免影响同节点的服务，只在 linux 下支持
+	Priority *Priority `json:"priority"`
+
+	// 传给命令的环境变量，值为 secret://path#key 时在执行前从密钥存储读取，明文不写入日志且在输出中遮盖
+	Envs map[string]string `json:"envs"`
+
+	// 扩展脚本名称，对应 /{HookKeyPrefix}/name 下发的 Lua 脚本
+	Hook string `json:"hook"`
+
+	// 参数默认值，Args 及 shell 方式的 Script 中可以用 {{.name}} 引用，执行的程序路径中不能引用
+	// 临时任务可以只指定任务 ID 及参数，复用任务定义中的命令
+	Params map[string]string `json:"params"`
+
+	// 尽力而为的任务，节点资源压力过高时推迟执行，压力持续未缓解则放弃本次执行
+	BestEffort bool `json:"best_effort"`
+
+	// 任务所属的应用/租户，开启结果加密时使用该租户的密钥，为空时使用 DefaultTenant
+	Tenant string `json:"tenant"`
+
+	// 任务的负责人及所属团队，开启 jobAuth 时签名密钥需要有该团队的权限
+	Owner string `json:"owner"`
+	Team  string `json:"team"`
+	// 管理端的签名，格式为 keyID:base64(ed25519 签名)，签名内容见 CanonicalJob
+	Auth string `json:"auth"`
+
 	// 执行任务的结点，用于记录 job log
 	runOn    string // worker id
 	hostname string
@@ -62,7 +150,7 @@ type Job struct {
 	// 用于访问etcd
 	*worker `json:"-"`
 
-	mutex  *etcdv3.Mutex
+	unlock func() error // 释放任务锁
 	locked bool
 }
 
@@ -78,6 +166,9 @@ func (j *Job) Cmds() (cmds map[string]*Cmd) {
 	}
 
 	for _, r := range j.Timers {
+		if r.Disabled {
+			continue
+		}
 		cmd := &Cmd{
 			Job:   j,
 			Timer: r,
@@ -98,7 +189,7 @@ func GetIDFromKey(key string) string {
 	return key[index+1:]
 }
 
-func (j *Job) Run(taskOptions ...TaskOption) error {
+func (j *Job) Run(taskOptions ...TaskOption) (err error) {
 	var (
 		cmd           *exec.Cmd
 		ctx           context.Context
@@ -107,6 +198,10 @@ func (j *Job) Run(taskOptions ...TaskOption) error {
 	)
 
 	task := NewTask(j, taskOptions...)
+	if task.TaskID == 0 {
+		task.span.End()
+		return ErrTaskID
+	}
 	_ = task.SetStatus(CronTaskStatusProcessing, "")
 
 	if j.Timeout > 0 {
@@ -117,8 +212,43 @@ func (j *Job) Run(taskOptions ...TaskOption) error {
 		defer cancel()
 	}
 
+	if hook := j.hook(j.Hook); hook != nil {
+		ok, reason, err := hook.Before(j)
+		if err != nil {
+			j.logger.Warn("run before hook failed", fieldJob(j.ID), xlog.FieldErr(err))
+		} else if !ok {
+			j.logger.Info("job skipped by hook", fieldJob(j.ID), xlog.String("reason", reason))
+
+			consoleLogBuf.WriteString("skipped by hook: " + reason)
+			_ = task.SetStatus(CronTaskStatusSkipped, consoleLogBuf.String())
+
+			return fmt.Errorf("job skipped by hook[%s]: %s", j.Hook, reason)
+		}
+	}
+
+	script, args, err := j.command()
+	if err != nil {
+		j.logger.Error("render command failed", fieldJob(j.ID), xlog.FieldErr(err))
+
+		consoleLogBuf.WriteString("render command failed: " + err.Error())
+		_ = task.SetStatus(CronTaskStatusFailed, consoleLogBuf.String())
+
+		return err
+	}
+	script, artifact, cleanupScript, err := j.verifyScript(ctx, script)
+	defer cleanupScript()
+	if err != nil {
+		scriptVerifyFailuresCounter.Inc(j.ID)
+		j.logger.Error("verify script failed", fieldJob(j.ID), xlog.FieldErr(err))
+
+		consoleLogBuf.WriteString("verify script failed: " + err.Error())
+		_ = task.SetStatus(CronTaskStatusFailed, consoleLogBuf.String())
+
+		return err
+	}
+
 	// check if script exists
-	scriptFileState, err := os.Stat(j.Script)
+	scriptFileState, err := os.Stat(script)
 	if err != nil {
 		j.logger.Error("read script file failed", xlog.String("err", err.Error()))
 
@@ -127,29 +257,178 @@ func (j *Job) Run(taskOptions ...TaskOption) error {
 
 		return err
 	} else if scriptFileState.IsDir() {
-		j.logger.Error("script path is a dir", xlog.String("script", j.Script))
+		j.logger.Error("script path is a dir", xlog.String("script", script))
 
 		consoleLogBuf.WriteString("script path is a dir, not a executable file")
 		_ = task.SetStatus(CronTaskStatusFailed, consoleLogBuf.String())
 
-		return fmt.Errorf("script is a dir, not a executable file. jobId[%s] script[%s]", j.ID, j.Script)
+		return fmt.Errorf("script is a dir, not a executable file. jobId[%s] script[%s]", j.ID, script)
 	}
 
-	j.logger.Infof("command is : %s", j.Script)
-	cmd = exec.CommandContext(ctx, j.Script)
+	if err := j.allowCommand(task, "command", script, args); err != nil {
+		consoleLogBuf.WriteString("denied by command policy: " + err.Error())
+		_ = task.SetStatus(CronTaskStatusFailed, consoleLogBuf.String())
+
+		return err
+	}
+
+	if j.isDraining() {
+		consoleLogBuf.WriteString("skipped: node is draining")
+		_ = task.SetStatus(CronTaskStatusSkipped, consoleLogBuf.String())
+
+		return ErrDraining
+	}
+	if limiter, maxStarts := j.startLimit(); !limiter.Allow() {
+		jobThrottledCounter.Inc(j.ID)
+		j.logger.Warn("job start throttled", fieldJob(j.ID), fieldTask(task.TaskID), xlog.Int("maxStartsPerMinute", maxStarts))
+
+		consoleLogBuf.WriteString(fmt.Sprintf("skipped: throttled, more than %d starts per minute on this node", maxStarts))
+		_ = task.SetStatus(CronTaskStatusSkipped, consoleLogBuf.String())
+
+		return ErrThrottled
+	}
+	if j.dryRun() {
+		j.logger.Info("job skipped in replay", fieldJob(j.ID), fieldTask(task.TaskID), xlog.String("script", script), xlog.Any("args", args))
+
+		consoleLogBuf.WriteString("skipped: replaying without exec")
+		_ = task.SetStatus(CronTaskStatusSkipped, consoleLogBuf.String())
+
+		return nil
+	}
+
+	// 任务定义的环境变量在前，agent 设置的变量同名时覆盖
+	env, secrets, err := j.resolveEnvs(ctx)
+	if err != nil {
+		j.logger.Error("resolve job envs failed", fieldJob(j.ID), xlog.FieldErr(err))
+
+		consoleLogBuf.WriteString("resolve job envs failed: " + err.Error())
+		_ = task.SetStatus(CronTaskStatusFailed, consoleLogBuf.String())
+
+		return err
+	}
+	task.masker = j.taskMasker(secrets)
+	if j.Runtime != nil {
+		if err := j.allowRuntime(task); err != nil {
+			consoleLogBuf.WriteString("denied by command policy: " + err.Error())
+			_ = task.SetStatus(CronTaskStatusFailed, consoleLogBuf.String())
+
+			return err
+		}
+		dir, release, err := j.envs.prepare(ctx, j.Runtime)
+		if err != nil {
+			j.logger.Error("prepare job runtime failed", fieldJob(j.ID), xlog.FieldErr(err))
+
+			consoleLogBuf.WriteString("prepare job runtime failed: " + err.Error())
+			_ = task.SetStatus(CronTaskStatusFailed, consoleLogBuf.String())
+
+			return err
+		}
+		defer release()
+		env = append(env, runtimeEnv(j.Runtime, dir)...)
+	}
+
+	workspace, cleanup, err := j.prepareWorkspace(ctx, task.TaskID)
+	if err != nil {
+		j.logger.Error("prepare workspace failed", fieldJob(j.ID), xlog.FieldErr(err))
+
+		consoleLogBuf.WriteString("prepare workspace failed: " + err.Error())
+		_ = task.SetStatus(CronTaskStatusFailed, consoleLogBuf.String())
+
+		return err
+	}
+	defer func() { cleanup(err != nil) }()
+
+	j.logger.Info("run command", fieldJob(j.ID), fieldTask(task.TaskID), xlog.String("script", script), xlog.Any("args", args))
+	script, args = j.limitCommand(shellCommand(script, args))
+	cmd = exec.CommandContext(ctx, script, args...)
+	cmd.Dir = j.WorkDir
+	if workspace != "" {
+		if cmd.Dir == "" {
+			cmd.Dir = workspace
+		}
+		env = append(env, workspaceEnv(workspace)...)
+	}
+	if task.shard != nil {
+		env = append(env, task.shard.Env()...)
+	}
+	if task.trigger != nil {
+		env = append(env, task.trigger.Env()...)
+	}
+	env = append(env, task.env...)
+	if artifact != "" {
+		env = append(env, EnvJobArtifact+"="+artifact)
+	}
+	// 将 trace context 传递给任务进程，任务调用下游服务时可以关联到同一个 trace
+	if traceParent := task.span.TraceParent(); traceParent != "" {
+		env = append(env, tracing.EnvTraceParent+"="+traceParent)
+	}
+	result, cleanupResult, err := resultFile(task.TaskID)
+	if err != nil {
+		j.logger.Error("create result file dir failed", fieldJob(j.ID), xlog.FieldErr(err))
+
+		consoleLogBuf.WriteString("create result file dir failed: " + err.Error())
+		_ = task.SetStatus(CronTaskStatusFailed, consoleLogBuf.String())
+
+		return err
+	}
+	defer cleanupResult()
+	env = append(env, EnvJobResultFile+"="+result)
+	cmd.Env = append(os.Environ(), env...)
+	if err := j.runPreHooks(ctx, task, env, &consoleLogBuf); err != nil {
+		_ = task.SetStatus(CronTaskStatusFailed, consoleLogBuf.String())
+		return err
+	}
 
 	sysProcAttr := makeCmdAttr()
 	cmd.SysProcAttr = sysProcAttr
-	cmd.Stdout = &consoleLogBuf
-	cmd.Stderr = &consoleLogBuf
-	if err := cmd.Start(); err != nil {
-		j.logger.Info(consoleLogBuf.String())
+	output, closeOutput := j.startOutput(task.TaskID)
+	defer closeOutput()
+
+	// 输出订阅及日志事件解析由 ring 异步推送，不阻塞子进程
+	var sink io.Writer = output
+	events := j.logEvents(task)
+	if events != nil {
+		sink = io.MultiWriter(output, events)
+	}
+	var mask io.WriteCloser
+	if task.masker != nil {
+		mask = newMaskWriter(sink, task.masker)
+		sink = mask
+	}
+	ring, err := newOutputRing(j.OutputBufferSize, sink)
+	if err != nil {
+		j.logger.Error("alloc output buffer failed", fieldJob(j.ID), xlog.FieldErr(err))
+
+		consoleLogBuf.WriteString("alloc output buffer failed: " + err.Error())
+		_ = task.SetStatus(CronTaskStatusFailed, consoleLogBuf.String())
+
+		return err
+	}
+	defer ring.Free()
+	// Stdout 与 Stderr 使用同一个 writer，exec 只会启动一个协程写入
+	cmd.Stdout = ring
+	cmd.Stderr = ring
+	if j.Priority != nil {
+		var prioErr error
+		prioErr, err = startWithPriority(cmd, j.Priority)
+		if prioErr != nil {
+			// 设置失败时仍以继承的优先级执行，在输出中注明
+			j.logger.Warn("set job priority failed", fieldJob(j.ID), xlog.FieldErr(prioErr))
+			consoleLogBuf.WriteString("set priority failed: " + prioErr.Error() + "\n")
+		}
+	} else {
+		err = cmd.Start()
+	}
+	if err != nil {
+		j.logger.Info(task.mask(consoleLogBuf.String()))
 
 		consoleLogBuf.WriteString(err.Error())
 		_ = task.SetStatus(CronTaskStatusFailed, consoleLogBuf.String())
 		return err
 	}
 
+	defer j.trackRunning(j.ID, task.TaskID, cmd.Process.Pid)()
+
 	proc := &Process{
 		ID:     strconv.Itoa(cmd.Process.Pid),
 		JobID:  j.ID,
@@ -167,20 +446,43 @@ func (j *Job) Run(taskOptions ...TaskOption) error {
 		}()
 	}()
 
-	if err := cmd.Wait(); err != nil {
-		j.logger.Error(consoleLogBuf.String())
+	err = cmd.Wait()
+	ring.Close()
+	if dropped := ring.Dropped(); dropped > 0 {
+		j.logger.Warn("output subscribers fell behind, output skipped", fieldJob(j.ID), xlog.Any("bytes", dropped))
+	}
+	consoleLogBuf.Write(ring.Bytes())
+	if mask != nil {
+		_ = mask.Close()
+	}
+	_ = events.Close()
+	j.parseResult(task, result, consoleLogBuf.String())
+	exitCode := -1
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+		task.span.SetAttribute("process.exit_code", exitCode)
+	}
+	// 配置了成功规则时，退出码也由规则判断
+	if _, exited := err.(*exec.ExitError); j.Success != nil && ctx.Err() == nil && (err == nil || exited) {
+		err = j.Success.Check(exitCode, consoleLogBuf.String(), time.Since(proc.Time))
+	}
+	if err != nil {
+		j.logger.Error(task.mask(consoleLogBuf.String()))
 		consoleLogBuf.WriteString(err.Error())
 
+		status := CronTaskStatusFailed
 		if ctx.Err() == context.DeadlineExceeded {
-			_ = task.SetStatus(CronTaskStatusTimeout, consoleLogBuf.String())
-		} else {
-			_ = task.SetStatus(CronTaskStatusFailed, consoleLogBuf.String())
+			status = CronTaskStatusTimeout
 		}
+		j.runPostHooks(ctx, task, env, status, exitCode, &consoleLogBuf)
+		_ = task.SetStatus(status, consoleLogBuf.String())
 
 		return err
 	}
 
-	j.logger.Info(consoleLogBuf.String())
+	j.logger.Info(task.mask(consoleLogBuf.String()))
+	j.extractMetrics(consoleLogBuf.String())
+	j.runPostHooks(ctx, task, env, CronTaskStatusSuccess, exitCode, &consoleLogBuf)
 	_ = task.SetStatus(CronTaskStatusSuccess, consoleLogBuf.String())
 
 	return nil
@@ -192,50 +494,114 @@ func (j *Job) RunWithRecovery() {
 			const size = 64 << 10
 			buf := make([]byte, size)
 			buf = buf[:runtime.Stack(buf, false)]
-			j.logger.Warnf("panic running job: %v\n%s", r, buf)
+			j.logger.Warn("panic running job", fieldJob(j.ID), xlog.Any("panic", r), xlog.FieldStack(buf))
 		}
 	}()
 	_ = j.Run()
 }
 
 func (j *Job) ValidRules() error {
-	for _, r := range j.Timers {
+	// 任务定义中的 null 元素解析为 nil
+	for i, r := range j.Timers {
+		if r == nil {
+			return fmt.Errorf("timer[%d] is empty", i)
+		}
 		if err := r.Valid(); err != nil {
 			return err
 		}
 	}
-	return nil
-}
-
-func (j *Job) Lock() error {
-	var err error
-	j.mutex, err = j.Client.NewMutex(LockKeyPrefix+j.ID, concurrency.WithTTL(10))
-	if err != nil {
+	for i, e := range j.Extracts {
+		if e == nil {
+			return fmt.Errorf("extract[%d] is empty", i)
+		}
+		if err := e.Valid(); err != nil {
+			return err
+		}
+	}
+	if j.Success != nil {
+		if err := j.Success.Valid(); err != nil {
+			return err
+		}
+	}
+	if j.Hooks != nil {
+		if err := j.Hooks.Valid(); err != nil {
+			return err
+		}
+	}
+	if j.Runtime != nil {
+		if err := j.Runtime.Valid(); err != nil {
+			return err
+		}
+	}
+	if j.LogParser != nil {
+		if err := j.LogParser.Valid(); err != nil {
+			return err
+		}
+	}
+	if j.Trigger != nil {
+		if err := j.Trigger.Valid(); err != nil {
+			return err
+		}
+	}
+	if j.Reduce != nil {
+		if err := j.Reduce.Valid(); err != nil {
+			return err
+		}
+	}
+	if j.Blackout != nil {
+		if err := j.Blackout.Valid(); err != nil {
+			return err
+		}
+	}
+	if j.Priority != nil {
+		if err := j.Priority.Valid(); err != nil {
+			return err
+		}
+	}
+	if err := j.DST.Valid(); err != nil {
 		return err
 	}
-
-	err = j.mutex.Lock(3 * time.Second)
-	if err != nil {
+	if err := j.validExecMode(); err != nil {
+		return err
+	}
+	if err := j.validIntegrity(); err != nil {
+		return err
+	}
+	if err := j.validEnvs(); err != nil {
 		return err
 	}
+	return j.validExecAttr()
+}
 
-	j.locked = true
+func (j *Job) Lock() error {
+	return j.etcdRetry("lock", j.Etcd.LockTimeout, func(ctx context.Context) (err error) {
+		j.unlock, err = j.store.Lock(ctx, LockKeyPrefix+j.ID)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		j.locked = true
+
+		return nil
+	})
 }
 
 func (j *Job) Unlock() {
-	if j.mutex != nil {
-		err := j.mutex.Unlock()
+	if j.unlock != nil {
+		err := j.unlock()
 		if err != nil {
 			xlog.Error("unlock failed", xlog.FieldErr(err))
 		}
+		j.unlock = nil
+		j.locked = false
 	}
 }
 
 type Timer struct {
 	ID   string `json:"id"`
 	Cron string `json:"timer"`
+	// 单独停用该定时规则，任务的其他定时规则不受影响
+	Disabled bool `json:"disabled"`
 
 	Schedule Schedule `json:"-"`
 }
@@ -255,7 +621,6 @@ func (rule *Timer) Valid() error {
 	if err != nil {
 		return fmt.Errorf("invalid Timer[%s], parse err: %s", rule.Cron, err.Error())
 	}
-
 	rule.Schedule = sch
 	return nil
 }
@@ -289,9 +654,37 @@ func (c *Cmd) GetID() string {
 	return c.Job.ID + "-" + c.Timer.ID
 }
 
+// schedule 按任务或节点的夏令时策略包装定时规则
+func (c *Cmd) schedule() Schedule {
+	return parser.WithDST(c.Timer.Schedule, c.dstPolicy())
+}
+
+func (c *Cmd) dstPolicy() parser.DSTPolicy {
+	if c.Job.DST != parser.DSTLegacy {
+		return c.Job.DST
+	}
+	return c.worker.DSTPolicy
+}
+
 func (c *Cmd) Run() error {
+	c.observeQueueWait()
+	if reason, ok := c.blackout(time.Now()); ok {
+		c.skipBlackout(reason)
+		return nil
+	}
+	if c.Job.BestEffort && !c.admit() {
+		return nil
+	}
+	if c.Job.IsSharded() {
+		return c.runShards()
+	}
+
+	return c.runWithRetry()
+}
+
+func (c *Cmd) runWithRetry(taskOptions ...TaskOption) error {
 	if c.Job.RetryCount <= 0 {
-		err := c.Job.Run()
+		err := c.Job.Run(taskOptions...)
 		if err != nil {
 			c.logger.Info("job run failed : ", xlog.FieldErr(err))
 		}
@@ -299,7 +692,7 @@ func (c *Cmd) Run() error {
 	}
 
 	for i := 0; i <= c.Job.RetryCount; i++ {
-		if err := c.Job.Run(); err != nil {
+		if err := c.Job.Run(taskOptions...); err != nil {
 			c.logger.Info("job run failed", xlog.FieldErr(err))
 		}
 
@@ -0,0 +1,215 @@
+package job
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/metric"
+)
+
+// ErrJobUnauthorized 开启 jobAuth 后任务定义没有有效的签名，或签名的密钥无权管理任务所属的团队
+var ErrJobUnauthorized = errors.New("job is not authorized")
+
+// 签名校验不通过而拒绝的任务数
+var jobAuthRejectedCounter = metric.CounterVecOpts{
+	Namespace: "juno",
+	Subsystem: "agent",
+	Name:      "job_auth_rejected_total",
+	Help:      "job definitions refused because of missing or invalid signatures",
+	Labels:    []string{"kind"},
+}.Build()
+
+// JobAuthConfig 校验任务定义的签名，只执行由受信任的管理端签名的任务，
+// 避免拥有 etcd 写权限即可在所有节点上执行任意命令
+type JobAuthConfig struct {
+	Enable  bool
+	Keys    []*JobAuthKey
+	OnceTTL time.Duration // 签名的临时任务 expires 距当前时间的上限，过期或 nonce 重复的临时任务被拒绝
+}
+
+// JobAuthKey 管理端签名使用的 ed25519 公钥
+type JobAuthKey struct {
+	ID        string
+	PublicKey string   // base64 编码的 ed25519 公钥
+	Teams     []string // 该密钥可以签名的团队，为空时不限制
+
+	key ed25519.PublicKey
+}
+
+// Valid 未开启时也解析公钥，制品的签名同样使用这些公钥校验
+func (c *JobAuthConfig) Valid() error {
+	if c.Enable && len(c.Keys) == 0 {
+		return errors.New("jobAuth requires at least one public key")
+	}
+	if c.Enable && c.OnceTTL <= 0 {
+		return errors.New("jobAuth onceTTL should be positive")
+	}
+	for _, k := range c.Keys {
+		if k.ID == "" || strings.Contains(k.ID, ":") {
+			return fmt.Errorf("invalid jobAuth key id %q", k.ID)
+		}
+		key, err := base64.StdEncoding.DecodeString(k.PublicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("jobAuth key %s: invalid ed25519 public key", k.ID)
+		}
+		k.key = key
+	}
+	return nil
+}
+
+func (c *JobAuthConfig) key(id string) *JobAuthKey {
+	for _, k := range c.Keys {
+		if k.ID == id {
+			return k
+		}
+	}
+	return nil
+}
+
+// allowTeam 密钥是否可以签名该团队的任务
+func (k *JobAuthKey) allowTeam(team string) bool {
+	if len(k.Teams) == 0 {
+		return true
+	}
+	for _, t := range k.Teams {
+		if t == team {
+			return true
+		}
+	}
+	return false
+}
+
+// CanonicalJob 签名的内容：去掉 auth 及 omit 字段后按 key 排序的紧凑 JSON，与原始内容的格式、字段顺序无关
+func CanonicalJob(data []byte, omit ...string) ([]byte, error) {
+	return canonicalJSON(data, append(omit, "auth")...)
+}
+
+func canonicalJSON(data []byte, omit ...string) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	fields := make(map[string]interface{})
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+	for _, name := range omit {
+		delete(fields, name)
+	}
+	return json.Marshal(fields)
+}
+
+// SignJob 管理端写入任务定义前签名，返回带 auth 字段的任务定义
+func SignJob(data []byte, keyID string, key ed25519.PrivateKey) ([]byte, error) {
+	canonical, err := CanonicalJob(data)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	fields["auth"], _ = json.Marshal(keyID + ":" + base64.StdEncoding.EncodeToString(ed25519.Sign(key, canonical)))
+	return json.Marshal(fields)
+}
+
+// authorize 校验任务定义的签名及签名密钥的团队权限，未开启 jobAuth 时不校验
+func (w *worker) authorize(kind string, data []byte, job *Job, omit ...string) error {
+	if !w.JobAuth.Enable {
+		return nil
+	}
+	if err := w.verifyAuth(data, job, omit...); err != nil {
+		jobAuthRejectedCounter.Inc(kind)
+		return fmt.Errorf("%w: %s", ErrJobUnauthorized, err)
+	}
+	return nil
+}
+
+// authorizeOnce 临时任务不论是否只带 Params 都校验签名，并要求签名内容中带有未过期的 expires 及未使用过的 nonce，
+// 避免截获的临时任务被重复写入执行
+func (w *worker) authorizeOnce(data []byte, job *OnceJob) error {
+	if !w.JobAuth.Enable {
+		return nil
+	}
+	err := w.verifyAuth(data, &job.Job, "task_id", "ack")
+	if err == nil {
+		err = w.onceNonces.use(job.Nonce, job.Expires, w.JobAuth.OnceTTL, time.Now())
+	}
+	if err != nil {
+		jobAuthRejectedCounter.Inc("once")
+		return fmt.Errorf("%w: %s", ErrJobUnauthorized, err)
+	}
+	return nil
+}
+
+// onceNonces 已执行的临时任务 nonce，保留到临时任务过期，只在内存中记录，重启后依靠 onceTTL 限制重放的窗口
+type onceNonces struct {
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+func (n *onceNonces) use(nonce string, expires int64, ttl time.Duration, now time.Time) error {
+	if nonce == "" {
+		return errors.New("missing nonce")
+	}
+	if expires == 0 {
+		return errors.New("missing expires")
+	}
+	deadline := time.Unix(expires, 0)
+	if !now.Before(deadline) {
+		return errors.New("once job expired")
+	}
+	if deadline.Sub(now) > ttl {
+		return fmt.Errorf("expires should be within %s", ttl)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for k, t := range n.used {
+		if !now.Before(t) {
+			delete(n.used, k)
+		}
+	}
+	if _, ok := n.used[nonce]; ok {
+		return fmt.Errorf("nonce %q already used", nonce)
+	}
+	if n.used == nil {
+		n.used = make(map[string]time.Time)
+	}
+	n.used[nonce] = deadline
+	return nil
+}
+
+func (w *worker) verifyAuth(data []byte, job *Job, omit ...string) error {
+	if job.Auth == "" {
+		return errors.New("missing auth")
+	}
+	index := strings.Index(job.Auth, ":")
+	if index < 0 {
+		return errors.New("auth should be keyID:signature")
+	}
+	key := w.JobAuth.key(job.Auth[:index])
+	if key == nil {
+		return fmt.Errorf("unknown key %q", job.Auth[:index])
+	}
+	signature, err := base64.StdEncoding.DecodeString(job.Auth[index+1:])
+	if err != nil {
+		return errors.New("invalid signature encoding")
+	}
+	canonical, err := CanonicalJob(data, omit...)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key.key, canonical, signature) {
+		return errors.New("signature mismatch")
+	}
+	if !key.allowTeam(job.Team) {
+		return fmt.Errorf("key %s can not sign jobs of team %q", key.ID, job.Team)
+	}
+	return nil
+}
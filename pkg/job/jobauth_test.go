@@ -0,0 +1,68 @@
+package job
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobAuth(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	config := DefaultConfig()
+	config.JobAuth = JobAuthConfig{Enable: true, OnceTTL: 10 * time.Minute, Keys: []*JobAuthKey{
+		{ID: "ops", PublicKey: base64.StdEncoding.EncodeToString(public), Teams: []string{"ops"}},
+	}}
+	assert.NoError(t, config.JobAuth.Valid())
+	w := &worker{Config: config, store: &replayStore{kvs: make(map[string][]byte)}}
+
+	raw := []byte(`{"id":"backup","script":"/opt/backup.sh","timers":[{"id":"t","timer":"@daily"}],"enable":true,"team":"ops","owner":"alice"}`)
+	signed, err := SignJob(raw, "ops", private)
+	assert.NoError(t, err)
+	job, err := w.GetJobContentFromKv(JobsKeyPrefix+"backup", signed)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", job.Owner)
+
+	// 未签名、签名后被修改、团队不在密钥权限内的任务都被拒绝
+	_, err = w.GetJobContentFromKv(JobsKeyPrefix+"backup", raw)
+	assert.True(t, errors.Is(err, ErrJobUnauthorized))
+
+	tampered, _ := SignJob(raw, "ops", private)
+	tampered = []byte(string(tampered[:len(tampered)-1]) + `,"args":["--all"]}`)
+	_, err = w.GetJobContentFromKv(JobsKeyPrefix+"backup", tampered)
+	assert.True(t, errors.Is(err, ErrJobUnauthorized))
+
+	other, _ := SignJob([]byte(`{"id":"backup","script":"/opt/backup.sh","enable":true,"team":"dev"}`), "ops", private)
+	_, err = w.GetJobContentFromKv(JobsKeyPrefix+"backup", other)
+	assert.True(t, errors.Is(err, ErrJobUnauthorized))
+
+	// 临时任务需要未过期的 expires 及未使用过的 nonce，确认写回后不再校验
+	expires := time.Now().Add(time.Minute).Unix()
+	once, _ := SignJob([]byte(fmt.Sprintf(`{"id":"backup","script":"/opt/backup.sh","team":"ops","expires":%d,"nonce":"n1"}`, expires)), "ops", private)
+	_, err = w.GetOnceJobFromKv(OnceKeyPrefix+"node-1/backup", once)
+	assert.NoError(t, err)
+	_, err = w.GetOnceJobFromKv(OnceKeyPrefix+"node-1/backup", once)
+	assert.True(t, errors.Is(err, ErrJobUnauthorized), "replayed nonce")
+	acked, err := ackPayload(once, newOnceAck("node-1", 7, nil))
+	assert.NoError(t, err)
+	_, err = w.GetOnceJobFromKv(OnceKeyPrefix+"node-1/backup", acked)
+	assert.NoError(t, err)
+
+	// 只带 Params 的临时任务同样需要签名
+	_, err = w.RunOnce([]byte(`{"id":"backup","params":{"dir":"/"}}`), 0)
+	assert.True(t, errors.Is(err, ErrJobUnauthorized))
+
+	expired, _ := SignJob([]byte(fmt.Sprintf(`{"id":"backup","params":{"dir":"/"},"expires":%d,"nonce":"n2"}`, time.Now().Add(-time.Second).Unix())), "ops", private)
+	_, err = w.RunOnce(expired, 0)
+	assert.True(t, errors.Is(err, ErrJobUnauthorized))
+
+	tooLong, _ := SignJob([]byte(fmt.Sprintf(`{"id":"backup","params":{"dir":"/"},"expires":%d,"nonce":"n3"}`, time.Now().Add(time.Hour).Unix())), "ops", private)
+	_, err = w.RunOnce(tooLong, 0)
+	assert.True(t, errors.Is(err, ErrJobUnauthorized))
+}
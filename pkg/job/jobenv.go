@@ -0,0 +1,258 @@
+package job
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+	"golang.org/x/sync/singleflight"
+)
+
+// 任务依赖的运行环境类型
+const (
+	RuntimePython = "python" // 按 requirements 文件创建 virtualenv
+	RuntimeNode   = "node"   // 按 package-lock.json 安装 node_modules
+)
+
+// RuntimeEnv 任务脚本依赖的运行环境，按锁文件的内容缓存在节点上，锁文件不变时复用
+type RuntimeEnv struct {
+	Kind        string `json:"kind"`        // python 或 node
+	Lockfile    string `json:"lockfile"`    // 依赖锁文件的绝对路径，node 环境同目录下需有 package.json
+	Interpreter string `json:"interpreter"` // 创建 virtualenv 的 python，默认为 python3
+}
+
+// 验证 runtime 字段
+func (r *RuntimeEnv) Valid() error {
+	if r.Kind != RuntimePython && r.Kind != RuntimeNode {
+		return fmt.Errorf("invalid job runtime kind: %s", r.Kind)
+	}
+	if !filepath.IsAbs(r.Lockfile) {
+		return errors.New("invalid job runtime, lockfile must be an absolute path")
+	}
+	return nil
+}
+
+// key 锁文件变化后重新创建环境
+func (r *RuntimeEnv) key() (string, error) {
+	files := []string{r.Lockfile}
+	if r.Kind == RuntimeNode {
+		files = append(files, filepath.Join(filepath.Dir(r.Lockfile), "package.json"))
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", r.Kind, r.Interpreter)
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		h.Write(content)
+		h.Write([]byte{0})
+	}
+	return r.Kind + "-" + hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// EnvCacheConfig 任务运行环境的缓存
+type EnvCacheConfig struct {
+	Dir     string        // 缓存目录
+	MaxIdle time.Duration // 超过该时间未使用的环境被删除，为 0 时不删除
+}
+
+// envReadyFile 环境创建完成后写入的标记文件，目录存在而没有标记时说明上次创建被中断
+const envReadyFile = ".juno-ready"
+
+// envCache 创建并缓存任务的运行环境，同一环境并发创建时只创建一次
+type envCache struct {
+	config *EnvCacheConfig
+	group  singleflight.Group
+	logger *xlog.Logger
+
+	mu    sync.Mutex
+	inUse map[string]int // key -> 正在使用该环境的执行数，使用中的环境不会被删除
+
+	// 创建环境，测试时替换
+	build func(ctx context.Context, env *RuntimeEnv, dir string) error
+}
+
+func newEnvCache(config *EnvCacheConfig, logger *xlog.Logger) *envCache {
+	return &envCache{
+		config: config,
+		logger: logger,
+		inUse:  make(map[string]int),
+		build:  buildEnv,
+	}
+}
+
+// prepare 返回运行环境的目录，不存在时创建，执行结束后调用 release。
+// virtualenv 的脚本 shebang 中是创建时的绝对路径，因此直接在最终的目录中创建，
+// 同一环境的创建由 singleflight 串行，完成后写入标记文件，没有标记的目录重新创建
+func (c *envCache) prepare(ctx context.Context, env *RuntimeEnv) (string, func(), error) {
+	key, err := env.key()
+	if err != nil {
+		return "", nil, err
+	}
+	dir := filepath.Join(c.config.Dir, key)
+
+	c.mu.Lock()
+	c.inUse[key]++
+	c.mu.Unlock()
+	release := func() {
+		// 使用结束时更新修改时间，长时间执行的任务结束后不会立即被当作空闲环境删除
+		now := time.Now()
+		_ = os.Chtimes(dir, now, now)
+		c.mu.Lock()
+		if c.inUse[key]--; c.inUse[key] <= 0 {
+			delete(c.inUse, key)
+		}
+		c.mu.Unlock()
+	}
+
+	_, err, _ = c.group.Do(key, func() (interface{}, error) {
+		if _, err := os.Stat(filepath.Join(dir, envReadyFile)); err == nil {
+			now := time.Now()
+			return nil, os.Chtimes(dir, now, now)
+		}
+
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		if err := c.build(ctx, env, dir); err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, envReadyFile), nil, 0644); err != nil {
+			return nil, err
+		}
+		c.logger.Info("job runtime created", xlog.String("kind", env.Kind), xlog.String("dir", dir), xlog.Duration("cost", time.Since(start)))
+
+		c.prune()
+		return nil, nil
+	})
+	if err != nil {
+		release()
+		return "", nil, err
+	}
+	return dir, release, nil
+}
+
+// prune 删除长时间未使用的环境，正在使用及创建中的环境不删除
+func (c *envCache) prune() {
+	if c.config.MaxIdle <= 0 {
+		return
+	}
+	entries, err := ioutil.ReadDir(c.config.Dir)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, entry := range entries {
+		if !entry.IsDir() || time.Since(entry.ModTime()) < c.config.MaxIdle || c.inUse[entry.Name()] > 0 {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(c.config.Dir, entry.Name())); err != nil {
+			c.logger.Warn("remove idle job runtime failed", xlog.String("name", entry.Name()), xlog.FieldErr(err))
+		}
+	}
+}
+
+// runtimeEnv 使用运行环境时主命令的环境变量
+func runtimeEnv(env *RuntimeEnv, dir string) []string {
+	bin := filepath.Join(dir, "bin")
+	vars := []string{"VIRTUAL_ENV=" + dir}
+	if env.Kind == RuntimeNode {
+		bin = filepath.Join(dir, "node_modules", ".bin")
+		vars = []string{"NODE_PATH=" + filepath.Join(dir, "node_modules")}
+	}
+	return append(vars, "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// envCommands 创建运行环境依次执行的命令，命令策略按同样的命令检查
+func envCommands(env *RuntimeEnv, dir string) ([][]string, error) {
+	switch env.Kind {
+	case RuntimePython:
+		interpreter := env.Interpreter
+		if interpreter == "" {
+			interpreter = "python3"
+		}
+		return [][]string{
+			{interpreter, "-m", "venv", dir},
+			{filepath.Join(dir, "bin", "pip"), "install", "--disable-pip-version-check", "-q", "-r", env.Lockfile},
+		}, nil
+	case RuntimeNode:
+		return [][]string{{"npm", "ci", "--no-audit", "--no-fund"}}, nil
+	}
+	return nil, fmt.Errorf("unknown job runtime kind: %s", env.Kind)
+}
+
+func buildEnv(ctx context.Context, env *RuntimeEnv, dir string) error {
+	commands, err := envCommands(env, dir)
+	if err != nil {
+		return err
+	}
+	workDir := ""
+	if env.Kind == RuntimeNode {
+		workDir = dir
+		for _, name := range []string{filepath.Base(env.Lockfile), "package.json"} {
+			content, err := ioutil.ReadFile(filepath.Join(filepath.Dir(env.Lockfile), name))
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	for _, command := range commands {
+		if err := runEnvCommand(ctx, workDir, command[0], command[1:]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allowRuntime 创建运行环境前按命令策略检查创建时执行的命令，环境已存在时同样检查，
+// 避免策略禁止的解释器通过已缓存的环境执行
+func (j *Job) allowRuntime(task *Task) error {
+	key, err := j.Runtime.key()
+	if err != nil {
+		return err
+	}
+	commands, err := envCommands(j.Runtime, filepath.Join(j.envs.config.Dir, key))
+	if err != nil {
+		return err
+	}
+	for _, command := range commands {
+		path := command[0]
+		if resolved, err := lookPath(path); err == nil {
+			path = resolved
+		}
+		if err := j.allowCommand(task, "runtime", path, command[1:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runEnvCommand(ctx context.Context, dir string, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %s: %s: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
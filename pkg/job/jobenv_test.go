@@ -0,0 +1,89 @@
+package job
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobenv")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	lockfile := filepath.Join(dir, "requirements.txt")
+	assert.NoError(t, ioutil.WriteFile(lockfile, []byte("requests==2.25.1\n"), 0644))
+	env := &RuntimeEnv{Kind: RuntimePython, Lockfile: lockfile}
+	assert.NoError(t, env.Valid())
+
+	var builds int32
+	var built string
+	cache := newEnvCache(&EnvCacheConfig{Dir: filepath.Join(dir, "envs"), MaxIdle: time.Hour}, xlog.DefaultLogger)
+	cache.build = func(ctx context.Context, env *RuntimeEnv, dir string) error {
+		atomic.AddInt32(&builds, 1)
+		built = dir
+		time.Sleep(10 * time.Millisecond)
+		return ioutil.WriteFile(filepath.Join(dir, "ok"), nil, 0644)
+	}
+
+	// 并发执行的任务只创建一次
+	var wg sync.WaitGroup
+	dirs := make([]string, 4)
+	for i := range dirs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var release func()
+			dirs[i], release, _ = cache.prepare(context.Background(), env)
+			release()
+		}(i)
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, builds)
+	for _, d := range dirs {
+		assert.Equal(t, dirs[0], d)
+	}
+	// 在最终的目录中创建，virtualenv 脚本的 shebang 指向实际使用的路径
+	assert.Equal(t, dirs[0], built)
+	assert.FileExists(t, filepath.Join(dirs[0], "ok"))
+
+	_, release, err := cache.prepare(context.Background(), env)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, builds)
+
+	// 锁文件变化后重新创建，使用中的旧环境即使长时间未更新也不删除
+	old := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(dirs[0], old, old))
+	assert.NoError(t, ioutil.WriteFile(lockfile, []byte("requests==2.26.0\n"), 0644))
+	newDir, releaseNew, err := cache.prepare(context.Background(), env)
+	assert.NoError(t, err)
+	releaseNew()
+	assert.NotEqual(t, dirs[0], newDir)
+	assert.EqualValues(t, 2, builds)
+	assert.DirExists(t, dirs[0])
+
+	// 不再使用后被删除
+	release()
+	assert.NoError(t, os.Chtimes(dirs[0], old, old))
+	cache.prune()
+	_, err = os.Stat(dirs[0])
+	assert.True(t, os.IsNotExist(err))
+
+	// 创建被中断、没有完成标记的目录重新创建
+	assert.NoError(t, os.Remove(filepath.Join(newDir, envReadyFile)))
+	_, releaseNew, err = cache.prepare(context.Background(), env)
+	assert.NoError(t, err)
+	releaseNew()
+	assert.EqualValues(t, 3, builds)
+
+	assert.Contains(t, runtimeEnv(env, newDir), "VIRTUAL_ENV="+newDir)
+	assert.Error(t, (&RuntimeEnv{Kind: "ruby", Lockfile: lockfile}).Valid())
+}
@@ -0,0 +1,185 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/metric"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// JobErrorKeyPrefix 无法调度的任务定义的错误，key 为 {JobErrorKeyPrefix}{jobId}/{node}，
+// 每个节点只写入、清除自己的 key，任务修正或删除后清除
+const JobErrorKeyPrefix = "/juno/cronjob/errors/jobs/"
+
+// 任务定义出错的阶段
+const (
+	JobErrorParse    = "parse"    // 不是合法的 JSON、字段类型不符或含未知字段
+	JobErrorValidate = "validate" // 字段取值不合法
+	JobErrorAuth     = "auth"     // 签名校验未通过
+)
+
+// 被拒绝的任务定义数
+var jobInvalidCounter = metric.CounterVecOpts{
+	Namespace: "juno",
+	Subsystem: "agent",
+	Name:      "job_invalid_total",
+	Help:      "job definitions rejected when loading from the store",
+	Labels:    []string{"stage"},
+}.Build()
+
+// JobError 写入 JobErrorKeyPrefix 的错误详情，管理端据此展示任务未被调度的原因
+type JobError struct {
+	JobID string `json:"job_id"`
+	Stage string `json:"stage"`
+	Error string `json:"error"`
+	// 出错的字段及 JSON 中的位置，无法定位时为空
+	Field  string `json:"field,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	Node   string `json:"node"`
+	Time   int64  `json:"time"`
+}
+
+// newJobError 按错误类型区分阶段并定位出错的位置
+func newJobError(id string, data []byte, err error) *JobError {
+	jobErr := &JobError{JobID: id, Stage: JobErrorValidate, Error: err.Error()}
+
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.Is(err, ErrJobUnauthorized):
+		jobErr.Stage = JobErrorAuth
+	case errors.As(err, &syntaxErr):
+		jobErr.Stage = JobErrorParse
+		jobErr.Line, jobErr.Column = jsonPosition(data, syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		jobErr.Stage = JobErrorParse
+		jobErr.Field = typeErr.Field
+		jobErr.Line, jobErr.Column = jsonPosition(data, typeErr.Offset)
+	case errors.Is(err, ErrJobTooLarge), errors.Is(err, ErrJSONTooDeep):
+		jobErr.Stage = JobErrorParse
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		jobErr.Stage = JobErrorParse
+		jobErr.Field = strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+	}
+	return jobErr
+}
+
+// jsonPosition offset 所在的行列，从 1 开始
+func jsonPosition(data []byte, offset int64) (int, int) {
+	if offset <= 0 || offset > int64(len(data)) {
+		return 0, 0
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	return line, int(offset) - bytes.LastIndexByte(before, '\n') - 1
+}
+
+// checkUnknownFields 开启 strictJobs 时拒绝含未知字段的任务定义，避免字段名拼写错误被静默忽略
+func checkUnknownFields(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(&Job{})
+}
+
+// jobErrorKey 当前节点写入任务 id 错误的 key
+func (w *worker) jobErrorKey(id string) string {
+	return JobErrorKeyPrefix + id + "/" + w.HostName
+}
+
+// fingerprint 不含时间的错误内容，用于判断同一错误是否已经写入
+func (e *JobError) fingerprint() string {
+	copied := *e
+	copied.Time = 0
+	data, _ := json.Marshal(&copied)
+	return string(data)
+}
+
+// reportJobError 把任务定义的错误写入存储，只有当前节点的日志不便于管理端排查。
+// 与已写入的错误相同时不再写入，任务定义每次加载失败都会调用
+func (w *worker) reportJobError(key string, data []byte, err error) {
+	id := GetIDFromKey(key)
+	jobErr := newJobError(id, data, err)
+	jobErr.Node = w.HostName
+	jobInvalidCounter.Inc(jobErr.Stage)
+
+	fingerprint := jobErr.fingerprint()
+	w.jobErrorMutex.Lock()
+	reported := w.jobErrors[id] == fingerprint
+	w.jobErrorMutex.Unlock()
+	if reported {
+		return
+	}
+
+	jobErr.Time = time.Now().Unix()
+	payload, _ := json.Marshal(jobErr)
+	err = w.etcdRetry("put", w.Etcd.PutTimeout, func(ctx context.Context) error {
+		return w.store.Put(ctx, w.jobErrorKey(id), payload)
+	})
+	if err != nil {
+		w.logger.Warn("put job error failed", fieldJob(id), xlog.FieldErr(err))
+		return
+	}
+
+	w.jobErrorMutex.Lock()
+	if w.jobErrors == nil {
+		w.jobErrors = make(map[string]string)
+	}
+	w.jobErrors[id] = fingerprint
+	w.jobErrorMutex.Unlock()
+}
+
+// clearJobError 任务修正或删除后清除当前节点写入的错误，只处理已知存在错误 key 的任务，避免每次加载都写存储。
+// id 为存储中 key 的最后一段，与写入错误时一致
+func (w *worker) clearJobError(id string) {
+	w.jobErrorMutex.Lock()
+	_, reported := w.jobErrors[id]
+	delete(w.jobErrors, id)
+	w.jobErrorMutex.Unlock()
+	if !reported {
+		return
+	}
+
+	err := w.etcdRetry("delete", w.Etcd.PutTimeout, func(ctx context.Context) error {
+		return w.store.Delete(ctx, w.jobErrorKey(id))
+	})
+	if err != nil {
+		w.logger.Warn("delete job error failed", fieldJob(id), xlog.FieldErr(err))
+	}
+}
+
+// loadJobErrors 启动时读取当前节点已写入的错误 key，之前写入的错误在任务修正后同样能被清除
+func (w *worker) loadJobErrors() {
+	ctx, cancel := NewEtcdTimeoutContext(w)
+	defer cancel()
+
+	kvs, err := w.store.List(ctx, JobErrorKeyPrefix)
+	if err != nil {
+		w.logger.Warn("list job errors failed", xlog.FieldErr(err))
+		return
+	}
+
+	w.jobErrorMutex.Lock()
+	defer w.jobErrorMutex.Unlock()
+	w.jobErrors = make(map[string]string, len(kvs))
+	suffix := "/" + w.HostName
+	for _, kv := range kvs {
+		if !strings.HasSuffix(kv.Key, suffix) {
+			continue
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(kv.Key, JobErrorKeyPrefix), suffix)
+		if id == "" || strings.Contains(id, "/") {
+			continue
+		}
+		jobErr := &JobError{}
+		_ = json.Unmarshal(kv.Value, jobErr)
+		w.jobErrors[id] = jobErr.fingerprint()
+	}
+}
@@ -0,0 +1,77 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportJobError(t *testing.T) {
+	config := DefaultConfig()
+	config.HostName = "node-1"
+	config.logger = xlog.DefaultLogger
+	config.StrictJobs = true
+	store := &replayStore{kvs: make(map[string][]byte)}
+	counting := &countingStore{JobStore: store}
+	w := &worker{Config: config, store: counting}
+
+	read := func(id string) *JobError {
+		kvs, _ := store.List(context.Background(), JobErrorKeyPrefix+id+"/")
+		if len(kvs) == 0 {
+			return nil
+		}
+		assert.Equal(t, JobErrorKeyPrefix+id+"/node-1", kvs[0].Key)
+		jobErr := &JobError{}
+		assert.NoError(t, json.Unmarshal(kvs[0].Value, jobErr))
+		return jobErr
+	}
+
+	_, err := w.GetJobContentFromKv(JobsKeyPrefix+"backup", []byte("{\n\"id\":\"backup\",\n\"timeout\":\"1h\"}"))
+	assert.Error(t, err)
+	jobErr := read("backup")
+	assert.Equal(t, JobErrorParse, jobErr.Stage)
+	assert.Equal(t, "timeout", jobErr.Field)
+	assert.Equal(t, 3, jobErr.Line)
+	assert.Equal(t, "node-1", jobErr.Node)
+
+	_, err = w.GetJobContentFromKv(JobsKeyPrefix+"backup", []byte(`{"id":"backup","script":"/opt/backup.sh","scirpt_args":[]}`))
+	assert.Error(t, err)
+	assert.Equal(t, "scirpt_args", read("backup").Field)
+
+	_, err = w.GetJobContentFromKv(JobsKeyPrefix+"backup", []byte(`{"id":"backup","script":"/opt/backup.sh","timers":[{"id":"1","timer":"bad"}]}`))
+	assert.Error(t, err)
+	assert.Equal(t, JobErrorValidate, read("backup").Stage)
+
+	// 同一错误不重复写入
+	puts := counting.puts
+	_, err = w.GetJobContentFromKv(JobsKeyPrefix+"backup", []byte(`{"id":"backup","script":"/opt/backup.sh","timers":[{"id":"1","timer":"bad"}]}`))
+	assert.Error(t, err)
+	assert.Equal(t, puts, counting.puts)
+
+	// 重启后读取当前节点的错误，其他节点的错误不处理
+	assert.NoError(t, store.Put(context.Background(), JobErrorKeyPrefix+"backup/node-2", []byte(`{}`)))
+	w.jobErrors = nil
+	w.loadJobErrors()
+	assert.Len(t, w.jobErrors, 1)
+
+	// 任务修正后清除错误，key 中的 id 与 json 中的 id 不同时按 key 清除
+	_, err = w.GetJobContentFromKv(JobsKeyPrefix+"backup", []byte(`{"id":"backup-v2","script":"/opt/backup.sh","timers":[{"id":"1","timer":"@daily"}]}`))
+	assert.NoError(t, err)
+	kvs, _ := store.List(context.Background(), JobErrorKeyPrefix+"backup/")
+	assert.Len(t, kvs, 1)
+	assert.Equal(t, JobErrorKeyPrefix+"backup/node-2", kvs[0].Key)
+}
+
+// countingStore 记录写入次数
+type countingStore struct {
+	JobStore
+	puts int
+}
+
+func (s *countingStore) Put(ctx context.Context, key string, value []byte) error {
+	s.puts++
+	return s.JobStore.Put(ctx, key, value)
+}
@@ -0,0 +1,244 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/douyu/jupiter/pkg/metric"
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// 写入 kafka 的任务事件数，status 为 sent、failed、dropped
+var kafkaEventsCounter = metric.CounterVecOpts{
+	Namespace: "juno",
+	Subsystem: "agent",
+	Name:      "kafka_events_total",
+	Help:      "job execution events exported to kafka",
+	Labels:    []string{"status"},
+}.Build()
+
+// KafkaConfig 把任务事件写入 kafka，供下游分析使用，不需要轮询 etcd 或 agent 接口
+type KafkaConfig struct {
+	Brokers       []string      // 为空时不写入
+	Topic         string        // 事件写入的 topic，消息的 key 为任务 id，同一任务的事件落在同一分区
+	Version       string        // kafka 版本，如 2.1.0，为空时使用客户端的默认版本
+	RequiredAcks  int           // 0 不等待确认，1 等待 leader 确认，-1 等待所有副本确认
+	QueueSize     int           // 待写入事件的队列长度，队列满时丢弃新事件
+	FlushMessages int           // 攒够该数量的消息后批量发送
+	FlushInterval time.Duration // 消息最长的攒批时间
+	Retries       int           // 发送失败后的重试次数
+	DialTimeout   time.Duration
+	Backoff       time.Duration // 连接失败后首次重连的间隔，之后每次翻倍
+	MaxBackoff    time.Duration // 重连间隔的上限
+}
+
+func (c *KafkaConfig) normalize() {
+	if c.QueueSize <= 0 {
+		c.QueueSize = 4096
+	}
+	if c.FlushMessages <= 0 {
+		c.FlushMessages = 100
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = time.Second
+	}
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = 5 * time.Second
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = time.Minute
+	}
+	if c.MaxBackoff < c.Backoff {
+		c.MaxBackoff = c.Backoff
+	}
+}
+
+func (c *KafkaConfig) Valid() error {
+	if len(c.Brokers) == 0 {
+		return nil
+	}
+	if c.Topic == "" {
+		return errors.New("kafka topic is required")
+	}
+	if c.Version != "" {
+		if _, err := sarama.ParseKafkaVersion(c.Version); err != nil {
+			return err
+		}
+	}
+	if c.RequiredAcks < -1 || c.RequiredAcks > 1 {
+		return errors.New("kafka requiredAcks should be -1, 0 or 1")
+	}
+	return nil
+}
+
+func (c *KafkaConfig) saramaConfig(clientID string) *sarama.Config {
+	config := sarama.NewConfig()
+	config.ClientID = clientID
+	if c.Version != "" {
+		config.Version, _ = sarama.ParseKafkaVersion(c.Version)
+	}
+	config.Net.DialTimeout = c.DialTimeout
+	config.Producer.RequiredAcks = sarama.RequiredAcks(c.RequiredAcks)
+	config.Producer.Flush.Messages = c.FlushMessages
+	config.Producer.Flush.Frequency = c.FlushInterval
+	config.Producer.Retry.Max = c.Retries
+	config.Producer.Return.Errors = true
+	return config
+}
+
+// kafkaExporter 异步写入任务事件，由 sarama 攒批发送，不阻塞任务执行
+type kafkaExporter struct {
+	topic    string
+	producer sarama.AsyncProducer // 连接建立前为空，只由写入协程访问
+	events   chan *CallbackEvent
+	logger   *xlog.Logger
+	quit     chan struct{}
+}
+
+// newKafkaExporter 未配置 brokers 时返回 nil
+// 连接失败时不影响节点启动，在后台按退避间隔重连，连接建立前的事件在队列中等待
+func newKafkaExporter(config *KafkaConfig, clientID string, logger *xlog.Logger, done <-chan struct{}) *kafkaExporter {
+	if len(config.Brokers) == 0 {
+		return nil
+	}
+
+	connect := func() (sarama.AsyncProducer, error) {
+		return sarama.NewAsyncProducer(config.Brokers, config.saramaConfig(clientID))
+	}
+	return startKafkaExporter(config, connect, logger, done)
+}
+
+func startKafkaExporter(config *KafkaConfig, connect func() (sarama.AsyncProducer, error), logger *xlog.Logger, done <-chan struct{}) *kafkaExporter {
+	e := &kafkaExporter{
+		topic:  config.Topic,
+		events: make(chan *CallbackEvent, config.QueueSize),
+		logger: logger,
+		quit:   make(chan struct{}),
+	}
+	xgo.Go(func() {
+		if !e.connect(config, connect, done) {
+			return
+		}
+		for {
+			select {
+			case event := <-e.events:
+				e.produce(event)
+			case <-done:
+				e.close()
+				return
+			case <-e.quit:
+				for len(e.events) > 0 {
+					e.produce(<-e.events)
+				}
+				e.close()
+				return
+			}
+		}
+	})
+	return e
+}
+
+// connect 建立连接，失败时按退避间隔重试，直到成功或 exporter 停止
+// 停止时未建立连接，队列中的事件记为丢弃
+func (e *kafkaExporter) connect(config *KafkaConfig, connect func() (sarama.AsyncProducer, error), done <-chan struct{}) bool {
+	backoff := config.Backoff
+	for {
+		producer, err := connect()
+		if err == nil {
+			e.producer = producer
+			xgo.Go(func() {
+				for perr := range producer.Errors() {
+					kafkaEventsCounter.Inc("failed")
+					e.logger.Warn("export job event to kafka failed", xlog.Any("key", perr.Msg.Key), xlog.FieldErr(perr.Err))
+				}
+			})
+			return true
+		}
+		e.logger.Error("create kafka producer failed, retry later", xlog.Any("brokers", config.Brokers), xlog.Duration("backoff", backoff), xlog.FieldErr(err))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			e.drop()
+			return false
+		case <-e.quit:
+			timer.Stop()
+			e.drop()
+			return false
+		}
+		if backoff *= 2; backoff > config.MaxBackoff {
+			backoff = config.MaxBackoff
+		}
+	}
+}
+
+// drop 丢弃队列中未写入的事件
+func (e *kafkaExporter) drop() {
+	for len(e.events) > 0 {
+		<-e.events
+		kafkaEventsCounter.Inc("dropped")
+	}
+}
+
+// Stop 配置重新加载后停止旧的 exporter，已入队的事件写入后关闭连接
+func (e *kafkaExporter) Stop() {
+	if e == nil {
+		return
+	}
+	close(e.quit)
+}
+
+// close 等待已提交的消息发送完
+func (e *kafkaExporter) close() {
+	if err := e.producer.Close(); err != nil {
+		e.logger.Warn("close kafka producer failed", xlog.FieldErr(err))
+	}
+}
+
+// Send 加入写入队列
+func (e *kafkaExporter) Send(event *CallbackEvent) {
+	if e == nil {
+		return
+	}
+
+	select {
+	case e.events <- event:
+	default:
+		kafkaEventsCounter.Inc("dropped")
+		e.logger.Warn("kafka queue is full, drop event", xlog.String("event", event.Event), fieldJob(event.JobID))
+	}
+}
+
+func (e *kafkaExporter) produce(event *CallbackEvent) {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	e.producer.Input() <- &sarama.ProducerMessage{
+		Topic:     e.topic,
+		Key:       sarama.StringEncoder(event.JobID),
+		Value:     sarama.ByteEncoder(value),
+		Timestamp: event.Time,
+	}
+	kafkaEventsCounter.Inc("sent")
+}
+
+// emit 推送任务事件给管理端并写入 kafka
+func (w *worker) emit(event *CallbackEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	w.reloadMutex.RLock()
+	callback, kafka := w.callback, w.kafka
+	w.reloadMutex.RUnlock()
+	callback.Send(event)
+	kafka.Send(event)
+}
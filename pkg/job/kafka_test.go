@@ -0,0 +1,91 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKafkaExporter(t *testing.T) {
+	config := DefaultConfig().Kafka
+	config.Brokers = []string{"127.0.0.1:9092"}
+	config.Topic = "events"
+	assert.NoError(t, config.Valid())
+
+	producer := mocks.NewAsyncProducer(t, sarama.NewConfig())
+	events := make(chan *CallbackEvent, 1)
+	producer.ExpectInputWithCheckerFunctionAndSucceed(func(value []byte) error {
+		event := &CallbackEvent{}
+		err := json.Unmarshal(value, event)
+		events <- event
+		return err
+	})
+
+	done := make(chan struct{})
+	w := &worker{Config: DefaultConfig()}
+	w.kafka = startKafkaExporter(&config, func() (sarama.AsyncProducer, error) { return producer, nil }, xlog.DefaultLogger, done)
+	w.emit(&CallbackEvent{Event: CallbackSuccess, JobID: "a", TaskID: 1})
+
+	event := <-events
+	assert.Equal(t, CallbackSuccess, event.Event)
+	assert.Equal(t, "a", event.JobID)
+	assert.False(t, event.Time.IsZero())
+	close(done)
+}
+
+func TestKafkaExporterReconnect(t *testing.T) {
+	config := DefaultConfig().Kafka
+	config.Brokers = []string{"127.0.0.1:9092"}
+	config.Topic = "events"
+	config.Backoff = 10 * time.Millisecond
+	config.normalize()
+
+	producer := mocks.NewAsyncProducer(t, sarama.NewConfig())
+	events := make(chan *CallbackEvent, 1)
+	producer.ExpectInputWithCheckerFunctionAndSucceed(func(value []byte) error {
+		event := &CallbackEvent{}
+		err := json.Unmarshal(value, event)
+		events <- event
+		return err
+	})
+
+	// broker 不可用时节点照常启动，事件在连接建立后写入
+	attempts := 0
+	connect := func() (sarama.AsyncProducer, error) {
+		if attempts++; attempts < 3 {
+			return nil, errors.New("kafka: client has run out of available brokers")
+		}
+		return producer, nil
+	}
+	done := make(chan struct{})
+	e := startKafkaExporter(&config, connect, xlog.DefaultLogger, done)
+	assert.NotNil(t, e)
+	e.Send(&CallbackEvent{Event: CallbackFailure, JobID: "a", TaskID: 1, Time: time.Now()})
+
+	select {
+	case event := <-events:
+		assert.Equal(t, "a", event.JobID)
+	case <-time.After(time.Second):
+		t.Fatal("event not exported after reconnect")
+	}
+	assert.Equal(t, 3, attempts)
+	close(done)
+}
+
+func TestKafkaConfigValid(t *testing.T) {
+	config := KafkaConfig{}
+	assert.NoError(t, config.Valid(), "disabled")
+
+	config.Brokers = []string{"127.0.0.1:9092"}
+	assert.Error(t, config.Valid(), "topic is required")
+
+	config.Topic = "events"
+	config.Version = "x"
+	assert.Error(t, config.Valid())
+}
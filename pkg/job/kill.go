@@ -0,0 +1,79 @@
+package job
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/douyu/juno-agent/pkg/audit"
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// KillKeyPrefix 强杀指定的执行，key 为 {KillKeyPrefix}{hostname}/{taskId}，值不使用，处理后删除
+const KillKeyPrefix = "/juno/cronjob/kill/"
+
+// KillTaskKey 强杀节点上 task 的 key
+func KillTaskKey(hostname string, taskID uint64) string {
+	return KillKeyPrefix + hostname + "/" + strconv.FormatUint(taskID, 10)
+}
+
+// killTask 强杀进程组，jobID 为空时按 task id 查找，返回 task 所属的任务
+func (w *worker) killTask(jobID string, taskID uint64) (string, error) {
+	w.runsMutex.Lock()
+	var kill context.CancelFunc
+	if jobID != "" {
+		kill = w.runningJobs[jobID][taskID]
+	} else {
+		for id, tasks := range w.runningJobs {
+			if kill = tasks[taskID]; kill != nil {
+				jobID = id
+				break
+			}
+		}
+	}
+	w.runsMutex.Unlock()
+
+	if kill == nil {
+		return "", ErrTaskNotRunning
+	}
+	kill()
+	return jobID, nil
+}
+
+// watchKills 监听写入当前节点的强杀 key，不依赖修改 proc key 触发的 watch
+func (w *worker) watchKills() {
+	prefix := KillKeyPrefix + w.HostName + "/"
+	_, events := w.watchPrefix(prefix)
+
+	xgo.Go(func() {
+		for event := range events {
+			if !event.IsCreate() {
+				continue
+			}
+
+			taskID, err := strconv.ParseUint(strings.TrimPrefix(event.Key, prefix), 10, 64)
+			if err != nil {
+				w.logger.Warn("invalid kill key", xlog.String("key", event.Key))
+			} else if jobID, err := w.killTask("", taskID); err != nil {
+				w.logger.Warn("kill task failed", fieldTask(taskID), xlog.FieldErr(err))
+			} else {
+				w.logger.Info("task killed by kill key", fieldJob(jobID), fieldTask(taskID))
+				w.Audit.Record(audit.Entry{
+					Action: audit.ActionKill,
+					Source: audit.SourceEtcd,
+					Node:   w.ID,
+					JobID:  jobID,
+					TaskID: taskID,
+					Key:    event.Key,
+				})
+			}
+
+			ctx, cancel := NewEtcdTimeoutContext(w)
+			if err := w.store.Delete(ctx, event.Key); err != nil {
+				w.logger.Warn("delete kill key failed", xlog.String("key", event.Key), xlog.FieldErr(err))
+			}
+			cancel()
+		}
+	})
+}
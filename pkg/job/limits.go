@@ -0,0 +1,70 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Rlimits 任务进程的资源限制，为空的项继承 agent 的限制
+type Rlimits struct {
+	NoFile *uint64 `json:"nofile"` // 打开的文件数
+	NProc  *uint64 `json:"nproc"`  // 用户的进程数
+	Core   *uint64 `json:"core"`   // core 文件大小，单位字节，0 为不生成 core 文件
+}
+
+// validExecAttr 检查工作目录、umask 及资源限制
+func (j *Job) validExecAttr() error {
+	if j.WorkDir != "" && !filepath.IsAbs(j.WorkDir) {
+		return errors.New("invalid work_dir, should be an absolute path")
+	}
+	if j.Umask != "" {
+		if err := validUmask(j.Umask); err != nil {
+			return err
+		}
+	}
+	if shellPath == "" && (j.Umask != "" || j.Rlimits != nil) {
+		return errors.New("umask and rlimits are not supported on current platform")
+	}
+	return nil
+}
+
+// validUmask umask 为八进制字符串，如 022
+func validUmask(umask string) error {
+	if mask, err := strconv.ParseUint(umask, 8, 32); err != nil || mask > 0777 {
+		return fmt.Errorf("invalid umask %q, should be octal like 022", umask)
+	}
+	return nil
+}
+
+// limitCommand 设置了 umask 或资源限制时通过 sh 设置后再 exec 任务命令，进程号不变
+// umask 及 rlimit 只能在子进程中设置，直接修改 agent 的会影响同时启动的其他任务
+func (j *Job) limitCommand(script string, args []string) (string, []string) {
+	if j.Umask == "" && j.Rlimits == nil {
+		return script, args
+	}
+
+	steps := []string{"set -e"}
+	if j.Umask != "" {
+		steps = append(steps, "umask "+j.Umask)
+	}
+	if r := j.Rlimits; r != nil {
+		if r.NoFile != nil {
+			steps = append(steps, "ulimit -n "+strconv.FormatUint(*r.NoFile, 10))
+		}
+		if r.NProc != nil {
+			// bash 使用 -u，dash 使用 -p
+			n := strconv.FormatUint(*r.NProc, 10)
+			steps = append(steps, "{ ulimit -u "+n+" 2>/dev/null || ulimit -p "+n+"; }")
+		}
+		if r.Core != nil {
+			// ulimit -c 的单位为 512 字节的块
+			steps = append(steps, "ulimit -c "+strconv.FormatUint((*r.Core+511)/512, 10))
+		}
+	}
+	steps = append(steps, `exec "$0" "$@"`)
+
+	return shellPath, append([]string{"-c", strings.Join(steps, "; "), script}, args...)
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package job
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitCommand(t *testing.T) {
+	job := &Job{}
+	script, args := job.limitCommand("/bin/echo", []string{"a"})
+	assert.Equal(t, "/bin/echo", script)
+	assert.Equal(t, []string{"a"}, args)
+
+	nofile, core := uint64(256), uint64(0)
+	job = &Job{Umask: "027", Rlimits: &Rlimits{NoFile: &nofile, Core: &core}}
+	assert.NoError(t, job.validExecAttr())
+
+	script, args = job.limitCommand("/bin/sh", []string{"-c", "umask; ulimit -n; ulimit -c"})
+	out, err := exec.Command(script, args...).CombinedOutput()
+	assert.NoError(t, err, string(out))
+	assert.Equal(t, []string{"0027", "256", "0"}, strings.Fields(string(out)))
+
+	assert.Error(t, (&Job{Umask: "999"}).validExecAttr())
+	assert.Error(t, (&Job{WorkDir: "data"}).validExecAttr())
+}
@@ -0,0 +1,243 @@
+package job
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 检查结果的严重程度，error 的任务不应写入存储
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// args 不经过 shell，其中的环境变量引用不会被展开
+var envRefRegexp = regexp.MustCompile(`\$\{?[A-Za-z_][A-Za-z0-9_]*\}?`)
+
+// LintPolicy 任务定义需要满足的约束，为零值时不检查
+type LintPolicy struct {
+	MaxTimeout     int64         // 允许的最大超时时间，单位秒
+	RequireTimeout bool          // 必须设置超时时间
+	MinInterval    time.Duration // 相邻两次触发的最小间隔，节点的 minTimerInterval 更大时使用节点的
+	ScriptDirs     []string      // 脚本必须位于这些目录下
+}
+
+// LintProblem 任务定义中的一个问题
+type LintProblem struct {
+	Field    string `json:"field"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+type linter struct {
+	problems []*LintProblem
+}
+
+func (l *linter) add(severity, field, format string, args ...interface{}) {
+	l.problems = append(l.problems, &LintProblem{Field: field, Severity: severity, Message: fmt.Sprintf(format, args...)})
+}
+
+// Lint 检查任务定义，一次返回所有问题，不修改任务
+func Lint(job *Job, policy *LintPolicy) []*LintProblem {
+	l := &linter{problems: make([]*LintProblem, 0)}
+
+	if job.ID == "" {
+		l.add(LintError, "id", "id is required")
+	} else if strings.Contains(job.ID, "/") {
+		l.add(LintError, "id", "id must not contain '/'")
+	}
+
+	l.lintCommand(job, policy)
+	l.lintTimers(job, policy)
+
+	switch {
+	case job.Timeout < 0:
+		l.add(LintError, "timeout", "timeout must not be negative")
+	case job.Timeout == 0 && policy.RequireTimeout:
+		l.add(LintError, "timeout", "timeout is required by policy")
+	case job.Timeout == 0:
+		l.add(LintWarning, "timeout", "no timeout, a hung process runs forever")
+	case policy.MaxTimeout > 0 && job.Timeout > policy.MaxTimeout:
+		l.add(LintError, "timeout", "timeout %ds exceeds the maximum %ds allowed by policy", job.Timeout, policy.MaxTimeout)
+	}
+
+	if job.RetryCount < 0 {
+		l.add(LintError, "retry_count", "retry_count must not be negative")
+	}
+	if job.RetryInterval < 0 {
+		l.add(LintWarning, "retry_interval", "negative retry_interval retries immediately")
+	}
+	if job.JobType != TypeNormal && job.JobType != TypeAlone {
+		l.add(LintError, "job_type", "unknown job_type %d", job.JobType)
+	}
+
+	for key, value := range job.Selector {
+		if key == "" || value == "" {
+			l.add(LintError, "selector", "selector keys and values must not be empty")
+			break
+		}
+	}
+	if len(job.Selector) > 0 && len(job.Nodes) > 0 {
+		l.add(LintWarning, "nodes", "nodes are ignored when selector is set")
+	}
+
+	if job.Shards < 0 {
+		l.add(LintError, "shards", "shards must not be negative")
+	} else if job.Shards > 0 && job.NodeGroup == "" {
+		l.add(LintWarning, "node_group", "shards require node_group, job runs unsharded")
+	}
+
+	for i, e := range job.Extracts {
+		if err := e.Valid(); err != nil {
+			l.add(LintError, fmt.Sprintf("extracts[%d]", i), "%s", err)
+		}
+	}
+	if job.Success != nil {
+		if err := job.Success.Valid(); err != nil {
+			l.add(LintError, "success", "%s", err)
+		}
+	}
+	if job.Hooks != nil {
+		if err := job.Hooks.Valid(); err != nil {
+			l.add(LintError, "hooks", "%s", err)
+		}
+	}
+	if job.Runtime != nil {
+		if err := job.Runtime.Valid(); err != nil {
+			l.add(LintError, "runtime", "%s", err)
+		}
+	}
+	if job.LogParser != nil {
+		if err := job.LogParser.Valid(); err != nil {
+			l.add(LintError, "log_parser", "%s", err)
+		}
+	}
+	if job.Trigger != nil {
+		if err := job.Trigger.Valid(); err != nil {
+			l.add(LintError, "trigger", "%s", err)
+		}
+	}
+	if err := job.validExecAttr(); err != nil {
+		l.add(LintError, "exec", "%s", err)
+	}
+	if job.Reduce != nil {
+		if err := job.Reduce.Valid(); err != nil {
+			l.add(LintError, "reduce", "%s", err)
+		} else if !job.IsSharded() {
+			l.add(LintWarning, "reduce", "reducer only runs for sharded jobs")
+		}
+	}
+	return l.problems
+}
+
+func (l *linter) lintCommand(job *Job, policy *LintPolicy) {
+	if err := job.validExecMode(); err != nil {
+		l.add(LintError, "exec_mode", "%s", err)
+		return
+	}
+	if job.ExecMode == ExecModeArgv && len(job.Command) > 0 {
+		if _, err := job.argv(); err != nil {
+			l.add(LintError, "command", "%s", err)
+		}
+		return
+	}
+	if err := job.validIntegrity(); err != nil {
+		l.add(LintError, "artifact", "%s", err)
+		return
+	}
+	if job.Script == "" {
+		// 未指定脚本时执行下载的制品
+		if job.Artifact == nil {
+			l.add(LintError, "script", "script is required")
+		}
+		return
+	}
+	switch job.ExecMode {
+	case ExecModeShell:
+		params, err := quoteParams(job.Params)
+		if err != nil {
+			l.add(LintError, "params", "%s", err)
+			return
+		}
+		if _, err := renderParams(job.Script, params); err != nil {
+			l.add(LintError, "script", "render script: %s", err)
+		}
+		return
+	case ExecModeArgv:
+		if _, err := job.argv(); err != nil {
+			l.add(LintError, "script", "%s", err)
+		}
+		return
+	}
+
+	script := job.Script
+	if err := literalProgram(script); err != nil {
+		l.add(LintError, "script", "%s", err)
+		return
+	}
+	if !filepath.IsAbs(script) {
+		l.add(LintWarning, "script", "script %q is not an absolute path", script)
+	} else if len(policy.ScriptDirs) > 0 && !inDirs(script, policy.ScriptDirs) {
+		l.add(LintError, "script", "script %q is not under %s allowed by policy", script, strings.Join(policy.ScriptDirs, ", "))
+	}
+
+	for i, arg := range job.Args {
+		if _, err := renderParams(arg, job.Params); err != nil {
+			l.add(LintError, fmt.Sprintf("args[%d]", i), "render args: %s", err)
+		}
+		if ref := envRefRegexp.FindString(arg); ref != "" {
+			l.add(LintWarning, fmt.Sprintf("args[%d]", i), "%s is passed literally, args are not expanded by a shell", ref)
+		}
+	}
+}
+
+func (l *linter) lintTimers(job *Job, policy *LintPolicy) {
+	if job.Trigger == nil {
+		if len(job.Timers) == 0 {
+			l.add(LintWarning, "timers", "no timers, job only runs when triggered")
+		} else if allTimersDisabled(job.Timers) {
+			l.add(LintWarning, "timers", "all timers are disabled, job only runs when triggered")
+		}
+	}
+
+	for i, timer := range job.Timers {
+		field := fmt.Sprintf("timers[%d]", i)
+		if timer.Cron == "" {
+			l.add(LintError, field, "timer is required")
+			continue
+		}
+		schedule, err := myParser.Parse(timer.Cron)
+		if err != nil {
+			l.add(LintError, field, "invalid timer %q: %s", timer.Cron, err)
+			continue
+		}
+		if policy.MinInterval <= 0 {
+			continue
+		}
+		if interval := timerInterval(schedule, time.Now()); interval > 0 && interval < policy.MinInterval {
+			l.add(LintError, field, "timer %q fires every %s, less than %s allowed by policy", timer.Cron, interval, policy.MinInterval)
+		}
+	}
+}
+
+func inDirs(path string, dirs []string) bool {
+	path = filepath.Clean(path)
+	for _, dir := range dirs {
+		if rel, err := filepath.Rel(filepath.Clean(dir), path); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
+
+func allTimersDisabled(timers []*Timer) bool {
+	for _, timer := range timers {
+		if !timer.Disabled {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLint(t *testing.T) {
+	job := &Job{
+		ID:      "backup",
+		Script:  "/opt/scripts/backup.sh",
+		Args:    []string{"--home", "$HOME"},
+		Timers:  []*Timer{{Cron: "*/10 * * * * *"}, {Cron: "bad"}},
+		Timeout: 7200,
+		Params:  map[string]string{"name": "backup"},
+		Shards:  2,
+	}
+	policy := &LintPolicy{MaxTimeout: 3600, MinInterval: time.Minute, ScriptDirs: []string{"/opt/scripts"}}
+
+	problems := Lint(job, policy)
+	fields := make(map[string]string)
+	for _, problem := range problems {
+		fields[problem.Field] = problem.Severity
+	}
+	assert.Equal(t, map[string]string{
+		"args[1]":    LintWarning,
+		"timers[0]":  LintError,
+		"timers[1]":  LintError,
+		"timeout":    LintError,
+		"node_group": LintWarning,
+	}, fields)
+	// 只检查，不修改任务
+	assert.Nil(t, job.Timers[0].Schedule)
+
+	job.Script = "/usr/local/bin/{{.missing}}"
+	problems = Lint(job, &LintPolicy{})
+	assert.Equal(t, "script", problems[0].Field)
+	assert.Equal(t, LintError, problems[0].Severity)
+
+	assert.Len(t, Lint(&Job{ID: "a", Script: "/opt/scripts/a", Timers: []*Timer{{Cron: "@hourly"}}, Timeout: 60}, policy), 0)
+}
@@ -0,0 +1,14 @@
+package job
+
+import (
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// 日志中任务相关的字段，节点名由 worker 的 logger 统一带上
+func fieldJob(id string) xlog.Field {
+	return xlog.String("job_id", id)
+}
+
+func fieldTask(id uint64) xlog.Field {
+	return xlog.Any("task_id", id)
+}
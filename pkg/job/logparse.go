@@ -0,0 +1,273 @@
+package job
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/metric"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// 输出的解析格式
+const (
+	LogFormatJSON   = "json"   // 每行一个 json 对象
+	LogFormatRegexp = "regexp" // 按正则的命名分组解析
+)
+
+// 单行输出的最大长度，超出部分丢弃
+const maxLogLine = 64 << 10
+
+// 事件的级别，由低到高
+var logLevels = map[string]int{
+	"debug": 0,
+	"info":  1,
+	"warn":  2,
+	"error": 3,
+	"fatal": 4,
+}
+
+// 解析出的事件数，可以按 level 配置告警
+var jobLogEventsCounter = metric.CounterVecOpts{
+	Namespace: "juno",
+	Subsystem: "agent",
+	Name:      "job_log_events_total",
+	Help:      "structured events parsed from job output",
+	Labels:    []string{"job", "level"},
+}.Build()
+
+// LogParser 逐行解析任务输出，解析出的事件写入 agent 日志随日志采集上报，
+// 不低于 AlertLevel 的事件推送给管理端，无法解析的行不产生事件
+type LogParser struct {
+	Format       string `json:"format"`        // json 或 regexp
+	Regexp       string `json:"regexp"`        // 命名分组 level、message 为级别及内容，其他分组作为字段
+	LevelField   string `json:"level_field"`   // json 中级别的字段名，默认为 level
+	MessageField string `json:"message_field"` // json 中内容的字段名，默认为 msg
+	AlertLevel   string `json:"alert_level"`   // 为空时不推送
+
+	re *regexp.Regexp
+}
+
+// LogEvent 从一行输出中解析出的事件
+type LogEvent struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// 验证 log_parser 字段
+func (p *LogParser) Valid() error {
+	switch p.Format {
+	case LogFormatJSON:
+	case LogFormatRegexp:
+		re, err := regexp.Compile(p.Regexp)
+		if err != nil {
+			return fmt.Errorf("invalid log_parser regexp, parse err: %s", err.Error())
+		}
+		hasMessage := false
+		for _, name := range re.SubexpNames() {
+			hasMessage = hasMessage || name == "message"
+		}
+		if !hasMessage {
+			return errors.New("log_parser regexp requires a message group")
+		}
+		p.re = re
+	default:
+		return fmt.Errorf("invalid log_parser format: %s", p.Format)
+	}
+	if _, ok := logLevels[p.AlertLevel]; p.AlertLevel != "" && !ok {
+		return fmt.Errorf("invalid log_parser alert_level: %s", p.AlertLevel)
+	}
+	return nil
+}
+
+// Parse 解析一行输出，无法解析时返回 false
+func (p *LogParser) Parse(line string) (*LogEvent, bool) {
+	event := &LogEvent{Time: time.Now(), Fields: make(map[string]string)}
+	switch p.Format {
+	case LogFormatJSON:
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			return nil, false
+		}
+		levelField, messageField := p.LevelField, p.MessageField
+		if levelField == "" {
+			levelField = "level"
+		}
+		if messageField == "" {
+			messageField = "msg"
+		}
+		for key, value := range fields {
+			text, ok := value.(string)
+			if !ok {
+				data, _ := json.Marshal(value)
+				text = string(data)
+			}
+			switch key {
+			case levelField:
+				event.Level = text
+			case messageField:
+				event.Message = text
+			default:
+				event.Fields[key] = text
+			}
+		}
+	case LogFormatRegexp:
+		if p.re == nil {
+			return nil, false
+		}
+		match := p.re.FindStringSubmatch(line)
+		if match == nil {
+			return nil, false
+		}
+		for i, name := range p.re.SubexpNames() {
+			switch name {
+			case "":
+			case "level":
+				event.Level = match[i]
+			case "message":
+				event.Message = match[i]
+			default:
+				event.Fields[name] = match[i]
+			}
+		}
+	default:
+		return nil, false
+	}
+	event.Level = normalizeLevel(event.Level)
+	return event, true
+}
+
+// alert 事件是否需要推送
+func (p *LogParser) alert(event *LogEvent) bool {
+	return p.AlertLevel != "" && logLevels[event.Level] >= logLevels[p.AlertLevel]
+}
+
+func normalizeLevel(level string) string {
+	level = strings.ToLower(level)
+	switch level {
+	case "warning":
+		return "warn"
+	case "err":
+		return "error"
+	case "critical", "panic":
+		return "fatal"
+	}
+	if _, ok := logLevels[level]; ok {
+		return level
+	}
+	return "info"
+}
+
+// logEventWriter 按行切分任务输出，投递原始的行并把解析出的事件交给 emit，Close 时处理最后不完整的一行
+type logEventWriter struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	parser *LogParser
+	emit   func(event *LogEvent)
+	ship   func(line string) // 投递到 loki、elasticsearch，为空时不投递
+}
+
+func (w *logEventWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for data := p; len(data) > 0; {
+		index := bytes.IndexByte(data, '\n')
+		if index < 0 {
+			w.append(data)
+			break
+		}
+		w.append(data[:index])
+		w.flush()
+		data = data[index+1:]
+	}
+	return len(p), nil
+}
+
+// append 超长的行截断，丢弃到下一个换行符
+func (w *logEventWriter) append(data []byte) {
+	if w.buf.Len()+len(data) > maxLogLine {
+		data = data[:maxLogLine-w.buf.Len()]
+	}
+	w.buf.Write(data)
+}
+
+func (w *logEventWriter) flush() {
+	line := strings.TrimRight(w.buf.String(), "\r")
+	w.buf.Reset()
+	if line == "" {
+		return
+	}
+	if w.ship != nil {
+		w.ship(line)
+	}
+	if w.parser == nil {
+		return
+	}
+	if event, ok := w.parser.Parse(line); ok {
+		w.emit(event)
+	}
+}
+
+func (w *logEventWriter) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flush()
+	return nil
+}
+
+// logEvents 返回解析及投递任务输出的 writer，任务未配置解析且不投递输出时返回 nil
+func (j *Job) logEvents(task *Task) *logEventWriter {
+	ship := j.shipLogs()
+	if j.LogParser == nil && !ship {
+		return nil
+	}
+
+	w := &logEventWriter{}
+	if ship {
+		w.ship = func(line string) {
+			j.shipper.Ship(&LogLine{
+				Time:    time.Now(),
+				JobID:   j.ID,
+				JobName: j.Name,
+				TaskID:  task.TaskID,
+				Node:    j.HostName,
+				Line:    line,
+			})
+		}
+	}
+	if j.LogParser == nil {
+		return w
+	}
+	w.parser = j.LogParser
+	w.emit = func(event *LogEvent) {
+		jobLogEventsCounter.Inc(j.ID, event.Level)
+
+		fields := []xlog.Field{fieldJob(j.ID), fieldTask(task.TaskID), xlog.String("level", event.Level)}
+		for key, value := range event.Fields {
+			fields = append(fields, xlog.String(key, value))
+		}
+		j.logger.Info(event.Message, fields...)
+
+		if j.LogParser.alert(event) {
+			j.emit(&CallbackEvent{
+				Event:  CallbackLog,
+				JobID:  j.ID,
+				TaskID: task.TaskID,
+				Node:   j.HostName,
+				Log:    event,
+			})
+		}
+	}
+	return w
+}
@@ -0,0 +1,41 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogParser(t *testing.T) {
+	parser := &LogParser{Format: LogFormatJSON, AlertLevel: "error"}
+	assert.NoError(t, parser.Valid())
+	event, ok := parser.Parse(`{"level":"ERROR","msg":"disk full","free":0,"mount":"/data"}`)
+	assert.True(t, ok)
+	assert.Equal(t, "error", event.Level)
+	assert.Equal(t, "disk full", event.Message)
+	assert.Equal(t, map[string]string{"free": "0", "mount": "/data"}, event.Fields)
+	assert.True(t, parser.alert(event))
+	_, ok = parser.Parse("plain text")
+	assert.False(t, ok)
+
+	parser = &LogParser{Format: LogFormatRegexp, Regexp: `^\[(?P<level>\w+)\] (?P<table>\w+): (?P<message>.*)$`}
+	assert.NoError(t, parser.Valid())
+	var events []*LogEvent
+	w := &logEventWriter{parser: parser, emit: func(event *LogEvent) {
+		events = append(events, event)
+	}}
+	// 一行可能分多次写入，最后一行没有换行符
+	_, _ = w.Write([]byte("[warning] users: 3 rows skipped\n[info] ord"))
+	_, _ = w.Write([]byte("ers: done\r\nnot matched\n[debug] items: fin"))
+	assert.Len(t, events, 2)
+	assert.NoError(t, w.Close())
+	assert.Len(t, events, 3)
+	assert.Equal(t, "warn", events[0].Level)
+	assert.Equal(t, "users", events[0].Fields["table"])
+	assert.Equal(t, "done", events[1].Message)
+	assert.Equal(t, "fin", events[2].Message)
+	assert.False(t, parser.alert(events[0]))
+
+	assert.Error(t, (&LogParser{Format: LogFormatRegexp, Regexp: `(?P<level>\w+)`}).Valid())
+	assert.Error(t, (&LogParser{Format: "xml"}).Valid())
+}
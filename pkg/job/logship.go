@@ -0,0 +1,301 @@
+package job
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/metric"
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/go-resty/resty/v2"
+)
+
+// 任务输出投递的后端
+const (
+	LogShipLoki          = "loki"
+	LogShipElasticsearch = "elasticsearch"
+)
+
+// 投递的输出行数，status 为 sent、failed、dropped
+var logShipCounter = metric.CounterVecOpts{
+	Namespace: "juno",
+	Subsystem: "agent",
+	Name:      "job_log_lines_shipped_total",
+	Help:      "job output lines shipped to loki or elasticsearch",
+	Labels:    []string{"backend", "status"},
+}.Build()
+
+// LogShipConfig 把任务输出按行投递到 loki 或 elasticsearch，与应用日志放在一起查询
+type LogShipConfig struct {
+	Backend   string            // loki 或 elasticsearch，为空时不投递
+	Addr      string            // 如 http://loki:3100、http://es:9200
+	Index     string            // elasticsearch 的索引，支持时间格式，如 juno-jobs-2006.01.02
+	TenantID  string            // loki 多租户的 X-Scope-OrgID
+	Username  string            // basic 认证
+	Password  string            //
+	Labels    map[string]string // 附加的固定标签，如 env、idc
+	AllJobs   bool              // 为 true 时投递所有任务的输出，否则只投递 ship_logs 为 true 的任务
+	BatchSize int               // 攒够该行数后发送
+	BatchWait time.Duration     // 最长的攒批时间
+	Timeout   time.Duration     // 单次请求超时
+	Retries   int               // 失败后的重试次数
+	Backoff   time.Duration     // 首次重试的等待时间，之后每次翻倍
+	QueueSize int               // 待发送行的队列长度，队列满时丢弃新行
+}
+
+func (c *LogShipConfig) normalize() {
+	if c.BatchSize <= 0 {
+		c.BatchSize = 500
+	}
+	if c.BatchWait <= 0 {
+		c.BatchWait = time.Second
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = time.Second
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = 10000
+	}
+	if c.Index == "" {
+		c.Index = "juno-jobs-2006.01.02"
+	}
+}
+
+func (c *LogShipConfig) Valid() error {
+	switch c.Backend {
+	case "":
+		return nil
+	case LogShipLoki, LogShipElasticsearch:
+	default:
+		return fmt.Errorf("unknown log ship backend %q, should be loki or elasticsearch", c.Backend)
+	}
+	if c.Addr == "" {
+		return errors.New("log ship addr is required")
+	}
+	return nil
+}
+
+// LogLine 任务输出的一行
+type LogLine struct {
+	Time    time.Time
+	JobID   string
+	JobName string
+	TaskID  uint64
+	Node    string
+	Line    string
+}
+
+// logShipper 异步批量投递任务输出，失败时按退避重试，不阻塞任务执行
+type logShipper struct {
+	config *LogShipConfig
+	client *resty.Client
+	lines  chan *LogLine
+	logger *xlog.Logger
+}
+
+// newLogShipper 未配置后端时返回 nil
+func newLogShipper(config *LogShipConfig, logger *xlog.Logger, done <-chan struct{}) *logShipper {
+	if config.Backend == "" {
+		return nil
+	}
+
+	client := resty.New().SetTimeout(config.Timeout)
+	if config.Username != "" {
+		client.SetBasicAuth(config.Username, config.Password)
+	}
+	if config.TenantID != "" {
+		client.SetHeader("X-Scope-OrgID", config.TenantID)
+	}
+	s := &logShipper{
+		config: config,
+		client: client,
+		lines:  make(chan *LogLine, config.QueueSize),
+		logger: logger,
+	}
+	xgo.Go(func() {
+		s.run(done)
+	})
+	return s
+}
+
+// Ship 加入投递队列
+func (s *logShipper) Ship(line *LogLine) {
+	select {
+	case s.lines <- line:
+	default:
+		logShipCounter.Inc(s.config.Backend, "dropped")
+	}
+}
+
+// run 攒批发送，worker 停止时发送队列中剩余的行
+func (s *logShipper) run(done <-chan struct{}) {
+	batch := make([]*LogLine, 0, s.config.BatchSize)
+	ticker := time.NewTicker(s.config.BatchWait)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) > 0 {
+			s.send(batch)
+			batch = make([]*LogLine, 0, s.config.BatchSize)
+		}
+	}
+	for {
+		select {
+		case line := <-s.lines:
+			if batch = append(batch, line); len(batch) >= s.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-done:
+			for {
+				select {
+				case line := <-s.lines:
+					batch = append(batch, line)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *logShipper) send(batch []*LogLine) {
+	var err error
+	backoff := s.config.Backoff
+	for attempt := 0; ; attempt++ {
+		if s.config.Backend == LogShipLoki {
+			err = s.pushLoki(batch)
+		} else {
+			err = s.bulkElasticsearch(batch)
+		}
+		if err == nil {
+			logShipCounter.Add(float64(len(batch)), s.config.Backend, "sent")
+			return
+		}
+		if attempt >= s.config.Retries {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	logShipCounter.Add(float64(len(batch)), s.config.Backend, "failed")
+	s.logger.Warn("ship job logs failed", xlog.String("backend", s.config.Backend), xlog.Int("lines", len(batch)), xlog.FieldErr(err))
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// pushLoki 每个任务在每个节点上的输出作为一个 stream，标签为 job、node 及附加的固定标签
+// task id 每次执行都不同，作为标签会让 stream 数量无限增长，写在每行的开头，可用 |= "task=<id> " 过滤
+func (s *logShipper) pushLoki(batch []*LogLine) error {
+	streams := make(map[string]*lokiStream)
+	order := make([]string, 0)
+	for _, line := range batch {
+		key := line.JobID + "/" + line.Node
+		stream, ok := streams[key]
+		if !ok {
+			labels := map[string]string{"job": line.JobID, "node": line.Node}
+			for name, value := range s.config.Labels {
+				labels[name] = value
+			}
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			order = append(order, key)
+		}
+		text := "task=" + strconv.FormatUint(line.TaskID, 10) + " " + line.Line
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(line.Time.UnixNano(), 10), text})
+	}
+
+	body := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{Streams: make([]*lokiStream, 0, len(order))}
+	for _, key := range order {
+		body.Streams = append(body.Streams, streams[key])
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	_, err = s.post(strings.TrimRight(s.config.Addr, "/")+"/loki/api/v1/push", "application/json", data)
+	return err
+}
+
+// bulkElasticsearch 使用 bulk 接口写入，部分文档写入失败时不重试，避免重复写入成功的文档
+func (s *logShipper) bulkElasticsearch(batch []*LogLine) error {
+	var buf bytes.Buffer
+	for _, line := range batch {
+		action := map[string]map[string]string{"index": {"_index": line.Time.Format(s.config.Index)}}
+		if err := writeJSONLine(&buf, action); err != nil {
+			return err
+		}
+		doc := make(map[string]interface{}, len(s.config.Labels)+6)
+		for name, value := range s.config.Labels {
+			doc[name] = value
+		}
+		doc["@timestamp"] = line.Time
+		doc["job"] = line.JobID
+		doc["job_name"] = line.JobName
+		doc["task"] = line.TaskID
+		doc["node"] = line.Node
+		doc["message"] = line.Line
+		if err := writeJSONLine(&buf, doc); err != nil {
+			return err
+		}
+	}
+
+	resp, err := s.post(strings.TrimRight(s.config.Addr, "/")+"/_bulk", "application/x-ndjson", buf.Bytes())
+	if err != nil {
+		return err
+	}
+	result := struct {
+		Errors bool `json:"errors"`
+	}{}
+	if json.Unmarshal(resp.Body(), &result) == nil && result.Errors {
+		s.logger.Warn("some job log lines are rejected by elasticsearch", xlog.Int("lines", len(batch)))
+	}
+	return nil
+}
+
+func (s *logShipper) post(url, contentType string, body []byte) (*resty.Response, error) {
+	resp, err := s.client.R().SetHeader("Content-Type", contentType).SetBody(body).Post(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode(), resp.String())
+	}
+	return resp, nil
+}
+
+func writeJSONLine(buf *bytes.Buffer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	buf.WriteByte('\n')
+	return nil
+}
+
+// shipLogs 任务的输出是否投递，任务未设置 ship_logs 时按节点配置
+func (j *Job) shipLogs() bool {
+	if j.shipper == nil {
+		return false
+	}
+	if j.ShipLogs != nil {
+		return *j.ShipLogs
+	}
+	return j.LogShip.AllJobs
+}
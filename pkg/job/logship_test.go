@@ -0,0 +1,84 @@
+package job
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogShipperLoki(t *testing.T) {
+	received := make(chan []*lokiStream, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/loki/api/v1/push", r.URL.Path)
+		assert.Equal(t, "tenant", r.Header.Get("X-Scope-OrgID"))
+		body := struct {
+			Streams []*lokiStream `json:"streams"`
+		}{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		received <- body.Streams
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := &LogShipConfig{Backend: LogShipLoki, Addr: server.URL, TenantID: "tenant", Labels: map[string]string{"env": "test"}, BatchSize: 2}
+	config.normalize()
+	assert.NoError(t, config.Valid())
+	done := make(chan struct{})
+	defer close(done)
+
+	job := &Job{ID: "backup", worker: &worker{Config: DefaultConfig(), shipper: newLogShipper(config, xlog.DefaultLogger, done)}}
+	job.HostName = "node-1"
+	job.LogShip.AllJobs = true
+	w := job.logEvents(&Task{TaskID: 7})
+	_, _ = w.Write([]byte("first\nsec"))
+	_, _ = w.Write([]byte("ond\n"))
+
+	select {
+	case streams := <-received:
+		assert.Len(t, streams, 1)
+		assert.Equal(t, map[string]string{"job": "backup", "node": "node-1", "env": "test"}, streams[0].Stream)
+		assert.Equal(t, "task=7 first", streams[0].Values[0][1])
+		assert.Equal(t, "task=7 second", streams[0].Values[1][1])
+	case <-time.After(5 * time.Second):
+		t.Fatal("logs not shipped")
+	}
+
+	disabled := false
+	job.ShipLogs = &disabled
+	assert.Nil(t, job.logEvents(&Task{TaskID: 8}))
+}
+
+func TestLogShipperElasticsearch(t *testing.T) {
+	received := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/_bulk", r.URL.Path)
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- body
+		_, _ = w.Write([]byte(`{"errors":false}`))
+	}))
+	defer server.Close()
+
+	config := &LogShipConfig{Backend: LogShipElasticsearch, Addr: server.URL, Index: "jobs-2006.01"}
+	config.normalize()
+	done := make(chan struct{})
+	defer close(done)
+
+	shipper := newLogShipper(config, xlog.DefaultLogger, done)
+	at := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	shipper.send([]*LogLine{{Time: at, JobID: "backup", TaskID: 7, Node: "node-1", Line: "done"}})
+
+	lines := bytes.Split(bytes.TrimSpace(<-received), []byte("\n"))
+	assert.Len(t, lines, 2)
+	assert.JSONEq(t, `{"index":{"_index":"jobs-2020.06"}}`, string(lines[0]))
+	doc := make(map[string]interface{})
+	assert.NoError(t, json.Unmarshal(lines[1], &doc))
+	assert.Equal(t, "done", doc["message"])
+	assert.Equal(t, "backup", doc["job"])
+}
@@ -0,0 +1,349 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/douyu/juno-agent/pkg/audit"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// 每个任务在本地保留的执行结果条数
+const maxRunHistory = 20
+
+var ErrJobNotFound = errors.New("job not found on current node")
+
+// Manager 节点上任务的管理接口，供 agent 的 API 直接操作本节点任务，不依赖 etcd
+type Manager interface {
+	// Jobs 当前节点调度的任务
+	Jobs() []*Job
+	// TriggerJob 立即执行一次任务，返回 task id
+	TriggerJob(id string) (uint64, error)
+	// RunOnce 立即执行一次临时任务，与写入 once key 效果相同，同样校验签名，taskID 为 0 时生成新的 id，返回 task id
+	RunOnce(data []byte, taskID uint64) (uint64, error)
+	// KillJob 强杀任务在当前节点上正在执行的进程，返回杀掉的进程数
+	KillJob(id string) (int, error)
+	// KillTask 强杀指定的正在执行的任务，jobID 为空时按 task id 查找
+	KillTask(jobID string, taskID uint64) (bool, error)
+	// RunningTasks 任务在当前节点上正在执行的 task id
+	RunningTasks(jobID string) []uint64
+	// RunningProcesses 当前节点上正在执行的全部任务进程
+	RunningProcesses() []RunningProcess
+	// JobRuns 任务在当前节点上最近的执行结果，按时间倒序
+	JobRuns(id string) ([]*TaskResult, error)
+	// SubscribeOutput 订阅正在执行的任务输出，返回已有输出、后续输出的 channel 及取消订阅的函数
+	SubscribeOutput(taskID uint64) ([]byte, <-chan []byte, func(), error)
+	// TaskRun 按 task id 查找当前节点最近的执行结果，不需要知道 job id
+	TaskRun(taskID uint64) (*TaskResult, error)
+	// Lint 按节点配置的约束检查任务定义，返回所有问题
+	Lint(job *Job) []*LintProblem
+	// Drain 停止调度并释放任务锁，等待正在执行的任务结束，用于节点重启前
+	Drain(ctx context.Context) error
+	// Undrain 重启失败等情况下取消 Drain，恢复调度及执行
+	Undrain()
+	// Health 调度器及各 watch 的状态
+	Health() *Health
+	// Reload 应用重新读取的配置，不影响执行中的任务
+	Reload(config *Config) (*ReloadResult, error)
+}
+
+var _ Manager = (*worker)(nil)
+
+func (w *worker) Jobs() []*Job {
+	// 返回副本，任务修改时原地更新
+	w.jobsMutex.RLock()
+	jobs := make([]*Job, 0, len(w.jobs))
+	for _, job := range w.jobs {
+		jobs = append(jobs, job.clone())
+	}
+	w.jobsMutex.RUnlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs
+}
+
+// clone 任务定义的副本，不含任务锁及 worker 的引用，修改副本不影响调度中的任务
+// 定时规则、提取规则、制品及切片、map 逐个复制，其余规则在任务修改时整体替换，不会原地修改，与调度中的任务共用
+func (j *Job) clone() *Job {
+	c := *j
+	c.worker = nil
+	c.unlock = nil
+	c.locked = false
+
+	c.Args = copyStrings(j.Args)
+	c.Nodes = copyStrings(j.Nodes)
+	c.Command = copyStrings(j.Command)
+	c.Selector = copyStringMap(j.Selector)
+	c.Envs = copyStringMap(j.Envs)
+	c.Params = copyStringMap(j.Params)
+	if j.Timers != nil {
+		c.Timers = make([]*Timer, len(j.Timers))
+		for i, timer := range j.Timers {
+			if timer != nil {
+				timer := *timer
+				c.Timers[i] = &timer
+			}
+		}
+	}
+	if j.Extracts != nil {
+		c.Extracts = make([]*Extract, len(j.Extracts))
+		for i, extract := range j.Extracts {
+			if extract != nil {
+				extract := *extract
+				c.Extracts[i] = &extract
+			}
+		}
+	}
+	if j.Artifact != nil {
+		artifact := *j.Artifact
+		c.Artifact = &artifact
+	}
+	if j.Artifacts != nil {
+		c.Artifacts = make([]*Artifact, len(j.Artifacts))
+		for i, artifact := range j.Artifacts {
+			if artifact != nil {
+				artifact := *artifact
+				c.Artifacts[i] = &artifact
+			}
+		}
+	}
+	return &c
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string(nil), s...)
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func (w *worker) TriggerJob(id string) (uint64, error) {
+	job, ok := w.getJob(id)
+	if !ok {
+		return 0, ErrJobNotFound
+	}
+
+	once := &OnceJob{Job: *job}
+	if err := w.acceptOnce(once); err != nil {
+		return 0, err
+	}
+	w.auditAPI(audit.ActionTrigger, id, once.TaskID)
+
+	return once.TaskID, nil
+}
+
+func (w *worker) RunOnce(data []byte, taskID uint64) (uint64, error) {
+	job, err := ParseOnceJob(data)
+	if err != nil {
+		return 0, err
+	}
+	if err := w.authorizeOnce(data, job); err != nil {
+		return 0, err
+	}
+	if taskID != 0 {
+		job.TaskID = taskID
+	}
+	if err := w.resolveOnce(job); err != nil {
+		return 0, err
+	}
+
+	if err := w.acceptOnce(job); err != nil {
+		return 0, err
+	}
+	w.auditAPI(audit.ActionOnce, job.ID, job.TaskID)
+
+	return job.TaskID, nil
+}
+
+func (w *worker) Lint(job *Job) []*LintProblem {
+	policy := w.Config.Lint
+	if floor := w.minTimerInterval(); floor > policy.MinInterval {
+		policy.MinInterval = floor
+	}
+	return Lint(job, &policy)
+}
+
+func (w *worker) KillJob(id string) (int, error) {
+	if _, ok := w.getJob(id); !ok {
+		return 0, ErrJobNotFound
+	}
+
+	w.runsMutex.Lock()
+	kills := make([]func(), 0, len(w.runningJobs[id]))
+	for _, kill := range w.runningJobs[id] {
+		kills = append(kills, kill)
+	}
+	w.runsMutex.Unlock()
+
+	for _, kill := range kills {
+		kill()
+	}
+	w.auditAPI(audit.ActionKill, id, 0)
+	return len(kills), nil
+}
+
+func (w *worker) KillTask(jobID string, taskID uint64) (bool, error) {
+	jobID, err := w.killTask(jobID, taskID)
+	if err != nil {
+		return false, err
+	}
+
+	w.auditAPI(audit.ActionKill, jobID, taskID)
+	return true, nil
+}
+
+func (w *worker) RunningTasks(jobID string) []uint64 {
+	w.runsMutex.Lock()
+	defer w.runsMutex.Unlock()
+
+	tasks := make([]uint64, 0, len(w.runningJobs[jobID]))
+	for taskID := range w.runningJobs[jobID] {
+		tasks = append(tasks, taskID)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i] < tasks[j]
+	})
+	return tasks
+}
+
+// RunningProcess 正在执行的任务进程
+type RunningProcess struct {
+	JobID  string `json:"job_id"`
+	TaskID uint64 `json:"task_id"`
+	PID    int    `json:"pid"`
+}
+
+func (w *worker) RunningProcesses() []RunningProcess {
+	w.runsMutex.Lock()
+	defer w.runsMutex.Unlock()
+
+	procs := make([]RunningProcess, 0, len(w.runningPids))
+	for _, proc := range w.runningPids {
+		procs = append(procs, proc)
+	}
+	sort.Slice(procs, func(i, j int) bool {
+		return procs[i].TaskID < procs[j].TaskID
+	})
+	return procs
+}
+
+// JobRuns 临时任务不在调度列表中，有执行记录即可查询
+func (w *worker) JobRuns(id string) ([]*TaskResult, error) {
+	_, scheduled := w.getJob(id)
+
+	w.runsMutex.Lock()
+	defer w.runsMutex.Unlock()
+
+	if _, ok := w.runs[id]; !ok && !scheduled {
+		return nil, ErrJobNotFound
+	}
+
+	runs := make([]*TaskResult, 0, len(w.runs[id]))
+	for i := len(w.runs[id]) - 1; i >= 0; i-- {
+		runs = append(runs, w.runs[id][i])
+	}
+	return runs, nil
+}
+
+// ErrTaskNotFound 执行结果已不在当前节点保留的最近记录中
+var ErrTaskNotFound = errors.New("task not found on current node")
+
+func (w *worker) TaskRun(taskID uint64) (*TaskResult, error) {
+	w.runsMutex.Lock()
+	defer w.runsMutex.Unlock()
+
+	for _, runs := range w.runs {
+		for _, run := range runs {
+			if run.TaskID == taskID {
+				return run, nil
+			}
+		}
+	}
+	return nil, ErrTaskNotFound
+}
+
+// trackRunning 记录正在执行的进程，返回的函数在进程结束后调用
+func (w *worker) trackRunning(jobID string, taskID uint64, pid int) func() {
+	w.runsMutex.Lock()
+	defer w.runsMutex.Unlock()
+
+	if w.runningJobs[jobID] == nil {
+		w.runningJobs[jobID] = make(map[uint64]context.CancelFunc)
+	}
+	if w.runningPids == nil {
+		w.runningPids = make(map[uint64]RunningProcess)
+	}
+	w.runningPids[taskID] = RunningProcess{JobID: jobID, TaskID: taskID, PID: pid}
+	w.runningJobs[jobID][taskID] = func() {
+		if err := killProcess(pid); err != nil {
+			w.logger.Warn("force kill process failed", fieldJob(jobID), fieldTask(taskID), xlog.Int("pid", pid), xlog.FieldErr(err))
+			return
+		}
+		w.emit(&CallbackEvent{
+			Event:  CallbackKill,
+			JobID:  jobID,
+			TaskID: taskID,
+			Node:   w.HostName,
+		})
+	}
+
+	return func() {
+		w.runsMutex.Lock()
+		defer w.runsMutex.Unlock()
+
+		delete(w.runningJobs[jobID], taskID)
+		delete(w.runningPids, taskID)
+		if len(w.runningJobs[jobID]) == 0 {
+			delete(w.runningJobs, jobID)
+		}
+	}
+}
+
+// recordRun 记录任务执行结果，同一个 task 的结果会被更新
+func (w *worker) recordRun(result *TaskResult) {
+	w.runsMutex.Lock()
+	defer w.runsMutex.Unlock()
+
+	id := result.Job.ID
+	switch result.Status {
+	case CronTaskStatusSuccess:
+		delete(w.failures, id)
+	case CronTaskStatusFailed, CronTaskStatusTimeout, CronTaskStatusOrphaned:
+		w.failures[id]++
+		if w.OnFailure != nil {
+			go w.OnFailure(result, w.failures[id])
+		}
+	}
+	if result.FinishedAt != nil {
+		observeRun(result)
+		w.checkDuration(result)
+	}
+
+	runs := w.runs[id]
+	for i, run := range runs {
+		if run.TaskID == result.TaskID {
+			runs[i] = result
+			return
+		}
+	}
+
+	runs = append(runs, result)
+	if len(runs) > maxRunHistory {
+		runs = runs[len(runs)-maxRunHistory:]
+	}
+	w.runs[id] = runs
+}
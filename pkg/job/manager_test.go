@@ -0,0 +1,54 @@
+package job
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobsCopy(t *testing.T) {
+	w := newReplayWorker(t)
+
+	newJob := func(name string) *Job {
+		return &Job{ID: "a", Name: name, Enable: true, Nodes: []string{"node-1"},
+			Args: []string{"-v"}, Envs: map[string]string{"MODE": "full"},
+			Timers: []*Timer{{ID: "hourly", Cron: "@hourly"}}}
+	}
+	w.addJob(newJob("a"))
+
+	jobs := w.Jobs()
+	assert.Len(t, jobs, 1)
+	assert.Nil(t, jobs[0].worker)
+
+	// 修改副本不影响调度中的任务
+	copied := jobs[0]
+	copied.Name = "b"
+	copied.Args[0] = "-q"
+	copied.Envs["MODE"] = "dry-run"
+	copied.Timers[0].Disabled = true
+	job, ok := w.getJob("a")
+	assert.True(t, ok)
+	assert.Equal(t, "a", job.Name)
+	assert.Equal(t, []string{"-v"}, job.Args)
+	assert.Equal(t, "full", job.Envs["MODE"])
+	assert.False(t, job.Timers[0].Disabled)
+	assert.Len(t, w.cmds, 1)
+
+	// 读取副本与原地修改任务并发执行
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			w.modJob(newJob("c"))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		for _, job := range w.Jobs() {
+			_ = job.Name
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, "c", w.Jobs()[0].Name)
+}
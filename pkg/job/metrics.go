@@ -0,0 +1,97 @@
+package job
+
+import (
+	"time"
+
+	"github.com/douyu/jupiter/pkg/metric"
+)
+
+var (
+	// 任务执行次数，status 为任务的最终状态
+	jobExecutionsCounter = metric.CounterVecOpts{
+		Namespace: "juno",
+		Subsystem: "agent",
+		Name:      "job_executions_total",
+		Help:      "cron job executions by final status",
+		Labels:    []string{"job", "status"},
+	}.Build()
+
+	// 任务从开始执行到结束的耗时
+	jobDurationHistogram = metric.HistogramVecOpts{
+		Namespace: "juno",
+		Subsystem: "agent",
+		Name:      "job_duration_seconds",
+		Help:      "cron job execution duration",
+		Labels:    []string{"job"},
+		Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 600, 1800, 3600},
+	}.Build()
+
+	// 任务的计划触发时间到实际开始执行的等待时间
+	jobQueueWaitHistogram = metric.HistogramVecOpts{
+		Namespace: "juno",
+		Subsystem: "agent",
+		Name:      "job_queue_wait_seconds",
+		Help:      "delay between scheduled time and actual start of cron job",
+		Labels:    []string{"job"},
+		Buckets:   []float64{0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300},
+	}.Build()
+
+	// etcd 操作失败后的重试次数
+	etcdRetriesCounter = metric.CounterVecOpts{
+		Namespace: "juno",
+		Subsystem: "agent",
+		Name:      "etcd_retries_total",
+		Help:      "retries of failed etcd operations",
+		Labels:    []string{"op"},
+	}.Build()
+
+	// 当前节点 cron 中的调度条目数
+	cronEntriesGauge = metric.GaugeVecOpts{
+		Namespace: "juno",
+		Subsystem: "agent",
+		Name:      "cron_entries",
+		Help:      "number of entries scheduled in cron on current node",
+	}.Build()
+
+	// 超出每分钟启动次数限制而未执行的次数
+	jobThrottledCounter = metric.CounterVecOpts{
+		Namespace: "juno",
+		Subsystem: "agent",
+		Name:      "job_throttled_total",
+		Help:      "job starts rejected by the per node rate limit",
+		Labels:    []string{"job"},
+	}.Build()
+
+	// BestEffort 任务因节点压力被推迟、放弃的次数
+	jobShedCounter = metric.CounterVecOpts{
+		Namespace: "juno",
+		Subsystem: "agent",
+		Name:      "job_shed_total",
+		Help:      "best effort job fires deferred or shed under host pressure",
+		Labels:    []string{"job", "decision"},
+	}.Build()
+
+	// 执行结果的输出加密失败、没有写入存储的次数
+	resultEncryptFailuresCounter = metric.CounterVecOpts{
+		Namespace: "juno",
+		Subsystem: "agent",
+		Name:      "result_encrypt_failures_total",
+		Help:      "task results whose logs were dropped because encryption failed",
+		Labels:    []string{"job"},
+	}.Build()
+)
+
+// observeRun 在任务结束后记录执行次数与耗时
+func observeRun(result *TaskResult) {
+	jobExecutionsCounter.Inc(result.Job.ID, string(result.Status))
+	jobDurationHistogram.Observe(result.FinishedAt.Sub(result.ExecutedAt).Seconds(), result.Job.ID)
+}
+
+// observeQueueWait 记录 cron 条目计划触发到实际执行的延迟
+func (c *Cmd) observeQueueWait() {
+	scheduled := c.Job.Cron.Entry(c.schEntryID).Prev
+	if scheduled.IsZero() {
+		return
+	}
+	jobQueueWaitHistogram.Observe(time.Since(scheduled).Seconds(), c.Job.ID)
+}
@@ -0,0 +1,84 @@
+package job
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+// gatherMetric 从默认注册表中取出指定名称、标签完全匹配的指标，不存在时返回 nil
+func gatherMetric(t *testing.T, name string, labels map[string]string) *dto.Metric {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.Nil(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			pairs := m.GetLabel()
+			if len(pairs) != len(labels) {
+				continue
+			}
+			matched := true
+			for _, pair := range pairs {
+				if labels[pair.GetName()] != pair.GetValue() {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+func TestObserveRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script")
+	}
+	dir, err := ioutil.TempDir("", "metrics")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "job.sh")
+	assert.Nil(t, ioutil.WriteFile(script, []byte("#!/bin/sh\nsleep 0.2\nexit $1\n"), 0755))
+
+	w := newReplayWorker(t, func(c *Config) {
+		c.Replay.Exec = true
+	})
+
+	// 任务 ID 只在本测试中使用，不受其他测试记录的指标影响
+	job := &Job{ID: "metrics", Name: "metrics", Script: script, Args: []string{"0"}, Enable: true, worker: w}
+	assert.Nil(t, job.Run())
+	job.Args = []string{"1"}
+	assert.NotNil(t, job.Run())
+
+	success := gatherMetric(t, "juno_agent_job_executions_total", map[string]string{"job": "metrics", "status": "success"})
+	if assert.NotNil(t, success) {
+		assert.Equal(t, float64(1), success.GetCounter().GetValue())
+	}
+	failed := gatherMetric(t, "juno_agent_job_executions_total", map[string]string{"job": "metrics", "status": "failed"})
+	if assert.NotNil(t, failed) {
+		assert.Equal(t, float64(1), failed.GetCounter().GetValue())
+	}
+
+	duration := gatherMetric(t, "juno_agent_job_duration_seconds", map[string]string{"job": "metrics"})
+	if assert.NotNil(t, duration) {
+		histogram := duration.GetHistogram()
+		assert.Equal(t, uint64(2), histogram.GetSampleCount())
+		assert.GreaterOrEqual(t, histogram.GetSampleSum(), 0.4)
+		// 每次执行至少 0.2s，都不落在 0.1 的桶里
+		for _, bucket := range histogram.GetBucket() {
+			if bucket.GetUpperBound() == 0.1 {
+				assert.Equal(t, uint64(0), bucket.GetCumulativeCount())
+			}
+		}
+	}
+}
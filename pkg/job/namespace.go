@@ -0,0 +1,113 @@
+package job
+
+import (
+	"context"
+	"sync"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// switchableStore 可以整体替换的任务存储，切换命名空间时替换为新命名空间下的连接
+type switchableStore struct {
+	mu    sync.RWMutex
+	store JobStore
+}
+
+func (s *switchableStore) current() JobStore {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store
+}
+
+// swap 替换为 next，返回替换前的存储，由调用方关闭
+func (s *switchableStore) swap(next JobStore) JobStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.store
+	s.store = next
+	return prev
+}
+
+func (s *switchableStore) List(ctx context.Context, prefix string) ([]*StoreKV, error) {
+	return s.current().List(ctx, prefix)
+}
+
+func (s *switchableStore) Watch(ctx context.Context, prefix string) ([]*StoreKV, <-chan *StoreEvent, error) {
+	return s.current().Watch(ctx, prefix)
+}
+
+func (s *switchableStore) Put(ctx context.Context, key string, value []byte) error {
+	return s.current().Put(ctx, key, value)
+}
+
+func (s *switchableStore) Delete(ctx context.Context, key string) error {
+	return s.current().Delete(ctx, key)
+}
+
+func (s *switchableStore) PutProc(ctx context.Context, key string, value []byte) error {
+	return s.current().PutProc(ctx, key, value)
+}
+
+func (s *switchableStore) DeleteProc(ctx context.Context, key string) error {
+	return s.current().DeleteProc(ctx, key)
+}
+
+func (s *switchableStore) Lock(ctx context.Context, key string) (func() error, error) {
+	return s.current().Lock(ctx, key)
+}
+
+func (s *switchableStore) Check(ctx context.Context) error {
+	return s.current().Check(ctx)
+}
+
+func (s *switchableStore) Close() error {
+	return s.current().Close()
+}
+
+// namespaceStore 按当前配置连接 namespace 下的任务存储，并检查连接是否可用
+func (w *worker) namespaceStore(namespace string) (JobStore, error) {
+	conf := *w.Config
+	conf.Namespace = namespace
+	store, err := newStore(&conf, w.redact)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := NewEtcdTimeoutContext(w)
+	defer cancel()
+	if err := store.Check(ctx); err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// switchNamespace 切换到 store 所在的命名空间：移除当前调度的任务并释放任务锁，
+// 关闭旧命名空间的连接，节点注册等与连接绑定的 key 随之删除，旧的 watch 结束，
+// 之后在新的命名空间中重新注册节点、建立 watch 并加载任务。
+// 执行中的任务继续执行，结束后的结果写入新的命名空间
+func (w *worker) switchNamespace(switchable *switchableStore, store JobStore, namespace string) {
+	w.syncMutex.Lock()
+	for _, job := range w.Jobs() {
+		w.delJob(job.ID)
+	}
+	prev := switchable.swap(store)
+	w.reloadMutex.Lock()
+	w.Namespace = namespace
+	w.reloadMutex.Unlock()
+	w.syncMutex.Unlock()
+
+	if err := prev.Close(); err != nil {
+		w.logger.Warn("close job store of previous namespace failed", xlog.FieldErr(err))
+	}
+
+	// 扩展脚本及维护日历按新命名空间中的内容重新加载
+	w.hookMutex.Lock()
+	w.hooks = make(map[string]*Hook)
+	w.hookMutex.Unlock()
+	w.calendarMutex.Lock()
+	w.calendars = make(map[string]*Calendar)
+	w.calendarMutex.Unlock()
+
+	w.watchStore()
+}
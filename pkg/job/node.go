@@ -0,0 +1,60 @@
+package job
+
+import (
+	"encoding/json"
+)
+
+// 节点信息，注册到 /{LabelKeyPrefix}/hostname
+type NodeInfo struct {
+	ID     string            `json:"id"`
+	IP     string            `json:"ip"`
+	Groups []string          `json:"groups"`
+	Labels map[string]string `json:"labels"`
+}
+
+// registerNode 将当前节点的标签及所属节点组注册到任务存储，key 与节点存活绑定，节点宕机后自动过期
+// key: /{LabelKeyPrefix}/hostname
+// key: /{NodeKeyPrefix}/group/hostname
+func (w *worker) registerNode() error {
+	groups, labels := w.nodeSelectors()
+	if len(groups) == 0 && len(labels) == 0 {
+		return nil
+	}
+
+	info, err := json.Marshal(NodeInfo{
+		ID:     w.ID,
+		IP:     w.AppIP,
+		Groups: groups,
+		Labels: labels,
+	})
+	if err != nil {
+		return err
+	}
+
+	kvs := map[string]string{LabelKeyPrefix + w.ID: string(info)}
+	for _, group := range groups {
+		kvs[NodeKeyPrefix+group+"/"+w.ID] = w.AppIP
+	}
+
+	for key, val := range kvs {
+		ctx, cancel := NewEtcdTimeoutContext(w)
+		err = w.store.PutProc(ctx, key, []byte(val))
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MatchSelector 判断标签是否满足选择器
+// 选择器中的每一项都需要与标签完全相等，空选择器匹配所有节点
+func MatchSelector(selector, labels map[string]string) bool {
+	for key, val := range selector {
+		if v, ok := labels[key]; !ok || v != val {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchSelector(t *testing.T) {
+	labels := map[string]string{"region": "sh", "env": "prod", "hardware": "gpu"}
+	tests := []struct {
+		name     string
+		selector map[string]string
+		labels   map[string]string
+		want     bool
+	}{
+		{"empty selector", nil, labels, true},
+		{"empty selector without labels", map[string]string{}, nil, true},
+		{"one term", map[string]string{"env": "prod"}, labels, true},
+		{"multiple terms", map[string]string{"env": "prod", "region": "sh"}, labels, true},
+		{"one of multiple terms differs", map[string]string{"env": "prod", "region": "bj"}, labels, false},
+		{"missing label", map[string]string{"zone": "a"}, labels, false},
+		{"empty value does not match missing label", map[string]string{"zone": ""}, labels, false},
+		{"node without labels", map[string]string{"env": "prod"}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, MatchSelector(tt.selector, tt.labels))
+		})
+	}
+}
+
+func TestIsJobTarget(t *testing.T) {
+	w := &worker{Config: &Config{
+		HostName: "node-1",
+		Labels:   map[string]string{"env": "prod"},
+	}}
+	tests := []struct {
+		name string
+		job  *Job
+		want bool
+	}{
+		{"listed in nodes", &Job{Nodes: []string{"node-2", "node-1"}}, true},
+		{"not listed in nodes", &Job{Nodes: []string{"node-2"}}, false},
+		{"selector matches", &Job{Selector: map[string]string{"env": "prod"}}, true},
+		{"selector does not match", &Job{Selector: map[string]string{"env": "test"}}, false},
+		// 设置了选择器时不再看 nodes
+		{"selector takes precedence over nodes", &Job{Nodes: []string{"node-1"}, Selector: map[string]string{"env": "test"}}, false},
+		{"selector matches although not in nodes", &Job{Nodes: []string{"node-2"}, Selector: map[string]string{"env": "prod"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, w.isJobTarget(tt.job))
+		})
+	}
+}
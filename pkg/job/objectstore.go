@@ -0,0 +1,173 @@
+package job
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Config s3:// 制品的访问配置，Endpoint 为空时访问 AWS，否则按 path-style 访问兼容 S3 的存储，如 MinIO
+type S3Config struct {
+	Endpoint  string // 如 https://minio.internal:9000
+	Region    string
+	AccessKey string
+	SecretKey string
+	// 允许下载的 bucket 或 bucket/前缀，为空时不允许下载 s3:// 制品，
+	// 避免任务借 agent 的密钥读取其他 bucket 中的对象
+	Allowed []string
+}
+
+// OSSConfig oss:// 制品的访问配置
+type OSSConfig struct {
+	Endpoint  string // 如 oss-cn-hangzhou.aliyuncs.com
+	AccessKey string
+	SecretKey string
+	Allowed   []string // 允许下载的 bucket 或 bucket/前缀，为空时不允许下载 oss:// 制品
+}
+
+// request 生成下载制品的请求，s3、oss 地址转换为对应的 http 地址并签名
+func (c *artifactCache) request(rawURL string) (*http.Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	switch u.Scheme {
+	case "s3":
+		if !allowedObject(c.config.S3.Allowed, u.Host, key) {
+			return nil, fmt.Errorf("s3://%s/%s is not in the allowed buckets", u.Host, key)
+		}
+		return c.s3Request(u.Host, key)
+	case "oss":
+		if !allowedObject(c.config.OSS.Allowed, u.Host, key) {
+			return nil, fmt.Errorf("oss://%s/%s is not in the allowed buckets", u.Host, key)
+		}
+		return c.ossRequest(u.Host, key)
+	}
+	return http.NewRequest(http.MethodGet, rawURL, nil)
+}
+
+func (c *artifactCache) s3Request(bucket, key string) (*http.Request, error) {
+	conf := c.config.S3
+	region := conf.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	var rawURL string
+	if conf.Endpoint == "" {
+		rawURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, s3Escape(key))
+	} else {
+		rawURL = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(conf.Endpoint, "/"), bucket, s3Escape(key))
+	}
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil || conf.AccessKey == "" {
+		return req, err
+	}
+
+	// AWS Signature Version 4，不对响应体签名
+	now := time.Now().UTC()
+	date := now.Format("20060102")
+	stamp := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		req.URL.EscapedPath(),
+		"",
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:UNSIGNED-PAYLOAD",
+		"x-amz-date:" + stamp,
+		"",
+		signedHeaders,
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	digest := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+
+	signingKey := []byte("AWS4" + conf.SecretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		signingKey = hmacSum(sha256.New, signingKey, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		conf.AccessKey, scope, signedHeaders, hex.EncodeToString(hmacSum(sha256.New, signingKey, toSign))))
+	return req, nil
+}
+
+func (c *artifactCache) ossRequest(bucket, key string) (*http.Request, error) {
+	conf := c.config.OSS
+	if conf.Endpoint == "" {
+		return nil, fmt.Errorf("oss endpoint is not configured for bucket %s", bucket)
+	}
+	endpoint := conf.Endpoint
+	scheme := "https"
+	if i := strings.Index(endpoint, "://"); i >= 0 {
+		scheme, endpoint = endpoint[:i], endpoint[i+3:]
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s://%s.%s/%s", scheme, bucket, endpoint, s3Escape(key)), nil)
+	if err != nil || conf.AccessKey == "" {
+		return req, err
+	}
+
+	// OSS 签名：Method\nContent-MD5\nContent-Type\nDate\n/bucket/key
+	date := time.Now().UTC().Format(http.TimeFormat)
+	req.Header.Set("Date", date)
+	toSign := http.MethodGet + "\n\n\n" + date + "\n/" + bucket + "/" + key
+	signature := base64.StdEncoding.EncodeToString(hmacSum(sha1.New, []byte(conf.SecretKey), toSign))
+	req.Header.Set("Authorization", "OSS "+conf.AccessKey+":"+signature)
+	return req, nil
+}
+
+// allowedObject 对象是否在允许的 bucket 或 bucket/前缀中，key 含 . 或 .. 路径段时拒绝，
+// 避免兼容 S3 的存储规范化路径后越过前缀
+func allowedObject(allowed []string, bucket, key string) bool {
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "." || segment == ".." {
+			return false
+		}
+	}
+	for _, entry := range allowed {
+		i := strings.Index(entry, "/")
+		if i < 0 {
+			if entry == bucket {
+				return true
+			}
+			continue
+		}
+		if entry[:i] == bucket && strings.HasPrefix(key, entry[i+1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func hmacSum(h func() hash.Hash, key []byte, data string) []byte {
+	mac := hmac.New(h, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape 按 S3 的规则编码对象 key，未保留字符及 / 之外全部编码
+func s3Escape(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		ch := key[i]
+		if ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || ch == '/' {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,115 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/metric"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// 临时任务的确认状态，写回 once key，admin 据此判断节点是否接收了任务
+const (
+	OnceAccepted = "accepted"
+	OnceRejected = "rejected"
+)
+
+// ErrOnceQueueFull 等待执行的临时任务超过 OnceQueue.Capacity
+var ErrOnceQueueFull = errors.New("once job queue is full")
+
+// 接收及拒绝的临时任务数
+var onceTasksCounter = metric.CounterVecOpts{
+	Namespace: "juno",
+	Subsystem: "agent",
+	Name:      "once_tasks_total",
+	Help:      "once tasks accepted or rejected by the bounded once queue",
+	Labels:    []string{"status"},
+}.Build()
+
+// OnceAck 节点对临时任务的确认
+type OnceAck struct {
+	Status string    `json:"status"`           // accepted 或 rejected
+	Reason string    `json:"reason,omitempty"` // 拒绝的原因，如队列已满、节点下线中
+	Node   string    `json:"node"`
+	TaskID uint64    `json:"task_id"`
+	At     time.Time `json:"at"`
+}
+
+func newOnceAck(node string, taskID uint64, err error) *OnceAck {
+	ack := &OnceAck{Status: OnceAccepted, Node: node, TaskID: taskID, At: time.Now()}
+	if err != nil {
+		ack.Status = OnceRejected
+		ack.Reason = err.Error()
+	}
+	return ack
+}
+
+// acceptOnce 分配 task id 后放入有界队列，由固定数量的协程执行，队列满或节点下线中时拒绝
+func (w *worker) acceptOnce(job *OnceJob) (err error) {
+	defer func() {
+		if err != nil {
+			onceTasksCounter.Inc(OnceRejected)
+		} else {
+			onceTasksCounter.Inc(OnceAccepted)
+		}
+	}()
+
+	if w.isDraining() {
+		return ErrDraining
+	}
+	if job.TaskID == 0 {
+		if job.TaskID, err = w.taskIdGen.NextID(); err != nil {
+			return err
+		}
+	}
+
+	job.worker = w
+	job.runOn = w.ID
+	select {
+	case w.onceTasks <- job:
+		return nil
+	default:
+		return ErrOnceQueueFull
+	}
+}
+
+// runOnceTasks 执行队列中的临时任务，worker 停止时队列中未执行的任务被丢弃
+func (w *worker) runOnceTasks() {
+	for {
+		select {
+		case job := <-w.onceTasks:
+			job.RunWithRecovery(WithTaskID(job.TaskID))
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// ackOnce 把确认写回 once key，保留 admin 写入的原始内容，只补上 task_id 及 ack
+// 带 ack 的 once key 不会再被执行，admin 应等到确认后再下发下一个任务
+func (w *worker) ackOnce(key string, payload []byte, ack *OnceAck) {
+	data, err := ackPayload(payload, ack)
+	if err != nil {
+		w.logger.Warn("encode once ack failed", xlog.String("key", key), xlog.FieldErr(err))
+		return
+	}
+
+	err = w.etcdRetry("put", w.Etcd.PutTimeout, func(ctx context.Context) error {
+		return w.store.Put(ctx, key, data)
+	})
+	if err != nil {
+		w.logger.Warn("put once ack failed", xlog.String("key", key), xlog.FieldErr(err))
+	}
+}
+
+func ackPayload(payload []byte, ack *OnceAck) ([]byte, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	fields["task_id"], _ = json.Marshal(ack.TaskID)
+	fields["ack"], _ = json.Marshal(ack)
+	return json.Marshal(fields)
+}
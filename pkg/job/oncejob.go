@@ -1,12 +1,23 @@
 package job
 
-import "runtime"
+import (
+	"runtime"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+)
 
 // 单次任务
 type OnceJob struct {
 	Job
 
 	TaskID uint64 `json:"task_id"`
+	// 开启 jobAuth 时必须签名，unix 秒级的过期时间及只能使用一次的随机值，防止重放
+	Expires int64  `json:"expires,omitempty"`
+	Nonce   string `json:"nonce,omitempty"`
+	// 节点写回的确认，不为空时表示该 once key 已被处理
+	Ack *OnceAck `json:"ack,omitempty"`
+	// 批量任务下发到所有节点，选择器及节点列表都为空时必须显式设置
+	All bool `json:"all,omitempty"`
 }
 
 func (o *OnceJob) RunWithRecovery(taskOptions ...TaskOption) {
@@ -15,7 +26,7 @@ func (o *OnceJob) RunWithRecovery(taskOptions ...TaskOption) {
 			const size = 64 << 10
 			buf := make([]byte, size)
 			buf = buf[:runtime.Stack(buf, false)]
-			o.logger.Warnf("panic running job: %v\n%s", r, buf)
+			o.logger.Warn("panic running once job", fieldJob(o.ID), xlog.Any("panic", r), xlog.FieldStack(buf))
 		}
 	}()
 	_ = o.Run(taskOptions...)
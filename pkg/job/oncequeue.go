@@ -0,0 +1,216 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/audit"
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/garyburd/redigo/redis"
+)
+
+// 临时任务的接收方式
+const (
+	OnceQueueEtcd  = "etcd"  // 监听 OnceKeyPrefix+HostName
+	OnceQueueRedis = "redis" // 从 redis 列表中 BLPOP
+)
+
+// OnceQueueConfig 临时任务的接收方式，Mode 为空时监听 etcd
+// redis 模式下每个节点对应一个列表，列表中的元素与 etcd 中 once key 的内容相同
+type OnceQueueConfig struct {
+	Mode         string
+	Addr         string        // redis 地址，如 127.0.0.1:6379
+	Password     string        // redis 密码，为空时不认证
+	DB           int           // redis db
+	Key          string        // 列表 key，%s 替换为节点 hostname
+	DialTimeout  time.Duration // 连接超时时间
+	BlockTimeout time.Duration // BLPOP 的阻塞时间，worker 停止时最多等待该时间
+	DedupTTL     time.Duration // task id 去重记录的保留时间，同一 task id 在此期间只执行一次，redis 模式下记录中保存确认
+	Workers      int           // 同时执行的临时任务数
+	Capacity     int           // 等待执行的临时任务数，超出时拒绝并在确认中注明
+}
+
+// normalize 补全无效的配置，BLPOP 的超时为 0 时会一直阻塞，redis 过期时间最小为 1s
+func (c *OnceQueueConfig) normalize() {
+	if c.BlockTimeout < time.Second {
+		c.BlockTimeout = time.Second
+	}
+	if c.DedupTTL < time.Second {
+		c.DedupTTL = 24 * time.Hour
+	}
+	if c.Workers <= 0 {
+		c.Workers = 8
+	}
+	if c.Capacity < 0 {
+		c.Capacity = 0
+	}
+}
+
+// listKey 节点对应的列表 key
+func (c *OnceQueueConfig) listKey(hostname string) string {
+	return fmt.Sprintf(c.Key, hostname)
+}
+
+// dedupKey 记录已经接收的 task id
+func (c *OnceQueueConfig) dedupKey(hostname string, taskID uint64) string {
+	return fmt.Sprintf("%s:task:%d", c.listKey(hostname), taskID)
+}
+
+// redisOnceQueue 从 redis 列表接收临时任务
+type redisOnceQueue struct {
+	config   *OnceQueueConfig
+	hostname string
+	pool     *redis.Pool
+}
+
+func newRedisOnceQueue(config *OnceQueueConfig, hostname string) *redisOnceQueue {
+	options := []redis.DialOption{
+		redis.DialConnectTimeout(config.DialTimeout),
+		// BLPOP 阻塞期间不能触发读超时
+		redis.DialReadTimeout(config.BlockTimeout + config.DialTimeout),
+		redis.DialWriteTimeout(config.DialTimeout),
+		redis.DialDatabase(config.DB),
+	}
+	if config.Password != "" {
+		options = append(options, redis.DialPassword(config.Password))
+	}
+
+	return &redisOnceQueue{
+		config:   config,
+		hostname: hostname,
+		pool: &redis.Pool{
+			MaxIdle:     1,
+			IdleTimeout: time.Minute,
+			Dial: func() (redis.Conn, error) {
+				return redis.Dial("tcp", config.Addr, options...)
+			},
+		},
+	}
+}
+
+// pop 阻塞等待列表中的下一个任务，超时返回 nil
+func (q *redisOnceQueue) pop() ([]byte, error) {
+	conn := q.pool.Get()
+	defer conn.Close()
+
+	reply, err := redis.ByteSlices(conn.Do("BLPOP", q.config.listKey(q.hostname), int(q.config.BlockTimeout/time.Second)))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// reply 为 [key, value]
+	return reply[1], nil
+}
+
+// claim 记录 task id，已经记录过时返回 false，admin 重复投递的任务不会重复执行
+func (q *redisOnceQueue) claim(taskID uint64) (bool, error) {
+	conn := q.pool.Get()
+	defer conn.Close()
+
+	_, err := redis.String(conn.Do("SET", q.config.dedupKey(q.hostname, taskID), q.hostname, "EX", int(q.config.DedupTTL/time.Second), "NX"))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ack 把确认写入去重记录，admin 按 task id 读取
+func (q *redisOnceQueue) ack(ack *OnceAck) error {
+	conn := q.pool.Get()
+	defer conn.Close()
+
+	data, _ := json.Marshal(ack)
+	_, err := conn.Do("SET", q.config.dedupKey(q.hostname, ack.TaskID), data, "EX", int(q.config.DedupTTL/time.Second))
+	return err
+}
+
+func (q *redisOnceQueue) close() error {
+	return q.pool.Close()
+}
+
+// popOnce 从 redis 列表接收临时任务，直到 worker 停止
+func (w *worker) popOnce() {
+	queue := newRedisOnceQueue(&w.OnceQueue, w.HostName)
+	defer queue.close()
+
+	w.logger.Info("pop once jobs from redis", xlog.String("addr", w.OnceQueue.Addr), xlog.String("key", w.OnceQueue.listKey(w.HostName)))
+
+	backoff := w.Etcd.Backoff
+	for {
+		select {
+		case <-w.done:
+			return
+		default:
+		}
+
+		payload, err := queue.pop()
+		if err != nil {
+			w.logger.Warn("pop once job failed, retry later", xlog.Duration("backoff", backoff), xlog.FieldErr(err))
+			select {
+			case <-time.After(backoff):
+			case <-w.done:
+				return
+			}
+			if backoff *= 2; backoff > w.Etcd.MaxBackoff {
+				backoff = w.Etcd.MaxBackoff
+			}
+			continue
+		}
+		backoff = w.Etcd.Backoff
+		if payload == nil {
+			continue
+		}
+
+		w.runQueuedOnce(queue, payload)
+	}
+}
+
+// runQueuedOnce 执行从队列中接收的临时任务，未指定 task id 时生成新的 id
+func (w *worker) runQueuedOnce(queue *redisOnceQueue, payload []byte) {
+	key := w.OnceQueue.listKey(w.HostName)
+	job, err := w.GetOnceJobFromKv(key, payload)
+	if err != nil {
+		return
+	}
+	if err := w.resolveOnce(job); err != nil {
+		w.logger.Error("resolve once job failed", fieldJob(job.ID), xlog.FieldErr(err))
+		return
+	}
+
+	if job.TaskID == 0 {
+		if job.TaskID, err = w.taskIdGen.NextID(); err != nil {
+			w.logger.Error("generate task id failed", fieldJob(job.ID), xlog.FieldErr(err))
+			return
+		}
+	}
+
+	claimed, err := queue.claim(job.TaskID)
+	if err != nil {
+		// 去重记录写入失败时仍然执行，宁可重复也不丢任务
+		w.logger.Warn("claim once task failed", fieldJob(job.ID), fieldTask(job.TaskID), xlog.FieldErr(err))
+	} else if !claimed {
+		w.logger.Info("once task has been received, skip it", fieldJob(job.ID), fieldTask(job.TaskID))
+		return
+	}
+
+	w.Audit.Record(audit.Entry{
+		Action: audit.ActionOnce,
+		Source: audit.SourceRedis,
+		Node:   w.ID,
+		JobID:  job.ID,
+		TaskID: job.TaskID,
+		Key:    key,
+		After:  maskJobValue(payload, w.redact),
+	})
+
+	err = w.acceptOnce(job)
+	if err != nil {
+		w.logger.Warn("reject once task", fieldJob(job.ID), fieldTask(job.TaskID), xlog.FieldErr(err))
+	}
+	if err := queue.ack(newOnceAck(w.ID, job.TaskID, err)); err != nil {
+		w.logger.Warn("put once ack failed", fieldJob(job.ID), fieldTask(job.TaskID), xlog.FieldErr(err))
+	}
+}
@@ -0,0 +1,49 @@
+package job
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnceQueueConfig(t *testing.T) {
+	config := DefaultConfig()
+	config.OnceQueue.BlockTimeout = 0
+	config.OnceQueue.DedupTTL = 0
+	config.OnceQueue.normalize()
+
+	assert.Equal(t, time.Second, config.OnceQueue.BlockTimeout)
+	assert.Equal(t, 24*time.Hour, config.OnceQueue.DedupTTL)
+	assert.Equal(t, "juno:cronjob:once:node-1", config.OnceQueue.listKey("node-1"))
+	assert.Equal(t, "juno:cronjob:once:node-1:task:42", config.OnceQueue.dedupKey("node-1", 42))
+}
+
+func TestAcceptOnce(t *testing.T) {
+	w := newReplayWorker(t, func(c *Config) {
+		c.OnceQueue.Capacity = 1
+	})
+
+	// 没有启动执行协程，第二个任务超出队列长度
+	first := &OnceJob{Job: Job{ID: "a", Script: "true"}}
+	assert.Nil(t, w.acceptOnce(first))
+	assert.NotZero(t, first.TaskID)
+	second := &OnceJob{Job: Job{ID: "a", Script: "true"}, TaskID: 42}
+	assert.Equal(t, ErrOnceQueueFull, w.acceptOnce(second))
+
+	// 确认写回 once key，保留原始内容
+	key := OnceKeyPrefix + w.HostName
+	w.ackOnce(key, []byte(`{"id": "a", "params": {"day": "1"}}`), newOnceAck(w.ID, 42, ErrOnceQueueFull))
+	kvs, err := w.store.List(context.Background(), key)
+	assert.Nil(t, err)
+	assert.Len(t, kvs, 1)
+
+	acked, err := w.GetOnceJobFromKv(key, kvs[0].Value)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", acked.Params["day"])
+	assert.Equal(t, uint64(42), acked.TaskID)
+	assert.Equal(t, OnceRejected, acked.Ack.Status)
+	assert.Equal(t, ErrOnceQueueFull.Error(), acked.Ack.Reason)
+	assert.Equal(t, "node-1", acked.Ack.Node)
+}
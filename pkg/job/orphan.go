@@ -0,0 +1,101 @@
+package job
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// 检查接管的进程是否结束的间隔
+const orphanPollInterval = time.Second
+
+// CronTaskStatusOrphaned agent 重启前启动的进程，无法获取退出码，按失败处理
+const CronTaskStatusOrphaned CronTaskStatus = "orphaned"
+
+// reconcileProcs 启动时处理重启前当前节点写入的 proc key
+// 进程仍在运行的重新接管，可以被强杀，结束后清理 key；进程已退出的记为 orphaned 并删除 key
+func (w *worker) reconcileProcs() {
+	ctx, cancel := NewEtcdTimeoutContext(w)
+	kvs, err := w.store.List(ctx, ProcKeyPrefix)
+	cancel()
+	if err != nil {
+		w.logger.Warn("list procs failed", xlog.FieldErr(err))
+		return
+	}
+
+	for _, kv := range kvs {
+		proc, err := GetProcFromKey(kv.Key)
+		if err != nil || proc.NodeID != w.ID {
+			continue
+		}
+		if err := json.Unmarshal(kv.Value, &proc.ProcessVal); err != nil {
+			w.logger.Warn("invalid proc value", xlog.String("key", kv.Key), xlog.FieldErr(err))
+		}
+		pid, err := strconv.Atoi(proc.ID)
+		if err != nil {
+			continue
+		}
+
+		job := w.orphanJob(proc.JobID)
+		task := NewTask(job, WithTaskID(proc.TaskID))
+		if !proc.Time.IsZero() {
+			task.executedAt = proc.Time
+		}
+
+		if !processAlive(pid) {
+			w.logger.Warn("orphaned process exited", fieldJob(proc.JobID), fieldTask(proc.TaskID), xlog.Int("pid", pid))
+			ctx, cancel := NewEtcdTimeoutContext(w)
+			if err := w.store.DeleteProc(ctx, kv.Key); err != nil {
+				w.logger.Warn("delete orphaned proc failed", xlog.String("key", kv.Key), xlog.FieldErr(err))
+			}
+			cancel()
+			_ = task.SetStatus(CronTaskStatusOrphaned, "orphaned: process exited while agent was not running")
+			continue
+		}
+
+		w.logger.Info("adopt orphaned process", fieldJob(proc.JobID), fieldTask(proc.TaskID), xlog.Int("pid", pid))
+		go w.adopt(job, task, proc, pid)
+	}
+}
+
+// adopt 重新写入 proc key 并等待进程结束，进程不是当前 agent 的子进程，只能轮询是否存活
+func (w *worker) adopt(job *Job, task *Task, proc *Process, pid int) {
+	// 以当前 session 重新写入，旧 session 的租约过期后 key 不会被删除
+	proc.Start(job)
+	untrack := w.trackRunning(job.ID, task.TaskID, pid)
+
+	ticker := time.NewTicker(orphanPollInterval)
+	defer ticker.Stop()
+	for processAlive(pid) {
+		select {
+		case <-w.done:
+			// agent 再次停止，保留 key 由下次启动接管
+			untrack()
+			return
+		case <-ticker.C:
+		}
+	}
+
+	untrack()
+	proc.Stop(job)
+	_ = task.SetStatus(CronTaskStatusOrphaned, "orphaned: process adopted after agent restart, exit status unknown")
+}
+
+// orphanJob 接管的进程所属的任务，任务已删除时只保留 id
+func (w *worker) orphanJob(id string) *Job {
+	job, ok := w.getJob(id)
+	if !ok {
+		var err error
+		if job, err = w.loadJob(id); err != nil {
+			job = &Job{ID: id}
+		}
+	} else {
+		copied := *job
+		job = &copied
+	}
+	job.worker = w
+	job.runOn = w.ID
+	return job
+}
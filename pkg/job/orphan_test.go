@@ -0,0 +1,86 @@
+//go:build !windows
+// +build !windows
+
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcileProcs(t *testing.T) {
+	config := DefaultConfig()
+	config.HostName = "node-1"
+	config.ReqTimeout = 3
+	config.logger = xlog.DefaultLogger
+	config.Etcd.normalize(config.ReqTimeout, config.RequireLockTime)
+	store := &replayStore{kvs: make(map[string][]byte)}
+	w := &worker{
+		Config:      config,
+		ID:          config.HostName,
+		store:       store,
+		runningJobs: make(map[string]map[uint64]context.CancelFunc),
+		runs:        make(map[string][]*TaskResult),
+		failures:    make(map[string]int),
+		done:        make(chan struct{}),
+	}
+	defer close(w.done)
+
+	// agent 重启前启动、仍在运行的进程
+	running := exec.Command("sleep", "30")
+	running.SysProcAttr = makeCmdAttr()
+	assert.NoError(t, running.Start())
+	exited := make(chan struct{})
+	go func() {
+		_ = running.Wait()
+		close(exited)
+	}()
+	// agent 停止期间已退出的进程
+	dead := exec.Command("true")
+	dead.SysProcAttr = makeCmdAttr()
+	assert.NoError(t, dead.Run())
+
+	putProc := func(jobID string, taskID uint64, pid int) string {
+		proc := &Process{ID: strconv.Itoa(pid), JobID: jobID, NodeID: w.ID, TaskID: taskID}
+		val, _ := json.Marshal(ProcessVal{Time: time.Now().Add(-time.Minute)})
+		assert.NoError(t, store.PutProc(context.Background(), proc.Key(), val))
+		return proc.Key()
+	}
+	runningKey := putProc("a", 1, running.Process.Pid)
+	deadKey := putProc("b", 2, dead.Process.Pid)
+	// 其他节点的进程不处理
+	otherKey := (&Process{ID: "1", JobID: "c", NodeID: "node-2", TaskID: 3}).Key()
+	assert.NoError(t, store.PutProc(context.Background(), otherKey, []byte(`{}`)))
+
+	w.reconcileProcs()
+
+	kvs, _ := store.List(context.Background(), deadKey)
+	assert.Empty(t, kvs)
+	runs, err := w.JobRuns("b")
+	assert.NoError(t, err)
+	assert.Equal(t, CronTaskStatusOrphaned, runs[0].Status)
+
+	// 接管的进程可以被强杀，结束后清理 key
+	assert.Eventually(t, func() bool {
+		return len(w.RunningTasks("a")) == 1
+	}, time.Second, 10*time.Millisecond)
+	killed, err := w.KillTask("a", 1)
+	assert.NoError(t, err)
+	assert.True(t, killed)
+	<-exited
+	assert.Eventually(t, func() bool {
+		runs, _ := w.JobRuns("a")
+		return len(runs) == 1 && runs[0].Status == CronTaskStatusOrphaned
+	}, 5*time.Second, 10*time.Millisecond)
+	kvs, _ = store.List(context.Background(), runningKey)
+	assert.Empty(t, kvs)
+	kvs, _ = store.List(context.Background(), otherKey)
+	assert.Len(t, kvs, 1)
+}
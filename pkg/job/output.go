@@ -0,0 +1,127 @@
+package job
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// 订阅者缓冲的输出块数量，消费过慢的订阅者跳过的输出以提示行的形式告知订阅者
+const outputSubscriberBuffer = 256
+
+var ErrTaskNotRunning = errors.New("task is not running on current node")
+
+// taskOutput 任务执行中的输出，写入的同时推送给订阅者
+type taskOutput struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	subs   map[chan []byte]int // 订阅者 -> 缓冲已满而跳过、尚未告知的字节数
+	closed bool
+	limit  int // 订阅时返回的已有输出的上限，为 0 时不限制
+}
+
+func newTaskOutput(limit int) *taskOutput {
+	return &taskOutput{
+		subs:  make(map[chan []byte]int),
+		limit: limit,
+	}
+}
+
+func (o *taskOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.buf.Write(p)
+	if o.limit > 0 && o.buf.Len() > o.limit {
+		o.buf.Next(o.buf.Len() - o.limit)
+	}
+	for sub, dropped := range o.subs {
+		// channel 多留出提示行的位置，恢复发送及任务结束时总能发出跳过输出的提示
+		if len(sub) >= outputSubscriberBuffer {
+			o.subs[sub] = dropped + len(p)
+			continue
+		}
+		if dropped > 0 {
+			sub <- droppedNotice(dropped)
+			o.subs[sub] = 0
+		}
+		chunk := make([]byte, len(p))
+		copy(chunk, p)
+		sub <- chunk
+	}
+	return len(p), nil
+}
+
+func droppedNotice(dropped int) []byte {
+	return []byte(fmt.Sprintf("\n[%d bytes of output dropped, subscriber is too slow]\n", dropped))
+}
+
+// subscribe 返回已有的输出及后续输出的 channel，任务结束后 channel 关闭
+func (o *taskOutput) subscribe() ([]byte, <-chan []byte, func()) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	history := append([]byte(nil), o.buf.Bytes()...)
+	sub := make(chan []byte, outputSubscriberBuffer+2)
+	if o.closed {
+		close(sub)
+		return history, sub, func() {}
+	}
+
+	o.subs[sub] = 0
+	return history, sub, func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+
+		if _, ok := o.subs[sub]; ok {
+			delete(o.subs, sub)
+			close(sub)
+		}
+	}
+}
+
+func (o *taskOutput) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.closed = true
+	for sub, dropped := range o.subs {
+		if dropped > 0 {
+			sub <- droppedNotice(dropped)
+		}
+		close(sub)
+	}
+	o.subs = nil
+}
+
+// startOutput 记录正在执行的任务输出，返回的函数在任务结束后调用
+func (w *worker) startOutput(taskID uint64) (*taskOutput, func()) {
+	output := newTaskOutput(w.OutputBufferSize)
+
+	w.runsMutex.Lock()
+	w.outputs[taskID] = output
+	w.runsMutex.Unlock()
+
+	return output, func() {
+		w.runsMutex.Lock()
+		delete(w.outputs, taskID)
+		w.runsMutex.Unlock()
+
+		output.close()
+	}
+}
+
+// SubscribeOutput 订阅正在执行的任务输出
+func (w *worker) SubscribeOutput(taskID uint64) ([]byte, <-chan []byte, func(), error) {
+	w.runsMutex.Lock()
+	output, ok := w.outputs[taskID]
+	w.runsMutex.Unlock()
+
+	if !ok {
+		return nil, nil, nil, ErrTaskNotRunning
+	}
+
+	history, ch, cancel := output.subscribe()
+	return history, ch, cancel, nil
+}
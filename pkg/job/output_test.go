@@ -0,0 +1,79 @@
+package job
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskOutput(t *testing.T) {
+	output := newTaskOutput(0)
+	_, _ = output.Write([]byte("line 1\n"))
+
+	history, ch, cancel := output.subscribe()
+	defer cancel()
+	assert.Equal(t, "line 1\n", string(history))
+
+	_, _ = output.Write([]byte("line 2\n"))
+	assert.Equal(t, "line 2\n", string(<-ch))
+
+	output.close()
+	_, ok := <-ch
+	assert.False(t, ok)
+
+	// subscribe after task finished
+	history, ch, _ = output.subscribe()
+	assert.Equal(t, "line 1\nline 2\n", string(history))
+	_, ok = <-ch
+	assert.False(t, ok)
+}
+
+func TestTaskOutputSlowSubscriber(t *testing.T) {
+	output := newTaskOutput(0)
+	_, ch, cancel := output.subscribe()
+	defer cancel()
+
+	for i := 0; i < outputSubscriberBuffer+10; i++ {
+		_, _ = output.Write([]byte("x"))
+	}
+	output.close()
+
+	var chunks []string
+	for chunk := range ch {
+		chunks = append(chunks, string(chunk))
+	}
+	assert.Len(t, chunks, outputSubscriberBuffer+1)
+	assert.Equal(t, "\n[10 bytes of output dropped, subscriber is too slow]\n", chunks[len(chunks)-1])
+}
+
+func TestTaskRun(t *testing.T) {
+	w := &worker{Config: DefaultConfig(), runs: make(map[string][]*TaskResult), failures: make(map[string]int)}
+	job := &Job{ID: "a"}
+	w.recordRun(&TaskResult{TaskID: 1, Job: job, Status: CronTaskStatusProcessing})
+	w.recordRun(&TaskResult{TaskID: 2, Job: job, Status: CronTaskStatusProcessing, Logs: "done"})
+
+	run, err := w.TaskRun(2)
+	assert.Nil(t, err)
+	assert.Equal(t, "done", run.Logs)
+
+	_, err = w.TaskRun(3)
+	assert.Equal(t, ErrTaskNotFound, err)
+}
+
+func TestKillTask(t *testing.T) {
+	w := &worker{runningJobs: make(map[string]map[uint64]context.CancelFunc)}
+	killed := 0
+	w.runningJobs["a"] = map[uint64]context.CancelFunc{42: func() { killed++ }}
+
+	jobID, err := w.killTask("", 42)
+	assert.Nil(t, err)
+	assert.Equal(t, "a", jobID)
+	assert.Equal(t, 1, killed)
+
+	_, err = w.killTask("b", 42)
+	assert.Equal(t, ErrTaskNotRunning, err)
+	_, err = w.killTask("", 43)
+	assert.Equal(t, ErrTaskNotRunning, err)
+	assert.Equal(t, "/juno/cronjob/kill/node-1/42", KillTaskKey("node-1", 42))
+}
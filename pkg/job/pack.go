@@ -0,0 +1,242 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/gitsync"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+const (
+	PackKeyPrefix = "/juno/cronjob/pack/" // 任务包同步的锁及状态
+	packLockKey   = PackKeyPrefix + "lock"
+	packStateKey  = PackKeyPrefix + "state"
+)
+
+// PackConfig 从 git 仓库同步任务定义写入任务存储，与管理端写入的任务共存
+// 多个节点开启时通过锁保证同一时间只有一个节点同步
+type PackConfig struct {
+	Enable   bool
+	Repo     string        // 仓库地址
+	Ref      string        // 固定的分支或 tag
+	Dir      string        // 仓库中存放任务定义的目录，每个 .json 文件为一个任务
+	CacheDir string        // 本地克隆目录
+	Interval time.Duration // 同步间隔
+	Verify   bool          // 校验提交或 tag 的签名，需在节点上导入可信的 gpg 公钥，默认开启
+	Prune    bool          // 删除之前同步、但已从仓库中移除的任务
+	IDPrefix string        // 任务包中任务 id 的前缀，与管理端写入的任务区分，不以该前缀开头的任务定义被拒绝
+}
+
+func (c *PackConfig) normalize() {
+	if c.Dir == "" {
+		c.Dir = "jobs"
+	}
+	if c.Interval < time.Minute {
+		c.Interval = time.Minute
+	}
+	if c.IDPrefix == "" {
+		c.IDPrefix = "pack-"
+	}
+}
+
+// PackState 最近一次同步的提交及写入的任务，用于清理从仓库中移除的任务
+type PackState struct {
+	Repo     string    `json:"repo"`
+	Ref      string    `json:"ref"`
+	Commit   string    `json:"commit"`
+	Jobs     []string  `json:"jobs"`
+	SyncedAt time.Time `json:"synced_at"`
+}
+
+// syncPacks 按间隔同步任务包，worker 停止后退出
+func (w *worker) syncPacks() {
+	for {
+		if err := w.syncPack(); err != nil {
+			w.logger.Error("sync job pack failed", xlog.String("repo", w.Pack.Repo), xlog.String("ref", w.Pack.Ref), xlog.FieldErr(err))
+		}
+
+		select {
+		case <-time.After(w.Pack.Interval):
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *worker) syncPack() error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.Pack.Interval)
+	defer cancel()
+
+	unlock, err := w.store.Lock(ctx, packLockKey)
+	if err != nil {
+		return fmt.Errorf("lock: %w", err)
+	}
+	defer func() {
+		_ = unlock()
+	}()
+
+	commit, err := gitsync.Fetch(ctx, gitsync.Source{
+		Repo:   w.Pack.Repo,
+		Ref:    w.Pack.Ref,
+		Dir:    w.Pack.CacheDir,
+		Verify: w.Pack.Verify,
+	})
+	if err != nil {
+		return err
+	}
+
+	state, err := w.packState(ctx)
+	if err != nil {
+		return err
+	}
+	if state.Commit == commit && state.Repo == w.Pack.Repo {
+		return nil
+	}
+
+	jobs, err := readPack(filepath.Join(w.Pack.CacheDir, w.Pack.Dir), w.Pack.IDPrefix)
+	if err != nil {
+		return err
+	}
+	if err := w.checkPackJobs(ctx, jobs, state); err != nil {
+		return err
+	}
+
+	next := PackState{Repo: w.Pack.Repo, Ref: w.Pack.Ref, Commit: commit, SyncedAt: time.Now()}
+	for _, job := range jobs {
+		if err := w.putPackJob(ctx, job); err != nil {
+			return err
+		}
+		next.Jobs = append(next.Jobs, job.ID)
+	}
+
+	if w.Pack.Prune {
+		imported := make(map[string]bool, len(next.Jobs))
+		for _, id := range next.Jobs {
+			imported[id] = true
+		}
+		for _, id := range state.Jobs {
+			if imported[id] {
+				continue
+			}
+			if err := w.store.Delete(ctx, JobsKeyPrefix+id); err != nil {
+				return err
+			}
+			w.logger.Info("job removed from pack", fieldJob(id), xlog.String("commit", commit))
+		}
+	}
+
+	data, _ := json.Marshal(next)
+	if err := w.store.Put(ctx, packStateKey, data); err != nil {
+		return err
+	}
+	w.logger.Info("job pack synced", xlog.String("repo", w.Pack.Repo), xlog.String("commit", commit), xlog.Int("jobs", len(next.Jobs)))
+	return nil
+}
+
+func (w *worker) packState(ctx context.Context) (*PackState, error) {
+	state := &PackState{}
+	kvs, err := w.store.List(ctx, packStateKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range kvs {
+		if kv.Key == packStateKey {
+			if err := json.Unmarshal(kv.Value, state); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return state, nil
+}
+
+// checkPackJobs 任务包不覆盖管理端写入的任务，已存在且不是之前由任务包同步的任务时整个任务包不同步
+func (w *worker) checkPackJobs(ctx context.Context, jobs []*packJob, state *PackState) error {
+	synced := make(map[string]bool, len(state.Jobs))
+	for _, id := range state.Jobs {
+		synced[id] = true
+	}
+	for _, job := range jobs {
+		if synced[job.ID] {
+			continue
+		}
+		key := JobsKeyPrefix + job.ID
+		kvs, err := w.store.List(ctx, key)
+		if err != nil {
+			return err
+		}
+		for _, kv := range kvs {
+			if kv.Key == key && !bytes.Equal(kv.Value, job.data) {
+				return fmt.Errorf("job %s already exists and is not managed by the pack", job.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// putPackJob 内容未变化时不写入，避免触发各节点重新加载任务
+func (w *worker) putPackJob(ctx context.Context, job *packJob) error {
+	key := JobsKeyPrefix + job.ID
+	kvs, err := w.store.List(ctx, key)
+	if err != nil {
+		return err
+	}
+	for _, kv := range kvs {
+		if kv.Key == key && bytes.Equal(kv.Value, job.data) {
+			return nil
+		}
+	}
+	return w.store.Put(ctx, key, job.data)
+}
+
+type packJob struct {
+	ID   string
+	data []byte
+}
+
+// readPack 读取并校验目录下的任务定义，任一文件不合法时整个任务包不同步
+// 任务 id 需以 prefix 开头，id 不做改写，以免管理端的签名失效
+func readPack(dir, prefix string) ([]*packJob, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	jobs := make([]*packJob, 0, len(files))
+	ids := make(map[string]string, len(files))
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		job, err := ParseJob(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+		if job.ID == "" {
+			return nil, fmt.Errorf("%s: empty job id", filepath.Base(file))
+		}
+		if !strings.HasPrefix(job.ID, prefix) {
+			return nil, fmt.Errorf("%s: job id %s should start with %s", filepath.Base(file), job.ID, prefix)
+		}
+		if other, ok := ids[job.ID]; ok {
+			return nil, fmt.Errorf("%s: job id %s already defined in %s", filepath.Base(file), job.ID, other)
+		}
+		ids[job.ID] = filepath.Base(file)
+
+		// 重新编码，去掉格式上的差异，保留原有字段以免管理端的签名失效
+		if data, err = canonicalJSON(data); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &packJob{ID: job.ID, data: data})
+	}
+	return jobs, nil
+}
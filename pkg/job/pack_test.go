@@ -0,0 +1,92 @@
+package job
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/gitsync"
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncPack(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir, err := ioutil.TempDir("", "pack")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	repo := filepath.Join(dir, "repo")
+	assert.NoError(t, os.MkdirAll(filepath.Join(repo, "jobs"), 0755))
+	commit := func(files map[string]string) {
+		for name, content := range files {
+			path := filepath.Join(repo, "jobs", name)
+			if content == "" {
+				assert.NoError(t, os.Remove(path))
+				continue
+			}
+			assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		}
+		for _, args := range [][]string{
+			{"add", "-A"},
+			{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "update jobs"},
+		} {
+			_, err := gitsync.Run(context.Background(), repo, args...)
+			assert.NoError(t, err)
+		}
+	}
+	_, err = gitsync.Run(context.Background(), repo, "init", "-q")
+	assert.NoError(t, err)
+	commit(map[string]string{
+		"backup.json":  `{"id":"pack-backup","script":"/opt/backup.sh","timers":[{"id":"1","timer":"0 0 3 * * *"}],"enable":true}`,
+		"cleanup.json": `{"id":"pack-cleanup","script":"/opt/cleanup.sh","timers":[{"id":"1","timer":"@hourly"}],"enable":true}`,
+	})
+	branch, err := gitsync.Run(context.Background(), repo, "rev-parse", "--abbrev-ref", "HEAD")
+	assert.NoError(t, err)
+
+	config := DefaultConfig()
+	config.logger = xlog.DefaultLogger
+	config.Pack = PackConfig{Repo: repo, Ref: branch, CacheDir: filepath.Join(dir, "cache"), Prune: true}
+	config.Pack.normalize()
+	store := &replayStore{kvs: make(map[string][]byte)}
+	w := &worker{Config: config, store: store}
+
+	// 管理端写入的同名任务不被覆盖
+	admin := []byte(`{"id":"pack-backup","script":"/opt/admin.sh"}`)
+	assert.NoError(t, store.Put(context.Background(), JobsKeyPrefix+"pack-backup", admin))
+	assert.Error(t, w.syncPack())
+	kvs, _ := store.List(context.Background(), JobsKeyPrefix)
+	assert.Len(t, kvs, 1)
+	assert.Equal(t, admin, kvs[0].Value)
+	assert.NoError(t, store.Delete(context.Background(), JobsKeyPrefix+"pack-backup"))
+
+	assert.NoError(t, w.syncPack())
+	kvs, _ = store.List(context.Background(), JobsKeyPrefix)
+	assert.Len(t, kvs, 2)
+
+	commit(map[string]string{"cleanup.json": ""})
+	assert.NoError(t, w.syncPack())
+	kvs, _ = store.List(context.Background(), JobsKeyPrefix)
+	assert.Len(t, kvs, 1)
+	assert.Equal(t, JobsKeyPrefix+"pack-backup", kvs[0].Key)
+
+	state, err := w.packState(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pack-backup"}, state.Jobs)
+	assert.WithinDuration(t, time.Now(), state.SyncedAt, time.Minute)
+
+	// 不合法的任务定义使整个任务包不同步
+	commit(map[string]string{"broken.json": `{"id":"pack-broken","timers":[{"id":"1","timer":"bad"}]}`})
+	assert.Error(t, w.syncPack())
+
+	// 任务 id 不以前缀开头时不同步
+	commit(map[string]string{"broken.json": "", "report.json": `{"id":"report","script":"/opt/report.sh","timers":[{"id":"1","timer":"@daily"}],"enable":true}`})
+	assert.Error(t, w.syncPack())
+}
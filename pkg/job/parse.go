@@ -0,0 +1,83 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// etcd 中的任务内容由外部写入，解析前限制大小及 JSON 嵌套深度
+const (
+	maxJobSize   = 4 << 20
+	maxJSONDepth = 32
+)
+
+var (
+	ErrJobTooLarge = errors.New("job content too large")
+	ErrJSONTooDeep = errors.New("job content nested too deep")
+)
+
+// ParseJob 解析并校验任务内容，非法输入只返回错误，不会 panic
+func ParseJob(data []byte) (*Job, error) {
+	job := &Job{}
+	if err := parseJSON(data, job, job.ValidRules); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ParseOnceJob 解析并校验临时任务内容
+func ParseOnceJob(data []byte) (*OnceJob, error) {
+	job := &OnceJob{}
+	if err := parseJSON(data, job, job.ValidRules); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func parseJSON(data []byte, v interface{}, valid func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parse job panic: %v", r)
+		}
+	}()
+
+	if len(data) > maxJobSize {
+		return ErrJobTooLarge
+	}
+	if err := checkJSONDepth(data, maxJSONDepth); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	return valid()
+}
+
+// checkJSONDepth 检查对象、数组的嵌套深度，忽略字符串中的括号，语法错误留给 json.Unmarshal
+func checkJSONDepth(data []byte, max int) error {
+	depth := 0
+	inString, escaped := false, false
+	for _, c := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch c {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			if depth++; depth > max {
+				return ErrJSONTooDeep
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+	return nil
+}
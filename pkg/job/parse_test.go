@@ -0,0 +1,28 @@
+package job
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJob(t *testing.T) {
+	job, err := ParseJob([]byte(`{"id":"1","timers":[{"id":"t1","timer":"*/5 * * * * *"}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "1", job.ID)
+
+	// 时区后缺少 cron 表达式，曾导致 parser panic
+	_, err = ParseJob([]byte(`{"id":"1","timers":[{"id":"t1","timer":"TZ="}]}`))
+	assert.Error(t, err)
+
+	_, err = ParseJob([]byte(strings.Repeat("[", maxJSONDepth+1)))
+	assert.Equal(t, ErrJSONTooDeep, err)
+
+	// 字符串中的括号不计入深度
+	_, err = ParseOnceJob([]byte(`{"id":"1","script":"` + strings.Repeat("[", maxJSONDepth+1) + `"}`))
+	assert.NoError(t, err)
+
+	_, err = ParseJob(make([]byte, maxJobSize+1))
+	assert.Equal(t, ErrJobTooLarge, err)
+}
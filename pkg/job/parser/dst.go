@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// DSTPolicy decides how a schedule behaves when a daylight saving transition
+// removes or repeats local times.
+type DSTPolicy string
+
+const (
+	// DSTLegacy keeps the plain SpecSchedule behavior: local times inside the
+	// spring-forward gap never fire and times in the fall-back hour fire twice.
+	DSTLegacy DSTPolicy = ""
+	// DSTSkip never fires for local times that do not exist, and fires only the
+	// first occurrence of repeated local times.
+	DSTSkip DSTPolicy = "skip"
+	// DSTRunOnce fires once at the end of the gap for local times that do not
+	// exist, and only the first occurrence of repeated local times.
+	DSTRunOnce DSTPolicy = "run-once"
+	// DSTRunTwice fires once at the end of the gap for local times that do not
+	// exist, and both occurrences of repeated local times.
+	DSTRunTwice DSTPolicy = "run-twice"
+)
+
+// Valid returns an error for unknown policies.
+func (p DSTPolicy) Valid() error {
+	switch p {
+	case DSTLegacy, DSTSkip, DSTRunOnce, DSTRunTwice:
+		return nil
+	}
+	return fmt.Errorf("invalid dst policy %q, should be skip, run-once or run-twice", string(p))
+}
+
+// DSTSchedule matches the spec against the wall clock of its location, so the
+// result of a transition depends only on the policy, not on the host timezone
+// or on how far apart the fields are incremented.
+type DSTSchedule struct {
+	*SpecSchedule
+	Policy DSTPolicy
+
+	wall *SpecSchedule
+}
+
+// WithDST wraps cron spec schedules with the policy. Other schedules and the
+// legacy policy are returned unchanged.
+func WithDST(schedule cron.Schedule, policy DSTPolicy) cron.Schedule {
+	spec, ok := schedule.(*SpecSchedule)
+	if !ok || policy == DSTLegacy {
+		return schedule
+	}
+	wall := *spec
+	wall.Location = time.UTC
+	return &DSTSchedule{SpecSchedule: spec, Policy: policy, wall: &wall}
+}
+
+// Next returns the next activation time after t, in the location of t.
+func (s *DSTSchedule) Next(t time.Time) time.Time {
+	loc := s.Location
+	if loc == time.Local {
+		loc = t.Location()
+	}
+
+	next := s.nextOnce(t, loc)
+	if s.Policy == DSTRunTwice {
+		// The plain schedule walks real time, so it also finds the second
+		// occurrence of a repeated local time, which nextOnce skips.
+		if again := s.SpecSchedule.Next(t); !again.IsZero() && (next.IsZero() || again.Before(next)) {
+			return again
+		}
+	}
+	return next
+}
+
+func (s *DSTSchedule) nextOnce(t time.Time, loc *time.Location) time.Time {
+	wall := wallClock(t, loc)
+	for {
+		if wall = s.wall.Next(wall); wall.IsZero() {
+			return wall
+		}
+
+		instants := resolveWallClock(wall, loc)
+		if len(instants) == 0 {
+			if s.Policy == DSTSkip {
+				continue
+			}
+			return gapEnd(wall, loc).In(t.Location())
+		}
+		// A repeated local time whose first occurrence is already past has
+		// fired before, t is inside the repeated hour.
+		if instants[0].After(t) {
+			return instants[0].In(t.Location())
+		}
+	}
+}
+
+// wallClock returns the local time of t in loc as a UTC time with the same fields.
+func wallClock(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+// resolveWallClock returns the instants, in order, at which the wall clock of
+// loc shows wall: none inside a gap, two inside a repeated hour.
+func resolveWallClock(wall time.Time, loc *time.Location) []time.Time {
+	instants := make([]time.Time, 0, 2)
+	offsets := make(map[int]bool, 2)
+	// UTC offsets are within -12h and +14h, so the offsets in effect around
+	// wall are found at these instants.
+	for _, probe := range []time.Duration{-14 * time.Hour, 0, 12 * time.Hour} {
+		_, offset := wall.Add(probe).In(loc).Zone()
+		if offsets[offset] {
+			continue
+		}
+		offsets[offset] = true
+
+		instant := wall.Add(-time.Duration(offset) * time.Second)
+		if wallClock(instant, loc).Equal(wall) {
+			instants = append(instants, instant)
+		}
+	}
+	if len(instants) == 2 && instants[1].Before(instants[0]) {
+		instants[0], instants[1] = instants[1], instants[0]
+	}
+	return instants
+}
+
+// gapEnd returns the transition instant of the gap that contains wall.
+func gapEnd(wall time.Time, loc *time.Location) time.Time {
+	_, before := wall.Add(-14 * time.Hour).In(loc).Zone()
+	_, after := wall.Add(12 * time.Hour).In(loc).Zone()
+	lo := wall.Add(-time.Duration(after) * time.Second)
+	hi := wall.Add(-time.Duration(before) * time.Second)
+	for hi.Sub(lo) > time.Second {
+		mid := lo.Add(hi.Sub(lo) / 2).Truncate(time.Second)
+		if _, offset := mid.In(loc).Zone(); offset == after {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi
+}
@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fires returns the activations of spec under the policy between from and to.
+func fires(t *testing.T, spec string, policy DSTPolicy, from, to time.Time) []string {
+	p := NewParser(Second | Minute | Hour | Dom | Month | Dow)
+	schedule, err := p.Parse(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule = WithDST(schedule, policy)
+
+	out := make([]string, 0)
+	for next := schedule.Next(from); !next.IsZero() && next.Before(to); next = schedule.Next(next) {
+		out = append(out, next.Format("01-02 15:04 MST"))
+	}
+	return out
+}
+
+func TestDSTPolicy(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("tzdata not available")
+	}
+
+	// 2020-03-08 02:00 EST jumps to 03:00 EDT
+	springFrom := time.Date(2020, 3, 7, 12, 0, 0, 0, loc)
+	springTo := time.Date(2020, 3, 8, 12, 0, 0, 0, loc)
+	// 2020-11-01 02:00 EDT falls back to 01:00 EST
+	fallFrom := time.Date(2020, 10, 31, 12, 0, 0, 0, loc)
+	fallTo := time.Date(2020, 11, 1, 12, 0, 0, 0, loc)
+
+	const daily = "0 30 2 * * *"
+	const fallDaily = "0 30 1 * * *"
+	tests := []struct {
+		policy DSTPolicy
+		spring []string
+		fall   []string
+	}{
+		{DSTLegacy, []string{}, []string{"11-01 01:30 EDT", "11-01 01:30 EST"}},
+		{DSTSkip, []string{}, []string{"11-01 01:30 EDT"}},
+		{DSTRunOnce, []string{"03-08 03:00 EDT"}, []string{"11-01 01:30 EDT"}},
+		{DSTRunTwice, []string{"03-08 03:00 EDT"}, []string{"11-01 01:30 EDT", "11-01 01:30 EST"}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.spring, fires(t, daily, test.policy, springFrom, springTo), "spring %q", test.policy)
+		assert.Equal(t, test.fall, fires(t, fallDaily, test.policy, fallFrom, fallTo), "fall %q", test.policy)
+	}
+
+	// Several activations inside the gap fire once when it ends.
+	assert.Equal(t, []string{"03-08 01:45 EST", "03-08 03:00 EDT", "03-08 03:15 EDT"},
+		fires(t, "0 */15 * * * *", DSTRunOnce, time.Date(2020, 3, 8, 1, 40, 0, 0, loc), time.Date(2020, 3, 8, 3, 20, 0, 0, loc)))
+
+	// The result does not depend on the host timezone.
+	utcFrom := springFrom.In(time.UTC)
+	schedule, _ := NewParser(Second | Minute | Hour | Dom | Month | Dow).Parse("TZ=America/New_York " + daily)
+	next := WithDST(schedule, DSTRunOnce).Next(utcFrom)
+	assert.Equal(t, time.UTC, next.Location())
+	assert.Equal(t, "03-08 03:00 EDT", next.In(loc).Format("01-02 15:04 MST"))
+
+	assert.Error(t, DSTPolicy("twice").Valid())
+}
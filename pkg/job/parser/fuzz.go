@@ -0,0 +1,13 @@
+//go:build gofuzz
+// +build gofuzz
+
+package parser
+
+// Fuzz is the go-fuzz entry of cron specs of job timers
+func Fuzz(data []byte) int {
+	p := NewParser(Second | Minute | Hour | Dom | Month | Dow | Descriptor)
+	if _, err := p.Parse(string(data)); err != nil {
+		return 0
+	}
+	return 1
+}
@@ -98,6 +98,9 @@ func (p Parser) Parse(spec string) (cron.Schedule, error) {
 		var err error
 		i := strings.Index(spec, " ")
 		eq := strings.Index(spec, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("missing spec after timezone: %s", spec)
+		}
 		if loc, err = time.LoadLocation(spec[eq+1 : i]); err != nil {
 			return nil, fmt.Errorf("provided bad location %s: %v", spec[eq+1:i], err)
 		}
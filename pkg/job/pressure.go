@@ -0,0 +1,36 @@
+package job
+
+import (
+	"github.com/douyu/juno-agent/pkg/audit"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// admit 节点压力过高时推迟执行，等待超过 DeferTimeout 压力仍未缓解则放弃本次执行
+func (c *Cmd) admit() bool {
+	pressured, reason := c.Pressure.Pressured()
+	if !pressured {
+		return true
+	}
+
+	c.logger.Info("defer best effort job", fieldJob(c.Job.ID), xlog.String("reason", reason))
+	c.recordShed(audit.ActionDefer, reason)
+	if c.Pressure.Wait(c.done) {
+		return true
+	}
+
+	_, reason = c.Pressure.Pressured()
+	c.logger.Warn("shed best effort job", fieldJob(c.Job.ID), xlog.String("reason", reason))
+	c.recordShed(audit.ActionShed, reason)
+	return false
+}
+
+func (c *Cmd) recordShed(decision string, reason string) {
+	jobShedCounter.Inc(c.Job.ID, decision)
+	c.Audit.Record(audit.Entry{
+		Action: decision,
+		Source: audit.SourceAgent,
+		Node:   c.worker.ID,
+		JobID:  c.Job.ID,
+		Reason: reason,
+	})
+}
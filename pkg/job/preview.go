@@ -0,0 +1,104 @@
+package job
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/job/parser"
+)
+
+const (
+	defaultPreviewCount = 10
+	maxPreviewCount     = 100
+)
+
+// TimerPreview 定时规则接下来的触发时间，时间使用规则中 TZ= 指定的时区，未指定时为节点的时区
+type TimerPreview struct {
+	Timer       string      `json:"timer"`
+	Location    string      `json:"location"`
+	Next        []time.Time `json:"next"`
+	MinInterval string      `json:"min_interval"` // 接下来几次触发间最短的间隔，只触发一次时为空
+}
+
+// PreviewTimer 校验定时规则并返回 from 之后的 count 次触发时间
+func PreviewTimer(timer string, count int, from time.Time) (*TimerPreview, error) {
+	if count <= 0 {
+		count = defaultPreviewCount
+	}
+	if count > maxPreviewCount {
+		count = maxPreviewCount
+	}
+
+	schedule, err := myParser.Parse(timer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timer %q: %w", timer, err)
+	}
+
+	loc := time.Local
+	if spec, ok := schedule.(*parser.SpecSchedule); ok && spec.Location != nil {
+		loc = spec.Location
+	}
+
+	preview := &TimerPreview{Timer: timer, Location: loc.String(), Next: make([]time.Time, 0, count)}
+	next := from.In(loc)
+	for len(preview.Next) < count {
+		if next = schedule.Next(next); next.IsZero() {
+			break
+		}
+		preview.Next = append(preview.Next, next)
+	}
+	if interval := timerInterval(schedule, from); interval > 0 {
+		preview.MinInterval = interval.String()
+	}
+	return preview, nil
+}
+
+// timerInterval 取接下来几次触发中最短的间隔，覆盖 "0 0,1 * * * *" 这类不均匀的表达式
+// 只触发一次或不再触发时返回 0
+func timerInterval(schedule Schedule, from time.Time) time.Duration {
+	var min time.Duration
+	next := schedule.Next(from)
+	for n := 0; n < 10 && !next.IsZero(); n++ {
+		following := schedule.Next(next)
+		if following.IsZero() {
+			break
+		}
+		if interval := following.Sub(next); min == 0 || interval < min {
+			min = interval
+		}
+		next = following
+	}
+	return min
+}
+
+// validInterval 触发间隔小于 floor 时返回错误，floor 为 0 时不限制
+func validInterval(timer string, schedule Schedule, floor time.Duration) error {
+	if floor <= 0 {
+		return nil
+	}
+	if interval := timerInterval(schedule, time.Now()); interval > 0 && interval < floor {
+		return fmt.Errorf("invalid Timer[%s], fires every %s, less than %s", timer, interval, floor)
+	}
+	return nil
+}
+
+// minTimerInterval 节点允许的最短触发间隔，重新加载配置时更新
+func (w *worker) minTimerInterval() time.Duration {
+	w.reloadMutex.RLock()
+	defer w.reloadMutex.RUnlock()
+	return w.MinTimerInterval
+}
+
+// validIntervals 检查任务的定时规则是否满足节点允许的最短触发间隔，定时规则已由 ValidRules 解析
+func (w *worker) validIntervals(job *Job) error {
+	floor := w.minTimerInterval()
+	for _, timer := range job.Timers {
+		if timer.Schedule == nil {
+			continue
+		}
+		if err := validInterval(timer.Cron, timer.Schedule, floor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
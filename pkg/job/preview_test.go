@@ -0,0 +1,56 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreviewTimer(t *testing.T) {
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	preview, err := PreviewTimer("TZ=Asia/Shanghai 0 30 9 * * *", 3, from)
+	assert.NoError(t, err)
+	assert.Equal(t, "Asia/Shanghai", preview.Location)
+	assert.Len(t, preview.Next, 3)
+	assert.Equal(t, "2020-01-01T09:30:00+08:00", preview.Next[0].Format(time.RFC3339))
+	assert.Equal(t, "2020-01-02T09:30:00+08:00", preview.Next[1].Format(time.RFC3339))
+	assert.Equal(t, "24h0m0s", preview.MinInterval)
+
+	preview, err = PreviewTimer("0 0,1 * * * *", 0, from)
+	assert.NoError(t, err)
+	assert.Len(t, preview.Next, defaultPreviewCount)
+	assert.Equal(t, "1m0s", preview.MinInterval)
+
+	_, err = PreviewTimer("bad", 1, from)
+	assert.Error(t, err)
+}
+
+func TestMinTimerInterval(t *testing.T) {
+	config := DefaultConfig()
+	config.MinTimerInterval = 10 * time.Second
+	config.logger = xlog.DefaultLogger
+	w := &worker{Config: config, store: &replayStore{kvs: make(map[string][]byte)}}
+
+	for timer, valid := range map[string]bool{
+		"* * * * * *":    false,
+		"*/5 * * * * *":  false,
+		"*/10 * * * * *": true,
+		"@hourly":        true,
+	} {
+		_, err := w.GetJobContentFromKv(JobsKeyPrefix+"report", []byte(`{"id":"report","timers":[{"id":"1","timer":"`+timer+`"}]}`))
+		assert.Equal(t, valid, err == nil, timer)
+	}
+	// 定时规则本身不受节点配置影响
+	assert.NoError(t, (&Timer{Cron: "* * * * * *"}).Valid())
+
+	// lint 使用节点与 lint 策略中较大的间隔
+	problems := w.Lint(&Job{ID: "report", Timers: []*Timer{{Cron: "*/5 * * * * *"}}})
+	found := false
+	for _, p := range problems {
+		found = found || p.Field == "timers[0]"
+	}
+	assert.True(t, found)
+}
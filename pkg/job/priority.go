@@ -0,0 +1,58 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// IO 调度类别，对应 ionice -c
+const (
+	IOClassRealtime   = "realtime"
+	IOClassBestEffort = "best-effort"
+	IOClassIdle       = "idle" // 只在磁盘空闲时得到 IO，适合备份等不影响其他服务的任务
+)
+
+// Priority 任务进程的 CPU 及 IO 调度优先级，在 exec 任务命令前设置，子进程一并继承，为空的项继承 agent 的优先级
+type Priority struct {
+	Nice    *int   `json:"nice"`     // -20 至 19，越大优先级越低，小于 0 需要 agent 有 CAP_SYS_NICE
+	IOClass string `json:"io_class"` // realtime、best-effort 或 idle
+	IOLevel int    `json:"io_level"` // 0 至 7，越大优先级越低，idle 时忽略
+}
+
+func (p *Priority) Valid() error {
+	if !prioritySupported {
+		return errors.New("priority is not supported on current platform")
+	}
+	if p.Nice != nil && (*p.Nice < -20 || *p.Nice > 19) {
+		return fmt.Errorf("invalid nice %d, should be -20 to 19", *p.Nice)
+	}
+	switch p.IOClass {
+	case "", IOClassRealtime, IOClassBestEffort, IOClassIdle:
+	default:
+		return fmt.Errorf("invalid io_class %q, should be realtime, best-effort or idle", p.IOClass)
+	}
+	if p.IOLevel < 0 || p.IOLevel > 7 {
+		return fmt.Errorf("invalid io_level %d, should be 0 to 7", p.IOLevel)
+	}
+	if p.IOClass != "" && !ioPrioritySupported {
+		return errors.New("io_class is not supported on current platform")
+	}
+	return nil
+}
+
+// startWithPriority 在单独的线程上设置优先级后启动 cmd，子进程 fork 时继承该线程的优先级，exec 前即已生效。
+// 设置失败时仍以继承的优先级启动，错误通过 prioErr 返回。
+// 线程的优先级不恢复，goroutine 不解锁线程直接退出，线程随之销毁，不影响 agent 的其他 goroutine
+func startWithPriority(cmd *exec.Cmd, p *Priority) (prioErr, err error) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runtime.LockOSThread()
+		prioErr = setThreadPriority(p)
+		err = cmd.Start()
+	}()
+	<-done
+	return prioErr, err
+}
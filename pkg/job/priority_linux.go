@@ -0,0 +1,44 @@
+package job
+
+import (
+	"fmt"
+	"syscall"
+)
+
+const (
+	prioritySupported   = true
+	ioPrioritySupported = true
+)
+
+// ioprio_set 的参数，见 linux/ioprio.h
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+var ioClasses = map[string]int{
+	IOClassRealtime:   1,
+	IOClassBestEffort: 2,
+	IOClassIdle:       3,
+}
+
+// setThreadPriority 设置当前线程的优先级，nice 及 IO 优先级在 linux 上都按线程生效，fork 出的子进程继承
+func setThreadPriority(p *Priority) error {
+	tid := syscall.Gettid()
+	if p.Nice != nil {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, *p.Nice); err != nil {
+			return fmt.Errorf("set nice: %w", err)
+		}
+	}
+	if p.IOClass != "" {
+		level := p.IOLevel
+		if p.IOClass == IOClassIdle {
+			level = 0
+		}
+		prio := ioClasses[p.IOClass]<<ioprioClassShift | level
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(prio)); errno != 0 {
+			return fmt.Errorf("set io priority: %w", errno)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package job
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetPriority(t *testing.T) {
+	nice := 5
+	priority := &Priority{Nice: &nice, IOClass: IOClassIdle}
+	assert.NoError(t, priority.Valid())
+
+	before, err := syscall.Getpriority(syscall.PRIO_PROCESS, 0)
+	assert.NoError(t, err)
+
+	cmd := exec.Command("sleep", "5")
+	cmd.SysProcAttr = makeCmdAttr()
+	prioErr, err := startWithPriority(cmd, priority)
+	assert.NoError(t, prioErr)
+	assert.NoError(t, err)
+	defer func() {
+		_ = killProcess(cmd.Process.Pid)
+		_ = cmd.Wait()
+	}()
+
+	// 进程启动时即为设置的优先级，系统调用返回 20 - nice
+	prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, cmd.Process.Pid)
+	assert.NoError(t, err)
+	assert.Equal(t, nice, 20-prio)
+	// agent 自身的优先级不变
+	after, err := syscall.Getpriority(syscall.PRIO_PROCESS, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	invalid := -21
+	assert.Error(t, (&Priority{Nice: &invalid}).Valid())
+	assert.Error(t, (&Priority{IOClass: "low"}).Valid())
+	assert.Error(t, (&Priority{IOClass: IOClassBestEffort, IOLevel: 8}).Valid())
+}
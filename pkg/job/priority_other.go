@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package job
+
+import "errors"
+
+const (
+	prioritySupported   = false
+	ioPrioritySupported = false
+)
+
+func setThreadPriority(p *Priority) error {
+	return errors.New("priority is not supported on current platform")
+}
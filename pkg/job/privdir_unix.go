@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+package job
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// privateDir 创建只有 agent 用户可以访问的目录，已存在时要求不是软链接且属于 agent 用户，
+// 避免其他用户预先在 /tmp 下创建同名目录后替换其中的文件
+func privateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Geteuid() {
+		return fmt.Errorf("%s is owned by uid %d, not the agent", dir, stat.Uid)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return os.Chmod(dir, 0700)
+	}
+	return nil
+}
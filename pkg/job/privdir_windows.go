@@ -0,0 +1,21 @@
+package job
+
+import (
+	"fmt"
+	"os"
+)
+
+// privateDir windows 下目录权限由 ACL 控制，只检查不是软链接
+func privateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
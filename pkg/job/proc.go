@@ -9,8 +9,7 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/coreos/etcd/clientv3"
-	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/douyu/jupiter/pkg/xlog"
 )
 
 // 当前执行中的任务信息
@@ -84,17 +83,9 @@ func (p *Process) put(job *Job) (err error) {
 		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(),
-		time.Duration(job.ReqTimeout)*time.Second)
-	defer cancel()
-
-	session, err := concurrency.NewSession(job.Client.Client, concurrency.WithTTL(10))
-	if err != nil {
-		return err
-	}
-
-	_, err = job.Client.Put(ctx, p.Key(), val, clientv3.WithLease(session.Lease()))
-	return
+	return job.etcdRetry("put_proc", job.Etcd.PutTimeout, func(ctx context.Context) error {
+		return job.store.PutProc(ctx, p.Key(), []byte(val))
+	})
 }
 
 func (p *Process) Start(job *Job) {
@@ -107,7 +98,7 @@ func (p *Process) Start(job *Job) {
 	}
 
 	if err := p.put(job); err != nil {
-		job.logger.Warnf("proc put[%s] err: %s", p.Key(), err.Error())
+		job.logger.Warn("put proc failed", fieldJob(job.ID), fieldTask(p.TaskID), xlog.FieldKey(p.Key()), xlog.FieldErr(err))
 	}
 	return
 }
@@ -117,12 +108,9 @@ func (p *Process) del(job *Job) error {
 		return nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(),
-		time.Duration(job.ReqTimeout)*time.Second)
-	defer cancel()
-
-	_, err := job.Delete(ctx, p.Key())
-	return err
+	return job.etcdRetry("del_proc", job.Etcd.PutTimeout, func(ctx context.Context) error {
+		return job.store.DeleteProc(ctx, p.Key())
+	})
 }
 
 func (p *Process) Stop(job *Job) {
@@ -135,6 +123,6 @@ func (p *Process) Stop(job *Job) {
 	}
 
 	if err := p.del(job); err != nil {
-		job.logger.Warnf("proc del[%s] err: %s", p.Key(), err.Error())
+		job.logger.Warn("delete proc failed", fieldJob(job.ID), fieldTask(p.TaskID), xlog.FieldKey(p.Key()), xlog.FieldErr(err))
 	}
 }
@@ -0,0 +1,57 @@
+package job
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrThrottled = errors.New("job start throttled")
+
+// startLimiter 令牌桶，限制节点上每分钟启动的任务进程数，
+// 避免误配的秒级规则或集中派发的临时任务在单机上启动大量进程
+type startLimiter struct {
+	mu       sync.Mutex
+	capacity float64
+	rate     float64 // 每秒补充的令牌数
+	tokens   float64
+	last     time.Time
+	now      func() time.Time
+}
+
+// newStartLimiter perMinute 不大于 0 时不限制，返回 nil
+func newStartLimiter(perMinute int) *startLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &startLimiter{
+		capacity: float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		tokens:   float64(perMinute),
+		last:     time.Now(),
+		now:      time.Now,
+	}
+}
+
+// Allow 取一个令牌，桶空时返回 false
+func (l *startLimiter) Allow() bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.capacity {
+		l.tokens = l.capacity
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
@@ -0,0 +1,58 @@
+package job
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartLimiter(t *testing.T) {
+	assert.True(t, newStartLimiter(0).Allow())
+
+	now := time.Now()
+	limiter := newStartLimiter(3)
+	limiter.now = func() time.Time { return now }
+	limiter.last = now
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, limiter.Allow())
+	}
+	assert.False(t, limiter.Allow())
+
+	// 每 20 秒补充一个令牌
+	now = now.Add(20 * time.Second)
+	assert.True(t, limiter.Allow())
+	assert.False(t, limiter.Allow())
+
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.True(t, limiter.Allow())
+	}
+	assert.False(t, limiter.Allow())
+}
+
+func TestThrottledRunSkipped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "throttle")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "job.sh")
+	assert.Nil(t, ioutil.WriteFile(script, []byte("#!/bin/sh\n"), 0755))
+
+	w := newReplayWorker(t, func(c *Config) {
+		c.MaxStartsPerMinute = 1
+	})
+	w.limiter = newStartLimiter(1)
+	assert.True(t, w.limiter.Allow())
+
+	job := &Job{ID: "a", Name: "a", Script: script, Enable: true, worker: w}
+	assert.Equal(t, ErrThrottled, job.Run())
+
+	runs, err := w.JobRuns("a")
+	assert.Nil(t, err)
+	assert.Len(t, runs, 1)
+	assert.Equal(t, CronTaskStatusSkipped, runs[0].Status)
+}
@@ -0,0 +1,179 @@
+package job
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/metric"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// 定期对账修复的次数，kind 为 add、modify、delete、cmd
+var reconcileRepairsCounter = metric.CounterVecOpts{
+	Namespace: "juno",
+	Subsystem: "agent",
+	Name:      "reconcile_repairs_total",
+	Help:      "divergences between local jobs and the job store repaired by reconcile",
+	Labels:    []string{"kind"},
+}.Build()
+
+// ReconcileConfig 定期对比本地的任务、调度条目与存储中的任务定义，修复漏掉 watch 事件导致的不一致
+type ReconcileConfig struct {
+	Enable   bool
+	Interval time.Duration // 对账间隔
+}
+
+func (c *ReconcileConfig) normalize() {
+	if c.Interval < time.Minute {
+		c.Interval = 5 * time.Minute
+	}
+}
+
+// runReconcile 按间隔对账，worker 停止后退出
+func (w *worker) runReconcile() {
+	for {
+		select {
+		case <-time.After(w.Reconcile.Interval):
+		case <-w.done:
+			return
+		}
+
+		if w.isDraining() {
+			continue
+		}
+		if err := w.reconcileJobs(); err != nil {
+			w.logger.Error("reconcile jobs failed", xlog.FieldErr(err))
+		}
+	}
+}
+
+// reconcileJobs 以存储中的任务定义为准，补上缺失的任务、更新内容不同的任务、删除已不存在的任务，
+// 并补齐缺失的 cron 条目
+// 解析失败的任务保留本地的上一个有效版本；同一版本修复后仍不一致时不再重复修复，避免每次对账都触发 RunOnAdd
+func (w *worker) reconcileJobs() error {
+	ctx, cancel := NewEtcdTimeoutContext(w)
+	kvs, err := w.store.List(ctx, JobsKeyPrefix)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	// 与 watch 事件的处理串行，避免同时修改 cmds
+	w.syncMutex.Lock()
+	defer w.syncMutex.Unlock()
+	if w.repaired == nil {
+		w.repaired = make(map[string]uint64)
+	}
+
+	remote := make(map[string]*Job, len(kvs))
+	invalid := make(map[string]bool)
+	for _, kv := range kvs {
+		job, err := w.GetJobContentFromKv(kv.Key, kv.Value)
+		if err != nil {
+			invalid[GetIDFromKey(kv.Key)] = true
+			continue
+		}
+		job.runOn = w.ID
+		remote[job.ID] = job
+	}
+
+	for id, job := range remote {
+		hash := jobHash(job)
+		local, ok := w.getJob(id)
+		switch {
+		case ok && jobHash(local) == hash:
+			delete(w.repaired, id)
+		case w.repaired[id] == hash:
+			// 已按该版本修复过，如单机任务抢锁失败、节点不是目标，等任务定义变化后再修复
+		case !ok:
+			if !w.isJobTarget(job) || w.lockedByOthers(job) {
+				continue
+			}
+			w.repair("add", id)
+			w.repaired[id] = hash
+			w.addJob(job)
+			w.runOnAdd(id)
+		default:
+			w.repair("modify", id)
+			w.repaired[id] = hash
+			w.modJob(job)
+			w.runOnAdd(id)
+		}
+	}
+
+	for id := range w.repaired {
+		if _, ok := remote[id]; !ok {
+			delete(w.repaired, id)
+		}
+	}
+	for _, job := range w.Jobs() {
+		if _, ok := remote[job.ID]; !ok && !invalid[job.ID] {
+			w.repair("delete", job.ID)
+			w.delJob(job.ID)
+		}
+	}
+
+	w.reconcileCmds()
+	return nil
+}
+
+// reconcileCmds 本地任务应有的 cron 条目缺失时补上，已不属于任何任务的条目删除
+func (w *worker) reconcileCmds() {
+	expected := make(map[string]*Cmd)
+	w.jobsMutex.RLock()
+	for _, job := range w.jobs {
+		for id, cmd := range job.Cmds() {
+			expected[id] = cmd
+		}
+	}
+	w.jobsMutex.RUnlock()
+
+	for id, cmd := range expected {
+		if _, ok := w.cmds[id]; !ok {
+			w.repair("cmd", cmd.Job.ID)
+			w.addCmd(cmd)
+		}
+	}
+	for id, cmd := range w.cmds {
+		if _, ok := expected[id]; !ok {
+			w.repair("cmd", cmd.Job.ID)
+			w.delCmd(cmd)
+		}
+	}
+}
+
+// lockedByOthers 单机任务的锁被其他节点持有时，本地没有该任务是正常的
+func (w *worker) lockedByOthers(job *Job) bool {
+	if job.JobType != TypeAlone || job.IsSharded() {
+		return false
+	}
+
+	ctx, cancel := NewEtcdTimeoutContext(w)
+	defer cancel()
+	kvs, err := w.store.List(ctx, LockKeyPrefix+job.ID)
+	if err != nil {
+		// 无法确认时不抢锁，等下次对账
+		return true
+	}
+	for _, kv := range kvs {
+		if kv.Key == LockKeyPrefix+job.ID || strings.HasPrefix(kv.Key, LockKeyPrefix+job.ID+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *worker) repair(kind, jobID string) {
+	reconcileRepairsCounter.Inc(kind)
+	w.logger.Warn("job diverged from store, repair it", xlog.String("kind", kind), fieldJob(jobID))
+}
+
+// jobHash 任务定义的摘要，只包含会序列化的字段
+func jobHash(job *Job) uint64 {
+	data, _ := json.Marshal(job)
+	h := fnv.New64a()
+	_, _ = h.Write(data)
+	return h.Sum64()
+}
@@ -0,0 +1,58 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcileJobs(t *testing.T) {
+	w := newReplayWorker(t)
+
+	newJob := func(id, name string) *Job {
+		return &Job{ID: id, Name: name, Enable: true, Nodes: []string{"node-1"}, Timers: []*Timer{{ID: "t", Cron: "@hourly"}}}
+	}
+	put := func(job *Job) {
+		data, _ := json.Marshal(job)
+		assert.Nil(t, w.store.Put(context.Background(), JobsKeyPrefix+job.ID, data))
+	}
+	// a 的创建事件丢失，b 的修改事件丢失，c 的删除事件丢失
+	put(newJob("a", "a"))
+	put(newJob("b", "b2"))
+	w.addJob(newJob("b", "b1"))
+	w.addJob(newJob("c", "c"))
+
+	assert.Nil(t, w.reconcileJobs())
+
+	jobs := w.Jobs()
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, "a", jobs[0].ID)
+	assert.Equal(t, "b2", jobs[1].Name)
+	assert.Len(t, w.cmds, 2)
+	assert.Contains(t, w.cmds, "a-t")
+	assert.Contains(t, w.cmds, "b-t")
+
+	// 一致时不再修复
+	local := w.jobs["a"]
+	assert.Nil(t, w.reconcileJobs())
+	assert.True(t, local == w.jobs["a"])
+
+	// 存储中的任务解析失败时保留本地的上一个有效版本
+	assert.Nil(t, w.store.Put(context.Background(), JobsKeyPrefix+"a", []byte("{")))
+	assert.Nil(t, w.reconcileJobs())
+	assert.True(t, local == w.jobs["a"])
+
+	// 同一版本修复过后仍不一致时不再重复修复
+	remote := newJob("b", "b3")
+	put(remote)
+	w.repaired["b"] = jobHash(remote)
+	assert.Nil(t, w.reconcileJobs())
+	assert.Equal(t, "b2", w.jobs["b"].Name)
+	delete(w.repaired, "b")
+	assert.Nil(t, w.reconcileJobs())
+	assert.Equal(t, "b3", w.jobs["b"].Name)
+	assert.Nil(t, w.reconcileJobs())
+	assert.NotContains(t, w.repaired, "b")
+}
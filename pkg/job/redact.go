@@ -0,0 +1,196 @@
+package job
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// 内置的敏感内容规则
+var builtinRedactRules = map[string][]redactRule{
+	// 13 到 19 位的卡号，允许以空格或 - 分组，通过 Luhn 校验的才遮盖，避免遮盖订单号、时间戳等普通数字
+	"credit_card": {
+		{re: regexp.MustCompile(`\b\d{4}[ -]?\d{4}[ -]?\d{4}[ -]?\d{1,7}\b`), repl: secretMask, valid: luhnValid},
+	},
+	// Authorization 头及常见的 access key、token 格式
+	"token": {
+		{re: regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]+=*`), repl: "${1} " + secretMask},
+		{re: regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`), repl: secretMask},
+		{re: regexp.MustCompile(`\b(?:ghp|gho|ghs|xox[abprs])[-_A-Za-z0-9]{10,}\b`), repl: secretMask},
+	},
+	// password=xxx、passwd: xxx 等，保留字段名
+	"password": {
+		{re: regexp.MustCompile(`(?i)\b((?:password|passwd|pwd|secret)\s*[=:]\s*)[^\s&,;"']+`), repl: "${1}" + secretMask},
+	},
+}
+
+// RedactConfig 任务输出在写入日志、存储及推送给订阅者前遮盖的敏感内容
+type RedactConfig struct {
+	Builtin  []string // 内置规则，可选 credit_card、token、password
+	Patterns []string // 自定义正则，匹配的内容整体替换为 ******
+}
+
+// masker 遮盖输出中的敏感内容
+type masker interface {
+	Replace(s string) string
+}
+
+// maskers 依次遮盖，任务引用的密钥明文先于正则规则
+type maskers []masker
+
+func (m maskers) Replace(s string) string {
+	for _, masker := range m {
+		s = masker.Replace(s)
+	}
+	return s
+}
+
+type redactRule struct {
+	re    *regexp.Regexp
+	repl  string
+	valid func(match string) bool // 不为空时只遮盖校验通过的匹配，repl 不展开分组
+}
+
+type redactRules []redactRule
+
+func (r redactRules) Replace(s string) string {
+	for _, rule := range r {
+		if rule.valid == nil {
+			s = rule.re.ReplaceAllString(s, rule.repl)
+			continue
+		}
+		valid, repl := rule.valid, rule.repl
+		s = rule.re.ReplaceAllStringFunc(s, func(match string) string {
+			if valid(match) {
+				return repl
+			}
+			return match
+		})
+	}
+	return s
+}
+
+// luhnValid 卡号的 Luhn 校验，忽略分组的空格及 -
+func luhnValid(number string) bool {
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
+
+func newRedactRules(config *RedactConfig) (redactRules, error) {
+	rules := make(redactRules, 0)
+	for _, name := range config.Builtin {
+		builtin, ok := builtinRedactRules[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown builtin redact rule: %s", name)
+		}
+		rules = append(rules, builtin...)
+	}
+	for _, pattern := range config.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+		rules = append(rules, redactRule{re: re, repl: secretMask})
+	}
+	return rules, nil
+}
+
+// taskMasker 任务本次执行的遮盖规则，没有需要遮盖的内容时返回 nil
+func (w *worker) taskMasker(secrets []string) masker {
+	m := make(maskers, 0, 2)
+	if len(secrets) > 0 {
+		m = append(m, newMasker(secrets))
+	}
+	if len(w.redact) > 0 {
+		m = append(m, w.redact)
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// 存储中的任务定义整体遮盖的字段，任务及一次性任务的环境变量、参数中常带有密钥
+var maskedJobFields = []string{"envs", "params"}
+
+// maskJobValue 遮盖存储中任务定义的 maskedJobFields 及 redact 匹配的内容，用于录制、审计等会落盘的副本
+// 不是 JSON 对象时只按 redact 遮盖
+func maskJobValue(value []byte, redact masker) []byte {
+	if len(value) == 0 {
+		return value
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(value, &fields); err == nil {
+		masked := false
+		for _, name := range maskedJobFields {
+			var values map[string]string
+			if err := json.Unmarshal(fields[name], &values); err != nil || len(values) == 0 {
+				continue
+			}
+			for k := range values {
+				values[k] = secretMask
+			}
+			fields[name], _ = json.Marshal(values)
+			masked = true
+		}
+		if masked {
+			value, _ = json.Marshal(fields)
+		}
+	}
+	if redact == nil {
+		return value
+	}
+	return []byte(redact.Replace(string(value)))
+}
+
+// maskWriter 按行遮盖后写入下游，密钥或敏感内容被拆到两次写入中时也能遮盖
+// 超过 maxLogLine 仍没有换行时直接写出
+type maskWriter struct {
+	w       io.Writer
+	masker  masker
+	pending []byte
+}
+
+func newMaskWriter(w io.Writer, masker masker) io.WriteCloser {
+	return &maskWriter{w: w, masker: masker}
+}
+
+func (m *maskWriter) Write(p []byte) (int, error) {
+	m.pending = append(m.pending, p...)
+	end := bytes.LastIndexByte(m.pending, '\n') + 1
+	if end == 0 && len(m.pending) > maxLogLine {
+		end = len(m.pending)
+	}
+	if end > 0 {
+		_, _ = io.WriteString(m.w, m.masker.Replace(string(m.pending[:end])))
+		m.pending = append(m.pending[:0], m.pending[end:]...)
+	}
+	return len(p), nil
+}
+
+func (m *maskWriter) Close() error {
+	if len(m.pending) > 0 {
+		_, _ = io.WriteString(m.w, m.masker.Replace(string(m.pending)))
+		m.pending = nil
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+const (
+	ReduceKeyPrefix = "/juno/cronjob/reduce/" // 分片任务每轮执行的分片结果、reduce 锁及最终结果
+
+	EnvReduceDir = "JUNO_REDUCE_DIR" // 分片输出文件所在目录
+)
+
+// Reducer 分片任务的所有分片上报结果后，由一个节点执行 reduce 命令汇总
+// 分片输出按序号写入临时目录下的 shard-<index>.log，文件路径依次追加在 Args 之后
+type Reducer struct {
+	Script  string   `json:"script"`
+	Args    []string `json:"args"`
+	Timeout int64    `json:"timeout"` // 单位秒，大于 0 时有效
+}
+
+func (r *Reducer) Valid() error {
+	if r.Script == "" {
+		return errors.New("invalid reducer, script is required")
+	}
+	if r.Timeout < 0 {
+		return errors.New("invalid reducer, timeout should not be negative")
+	}
+	return nil
+}
+
+// reduceKey 任务某一轮执行的 reduce 数据，轮次为 cron 的计划触发时间，各节点相同
+func reduceKey(jobID string, round int64) string {
+	return ReduceKeyPrefix + jobID + "/" + strconv.FormatInt(round, 10)
+}
+
+// ReduceResultKey 任务某一轮执行汇总后的结果
+func ReduceResultKey(jobID string, round int64) string {
+	return reduceKey(jobID, round) + "/result"
+}
+
+func shardResultKey(jobID string, shard *Shard) string {
+	return fmt.Sprintf("%s/shard/%d", reduceKey(jobID, shard.Round), shard.Index)
+}
+
+// reduceRound 本次触发的轮次，没有计划时间（如手工触发）时返回 0，不做 reduce
+func (c *Cmd) reduceRound() int64 {
+	if c.Job.Reduce == nil || c.Job.Cron == nil {
+		return 0
+	}
+	scheduled := c.Job.Cron.Entry(c.schEntryID).Prev
+	if scheduled.IsZero() {
+		return 0
+	}
+	return scheduled.Unix()
+}
+
+// tryReduce 在当前节点的分片执行完后调用，所有分片都已上报时抢锁执行 reduce
+// 每个节点都先写入分片结果再检查，最后一个完成的节点一定能看到全部结果
+func (c *Cmd) tryReduce(round int64) {
+	j := c.Job
+	results, err := j.shardResults(round)
+	if err != nil {
+		j.logger.Warn("list shard results failed", fieldJob(j.ID), xlog.FieldErr(err))
+		return
+	}
+	if len(results) < j.Shards {
+		return
+	}
+
+	ctx, cancel := NewEtcdTimeoutContext(j.worker)
+	unlock, err := j.store.Lock(ctx, reduceKey(j.ID, round)+"/lock")
+	cancel()
+	if err != nil {
+		j.logger.Warn("lock reduce failed", fieldJob(j.ID), xlog.FieldErr(err))
+		return
+	}
+	defer func() {
+		_ = unlock()
+	}()
+
+	ctx, cancel = NewEtcdTimeoutContext(j.worker)
+	kvs, err := j.store.List(ctx, ReduceResultKey(j.ID, round))
+	cancel()
+	if err != nil || len(kvs) > 0 {
+		// 其他节点已经执行过 reduce
+		return
+	}
+
+	if err := j.runReduce(round, results); err != nil {
+		j.logger.Warn("run reducer failed", fieldJob(j.ID), xlog.Any("round", round), xlog.FieldErr(err))
+	}
+}
+
+// shardResults 读取一轮执行中已上报的分片结果，按分片序号排序
+func (j *Job) shardResults(round int64) ([]*TaskResult, error) {
+	ctx, cancel := NewEtcdTimeoutContext(j.worker)
+	defer cancel()
+
+	kvs, err := j.store.List(ctx, reduceKey(j.ID, round)+"/shard/")
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*TaskResult, 0, len(kvs))
+	for _, kv := range kvs {
+		result := &TaskResult{}
+		if err := json.Unmarshal(kv.Value, result); err != nil || result.Shard == nil {
+			continue
+		}
+		if j.Keyring != nil {
+			if plain, _, err := j.Keyring.Decrypt(result.Logs); err == nil {
+				result.Logs = string(plain)
+			}
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(a, b int) bool {
+		return results[a].Shard.Index < results[b].Shard.Index
+	})
+	return results, nil
+}
+
+// runReduce 有分片失败时不执行 reduce 命令，直接记录失败的最终结果
+func (j *Job) runReduce(round int64, results []*TaskResult) error {
+	reducer := *j
+	reducer.Script = j.Reduce.Script
+	reducer.Args = j.Reduce.Args
+	reducer.Timeout = j.Reduce.Timeout
+	reducer.Shards = 0
+	reducer.Reduce = nil
+	reducer.Hooks = nil
+	reducer.Extracts = nil
+	reducer.Success = nil
+	reducer.Trigger = nil
+
+	for _, result := range results {
+		if result.Status != CronTaskStatusSuccess {
+			task := NewTask(&reducer, withReduceRound(round))
+			if task.TaskID == 0 {
+				task.span.End()
+				return ErrTaskID
+			}
+			return task.SetStatus(CronTaskStatusFailed, fmt.Sprintf("shard %d %s, reducer skipped", result.Shard.Index, result.Status))
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "juno-reduce-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	files := make([]string, 0, len(results))
+	for _, result := range results {
+		file := filepath.Join(dir, fmt.Sprintf("shard-%d.log", result.Shard.Index))
+		if err := ioutil.WriteFile(file, []byte(result.Logs), 0600); err != nil {
+			return err
+		}
+		files = append(files, file)
+	}
+	reducer.Args = append(append([]string{}, j.Reduce.Args...), files...)
+
+	return reducer.Run(withReduceRound(round), withEnv(EnvReduceDir+"="+dir))
+}
+
+// withReduceRound 结果同时写入该轮执行的 reduce 结果 key
+func withReduceRound(round int64) TaskOption {
+	return func(t *Task) {
+		t.reduceRound = round
+	}
+}
+
+func withEnv(env ...string) TaskOption {
+	return func(t *Task) {
+		t.env = append(t.env, env...)
+	}
+}
+
+// reportShard 分片执行结束后上报结果，供 reduce 汇总
+func (t *Task) reportShard(payload []byte) {
+	if t.shard == nil || t.shard.Round == 0 || t.job.Reduce == nil {
+		return
+	}
+	if err := t.job.store.Put(context.Background(), shardResultKey(t.job.ID, t.shard), payload); err != nil {
+		t.job.logger.Warn("report shard result failed", fieldJob(t.job.ID), xlog.Int("shard", t.shard.Index), xlog.FieldErr(err))
+	}
+}
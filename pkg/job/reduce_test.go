@@ -0,0 +1,52 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTryReduce(t *testing.T) {
+	config := DefaultConfig()
+	config.HostName = "node-1"
+	config.ReqTimeout = 3
+	config.logger = xlog.DefaultLogger
+	taskIdGen, err := newTaskIDGen(1)
+	assert.NoError(t, err)
+	store := &replayStore{kvs: make(map[string][]byte)}
+	w := &worker{
+		Config:      config,
+		ID:          config.HostName,
+		store:       store,
+		taskIdGen:   taskIdGen,
+		runningJobs: make(map[string]map[uint64]context.CancelFunc),
+		runs:        make(map[string][]*TaskResult),
+		failures:    make(map[string]int),
+	}
+	job := &Job{ID: "count", Shards: 2, NodeGroup: "g", Reduce: &Reducer{Script: "/bin/cat"}, worker: w}
+	cmd := &Cmd{Job: job}
+	const round = 1600000000
+
+	report := func(index int, status CronTaskStatus) {
+		shard := &Shard{Index: index, Total: 2, Round: round}
+		data, _ := json.Marshal(TaskResult{Status: status, Shard: shard, Logs: "ok"})
+		assert.NoError(t, store.Put(context.Background(), shardResultKey(job.ID, shard), data))
+	}
+
+	// 分片未全部上报时不汇总
+	report(1, CronTaskStatusFailed)
+	cmd.tryReduce(round)
+	_, ok := store.kvs[ReduceResultKey(job.ID, round)]
+	assert.False(t, ok)
+
+	// 有分片失败时不执行 reducer，直接记录失败
+	report(0, CronTaskStatusSuccess)
+	cmd.tryReduce(round)
+	result := &TaskResult{}
+	assert.NoError(t, json.Unmarshal(store.kvs[ReduceResultKey(job.ID, round)], result))
+	assert.Equal(t, CronTaskStatusFailed, result.Status)
+	assert.Contains(t, result.Logs, "shard 1 failed")
+}
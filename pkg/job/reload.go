@@ -0,0 +1,230 @@
+package job
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/douyu/juno-agent/util"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// ReloadResult 重新加载配置的结果，配置项为 toml 中的名称
+type ReloadResult struct {
+	Applied []string `json:"applied"` // 已生效的配置项
+	Restart []string `json:"restart"` // 只在启动时生效，需要重启 agent 的配置项
+}
+
+// Reload 应用重新读取的 worker 配置，只替换运行中可以生效的部分：
+// 启动限流、定时规则的最短间隔、回调及 kafka 的推送地址、命令策略、节点禁止执行的时间段、节点标签、节点组及命名空间。
+// 执行中的任务不受影响；命名空间变更时切换到新命名空间的连接并重新建立 watch，其余情况下已建立的 watch 及连接保持不变，
+// 存储后端等变更只提示需要重启。
+// 新配置无效时不做任何修改，调用方需串行调用
+func (w *worker) Reload(next *Config) (*ReloadResult, error) {
+	next.normalize()
+	if err := next.Kafka.Valid(); err != nil {
+		return nil, fmt.Errorf("invalid kafka config: %w", err)
+	}
+	if len(next.Blackout.Windows) > 0 || len(next.Blackout.Calendars) > 0 {
+		if err := next.Blackout.Valid(); err != nil {
+			return nil, fmt.Errorf("invalid blackout config: %w", err)
+		}
+	}
+
+	result := &ReloadResult{Restart: restartRequired(w.Config, next)}
+
+	// 新命名空间的连接先建立并检查，失败时不做任何修改；回放时命名空间不影响回放的事件
+	var store JobStore
+	switchable, _ := w.store.(*switchableStore)
+	if next.Namespace != w.Namespace {
+		if switchable != nil {
+			var err error
+			if store, err = w.namespaceStore(next.Namespace); err != nil {
+				return nil, fmt.Errorf("connect namespace %s failed: %w", next.Namespace, err)
+			}
+		}
+		result.Applied = append(result.Applied, "namespace")
+	}
+
+	var policy *commandPolicy
+	policyChanged := !reflect.DeepEqual(w.CommandPolicy, next.CommandPolicy)
+	if policyChanged {
+		var err error
+		if policy, err = newCommandPolicy(&next.CommandPolicy, w.logger); err != nil {
+			return nil, fmt.Errorf("load command policy failed: %w", err)
+		}
+		result.Applied = append(result.Applied, "commandPolicy")
+	}
+
+	// 推送地址未变时保留原有的连接及队列
+	var callback *callbackReporter
+	callbackChanged := !reflect.DeepEqual(w.Callback, next.Callback)
+	if callbackChanged {
+		callback = newCallbackReporter(&next.Callback, w.logger, w.done)
+		result.Applied = append(result.Applied, "callback")
+	}
+	var kafka *kafkaExporter
+	kafkaChanged := !reflect.DeepEqual(w.Kafka, next.Kafka)
+	if kafkaChanged {
+		kafka = newKafkaExporter(&next.Kafka, w.HostName, w.logger, w.done)
+		result.Applied = append(result.Applied, "kafka")
+	}
+
+	if next.MinTimerInterval != w.MinTimerInterval {
+		result.Applied = append(result.Applied, "minTimerInterval")
+	}
+
+	w.reloadMutex.Lock()
+	prevCallback, prevKafka, prevPolicy := w.callback, w.kafka, w.commandPolicy
+	prevGroups := w.NodeGroups
+	if policyChanged {
+		w.commandPolicy = policy
+		w.CommandPolicy = next.CommandPolicy
+	}
+	if callbackChanged {
+		w.callback = callback
+		w.Callback = next.Callback
+	}
+	if kafkaChanged {
+		w.kafka = kafka
+		w.Kafka = next.Kafka
+	}
+	if next.MaxStartsPerMinute != w.MaxStartsPerMinute {
+		// 新的限流从满桶开始
+		w.limiter = newStartLimiter(next.MaxStartsPerMinute)
+		w.MaxStartsPerMinute = next.MaxStartsPerMinute
+		result.Applied = append(result.Applied, "maxStartsPerMinute")
+	}
+	if !reflect.DeepEqual(w.Blackout, next.Blackout) {
+		w.Blackout = next.Blackout
+		result.Applied = append(result.Applied, "blackout")
+	}
+	retarget := !reflect.DeepEqual(w.NodeGroups, next.NodeGroups) || !reflect.DeepEqual(w.Labels, next.Labels)
+	if retarget {
+		w.NodeGroups = next.NodeGroups
+		w.Labels = next.Labels
+		result.Applied = append(result.Applied, "nodeGroups", "labels")
+	}
+	if store == nil {
+		w.Namespace = next.Namespace
+	}
+	w.MinTimerInterval = next.MinTimerInterval
+	w.reloadMutex.Unlock()
+
+	if callbackChanged {
+		prevCallback.Stop()
+	}
+	if kafkaChanged {
+		prevKafka.Stop()
+	}
+	if policyChanged {
+		prevPolicy.stop()
+		if policy != nil {
+			go policy.run(w.done)
+		}
+	}
+	if store != nil {
+		// 切换后按新的节点组及标签在新命名空间中注册节点并加载任务
+		w.switchNamespace(switchable, store, next.Namespace)
+	} else if retarget {
+		w.unregisterGroups(prevGroups)
+		if err := w.registerNode(); err != nil {
+			w.logger.Warn("register node failed", xlog.FieldErr(err))
+		}
+		if err := w.retargetJobs(); err != nil {
+			w.logger.Error("retarget jobs failed", xlog.FieldErr(err))
+		}
+	}
+
+	w.logger.Info("worker config reloaded", xlog.Any("applied", result.Applied), xlog.Any("restart", result.Restart))
+	return result, nil
+}
+
+// restartRequired 只在启动时生效的配置项，变更后需要重启 agent
+func restartRequired(prev, next *Config) []string {
+	fields := []struct {
+		name       string
+		prev, next interface{}
+	}{
+		{"store", prev.Store, next.Store},
+		{"etcdConfigKey", prev.EtcdConfigKey, next.EtcdConfigKey},
+		{"etcdClient", prev.EtcdClient, next.EtcdClient},
+		{"etcd", prev.Etcd, next.Etcd},
+		{"onceQueue", prev.OnceQueue, next.OnceQueue},
+		{"jobAuth", prev.JobAuth, next.JobAuth},
+		{"logShip", prev.LogShip, next.LogShip},
+		{"pack", prev.Pack, next.Pack},
+		{"gc", prev.GC, next.GC},
+		{"reconcile", prev.Reconcile, next.Reconcile},
+		{"workspaces", prev.Workspaces, next.Workspaces},
+		{"selfMetrics", prev.SelfMetrics, next.SelfMetrics},
+		{"machineId", prev.MachineID, next.MachineID},
+	}
+
+	var restart []string
+	for _, field := range fields {
+		if !reflect.DeepEqual(field.prev, field.next) {
+			restart = append(restart, field.name)
+		}
+	}
+	return restart
+}
+
+// startLimit 当前的启动限流及每分钟最多启动的进程数
+func (w *worker) startLimit() (*startLimiter, int) {
+	w.reloadMutex.RLock()
+	defer w.reloadMutex.RUnlock()
+	return w.limiter, w.MaxStartsPerMinute
+}
+
+// nodeSelectors 当前节点所属的节点组及标签，重新加载时整体替换，返回的值不能修改
+func (w *worker) nodeSelectors() ([]string, map[string]string) {
+	w.reloadMutex.RLock()
+	defer w.reloadMutex.RUnlock()
+	return w.NodeGroups, w.Labels
+}
+
+// nodeBlackout 节点全局的禁止执行时间段
+func (w *worker) nodeBlackout() *Blackout {
+	w.reloadMutex.RLock()
+	blackout := w.Blackout
+	w.reloadMutex.RUnlock()
+	return &blackout
+}
+
+// unregisterGroups 删除当前节点在已退出的节点组下的注册 key，节点组、标签都为空时删除标签 key
+func (w *worker) unregisterGroups(prevGroups []string) {
+	groups, labels := w.nodeSelectors()
+	keys := make([]string, 0, len(prevGroups)+1)
+	for _, group := range prevGroups {
+		if util.InStringArray(groups, group) < 0 {
+			keys = append(keys, NodeKeyPrefix+group+"/"+w.ID)
+		}
+	}
+	if len(groups) == 0 && len(labels) == 0 {
+		keys = append(keys, LabelKeyPrefix+w.ID)
+	}
+
+	for _, key := range keys {
+		ctx, cancel := NewEtcdTimeoutContext(w)
+		err := w.store.DeleteProc(ctx, key)
+		cancel()
+		if err != nil {
+			w.logger.Warn("unregister node failed", xlog.FieldKey(key), xlog.FieldErr(err))
+		}
+	}
+}
+
+// retargetJobs 节点组或标签变更后，移除不再由当前节点调度的任务，并从存储补上新匹配的任务，
+// 被移除任务正在执行的进程不会被强杀
+func (w *worker) retargetJobs() error {
+	w.syncMutex.Lock()
+	for _, job := range w.Jobs() {
+		if !w.isJobTarget(job) {
+			w.logger.Info("current node is no longer the target of job, remove it", fieldJob(job.ID))
+			w.delJob(job.ID)
+		}
+	}
+	w.syncMutex.Unlock()
+
+	return w.reconcileJobs()
+}
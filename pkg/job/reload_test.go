@@ -0,0 +1,107 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReload(t *testing.T) {
+	w := newReplayWorker(t, func(c *Config) {
+		c.Labels = map[string]string{"env": "test"}
+	})
+	path := w.Replay.ReplayFile
+
+	newJob := func(id string, selector map[string]string) *Job {
+		job := &Job{ID: id, Name: id, Enable: true, Selector: selector, Timers: []*Timer{{ID: "t", Cron: "@hourly"}}}
+		data, _ := json.Marshal(job)
+		assert.Nil(t, w.store.Put(context.Background(), JobsKeyPrefix+id, data))
+		return job
+	}
+	w.addJob(newJob("test", map[string]string{"env": "test"}))
+	newJob("prod", map[string]string{"env": "prod"})
+	assert.Len(t, w.Jobs(), 1)
+
+	next := DefaultConfig()
+	next.Replay.ReplayFile = path
+	next.Labels = map[string]string{"env": "prod"}
+	next.MaxStartsPerMinute = 10
+	next.Namespace = "prod"
+	result, err := w.Reload(next)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"namespace", "maxStartsPerMinute", "nodeGroups", "labels"}, result.Applied)
+	assert.Empty(t, result.Restart)
+
+	// 按新的标签调度任务，不再匹配的任务被移除
+	jobs := w.Jobs()
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, "prod", jobs[0].ID)
+	limiter, maxStarts := w.startLimit()
+	assert.NotNil(t, limiter)
+	assert.Equal(t, 10, maxStarts)
+
+	// 相同的配置不再重复应用
+	same := DefaultConfig()
+	same.Replay.ReplayFile = path
+	same.Labels = map[string]string{"env": "prod"}
+	same.MaxStartsPerMinute = 10
+	same.Namespace = "prod"
+	result, err = w.Reload(same)
+	assert.Nil(t, err)
+	assert.Empty(t, result.Applied)
+
+	// 无效的配置不做任何修改
+	invalid := DefaultConfig()
+	invalid.Kafka.Brokers = []string{"127.0.0.1:9092"}
+	_, err = w.Reload(invalid)
+	assert.Error(t, err)
+	_, labels := w.nodeSelectors()
+	assert.Equal(t, "prod", labels["env"])
+}
+
+func TestSwitchNamespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "namespace")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeRecord := func(name string, entries ...*RecordEntry) string {
+		path := filepath.Join(dir, name)
+		var data []byte
+		for _, entry := range entries {
+			line, _ := json.Marshal(entry)
+			data = append(append(data, line...), '\n')
+		}
+		assert.Nil(t, ioutil.WriteFile(path, data, 0644))
+		return path
+	}
+	jobData, _ := json.Marshal(&Job{ID: "next", Name: "next", Enable: true, Nodes: []string{"node-1"}, Timers: []*Timer{{ID: "t", Cron: "@hourly"}}})
+	nextPath := writeRecord("next.jsonl", &RecordEntry{Prefix: JobsKeyPrefix, KVs: []*StoreKV{{Key: JobsKeyPrefix + "next", Value: jobData}}})
+
+	w := newReplayWorker(t)
+	prev, err := newReplayStore(&w.Replay)
+	assert.Nil(t, err)
+	switchable := &switchableStore{store: prev}
+	w.store = switchable
+	w.addJob(&Job{ID: "prev", Name: "prev", Enable: true, Timers: []*Timer{{ID: "t", Cron: "@hourly"}}})
+	_, events := w.watchPrefix(JobsKeyPrefix)
+
+	next, err := newReplayStore(&ReplayConfig{ReplayFile: nextPath})
+	assert.Nil(t, err)
+	w.switchNamespace(switchable, next, "next")
+	defer next.Close()
+
+	// 旧命名空间的 watch 结束，任务从新的命名空间重新加载
+	_, ok := <-events
+	assert.False(t, ok)
+	assert.Equal(t, "next", w.Namespace)
+	assert.Eventually(t, func() bool {
+		jobs := w.Jobs()
+		return len(jobs) == 1 && jobs[0].ID == "next"
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,312 @@
+package job
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/util/xgo"
+)
+
+// ReplayConfig 录制及回放 watch 事件的配置
+type ReplayConfig struct {
+	RecordFile string  // 将 watch 到的初始数据及事件追加写入该文件，为空时不录制，文件权限为 0600
+	ReplayFile string  // 不连接任务存储，从该文件回放录制的事件，为空时不回放
+	Speed      float64 // 回放速度，1 为按录制时的间隔回放，0 为不等待
+	Exec       bool    // 回放时是否真正执行任务命令，默认只记录为跳过
+}
+
+// RecordEntry 录制文件中的一行，Event 为空时为 watch 建立时读取的初始数据
+type RecordEntry struct {
+	Time   time.Time   `json:"time"`
+	Prefix string      `json:"prefix"`
+	KVs    []*StoreKV  `json:"kvs,omitempty"`
+	Event  *StoreEvent `json:"event,omitempty"`
+}
+
+// recordingStore 将 watch 到的数据按接收顺序写入文件，其余操作直接转发
+// 写入前遮盖任务的环境变量、参数及 redact 规则匹配的内容，录制只用于复现调度问题，不保留原始值
+type recordingStore struct {
+	JobStore
+
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	redact  masker
+}
+
+func newRecordingStore(store JobStore, path string, redact masker) (*recordingStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err == nil {
+		// 文件已存在时 OpenFile 不会修改权限
+		err = file.Chmod(0600)
+	}
+	if err != nil {
+		if file != nil {
+			_ = file.Close()
+		}
+		_ = store.Close()
+		return nil, err
+	}
+	return &recordingStore{
+		JobStore: store,
+		file:     file,
+		encoder:  json.NewEncoder(file),
+		redact:   redact,
+	}, nil
+}
+
+func (s *recordingStore) record(entry *RecordEntry) {
+	entry.Time = time.Now()
+	if len(entry.KVs) > 0 {
+		kvs := make([]*StoreKV, len(entry.KVs))
+		for i, kv := range entry.KVs {
+			kvs[i] = &StoreKV{Key: kv.Key, Value: s.mask(kv.Value)}
+		}
+		entry.KVs = kvs
+	}
+	if entry.Event != nil {
+		event := *entry.Event
+		event.Value = s.mask(event.Value)
+		event.PrevValue = s.mask(event.PrevValue)
+		entry.Event = &event
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.encoder.Encode(entry)
+}
+
+// mask 遮盖录制的值，watch 到的原始数据仍原样交给 worker
+func (s *recordingStore) mask(value []byte) []byte {
+	return maskJobValue(value, s.redact)
+}
+
+func (s *recordingStore) Watch(ctx context.Context, prefix string) ([]*StoreKV, <-chan *StoreEvent, error) {
+	kvs, events, err := s.JobStore.Watch(ctx, prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.record(&RecordEntry{Prefix: prefix, KVs: kvs})
+
+	ch := make(chan *StoreEvent, cap(events))
+	xgo.Go(func() {
+		defer close(ch)
+		for event := range events {
+			s.record(&RecordEntry{Prefix: prefix, Event: event})
+			ch <- event
+		}
+	})
+	return kvs, ch, nil
+}
+
+func (s *recordingStore) Close() error {
+	err := s.JobStore.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ReadRecord 读取录制文件
+func ReadRecord(path string) ([]*RecordEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []*RecordEntry
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for decoder.More() {
+		entry := &RecordEntry{}
+		if err := decoder.Decode(entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// replayStore 按录制顺序回放事件，数据保存在内存中
+// 录制中的所有前缀都建立 watch 后才开始回放，各前缀的初始数据为录制中该前缀第一次 watch 时的数据，
+// 回放期间 worker 写入的 key 同样保存在内存中，抢锁总是成功
+type replayStore struct {
+	entries  []*RecordEntry
+	prefixes map[string]bool // 录制中出现的前缀
+	speed    float64
+
+	mu      sync.Mutex
+	kvs     map[string][]byte
+	watches map[string]chan *StoreEvent
+	started bool
+	done    chan struct{} // 回放结束后关闭
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newReplayStore(config *ReplayConfig) (*replayStore, error) {
+	entries, err := ReadRecord(config.ReplayFile)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &replayStore{
+		entries:  entries,
+		prefixes: make(map[string]bool),
+		speed:    config.Speed,
+		kvs:      make(map[string][]byte),
+		watches:  make(map[string]chan *StoreEvent),
+		done:     make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	for _, entry := range entries {
+		s.prefixes[entry.Prefix] = true
+	}
+	return s, nil
+}
+
+// Done 回放结束后关闭
+func (s *replayStore) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *replayStore) List(ctx context.Context, prefix string) ([]*StoreKV, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var kvs []*StoreKV
+	for key, value := range s.kvs {
+		if strings.HasPrefix(key, prefix) {
+			kvs = append(kvs, &StoreKV{Key: key, Value: value})
+		}
+	}
+	return kvs, nil
+}
+
+func (s *replayStore) Watch(ctx context.Context, prefix string) ([]*StoreKV, <-chan *StoreEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var kvs []*StoreKV
+	for _, entry := range s.entries {
+		if entry.Prefix == prefix && entry.Event == nil {
+			kvs = entry.KVs
+			break
+		}
+	}
+	for _, kv := range kvs {
+		s.kvs[kv.Key] = kv.Value
+	}
+
+	ch := make(chan *StoreEvent, 100)
+	s.watches[prefix] = ch
+	if !s.started && s.watchesAll() {
+		s.started = true
+		xgo.Go(s.play)
+	}
+	return kvs, ch, nil
+}
+
+func (s *replayStore) watchesAll() bool {
+	for prefix := range s.prefixes {
+		if _, ok := s.watches[prefix]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// play 按录制顺序发送事件
+func (s *replayStore) play() {
+	defer close(s.done)
+
+	var last time.Time
+	for _, entry := range s.entries {
+		if entry.Event == nil {
+			continue
+		}
+		if s.speed > 0 && !last.IsZero() {
+			if !sleepContext(s.ctx, time.Duration(float64(entry.Time.Sub(last))/s.speed)) {
+				return
+			}
+		}
+		last = entry.Time
+
+		s.mu.Lock()
+		if entry.Event.Type == StoreDelete {
+			delete(s.kvs, entry.Event.Key)
+		} else {
+			s.kvs[entry.Event.Key] = entry.Event.Value
+		}
+		ch := s.watches[entry.Prefix]
+		s.mu.Unlock()
+
+		select {
+		case ch <- entry.Event:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *replayStore) Put(ctx context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kvs[key] = value
+	return nil
+}
+
+func (s *replayStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.kvs, key)
+	return nil
+}
+
+func (s *replayStore) PutProc(ctx context.Context, key string, value []byte) error {
+	return s.Put(ctx, key, value)
+}
+
+func (s *replayStore) DeleteProc(ctx context.Context, key string) error {
+	return s.Delete(ctx, key)
+}
+
+func (s *replayStore) Lock(ctx context.Context, key string) (func() error, error) {
+	return func() error { return nil }, nil
+}
+
+func (s *replayStore) Check(ctx context.Context) error {
+	return nil
+}
+
+func (s *replayStore) Close() error {
+	s.cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		// 等待回放停止，避免向关闭的 channel 发送事件
+		s.mu.Unlock()
+		<-s.done
+		s.mu.Lock()
+	}
+	for prefix, ch := range s.watches {
+		close(ch)
+		delete(s.watches, prefix)
+	}
+	return nil
+}
+
+// dryRun 回放录制且未开启 Exec 时不执行任务命令，避免按录制的任务定义在本机执行真实命令
+func (w *worker) dryRun() bool {
+	return w.Replay.ReplayFile != "" && !w.Replay.Exec
+}
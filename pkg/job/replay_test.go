@@ -0,0 +1,117 @@
+package job
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	jobValue := func(id, name, node string) []byte {
+		data, _ := json.Marshal(&Job{ID: id, Name: name, Nodes: []string{node}})
+		return data
+	}
+	entries := []*RecordEntry{
+		{Prefix: JobsKeyPrefix, KVs: []*StoreKV{{Key: JobsKeyPrefix + "a", Value: jobValue("a", "a", "node-1")}}},
+		{Prefix: JobsKeyPrefix, Event: &StoreEvent{Type: StorePut, Key: JobsKeyPrefix + "b", Value: jobValue("b", "b", "node-1"), Create: true}},
+		{Prefix: JobsKeyPrefix, Event: &StoreEvent{Type: StorePut, Key: JobsKeyPrefix + "a", Value: jobValue("a", "a", "node-2")}},
+		{Prefix: JobsKeyPrefix, Event: &StoreEvent{Type: StorePut, Key: JobsKeyPrefix + "b", Value: jobValue("b", "b2", "node-1")}},
+	}
+	path := filepath.Join(dir, "events.jsonl")
+	file, err := os.Create(path)
+	assert.Nil(t, err)
+	encoder := json.NewEncoder(file)
+	for _, entry := range entries {
+		assert.Nil(t, encoder.Encode(entry))
+	}
+	assert.Nil(t, file.Close())
+
+	config := DefaultConfig()
+	config.HostName = "node-1"
+	config.AppIP = "127.0.0.1"
+	config.Replay.ReplayFile = path
+	w := config.Build()
+	assert.Nil(t, w.Run())
+	defer w.Stop()
+
+	<-w.store.(*replayStore).Done()
+	assert.Eventually(t, func() bool {
+		jobs := w.Jobs()
+		return len(jobs) == 1 && jobs[0].ID == "b" && jobs[0].Name == "b2"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	read, err := ReadRecord(path)
+	assert.Nil(t, err)
+	assert.Len(t, read, len(entries))
+	assert.Equal(t, entries[3].Event.Value, read[3].Event.Value)
+
+	// 重复停止不会 panic
+	assert.Nil(t, w.Stop())
+}
+
+func TestRecordRedact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "record")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.jsonl")
+	assert.Nil(t, ioutil.WriteFile(path, nil, 0644))
+
+	rules, err := newRedactRules(&RedactConfig{Builtin: []string{"token"}})
+	assert.Nil(t, err)
+	store, err := newRecordingStore(&replayStore{kvs: make(map[string][]byte)}, path, rules)
+	assert.Nil(t, err)
+
+	value, _ := json.Marshal(&Job{ID: "a", Script: "/bin/curl -H 'Authorization: Bearer abc'",
+		Envs: map[string]string{"DB_PASSWORD": "hunter2"}, Params: map[string]string{"day": "1"}})
+	store.record(&RecordEntry{Prefix: JobsKeyPrefix, KVs: []*StoreKV{{Key: JobsKeyPrefix + "a", Value: value}}})
+	assert.Nil(t, store.file.Close())
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+	read, err := ReadRecord(path)
+	assert.Nil(t, err)
+	assert.Len(t, read, 1)
+	job := &Job{}
+	assert.Nil(t, json.Unmarshal(read[0].KVs[0].Value, job))
+	assert.Equal(t, "a", job.ID)
+	assert.Equal(t, secretMask, job.Envs["DB_PASSWORD"])
+	assert.Equal(t, secretMask, job.Params["day"])
+	assert.Equal(t, "/bin/curl -H 'Authorization: Bearer "+secretMask+"'", job.Script)
+}
+
+func TestReplayDryRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script")
+	}
+	dir, err := ioutil.TempDir("", "replay")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	marker := filepath.Join(dir, "ran")
+	script := filepath.Join(dir, "job.sh")
+	assert.Nil(t, ioutil.WriteFile(script, []byte("#!/bin/sh\ntouch "+marker+"\n"), 0755))
+
+	w := newReplayWorker(t)
+
+	job := &Job{ID: "a", Name: "a", Script: script, Enable: true, worker: w}
+	assert.Nil(t, job.Run())
+	_, err = os.Stat(marker)
+	assert.True(t, os.IsNotExist(err))
+
+	runs, err := w.JobRuns("a")
+	assert.Nil(t, err)
+	assert.Len(t, runs, 1)
+	assert.Equal(t, CronTaskStatusSkipped, runs[0].Status)
+}
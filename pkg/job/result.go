@@ -0,0 +1,139 @@
+package job
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+const (
+	// EnvJobResultFile 命令可以将结构化结果写入该文件，优先于输出的最后一行
+	EnvJobResultFile = "JOB_RESULT_FILE"
+
+	// 结果文件只读取前 64KB
+	maxJobResultSize = 64 << 10
+
+	// 每个任务最多暴露的 metrics 名称数，metrics 的 key 由命令输出决定，限制 job_output 的基数
+	maxResultMetrics = 16
+)
+
+// resultMetricName metrics 的 key 作为 job_output 的 name 标签，只接受指标名的格式
+var resultMetricName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,63}$`)
+
+// JobResult 任务约定输出的结构化结果，保存在执行记录中供管理端展示
+// 通过 $JOB_RESULT_FILE 写入，或者作为输出的最后一行 JSON
+type JobResult struct {
+	Records int64                  `json:"records,omitempty"` // 处理的记录数
+	Status  string                 `json:"status,omitempty"`  // 业务自定义的状态，不影响执行是否成功的判断
+	Message string                 `json:"message,omitempty"`
+	Metrics map[string]float64     `json:"metrics,omitempty"` // 数值指标，每个任务前 16 个合法的名称同时作为 job_output gauge 暴露
+	Data    map[string]interface{} `json:"data,omitempty"`    // 其他字段原样保存
+}
+
+func (r *JobResult) empty() bool {
+	return r.Records == 0 && r.Status == "" && r.Message == "" && len(r.Metrics) == 0 && len(r.Data) == 0
+}
+
+// resultFile 每次执行在独立的 0700 临时目录中创建结果文件，其他用户无法预先创建或读取，
+// 执行结束后调用 cleanup 删除目录
+func resultFile(taskID uint64) (string, func(), error) {
+	dir, err := ioutil.TempDir("", fmt.Sprintf("juno-result-%d-", taskID))
+	if err != nil {
+		return "", nil, err
+	}
+	return filepath.Join(dir, "result.json"), func() { _ = os.RemoveAll(dir) }, nil
+}
+
+// readJobResult 读取并删除结果文件，文件不存在时解析输出的最后一行
+// 输出的最后一行只有完全符合约定的字段时才作为结果，避免把 JSON 格式的日志当作结果。
+// 结果文件与输出都先经过 mask 遮盖敏感内容再解析
+func readJobResult(file, output string, mask func(string) string) (*JobResult, error) {
+	f, err := os.Open(file)
+	if err == nil {
+		defer os.Remove(file)
+		defer f.Close()
+
+		data, err := ioutil.ReadAll(io.LimitReader(f, maxJobResultSize))
+		if err != nil {
+			return nil, err
+		}
+		result := &JobResult{}
+		if err := json.Unmarshal([]byte(mask(string(data))), result); err != nil {
+			return nil, fmt.Errorf("invalid result file: %w", err)
+		}
+		return result, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	output = strings.TrimSpace(output)
+	line := mask(output[strings.LastIndex(output, "\n")+1:])
+	if !strings.HasPrefix(line, "{") {
+		return nil, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(line)))
+	decoder.DisallowUnknownFields()
+	result := &JobResult{}
+	if err := decoder.Decode(result); err != nil || result.empty() {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// parseResult 解析本次执行的结构化结果，解析失败只记录日志，不影响执行状态
+func (j *Job) parseResult(task *Task, file, output string) {
+	result, err := readJobResult(file, output, task.mask)
+	if err != nil {
+		j.logger.Warn("parse job result failed", fieldJob(j.ID), fieldTask(task.TaskID), xlog.FieldErr(err))
+		return
+	}
+	if result == nil {
+		return
+	}
+	for name, v := range result.Metrics {
+		if !resultMetricName.MatchString(name) || !j.resultMetrics.add(j.ID, name) {
+			j.logger.Warn("result metric not exported", fieldJob(j.ID), fieldTask(task.TaskID), xlog.String("name", name))
+			continue
+		}
+		jobOutputGauge.Set(v, j.ID, j.Name, name)
+	}
+	task.result = result
+}
+
+// resultMetrics 各任务已暴露的 metrics 名称，每个任务最多 maxResultMetrics 个，
+// 超出的名称仍保存在执行记录中，只是不作为 job_output 暴露
+type resultMetrics struct {
+	mu    sync.Mutex
+	names map[string]map[string]bool
+}
+
+func (m *resultMetrics) add(jobID, name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := m.names[jobID]
+	if names[name] {
+		return true
+	}
+	if len(names) >= maxResultMetrics {
+		return false
+	}
+	if names == nil {
+		if m.names == nil {
+			m.names = make(map[string]map[string]bool)
+		}
+		names = make(map[string]bool)
+		m.names[jobID] = names
+	}
+	names[name] = true
+	return true
+}
@@ -0,0 +1,70 @@
+package job
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadJobResult(t *testing.T) {
+	file, cleanup, err := resultFile(1)
+	assert.NoError(t, err)
+	defer cleanup()
+	stat, err := os.Stat(filepath.Dir(file))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), stat.Mode().Perm())
+	other, cleanupOther, err := resultFile(1)
+	assert.NoError(t, err)
+	cleanupOther()
+	assert.NotEqual(t, file, other)
+
+	noMask := func(s string) string { return s }
+	// 没有结果文件时使用输出的最后一行
+	result, err := readJobResult(file, "start\n{\"records\": 42, \"status\": \"partial\"}\n", noMask)
+	assert.NoError(t, err)
+	assert.Equal(t, &JobResult{Records: 42, Status: "partial"}, result)
+
+	// 最后一行不是约定的结果时忽略
+	result, err = readJobResult(file, "{\"level\": \"info\", \"msg\": \"done\"}", noMask)
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+	result, err = readJobResult(file, "done", noMask)
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+
+	// 结果文件优先，读取后删除
+	assert.NoError(t, ioutil.WriteFile(file, []byte(`{"records": 7, "metrics": {"lag": 1.5}, "data": {"table": "users"}}`), 0600))
+	result, err = readJobResult(file, "{\"records\": 42}", noMask)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), result.Records)
+	assert.Equal(t, 1.5, result.Metrics["lag"])
+	assert.Equal(t, "users", result.Data["table"])
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte("not json"), 0600))
+	_, err = readJobResult(file, "", noMask)
+	assert.Error(t, err)
+
+	// 解析前遮盖敏感内容
+	mask := strings.NewReplacer("s3cr3t", "******").Replace
+	result, err = readJobResult(file, `{"message": "token s3cr3t"}`, mask)
+	assert.NoError(t, err)
+	assert.Equal(t, "token ******", result.Message)
+}
+
+func TestResultMetrics(t *testing.T) {
+	var m resultMetrics
+	for i := 0; i < maxResultMetrics; i++ {
+		assert.True(t, m.add("report", fmt.Sprintf("m%d", i)))
+	}
+	assert.False(t, m.add("report", "other"))
+	assert.True(t, m.add("report", "m0"))
+	assert.True(t, m.add("sync", "other"))
+	assert.False(t, resultMetricName.MatchString(`lag{user="x"}`))
+}
@@ -0,0 +1,43 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// etcdRetry 按 Etcd 策略执行任务存储的操作，每次尝试使用独立的超时 context
+func (w *worker) etcdRetry(op string, timeout time.Duration, fn func(ctx context.Context) error) (err error) {
+	backoff := w.Etcd.Backoff
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err = fn(ctx)
+		cancel()
+		if err == nil || attempt >= w.Etcd.Retries {
+			return err
+		}
+
+		etcdRetriesCounter.Inc(op)
+		w.logger.Warn("etcd operation failed, retry later",
+			xlog.String("op", op), xlog.Int("attempt", attempt+1), xlog.Duration("backoff", backoff), xlog.FieldErr(err))
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > w.Etcd.MaxBackoff {
+			backoff = w.Etcd.MaxBackoff
+		}
+	}
+}
+
+// watchPrefix 按重试策略建立 watch，返回前缀下已有的 key 及之后的变更
+// 重试后仍然失败说明任务存储不可用，直接 panic
+func (w *worker) watchPrefix(prefix string) (kvs []*StoreKV, events <-chan *StoreEvent) {
+	err := w.etcdRetry("watch", w.Etcd.WatchTimeout, func(ctx context.Context) (err error) {
+		kvs, events, err = w.store.Watch(ctx, prefix)
+		return err
+	})
+	if err != nil {
+		panic(fmt.Errorf("watch prefix[%s] failed after %d retries: %w", prefix, w.Etcd.Retries, err))
+	}
+	return kvs, w.watches.track(prefix, events)
+}
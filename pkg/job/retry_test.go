@@ -0,0 +1,42 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEtcdRetry(t *testing.T) {
+	config := DefaultConfig()
+	config.Etcd.Backoff = time.Millisecond
+	config.Etcd.Retries = 2
+	config.Etcd.normalize(config.ReqTimeout, 5)
+	config.logger = xlog.DefaultLogger
+	w := &worker{Config: config}
+
+	assert.Equal(t, 3*time.Second, w.Etcd.PutTimeout)
+	assert.Equal(t, 5*time.Second, w.Etcd.LockTimeout)
+
+	attempts := 0
+	err := w.etcdRetry("put", 10*time.Millisecond, func(ctx context.Context) error {
+		attempts++
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = w.etcdRetry("put", time.Second, func(ctx context.Context) error {
+		if attempts++; attempts < 2 {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+}
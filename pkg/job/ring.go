@@ -0,0 +1,165 @@
+package job
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// 未配置 OutputBufferSize 时每个执行中的任务保留的输出
+const defaultOutputBufferSize = 8 << 20
+
+// outputRing 接收任务进程的输出，写入只做内存拷贝，不会因下游消费慢而阻塞子进程
+// 只保留最后 size 字节的输出，超出部分覆盖最早的输出；下游由独立的协程异步推送，
+// 落后超过 size 时跳过被覆盖的部分
+type outputRing struct {
+	mu      sync.Mutex
+	data    []byte
+	release func() error
+	written int64 // 累计写入的字节数，写入位置为 written % len(data)
+
+	sink    io.Writer // 异步推送的下游，如输出订阅、日志事件解析
+	flushed int64     // 已推送给下游的位置
+	dropped int64     // 下游落后而跳过的字节数
+	notify  chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newOutputRing(size int, sink io.Writer) (*outputRing, error) {
+	if size <= 0 {
+		size = defaultOutputBufferSize
+	}
+	data, release, err := allocRing(size)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &outputRing{
+		data:    data,
+		release: release,
+		sink:    sink,
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go r.flushLoop()
+	return r, nil
+}
+
+func (r *outputRing) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	size := int64(len(r.data))
+	n := len(p)
+	if int64(n) > size {
+		// 单次写入超过容量时只有最后 size 字节会被保留
+		r.written += int64(n) - size
+		p = p[int64(n)-size:]
+	}
+	off := int(r.written % size)
+	c := copy(r.data[off:], p)
+	copy(r.data, p[c:])
+	r.written += int64(len(p))
+	r.mu.Unlock()
+
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+	return n, nil
+}
+
+// flushLoop 把新写入的输出推送给下游，Close 时推送完剩余的输出后退出
+func (r *outputRing) flushLoop() {
+	defer close(r.stopped)
+
+	var chunk []byte
+	for {
+		select {
+		case <-r.notify:
+		case <-r.done:
+			chunk = r.flush(chunk)
+			return
+		}
+		chunk = r.flush(chunk)
+	}
+}
+
+func (r *outputRing) flush(chunk []byte) []byte {
+	if r.sink == nil {
+		return chunk
+	}
+
+	r.mu.Lock()
+	size := int64(len(r.data))
+	if lag := r.written - r.flushed; lag > size {
+		r.dropped += lag - size
+		r.flushed = r.written - size
+	}
+	chunk = r.readLocked(chunk[:0], r.flushed, r.written)
+	r.flushed = r.written
+	r.mu.Unlock()
+
+	if len(chunk) > 0 {
+		_, _ = r.sink.Write(chunk)
+	}
+	return chunk
+}
+
+// readLocked 读取 [from, to) 之间的输出，调用方保证区间没有被覆盖
+func (r *outputRing) readLocked(dst []byte, from, to int64) []byte {
+	size := int64(len(r.data))
+	for from < to {
+		off := from % size
+		end := size
+		if to-from < size-off {
+			end = off + to - from
+		}
+		dst = append(dst, r.data[off:end]...)
+		from += end - off
+	}
+	return dst
+}
+
+// Close 停止写入并等待下游推送完成，之后仍可以读取保留的输出
+func (r *outputRing) Close() {
+	select {
+	case <-r.done:
+	default:
+		close(r.done)
+	}
+	<-r.stopped
+}
+
+// Bytes 保留的输出，有输出被覆盖时在开头注明丢弃的字节数
+func (r *outputRing) Bytes() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	from := r.written - int64(len(r.data))
+	if from <= 0 {
+		return r.readLocked(nil, 0, r.written)
+	}
+	out := []byte(fmt.Sprintf("[%d bytes of earlier output truncated]\n", from))
+	return r.readLocked(out, from, r.written)
+}
+
+// Dropped 下游落后而没有推送的字节数
+func (r *outputRing) Dropped() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dropped
+}
+
+// Free 释放缓冲区，之后不能再读写
+func (r *outputRing) Free() {
+	r.Close()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.release != nil {
+		_ = r.release()
+		r.release = nil
+	}
+	r.data = nil
+}
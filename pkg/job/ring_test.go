@@ -0,0 +1,79 @@
+package job
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lockedBuffer 下游 sink 在 flush 协程中写入
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func TestOutputRing(t *testing.T) {
+	sink := &lockedBuffer{}
+	ring, err := newOutputRing(8, sink)
+	assert.NoError(t, err)
+	defer ring.Free()
+
+	_, _ = ring.Write([]byte("abc"))
+	_, _ = ring.Write([]byte("def"))
+	assert.Equal(t, "abcdef", string(ring.Bytes()))
+
+	// 跨过缓冲区末尾时回绕，只保留最后 8 字节
+	_, _ = ring.Write([]byte("ghij"))
+	assert.Equal(t, "[2 bytes of earlier output truncated]\ncdefghij", string(ring.Bytes()))
+
+	n, err := ring.Write([]byte("0123456789"))
+	assert.NoError(t, err)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, "[12 bytes of earlier output truncated]\n23456789", string(ring.Bytes()))
+
+	ring.Close()
+	// 下游收到的输出按顺序，落后时跳过被覆盖的部分
+	got := sink.buf.String()
+	assert.Equal(t, int64(20), int64(len(got))+ring.Dropped())
+	assert.True(t, strings.HasSuffix(got, "23456789"))
+}
+
+// BenchmarkOutputRing 模拟输出数百 MB 的任务，ring 写入不受下游消费速度影响
+func BenchmarkOutputRing(b *testing.B) {
+	line := []byte(strings.Repeat("x", 1023) + "\n")
+	const total = 256 << 20
+	b.SetBytes(total)
+	for i := 0; i < b.N; i++ {
+		ring, err := newOutputRing(defaultOutputBufferSize, ioutil.Discard)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for written := 0; written < total; written += len(line) {
+			_, _ = ring.Write(line)
+		}
+		ring.Free()
+	}
+}
+
+// BenchmarkOutputBuffer 之前的方式，所有输出保存在内存中
+func BenchmarkOutputBuffer(b *testing.B) {
+	line := []byte(strings.Repeat("x", 1023) + "\n")
+	const total = 256 << 20
+	b.SetBytes(total)
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		for written := 0; written < total; written += len(line) {
+			_, _ = buf.Write(line)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package job
+
+import "syscall"
+
+// allocRing 使用匿名 mmap 分配输出缓冲区，不占用 Go 堆，任务结束后立即归还给系统
+func allocRing(size int) ([]byte, func() error, error) {
+	data, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error {
+		return syscall.Munmap(data)
+	}, nil
+}
@@ -0,0 +1,6 @@
+package job
+
+// allocRing windows 下使用普通的切片
+func allocRing(size int) ([]byte, func() error, error) {
+	return make([]byte, size), nil, nil
+}
@@ -0,0 +1,45 @@
+//go:build !windows
+// +build !windows
+
+package job
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunOnAdd(t *testing.T) {
+	w := newReplayWorker(t)
+
+	runs := func(id string) int {
+		w.runsMutex.Lock()
+		defer w.runsMutex.Unlock()
+		return len(w.runs[id])
+	}
+	event := func(job *Job, create bool) *StoreEvent {
+		data, _ := json.Marshal(job)
+		return &StoreEvent{Type: StorePut, Key: JobsKeyPrefix + job.ID, Value: data, Create: create}
+	}
+
+	job := &Job{ID: "a", Name: "a", Script: "true", Enable: true, RunOnAdd: true,
+		Nodes: []string{"node-1"}, Timers: []*Timer{{ID: "t", Cron: "@hourly"}}}
+	w.handleJobEvent(event(job, true))
+	assert.Eventually(t, func() bool { return runs("a") == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// 内容不变的修改不再执行
+	w.handleJobEvent(event(job, false))
+	job.Name = "a2"
+	w.handleJobEvent(event(job, false))
+	assert.Eventually(t, func() bool { return runs("a") == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// 未开启的任务只按 Timers 调度
+	plain := &Job{ID: "b", Name: "b", Script: "true", Enable: true,
+		Nodes: []string{"node-1"}, Timers: []*Timer{{ID: "t", Cron: "@hourly"}}}
+	w.handleJobEvent(event(plain, true))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, runs("b"))
+	assert.Equal(t, 2, runs("a"))
+}
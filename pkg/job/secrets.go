@@ -0,0 +1,119 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/douyu/juno-agent/pkg/secret"
+)
+
+const (
+	SecretKeyPrefix = "/juno/cronjob/secret/" // 加密保存的密钥，值为 keyring 加密的 JSON 对象
+
+	secretMask = "******"
+)
+
+// storeSecrets 从任务存储读取密钥，需要开启 keyring
+type storeSecrets struct {
+	w *worker
+}
+
+func (s *storeSecrets) Get(ctx context.Context, scope secret.Scope, path string) (map[string]string, error) {
+	if s.w.Keyring == nil {
+		return nil, errors.New("keyring is required to read secrets from job store")
+	}
+
+	key := SecretKeyPrefix + path
+	kvs, err := s.w.store.List(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range kvs {
+		if kv.Key != key {
+			continue
+		}
+		plain, _, err := s.w.Keyring.Decrypt(string(kv.Value))
+		if err != nil {
+			return nil, fmt.Errorf("decrypt: %w", err)
+		}
+		values := make(map[string]string)
+		if err := json.Unmarshal(plain, &values); err != nil {
+			return nil, fmt.Errorf("secret should be a json object of strings: %w", err)
+		}
+		return values, nil
+	}
+	return nil, errors.New("secret not found")
+}
+
+// secrets 解析 secret:// 引用使用的存储
+func (w *worker) secrets() secret.Provider {
+	if w.Secrets != nil {
+		return w.Secrets
+	}
+	return &storeSecrets{w: w}
+}
+
+// resolveEnvs 返回传给命令的环境变量及其中的密钥明文，密钥明文只用于传给命令及遮盖输出
+func (j *Job) resolveEnvs(ctx context.Context) ([]string, []string, error) {
+	names := make([]string, 0, len(j.Envs))
+	for name := range j.Envs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := make([]string, 0, len(names))
+	secrets := make([]string, 0)
+	for _, name := range names {
+		value := j.Envs[name]
+		if secret.IsRef(value) {
+			ref, err := secret.ParseRef(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("env %s: %w", name, err)
+			}
+			scope := secret.Scope{Team: j.Team, Owner: j.Owner}
+			if value, err = secret.Resolve(ctx, j.secrets(), scope, ref); err != nil {
+				return nil, nil, fmt.Errorf("env %s: %w", name, err)
+			}
+			if value != "" {
+				secrets = append(secrets, value)
+			}
+		}
+		env = append(env, name+"="+value)
+	}
+	return env, secrets, nil
+}
+
+// validEnvs 只检查引用的格式，密钥在执行时才读取
+func (j *Job) validEnvs() error {
+	for name, value := range j.Envs {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return fmt.Errorf("invalid env name %q", name)
+		}
+		if secret.IsRef(value) {
+			if _, err := secret.ParseRef(value); err != nil {
+				return fmt.Errorf("env %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// newMasker 把输出中的密钥明文替换为 ******，没有密钥时返回 nil
+func newMasker(secrets []string) *strings.Replacer {
+	if len(secrets) == 0 {
+		return nil
+	}
+	// 较长的密钥先替换，避免其中包含的较短密钥被替换后长的无法匹配
+	sort.Slice(secrets, func(a, b int) bool {
+		return len(secrets[a]) > len(secrets[b])
+	})
+	pairs := make([]string, 0, len(secrets)*2)
+	for _, s := range secrets {
+		pairs = append(pairs, s, secretMask)
+	}
+	return strings.NewReplacer(pairs...)
+}
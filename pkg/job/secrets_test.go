@@ -0,0 +1,60 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/douyu/juno-agent/pkg/secret"
+	"github.com/stretchr/testify/assert"
+)
+
+type mapSecrets map[string]map[string]string
+
+func (m mapSecrets) Get(ctx context.Context, scope secret.Scope, path string) (map[string]string, error) {
+	values, ok := m[path]
+	if !ok {
+		return nil, errors.New("secret not found")
+	}
+	return values, nil
+}
+
+func TestResolveEnvs(t *testing.T) {
+	config := DefaultConfig()
+	config.Secrets = mapSecrets{"db/orders": {"password": "p@ss", "user": "orders"}}
+	w := &worker{Config: config}
+
+	job := &Job{ID: "a", worker: w, Envs: map[string]string{
+		"DB_USER":     "secret://db/orders#user",
+		"DB_PASSWORD": "secret://db/orders#password",
+		"DB_HOST":     "127.0.0.1",
+	}}
+	assert.NoError(t, job.validEnvs())
+	env, secrets, err := job.resolveEnvs(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"DB_HOST=127.0.0.1", "DB_PASSWORD=p@ss", "DB_USER=orders"}, env)
+	assert.ElementsMatch(t, []string{"p@ss", "orders"}, secrets)
+
+	// 错误信息中不包含密钥明文
+	job.Envs["DB_PORT"] = "secret://db/orders#port"
+	_, _, err = job.resolveEnvs(context.Background())
+	assert.EqualError(t, err, "env DB_PORT: key port not found in secret db/orders")
+
+	assert.Error(t, (&Job{Envs: map[string]string{"A": "secret://db"}}).validEnvs())
+	assert.Error(t, (&Job{Envs: map[string]string{"A=B": "c"}}).validEnvs())
+}
+
+func TestMaskWriter(t *testing.T) {
+	var out bytes.Buffer
+	mask := newMaskWriter(&out, newMasker([]string{"p@ss", "p@ssword"}))
+
+	// 密钥被拆到两次写入中
+	_, _ = mask.Write([]byte("login with p@"))
+	assert.Equal(t, "", out.String())
+	_, _ = mask.Write([]byte("ssword ok\nnext p@"))
+	assert.Equal(t, "login with ****** ok\n", out.String())
+	_, _ = mask.Write([]byte("ss"))
+	assert.NoError(t, mask.Close())
+	assert.Equal(t, "login with ****** ok\nnext ******", out.String())
+}
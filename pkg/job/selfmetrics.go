@@ -0,0 +1,133 @@
+package job
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/metric"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// HeartbeatKeyPrefix 各节点定期写入当前时间并 watch 自己的 key，收到变更的延迟即 watch 的延迟
+const HeartbeatKeyPrefix = "/juno/cronjob/heartbeat/"
+
+var (
+	// agent 的 goroutine 数
+	goroutinesGauge = metric.GaugeVecOpts{
+		Namespace: "juno",
+		Subsystem: "agent",
+		Name:      "goroutines",
+		Help:      "number of goroutines of the agent process",
+	}.Build()
+
+	// 任务存储每次请求的耗时，不含抢锁的等待
+	storeRequestHistogram = metric.HistogramVecOpts{
+		Namespace: "juno",
+		Subsystem: "agent",
+		Name:      "store_request_duration_seconds",
+		Help:      "latency of requests to the job store",
+		Labels:    []string{"backend", "op"},
+		Buckets:   []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 3, 10},
+	}.Build()
+
+	// 写入心跳到 watch 收到的延迟
+	watchLagHistogram = metric.HistogramVecOpts{
+		Namespace: "juno",
+		Subsystem: "agent",
+		Name:      "watch_lag_seconds",
+		Help:      "delay between writing a heartbeat key and receiving it from watch",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60},
+	}.Build()
+
+	// 距最近一次收到心跳的时间，watch 卡住时持续增长
+	heartbeatAgeGauge = metric.GaugeVecOpts{
+		Namespace: "juno",
+		Subsystem: "agent",
+		Name:      "watch_heartbeat_age_seconds",
+		Help:      "seconds since the last heartbeat was received from watch",
+	}.Build()
+)
+
+// SelfMetricsConfig agent 自身指标的采集
+type SelfMetricsConfig struct {
+	Interval time.Duration // 采集及写入心跳的间隔，为 0 时不采集
+}
+
+// observedStore 记录任务存储各请求的耗时
+type observedStore struct {
+	JobStore
+	backend string
+}
+
+func (s *observedStore) observe(op string, start time.Time) {
+	storeRequestHistogram.Observe(time.Since(start).Seconds(), s.backend, op)
+}
+
+func (s *observedStore) List(ctx context.Context, prefix string) ([]*StoreKV, error) {
+	defer s.observe("list", time.Now())
+	return s.JobStore.List(ctx, prefix)
+}
+
+func (s *observedStore) Watch(ctx context.Context, prefix string) ([]*StoreKV, <-chan *StoreEvent, error) {
+	defer s.observe("watch", time.Now())
+	return s.JobStore.Watch(ctx, prefix)
+}
+
+func (s *observedStore) Put(ctx context.Context, key string, value []byte) error {
+	defer s.observe("put", time.Now())
+	return s.JobStore.Put(ctx, key, value)
+}
+
+func (s *observedStore) Delete(ctx context.Context, key string) error {
+	defer s.observe("delete", time.Now())
+	return s.JobStore.Delete(ctx, key)
+}
+
+func (s *observedStore) PutProc(ctx context.Context, key string, value []byte) error {
+	defer s.observe("put_proc", time.Now())
+	return s.JobStore.PutProc(ctx, key, value)
+}
+
+func (s *observedStore) DeleteProc(ctx context.Context, key string) error {
+	defer s.observe("delete_proc", time.Now())
+	return s.JobStore.DeleteProc(ctx, key)
+}
+
+// runSelfMetrics 按间隔采集 goroutine 数并写入心跳，worker 停止后退出
+func (w *worker) runSelfMetrics() {
+	key := HeartbeatKeyPrefix + w.ID
+	_, events := w.watchPrefix(key)
+	received := time.Now().UnixNano()
+	go func() {
+		for event := range events {
+			sent, err := strconv.ParseInt(string(event.Value), 10, 64)
+			if event.Type != StorePut || err != nil {
+				continue
+			}
+			now := time.Now().UnixNano()
+			atomic.StoreInt64(&received, now)
+			watchLagHistogram.Observe(time.Duration(now - sent).Seconds())
+		}
+	}()
+
+	for {
+		select {
+		case <-time.After(w.SelfMetrics.Interval):
+		case <-w.done:
+			return
+		}
+
+		goroutinesGauge.Set(float64(runtime.NumGoroutine()))
+		heartbeatAgeGauge.Set(time.Since(time.Unix(0, atomic.LoadInt64(&received))).Seconds())
+
+		ctx, cancel := context.WithTimeout(context.Background(), w.Etcd.PutTimeout)
+		err := w.store.PutProc(ctx, key, []byte(strconv.FormatInt(time.Now().UnixNano(), 10)))
+		cancel()
+		if err != nil {
+			w.logger.Warn("put heartbeat failed", xlog.FieldKey(key), xlog.FieldErr(err))
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package job
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObservedStore(t *testing.T) {
+	store := &observedStore{JobStore: &replayStore{kvs: make(map[string][]byte)}, backend: "replay"}
+	ctx := context.Background()
+
+	assert.NoError(t, store.Put(ctx, JobsKeyPrefix+"backup", []byte("{}")))
+	assert.NoError(t, store.PutProc(ctx, HeartbeatKeyPrefix+"node-1", []byte("1")))
+	kvs, err := store.List(ctx, JobsKeyPrefix)
+	assert.NoError(t, err)
+	assert.Len(t, kvs, 1)
+
+	assert.NoError(t, store.Delete(ctx, JobsKeyPrefix+"backup"))
+	kvs, _ = store.List(ctx, JobsKeyPrefix)
+	assert.Empty(t, kvs)
+}
@@ -0,0 +1,125 @@
+package job
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	EnvShardIndex = "JUNO_SHARD_INDEX" // 当前分片序号，从 0 开始
+	EnvShardTotal = "JUNO_SHARD_TOTAL" // 分片总数
+)
+
+// 分片信息，执行时通过环境变量传给命令
+type Shard struct {
+	Index int   `json:"index"`
+	Total int   `json:"total"`
+	Round int64 `json:"round,omitempty"` // 配置了 Reduce 时为本轮执行的计划时间，用于汇总各分片的结果
+}
+
+func (s *Shard) Env() []string {
+	return []string{
+		EnvShardIndex + "=" + strconv.Itoa(s.Index),
+		EnvShardTotal + "=" + strconv.Itoa(s.Total),
+	}
+}
+
+// IsSharded 是否为分片任务
+// 分片任务在 NodeGroup 的存活节点间分配，不再使用 Nodes 列表
+func (j *Job) IsSharded() bool {
+	return j.Shards > 0 && j.NodeGroup != ""
+}
+
+// OwnedShards 计算 node 负责的分片序号
+// 使用 rendezvous hashing：每个分片归属于权重最大的节点，各节点基于相同的存活列表得到相同的结果，
+// 节点上下线时只有该节点相关的分片会迁移
+func OwnedShards(jobID string, shards int, nodes []string, node string) []int {
+	if shards <= 0 || len(nodes) == 0 {
+		return nil
+	}
+
+	sorted := make([]string, len(nodes))
+	copy(sorted, nodes)
+	sort.Strings(sorted)
+
+	owned := make([]int, 0)
+	for i := 0; i < shards; i++ {
+		var (
+			owner     string
+			maxWeight uint64
+		)
+		for _, n := range sorted {
+			if w := shardWeight(jobID, i, n); owner == "" || w > maxWeight {
+				owner, maxWeight = n, w
+			}
+		}
+		if owner == node {
+			owned = append(owned, i)
+		}
+	}
+	return owned
+}
+
+func shardWeight(jobID string, shard int, node string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(jobID + "/" + strconv.Itoa(shard) + "/" + node))
+
+	// fnv 对相近的输入区分度不够，再做一次 splitmix64 混淆
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// runShards 计算当前节点负责的分片，并发执行
+func (c *Cmd) runShards() error {
+	nodes, err := c.liveNodes(c.Job.NodeGroup)
+	if err != nil {
+		c.logger.Warn("get live nodes failed", fieldJob(c.Job.ID), xlog.FieldErr(err))
+		return err
+	}
+
+	owned := OwnedShards(c.Job.ID, c.Job.Shards, nodes, c.Job.runOn)
+	if len(owned) == 0 {
+		c.logger.Info("no shard owned by current node, skip", fieldJob(c.Job.ID))
+		return nil
+	}
+
+	round := c.reduceRound()
+	var eg errgroup.Group
+	for _, index := range owned {
+		shard := &Shard{Index: index, Total: c.Job.Shards, Round: round}
+		eg.Go(func() error {
+			return c.runWithRetry(WithShard(shard))
+		})
+	}
+	err = eg.Wait()
+	if round != 0 {
+		c.tryReduce(round)
+	}
+	return err
+}
+
+// liveNodes 获取节点组内的存活节点
+func (w *worker) liveNodes(group string) ([]string, error) {
+	ctx, cancel := NewEtcdTimeoutContext(w)
+	defer cancel()
+
+	kvs, err := w.store.List(ctx, NodeKeyPrefix+group+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]string, 0, len(kvs))
+	for _, kv := range kvs {
+		nodes = append(nodes, GetIDFromKey(kv.Key))
+	}
+	return nodes, nil
+}
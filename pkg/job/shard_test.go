@@ -0,0 +1,44 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwnedShards(t *testing.T) {
+	nodes := []string{"node-a", "node-b", "node-c"}
+
+	t.Run("every shard has exactly one owner", func(t *testing.T) {
+		owners := make(map[int]int)
+		for _, node := range nodes {
+			for _, index := range OwnedShards("job-1", 16, nodes, node) {
+				owners[index]++
+			}
+		}
+		assert.Len(t, owners, 16)
+		for index, count := range owners {
+			assert.Equal(t, 1, count, "shard %d", index)
+		}
+	})
+
+	t.Run("result does not depend on node order", func(t *testing.T) {
+		reversed := []string{"node-c", "node-b", "node-a"}
+		for _, node := range nodes {
+			assert.Equal(t, OwnedShards("job-1", 16, nodes, node), OwnedShards("job-1", 16, reversed, node))
+		}
+	})
+
+	t.Run("removing a node only moves its own shards", func(t *testing.T) {
+		before := OwnedShards("job-1", 16, nodes, "node-a")
+		after := OwnedShards("job-1", 16, nodes[:2], "node-a")
+		for _, index := range before {
+			assert.Contains(t, after, index)
+		}
+	})
+
+	t.Run("node not in group owns nothing", func(t *testing.T) {
+		assert.Empty(t, OwnedShards("job-1", 16, nodes, "node-x"))
+		assert.Empty(t, OwnedShards("job-1", 0, nodes, "node-a"))
+	})
+}
@@ -0,0 +1,255 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/job/etcd"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// 任务存储的后端类型
+const (
+	StoreEtcd      = "etcd"
+	StoreConsul    = "consul"
+	StoreZooKeeper = "zookeeper"
+)
+
+// 存储事件类型
+const (
+	StorePut    = "put"
+	StoreDelete = "delete"
+)
+
+// JobStore 任务存储，任务、锁、执行中的进程、执行结果等 key 均通过它读写
+// key 统一使用 / 分隔的路径形式，如 /juno/cronjob/job/xxx，由各后端转换为自己的格式
+type JobStore interface {
+	// List 读取前缀下的所有 key
+	List(ctx context.Context, prefix string) ([]*StoreKV, error)
+	// Watch 读取前缀下的所有 key 并监听之后的变更，ctx 只用于读取初始数据，监听持续到 Close
+	Watch(ctx context.Context, prefix string) ([]*StoreKV, <-chan *StoreEvent, error)
+	// Put 写入 key
+	Put(ctx context.Context, key string, value []byte) error
+	// Delete 删除 key，key 不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// PutProc 写入与当前节点存活绑定的 key，节点宕机或与存储断开后自动删除，用于执行中的进程及节点注册
+	PutProc(ctx context.Context, key string, value []byte) error
+	// DeleteProc 删除 PutProc 写入的 key
+	DeleteProc(ctx context.Context, key string) error
+	// Lock 抢占 key 对应的锁，抢到或 ctx 结束时返回，返回的函数用于释放锁
+	// 持有锁的节点宕机后锁自动释放，锁 key 被删除
+	Lock(ctx context.Context, key string) (unlock func() error, err error)
+	// Check 检查与存储的连接，PutProc 使用的租约或会话过期且未恢复时同样返回错误，用于就绪检查
+	Check(ctx context.Context) error
+	// Close 停止所有监听并释放与存储的连接
+	Close() error
+}
+
+// StoreKV 存储中的一个 key
+type StoreKV struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// StoreEvent key 的变更
+type StoreEvent struct {
+	Type      string `json:"type"` // StorePut 或 StoreDelete
+	Key       string `json:"key"`
+	Value     []byte `json:"value,omitempty"`      // 删除事件为空
+	PrevValue []byte `json:"prev_value,omitempty"` // 变更前的内容，后端不支持或 key 新建时为空
+	Revision  int64  `json:"revision"`             // 变更的版本号，各后端含义不同，仅用于审计
+	Create    bool   `json:"create,omitempty"`     // key 是否为新建
+}
+
+// IsCreate 是否为新建 key
+func (e *StoreEvent) IsCreate() bool {
+	return e.Type == StorePut && e.Create
+}
+
+// IsModify 是否为修改已有的 key
+func (e *StoreEvent) IsModify() bool {
+	return e.Type == StorePut && !e.Create
+}
+
+// StoreConfig 任务存储的配置，Backend 为空时使用 etcd
+type StoreConfig struct {
+	Backend   string
+	Consul    ConsulConfig
+	ZooKeeper ZooKeeperConfig
+}
+
+// newStore 按配置创建任务存储，配置了回放文件时从文件回放，配置了录制文件时录制 watch 到的事件，录制的内容经 redact 遮盖
+func newStore(conf *Config, redact masker) (JobStore, error) {
+	if conf.Replay.ReplayFile != "" {
+		return newReplayStore(&conf.Replay)
+	}
+
+	store, err := newBackendStore(conf)
+	if err != nil {
+		return nil, err
+	}
+	backend := conf.Store.Backend
+	if backend == "" {
+		backend = StoreEtcd
+	}
+	store = &observedStore{JobStore: store, backend: backend}
+	if conf.Replay.RecordFile == "" {
+		return store, nil
+	}
+	return newRecordingStore(store, conf.Replay.RecordFile, redact)
+}
+
+func newBackendStore(conf *Config) (JobStore, error) {
+	switch conf.Store.Backend {
+	case "", StoreEtcd:
+		return newEtcdStore(conf), nil
+	case StoreConsul:
+		return newConsulStore(conf)
+	case StoreZooKeeper:
+		return newZooKeeperStore(conf)
+	default:
+		return nil, fmt.Errorf("unknown job store backend: %s", conf.Store.Backend)
+	}
+}
+
+// storeNamespace etcd 以外的后端自行在 key 前加上命名空间
+func storeNamespace(conf *Config) string {
+	return etcd.NormalizeNamespace(conf.Namespace)
+}
+
+// snapshot 前缀下所有 key 的内容，用于不支持按版本监听的后端比较前后两次读取的差异
+type snapshot map[string][]byte
+
+func newSnapshot(kvs []*StoreKV) snapshot {
+	s := make(snapshot, len(kvs))
+	for _, kv := range kvs {
+		s[kv.Key] = kv.Value
+	}
+	return s
+}
+
+// diff 生成从 s 变为 next 的事件，按 key 排序
+func (s snapshot) diff(next snapshot, revision int64) []*StoreEvent {
+	var events []*StoreEvent
+	for key, value := range next {
+		prev, ok := s[key]
+		switch {
+		case !ok:
+			events = append(events, &StoreEvent{Type: StorePut, Key: key, Value: value, Revision: revision, Create: true})
+		case string(prev) != string(value):
+			events = append(events, &StoreEvent{Type: StorePut, Key: key, Value: value, PrevValue: prev, Revision: revision})
+		}
+	}
+	for key, prev := range s {
+		if _, ok := next[key]; !ok {
+			events = append(events, &StoreEvent{Type: StoreDelete, Key: key, PrevValue: prev, Revision: revision})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Key < events[j].Key
+	})
+	return events
+}
+
+// procKeys PutProc 写入且未删除的 key，会话或租约过期后由后端以新的会话重新写入，
+// 仍在执行的进程及节点注册不会因短暂断开而丢失
+type procKeys struct {
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+func (p *procKeys) put(key string, value []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.keys == nil {
+		p.keys = make(map[string][]byte)
+	}
+	p.keys[key] = value
+}
+
+func (p *procKeys) delete(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.keys, key)
+}
+
+func (p *procKeys) has(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.keys[key]
+	return ok
+}
+
+func (p *procKeys) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.keys)
+}
+
+// reput 通过 put 重新写入所有 key，失败时按退避间隔重试，直到全部写入或 ctx 结束
+// 写入期间被 DeleteProc 删除的 key 通过 del 再次删除，不保留
+func (p *procKeys) reput(ctx context.Context, timeout, maxBackoff time.Duration, logger *xlog.Logger,
+	put func(ctx context.Context, key string, value []byte) error, del func(ctx context.Context, key string) error) {
+	backoff := time.Second
+	for {
+		p.mu.Lock()
+		kvs := make(map[string][]byte, len(p.keys))
+		for key, value := range p.keys {
+			kvs[key] = value
+		}
+		p.mu.Unlock()
+		if len(kvs) == 0 {
+			return
+		}
+
+		logger.Warn("proc session expired, put proc keys again", xlog.Int("keys", len(kvs)))
+		err := p.putAll(ctx, timeout, kvs, put, del)
+		if err == nil {
+			return
+		}
+		logger.Warn("put proc keys failed", xlog.FieldErr(err), xlog.Duration("retryAfter", backoff))
+
+		if !sleepContext(ctx, backoff) {
+			return
+		}
+		if backoff < maxBackoff {
+			backoff *= 2
+		}
+	}
+}
+
+func (p *procKeys) putAll(ctx context.Context, timeout time.Duration, kvs map[string][]byte,
+	put func(ctx context.Context, key string, value []byte) error, del func(ctx context.Context, key string) error) error {
+	for key, value := range kvs {
+		putCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := put(putCtx, key, value)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		if !p.has(key) {
+			delCtx, cancel := context.WithTimeout(ctx, timeout)
+			_ = del(delCtx, key)
+			cancel()
+		}
+	}
+	return nil
+}
+
+// sleepContext 等待 d 或 ctx 结束，ctx 结束时返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,322 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/hashicorp/consul/api"
+)
+
+// ErrKeyHeld key 已被其他节点的 session 持有
+var ErrKeyHeld = errors.New("key is held by another session")
+
+// ConsulConfig consul 任务存储的配置
+type ConsulConfig struct {
+	Address    string        // consul agent 地址，为空时使用 CONSUL_HTTP_ADDR 或 127.0.0.1:8500
+	Scheme     string        // http 或 https
+	Datacenter string        // 为空时使用 agent 所在的数据中心
+	Token      string        // ACL token
+	SessionTTL time.Duration // 进程、节点注册 key 绑定的 session 的 ttl，consul 要求不小于 10s
+	WaitTime   time.Duration // watch 阻塞查询的最长等待时间
+}
+
+// consulStore 基于 consul kv 的任务存储
+// watch 使用阻塞查询，比较前后两次读取的内容生成事件；与节点存活绑定的 key 及锁使用 behavior 为 delete 的 session
+type consulStore struct {
+	config    *ConsulConfig
+	namespace string
+	node      string
+	lockTTL   time.Duration
+	timeout   time.Duration
+	kv        *api.KV
+	sessions  *api.Session
+	logger    *xlog.Logger
+
+	procs procKeys // PutProc 写入且未删除的 key，session 过期后重新写入
+
+	mu      sync.Mutex
+	session string // PutProc 使用的 session，过期后重新创建
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newConsulStore(conf *Config) (*consulStore, error) {
+	config := &conf.Store.Consul
+	apiConfig := api.DefaultConfig()
+	if config.Address != "" {
+		apiConfig.Address = config.Address
+	}
+	if config.Scheme != "" {
+		apiConfig.Scheme = config.Scheme
+	}
+	apiConfig.Datacenter = config.Datacenter
+	apiConfig.Token = config.Token
+
+	client, err := api.NewClient(apiConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &consulStore{
+		config:    config,
+		namespace: storeNamespace(conf),
+		node:      conf.HostName,
+		lockTTL:   time.Duration(conf.Etcd.LockTTL) * time.Second,
+		timeout:   time.Duration(conf.ReqTimeout) * time.Second,
+		kv:        client.KV(),
+		sessions:  client.Session(),
+		logger:    conf.logger,
+	}
+	if s.lockTTL < 10*time.Second {
+		s.lockTTL = 10 * time.Second
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s, nil
+}
+
+// consulKey consul 的 key 不以 / 开头
+func (s *consulStore) consulKey(key string) string {
+	return strings.TrimPrefix(s.namespace+key, "/")
+}
+
+func (s *consulStore) storeKey(key string) string {
+	return strings.TrimPrefix("/"+key, s.namespace)
+}
+
+func (s *consulStore) list(ctx context.Context, prefix string, index uint64) ([]*StoreKV, uint64, error) {
+	q := &api.QueryOptions{WaitIndex: index, WaitTime: s.config.WaitTime}
+	pairs, meta, err := s.kv.List(s.consulKey(prefix), q.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	kvs := make([]*StoreKV, 0, len(pairs))
+	for _, pair := range pairs {
+		kvs = append(kvs, &StoreKV{Key: s.storeKey(pair.Key), Value: pair.Value})
+	}
+	return kvs, meta.LastIndex, nil
+}
+
+func (s *consulStore) List(ctx context.Context, prefix string) ([]*StoreKV, error) {
+	kvs, _, err := s.list(ctx, prefix, 0)
+	return kvs, err
+}
+
+func (s *consulStore) Watch(ctx context.Context, prefix string) ([]*StoreKV, <-chan *StoreEvent, error) {
+	kvs, index, err := s.list(ctx, prefix, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan *StoreEvent, 100)
+	xgo.Go(func() {
+		defer close(ch)
+
+		current := newSnapshot(kvs)
+		for {
+			next, lastIndex, err := s.list(s.ctx, prefix, index)
+			if s.ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				s.logger.Warn("consul watch failed, retry later", xlog.String("prefix", prefix), xlog.FieldErr(err))
+				if !sleepContext(s.ctx, time.Second) {
+					return
+				}
+				continue
+			}
+			// index 回退时需要重新开始阻塞查询
+			if lastIndex < index {
+				lastIndex = 0
+			}
+			if lastIndex == index {
+				continue
+			}
+			index = lastIndex
+
+			snap := newSnapshot(next)
+			for _, event := range current.diff(snap, int64(index)) {
+				select {
+				case ch <- event:
+				case <-s.ctx.Done():
+					return
+				}
+			}
+			current = snap
+		}
+	})
+	return kvs, ch, nil
+}
+
+func (s *consulStore) Put(ctx context.Context, key string, value []byte) error {
+	_, err := s.kv.Put(&api.KVPair{Key: s.consulKey(key), Value: value}, (&api.WriteOptions{}).WithContext(ctx))
+	return err
+}
+
+func (s *consulStore) Delete(ctx context.Context, key string) error {
+	_, err := s.kv.Delete(s.consulKey(key), (&api.WriteOptions{}).WithContext(ctx))
+	return err
+}
+
+func (s *consulStore) PutProc(ctx context.Context, key string, value []byte) error {
+	if err := s.putProc(ctx, key, value); err != nil {
+		return err
+	}
+	s.procs.put(key, value)
+	return nil
+}
+
+// putProc 以当前的 session 写入 key
+func (s *consulStore) putProc(ctx context.Context, key string, value []byte) error {
+	session, err := s.procSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	acquired, _, err := s.kv.Acquire(&api.KVPair{Key: s.consulKey(key), Value: value, Session: session}, (&api.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return ErrKeyHeld
+	}
+	return nil
+}
+
+func (s *consulStore) DeleteProc(ctx context.Context, key string) error {
+	s.procs.delete(key)
+	return s.Delete(ctx, key)
+}
+
+// procSession 返回 PutProc 使用的 session，不存在或已过期时创建
+// session 过期后其下的 key 被删除，以新的 session 重新写入，仍在执行的进程及节点注册不会丢失
+func (s *consulStore) procSession(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.session != "" {
+		return s.session, nil
+	}
+
+	id, _, err := s.createSession(ctx, s.config.SessionTTL, func() {
+		s.mu.Lock()
+		s.session = ""
+		s.mu.Unlock()
+		s.procs.reput(s.ctx, s.timeout, s.config.SessionTTL, s.logger, s.putProc, s.Delete)
+	})
+	if err != nil {
+		return "", err
+	}
+	s.session = id
+	return id, nil
+}
+
+// createSession 创建 session 并定期续约，session 失效时绑定的 key 被删除
+// 续约失败时调用 expired，调用返回的 stop 或关闭 store 后停止续约并销毁 session
+func (s *consulStore) createSession(ctx context.Context, ttl time.Duration, expired func()) (string, func(), error) {
+	if ttl < 10*time.Second {
+		ttl = 10 * time.Second
+	}
+	id, _, err := s.sessions.Create(&api.SessionEntry{
+		Name:     "juno-agent-" + s.node,
+		TTL:      ttl.String(),
+		Behavior: api.SessionBehaviorDelete,
+	}, (&api.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return "", nil, err
+	}
+
+	done := make(chan struct{})
+	var once sync.Once
+	stop := func() {
+		once.Do(func() { close(done) })
+	}
+	xgo.Go(func() {
+		select {
+		case <-s.ctx.Done():
+			stop()
+		case <-done:
+		}
+	})
+	xgo.Go(func() {
+		if err := s.sessions.RenewPeriodic(ttl.String(), id, nil, done); err != nil {
+			s.logger.Warn("consul session expired", xlog.String("session", id), xlog.FieldErr(err))
+			expired()
+		}
+	})
+	return id, stop, nil
+}
+
+func (s *consulStore) Lock(ctx context.Context, key string) (func() error, error) {
+	id, stop, err := s.createSession(ctx, s.lockTTL, func() {})
+	if err != nil {
+		return nil, err
+	}
+	unlock := func() error {
+		stop()
+		_, err := s.sessions.Destroy(id, nil)
+		return err
+	}
+
+	pair := &api.KVPair{Key: s.consulKey(key), Value: []byte(s.node), Session: id}
+	for {
+		acquired, _, err := s.kv.Acquire(pair, (&api.WriteOptions{}).WithContext(ctx))
+		if err == nil && acquired {
+			return unlock, nil
+		}
+		if err == nil {
+			err = s.waitRelease(ctx, pair.Key)
+		}
+		if err != nil && !sleepContext(ctx, time.Second) {
+			break
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	_ = unlock()
+	return nil, ctx.Err()
+}
+
+// waitRelease 锁被其他 session 持有时，阻塞等待锁 key 变化
+func (s *consulStore) waitRelease(ctx context.Context, key string) error {
+	pair, meta, err := s.kv.Get(key, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil || pair == nil || pair.Session == "" {
+		return err
+	}
+	_, _, err = s.kv.Get(key, (&api.QueryOptions{WaitIndex: meta.LastIndex, WaitTime: s.config.WaitTime}).WithContext(ctx))
+	return err
+}
+
+func (s *consulStore) Check(ctx context.Context) error {
+	opts := (&api.QueryOptions{}).WithContext(ctx)
+	if _, _, err := s.kv.Get(s.consulKey(gcStateKey), opts); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	session := s.session
+	s.mu.Unlock()
+	if session == "" {
+		return nil
+	}
+	entry, _, err := s.sessions.Info(session, opts)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return errors.New("consul proc session expired")
+	}
+	return nil
+}
+
+func (s *consulStore) Close() error {
+	s.cancel()
+	return nil
+}
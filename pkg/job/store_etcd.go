@@ -0,0 +1,257 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/envelope"
+	"github.com/douyu/juno-agent/pkg/etcdv3"
+	"github.com/douyu/juno-agent/pkg/job/etcd"
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// etcdStore 基于 etcd 的任务存储
+// 大的 value 以分块的 envelope 写入，读取时自动合并；与节点存活绑定的 key 共用一个 session 租约
+type etcdStore struct {
+	client  *etcdv3.Client
+	writer  *envelope.Writer
+	timeout time.Duration
+	lockTTL int
+	procTTL int
+	logger  *xlog.Logger
+
+	mu      sync.Mutex
+	session *concurrency.Session // PutProc 使用的租约，过期后重新创建
+	procs   procKeys             // PutProc 写入且未删除的 key，租约过期后重新写入
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newEtcdStore(conf *Config) *etcdStore {
+	s := &etcdStore{
+		client:  newEtcdClient(conf),
+		writer:  conf.Envelope,
+		timeout: time.Duration(conf.ReqTimeout) * time.Second,
+		lockTTL: conf.Etcd.LockTTL,
+		procTTL: conf.Etcd.ProcTTL,
+		logger:  conf.logger,
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+// newEtcdClient 连接任务存储的 etcd，配置错误时 panic，与 etcdv3 的 Build 行为一致
+// 配置了 Namespace 时，所有 key 都会加上命名空间前缀
+func newEtcdClient(conf *Config) *etcdv3.Client {
+	if !conf.EtcdClient.Enabled() {
+		return etcd.WithNamespace(etcdv3.StdConfig(conf.EtcdConfigKey).Build(), conf.Namespace)
+	}
+
+	client, err := etcd.NewClient(&conf.EtcdClient)
+	if err != nil {
+		conf.logger.Panic("connect etcd failed", xlog.FieldErr(err), xlog.Any("endpoints", conf.EtcdClient.Endpoints))
+	}
+	return etcd.WithNamespace(client, conf.Namespace)
+}
+
+// read 读取完整的 value，envelope 的剩余分块需要另外读取
+func (s *etcdStore) read(ctx context.Context, kv *mvccpb.KeyValue) ([]byte, error) {
+	return envelope.Read(ctx, s.client, string(kv.Key), kv.Value)
+}
+
+func (s *etcdStore) storeKVs(ctx context.Context, kvs []*mvccpb.KeyValue) []*StoreKV {
+	result := make([]*StoreKV, 0, len(kvs))
+	for _, kv := range kvs {
+		value, err := s.read(ctx, kv)
+		if err != nil {
+			s.logger.Warn("read key failed", xlog.FieldKey(string(kv.Key)), xlog.FieldErr(err))
+			continue
+		}
+		result = append(result, &StoreKV{Key: string(kv.Key), Value: value})
+	}
+	return result
+}
+
+func (s *etcdStore) List(ctx context.Context, prefix string) ([]*StoreKV, error) {
+	resp, err := s.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	return s.storeKVs(ctx, resp.Kvs), nil
+}
+
+func (s *etcdStore) Watch(ctx context.Context, prefix string) ([]*StoreKV, <-chan *StoreEvent, error) {
+	watch, err := s.client.WatchPrefix(ctx, prefix, clientv3.WithPrevKV())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan *StoreEvent, 100)
+	xgo.Go(func() {
+		defer close(ch)
+		defer watch.Close()
+
+		for {
+			var ev *clientv3.Event
+			select {
+			case ev = <-watch.C():
+			case <-s.ctx.Done():
+				return
+			}
+
+			event := &StoreEvent{
+				Type:     StorePut,
+				Key:      string(ev.Kv.Key),
+				Revision: ev.Kv.ModRevision,
+				Create:   ev.IsCreate(),
+			}
+			if ev.PrevKv != nil {
+				event.PrevValue = ev.PrevKv.Value
+			}
+			if ev.Type == clientv3.EventTypeDelete {
+				event.Type = StoreDelete
+			} else {
+				ctx, cancel := context.WithTimeout(s.ctx, s.timeout)
+				value, err := s.read(ctx, ev.Kv)
+				cancel()
+				if err != nil {
+					s.logger.Warn("read key failed", xlog.FieldKey(string(ev.Kv.Key)), xlog.FieldErr(err))
+					continue
+				}
+				event.Value = value
+			}
+
+			select {
+			case ch <- event:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	})
+	return s.storeKVs(ctx, watch.IncipientKeyValues()), ch, nil
+}
+
+func (s *etcdStore) Put(ctx context.Context, key string, value []byte) error {
+	// 超过 etcd 单个 value 的限制时压缩并分块写入
+	return s.writer.Put(ctx, s.client, key, value)
+}
+
+func (s *etcdStore) Delete(ctx context.Context, key string) error {
+	return envelope.Delete(ctx, s.client, key)
+}
+
+func (s *etcdStore) PutProc(ctx context.Context, key string, value []byte) error {
+	if err := s.putProc(ctx, key, value); err != nil {
+		return err
+	}
+	s.procs.put(key, value)
+	return nil
+}
+
+// putProc 以当前的租约写入 key
+func (s *etcdStore) putProc(ctx context.Context, key string, value []byte) error {
+	session, err := s.procSession()
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Put(ctx, key, string(value), clientv3.WithLease(session.Lease()))
+	return err
+}
+
+func (s *etcdStore) DeleteProc(ctx context.Context, key string) error {
+	s.procs.delete(key)
+	return s.deleteProc(ctx, key)
+}
+
+func (s *etcdStore) deleteProc(ctx context.Context, key string) error {
+	_, err := s.client.Delete(ctx, key)
+	return err
+}
+
+func (s *etcdStore) Check(ctx context.Context) error {
+	s.mu.Lock()
+	session := s.session
+	s.mu.Unlock()
+	procs := s.procs.len()
+	if session != nil && procs > 0 {
+		select {
+		case <-session.Done():
+			return errors.New("etcd proc lease expired")
+		default:
+		}
+	}
+	_, err := s.client.Get(ctx, gcStateKey)
+	return err
+}
+
+// procSession 返回 PutProc 使用的 session，不存在或租约已过期时创建
+func (s *etcdStore) procSession() (*concurrency.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.session != nil {
+		select {
+		case <-s.session.Done():
+		default:
+			return s.session, nil
+		}
+	}
+
+	session, err := concurrency.NewSession(s.client.Client, concurrency.WithTTL(s.procTTL))
+	if err != nil {
+		return nil, err
+	}
+	s.session = session
+	go s.keepProcs(session)
+	return session, nil
+}
+
+// keepProcs 租约在与 etcd 断开超过 ttl 后过期，其下的 key 被删除，
+// 节点恢复连接后以新的租约重新写入，仍在执行的进程及节点注册不会丢失；
+// 节点宕机时租约不再续期，key 在 ttl 后自动删除
+func (s *etcdStore) keepProcs(session *concurrency.Session) {
+	select {
+	case <-session.Done():
+	case <-s.ctx.Done():
+		return
+	}
+	s.procs.reput(s.ctx, s.timeout, time.Duration(s.procTTL)*time.Second, s.logger, s.putProc, s.deleteProc)
+}
+
+func (s *etcdStore) Lock(ctx context.Context, key string) (func() error, error) {
+	session, err := concurrency.NewSession(s.client.Client, concurrency.WithTTL(s.lockTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	mutex := concurrency.NewMutex(session, key)
+	if err := mutex.Lock(ctx); err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+
+	return func() error {
+		if err := mutex.Unlock(context.Background()); err != nil {
+			return err
+		}
+		return session.Close()
+	}, nil
+}
+
+func (s *etcdStore) Close() error {
+	s.cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.session != nil {
+		_ = s.session.Close()
+	}
+	return s.client.Close()
+}
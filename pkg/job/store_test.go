@@ -0,0 +1,111 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	prev := newSnapshot([]*StoreKV{
+		{Key: "/a", Value: []byte("1")},
+		{Key: "/b", Value: []byte("2")},
+		{Key: "/c", Value: []byte("3")},
+	})
+	next := newSnapshot([]*StoreKV{
+		{Key: "/a", Value: []byte("1")},
+		{Key: "/b", Value: []byte("20")},
+		{Key: "/d", Value: []byte("4")},
+	})
+
+	events := prev.diff(next, 7)
+	assert.Len(t, events, 3)
+
+	assert.Equal(t, "/b", events[0].Key)
+	assert.True(t, events[0].IsModify())
+	assert.Equal(t, []byte("2"), events[0].PrevValue)
+	assert.Equal(t, []byte("20"), events[0].Value)
+
+	assert.Equal(t, "/c", events[1].Key)
+	assert.Equal(t, StoreDelete, events[1].Type)
+	assert.Nil(t, events[1].Value)
+
+	assert.Equal(t, "/d", events[2].Key)
+	assert.True(t, events[2].IsCreate())
+	assert.Equal(t, int64(7), events[2].Revision)
+
+	assert.Empty(t, next.diff(next, 8))
+}
+
+func TestStoreKeys(t *testing.T) {
+	consul := &consulStore{namespace: "/prod"}
+	assert.Equal(t, "prod/juno/cronjob/job/1", consul.consulKey(JobsKeyPrefix+"1"))
+	assert.Equal(t, JobsKeyPrefix+"1", consul.storeKey("prod/juno/cronjob/job/1"))
+
+	zk := &zkStore{}
+	assert.Equal(t, "/juno/cronjob/job", zk.zkPath(JobsKeyPrefix))
+	assert.Equal(t, "/juno/cronjob/job/1", zk.storeKey(zk.zkPath(JobsKeyPrefix+"1")))
+
+	assert.Equal(t, "jupiter", getJobIDFromLockKey(LockKeyPrefix+"jupiter/694d7a2b"))
+}
+
+func TestZkWatcherWait(t *testing.T) {
+	s := &zkStore{}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	w := &zkWatcher{store: s, armed: make(map[zkWatch]bool), triggers: make(chan zkWatch, 10)}
+
+	data, children := zkWatch{path: "/a"}, zkWatch{path: "/a", children: true}
+	events := make(chan zk.Event, 2)
+	w.arm(data, events)
+	w.arm(children, events)
+	assert.Len(t, w.armed, 2)
+
+	// 同时触发的 watch 一次取出，下次读取时重新注册
+	events <- zk.Event{Type: zk.EventNodeDataChanged}
+	events <- zk.Event{Type: zk.EventNodeChildrenChanged}
+	assert.Eventually(t, func() bool { return len(w.triggers) == 2 }, time.Second, time.Millisecond)
+	assert.True(t, w.wait())
+	assert.Empty(t, w.armed)
+
+	w.pending = true
+	assert.True(t, w.wait())
+
+	s.cancel()
+	assert.False(t, w.wait())
+}
+
+func TestProcKeysReput(t *testing.T) {
+	procs := &procKeys{}
+	procs.put("/proc/1", []byte("1"))
+	procs.put("/node/a", []byte("a"))
+
+	// 第一次写入失败后重试；写入期间被删除的 key 再次删除
+	puts := make(map[string][]byte)
+	var deleted []string
+	attempts := 0
+	put := func(ctx context.Context, key string, value []byte) error {
+		if attempts++; attempts == 1 {
+			return errors.New("lease not found")
+		}
+		if key == "/proc/1" {
+			procs.delete(key)
+		}
+		puts[key] = value
+		return nil
+	}
+	del := func(ctx context.Context, key string) error {
+		deleted = append(deleted, key)
+		return nil
+	}
+	procs.reput(context.Background(), time.Second, time.Second, xlog.DefaultLogger, put, del)
+
+	assert.Equal(t, []byte("a"), puts["/node/a"])
+	assert.Equal(t, []string{"/proc/1"}, deleted)
+	assert.False(t, procs.has("/proc/1"))
+	assert.True(t, procs.has("/node/a"))
+}
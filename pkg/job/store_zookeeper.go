@@ -0,0 +1,427 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/go-zookeeper/zk"
+)
+
+// ZooKeeperConfig zookeeper 任务存储的配置
+type ZooKeeperConfig struct {
+	Servers        []string      // zookeeper 地址，如 127.0.0.1:2181
+	SessionTimeout time.Duration // 会话超时时间，节点断开超过该时间后临时节点被删除
+	RetryInterval  time.Duration // watch 读取子树失败后重试的间隔
+	Auth           string        // digest 认证信息，格式为 user:password，为空时不认证
+}
+
+// zkStore 基于 zookeeper 的任务存储
+// key 对应同名的 znode，中间路径自动创建；与节点存活绑定的 key 及锁使用临时节点
+// zookeeper 的 watch 只触发一次且不支持监听子树，watch 在子树的每个节点上注册 watch，
+// 任一触发后重新读取整个子树并比较差异
+type zkStore struct {
+	config    *ZooKeeperConfig
+	namespace string
+	node      string
+	conn      *zk.Conn
+	acl       []zk.ACL
+	timeout   time.Duration
+	logger    *xlog.Logger
+
+	procs procKeys // PutProc 写入且未删除的 key，会话过期后重新创建
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// zkLogger 将 zookeeper 客户端的日志输出到 worker 的日志
+type zkLogger struct {
+	*xlog.Logger
+}
+
+func (l zkLogger) Printf(format string, args ...interface{}) {
+	l.Infof(format, args...)
+}
+
+func newZooKeeperStore(conf *Config) (*zkStore, error) {
+	config := &conf.Store.ZooKeeper
+	if config.SessionTimeout <= 0 {
+		config.SessionTimeout = 10 * time.Second
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = time.Second
+	}
+
+	conn, events, err := zk.Connect(config.Servers, config.SessionTimeout, zk.WithLogger(zkLogger{conf.logger}))
+	if err != nil {
+		return nil, err
+	}
+	if config.Auth != "" {
+		if err := conn.AddAuth("digest", []byte(config.Auth)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	s := &zkStore{
+		config:    config,
+		namespace: storeNamespace(conf),
+		node:      conf.HostName,
+		conn:      conn,
+		acl:       zk.WorldACL(zk.PermAll),
+		timeout:   time.Duration(conf.ReqTimeout) * time.Second,
+		logger:    conf.logger,
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	xgo.Go(func() {
+		s.keepProcs(events)
+	})
+	return s, nil
+}
+
+// keepProcs 会话过期后临时节点被删除，客户端以新的会话重连后重新创建，
+// 仍在执行的进程及节点注册不会丢失；节点宕机时临时节点在会话超时后删除
+// 客户端不会关闭 events，store 关闭后退出
+func (s *zkStore) keepProcs(events <-chan zk.Event) {
+	expired := false
+	for {
+		var event zk.Event
+		select {
+		case event = <-events:
+		case <-s.ctx.Done():
+			return
+		}
+
+		switch event.State {
+		case zk.StateExpired:
+			expired = true
+		case zk.StateHasSession:
+			if expired {
+				expired = false
+				s.procs.reput(s.ctx, s.timeout, s.config.SessionTimeout, s.logger, s.putProc, s.Delete)
+			}
+		}
+	}
+}
+
+// zkPath znode 路径不能以 / 结尾
+func (s *zkStore) zkPath(key string) string {
+	return path.Clean("/" + s.namespace + key)
+}
+
+func (s *zkStore) storeKey(p string) string {
+	return strings.TrimPrefix(p, s.namespace)
+}
+
+// walk 读取 p 及其下所有有内容的节点，只用于存放中间路径的空节点被忽略
+func (s *zkStore) walk(p string, kvs []*StoreKV) ([]*StoreKV, error) {
+	data, _, err := s.conn.Get(p)
+	if err == zk.ErrNoNode {
+		return kvs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		kvs = append(kvs, &StoreKV{Key: s.storeKey(p), Value: data})
+	}
+
+	children, _, err := s.conn.Children(p)
+	if err == zk.ErrNoNode {
+		return kvs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		if kvs, err = s.walk(path.Join(p, child), kvs); err != nil {
+			return nil, err
+		}
+	}
+	return kvs, nil
+}
+
+func (s *zkStore) List(ctx context.Context, prefix string) ([]*StoreKV, error) {
+	return s.walk(s.zkPath(prefix), nil)
+}
+
+func (s *zkStore) Watch(ctx context.Context, prefix string) ([]*StoreKV, <-chan *StoreEvent, error) {
+	w := &zkWatcher{
+		store:    s,
+		armed:    make(map[zkWatch]bool),
+		triggers: make(chan zkWatch, 100),
+	}
+	kvs, err := w.walk(s.zkPath(prefix), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan *StoreEvent, 100)
+	xgo.Go(func() {
+		defer close(ch)
+
+		current := newSnapshot(kvs)
+		for w.wait() {
+			next, err := w.walk(s.zkPath(prefix), nil)
+			if err != nil {
+				s.logger.Warn("zookeeper watch failed, retry later", xlog.String("prefix", prefix), xlog.FieldErr(err))
+				// 读取失败时部分节点的 watch 可能未注册，重试前不等待触发
+				if !sleepContext(s.ctx, s.config.RetryInterval) {
+					return
+				}
+				w.pending = true
+				continue
+			}
+
+			snap := newSnapshot(next)
+			for _, event := range current.diff(snap, time.Now().UnixNano()) {
+				select {
+				case ch <- event:
+				case <-s.ctx.Done():
+					return
+				}
+			}
+			current = snap
+		}
+	})
+	return kvs, ch, nil
+}
+
+// zkWatch 节点上的一个 watch，children 为 true 时监听子节点列表，否则监听节点的内容及是否存在
+type zkWatch struct {
+	path     string
+	children bool
+}
+
+// zkWatcher 子树上已注册的 watch，只在 Watch 的协程中访问，触发后从 armed 中删除，下次读取时重新注册
+// 会话过期或连接关闭时客户端会触发所有 watch，重新读取时全部重新注册
+type zkWatcher struct {
+	store    *zkStore
+	armed    map[zkWatch]bool
+	triggers chan zkWatch
+	pending  bool // 读取失败，需要重新读取
+}
+
+// arm 等待 watch 触发后通知 triggers
+func (w *zkWatcher) arm(watch zkWatch, events <-chan zk.Event) {
+	w.armed[watch] = true
+	xgo.Go(func() {
+		<-events
+		select {
+		case w.triggers <- watch:
+		case <-w.store.ctx.Done():
+		}
+	})
+}
+
+// wait 等待任一 watch 触发，返回前取出同时触发的其他 watch，store 关闭时返回 false
+func (w *zkWatcher) wait() bool {
+	if w.pending {
+		w.pending = false
+		return true
+	}
+
+	select {
+	case watch := <-w.triggers:
+		delete(w.armed, watch)
+	case <-w.store.ctx.Done():
+		return false
+	}
+	for {
+		select {
+		case watch := <-w.triggers:
+			delete(w.armed, watch)
+		default:
+			return true
+		}
+	}
+}
+
+// walk 读取 p 及其下所有有内容的节点，只用于存放中间路径的空节点被忽略，未注册 watch 的节点同时注册
+func (w *zkWatcher) walk(p string, kvs []*StoreKV) ([]*StoreKV, error) {
+	conn := w.store.conn
+
+	var data []byte
+	var err error
+	if watch := (zkWatch{path: p}); w.armed[watch] {
+		data, _, err = conn.Get(p)
+	} else {
+		var exists bool
+		var events <-chan zk.Event
+		// ExistsW 在节点不存在时同样注册 watch，节点创建后触发
+		if exists, _, events, err = conn.ExistsW(p); err == nil {
+			w.arm(watch, events)
+			if !exists {
+				return kvs, nil
+			}
+			data, _, err = conn.Get(p)
+		}
+	}
+	if err == zk.ErrNoNode {
+		return kvs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		kvs = append(kvs, &StoreKV{Key: w.store.storeKey(p), Value: data})
+	}
+
+	var children []string
+	if watch := (zkWatch{path: p, children: true}); w.armed[watch] {
+		children, _, err = conn.Children(p)
+	} else {
+		var events <-chan zk.Event
+		if children, _, events, err = conn.ChildrenW(p); err == nil {
+			w.arm(watch, events)
+		}
+	}
+	if err == zk.ErrNoNode {
+		return kvs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		if kvs, err = w.walk(path.Join(p, child), kvs); err != nil {
+			return nil, err
+		}
+	}
+	return kvs, nil
+}
+
+// ensureParents 创建 p 的所有上级节点
+func (s *zkStore) ensureParents(p string) error {
+	parent := path.Dir(p)
+	if parent == "/" {
+		return nil
+	}
+	if exists, _, err := s.conn.Exists(parent); err != nil || exists {
+		return err
+	}
+	if err := s.ensureParents(parent); err != nil {
+		return err
+	}
+	if _, err := s.conn.Create(parent, nil, 0, s.acl); err != nil && err != zk.ErrNodeExists {
+		return err
+	}
+	return nil
+}
+
+// create 创建节点，节点已存在时更新内容
+func (s *zkStore) create(key string, value []byte, flags int32) error {
+	p := s.zkPath(key)
+	if err := s.ensureParents(p); err != nil {
+		return err
+	}
+
+	_, err := s.conn.Create(p, value, flags, s.acl)
+	if err == zk.ErrNodeExists {
+		_, err = s.conn.Set(p, value, -1)
+	}
+	return err
+}
+
+func (s *zkStore) Put(ctx context.Context, key string, value []byte) error {
+	return s.create(key, value, 0)
+}
+
+func (s *zkStore) Delete(ctx context.Context, key string) error {
+	err := s.conn.Delete(s.zkPath(key), -1)
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	return err
+}
+
+func (s *zkStore) PutProc(ctx context.Context, key string, value []byte) error {
+	if err := s.putProc(ctx, key, value); err != nil {
+		return err
+	}
+	s.procs.put(key, value)
+	return nil
+}
+
+func (s *zkStore) putProc(ctx context.Context, key string, value []byte) error {
+	return s.create(key, value, zk.FlagEphemeral)
+}
+
+func (s *zkStore) DeleteProc(ctx context.Context, key string) error {
+	s.procs.delete(key)
+	return s.Delete(ctx, key)
+}
+
+// Lock 创建临时节点作为锁，节点已存在时通过 watch 等待其被删除后重试
+func (s *zkStore) Lock(ctx context.Context, key string) (func() error, error) {
+	p := s.zkPath(key)
+	if err := s.ensureParents(p); err != nil {
+		return nil, err
+	}
+
+	for {
+		_, err := s.conn.Create(p, []byte(s.node), zk.FlagEphemeral, s.acl)
+		if err == nil {
+			_, stat, err := s.conn.Exists(p)
+			if err != nil {
+				return nil, err
+			}
+			return func() error {
+				return s.unlock(p, stat)
+			}, nil
+		}
+		if err != zk.ErrNodeExists {
+			return nil, err
+		}
+
+		exists, _, ch, err := s.conn.ExistsW(p)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.ctx.Done():
+			return nil, s.ctx.Err()
+		}
+	}
+}
+
+// unlock 只删除抢到的锁节点：会话过期后锁节点已被删除，可能已由其他节点重新创建，
+// 按创建时的 zxid 判断是否仍是同一个节点，并带上抢到时的版本号删除
+func (s *zkStore) unlock(p string, acquired *zk.Stat) error {
+	exists, stat, err := s.conn.Exists(p)
+	if err != nil {
+		return err
+	}
+	if !exists || stat.Czxid != acquired.Czxid {
+		return nil
+	}
+	err = s.conn.Delete(p, acquired.Version)
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	return err
+}
+
+// Check 会话断开或过期后临时节点会被删除，连接恢复并重新建立会话前未就绪
+func (s *zkStore) Check(ctx context.Context) error {
+	if state := s.conn.State(); state != zk.StateHasSession {
+		return fmt.Errorf("zookeeper session state is %s", state)
+	}
+	return nil
+}
+
+func (s *zkStore) Close() error {
+	s.cancel()
+	s.conn.Close()
+	return nil
+}
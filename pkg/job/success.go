@@ -0,0 +1,69 @@
+package job
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// SuccessRule 判断任务执行是否成功的规则，各条件同时满足才算成功，
+// 用于退出码为 0 但输出中打印了错误的脚本
+type SuccessRule struct {
+	ExitCodes  []int  `json:"exit_codes"`  // 视为成功的退出码，为空时只有 0 为成功
+	Match      string `json:"match"`       // 输出必须匹配的正则
+	NotMatch   string `json:"not_match"`   // 输出不能匹配的正则，如 "(?i)error"
+	MaxRuntime int64  `json:"max_runtime"` // 单位秒，执行时间超过时视为失败，大于 0 时有效，不会终止进程
+
+	match    *regexp.Regexp
+	notMatch *regexp.Regexp
+}
+
+// 验证 success 字段
+func (r *SuccessRule) Valid() error {
+	var err error
+	if r.Match != "" {
+		if r.match, err = regexp.Compile(r.Match); err != nil {
+			return fmt.Errorf("invalid success match regexp, parse err: %s", err.Error())
+		}
+	}
+	if r.NotMatch != "" {
+		if r.notMatch, err = regexp.Compile(r.NotMatch); err != nil {
+			return fmt.Errorf("invalid success not_match regexp, parse err: %s", err.Error())
+		}
+	}
+	if r.MaxRuntime < 0 {
+		return fmt.Errorf("invalid success max_runtime[%d]", r.MaxRuntime)
+	}
+	return nil
+}
+
+// Check 按规则检查一次执行，不满足时返回原因
+func (r *SuccessRule) Check(exitCode int, output string, runtime time.Duration) error {
+	if !r.acceptExitCode(exitCode) {
+		return fmt.Errorf("exit code %d not accepted", exitCode)
+	}
+	if r.match != nil && !r.match.MatchString(output) {
+		return fmt.Errorf("output does not match %q", r.Match)
+	}
+	if r.notMatch != nil {
+		if found := r.notMatch.FindString(output); found != "" {
+			return fmt.Errorf("output matches %q: %s", r.NotMatch, found)
+		}
+	}
+	if r.MaxRuntime > 0 && runtime > time.Duration(r.MaxRuntime)*time.Second {
+		return fmt.Errorf("runtime %s exceeds %ds", runtime.Round(time.Millisecond), r.MaxRuntime)
+	}
+	return nil
+}
+
+func (r *SuccessRule) acceptExitCode(exitCode int) bool {
+	if len(r.ExitCodes) == 0 {
+		return exitCode == 0
+	}
+	for _, code := range r.ExitCodes {
+		if code == exitCode {
+			return true
+		}
+	}
+	return false
+}
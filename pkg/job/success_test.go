@@ -0,0 +1,30 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuccessRule(t *testing.T) {
+	rule := &SuccessRule{
+		ExitCodes:  []int{0, 3},
+		NotMatch:   "(?i)error",
+		MaxRuntime: 60,
+	}
+	assert.NoError(t, rule.Valid())
+
+	assert.NoError(t, rule.Check(0, "done", time.Second))
+	assert.NoError(t, rule.Check(3, "nothing to do", time.Second))
+	assert.Error(t, rule.Check(1, "done", time.Second))
+	assert.Error(t, rule.Check(0, "ERROR: connect refused", time.Second))
+	assert.Error(t, rule.Check(0, "done", 2*time.Minute))
+
+	rule = &SuccessRule{Match: `rows=\d+`}
+	assert.NoError(t, rule.Valid())
+	assert.NoError(t, rule.Check(0, "rows=10", 0))
+	assert.Error(t, rule.Check(0, "", 0))
+
+	assert.Error(t, (&SuccessRule{Match: "("}).Valid())
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/douyu/juno-agent/pkg/tracing"
 	"github.com/douyu/jupiter/pkg/xlog"
 )
 
@@ -13,9 +15,17 @@ type (
 	Task struct {
 		TaskID uint64
 
-		job        *Job
-		executedAt time.Time
-		finishedAt *time.Time
+		job         *Job
+		shard       *Shard
+		batch       string
+		trigger     *TriggerEvent
+		env         []string // 额外传给命令的环境变量
+		reduceRound int64
+		result      *JobResult
+		masker      masker // 遮盖输出中的密钥明文及敏感内容，没有需要遮盖的内容时为空
+		executedAt  time.Time
+		finishedAt  *time.Time
+		span        *tracing.Span
 	}
 
 	TaskOption func(t *Task)
@@ -28,12 +38,18 @@ type (
 		Job        *Job           `json:"job"`
 		Logs       string         `json:"logs"`
 		RunOn      string         `json:"run_on"`
+		Shard      *Shard         `json:"shard,omitempty"`
+		Alert      string         `json:"alert,omitempty"`
+		Result     *JobResult     `json:"result,omitempty"` // 命令输出的结构化结果
 		ExecutedAt time.Time      `json:"executed_at"`
 		FinishedAt *time.Time     `json:"finished_at"`
 	}
 )
 
-var (
+// 输出加密失败时写入存储的内容
+const logsDroppedPrefix = "logs dropped: encrypt failed: "
+
+const (
 	CronTaskStatusProcessing CronTaskStatus = "processing"
 	CronTaskStatusSuccess    CronTaskStatus = "success"
 	CronTaskStatusFailed     CronTaskStatus = "failed"
@@ -48,16 +64,33 @@ func NewTask(job *Job, ops ...TaskOption) *Task {
 	for _, op := range ops {
 		op(task)
 	}
+	// 生成失败时 TaskID 为 0，调用方检查后不执行、不写入执行记录
 	if task.TaskID == 0 {
-		id, _ := job.worker.taskIdGen.NextID()
+		id, err := job.worker.taskIdGen.NextID()
+		if err != nil {
+			job.logger.Error("generate task id failed", xlog.FieldErr(err), xlog.String("job", job.ID))
+			id = 0
+		}
 		task.TaskID = id
 	}
 
+	task.span = job.Tracer.Start("cronjob "+job.Name, "")
+	task.span.SetAttribute("job.id", job.ID)
+	task.span.SetAttribute("job.name", job.Name)
+	task.span.SetAttribute("task.id", task.TaskID)
+	task.span.SetAttribute("node.id", job.runOn)
+	task.span.SetAttribute("host.name", job.HostName)
+	if task.shard != nil {
+		task.span.SetAttribute("job.shard", task.shard.Index)
+	}
+
 	return task
 }
 
 func (t *Task) SetStatus(status CronTaskStatus, logs string) error {
-	if status == CronTaskStatusSuccess || status == CronTaskStatusFailed || status == CronTaskStatusTimeout {
+	logs = t.mask(logs)
+	if status == CronTaskStatusSuccess || status == CronTaskStatusFailed || status == CronTaskStatusTimeout ||
+		status == CronTaskStatusOrphaned || status == CronTaskStatusSkipped {
 		now := time.Now()
 		t.finishedAt = &now
 	}
@@ -68,16 +101,85 @@ func (t *Task) SetStatus(status CronTaskStatus, logs string) error {
 		Status:     status,
 		Logs:       logs,
 		RunOn:      t.job.HostName,
+		Shard:      t.shard,
+		Result:     t.result,
 		ExecutedAt: t.executedAt,
 		FinishedAt: t.finishedAt,
 	}
+	if t.finishedAt != nil {
+		if hook := t.job.hook(t.job.Hook); hook != nil {
+			if err := hook.After(&payload); err != nil {
+				t.job.logger.Warn("run after hook failed", fieldJob(t.job.ID), xlog.FieldErr(err))
+			}
+		}
+	}
+	t.job.recordRun(&payload)
+	t.job.emit(&CallbackEvent{
+		Event:      callbackEvent(status),
+		JobID:      t.job.ID,
+		JobName:    t.job.Name,
+		TaskID:     t.TaskID,
+		Node:       t.job.HostName,
+		ExecutedAt: t.executedAt,
+		FinishedAt: t.finishedAt,
+	})
+	if t.finishedAt != nil {
+		t.endSpan(status, logs)
+	}
+
+	if t.job.EncryptResults && t.job.Keyring != nil {
+		tenant := t.job.Tenant
+		if tenant == "" {
+			tenant = DefaultTenant
+		}
+		// 加密失败时不写入明文输出，输出替换为丢弃的原因，状态仍然写入
+		encrypted, err := t.job.Keyring.Encrypt(tenant, []byte(payload.Logs))
+		if err != nil {
+			resultEncryptFailuresCounter.Inc(t.job.ID)
+			t.job.logger.Error("encrypt task logs failed, logs are dropped", fieldJob(t.job.ID), fieldTask(t.TaskID), xlog.FieldErr(err))
+			encrypted = logsDroppedPrefix + err.Error()
+		}
+		payload.Logs = encrypted
+	}
+
 	payloadBytes, _ := json.Marshal(&payload)
 
-	_, err := t.job.Client.Put(context.Background(),
-		t.Key(),
-		string(payloadBytes),
-	)
-	return err
+	if t.finishedAt != nil {
+		t.reportShard(payloadBytes)
+		if t.reduceRound != 0 {
+			if err := t.job.store.Put(context.Background(), ReduceResultKey(t.job.ID, t.reduceRound), payloadBytes); err != nil {
+				t.job.logger.Warn("put reduce result failed", fieldJob(t.job.ID), xlog.FieldErr(err))
+			}
+		}
+	}
+
+	if t.batch != "" {
+		if err := t.job.store.Put(context.Background(), BatchResultKey(t.batch, t.job.HostName), payloadBytes); err != nil {
+			t.job.logger.Warn("put batch result failed", xlog.String("batchId", t.batch), fieldJob(t.job.ID), xlog.FieldErr(err))
+		}
+	}
+
+	return t.job.store.Put(context.Background(), t.Key(), payloadBytes)
+}
+
+// mask 遮盖日志中的密钥明文及敏感内容
+func (t *Task) mask(logs string) string {
+	if t.masker == nil {
+		return logs
+	}
+	return t.masker.Replace(logs)
+}
+
+// endSpan 结束任务的 trace span，失败时记录输出的最后一行
+func (t *Task) endSpan(status CronTaskStatus, logs string) {
+	t.span.SetAttribute("job.status", string(status))
+	if status == CronTaskStatusSuccess || status == CronTaskStatusSkipped {
+		t.span.SetStatus(tracing.StatusOK, "")
+	} else {
+		logs = strings.TrimSpace(logs)
+		t.span.SetStatus(tracing.StatusError, logs[strings.LastIndex(logs, "\n")+1:])
+	}
+	t.span.End()
 }
 
 func (t *Task) Key() string {
@@ -85,8 +187,7 @@ func (t *Task) Key() string {
 }
 
 func (t *Task) Stop() {
-	_, err := t.job.Client.Delete(context.Background(), t.Key())
-	if err != nil {
+	if err := t.job.store.Delete(context.Background(), t.Key()); err != nil {
 		t.job.logger.Error("delete task result failed", xlog.FieldErr(err))
 	}
 }
@@ -96,3 +197,9 @@ func WithTaskID(taskId uint64) TaskOption {
 		t.TaskID = taskId
 	}
 }
+
+func WithShard(shard *Shard) TaskOption {
+	return func(t *Task) {
+		t.shard = shard
+	}
+}
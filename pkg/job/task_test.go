@@ -0,0 +1,52 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/douyu/juno-agent/pkg/keyring"
+	"github.com/stretchr/testify/assert"
+)
+
+// brokenMaster 无法包装数据密钥，新租户的加密总是失败
+type brokenMaster struct{}
+
+func (brokenMaster) Wrap(key, aad []byte) ([]byte, error) {
+	return nil, errors.New("kms unavailable")
+}
+
+func (brokenMaster) Unwrap(wrapped, aad []byte) ([]byte, error) {
+	return nil, errors.New("kms unavailable")
+}
+
+func TestEncryptFailureDropsLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "encrypt")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ring, err := keyring.New(filepath.Join(dir, "keyring.json"), brokenMaster{})
+	assert.Nil(t, err)
+	w := newReplayWorker(t, func(c *Config) {
+		c.EncryptResults = true
+		c.Keyring = ring
+	})
+
+	job := &Job{ID: "a", Name: "a", worker: w}
+	task := NewTask(job)
+	assert.Nil(t, task.SetStatus(CronTaskStatusSuccess, "password is hunter2"))
+
+	kvs, err := w.store.List(context.Background(), task.Key())
+	assert.Nil(t, err)
+	assert.Len(t, kvs, 1)
+	var result TaskResult
+	assert.Nil(t, json.Unmarshal(kvs[0].Value, &result))
+	assert.Equal(t, CronTaskStatusSuccess, result.Status)
+	assert.True(t, strings.HasPrefix(result.Logs, logsDroppedPrefix))
+	assert.NotContains(t, result.Logs, "hunter2")
+}
@@ -0,0 +1,112 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sony/sonyflake"
+)
+
+// MachineKeyPrefix 节点的 sonyflake 机器号，machine/id/{机器号} 的值为占用该机器号的节点 ID
+const MachineKeyPrefix = "/juno/cronjob/machine/"
+
+const (
+	machineIDKeyPrefix = MachineKeyPrefix + "id/"
+	machineLockKey     = MachineKeyPrefix + "lock"
+)
+
+var (
+	errTaskIDGen = errors.New("create task id generator failed")
+	// ErrNoMachineID 机器号已全部分配给其他节点，节点不启动
+	ErrNoMachineID = errors.New("no machine id available")
+	// ErrTaskID 生成 task id 失败，不执行，避免以 0 为 task id 写入执行记录
+	ErrTaskID = errors.New("generate task id failed")
+)
+
+// taskIDGen 生成 task id
+type taskIDGen interface {
+	NextID() (uint64, error)
+}
+
+// newTaskIDGen 创建 task id 生成器，task id 的低 16 位为节点的机器号，节点间不重复时 task id 不重复
+func newTaskIDGen(machineID uint16) (taskIDGen, error) {
+	gen := sonyflake.NewSonyflake(sonyflake.Settings{
+		MachineID: func() (uint16, error) {
+			return machineID, nil
+		},
+	})
+	// 起始时间晚于当前时间等情况下返回 nil
+	if gen == nil {
+		return nil, errTaskIDGen
+	}
+	return gen, nil
+}
+
+// allocMachineID 在任务存储中为节点分配机器号。
+// 持锁读取已分配的机器号，节点已占用机器号时沿用，否则从节点 ID 的哈希开始取第一个空闲的机器号写入。
+// 分配的 key 不随节点下线删除，节点重启后机器号不变；0 保留给未分配的情况
+func allocMachineID(ctx context.Context, store JobStore, nodeID string) (uint16, error) {
+	unlock, err := store.Lock(ctx, machineLockKey)
+	if err != nil {
+		return 0, fmt.Errorf("lock: %w", err)
+	}
+	defer func() {
+		_ = unlock()
+	}()
+
+	kvs, err := store.List(ctx, machineIDKeyPrefix)
+	if err != nil {
+		return 0, err
+	}
+	used := make(map[uint16]bool, len(kvs))
+	for _, kv := range kvs {
+		id, err := strconv.ParseUint(strings.TrimPrefix(kv.Key, machineIDKeyPrefix), 10, 16)
+		if err != nil || id == 0 {
+			continue
+		}
+		if string(kv.Value) == nodeID {
+			return uint16(id), nil
+		}
+		used[uint16(id)] = true
+	}
+
+	start := uint16(nodeHash(nodeID))
+	for i := 0; i < 1<<16; i++ {
+		id := start + uint16(i)
+		if id == 0 || used[id] {
+			continue
+		}
+		if err := store.Put(ctx, machineIDKey(id), []byte(nodeID)); err != nil {
+			return 0, err
+		}
+		return id, nil
+	}
+	return 0, ErrNoMachineID
+}
+
+// machineIDKey 机器号的分配 key
+func machineIDKey(id uint16) string {
+	return machineIDKeyPrefix + strconv.Itoa(int(id))
+}
+
+// machineID 配置的机器号，未配置时在任务存储中分配
+func (c *Config) machineID(store JobStore) (uint16, error) {
+	if c.MachineID != 0 {
+		return c.MachineID, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.ReqTimeout)*time.Second)
+	defer cancel()
+	return allocMachineID(ctx, store, c.HostName)
+}
+
+// nodeHash 节点 ID 的 64 位哈希
+func nodeHash(nodeID string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(nodeID))
+	return h.Sum64()
+}
@@ -0,0 +1,62 @@
+package job
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTaskIDGen(t *testing.T) {
+	gen, err := newTaskIDGen(42)
+	assert.NoError(t, err)
+	ids := make(map[uint64]bool)
+	for i := 0; i < 1000; i++ {
+		id, err := gen.NextID()
+		assert.NoError(t, err)
+		assert.False(t, ids[id])
+		assert.EqualValues(t, 42, id&0xffff)
+		ids[id] = true
+	}
+	id, _ := gen.NextID()
+	created, ok := taskTime(id)
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now(), created, time.Second)
+}
+
+func TestAllocMachineID(t *testing.T) {
+	ctx := context.Background()
+	store := &replayStore{kvs: make(map[string][]byte)}
+
+	// 从节点 ID 的哈希开始分配，被占用时取下一个
+	start := uint16(nodeHash("node-a"))
+	assert.NoError(t, store.Put(ctx, machineIDKey(start), []byte("node-x")))
+	a, err := allocMachineID(ctx, store, "node-a")
+	assert.NoError(t, err)
+	assert.NotEqual(t, start, a)
+	assert.NotZero(t, a)
+
+	// 重启后沿用已分配的机器号
+	again, err := allocMachineID(ctx, store, "node-a")
+	assert.NoError(t, err)
+	assert.Equal(t, a, again)
+
+	b, err := allocMachineID(ctx, store, "node-b")
+	assert.NoError(t, err)
+	assert.NotEqual(t, a, b)
+
+	// 配置的机器号优先
+	config := &Config{HostName: "node-c", MachineID: 7}
+	id, err := config.machineID(store)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 7, id)
+
+	// 没有空闲的机器号时不分配
+	full := &replayStore{kvs: make(map[string][]byte)}
+	for i := 1; i < 1<<16; i++ {
+		full.kvs[machineIDKey(uint16(i))] = []byte("other")
+	}
+	_, err = allocMachineID(ctx, full, "node-a")
+	assert.Equal(t, ErrNoMachineID, err)
+}
@@ -0,0 +1,141 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+var ErrJobNotDefined = errors.New("job not defined")
+
+// command 渲染任务的 Args，其中可以用 {{.name}} 引用 Params
+// 执行的程序路径不渲染参数，避免参数值中的 ../ 等改变执行的程序；
+// 除 shell 方式外渲染结果直接作为 argv 传给进程，不经过 shell，参数值不需要转义；
+// shell 方式下 Script 为命令行，拼入的参数值经过引号转义，只作为一个单词，Args 作为 $1、$2... 原样传入
+func (j *Job) command() (string, []string, error) {
+	if j.ExecMode == ExecModeArgv {
+		argv, err := j.argv()
+		if err != nil {
+			return "", nil, err
+		}
+		script, err := lookPath(argv[0])
+		if err != nil {
+			return "", nil, err
+		}
+		return script, argv[1:], nil
+	}
+
+	script := j.Script
+	if j.ExecMode == ExecModeShell {
+		quoted, err := quoteParams(j.Params)
+		if err != nil {
+			return "", nil, err
+		}
+		if script, err = renderParams(j.Script, quoted); err != nil {
+			return "", nil, fmt.Errorf("render script: %w", err)
+		}
+	} else if err := literalProgram(script); err != nil {
+		return "", nil, err
+	}
+
+	args := make([]string, 0, len(j.Args))
+	for i, arg := range j.Args {
+		arg, err := renderParams(arg, j.Params)
+		if err != nil {
+			return "", nil, fmt.Errorf("render args[%d]: %w", i, err)
+		}
+		args = append(args, arg)
+	}
+	if j.ExecMode == ExecModeShell {
+		var err error
+		script, args = shellLine(script, args)
+		if script, err = lookPath(script); err != nil {
+			return "", nil, err
+		}
+	}
+	return script, args, nil
+}
+
+// literalProgram 执行的程序路径中引用参数时拒绝执行，参数只能通过 Args 传入
+func literalProgram(path string) error {
+	if strings.Contains(path, "{{") {
+		return fmt.Errorf("program %q must not reference params, pass them in args", path)
+	}
+	return nil
+}
+
+// renderParams 引用了不存在的参数时返回错误，避免以空值执行命令
+func renderParams(text string, params map[string]string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tpl, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf strings.Builder
+	if err := tpl.Execute(&buf, params); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// quoteParams 转义后的参数值用于拼入 shell 命令行
+func quoteParams(params map[string]string) (map[string]string, error) {
+	quoted := make(map[string]string, len(params))
+	for k, v := range params {
+		q, err := shellQuote(v)
+		if err != nil {
+			return nil, fmt.Errorf("param %s: %w", k, err)
+		}
+		quoted[k] = q
+	}
+	return quoted, nil
+}
+
+// resolveOnce 临时任务没有指定 Script 时按 ID 引用已定义的任务，
+// 使用任务定义中的命令执行，临时任务的 Params 覆盖任务定义中的默认参数
+func (w *worker) resolveOnce(o *OnceJob) error {
+	if o.Script != "" || len(o.Command) > 0 {
+		return nil
+	}
+
+	job, err := w.loadJob(o.ID)
+	if err != nil {
+		return err
+	}
+
+	params := make(map[string]string, len(job.Params)+len(o.Params))
+	for k, v := range job.Params {
+		params[k] = v
+	}
+	for k, v := range o.Params {
+		params[k] = v
+	}
+
+	o.Job = *job
+	o.Params = params
+	return nil
+}
+
+// loadJob 从存储中读取任务定义，不要求任务调度在当前节点上
+func (w *worker) loadJob(id string) (*Job, error) {
+	ctx, cancel := NewEtcdTimeoutContext(w)
+	defer cancel()
+
+	// 前缀查询会匹配到 id 以 jobId 开头的其他任务
+	kvs, err := w.store.List(ctx, JobsKeyPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, kv := range kvs {
+		if kv.Key == JobsKeyPrefix+id {
+			return w.GetJobContentFromKv(kv.Key, kv.Value)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrJobNotDefined, id)
+}
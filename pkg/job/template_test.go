@@ -0,0 +1,33 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobCommand(t *testing.T) {
+	job := &Job{
+		Script: "/opt/billing/backfill.sh",
+		Args:   []string{"--date", "{{.date}}", "--dry-run"},
+		Params: map[string]string{"app": "../../tmp", "date": "2020-01-02; rm -rf /"},
+	}
+
+	script, args, err := job.command()
+	assert.NoError(t, err)
+	assert.Equal(t, "/opt/billing/backfill.sh", script)
+	assert.Equal(t, []string{"--date", "2020-01-02; rm -rf /", "--dry-run"}, args)
+
+	job.Params = map[string]string{"app": "billing"}
+	_, _, err = job.command()
+	assert.Error(t, err)
+
+	// 程序路径不渲染参数
+	job.Script, job.Args = "/opt/{{.app}}/backfill.sh", nil
+	_, _, err = job.command()
+	assert.Error(t, err)
+
+	job.ExecMode, job.Script = ExecModeArgv, "{{.app}}/backfill.sh --app {{.app}}"
+	_, _, err = job.command()
+	assert.Error(t, err)
+}
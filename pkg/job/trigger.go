@@ -0,0 +1,134 @@
+package job
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+const (
+	TriggerKeyPrefix = "/juno/cronjob/trigger/" // 外部系统写入的触发 key，任务按 key 名称订阅
+
+	EnvTriggerKey     = "JUNO_TRIGGER_KEY"     // 触发本次执行的 key 名称
+	EnvTriggerPayload = "JUNO_TRIGGER_PAYLOAD" // 触发 key 最新的值
+
+	// 超过该长度的值不通过环境变量传递，避免超出系统对环境变量的限制
+	maxTriggerPayload = 64 << 10
+)
+
+// Trigger 触发 key 变更时执行任务，可以和 Timers 同时使用
+type Trigger struct {
+	// TriggerKeyPrefix 下的 key 名称
+	Key string `json:"key"`
+	// 单位秒，key 在该时间内多次变更只执行一次，使用最后一次的值；为 0 时每次变更都执行
+	Debounce int `json:"debounce"`
+}
+
+func (t *Trigger) Valid() error {
+	if t.Key == "" || strings.HasPrefix(t.Key, "/") {
+		return errors.New("invalid trigger, key should be a non-empty name under the trigger prefix")
+	}
+	if t.Debounce < 0 {
+		return errors.New("invalid trigger, debounce should not be negative")
+	}
+	return nil
+}
+
+// TriggerEvent 触发本次执行的 key 及其值
+type TriggerEvent struct {
+	Key     string `json:"key"`
+	Payload string `json:"-"`
+}
+
+func (e *TriggerEvent) Env() []string {
+	env := []string{EnvTriggerKey + "=" + e.Key}
+	if len(e.Payload) <= maxTriggerPayload {
+		env = append(env, EnvTriggerPayload+"="+e.Payload)
+	}
+	return env
+}
+
+func WithTrigger(event *TriggerEvent) TaskOption {
+	return func(t *Task) {
+		t.trigger = event
+	}
+}
+
+// watchTriggers 监听触发 key，订阅该 key 的任务在防抖时间后执行
+// 只有调度在当前节点上的任务会执行，单机任务由持有锁的节点执行
+func (w *worker) watchTriggers() {
+	_, events := w.watchPrefix(TriggerKeyPrefix)
+
+	xgo.Go(func() {
+		for event := range events {
+			if event.Type == StoreDelete {
+				continue
+			}
+
+			trigger := &TriggerEvent{
+				Key:     strings.TrimPrefix(event.Key, TriggerKeyPrefix),
+				Payload: string(event.Value),
+			}
+			if len(trigger.Payload) > maxTriggerPayload {
+				w.logger.Warn("trigger payload too large, not passed to command", xlog.String("key", trigger.Key), xlog.Int("size", len(trigger.Payload)))
+			}
+			for _, job := range w.triggeredJobs(trigger.Key) {
+				w.debounceTrigger(job, trigger)
+			}
+		}
+	})
+}
+
+// triggeredJobs 当前节点上订阅了 key 的任务
+func (w *worker) triggeredJobs(key string) []*Job {
+	w.jobsMutex.RLock()
+	defer w.jobsMutex.RUnlock()
+
+	jobs := make([]*Job, 0)
+	for _, job := range w.jobs {
+		if job.Enable && job.Trigger != nil && job.Trigger.Key == key {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// debounceTrigger 在防抖时间内重复的变更会重置 timer，到期后使用最后一次的值执行
+func (w *worker) debounceTrigger(job *Job, trigger *TriggerEvent) {
+	if job.Trigger.Debounce <= 0 {
+		go w.fireTrigger(job.ID, trigger)
+		return
+	}
+
+	w.triggerMutex.Lock()
+	defer w.triggerMutex.Unlock()
+
+	if timer, ok := w.triggers[job.ID]; ok {
+		timer.Stop()
+	}
+	w.triggers[job.ID] = time.AfterFunc(time.Duration(job.Trigger.Debounce)*time.Second, func() {
+		w.triggerMutex.Lock()
+		delete(w.triggers, job.ID)
+		w.triggerMutex.Unlock()
+
+		w.fireTrigger(job.ID, trigger)
+	})
+}
+
+// fireTrigger 执行前重新读取任务，防抖期间任务被删除或取消订阅时不再执行
+func (w *worker) fireTrigger(jobID string, trigger *TriggerEvent) {
+	job, ok := w.getJob(jobID)
+	if !ok || !job.Enable || job.Trigger == nil || job.Trigger.Key != trigger.Key {
+		return
+	}
+	if w.isDraining() {
+		return
+	}
+
+	w.logger.Info("job triggered", fieldJob(jobID), xlog.String("key", trigger.Key))
+	cmd := &Cmd{Job: job}
+	_ = cmd.runWithRetry(WithTrigger(trigger))
+}
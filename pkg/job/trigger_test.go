@@ -0,0 +1,38 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTriggerValid(t *testing.T) {
+	assert.NoError(t, (&Trigger{Key: "deploy/app"}).Valid())
+	assert.Error(t, (&Trigger{}).Valid())
+	assert.Error(t, (&Trigger{Key: "/juno/cronjob/trigger/x"}).Valid())
+	assert.Error(t, (&Trigger{Key: "x", Debounce: -1}).Valid())
+
+	env := (&TriggerEvent{Key: "deploy/app", Payload: "v2"}).Env()
+	assert.Equal(t, []string{EnvTriggerKey + "=deploy/app", EnvTriggerPayload + "=v2"}, env)
+}
+
+func TestDebounceTrigger(t *testing.T) {
+	w := &worker{
+		Config:   DefaultConfig(),
+		jobs:     make(Jobs),
+		triggers: make(map[string]*time.Timer),
+	}
+	job := &Job{ID: "a", Enable: true, Trigger: &Trigger{Key: "k", Debounce: 60}}
+	w.jobs[job.ID] = job
+	assert.Equal(t, []*Job{job}, w.triggeredJobs("k"))
+	assert.Empty(t, w.triggeredJobs("other"))
+
+	// 防抖期间的变更重置 timer，只保留一个等待执行
+	w.debounceTrigger(job, &TriggerEvent{Key: "k", Payload: "1"})
+	first := w.triggers[job.ID]
+	w.debounceTrigger(job, &TriggerEvent{Key: "k", Payload: "2"})
+	assert.Len(t, w.triggers, 1)
+	assert.False(t, first.Stop(), "previous timer should have been stopped")
+	w.triggers[job.ID].Stop()
+}
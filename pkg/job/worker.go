@@ -19,49 +19,151 @@ import (
 	"encoding/json"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/coreos/etcd/clientv3"
-	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/douyu/juno-agent/pkg/audit"
 	"github.com/douyu/juno-agent/pkg/job/etcd"
 	"github.com/douyu/juno-agent/util"
-	"github.com/douyu/jupiter/pkg/client/etcdv3"
 	"github.com/douyu/jupiter/pkg/util/xgo"
 	"github.com/douyu/jupiter/pkg/xlog"
-	"github.com/sony/sonyflake"
 )
 
 // Node 执行 cron 命令服务的结构体
 type worker struct {
 	*Config
-	*etcdv3.Client
 	*Cron
 
-	ID             string
-	ImmediatelyRun bool // 是否立即执行
+	store JobStore // 任务存储
+
+	ID string
 
 	jobs        Jobs // 和结点相关的任务
+	jobsMutex   sync.RWMutex
+	syncMutex   sync.Mutex        // 处理任务变更的 watch 事件与定期对账串行执行
+	repaired    map[string]uint64 // jobId -> 对账已修复到的任务定义摘要，由 syncMutex 保护
 	cmds        map[string]*Cmd
-	runningJobs map[string]context.CancelFunc
+	runningJobs map[string]map[uint64]context.CancelFunc // jobId -> taskId -> kill func
+	runningPids map[uint64]RunningProcess                // taskId -> 正在执行的进程
+	runs        map[string][]*TaskResult                 // jobId -> 最近的执行结果
+	outputs     map[uint64]*taskOutput                   // taskId -> 正在执行的任务输出
+	failures    map[string]int                           // jobId -> 连续失败次数
+	durations   map[string][]float64                     // jobId -> 最近成功执行的耗时，单位秒
+	runsMutex   sync.Mutex
+	onceTasks   chan *OnceJob // 等待执行的临时任务
 
 	done      chan struct{}
-	taskIdGen *sonyflake.Sonyflake
+	stopOnce  sync.Once
+	stopErr   error
+	taskIdGen taskIDGen
+	limiter   *startLimiter     // 限制每分钟启动的进程数，为空时不限制
+	draining  int32             // 节点下线前置为 1，不再调度、抢锁及启动新的执行
+	callback  *callbackReporter // 推送任务事件给管理端，为空时不推送
+	kafka     *kafkaExporter    // 任务事件写入 kafka，为空时不写入
+	shipper   *logShipper       // 任务输出投递到 loki、elasticsearch，为空时不投递
+	envs      *envCache         // 任务依赖的运行环境
+	artifacts *artifactCache    // 按 SHA-256 缓存的任务制品
+	redact    redactRules       // 任务输出中需要遮盖的敏感内容
+
+	commandPolicy *commandPolicy // 执行前检查命令，为空时不检查
+
+	hooks     map[string]*Hook // 扩展脚本
+	hookMutex sync.RWMutex
+
+	calendars     map[string]*Calendar // 维护日历
+	calendarMutex sync.RWMutex
+
+	triggers     map[string]*time.Timer // jobId -> 防抖中等待执行的触发
+	triggerMutex sync.Mutex
+
+	jobErrors     map[string]string // 当前节点在存储中有错误 key 的任务，jobId -> 错误内容
+	jobErrorMutex sync.Mutex
+
+	watches    watchTracker // 各前缀 watch 的状态
+	storeCheck storeCheck   // 就绪检查最近一次探测任务存储的结果
+
+	onceNonces onceNonces // 开启 jobAuth 时已执行的临时任务 nonce
+
+	resultMetrics resultMetrics // 各任务结构化结果中已暴露的 metrics 名称
+
+	// 保护重新加载配置时替换的 limiter、callback、kafka、commandPolicy 及 Labels、NodeGroups、Blackout
+	reloadMutex sync.RWMutex
 }
 
 func NewWorker(conf *Config) (w *worker) {
+	redact, err := newRedactRules(&conf.Redact)
+	if err != nil {
+		conf.logger.Panic("invalid redact config", xlog.FieldErr(err))
+	}
+	store, err := newStore(conf, redact)
+	if err != nil {
+		conf.logger.Panic("create job store failed", xlog.FieldErr(err), xlog.String("backend", conf.Store.Backend))
+	}
+	if conf.Replay.ReplayFile == "" {
+		// 重新加载配置时可以切换到新的命名空间
+		store = &switchableStore{store: store}
+	}
+	if len(conf.Blackout.Windows) > 0 || len(conf.Blackout.Calendars) > 0 {
+		if err := conf.Blackout.Valid(); err != nil {
+			conf.logger.Panic("invalid blackout config", xlog.FieldErr(err))
+		}
+	}
+	commandPolicy, err := newCommandPolicy(&conf.CommandPolicy, conf.logger)
+	if err != nil {
+		conf.logger.Panic("load command policy failed", xlog.FieldErr(err), xlog.String("file", conf.CommandPolicy.File))
+	}
+	if err := conf.JobAuth.Valid(); err != nil {
+		conf.logger.Panic("invalid jobAuth config", xlog.FieldErr(err))
+	}
+	if err := conf.DSTPolicy.Valid(); err != nil {
+		conf.logger.Panic("invalid dst policy", xlog.FieldErr(err))
+	}
+	if err := conf.Kafka.Valid(); err != nil {
+		conf.logger.Panic("invalid kafka config", xlog.FieldErr(err))
+	}
+	if err := conf.LogShip.Valid(); err != nil {
+		conf.logger.Panic("invalid log ship config", xlog.FieldErr(err))
+	}
+	// 没有可用的机器号时不启动，避免与其他节点生成重复的 task id
+	machineID, err := conf.machineID(store)
+	if err != nil {
+		conf.logger.Panic("allocate machine id failed", xlog.FieldErr(err), xlog.String("node", conf.HostName))
+	}
+	taskIdGen, err := newTaskIDGen(machineID)
+	if err != nil {
+		conf.logger.Panic("create task id generator failed", xlog.FieldErr(err), xlog.Any("machineID", machineID))
+	}
+
 	w = &worker{
-		Config:         conf,
-		ID:             conf.HostName,
-		Client:         etcdv3.StdConfig("default").Build(),
-		ImmediatelyRun: false,
-		cmds:           make(map[string]*Cmd),
-		runningJobs:    make(map[string]context.CancelFunc),
-		done:           make(chan struct{}),
-		taskIdGen:      sonyflake.NewSonyflake(sonyflake.Settings{}), // default setting
+		Config:      conf,
+		ID:          conf.HostName,
+		store:       store,
+		cmds:        make(map[string]*Cmd),
+		runningJobs: make(map[string]map[uint64]context.CancelFunc),
+		runs:        make(map[string][]*TaskResult),
+		outputs:     make(map[uint64]*taskOutput),
+		failures:    make(map[string]int),
+		durations:   make(map[string][]float64),
+		hooks:       make(map[string]*Hook),
+		calendars:   make(map[string]*Calendar),
+		onceTasks:   make(chan *OnceJob, conf.OnceQueue.Capacity),
+		triggers:    make(map[string]*time.Timer),
+		done:        make(chan struct{}),
+		taskIdGen:   taskIdGen,
+		limiter:     newStartLimiter(conf.MaxStartsPerMinute),
+		redact:      redact,
+
+		commandPolicy: commandPolicy,
 	}
 
+	w.callback = newCallbackReporter(&conf.Callback, conf.logger, w.done)
+	w.kafka = newKafkaExporter(&conf.Kafka, conf.HostName, conf.logger, w.done)
+	w.shipper = newLogShipper(&conf.LogShip, conf.logger, w.done)
+	w.envs = newEnvCache(&conf.EnvCache, conf.logger)
+	w.artifacts = newArtifactCache(&conf.Artifacts)
 	w.Cron = newCron(w)
 
-	w.logger.Info("agent info :", xlog.String("name", conf.AppIP+":"+conf.HostName))
+	w.logger.Info("agent info :", xlog.String("name", conf.AppIP+":"+conf.HostName), xlog.String("namespace", etcd.NormalizeNamespace(conf.Namespace)))
 
 	return
 }
@@ -70,16 +172,80 @@ func (w *worker) Run() error {
 	w.logger.Info("worker run...")
 
 	w.Cron.Run()
+	for i := 0; i < w.OnceQueue.Workers; i++ {
+		go w.runOnceTasks()
+	}
+	if w.OnceQueue.Mode == OnceQueueRedis {
+		go w.popOnce()
+	}
+	w.reconcileProcs()
+	w.watchStore()
+	if w.Pack.Enable {
+		go w.syncPacks()
+	}
+	if w.GC.Enable {
+		go w.runGC()
+	}
+	if w.Reconcile.Enable {
+		go w.runReconcile()
+	}
+	if w.commandPolicy != nil {
+		go w.commandPolicy.run(w.done)
+	}
+	go w.gcWorkspaces()
+	if w.SelfMetrics.Interval > 0 {
+		go w.runSelfMetrics()
+	}
+
+	return nil
+}
+
+// watchStore 在当前的任务存储中注册节点并建立各前缀的 watch，启动及切换命名空间时调用
+func (w *worker) watchStore() {
+	if err := w.registerNode(); err != nil {
+		w.logger.Warn("register node failed", xlog.FieldErr(err))
+	}
+
+	// 各 watch 在后台建立，全部建立后节点才就绪
+	w.watches.expect(JobsKeyPrefix, LockKeyPrefix, BatchKeyPrefix, TriggerKeyPrefix, ProcKeyPrefix, KillKeyPrefix+w.HostName+"/")
+	if w.OnceQueue.Mode != OnceQueueRedis {
+		w.watches.expect(OnceKeyPrefix + w.HostName)
+	}
+	w.watchHooks()
+	w.watchCalendars()
 	go w.watchLocks()
 	go w.watchJobs()
-	go w.watchOnce()
+	if w.OnceQueue.Mode != OnceQueueRedis {
+		go w.watchOnce()
+	}
+	go w.watchBatches()
+	go w.watchTriggers()
 	go w.watchExecutingProc()
+	go w.watchKills()
+}
 
-	return nil
+// Stop 停止调度，释放持有的任务锁并关闭任务存储，单机任务由其他节点接管
+// Stop 只有第一次调用生效，之后的调用返回第一次的结果
+func (w *worker) Stop() error {
+	w.stopOnce.Do(func() {
+		close(w.done)
+		_ = w.Cron.Stop()
+
+		w.jobsMutex.RLock()
+		for _, job := range w.jobs {
+			job.Unlock()
+		}
+		w.jobsMutex.RUnlock()
+
+		w.stopErr = w.store.Close()
+	})
+	return w.stopErr
 }
 
-func (w *worker) loadJobs(keyValue []*mvccpb.KeyValue) {
+func (w *worker) loadJobs(keyValue []*StoreKV) {
+	w.jobsMutex.Lock()
 	w.jobs = make(map[string]*Job)
+	w.jobsMutex.Unlock()
 	if len(keyValue) == 0 {
 		return
 	}
@@ -87,12 +253,12 @@ func (w *worker) loadJobs(keyValue []*mvccpb.KeyValue) {
 	for _, val := range keyValue {
 		job, err := w.GetJobContentFromKv(val.Key, val.Value)
 		if err != nil {
-			w.logger.Warnf("job[%s] is invalid: %s", val.Key, err.Error())
+			w.logger.Warn("job is invalid", fieldJob(GetIDFromKey(val.Key)), xlog.FieldErr(err))
 			continue
 		}
 
 		job.runOn = w.ID
-		if _, ok := w.jobs[job.ID]; !ok {
+		if _, ok := w.getJob(job.ID); !ok {
 			w.addJob(job)
 		}
 	}
@@ -102,72 +268,86 @@ func (w *worker) loadJobs(keyValue []*mvccpb.KeyValue) {
 
 // watchJobs watch jobs
 func (w *worker) watchJobs() {
-	ctx, cancelFunc := NewEtcdTimeoutContext(w)
-	defer cancelFunc()
-
-	watch, err := etcd.WatchPrefix(w.Client, ctx, JobsKeyPrefix)
-	if err != nil {
-		panic(err)
-	}
+	kvs, events := w.watchPrefix(JobsKeyPrefix)
 
 	// 将之前job保存下来
-	w.loadJobs(watch.IncipientKeyValues())
+	w.loadJobErrors()
+	w.loadJobs(kvs)
 
 	xgo.Go(func() {
-		for event := range watch.C() {
-			switch {
-			case event.IsCreate():
-				w.logger.Info("is create..")
-				job, err := w.GetJobContentFromKv(event.Kv.Key, event.Kv.Value)
-				if err != nil {
-					continue
-				}
+		for event := range events {
+			w.syncMutex.Lock()
+			w.handleJobEvent(event)
+			w.syncMutex.Unlock()
+		}
+	})
+}
 
-				job.runOn = w.ID
-				w.addJob(job)
-			case event.IsModify():
-				w.logger.Info("is IsModify..")
-				job, err := w.GetJobContentFromKv(event.Kv.Key, event.Kv.Value)
-				if err != nil {
-					continue
-				}
+func (w *worker) handleJobEvent(event *StoreEvent) {
+	switch {
+	case event.IsCreate():
+		w.logger.Info("is create..")
+		w.auditEvent(audit.ActionCreate, event)
+		job, err := w.GetJobContentFromKv(event.Key, event.Value)
+		if err != nil {
+			return
+		}
 
-				job.runOn = w.ID
-				w.modJob(job)
-			case event.Type == clientv3.EventTypeDelete:
-				w.logger.Info("is EventTypeDelete..")
-				w.delJob(GetIDFromKey(string(event.Kv.Key)))
-			default:
-				w.logger.Warnf("unknown event type[%v] from job[%s]", event.Type, string(event.Kv.Key))
-			}
+		job.runOn = w.ID
+		w.addJob(job)
+		w.runOnAdd(job.ID)
+	case event.IsModify():
+		w.logger.Info("is IsModify..")
+		w.auditEvent(audit.ActionModify, event)
+		job, err := w.GetJobContentFromKv(event.Key, event.Value)
+		if err != nil {
+			return
 		}
-	})
+
+		job.runOn = w.ID
+		// 内容未变的修改（如重复写入）不触发立即执行
+		prev, ok := w.getJob(job.ID)
+		changed := !ok || jobHash(prev) != jobHash(job)
+		w.modJob(job)
+		if changed {
+			w.runOnAdd(job.ID)
+		}
+	case event.Type == StoreDelete:
+		w.logger.Info("is EventTypeDelete..")
+		w.auditEvent(audit.ActionDelete, event)
+		w.delJob(GetIDFromKey(event.Key))
+		w.clearJobError(GetIDFromKey(event.Key))
+	default:
+		w.logger.Warn("unknown job event type", xlog.String("type", event.Type), xlog.FieldKey(event.Key))
+	}
 }
 
 // 立即执行一次任务
 func (w *worker) watchOnce() {
-	ctx, cancelFunc := NewEtcdTimeoutContext(w)
-	defer cancelFunc()
-
-	watch, err := etcd.WatchPrefix(w.Client, ctx, OnceKeyPrefix+w.HostName)
-	if err != nil {
-		panic(err)
-	}
+	_, events := w.watchPrefix(OnceKeyPrefix + w.HostName)
 
 	xgo.Go(func() {
-		for event := range watch.C() {
+		for event := range events {
 			switch {
 			case event.IsCreate(), event.IsModify():
-				w.logger.Info("once task...")
-
-				job, err := w.GetOnceJobFromKv(event.Kv.Key, event.Kv.Value)
+				job, err := w.GetOnceJobFromKv(event.Key, event.Value)
 				if err != nil {
 					xlog.Error("get job from kv failed", xlog.String("err", err.Error()))
 					continue
 				}
+				if job.Ack != nil {
+					// 节点写回的确认
+					continue
+				}
 
-				job.worker = w
-				go job.RunWithRecovery(WithTaskID(job.TaskID))
+				w.logger.Info("once task...")
+				w.auditEvent(audit.ActionOnce, event)
+				if err = w.resolveOnce(job); err != nil {
+					w.logger.Error("resolve once job failed", fieldJob(job.ID), xlog.FieldErr(err))
+				} else if err = w.acceptOnce(job); err != nil {
+					w.logger.Warn("reject once task", fieldJob(job.ID), fieldTask(job.TaskID), xlog.FieldErr(err))
+				}
+				w.ackOnce(event.Key, event.Value, newOnceAck(w.ID, job.TaskID, err))
 			}
 		}
 	})
@@ -175,24 +355,17 @@ func (w *worker) watchOnce() {
 
 // watch任务执行列表，执行强杀操作
 func (w *worker) watchExecutingProc() {
-	ctx, cancelFunc := NewEtcdTimeoutContext(w)
-	defer cancelFunc()
-
-	watch, err := etcd.WatchPrefix(w.Client, ctx, ProcKeyPrefix)
-	if err != nil {
-		panic(err)
-	}
+	_, events := w.watchPrefix(ProcKeyPrefix)
 
 	xgo.Go(func() {
-		for event := range watch.C() {
+		for event := range events {
 			switch {
 			case event.IsModify():
 				w.logger.Info("exec process task...")
 
-				key := string(event.Kv.Key)
-				process, err := GetProcFromKey(key)
+				process, err := GetProcFromKey(event.Key)
 				if err != nil {
-					w.logger.Warnf("err: %s, kv: %s", err.Error(), event.Kv.String())
+					w.logger.Warn("parse proc key failed", xlog.FieldKey(event.Key), xlog.FieldErr(err))
 					continue
 				}
 
@@ -200,9 +373,8 @@ func (w *worker) watchExecutingProc() {
 					continue
 				}
 
-				val := string(event.Kv.Value)
 				pv := &ProcessVal{}
-				err = json.Unmarshal([]byte(val), pv)
+				err = json.Unmarshal(event.Value, pv)
 				if err != nil {
 					continue
 				}
@@ -216,15 +388,23 @@ func (w *worker) watchExecutingProc() {
 }
 
 func (w *worker) delJob(id string) {
-	job, ok := w.jobs[id]
+	job, ok := w.getJob(id)
 	// 之前此任务没有在当前结点执行
 	if !ok {
 		return
 	}
 
-	xlog.Error("worker.delJob:delete a job", xlog.String("jobId", id))
+	xlog.Error("worker.delJob:delete a job", fieldJob(id))
 
+	w.jobsMutex.Lock()
 	delete(w.jobs, id)
+	w.jobsMutex.Unlock()
+
+	w.runsMutex.Lock()
+	delete(w.runs, id)
+	delete(w.failures, id)
+	delete(w.durations, id)
+	w.runsMutex.Unlock()
 	job.Unlock()
 
 	cmds := job.Cmds()
@@ -239,17 +419,17 @@ func (w *worker) delJob(id string) {
 }
 
 func (w *worker) modJob(job *Job) {
-	oJob, ok := w.jobs[job.ID]
+	oJob, ok := w.getJob(job.ID)
 	if !ok {
 		w.addJob(job)
 		return
 	}
 
 	job.worker = w
-	job.mutex = oJob.mutex
+	job.unlock = oJob.unlock
 	job.locked = oJob.locked
 
-	if util.InStringArray(job.Nodes, w.HostName) < 0 {
+	if !w.isJobTarget(job) {
 		w.delJob(job.ID)
 		return
 	}
@@ -265,7 +445,10 @@ func (w *worker) modJob(job *Job) {
 	}
 
 	prevCmds := oJob.Cmds()
+	// 原地更新，cmd 中引用的是同一个 job
+	w.jobsMutex.Lock()
 	*oJob = *job
+	w.jobsMutex.Unlock()
 	cmds := oJob.Cmds()
 
 	// 筛选出需要删除的任务
@@ -282,24 +465,31 @@ func (w *worker) modJob(job *Job) {
 func (w *worker) addJob(job *Job) {
 	job.worker = w
 
-	if util.InStringArray(job.Nodes, w.HostName) < 0 {
+	if !w.isJobTarget(job) {
 		// ignore
-		xlog.Info("worker.addJob: Nodes do not contain current node, skip it.", xlog.String("jobId", job.ID))
+		xlog.Info("worker.addJob: current node is not the target of job, skip it.", fieldJob(job.ID))
+		return
+	}
+	if w.isDraining() {
+		xlog.Info("worker.addJob: current node is draining, skip it.", fieldJob(job.ID))
 		return
 	}
 
-	if job.JobType == TypeAlone {
+	// 分片任务由各节点分别执行自己的分片，不抢锁
+	if job.JobType == TypeAlone && !job.IsSharded() {
 		err := job.Lock()
 		if err != nil {
-			xlog.Info("failed to lock job. ignore it", xlog.String("jobId", job.ID))
+			xlog.Info("failed to lock job. ignore it", fieldJob(job.ID))
 			return
 		}
 	}
 
-	xlog.Info("worker.addJob: add a job", xlog.String("jobId", job.ID), xlog.Any("job", job))
+	xlog.Info("worker.addJob: add a job", fieldJob(job.ID), xlog.Any("job", job))
 
 	// 添加任务到当前节点
+	w.jobsMutex.Lock()
 	w.jobs[job.ID] = job
+	w.jobsMutex.Unlock()
 
 	cmds := job.Cmds()
 	if len(cmds) == 0 {
@@ -312,13 +502,47 @@ func (w *worker) addJob(job *Job) {
 	return
 }
 
+// runOnAdd 开启了 RunOnAdd 的任务新增或修改后立即执行一次，节点启动加载任务时不执行
+// 任务没有调度到当前节点（如单机任务的锁被其他节点持有）时不执行
+func (w *worker) runOnAdd(id string) {
+	job, ok := w.getJob(id)
+	if !ok || !job.Enable || !job.RunOnAdd || w.isDraining() {
+		return
+	}
+	// 分片任务的各分片按调度轮次分配，立即执行无法确定轮次
+	if job.IsSharded() {
+		w.logger.Warn("run_on_add is ignored for sharded job", fieldJob(id))
+		return
+	}
+
+	w.logger.Info("run job on add", fieldJob(id))
+	cmd := &Cmd{Job: job}
+	xgo.Go(func() {
+		_ = cmd.runWithRetry()
+	})
+}
+
+// isJobTarget 判断任务是否需要在当前节点调度
+// 分片任务按节点组匹配，设置了 Selector 的任务按节点标签匹配，其余按 Nodes 列表匹配
+func (w *worker) isJobTarget(job *Job) bool {
+	groups, labels := w.nodeSelectors()
+	if job.IsSharded() {
+		return util.InStringArray(groups, job.NodeGroup) >= 0
+	}
+	if len(job.Selector) > 0 {
+		return MatchSelector(job.Selector, labels)
+	}
+	return util.InStringArray(job.Nodes, w.HostName) >= 0
+}
+
 func (w *worker) delCmd(cmd *Cmd) {
 	c, ok := w.cmds[cmd.GetID()]
 	if ok {
 		delete(w.cmds, cmd.GetID())
 		w.Cron.Remove(c.schEntryID)
+		cronEntriesGauge.Set(float64(len(w.cmds)))
 	}
-	w.logger.Infof("job[%s] rule[%s] timer[%s] has deleted", cmd.Job.ID, cmd.Timer.ID, cmd.Timer.Cron)
+	w.logger.Info("timer deleted", fieldJob(cmd.Job.ID), xlog.String("timer_id", cmd.Timer.ID), xlog.String("timer", cmd.Timer.Cron))
 }
 
 func (w *worker) modCmd(cmd *Cmd) {
@@ -329,53 +553,66 @@ func (w *worker) modCmd(cmd *Cmd) {
 	}
 
 	entryID := c.schEntryID
-	sch := c.Timer.Cron
+	sch, dst := c.Timer.Cron, c.dstPolicy()
 	*c = *cmd
 	c.schEntryID = entryID
 
-	// 节点执行时间改变，更新 cron
+	// 节点执行时间或夏令时策略改变，更新 cron
 	// 否则不用更新 cron
-	if c.Timer.Cron != sch {
+	if c.Timer.Cron != sch || c.dstPolicy() != dst {
 		w.Cron.Remove(entryID)
-		c.schEntryID = w.Cron.Schedule(c.Timer.Schedule, c)
+		c.schEntryID = w.Cron.Schedule(c.schedule(), c)
 	}
 
-	w.logger.Infof("job[%s]rule[%s] timer[%s] has updated", c.Job.ID, c.Timer.ID, c.Timer.Cron)
+	w.logger.Info("timer updated", fieldJob(c.Job.ID), xlog.String("timer_id", c.Timer.ID), xlog.String("timer", c.Timer.Cron))
 }
 
 func (w *worker) addCmd(cmd *Cmd) {
-	cmd.schEntryID = w.Cron.Schedule(cmd.Timer.Schedule, cmd)
+	cmd.schEntryID = w.Cron.Schedule(cmd.schedule(), cmd)
 	w.cmds[cmd.GetID()] = cmd
+	cronEntriesGauge.Set(float64(len(w.cmds)))
 
-	w.logger.Infof("job[%s] rule[%s] timer[%s] has added",
-		cmd.Job.ID, cmd.Timer.ID, cmd.Timer.Cron)
+	w.logger.Info("timer added", fieldJob(cmd.Job.ID), xlog.String("timer_id", cmd.Timer.ID), xlog.String("timer", cmd.Timer.Cron))
 	return
 }
 
-func (w *worker) GetJobContentFromKv(key []byte, value []byte) (*Job, error) {
-	job := &Job{}
-
-	if err := json.Unmarshal(value, job); err != nil {
-		w.logger.Warnf("job[%s] unmarshal err: %s", key, err.Error())
+func (w *worker) GetJobContentFromKv(key string, value []byte) (*Job, error) {
+	job, err := ParseJob(value)
+	if err == nil {
+		err = w.validIntervals(job)
+	}
+	if err == nil && w.StrictJobs {
+		err = checkUnknownFields(value)
+	}
+	if err != nil {
+		w.logger.Warn("job is invalid", fieldJob(GetIDFromKey(key)), xlog.FieldErr(err))
+		w.reportJobError(key, value, err)
 		return nil, err
 	}
-	if err := job.ValidRules(); err != nil {
-		w.logger.Warnf("valid rules [%s] err: %s", key, err.Error())
+	if err := w.authorize("job", value, job); err != nil {
+		w.logger.Warn("job is refused", fieldJob(GetIDFromKey(key)), xlog.FieldErr(err))
+		w.reportJobError(key, value, err)
 		return nil, err
 	}
+	// 错误按 key 中的 id 写入，json 中的 id 可能与 key 不同
+	w.clearJobError(GetIDFromKey(key))
 
 	return job, nil
 }
 
-func (w *worker) GetOnceJobFromKv(key []byte, value []byte) (*OnceJob, error) {
-	job := &OnceJob{}
-
-	if err := json.Unmarshal(value, job); err != nil {
-		w.logger.Warnf("job[%s] unmarshal err: %s", key, err.Error())
+func (w *worker) GetOnceJobFromKv(key string, value []byte) (*OnceJob, error) {
+	job, err := ParseOnceJob(value)
+	if err != nil {
+		w.logger.Warn("once job is invalid", xlog.FieldKey(key), xlog.FieldErr(err))
 		return nil, err
 	}
-	if err := job.ValidRules(); err != nil {
-		w.logger.Warnf("valid rules [%s] err: %s", key, err.Error())
+	// 节点写回确认后的 key 不会再执行，其中的 nonce 已经使用过
+	if job.Ack != nil {
+		return job, nil
+	}
+	// 只带 Params 的临时任务同样需要签名，Params 会渲染进已定义任务的命令
+	if err := w.authorizeOnce(value, job); err != nil {
+		w.logger.Warn("once job is refused", fieldJob(job.ID), xlog.FieldKey(key), xlog.FieldErr(err))
 		return nil, err
 	}
 
@@ -385,47 +622,46 @@ func (w *worker) GetOnceJobFromKv(key []byte, value []byte) (*OnceJob, error) {
 func (w *worker) KillExecutingProc(process *Process) {
 	pid, _ := strconv.Atoi(process.ID)
 	if err := killProcess(pid); err != nil {
-		w.logger.Warnf("process:[%d] force kill failed, error:[%s]", pid, err)
+		w.logger.Warn("force kill process failed", fieldJob(process.JobID), fieldTask(process.TaskID), xlog.Int("pid", pid), xlog.FieldErr(err))
 		return
 	}
 }
 
 func (w *worker) watchLocks() {
-	wch := w.Client.Watch(context.Background(), LockKeyPrefix, clientv3.WithPrefix())
-
-	for ev := range wch {
-		for _, ev := range ev.Events {
-			switch {
-			case ev.Type == clientv3.EventTypeDelete:
-				// watch deleted job and try to lock that job
-				jobId := getJobIDFromLockKey(string(ev.Kv.Key))
-				w.tryGetJob(jobId)
-			}
+	_, events := w.watchPrefix(LockKeyPrefix)
+
+	for event := range events {
+		switch {
+		case event.Type == StoreDelete:
+			// watch deleted job and try to lock that job
+			jobId := getJobIDFromLockKey(event.Key)
+			w.syncMutex.Lock()
+			w.tryGetJob(jobId)
+			w.syncMutex.Unlock()
 		}
 	}
 }
 
 func (w *worker) tryGetJob(jobId string) {
-	resp, err := w.Client.Get(context.Background(), JobsKeyPrefix+jobId)
+	job, err := w.loadJob(jobId)
 	if err != nil {
 		return
 	}
-	if len(resp.Kvs) == 0 {
-		return
-	}
 
-	jobKv := resp.Kvs[0]
-	job, err := w.GetJobContentFromKv(jobKv.Key, jobKv.Value)
-	if err != nil {
-		return
-	}
-
-	if _, ok := w.jobs[job.ID]; !ok {
+	if _, ok := w.getJob(job.ID); !ok {
 		w.addJob(job)
 	}
 }
 
+func (w *worker) getJob(id string) (*Job, bool) {
+	w.jobsMutex.RLock()
+	defer w.jobsMutex.RUnlock()
+
+	job, ok := w.jobs[id]
+	return job, ok
+}
+
 func getJobIDFromLockKey(key string) (jobId string) {
-	key = strings.TrimLeft(key, LockKeyPrefix)
+	key = strings.TrimPrefix(key, LockKeyPrefix)
 	return strings.Split(key, "/")[0]
 }
@@ -0,0 +1,57 @@
+package job
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newReplayWorker 创建回放空录制文件的 worker，不连接任务存储，options 在 Build 前修改配置，
+// 测试结束后删除录制文件所在的临时目录
+func newReplayWorker(t *testing.T, options ...func(*Config)) *worker {
+	dir, err := ioutil.TempDir("", "worker")
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+	path := filepath.Join(dir, "events.jsonl")
+	assert.Nil(t, ioutil.WriteFile(path, nil, 0644))
+
+	config := DefaultConfig()
+	config.HostName = "node-1"
+	config.AppIP = "127.0.0.1"
+	config.Replay.ReplayFile = path
+	for _, option := range options {
+		option(config)
+	}
+	w := config.Build()
+	w.jobs = make(Jobs)
+	return w
+}
+
+func TestModJobDisabledTimer(t *testing.T) {
+	w := newReplayWorker(t)
+
+	newJob := func(disabled bool) *Job {
+		return &Job{ID: "a", Enable: true, Nodes: []string{"node-1"}, Timers: []*Timer{
+			{ID: "hourly", Cron: "@hourly"},
+			{ID: "daily", Cron: "@daily", Disabled: disabled},
+		}}
+	}
+	w.addJob(newJob(false))
+	assert.Len(t, w.cmds, 2)
+	entryID := w.cmds["a-hourly"].schEntryID
+
+	// 停用一个定时规则，另一个的 cron 条目保持不变
+	w.modJob(newJob(true))
+	assert.Len(t, w.cmds, 1)
+	assert.Equal(t, entryID, w.cmds["a-hourly"].schEntryID)
+	assert.Len(t, w.Cron.Entries(), 1)
+
+	w.modJob(newJob(false))
+	assert.Contains(t, w.cmds, "a-daily")
+	assert.Len(t, w.Cron.Entries(), 2)
+}
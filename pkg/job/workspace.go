@@ -0,0 +1,179 @@
+package job
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// EnvJobWorkspace 本次执行的工作区
+const EnvJobWorkspace = "JOB_WORKSPACE"
+
+// WorkspaceConfig 每次执行独立的工作区，同一任务并发执行时临时文件互不影响
+type WorkspaceConfig struct {
+	Dir        string        // 工作区所在目录，每次执行的工作区为 {Dir}/{taskId}-{随机后缀}，权限为 0700
+	AllJobs    bool          // 任务未设置 workspace 时是否创建
+	KeepFailed bool          // 保留失败执行的工作区用于排查，由定期清理删除
+	MaxAge     time.Duration // 保留的工作区超过该时间后删除
+	MaxSize    int64         // 保留的工作区总大小上限，超出时从最早的开始删除，为 0 时不限制
+	Interval   time.Duration // 清理间隔
+}
+
+func (c *WorkspaceConfig) normalize() {
+	if c.Dir == "" {
+		c.Dir = "/tmp/juno-agent/workspaces"
+	}
+	if c.MaxAge <= 0 {
+		c.MaxAge = 72 * time.Hour
+	}
+	if c.Interval < time.Minute {
+		c.Interval = time.Minute
+	}
+}
+
+// useWorkspace 声明 artifacts 的任务总是在工作区中执行
+func (j *Job) useWorkspace() bool {
+	if len(j.Artifacts) > 0 {
+		return true
+	}
+	if j.Workspace != nil {
+		return *j.Workspace
+	}
+	return j.Workspaces.AllJobs
+}
+
+// prepareWorkspace 创建本次执行的工作区并下载 artifacts，
+// 返回的 cleanup 删除工作区，开启 keepFailed 时失败的执行保留
+func (j *Job) prepareWorkspace(ctx context.Context, taskID uint64) (string, func(failed bool), error) {
+	if !j.useWorkspace() {
+		return "", func(bool) {}, nil
+	}
+	if err := privateDir(j.Workspaces.Dir); err != nil {
+		return "", nil, err
+	}
+	// 随机后缀保证每次执行新建目录，task id 相同或目录被预先创建时不会共用
+	dir, err := ioutil.TempDir(j.Workspaces.Dir, strconv.FormatUint(taskID, 10)+"-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func(failed bool) {
+		if failed && j.Workspaces.KeepFailed {
+			j.logger.Info("keep workspace of failed task", fieldJob(j.ID), fieldTask(taskID), xlog.String("dir", dir))
+			return
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			j.logger.Warn("remove workspace failed", fieldJob(j.ID), xlog.String("dir", dir), xlog.FieldErr(err))
+		}
+	}
+
+	if err := j.fetchArtifacts(ctx, dir); err != nil {
+		cleanup(false)
+		return "", nil, err
+	}
+	return dir, cleanup, nil
+}
+
+// workspaceEnv 临时文件同样写入工作区
+func workspaceEnv(dir string) []string {
+	return []string{EnvJobWorkspace + "=" + dir, "TMPDIR=" + dir, "TMP=" + dir, "TEMP=" + dir}
+}
+
+// gcWorkspaces 定期删除保留的及 agent 异常退出遗留的工作区，worker 停止后退出
+func (w *worker) gcWorkspaces() {
+	for {
+		select {
+		case <-time.After(w.Workspaces.Interval):
+		case <-w.done:
+			return
+		}
+
+		if err := w.gcWorkspaceDir(); err != nil {
+			w.logger.Warn("gc workspaces failed", xlog.FieldErr(err), xlog.String("dir", w.Workspaces.Dir))
+		}
+	}
+}
+
+func (w *worker) gcWorkspaceDir() error {
+	entries, err := ioutil.ReadDir(w.Workspaces.Dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	running := make(map[string]bool)
+	w.runsMutex.Lock()
+	for _, tasks := range w.runningJobs {
+		for taskID := range tasks {
+			running[strconv.FormatUint(taskID, 10)] = true
+		}
+	}
+	w.runsMutex.Unlock()
+
+	type workspace struct {
+		path    string
+		modTime time.Time
+		size    int64
+	}
+	var (
+		kept  []workspace
+		total int64
+	)
+	deleted := 0
+	for _, entry := range entries {
+		if !entry.IsDir() || running[workspaceTaskID(entry.Name())] {
+			continue
+		}
+		path := filepath.Join(w.Workspaces.Dir, entry.Name())
+		if time.Since(entry.ModTime()) > w.Workspaces.MaxAge {
+			if err := os.RemoveAll(path); err == nil {
+				deleted++
+			}
+			continue
+		}
+		size := dirSize(path)
+		kept = append(kept, workspace{path: path, modTime: entry.ModTime(), size: size})
+		total += size
+	}
+
+	if w.Workspaces.MaxSize > 0 && total > w.Workspaces.MaxSize {
+		sort.Slice(kept, func(i, j int) bool { return kept[i].modTime.Before(kept[j].modTime) })
+		for _, ws := range kept {
+			if total <= w.Workspaces.MaxSize {
+				break
+			}
+			if err := os.RemoveAll(ws.path); err == nil {
+				total -= ws.size
+				deleted++
+			}
+		}
+	}
+	gcReclaimedCounter.Add(float64(deleted), "workspace")
+	return nil
+}
+
+// workspaceTaskID 工作区目录名中的 task id
+func workspaceTaskID(name string) string {
+	if i := strings.IndexByte(name, '-'); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	_ = filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
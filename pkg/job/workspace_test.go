@@ -0,0 +1,70 @@
+package job
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkspace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workspaces")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.Workspaces.Dir = dir
+	config.Workspaces.KeepFailed = true
+	config.Workspaces.MaxSize = 10
+	w := &worker{Config: config, runningJobs: map[string]map[uint64]context.CancelFunc{"busy": {3: nil}}}
+
+	enable := true
+	job := &Job{ID: "report", worker: w}
+	workspace, _, err := job.prepareWorkspace(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Empty(t, workspace)
+
+	// 失败的执行保留工作区
+	job.Workspace = &enable
+	workspace, cleanup, err := job.prepareWorkspace(context.Background(), 1)
+	assert.NoError(t, err)
+	stat, err := os.Stat(workspace)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), stat.Mode().Perm())
+	// 同一 task id 再次执行时使用新的目录
+	other, cleanupOther, err := job.prepareWorkspace(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.NotEqual(t, workspace, other)
+	cleanupOther(false)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workspace, "out.tmp"), []byte("0123456789"), 0644))
+	cleanup(true)
+	assert.DirExists(t, workspace)
+	failed := workspace
+
+	workspace, cleanup, err = job.prepareWorkspace(context.Background(), 2)
+	assert.NoError(t, err)
+	cleanup(false)
+	_, err = os.Stat(workspace)
+	assert.True(t, os.IsNotExist(err))
+
+	// 过期的工作区删除，超出总大小时从最早的开始删除，执行中的不删除
+	for _, name := range []string{"2-a", "3-b", "4-c"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, name), 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name, "out.tmp"), []byte("0123456789"), 0644))
+	}
+	old := time.Now().Add(-100 * time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "2-a"), old, old))
+	assert.NoError(t, os.Chtimes(failed, old.Add(90*time.Hour), old.Add(90*time.Hour)))
+
+	assert.NoError(t, w.gcWorkspaceDir())
+	names := []string{}
+	entries, _ := ioutil.ReadDir(dir)
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"3-b", "4-c"}, names)
+}
@@ -0,0 +1,275 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyring
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnvelopePrefix marks values encrypted by a Keyring
+const EnvelopePrefix = "jk1:"
+
+var ErrNotEnvelope = errors.New("value is not an encrypted envelope")
+
+// KeyInfo describes a data key version without key material
+type KeyInfo struct {
+	Tenant    string    `json:"tenant"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Current   bool      `json:"current"`
+}
+
+// dataKey a version of tenant data key, Wrapped is persisted and Key only lives in memory
+type dataKey struct {
+	Version   int       `json:"version"`
+	Wrapped   []byte    `json:"wrapped"`
+	CreatedAt time.Time `json:"created_at"`
+
+	key []byte
+}
+
+// envelope is carried by every encrypted value, the wrapped data key is included
+// so that the value can be decrypted by any holder of the master key
+type envelope struct {
+	Tenant  string `json:"t"`
+	Version int    `json:"v"`
+	Key     []byte `json:"k"`
+	Data    []byte `json:"d"`
+}
+
+// Keyring keeps a data key per tenant, each wrapped by the master key.
+// the last version of a tenant is used for encryption, older versions are kept for decryption
+type Keyring struct {
+	path   string
+	master MasterKey
+
+	mu      sync.RWMutex
+	tenants map[string][]*dataKey
+}
+
+// New load keyring from path, an empty keyring is created if the file does not exist
+func New(path string, master MasterKey) (*Keyring, error) {
+	k := &Keyring{
+		path:    path,
+		master:  master,
+		tenants: make(map[string][]*dataKey),
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &k.tenants); err != nil {
+		return nil, fmt.Errorf("parse keyring %s: %s", path, err)
+	}
+	for tenant, keys := range k.tenants {
+		for _, dk := range keys {
+			if dk.key, err = master.Unwrap(dk.Wrapped, keyAAD(tenant, dk.Version)); err != nil {
+				return nil, fmt.Errorf("unwrap key of tenant[%s] version[%d]: %s", tenant, dk.Version, err)
+			}
+		}
+	}
+	return k, nil
+}
+
+// Encrypt encrypts plain with the current key of tenant, a key is created for a new tenant
+func (k *Keyring) Encrypt(tenant string, plain []byte) (string, error) {
+	dk, err := k.current(tenant)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newGCM(dk.key)
+	if err != nil {
+		return "", err
+	}
+	data, err := seal(aead, plain, []byte(tenant))
+	if err != nil {
+		return "", err
+	}
+
+	content, _ := json.Marshal(envelope{Tenant: tenant, Version: dk.Version, Key: dk.Wrapped, Data: data})
+	return EnvelopePrefix + base64.RawURLEncoding.EncodeToString(content), nil
+}
+
+// Decrypt decrypts a value returned by Encrypt, and returns the tenant it belongs to
+func (k *Keyring) Decrypt(value string) ([]byte, string, error) {
+	if !IsEnvelope(value) {
+		return nil, "", ErrNotEnvelope
+	}
+	content, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(value, EnvelopePrefix))
+	if err != nil {
+		return nil, "", err
+	}
+	var env envelope
+	if err := json.Unmarshal(content, &env); err != nil {
+		return nil, "", err
+	}
+
+	key := k.lookup(env.Tenant, env.Version)
+	if key == nil {
+		// encrypted on another node, unwrap the key carried by the envelope
+		if key, err = k.master.Unwrap(env.Key, keyAAD(env.Tenant, env.Version)); err != nil {
+			return nil, "", err
+		}
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, "", err
+	}
+	plain, err := open(aead, env.Data, []byte(env.Tenant))
+	if err != nil {
+		return nil, "", err
+	}
+	return plain, env.Tenant, nil
+}
+
+// Rotate creates a new version of data key for tenant, it is used for encryption since then
+func (k *Keyring) Rotate(tenant string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	dk, err := k.addKey(tenant)
+	if err != nil {
+		return 0, err
+	}
+	return dk.Version, nil
+}
+
+// Keys lists key versions of all tenants
+func (k *Keyring) Keys() []KeyInfo {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	infos := make([]KeyInfo, 0)
+	for tenant, keys := range k.tenants {
+		for i, dk := range keys {
+			infos = append(infos, KeyInfo{
+				Tenant:    tenant,
+				Version:   dk.Version,
+				CreatedAt: dk.CreatedAt,
+				Current:   i == len(keys)-1,
+			})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Tenant != infos[j].Tenant {
+			return infos[i].Tenant < infos[j].Tenant
+		}
+		return infos[i].Version < infos[j].Version
+	})
+	return infos
+}
+
+// IsEnvelope reports whether value is encrypted by a Keyring
+func IsEnvelope(value string) bool {
+	return strings.HasPrefix(value, EnvelopePrefix)
+}
+
+func (k *Keyring) current(tenant string) (*dataKey, error) {
+	k.mu.RLock()
+	keys := k.tenants[tenant]
+	k.mu.RUnlock()
+	if len(keys) > 0 {
+		return keys[len(keys)-1], nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// created by another goroutine while waiting for the lock
+	if keys := k.tenants[tenant]; len(keys) > 0 {
+		return keys[len(keys)-1], nil
+	}
+	return k.addKey(tenant)
+}
+
+func (k *Keyring) lookup(tenant string, version int) []byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, dk := range k.tenants[tenant] {
+		if dk.Version == version {
+			return dk.key
+		}
+	}
+	return nil
+}
+
+// addKey must be called with k.mu held
+func (k *Keyring) addKey(tenant string) (*dataKey, error) {
+	if tenant == "" {
+		return nil, errors.New("tenant is required")
+	}
+
+	version := 1
+	if keys := k.tenants[tenant]; len(keys) > 0 {
+		version = keys[len(keys)-1].Version + 1
+	}
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	wrapped, err := k.master.Wrap(key, keyAAD(tenant, version))
+	if err != nil {
+		return nil, err
+	}
+
+	dk := &dataKey{Version: version, Wrapped: wrapped, CreatedAt: time.Now(), key: key}
+	k.tenants[tenant] = append(k.tenants[tenant], dk)
+	if err := k.save(); err != nil {
+		k.tenants[tenant] = k.tenants[tenant][:len(k.tenants[tenant])-1]
+		return nil, err
+	}
+	return dk, nil
+}
+
+// save writes keyring to a temp file then renames it, so the file is never half written
+func (k *Keyring) save() error {
+	content, err := json.MarshalIndent(k.tenants, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(k.path), 0700); err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.path)
+}
+
+// keyAAD binds a wrapped key to its tenant and version
+func keyAAD(tenant string, version int) []byte {
+	return []byte(fmt.Sprintf("%s/%d", tenant, version))
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyring
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyring(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyring")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	master, err := NewLocalMaster([]byte("12341234123412341234123412341234"))
+	assert.Nil(t, err)
+	path := filepath.Join(dir, "keyring.json")
+	ring, err := New(path, master)
+	assert.Nil(t, err)
+
+	v1, err := ring.Encrypt("app-a", []byte("result of a"))
+	assert.Nil(t, err)
+	assert.True(t, IsEnvelope(v1))
+
+	t.Run("rotate keeps old versions", func(t *testing.T) {
+		version, err := ring.Rotate("app-a")
+		assert.Nil(t, err)
+		assert.Equal(t, 2, version)
+
+		v2, err := ring.Encrypt("app-a", []byte("result of a"))
+		assert.Nil(t, err)
+		assert.NotEqual(t, v1, v2)
+
+		for _, v := range []string{v1, v2} {
+			plain, tenant, err := ring.Decrypt(v)
+			assert.Nil(t, err)
+			assert.Equal(t, "app-a", tenant)
+			assert.Equal(t, "result of a", string(plain))
+		}
+	})
+
+	t.Run("tenants have separate keys", func(t *testing.T) {
+		_, err := ring.Encrypt("app-b", []byte("result of b"))
+		assert.Nil(t, err)
+
+		keys := ring.Keys()
+		assert.Len(t, keys, 3)
+		assert.Equal(t, KeyInfo{Tenant: "app-a", Version: 2, CreatedAt: keys[1].CreatedAt, Current: true}, keys[1])
+		assert.Equal(t, "app-b", keys[2].Tenant)
+	})
+
+	t.Run("reload and decrypt on another node", func(t *testing.T) {
+		reloaded, err := New(path, master)
+		assert.Nil(t, err)
+		assert.Len(t, reloaded.Keys(), 3)
+
+		other, err := New(filepath.Join(dir, "other.json"), master)
+		assert.Nil(t, err)
+		plain, _, err := other.Decrypt(v1)
+		assert.Nil(t, err)
+		assert.Equal(t, "result of a", string(plain))
+	})
+
+	t.Run("wrong master key", func(t *testing.T) {
+		wrong, _ := NewLocalMaster([]byte("43214321432143214321432143214321"))
+		_, err := New(path, wrong)
+		assert.NotNil(t, err)
+
+		other, _ := New(filepath.Join(dir, "wrong.json"), wrong)
+		_, _, err = other.Decrypt(v1)
+		assert.NotNil(t, err)
+	})
+
+	_, _, err = ring.Decrypt("plain text")
+	assert.Equal(t, ErrNotEnvelope, err)
+}
+
+func TestVaultTransit(t *testing.T) {
+	// fake transit engine, ciphertext carries associated_data and plaintext in base64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token", r.Header.Get("X-Vault-Token"))
+		var params map[string]string
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&params))
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/agent":
+			fmt.Fprintf(w, `{"data":{"ciphertext":"vault:v1:%s.%s"}}`, params["associated_data"], params["plaintext"])
+		case "/v1/transit/decrypt/agent":
+			parts := strings.SplitN(strings.TrimPrefix(params["ciphertext"], "vault:v1:"), ".", 2)
+			if parts[0] != params["associated_data"] {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(w, `{"data":{"plaintext":"%s"}}`, parts[1])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "keyring")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.Enable = true
+	config.Path = filepath.Join(dir, "keyring.json")
+	config.KMS.Backend = KMSVault
+	config.KMS.Addr = server.URL
+	config.KMS.Token = "token"
+	config.KMS.Key = "agent"
+	ring, err := config.Build()
+	assert.Nil(t, err)
+
+	value, err := ring.Encrypt("app-a", []byte("password = 123"))
+	assert.Nil(t, err)
+	other, err := config.Build()
+	assert.Nil(t, err)
+	plain, _, err := other.Decrypt(value)
+	assert.Nil(t, err)
+	assert.Equal(t, "password = 123", string(plain))
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyring
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// KMSVault wraps data keys with the transit engine of HashiCorp Vault
+const KMSVault = "vault"
+
+// KMSConfig remote KMS holding the master key, the key never leaves the KMS
+type KMSConfig struct {
+	Backend string        `json:"backend"` // vault, empty to use the local master key
+	Addr    string        `json:"addr"`    // e.g. https://vault.example.com:8200
+	Token   string        `json:"token"`   // token allowed to encrypt and decrypt with Key
+	Mount   string        `json:"mount"`   // path the transit engine is mounted at
+	Key     string        `json:"key"`     // name of the transit key
+	Timeout time.Duration `json:"timeout"`
+}
+
+// vaultTransit sends data keys to vault for wrapping, aad is passed as associated_data
+type vaultTransit struct {
+	config *KMSConfig
+	client *http.Client
+}
+
+// NewVaultTransit returns a MasterKey backed by a vault transit key
+func NewVaultTransit(config *KMSConfig) (MasterKey, error) {
+	if config.Addr == "" || config.Key == "" {
+		return nil, errors.New("vault addr and transit key are required")
+	}
+	return &vaultTransit{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+func (v *vaultTransit) Wrap(key, aad []byte) ([]byte, error) {
+	var data struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	err := v.call("encrypt", map[string]string{
+		"plaintext":       base64.StdEncoding.EncodeToString(key),
+		"associated_data": base64.StdEncoding.EncodeToString(aad),
+	}, &data)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(data.Ciphertext), nil
+}
+
+func (v *vaultTransit) Unwrap(wrapped, aad []byte) ([]byte, error) {
+	var data struct {
+		Plaintext string `json:"plaintext"`
+	}
+	err := v.call("decrypt", map[string]string{
+		"ciphertext":      string(wrapped),
+		"associated_data": base64.StdEncoding.EncodeToString(aad),
+	}, &data)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(data.Plaintext)
+}
+
+// call posts to <mount>/<op>/<key> and decodes the data field of the response
+func (v *vaultTransit) call(op string, params map[string]string, data interface{}) error {
+	body, _ := json.Marshal(params)
+	url := fmt.Sprintf("%s/v1/%s/%s/%s", strings.TrimRight(v.config.Addr, "/"), strings.Trim(v.config.Mount, "/"), op, v.config.Key)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.config.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return fmt.Errorf("vault transit %s responded %s", op, resp.Status)
+	}
+
+	var result struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	return json.Unmarshal(result.Data, data)
+}
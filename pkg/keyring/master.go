@@ -0,0 +1,81 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MasterKey wraps data keys, it may be backed by a local key or a remote KMS
+type MasterKey interface {
+	// Wrap encrypts a data key, aad is authenticated but not encrypted
+	Wrap(key, aad []byte) ([]byte, error)
+	// Unwrap decrypts a data key wrapped by Wrap
+	Unwrap(wrapped, aad []byte) ([]byte, error)
+}
+
+// localMaster wraps keys with AES-256-GCM under a key from agent config
+type localMaster struct {
+	aead cipher.AEAD
+}
+
+// NewLocalMaster returns a MasterKey using a 32 bytes key
+func NewLocalMaster(key []byte) (MasterKey, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key requires 32 bytes, got %d", len(key))
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &localMaster{aead: aead}, nil
+}
+
+func (m *localMaster) Wrap(key, aad []byte) ([]byte, error) {
+	return seal(m.aead, key, aad)
+}
+
+func (m *localMaster) Unwrap(wrapped, aad []byte) ([]byte, error) {
+	return open(m.aead, wrapped, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns nonce followed by ciphertext
+func seal(aead cipher.AEAD, plain, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, aad), nil
+}
+
+func open(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+}
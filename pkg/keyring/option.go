@@ -0,0 +1,81 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyring
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config keyring config
+type Config struct {
+	Enable    bool      `json:"enable"`
+	Path      string    `json:"path"`       // file which wrapped data keys are stored in
+	MasterKey string    `json:"master_key"` // 32 bytes key wrapping data keys, api.secret is used if empty
+	KMS       KMSConfig `json:"kms"`        // wrap data keys with a remote KMS instead of MasterKey
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadKeyringConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	if config.MasterKey == "" {
+		config.MasterKey = conf.GetString("api.secret")
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable: false,
+		Path:   "/tmp/juno-agent/keyring.json",
+		KMS: KMSConfig{
+			Mount:   "transit",
+			Timeout: 5 * time.Second,
+		},
+	}
+}
+
+// Build new a instance, nil is returned if keyring is disabled
+func (c *Config) Build() (*Keyring, error) {
+	if !c.Enable {
+		return nil, nil
+	}
+
+	var (
+		master MasterKey
+		err    error
+	)
+	switch c.KMS.Backend {
+	case "":
+		master, err = NewLocalMaster([]byte(c.MasterKey))
+	case KMSVault:
+		master, err = NewVaultTransit(&c.KMS)
+	default:
+		err = fmt.Errorf("unknown kms backend: %s", c.KMS.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	xlog.Info("plugin", xlog.String("keyring", "start"), xlog.String("kms", c.KMS.Backend))
+	return New(c.Path, master)
+}
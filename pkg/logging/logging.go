@@ -0,0 +1,147 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging keeps a logger per agent module so the level of one module,
+// e.g. the job watcher, can be raised at runtime without drowning in logs of the others.
+package logging
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/xlog"
+	"go.uber.org/zap/zapcore"
+)
+
+type module struct {
+	logger *xlog.Logger
+	config string        // name of the logger under [jupiter.logger]
+	level  zapcore.Level // current level, may be changed through SetLevel
+	// level read from the config, Reload only touches modules whose configured level changed
+	configured zapcore.Level
+}
+
+var (
+	mu      sync.RWMutex
+	modules = make(map[string]*module)
+)
+
+// Logger returns the logger of module. A module configured under [jupiter.logger.<name>]
+// gets its own logger built on first use, other modules share xlog.DefaultLogger and its level.
+func Logger(name string) *xlog.Logger {
+	mu.RLock()
+	m, ok := modules[name]
+	mu.RUnlock()
+	if ok {
+		return m.logger
+	}
+
+	key := "jupiter.logger." + name
+	if conf.Get(key) == nil {
+		return xlog.DefaultLogger
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if m, ok := modules[name]; ok {
+		return m.logger
+	}
+	m = newModule(xlog.StdConfig(name).Build(), name)
+	modules[name] = m
+	return m.logger
+}
+
+// Register a logger built by the module itself from [jupiter.logger.<config>],
+// e.g. the job worker writes to [jupiter.logger.cronjob]
+func Register(name string, logger *xlog.Logger, config string) *xlog.Logger {
+	mu.Lock()
+	defer mu.Unlock()
+	modules[name] = newModule(logger, config)
+	return logger
+}
+
+func newModule(logger *xlog.Logger, config string) *module {
+	m := &module{logger: logger, config: config}
+	m.configured = configuredLevel(config)
+	m.level = m.configured
+	return m
+}
+
+// configuredLevel an empty or unknown level is info, the same as xlog
+func configuredLevel(config string) zapcore.Level {
+	var lv zapcore.Level
+	if err := lv.UnmarshalText([]byte(conf.GetString("jupiter.logger." + config + ".level"))); err != nil {
+		return zapcore.InfoLevel
+	}
+	return lv
+}
+
+// Reload re-reads the configured level of every module after the agent config is reloaded.
+// A level set through SetLevel is kept unless the configured level of that module changed.
+func Reload() []Status {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var changed []Status
+	for name, m := range modules {
+		lv := configuredLevel(m.config)
+		if lv == m.configured {
+			continue
+		}
+		m.configured = lv
+		m.logger.SetLevel(lv)
+		m.level = lv
+		changed = append(changed, Status{Module: name, Level: lv.String()})
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Module < changed[j].Module })
+	return changed
+}
+
+// SetLevel change the level of module at runtime, e.g. SetLevel("job", "debug")
+func SetLevel(name, level string) error {
+	var lv zapcore.Level
+	if err := lv.UnmarshalText([]byte(level)); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	m, ok := modules[name]
+	if !ok {
+		return fmt.Errorf("module %s shares the default logger, configure [jupiter.logger.%s] to set its level", name, name)
+	}
+	m.logger.SetLevel(lv)
+	m.level = lv
+	return nil
+}
+
+// Status the level of a module
+type Status struct {
+	Module string `json:"module"`
+	Level  string `json:"level"`
+}
+
+// Levels returns the level of every module that has a logger of its own
+func Levels() []Status {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	levels := make([]Status, 0, len(modules))
+	for name, m := range modules {
+		levels = append(levels, Status{Module: name, Level: m.level.String()})
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Module < levels[j].Module })
+	return levels
+}
@@ -0,0 +1,39 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"testing"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetLevel(t *testing.T) {
+	// the level of a logger without config is info
+	Register("job", xlog.DefaultLogger, "cronjob")
+	assert.Equal(t, []Status{{Module: "job", Level: "info"}}, Levels())
+
+	assert.NoError(t, SetLevel("job", "warn"))
+	assert.Equal(t, "warn", Levels()[0].Level)
+	assert.Error(t, SetLevel("job", "loud"))
+	// modules without a logger of their own share the default logger
+	assert.Error(t, SetLevel("proxy", "debug"))
+	assert.Equal(t, xlog.DefaultLogger, Logger("proxy"))
+
+	// the level set at runtime is kept while the configured level stays the same
+	assert.Empty(t, Reload())
+	assert.Equal(t, "warn", Levels()[0].Level)
+}
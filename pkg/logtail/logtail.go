@@ -0,0 +1,203 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logtail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/file"
+)
+
+var (
+	// ErrDisabled log tail is not enabled in config
+	ErrDisabled = errors.New("log tail is not enabled")
+	// ErrNotAllowed the file is outside the configured dirs
+	ErrNotAllowed = errors.New("file is not under the allowed log dirs")
+	// ErrRateLimited too many requests in the last minute
+	ErrRateLimited = errors.New("too many log tail requests, try again later")
+)
+
+// Request lines to read from the end of a file
+type Request struct {
+	Path  string
+	Lines int    // MaxLines when zero or larger
+	Grep  string // regular expression, only matching lines are returned
+	// rate limited separately, the peer address of the request
+	Client string
+}
+
+// Result the last lines of a file, oldest first
+type Result struct {
+	Path  string   `json:"path"` // symlinks resolved
+	Size  int64    `json:"size"`
+	Lines []string `json:"lines"`
+	// the file is larger than MaxBytes and only its end was searched
+	Truncated bool `json:"truncated"`
+}
+
+// Tailer reads the end of log files under the allowed dirs
+type Tailer struct {
+	config  *Config
+	limiter *limiter
+}
+
+// Tail return the last matching lines of a file
+func (t *Tailer) Tail(req Request) (*Result, error) {
+	if !t.config.Enable {
+		return nil, ErrDisabled
+	}
+	if !t.limiter.allow(req.Client, time.Now()) {
+		return nil, ErrRateLimited
+	}
+	if req.Lines <= 0 || req.Lines > t.config.MaxLines {
+		req.Lines = t.config.MaxLines
+	}
+	var grep *regexp.Regexp
+	if req.Grep != "" {
+		if len(req.Grep) > t.config.MaxPattern {
+			return nil, fmt.Errorf("grep should not be longer than %d", t.config.MaxPattern)
+		}
+		var err error
+		if grep, err = regexp.Compile(req.Grep); err != nil {
+			return nil, err
+		}
+	}
+	if req.Path == "" || !filepath.IsAbs(req.Path) {
+		return nil, errors.New("path should be absolute")
+	}
+	// the path of the opened file is checked again, a dir replaced with a symlink can not lead out of dirs
+	f, err := file.OpenBeneath(t.config.Dirs, req.Path)
+	if err == file.ErrNotAllowed {
+		return nil, ErrNotAllowed
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	path := f.Name()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, errors.New("not a regular file")
+	}
+
+	result := &Result{Path: path, Size: info.Size(), Lines: make([]string, 0)}
+	offset := info.Size() - t.config.MaxBytes
+	if offset < 0 {
+		offset = 0
+	}
+	// the file may grow while reading, never read more than MaxBytes
+	data := make([]byte, info.Size()-offset)
+	n, err := f.ReadAt(data, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	data = data[:n]
+	if offset > 0 {
+		result.Truncated = true
+		// drop the partial first line
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		} else {
+			data = nil
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	for i := len(lines) - 1; i >= 0 && len(result.Lines) < req.Lines; i-- {
+		if len(data) == 0 || grep != nil && !grep.MatchString(lines[i]) {
+			continue
+		}
+		result.Lines = append(result.Lines, lines[i])
+	}
+	for i, j := 0, len(result.Lines)-1; i < j; i, j = i+1, j-1 {
+		result.Lines[i], result.Lines[j] = result.Lines[j], result.Lines[i]
+	}
+	return result, nil
+}
+
+// resolve the real path of file, which must lie under one of the allowed dirs
+// limiter a token bucket for each client, so that one client can not use up the rate of others
+type limiter struct {
+	mu       sync.Mutex
+	capacity float64
+	rate     float64 // tokens added per second
+	buckets  map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// most clients tracked, full buckets are dropped when exceeded
+const maxClients = 1024
+
+func newLimiter(perMinute int) *limiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &limiter{
+		capacity: float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		buckets:  make(map[string]*bucket),
+	}
+}
+
+func (l *limiter) allow(client string, now time.Time) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxClients {
+			l.prune(now)
+		}
+		b = &bucket{tokens: l.capacity, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.capacity {
+		b.tokens = l.capacity
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prune drop buckets refilled to capacity, they are the same as new ones
+func (l *limiter) prune(now time.Time) {
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.capacity {
+			delete(l.buckets, client)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logtail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTail(t *testing.T) {
+	root, err := ioutil.TempDir("", "logtail")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	logs := filepath.Join(root, "logs")
+	assert.NoError(t, os.MkdirAll(logs, 0755))
+	content := "info 1\nerror 2\ninfo 3\nerror 4\ninfo 5\n"
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(logs, "app.log"), []byte(content), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "secret"), []byte("secret\n"), 0644))
+	assert.NoError(t, os.Symlink(filepath.Join(root, "secret"), filepath.Join(logs, "link.log")))
+
+	config := DefaultConfig()
+	config.Enable = true
+	config.Dirs = []string{logs}
+	config.RatePerMinute = 4
+	tailer := config.Build()
+
+	result, err := tailer.Tail(Request{Path: filepath.Join(logs, "app.log"), Lines: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"error 4", "info 5"}, result.Lines)
+	assert.False(t, result.Truncated)
+
+	result, err = tailer.Tail(Request{Path: filepath.Join(logs, "app.log"), Grep: "^error"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"error 2", "error 4"}, result.Lines)
+
+	// symlinks pointing outside the dirs and relative escapes are refused
+	_, err = tailer.Tail(Request{Path: filepath.Join(logs, "link.log")})
+	assert.Equal(t, ErrNotAllowed, err)
+	_, err = tailer.Tail(Request{Path: filepath.Join(logs, "..", "secret")})
+	assert.Equal(t, ErrNotAllowed, err)
+	_, err = tailer.Tail(Request{Path: filepath.Join(logs, "app.log")})
+	assert.Equal(t, ErrRateLimited, err)
+	// other clients have their own rate
+	_, err = tailer.Tail(Request{Path: filepath.Join(logs, "app.log"), Client: "10.0.0.2"})
+	assert.NoError(t, err)
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(60)
+	now := time.Now()
+	for i := 0; i < 60; i++ {
+		assert.True(t, l.allow("a", now))
+	}
+	assert.False(t, l.allow("a", now))
+	assert.True(t, l.allow("b", now))
+	assert.True(t, l.allow("a", now.Add(time.Second)))
+
+	l.prune(now.Add(2 * time.Minute))
+	assert.Empty(t, l.buckets)
+}
+
+func TestTailMaxBytes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logtail")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(strings.Repeat("x", 20)+"\nlast line\n"), 0644))
+
+	config := DefaultConfig()
+	config.Enable = true
+	config.Dirs = []string{dir}
+	config.MaxBytes = 15
+	result, err := config.Build().Tail(Request{Path: path})
+	assert.NoError(t, err)
+	assert.True(t, result.Truncated)
+	assert.Equal(t, []string{"last line"}, result.Lines)
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logtail
+
+import (
+	"fmt"
+
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config remote log tail config
+type Config struct {
+	Enable        bool     `json:"enable"`
+	Dirs          []string `json:"dirs"`            // only files under these dirs can be read, symlinks are resolved first
+	MaxLines      int      `json:"max_lines"`       // most lines returned by one request
+	MaxBytes      int64    `json:"max_bytes"`       // most bytes read from the end of a file by one request
+	MaxPattern    int      `json:"max_pattern"`     // longest grep pattern accepted
+	RatePerMinute int      `json:"rate_per_minute"` // requests allowed per minute of each client, 0 means no limit
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadLogtailConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable:        false,
+		Dirs:          []string{"/home/www/logs"},
+		MaxLines:      1000,
+		MaxBytes:      4 << 20,
+		MaxPattern:    256,
+		RatePerMinute: 60,
+	}
+}
+
+// Build new a instance
+func (c *Config) Build() *Tailer {
+	if c.Enable {
+		xlog.Info("plugin", xlog.String("logtail", "start"), xlog.Any("dirs", c.Dirs))
+	}
+	return &Tailer{
+		config:  c,
+		limiter: newLimiter(c.RatePerMinute),
+	}
+}
@@ -25,4 +25,25 @@ type AgentReportRequest struct {
 	ZoneCode     string `json:"zone_code"`
 	ZoneName     string `json:"zone_name"`
 	Env          string `json:"env"`
+
+	OS           string          `json:"os,omitempty"`
+	Arch         string          `json:"arch,omitempty"`
+	Capabilities map[string]bool `json:"capabilities,omitempty"`
+
+	Containers []ContainerStatus `json:"containers,omitempty"`
+}
+
+// ContainerStatus app container running on the node
+type ContainerStatus struct {
+	ID           string  `json:"id"`
+	Name         string  `json:"name"`
+	App          string  `json:"app,omitempty"` // value of the app label
+	Runtime      string  `json:"runtime"`       // docker or cri
+	Image        string  `json:"image"`
+	State        string  `json:"state"` // running, exited ...
+	RestartCount int     `json:"restart_count"`
+	StartedAt    int64   `json:"started_at,omitempty"`
+	CPUPercent   float64 `json:"cpu_percent"` // of one core, only for running containers
+	MemoryUsage  uint64  `json:"memory_usage"`
+	MemoryLimit  uint64  `json:"memory_limit,omitempty"`
 }
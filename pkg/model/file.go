@@ -16,4 +16,5 @@ package model
 
 type GetFileReq struct {
 	FileName string `query:"file_name"`
+	Tenant   string `query:"tenant"` // 指定时使用该租户的密钥加密内容
 }
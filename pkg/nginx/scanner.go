@@ -15,6 +15,8 @@
 package nginx
 
 import (
+	"errors"
+	"fmt"
 	"github.com/douyu/juno-agent/pkg/structs"
 	"github.com/douyu/jupiter/pkg/xlog"
 	"github.com/fsnotify/fsnotify"
@@ -26,6 +28,9 @@ import (
 	parser "github.com/yangchenxing/go-nginx-conf-parser"
 )
 
+// max size of a nginx conf file
+const maxConfSize = 4 << 20
+
 // Config nginx config
 type ConfigBlock = parser.NginxConfigureBlock
 
@@ -184,7 +189,17 @@ func (c *ConfScanner) parseFile(filename string) (ConfigBlock, error) {
 }
 
 // parse ...
-func (c *ConfScanner) parse(content []byte) (ConfigBlock, error) {
+// panics of the third-party parser on malformed conf are returned as errors
+func (c *ConfScanner) parse(content []byte) (block ConfigBlock, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			block, err = nil, fmt.Errorf("parse nginx conf panic: %v", r)
+		}
+	}()
+
+	if len(content) > maxConfSize {
+		return nil, errors.New("nginx conf too large")
+	}
 	return parser.Parse(content)
 }
 
@@ -0,0 +1,119 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+)
+
+// features that depend on the operating system or on tools installed on the host
+const (
+	KillProcessTree = "kill_process_tree" // kill a job together with its children
+	ProcessScan     = "process_scan"      // scan running processes with ps
+	Systemd         = "systemd"           // manage programs with systemctl
+	Supervisor      = "supervisor"        // manage programs with supervisorctl
+	ProcFS          = "procfs"            // read host metrics from /proc
+	Cgroups         = "cgroups"           // cgroup hierarchy mounted at /sys/fs/cgroup
+	Namespaces      = "namespaces"        // linux namespaces under /proc/self/ns
+	PSI             = "psi"               // pressure stall information under /proc/pressure
+)
+
+// ErrNotSupported is returned by features that are not available on current platform
+var ErrNotSupported = errors.New("not supported on " + runtime.GOOS + "/" + runtime.GOARCH)
+
+// Capability describes whether a feature is available on current host
+type Capability struct {
+	Name      string `json:"name"`
+	Supported bool   `json:"supported"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Matrix is the capability matrix reported by the agent
+type Matrix struct {
+	OS           string       `json:"os"`
+	Arch         string       `json:"arch"`
+	Capabilities []Capability `json:"capabilities"`
+}
+
+var (
+	probeOnce    sync.Once
+	capabilities []Capability
+)
+
+// Capabilities probes features once and returns the result in a fixed order
+func Capabilities() []Capability {
+	probeOnce.Do(func() {
+		capabilities = probe()
+	})
+	return capabilities
+}
+
+// Supported reports whether the named feature is available
+func Supported(name string) bool {
+	for _, c := range Capabilities() {
+		if c.Name == name {
+			return c.Supported
+		}
+	}
+	return false
+}
+
+// Report returns the capability matrix of current host
+func Report() Matrix {
+	return Matrix{
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		Capabilities: Capabilities(),
+	}
+}
+
+// Map returns capabilities as name to supported
+func Map() map[string]bool {
+	m := make(map[string]bool)
+	for _, c := range Capabilities() {
+		m[c.Name] = c.Supported
+	}
+	return m
+}
+
+func supported(name string) Capability {
+	return Capability{Name: name, Supported: true}
+}
+
+func unsupported(name string) Capability {
+	return Capability{Name: name, Reason: "not available on " + runtime.GOOS}
+}
+
+// requireCommands is supported only if all commands are found in PATH
+func requireCommands(name string, commands ...string) Capability {
+	for _, command := range commands {
+		if _, err := exec.LookPath(command); err != nil {
+			return Capability{Name: name, Reason: command + " not found in PATH"}
+		}
+	}
+	return supported(name)
+}
+
+// requirePath is supported only if path exists
+func requirePath(name string, path string) Capability {
+	if _, err := os.Stat(path); err != nil {
+		return Capability{Name: name, Reason: path + " not found"}
+	}
+	return supported(name)
+}
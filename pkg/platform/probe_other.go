@@ -0,0 +1,32 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package platform
+
+// probe on other unix systems, only features relying on common tools are detected
+func probe() []Capability {
+	return []Capability{
+		supported(KillProcessTree),
+		requireCommands(ProcessScan, "bash", "ps"),
+		unsupported(Systemd),
+		requireCommands(Supervisor, "supervisorctl"),
+		unsupported(ProcFS),
+		unsupported(Cgroups),
+		unsupported(Namespaces),
+		unsupported(PSI),
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+func probe() []Capability {
+	return []Capability{
+		requireCommands(KillProcessTree, "taskkill"),
+		unsupported(ProcessScan),
+		unsupported(Systemd),
+		unsupported(Supervisor),
+		unsupported(ProcFS),
+		unsupported(Cgroups),
+		unsupported(Namespaces),
+		unsupported(PSI),
+	}
+}
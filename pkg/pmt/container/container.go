@@ -0,0 +1,140 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/logging"
+	"github.com/douyu/juno-agent/pkg/model"
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+var (
+	// ErrRestartDisabled restarting containers is not enabled in config
+	ErrRestartDisabled = errors.New("container restart is not enabled")
+	// ErrNotFound no app container has the id or name
+	ErrNotFound = errors.New("app container not found")
+)
+
+// Container a container listed by the runtime
+type Container struct {
+	model.ContainerStatus
+	Labels map[string]string
+}
+
+// Runtime talks to a container runtime on the node
+type Runtime interface {
+	// List all containers, running or not
+	List(ctx context.Context) ([]Container, error)
+	// Inspect fills restart count, start time and resource usage of a container
+	Inspect(ctx context.Context, container *Container) error
+	Restart(ctx context.Context, id string) error
+}
+
+// Inspector periodically collects the app containers on the node
+type Inspector struct {
+	config  *Config
+	runtime Runtime
+
+	mu       sync.RWMutex
+	statuses []model.ContainerStatus
+	stop     chan struct{}
+}
+
+// Start collect container states every interval
+func (i *Inspector) Start() error {
+	xgo.Go(func() {
+		ticker := time.NewTicker(i.config.Interval)
+		defer ticker.Stop()
+		for {
+			if _, err := i.Collect(context.Background()); err != nil {
+				logging.Logger("container").Error("collect containers", xlog.String("runtime", i.config.Runtime), xlog.FieldErr(err))
+			}
+			select {
+			case <-ticker.C:
+			case <-i.stop:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// Close stop collecting
+func (i *Inspector) Close() error {
+	close(i.stop)
+	return nil
+}
+
+// Statuses app containers of the latest collection
+func (i *Inspector) Statuses() []model.ContainerStatus {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.statuses
+}
+
+// Collect list app containers and inspect them, the result is kept for Statuses.
+// A container failing to be inspected is still reported with the listed state
+func (i *Inspector) Collect(ctx context.Context) ([]model.ContainerStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, i.config.Timeout)
+	defer cancel()
+	containers, err := i.runtime.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]model.ContainerStatus, 0, len(containers))
+	for _, container := range containers {
+		if i.config.Label != "" {
+			app, ok := container.Labels[i.config.Label]
+			if !ok {
+				continue
+			}
+			container.App = app
+		}
+		if err := i.runtime.Inspect(ctx, &container); err != nil {
+			logging.Logger("container").Warn("inspect container", xlog.String("id", container.ID), xlog.FieldErr(err))
+		}
+		statuses = append(statuses, container.ContainerStatus)
+	}
+	i.mu.Lock()
+	i.statuses = statuses
+	i.mu.Unlock()
+	return statuses, nil
+}
+
+// Restart restart an app container by id, id prefix or name
+func (i *Inspector) Restart(ctx context.Context, id string) (model.ContainerStatus, error) {
+	if !i.config.Restart {
+		return model.ContainerStatus{}, ErrRestartDisabled
+	}
+	statuses, err := i.Collect(ctx)
+	if err != nil {
+		return model.ContainerStatus{}, err
+	}
+	for _, status := range statuses {
+		if status.Name == id || (id != "" && strings.HasPrefix(status.ID, id)) {
+			ctx, cancel := context.WithTimeout(ctx, i.config.Timeout)
+			defer cancel()
+			return status, i.runtime.Restart(ctx, status.ID)
+		}
+	}
+	return model.ContainerStatus{}, ErrNotFound
+}
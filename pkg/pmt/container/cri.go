@@ -0,0 +1,143 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// cri reads containers of containerd or cri-o with crictl
+type cri struct {
+	crictl string
+}
+
+// List crictl ps, pod labels are merged so the app label set on pods is found
+func (c *cri) List(ctx context.Context) ([]Container, error) {
+	var pods struct {
+		Items []struct {
+			ID     string            `json:"id"`
+			Labels map[string]string `json:"labels"`
+		} `json:"items"`
+	}
+	if err := c.run(ctx, &pods, "pods", "-o", "json"); err != nil {
+		return nil, err
+	}
+	podLabels := make(map[string]map[string]string, len(pods.Items))
+	for _, pod := range pods.Items {
+		podLabels[pod.ID] = pod.Labels
+	}
+
+	var ps struct {
+		Containers []struct {
+			ID           string `json:"id"`
+			PodSandboxID string `json:"podSandboxId"`
+			Metadata     struct {
+				Name    string `json:"name"`
+				Attempt int    `json:"attempt"`
+			} `json:"metadata"`
+			Image struct {
+				Image string `json:"image"`
+			} `json:"image"`
+			State     string            `json:"state"`
+			CreatedAt string            `json:"createdAt"` // unix nanoseconds
+			Labels    map[string]string `json:"labels"`
+		} `json:"containers"`
+	}
+	if err := c.run(ctx, &ps, "ps", "-a", "-o", "json"); err != nil {
+		return nil, err
+	}
+	containers := make([]Container, 0, len(ps.Containers))
+	for _, item := range ps.Containers {
+		labels := make(map[string]string)
+		for k, v := range podLabels[item.PodSandboxID] {
+			labels[k] = v
+		}
+		for k, v := range item.Labels {
+			labels[k] = v
+		}
+		container := Container{Labels: labels}
+		container.ID = item.ID
+		container.Name = item.Metadata.Name
+		container.Runtime = RuntimeCRI
+		container.Image = item.Image.Image
+		container.State = strings.ToLower(strings.TrimPrefix(item.State, "CONTAINER_"))
+		// the kubelet creates a new container with the next attempt on every restart
+		container.RestartCount = item.Metadata.Attempt
+		if container.State == "running" {
+			if created, err := strconv.ParseInt(item.CreatedAt, 10, 64); err == nil {
+				container.StartedAt = created / 1e9
+			}
+		}
+		containers = append(containers, container)
+	}
+	return containers, nil
+}
+
+// Inspect crictl stats of running containers, cri reports no memory limit
+func (c *cri) Inspect(ctx context.Context, container *Container) error {
+	if container.State != "running" {
+		return nil
+	}
+	var stats struct {
+		Stats []struct {
+			CPU struct {
+				UsageNanoCores struct {
+					Value string `json:"value"`
+				} `json:"usageNanoCores"`
+			} `json:"cpu"`
+			Memory struct {
+				WorkingSetBytes struct {
+					Value string `json:"value"`
+				} `json:"workingSetBytes"`
+			} `json:"memory"`
+		} `json:"stats"`
+	}
+	if err := c.run(ctx, &stats, "stats", "-o", "json", "--id", container.ID); err != nil {
+		return err
+	}
+	if len(stats.Stats) == 0 {
+		return nil
+	}
+	// usageNanoCores is missing on older runtimes
+	if nanoCores, err := strconv.ParseUint(stats.Stats[0].CPU.UsageNanoCores.Value, 10, 64); err == nil {
+		container.CPUPercent = float64(nanoCores) / 1e7
+	}
+	container.MemoryUsage, _ = strconv.ParseUint(stats.Stats[0].Memory.WorkingSetBytes.Value, 10, 64)
+	return nil
+}
+
+// Restart crictl stop, the kubelet starts the container again as its restart policy says
+func (c *cri) Restart(ctx context.Context, id string) error {
+	return c.run(ctx, nil, "stop", id)
+}
+
+func (c *cri) run(ctx context.Context, v interface{}, args ...string) error {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.crictl, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("crictl %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(stdout.Bytes(), v)
+}
@@ -0,0 +1,192 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// docker reads containers from the docker engine api
+type docker struct {
+	url    string
+	client *http.Client
+}
+
+func newDocker(addr string) *docker {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	base := strings.TrimRight(addr, "/")
+	if strings.HasPrefix(addr, "unix://") {
+		socket := strings.TrimPrefix(addr, "unix://")
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		base = "http://docker"
+	}
+	return &docker{url: base, client: &http.Client{Transport: transport}}
+}
+
+// List GET /containers/json
+func (d *docker) List(ctx context.Context) ([]Container, error) {
+	var items []struct {
+		ID     string `json:"Id"`
+		Names  []string
+		Image  string
+		State  string
+		Labels map[string]string
+	}
+	if err := d.get(ctx, "/containers/json?all=1", &items); err != nil {
+		return nil, err
+	}
+	containers := make([]Container, 0, len(items))
+	for _, item := range items {
+		container := Container{Labels: item.Labels}
+		container.ID = item.ID
+		container.Runtime = RuntimeDocker
+		container.Image = item.Image
+		container.State = item.State
+		if len(item.Names) > 0 {
+			container.Name = strings.TrimPrefix(item.Names[0], "/")
+		}
+		containers = append(containers, container)
+	}
+	return containers, nil
+}
+
+// Inspect GET /containers/{id}/json, and /containers/{id}/stats for running containers
+func (d *docker) Inspect(ctx context.Context, container *Container) error {
+	var inspect struct {
+		RestartCount int
+		State        struct {
+			Status    string
+			StartedAt time.Time
+		}
+	}
+	if err := d.get(ctx, "/containers/"+url.PathEscape(container.ID)+"/json", &inspect); err != nil {
+		return err
+	}
+	container.RestartCount = inspect.RestartCount
+	container.State = inspect.State.Status
+	if inspect.State.Status != "running" {
+		return nil
+	}
+	container.StartedAt = inspect.State.StartedAt.Unix()
+
+	// without streaming docker samples twice, so precpu_stats is filled
+	var stats dockerStats
+	if err := d.get(ctx, "/containers/"+url.PathEscape(container.ID)+"/stats?stream=false", &stats); err != nil {
+		return err
+	}
+	container.CPUPercent = stats.cpuPercent()
+	container.MemoryUsage = stats.memoryUsage()
+	container.MemoryLimit = stats.MemoryStats.Limit
+	return nil
+}
+
+// Restart POST /containers/{id}/restart
+func (d *docker) Restart(ctx context.Context, id string) error {
+	req, err := http.NewRequest(http.MethodPost, d.url+"/containers/"+url.PathEscape(id)+"/restart", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return dockerError(resp)
+	}
+	return nil
+}
+
+func (d *docker) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, d.url+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return dockerError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// dockerError errors are returned as {"message": "..."}
+func dockerError(resp *http.Response) error {
+	var body struct {
+		Message string `json:"message"`
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	if json.Unmarshal(data, &body) == nil && body.Message != "" {
+		return fmt.Errorf("docker responded %s: %s", resp.Status, body.Message)
+	}
+	return fmt.Errorf("docker responded %s", resp.Status)
+}
+
+type dockerCPUStats struct {
+	CPUUsage struct {
+		TotalUsage uint64 `json:"total_usage"`
+	} `json:"cpu_usage"`
+	SystemUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs  uint64 `json:"online_cpus"`
+}
+
+type dockerStats struct {
+	CPUStats    dockerCPUStats `json:"cpu_stats"`
+	PreCPUStats dockerCPUStats `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+}
+
+// cpuPercent the same as docker stats, 100 is one core fully used
+func (s *dockerStats) cpuPercent() float64 {
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+	return cpuDelta / systemDelta * float64(s.CPUStats.OnlineCPUs) * 100
+}
+
+// memoryUsage excludes inactive page cache like docker stats, older engines only report cache
+func (s *dockerStats) memoryUsage() uint64 {
+	cache, ok := s.MemoryStats.Stats["total_inactive_file"]
+	if !ok {
+		cache, ok = s.MemoryStats.Stats["inactive_file"]
+	}
+	if !ok {
+		cache = s.MemoryStats.Stats["cache"]
+	}
+	if cache > s.MemoryStats.Usage {
+		return s.MemoryStats.Usage
+	}
+	return s.MemoryStats.Usage - cache
+}
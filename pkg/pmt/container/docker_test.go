@@ -0,0 +1,85 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspectorDocker(t *testing.T) {
+	var restarted string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"Id":"abc123","Names":["/demo-api"],"Image":"demo:1.0","State":"running","Labels":{"app":"demo"}},
+			{"Id":"def456","Names":["/redis"],"Image":"redis:6","State":"running","Labels":{}}
+		]`))
+	})
+	mux.HandleFunc("/containers/abc123/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"RestartCount":2,"State":{"Status":"running","StartedAt":"2020-07-01T00:00:00.123Z"}}`))
+	})
+	mux.HandleFunc("/containers/abc123/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"cpu_stats":{"cpu_usage":{"total_usage":3000},"system_cpu_usage":20000,"online_cpus":4},
+			"precpu_stats":{"cpu_usage":{"total_usage":1000},"system_cpu_usage":10000},
+			"memory_stats":{"usage":1000,"limit":4096,"stats":{"inactive_file":200}}
+		}`))
+	})
+	mux.HandleFunc("/containers/abc123/restart", func(w http.ResponseWriter, r *http.Request) {
+		restarted = r.Method
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.Enable = true
+	config.Addr = server.URL
+	inspector := config.Build()
+
+	statuses, err := inspector.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []model.ContainerStatus{{
+		ID:           "abc123",
+		Name:         "demo-api",
+		App:          "demo",
+		Runtime:      RuntimeDocker,
+		Image:        "demo:1.0",
+		State:        "running",
+		RestartCount: 2,
+		StartedAt:    time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC).Unix(),
+		CPUPercent:   80,
+		MemoryUsage:  800,
+		MemoryLimit:  4096,
+	}}, statuses)
+	assert.Equal(t, statuses, inspector.Statuses())
+
+	_, err = inspector.Restart(context.Background(), "abc")
+	assert.Equal(t, ErrRestartDisabled, err)
+	config.Restart = true
+	_, err = inspector.Restart(context.Background(), "redis")
+	assert.Equal(t, ErrNotFound, err)
+	status, err := inspector.Restart(context.Background(), "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "demo-api", status.Name)
+	assert.Equal(t, http.MethodPost, restarted)
+}
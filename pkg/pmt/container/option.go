@@ -0,0 +1,90 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/flag"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// container runtimes
+const (
+	RuntimeDocker = "docker" // docker engine api
+	RuntimeCRI    = "cri"    // containerd and other cri runtimes through crictl
+)
+
+// Config container inspection config
+type Config struct {
+	Enable   bool          `json:"enable"`
+	Runtime  string        `json:"runtime"`  // docker or cri
+	Addr     string        `json:"addr"`     // docker engine address, unix:///var/run/docker.sock or http://host:port
+	Crictl   string        `json:"crictl"`   // crictl binary used for cri runtimes
+	Label    string        `json:"label"`    // containers with this label are app containers, its value is the app name; all containers when empty
+	Restart  bool          `json:"restart"`  // allow restarting app containers through the agent
+	Interval time.Duration `json:"interval"` // how often container states are collected
+	Timeout  time.Duration `json:"timeout"`
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		fmt.Printf("loadContainerConfig.err:%#v\n", err)
+		panic(err)
+	}
+	flagConfig := flag.Bool("container")
+	config.Enable = flagConfig || config.Enable
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable:   false,
+		Runtime:  RuntimeDocker,
+		Addr:     "unix:///var/run/docker.sock",
+		Crictl:   "crictl",
+		Label:    "app",
+		Interval: 30 * time.Second,
+		Timeout:  10 * time.Second,
+	}
+}
+
+// Build returns nil if not enabled or the runtime is unknown
+func (c *Config) Build() *Inspector {
+	if !c.Enable {
+		return nil
+	}
+	var runtime Runtime
+	switch c.Runtime {
+	case RuntimeDocker:
+		runtime = newDocker(c.Addr)
+	case RuntimeCRI:
+		runtime = &cri{crictl: c.Crictl}
+	default:
+		xlog.Error("plugin", xlog.String("container", "unknown runtime"), xlog.String("runtime", c.Runtime))
+		return nil
+	}
+	xlog.Info("plugin", xlog.String("container", "start"), xlog.String("runtime", c.Runtime))
+	return &Inspector{
+		config:  c,
+		runtime: runtime,
+		stop:    make(chan struct{}),
+	}
+}
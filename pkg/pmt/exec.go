@@ -19,6 +19,8 @@ import (
 	"errors"
 	"os/exec"
 	"strings"
+
+	"github.com/douyu/juno-agent/pkg/platform"
 )
 
 var (
@@ -50,6 +52,9 @@ func GenCommand(pmt, app string, op int) (args []string, err error) {
 	default:
 		return nil, errors.New("cmd shell is not found")
 	}
+	if !platform.Supported(pmt) {
+		return nil, errors.New(pmt + " is not available on this host")
+	}
 
 	switch op {
 	case Start:
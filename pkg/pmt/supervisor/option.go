@@ -16,6 +16,8 @@ package supervisor
 
 import (
 	"fmt"
+	"time"
+
 	"github.com/douyu/jupiter/pkg/flag"
 	"github.com/douyu/jupiter/pkg/xlog"
 
@@ -27,8 +29,9 @@ var DefaultSupervisorDir = "/etc/supervisor/conf.d"
 
 // Config ...
 type Config struct {
-	Dir    string `json:"dir"`    // 配置中心supervisor具体配置路径
-	Enable bool   `json:"enable"` // 是否开启开插件
+	Dir    string    `json:"dir"`    // 配置中心supervisor具体配置路径
+	Enable bool      `json:"enable"` // 是否开启开插件
+	RPC    RPCConfig `json:"rpc"`    // 通过 xml-rpc 查询程序状态及启停程序
 }
 
 // StdConfig 返回标准配置信息
@@ -60,6 +63,10 @@ func DefaultConfig() Config {
 	return Config{
 		Dir:    DefaultSupervisorDir,
 		Enable: false,
+		RPC: RPCConfig{
+			Addr:    "unix:///var/run/supervisor.sock",
+			Timeout: 30 * time.Second, // 停止程序时等待其退出
+		},
 	}
 }
 
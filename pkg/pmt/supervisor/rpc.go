@@ -0,0 +1,205 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// 控制程序的操作
+const (
+	OpStart   = "start"
+	OpStop    = "stop"
+	OpRestart = "restart"
+)
+
+// ErrNotAllowed 程序不在允许控制的列表中
+var ErrNotAllowed = errors.New("program is not allowed to be controlled")
+
+// RPCConfig 通过 supervisord 的 xml-rpc 接口查询及控制程序
+type RPCConfig struct {
+	Enable   bool          `json:"enable"`
+	Addr     string        `json:"addr"` // unix:///var/run/supervisor.sock 或 http://127.0.0.1:9001
+	Username string        `json:"username"`
+	Password string        `json:"password"`
+	Timeout  time.Duration `json:"timeout"`
+	Allow    []string      `json:"allow"` // 允许启停的程序，支持通配符如 demo-*，为空时不允许控制任何程序
+}
+
+// ProgramState supervisord 中程序的状态
+type ProgramState struct {
+	Name        string `json:"name"` // 分组中的程序为 group:name
+	Group       string `json:"group"`
+	State       string `json:"state"` // RUNNING、STOPPED、FATAL 等
+	PID         int    `json:"pid"`
+	Uptime      int64  `json:"uptime"` // 秒，未运行时为 0
+	Description string `json:"description"`
+	ExitStatus  int    `json:"exitStatus"`
+	SpawnErr    string `json:"spawnErr"`
+}
+
+// Client supervisord xml-rpc 客户端
+type Client struct {
+	config *RPCConfig
+	url    string
+	client *http.Client
+}
+
+// Build 未开启时返回 nil
+func (c *RPCConfig) Build() *Client {
+	if !c.Enable {
+		return nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	url := strings.TrimRight(c.Addr, "/") + "/RPC2"
+	if strings.HasPrefix(c.Addr, "unix://") {
+		socket := strings.TrimPrefix(c.Addr, "unix://")
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		url = "http://supervisor/RPC2"
+	}
+	return &Client{
+		config: c,
+		url:    url,
+		client: &http.Client{Timeout: c.Timeout, Transport: transport},
+	}
+}
+
+// Programs 全部程序的状态
+func (c *Client) Programs(ctx context.Context) ([]ProgramState, error) {
+	result, err := c.call(ctx, "supervisor.getAllProcessInfo")
+	if err != nil {
+		return nil, err
+	}
+	// 没有程序时为空数组，xml 中没有 value
+	infos, _ := result.([]interface{})
+	programs := make([]ProgramState, 0, len(infos))
+	for _, item := range infos {
+		info, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		program := ProgramState{
+			Name:        stringField(info, "name"),
+			Group:       stringField(info, "group"),
+			State:       stringField(info, "statename"),
+			PID:         intField(info, "pid"),
+			Description: stringField(info, "description"),
+			ExitStatus:  intField(info, "exitstatus"),
+			SpawnErr:    stringField(info, "spawnerr"),
+		}
+		if program.Group != program.Name {
+			program.Name = program.Group + ":" + program.Name
+		}
+		if program.State == "RUNNING" {
+			program.Uptime = int64(intField(info, "now") - intField(info, "start"))
+		}
+		programs = append(programs, program)
+	}
+	return programs, nil
+}
+
+// Control 启动、停止或重启允许控制的程序，等待操作完成
+func (c *Client) Control(ctx context.Context, name, op string) error {
+	if !c.Allowed(name) {
+		return ErrNotAllowed
+	}
+	switch op {
+	case OpStart:
+		return ignoreFault(c.callErr(ctx, "supervisor.startProcess", name, true), faultAlreadyStarted)
+	case OpStop:
+		return ignoreFault(c.callErr(ctx, "supervisor.stopProcess", name, true), faultNotRunning)
+	case OpRestart:
+		if err := ignoreFault(c.callErr(ctx, "supervisor.stopProcess", name, true), faultNotRunning); err != nil {
+			return err
+		}
+		return c.callErr(ctx, "supervisor.startProcess", name, true)
+	default:
+		return fmt.Errorf("unknown op: %s", op)
+	}
+}
+
+// Allowed 程序是否在允许控制的列表中
+func (c *Client) Allowed(name string) bool {
+	for _, pattern := range c.config.Allow {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) callErr(ctx context.Context, method string, params ...interface{}) error {
+	_, err := c.call(ctx, method, params...)
+	return err
+}
+
+func (c *Client) call(ctx context.Context, method string, params ...interface{}) (interface{}, error) {
+	body, err := encodeCall(method, params...)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	if c.config.Username != "" {
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("supervisor responded %s", resp.Status)
+	}
+	return decodeResponse(data)
+}
+
+// ignoreFault 操作已生效的 fault 不视为错误
+func ignoreFault(err error, code int) error {
+	var fault *Fault
+	if errors.As(err, &fault) && fault.Code == code {
+		return nil
+	}
+	return err
+}
+
+func stringField(info map[string]interface{}, key string) string {
+	s, _ := info[key].(string)
+	return s
+}
+
+func intField(info map[string]interface{}, key string) int {
+	n, _ := info[key].(int)
+	return n
+}
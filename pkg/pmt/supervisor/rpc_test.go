@@ -0,0 +1,82 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package supervisor
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const allProcessInfo = `<?xml version='1.0'?>
+<methodResponse><params><param><value><array><data>
+<value><struct>
+<member><name>name</name><value><string>demo</string></value></member>
+<member><name>group</name><value><string>demo</string></value></member>
+<member><name>statename</name><value><string>RUNNING</string></value></member>
+<member><name>pid</name><value><int>1234</int></value></member>
+<member><name>start</name><value><int>1000</int></value></member>
+<member><name>now</name><value><int>1060</int></value></member>
+<member><name>description</name><value><string>pid 1234, uptime 0:01:00</string></value></member>
+</struct></value>
+<value><struct>
+<member><name>name</name><value><string>worker_00</string></value></member>
+<member><name>group</name><value><string>worker</string></value></member>
+<member><name>statename</name><value><string>STOPPED</string></value></member>
+<member><name>pid</name><value><int>0</int></value></member>
+</struct></value>
+</data></array></value></param></params></methodResponse>`
+
+const notRunningFault = `<?xml version='1.0'?>
+<methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><int>70</int></value></member>
+<member><name>faultString</name><value><string>NOT_RUNNING: demo</string></value></member>
+</struct></value></fault></methodResponse>`
+
+func TestRPCClient(t *testing.T) {
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case strings.Contains(string(body), "supervisor.getAllProcessInfo"):
+			w.Write([]byte(allProcessInfo))
+		case strings.Contains(string(body), "supervisor.stopProcess"):
+			calls = append(calls, "stop")
+			w.Write([]byte(notRunningFault))
+		case strings.Contains(string(body), "supervisor.startProcess"):
+			assert.Contains(t, string(body), "<string>demo</string><")
+			calls = append(calls, "start")
+			w.Write([]byte(`<?xml version='1.0'?><methodResponse><params><param><value><boolean>1</boolean></value></param></params></methodResponse>`))
+		}
+	}))
+	defer server.Close()
+
+	client := (&RPCConfig{Enable: true, Addr: server.URL, Allow: []string{"demo"}}).Build()
+	programs, err := client.Programs(context.Background())
+	if assert.NoError(t, err) && assert.Len(t, programs, 2) {
+		assert.Equal(t, ProgramState{Name: "demo", Group: "demo", State: "RUNNING", PID: 1234, Uptime: 60, Description: "pid 1234, uptime 0:01:00"}, programs[0])
+		assert.Equal(t, "worker:worker_00", programs[1].Name)
+	}
+
+	// 程序未运行时重启直接启动
+	assert.NoError(t, client.Control(context.Background(), "demo", OpRestart))
+	assert.Equal(t, []string{"stop", "start"}, calls)
+	assert.Equal(t, ErrNotAllowed, client.Control(context.Background(), "worker:worker_00", OpStop))
+}
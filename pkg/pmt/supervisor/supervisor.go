@@ -27,6 +27,9 @@ import (
 	"strings"
 )
 
+// max size of a supervisor conf file
+const maxConfSize = 1 << 20
+
 // Scanner supervisor sacnner
 type Scanner struct {
 	enable      bool
@@ -69,7 +72,17 @@ func (s *Scanner) parseFile(file string) (*Program, []byte, error) {
 }
 
 // parse parse...
-func (s *Scanner) parse(content []byte) (*Program, error) {
+// the conf dir may contain arbitrary files, panics of the ini parser are returned as errors
+func (s *Scanner) parse(content []byte) (program *Program, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			program, err = nil, fmt.Errorf("parse supervisor conf panic: %v", r)
+		}
+	}()
+
+	if len(content) > maxConfSize {
+		return nil, errors.New("supervisor conf too large")
+	}
 	conf, err := ini.LoadSources(ini.LoadOptions{
 		AllowBooleanKeys: true,
 	}, content)
@@ -79,7 +92,9 @@ func (s *Scanner) parse(content []byte) (*Program, error) {
 	for _, section := range conf.Sections() {
 		if section.Name() != ini.DEFAULT_SECTION {
 			program := new(Program)
-			err = section.MapTo(program)
+			if err := section.MapTo(program); err != nil {
+				return nil, err
+			}
 			if program.Command != "" {
 				kvs := strings.SplitN(program.Command, " ", -1)
 				for _, val := range kvs {
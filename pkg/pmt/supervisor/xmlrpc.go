@@ -0,0 +1,144 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package supervisor
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Fault xml-rpc 调用返回的错误，如 supervisord 的 BAD_NAME、ALREADY_STARTED
+type Fault struct {
+	Code   int
+	String string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("supervisor fault %d: %s", f.Code, f.String)
+}
+
+// supervisord 的 fault code
+const (
+	faultAlreadyStarted = 60
+	faultNotRunning     = 70
+)
+
+// encodeCall 参数只支持 string、bool、int
+func encodeCall(method string, params ...interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0"?><methodCall><methodName>`)
+	if err := xml.EscapeText(&b, []byte(method)); err != nil {
+		return nil, err
+	}
+	b.WriteString(`</methodName><params>`)
+	for _, param := range params {
+		b.WriteString(`<param><value>`)
+		switch v := param.(type) {
+		case string:
+			b.WriteString(`<string>`)
+			if err := xml.EscapeText(&b, []byte(v)); err != nil {
+				return nil, err
+			}
+			b.WriteString(`</string>`)
+		case bool:
+			if v {
+				b.WriteString(`<boolean>1</boolean>`)
+			} else {
+				b.WriteString(`<boolean>0</boolean>`)
+			}
+		case int:
+			b.WriteString(`<int>` + strconv.Itoa(v) + `</int>`)
+		default:
+			return nil, fmt.Errorf("unsupported xml-rpc param %T", param)
+		}
+		b.WriteString(`</value></param>`)
+	}
+	b.WriteString(`</params></methodCall>`)
+	return b.Bytes(), nil
+}
+
+type xmlValue struct {
+	Text    string      `xml:",chardata"`
+	String  *string     `xml:"string"`
+	Int     *string     `xml:"int"`
+	I4      *string     `xml:"i4"`
+	Boolean *string     `xml:"boolean"`
+	Double  *string     `xml:"double"`
+	Array   *[]xmlValue `xml:"array>data>value"`
+	Struct  *[]struct {
+		Name  string   `xml:"name"`
+		Value xmlValue `xml:"value"`
+	} `xml:"struct>member"`
+}
+
+type methodResponse struct {
+	Params []xmlValue `xml:"params>param>value"`
+	Fault  *xmlValue  `xml:"fault>value"`
+}
+
+// decodeResponse 返回值转为 string、int、bool、float64、[]interface{} 及 map[string]interface{}
+func decodeResponse(data []byte) (interface{}, error) {
+	var resp methodResponse
+	if err := xml.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Fault != nil {
+		fault, _ := resp.Fault.decode().(map[string]interface{})
+		code, _ := fault["faultCode"].(int)
+		message, _ := fault["faultString"].(string)
+		return nil, &Fault{Code: code, String: message}
+	}
+	if len(resp.Params) == 0 {
+		return nil, nil
+	}
+	return resp.Params[0].decode(), nil
+}
+
+func (v *xmlValue) decode() interface{} {
+	switch {
+	case v.String != nil:
+		return *v.String
+	case v.Int != nil:
+		n, _ := strconv.Atoi(strings.TrimSpace(*v.Int))
+		return n
+	case v.I4 != nil:
+		n, _ := strconv.Atoi(strings.TrimSpace(*v.I4))
+		return n
+	case v.Boolean != nil:
+		return strings.TrimSpace(*v.Boolean) == "1"
+	case v.Double != nil:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(*v.Double), 64)
+		return f
+	case v.Array != nil:
+		values := make([]interface{}, 0, len(*v.Array))
+		for i := range *v.Array {
+			values = append(values, (*v.Array)[i].decode())
+		}
+		return values
+	case v.Struct != nil:
+		members := make(map[string]interface{}, len(*v.Struct))
+		for i := range *v.Struct {
+			member := &(*v.Struct)[i]
+			members[member.Name] = member.Value.decode()
+		}
+		return members
+	default:
+		// 没有类型的值为字符串
+		return v.Text
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// operations on units issued through the agent
+const (
+	OpStart   = "start"
+	OpStop    = "stop"
+	OpRestart = "restart"
+	OpReload  = "reload"
+)
+
+const (
+	systemdDest      = "org.freedesktop.systemd1"
+	systemdPath      = dbus.ObjectPath("/org/freedesktop/systemd1")
+	managerInterface = "org.freedesktop.systemd1.Manager"
+	unitInterface    = "org.freedesktop.systemd1.Unit"
+	serviceInterface = "org.freedesktop.systemd1.Service"
+)
+
+// ErrNotAllowed the unit is not in the allow list
+var ErrNotAllowed = errors.New("unit is not allowed to be controlled")
+
+// jobMethods manager methods enqueuing a job for each operation
+var jobMethods = map[string]string{
+	OpStart:   "StartUnit",
+	OpStop:    "StopUnit",
+	OpRestart: "RestartUnit",
+	OpReload:  "ReloadUnit",
+}
+
+// DBusConfig query and control units through the systemd D-Bus api
+type DBusConfig struct {
+	Enable  bool          `json:"enable"`
+	Units   []string      `json:"units"` // patterns of units reported besides the ones defined in dir, e.g. nginx.service
+	Allow   []string      `json:"allow"` // patterns of units allowed to be controlled, none when empty
+	Timeout time.Duration `json:"timeout"`
+}
+
+// UnitState state of a unit as reported by systemd
+type UnitState struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	LoadState   string `json:"loadState"`
+	ActiveState string `json:"activeState"` // active, inactive, failed, activating ...
+	SubState    string `json:"subState"`    // running, exited, dead ...
+	MainPID     uint32 `json:"mainPid"`
+	Restarts    uint32 `json:"restarts"` // times restarted automatically by systemd, services only
+}
+
+// Manager talks to systemd over the system bus
+type Manager struct {
+	config *DBusConfig
+	dir    string
+}
+
+// Build returns nil if not enabled, dir is where the managed unit files live
+func (c *DBusConfig) Build(dir string) *Manager {
+	if !c.Enable {
+		return nil
+	}
+	return &Manager{config: c, dir: dir}
+}
+
+// Units states of the units defined in dir or matching the configured patterns
+func (m *Manager) Units(ctx context.Context) ([]UnitState, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.config.Timeout)
+	defer cancel()
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var files []struct {
+		Path  string
+		State string
+	}
+	manager := conn.Object(systemdDest, systemdPath)
+	if err := manager.CallWithContext(ctx, managerInterface+".ListUnitFiles", 0).Store(&files); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, file := range files {
+		if m.managed(file.Path) {
+			names = append(names, filepath.Base(file.Path))
+		}
+	}
+	sort.Strings(names)
+
+	units := make([]UnitState, 0, len(names))
+	for _, name := range names {
+		unit, err := unitState(ctx, conn, name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		units = append(units, unit)
+	}
+	return units, nil
+}
+
+// Control start, stop, restart or reload an allowed unit and wait for the job to finish
+func (m *Manager) Control(ctx context.Context, name, op string) error {
+	method, ok := jobMethods[op]
+	if !ok {
+		return fmt.Errorf("unknown op: %s", op)
+	}
+	if !m.Allowed(name) {
+		return ErrNotAllowed
+	}
+	ctx, cancel := context.WithTimeout(ctx, m.config.Timeout)
+	defer cancel()
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// subscribe before enqueuing the job, otherwise a fast job could finish unnoticed
+	manager := conn.Object(systemdDest, systemdPath)
+	if err := manager.CallWithContext(ctx, managerInterface+".Subscribe", 0).Store(); err != nil {
+		return err
+	}
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(systemdPath),
+		dbus.WithMatchInterface(managerInterface),
+		dbus.WithMatchMember("JobRemoved"),
+	); err != nil {
+		return err
+	}
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+	defer conn.RemoveSignal(signals)
+
+	var job dbus.ObjectPath
+	if err := manager.CallWithContext(ctx, managerInterface+"."+method, 0, name, "replace").Store(&job); err != nil {
+		return err
+	}
+	for {
+		select {
+		case signal := <-signals:
+			// JobRemoved(u id, o job, s unit, s result)
+			if signal.Name != managerInterface+".JobRemoved" || len(signal.Body) < 4 {
+				continue
+			}
+			if path, _ := signal.Body[1].(dbus.ObjectPath); path != job {
+				continue
+			}
+			if result, _ := signal.Body[3].(string); result != "done" {
+				return fmt.Errorf("%s %s: job %s", op, name, result)
+			}
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Allowed whether the unit matches one of the allowed patterns
+func (m *Manager) Allowed(name string) bool {
+	return matchAny(m.config.Allow, name)
+}
+
+// managed unit files defined in dir or matching the configured patterns
+func (m *Manager) managed(file string) bool {
+	return filepath.Dir(file) == filepath.Clean(m.dir) || matchAny(m.config.Units, filepath.Base(file))
+}
+
+func unitState(ctx context.Context, conn *dbus.Conn, name string) (UnitState, error) {
+	var unitPath dbus.ObjectPath
+	manager := conn.Object(systemdDest, systemdPath)
+	if err := manager.CallWithContext(ctx, managerInterface+".LoadUnit", 0, name).Store(&unitPath); err != nil {
+		return UnitState{}, err
+	}
+	unit := conn.Object(systemdDest, unitPath)
+	var props map[string]dbus.Variant
+	if err := unit.CallWithContext(ctx, "org.freedesktop.DBus.Properties.GetAll", 0, unitInterface).Store(&props); err != nil {
+		return UnitState{}, err
+	}
+	state := UnitState{
+		Name:        name,
+		Description: stringProp(props, "Description"),
+		LoadState:   stringProp(props, "LoadState"),
+		ActiveState: stringProp(props, "ActiveState"),
+		SubState:    stringProp(props, "SubState"),
+	}
+	if filepath.Ext(name) != ".service" {
+		return state, nil
+	}
+	if err := unit.CallWithContext(ctx, "org.freedesktop.DBus.Properties.GetAll", 0, serviceInterface).Store(&props); err != nil {
+		return UnitState{}, err
+	}
+	// NRestarts is only exported since systemd 235
+	state.MainPID = uint32Prop(props, "MainPID")
+	state.Restarts = uint32Prop(props, "NRestarts")
+	return state, nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func stringProp(props map[string]dbus.Variant, key string) string {
+	s, _ := props[key].Value().(string)
+	return s
+}
+
+func uint32Prop(props map[string]dbus.Variant, key string) uint32 {
+	n, _ := props[key].Value().(uint32)
+	return n
+}
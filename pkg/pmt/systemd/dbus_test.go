@@ -0,0 +1,43 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package systemd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManagerUnits(t *testing.T) {
+	config := &DBusConfig{
+		Enable: true,
+		Units:  []string{"nginx.service"},
+		Allow:  []string{"demo-*.service"},
+	}
+	manager := config.Build("/etc/systemd/system/")
+
+	assert.True(t, manager.managed("/etc/systemd/system/demo-api.service"))
+	assert.True(t, manager.managed("/lib/systemd/system/nginx.service"))
+	assert.False(t, manager.managed("/lib/systemd/system/sshd.service"))
+	assert.False(t, manager.managed("/etc/systemd/system/multi-user.target.wants/demo-api.service"))
+
+	assert.True(t, manager.Allowed("demo-api.service"))
+	assert.False(t, manager.Allowed("nginx.service"))
+	assert.Equal(t, ErrNotAllowed, manager.Control(context.Background(), "nginx.service", OpRestart))
+	assert.EqualError(t, manager.Control(context.Background(), "demo-api.service", "mask"), "unknown op: mask")
+
+	assert.Nil(t, (&DBusConfig{}).Build("/etc/systemd/system"))
+}
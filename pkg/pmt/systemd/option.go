@@ -16,6 +16,8 @@ package systemd
 
 import (
 	"fmt"
+	"time"
+
 	"github.com/douyu/jupiter/pkg/flag"
 	"github.com/douyu/jupiter/pkg/xlog"
 
@@ -27,8 +29,9 @@ var DefaultSystemdDir = "/etc/systemd/system"
 
 // Config systemd config
 type Config struct {
-	Dir    string `json:"dir"`    // Configure the supervisor specific configuration path
-	Enable bool   `json:"enable"` // Whether to open the open plug-in
+	Dir    string     `json:"dir"`    // Configure the supervisor specific configuration path
+	Enable bool       `json:"enable"` // Whether to open the open plug-in
+	DBus   DBusConfig `json:"dbus"`   // Query and control units over D-Bus
 }
 
 // StdConfig returns standard configuration information
@@ -48,6 +51,9 @@ func DefaultConfig() Config {
 	return Config{
 		Dir:    DefaultSystemdDir,
 		Enable: false,
+		DBus: DBusConfig{
+			Timeout: 30 * time.Second, // stopping a unit waits for its processes to exit
+		},
 	}
 }
 
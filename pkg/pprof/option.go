@@ -0,0 +1,85 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/util/xtime"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config on-demand profile capture config
+type Config struct {
+	Enable      bool          `json:"enable"`
+	Dir         string        `json:"dir"`          // dir which profiles are written to
+	Host        string        `json:"host"`         // host of the app governance servers, only local apps are profiled
+	MaxDuration time.Duration `json:"max_duration"` // longest cpu profile allowed
+	Retention   time.Duration `json:"retention"`    // profiles older than this are removed
+	MaxFiles    int           `json:"max_files"`    // oldest profiles are removed when exceeded
+	Upload      UploadConfig  `json:"upload"`
+}
+
+// UploadConfig where captured profiles are uploaded when requested, Admin takes precedence
+type UploadConfig struct {
+	Admin string   `json:"admin"` // url the profile is posted to, app, type and name are passed as query
+	S3    S3Config `json:"s3"`
+}
+
+// S3Config an s3 compatible bucket, objects are put to <prefix><app>/<name>
+type S3Config struct {
+	Endpoint  string `json:"endpoint"` // e.g. https://minio.internal:9000, path-style; AWS when empty
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadPprofConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable:      false,
+		Dir:         "/tmp/juno-agent/pprof",
+		Host:        "127.0.0.1",
+		MaxDuration: xtime.Duration("120s"),
+		Retention:   xtime.Duration("168h"),
+		MaxFiles:    200,
+	}
+}
+
+// Build new a instance
+func (c *Config) Build() *Capturer {
+	if c.Enable {
+		xlog.Info("plugin", xlog.String("pprof", "start"))
+	}
+	return &Capturer{
+		config: c,
+		client: &http.Client{},
+	}
+}
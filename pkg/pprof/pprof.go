@@ -0,0 +1,245 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+const profileSuffix = ".pb.gz"
+
+// profile types served under /debug/pprof/ by the governance server
+const (
+	TypeCPU       = "cpu"
+	TypeHeap      = "heap"
+	TypeAllocs    = "allocs"
+	TypeGoroutine = "goroutine"
+	TypeBlock     = "block"
+	TypeMutex     = "mutex"
+)
+
+// endpoints cpu is sampled for the requested duration, the others are snapshots
+var endpoints = map[string]string{
+	TypeCPU:       "profile",
+	TypeHeap:      "heap",
+	TypeAllocs:    "allocs",
+	TypeGoroutine: "goroutine",
+	TypeBlock:     "block",
+	TypeMutex:     "mutex",
+}
+
+var (
+	// ErrDisabled profile capture is not enabled in config
+	ErrDisabled = errors.New("pprof capture is not enabled")
+
+	invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+)
+
+// Request profiles to capture from an app
+type Request struct {
+	App     string   `json:"app"`
+	Port    int      `json:"port"`    // governance port of the app
+	Types   []string `json:"types"`   // cpu when empty
+	Seconds int      `json:"seconds"` // duration of the cpu profile, 30 when zero
+	Upload  bool     `json:"upload"`  // upload the profiles as configured after they are written
+}
+
+// Profile a captured profile
+type Profile struct {
+	Name     string    `json:"name"`
+	App      string    `json:"app,omitempty"`
+	Type     string    `json:"type,omitempty"`
+	Size     int64     `json:"size"`
+	Time     time.Time `json:"time"`
+	Location string    `json:"location,omitempty"` // where the profile was uploaded
+	Error    string    `json:"error,omitempty"`    // capture or upload failed
+}
+
+// Capturer fetches profiles from local apps and keeps them on disk
+type Capturer struct {
+	config *Config
+	client *http.Client
+	mu     sync.Mutex // serializes pruning of concurrent captures
+}
+
+// Capture fetch the requested profiles concurrently and write them to Dir.
+// Every type gets a Profile, failed ones carry the Error
+func (c *Capturer) Capture(ctx context.Context, req Request) ([]Profile, error) {
+	if !c.config.Enable {
+		return nil, ErrDisabled
+	}
+	if req.App == "" || invalidNameChars.MatchString(req.App) {
+		return nil, fmt.Errorf("invalid app %q", req.App)
+	}
+	if req.Port <= 0 || req.Port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", req.Port)
+	}
+	if len(req.Types) == 0 {
+		req.Types = []string{TypeCPU}
+	}
+	for _, typ := range req.Types {
+		if _, ok := endpoints[typ]; !ok {
+			return nil, fmt.Errorf("unknown profile type %q", typ)
+		}
+	}
+	if req.Seconds <= 0 {
+		req.Seconds = 30
+	}
+	if time.Duration(req.Seconds)*time.Second > c.config.MaxDuration {
+		return nil, fmt.Errorf("seconds should not exceed %s", c.config.MaxDuration)
+	}
+	if err := os.MkdirAll(c.config.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	profiles := make([]Profile, len(req.Types))
+	var wg sync.WaitGroup
+	for i, typ := range req.Types {
+		wg.Add(1)
+		go func(i int, typ string) {
+			defer wg.Done()
+			profile := Profile{
+				Name: fmt.Sprintf("%s-%s-%s%s", req.App, typ, now.Format("20060102-150405"), profileSuffix),
+				App:  req.App,
+				Type: typ,
+				Time: now,
+			}
+			if err := c.fetch(ctx, req, typ, &profile); err != nil {
+				profile.Error = err.Error()
+			} else if req.Upload {
+				if profile.Location, err = c.upload(ctx, profile); err != nil {
+					profile.Error = "upload: " + err.Error()
+				}
+			}
+			profiles[i] = profile
+		}(i, typ)
+	}
+	wg.Wait()
+
+	for _, profile := range profiles {
+		if profile.Error != "" {
+			xlog.Warn("pprof capture", xlog.String("app", req.App), xlog.String("type", profile.Type), xlog.String("err", profile.Error))
+		}
+	}
+	c.prune()
+	return profiles, nil
+}
+
+// fetch GET /debug/pprof/<endpoint> of the app and write the response to Dir
+func (c *Capturer) fetch(ctx context.Context, req Request, typ string, profile *Profile) error {
+	timeout := 30 * time.Second
+	url := fmt.Sprintf("http://%s/debug/pprof/%s", net.JoinHostPort(c.config.Host, strconv.Itoa(req.Port)), endpoints[typ])
+	if typ == TypeCPU {
+		url += "?seconds=" + strconv.Itoa(req.Seconds)
+		timeout += time.Duration(req.Seconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	httpReq, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("app responded %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	path := filepath.Join(c.config.Dir, profile.Name)
+	file, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(file, resp.Body)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	profile.Size = size
+	return os.Rename(path+".tmp", path)
+}
+
+// Profiles list profiles kept on disk, newest first
+func (c *Capturer) Profiles() ([]Profile, error) {
+	infos, err := ioutil.ReadDir(c.config.Dir)
+	if os.IsNotExist(err) {
+		return []Profile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]Profile, 0, len(infos))
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), profileSuffix) {
+			continue
+		}
+		profiles = append(profiles, Profile{Name: info.Name(), Size: info.Size(), Time: info.ModTime()})
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Time.After(profiles[j].Time)
+	})
+	return profiles, nil
+}
+
+// ProfilePath returns the local path of a profile, name must be one returned by Profiles
+func (c *Capturer) ProfilePath(name string) (string, error) {
+	if name != filepath.Base(name) || !strings.HasSuffix(name, profileSuffix) {
+		return "", errors.New("invalid profile name")
+	}
+	path := filepath.Join(c.config.Dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// prune remove profiles older than Retention and the oldest ones exceeding MaxFiles
+func (c *Capturer) prune() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	profiles, err := c.Profiles()
+	if err != nil {
+		return
+	}
+	for i, profile := range profiles {
+		if i >= c.config.MaxFiles || time.Since(profile.Time) > c.config.Retention {
+			_ = os.Remove(filepath.Join(c.config.Dir, profile.Name))
+		}
+	}
+}
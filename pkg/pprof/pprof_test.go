@@ -0,0 +1,110 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapture(t *testing.T) {
+	var uploaded []string
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/debug/pprof/profile":
+			assert.Equal(t, "1", r.URL.Query().Get("seconds"))
+			w.Write([]byte("cpu"))
+		case "/debug/pprof/heap":
+			w.Write([]byte("heap"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer app.Close()
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		uploaded = append(uploaded, r.URL.Query().Get("type")+":"+string(body))
+	}))
+	defer admin.Close()
+
+	dir, err := ioutil.TempDir("", "pprof")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config := DefaultConfig()
+	config.Enable = true
+	config.Dir = dir
+	config.MaxFiles = 2
+	config.Upload.Admin = admin.URL
+	capturer := config.Build()
+
+	_, portStr, _ := net.SplitHostPort(app.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	_, err = capturer.Capture(context.Background(), Request{App: "demo", Port: port, Seconds: 600})
+	assert.Error(t, err)
+	_, err = capturer.Capture(context.Background(), Request{App: "../demo", Port: port})
+	assert.Error(t, err)
+
+	profiles, err := capturer.Capture(context.Background(), Request{
+		App:     "demo",
+		Port:    port,
+		Types:   []string{TypeCPU, TypeHeap, TypeBlock},
+		Seconds: 1,
+		Upload:  true,
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, profiles, 3) {
+		assert.Equal(t, int64(3), profiles[0].Size)
+		assert.Equal(t, admin.URL, profiles[0].Location)
+		assert.Empty(t, profiles[1].Error)
+		assert.Contains(t, profiles[2].Error, "404")
+	}
+	assert.ElementsMatch(t, []string{"cpu:cpu", "heap:heap"}, uploaded)
+
+	kept, err := capturer.Profiles()
+	assert.NoError(t, err)
+	assert.Len(t, kept, 2)
+	path, err := capturer.ProfilePath(profiles[1].Name)
+	assert.NoError(t, err)
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "heap", string(content))
+	_, err = capturer.ProfilePath("../" + profiles[1].Name)
+	assert.Error(t, err)
+}
+
+func TestS3PutRequest(t *testing.T) {
+	config := S3Config{Endpoint: "http://minio:9000/", Bucket: "profiles", Prefix: "pprof/", AccessKey: "ak", SecretKey: "sk"}
+	req, err := config.putRequest("demo/demo cpu.pb.gz", []byte("cpu"), mustTime("2020-07-01T00:00:00Z"))
+	assert.NoError(t, err)
+	assert.Equal(t, "http://minio:9000/profiles/pprof/demo/demo%20cpu.pb.gz", req.URL.String())
+	assert.Equal(t, "20200701T000000Z", req.Header.Get("X-Amz-Date"))
+	assert.Contains(t, req.Header.Get("Authorization"), "Credential=ak/20200701/us-east-1/s3/aws4_request")
+}
+
+func mustTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
@@ -0,0 +1,149 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pprof
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// upload the profile to the admin or the s3 bucket, returns where it was put
+func (c *Capturer) upload(ctx context.Context, profile Profile) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(c.config.Dir, profile.Name))
+	if err != nil {
+		return "", err
+	}
+	upload := c.config.Upload
+	var req *http.Request
+	switch {
+	case upload.Admin != "":
+		query := url.Values{"app": {profile.App}, "type": {profile.Type}, "name": {profile.Name}}
+		location := upload.Admin
+		if strings.Contains(location, "?") {
+			location += "&" + query.Encode()
+		} else {
+			location += "?" + query.Encode()
+		}
+		if req, err = http.NewRequest(http.MethodPost, location, bytes.NewReader(data)); err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+	case upload.S3.Bucket != "":
+		if req, err = upload.S3.putRequest(profile.App+"/"+profile.Name, data, time.Now()); err != nil {
+			return "", err
+		}
+	default:
+		return "", errors.New("no upload destination is configured")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("%s responded %s: %.256s", req.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if upload.Admin != "" {
+		return upload.Admin, nil
+	}
+	return fmt.Sprintf("s3://%s/%s%s/%s", upload.S3.Bucket, upload.S3.Prefix, profile.App, profile.Name), nil
+}
+
+// putRequest PUT the object signed with AWS Signature Version 4, path-style when Endpoint is set
+func (c *S3Config) putRequest(key string, data []byte, now time.Time) (*http.Request, error) {
+	region := c.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	key = c.Prefix + key
+	var rawURL string
+	if c.Endpoint == "" {
+		rawURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", c.Bucket, region, escapeKey(key))
+	} else {
+		rawURL = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(c.Endpoint, "/"), c.Bucket, escapeKey(key))
+	}
+	req, err := http.NewRequest(http.MethodPut, rawURL, bytes.NewReader(data))
+	if err != nil || c.AccessKey == "" {
+		return req, err
+	}
+
+	now = now.UTC()
+	date := now.Format("20060102")
+	stamp := now.Format("20060102T150405Z")
+	payload := sha256.Sum256(data)
+	payloadHash := hex.EncodeToString(payload[:])
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		http.MethodPut,
+		req.URL.EscapedPath(),
+		"",
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + stamp,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	digest := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+
+	signingKey := []byte("AWS4" + c.SecretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(signingKey, toSign))))
+	return req, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapeKey encode the object key as s3 does, everything but unreserved characters and /
+func escapeKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		ch := key[i]
+		if ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || ch == '/' {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
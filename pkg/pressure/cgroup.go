@@ -0,0 +1,69 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pressure
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	procPressure = "/proc/pressure"
+	procCgroup   = "/proc/self/cgroup"
+	cgroupRoot   = "/sys/fs/cgroup"
+)
+
+// detectPath picks the pressure directory when none is configured. On a
+// cgroup v2 host the agent's own cgroup is used, so an agent confined to a
+// slice or container sees the pressure of its cgroup instead of the whole
+// host. Hosts on cgroup v1 or hybrid mode fall back to /proc/pressure
+func detectPath(procCgroup, cgroupRoot string) string {
+	data, err := ioutil.ReadFile(procCgroup)
+	if err != nil || !isCgroup2(cgroupRoot) {
+		return procPressure
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// the unified hierarchy is the only line with hierarchy id 0 and no controllers
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "0::") {
+			continue
+		}
+		dir := filepath.Join(cgroupRoot, strings.TrimPrefix(line, "0::"))
+		if _, err := os.Stat(filepath.Join(dir, "cpu.pressure")); err == nil {
+			return dir
+		}
+	}
+	return procPressure
+}
+
+// isCgroup2 reports whether dir is a cgroup v2 directory, which names its
+// pressure files cpu.pressure, memory.pressure and io.pressure
+func isCgroup2(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "cgroup.controllers"))
+	return err == nil
+}
+
+// pressureFile returns the file holding the pressure of resource in dir
+func pressureFile(dir, resource string) string {
+	if isCgroup2(dir) {
+		return filepath.Join(dir, resource+".pressure")
+	}
+	return filepath.Join(dir, resource)
+}
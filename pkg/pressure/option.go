@@ -0,0 +1,77 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pressure
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/platform"
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config pressure monitor config, thresholds are the "some" avg10 percentage
+// of each resource, zero disables the resource
+type Config struct {
+	Enable       bool          `json:"enable"`
+	Path         string        `json:"path"`     // directory of the cpu, memory and io pressure files, empty picks the agent's cgroup v2 directory or /proc/pressure
+	Interval     time.Duration `json:"interval"` // how often pressure is sampled
+	CPU          float64       `json:"cpu"`
+	Memory       float64       `json:"memory"`
+	IO           float64       `json:"io"`
+	DeferTimeout time.Duration `json:"defer_timeout"` // how long deferred work waits for pressure to clear before it is shed
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadPressureConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable:       false,
+		Path:         "",
+		Interval:     5 * time.Second,
+		CPU:          40,
+		Memory:       20,
+		IO:           40,
+		DeferTimeout: 5 * time.Minute,
+	}
+}
+
+// Build new a instance
+func (c *Config) Build() *Monitor {
+	if c.Enable && !platform.Supported(platform.PSI) {
+		xlog.Warn("plugin", xlog.String("pressure", "disabled"), xlog.FieldErr(platform.ErrNotSupported))
+		c.Enable = false
+	}
+	if c.Enable && c.Path == "" {
+		c.Path = detectPath(procCgroup, cgroupRoot)
+	}
+	if c.Enable {
+		xlog.Info("plugin", xlog.String("pressure", "start"), xlog.String("path", c.Path))
+	}
+	return &Monitor{
+		config: c,
+		stop:   make(chan struct{}),
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pressure
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/metric"
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+var pressureGauge = metric.GaugeVecOpts{
+	Namespace: "juno",
+	Subsystem: "agent",
+	Name:      "pressure_avg10",
+	Help:      "share of time some tasks stalled on a resource in the last 10 seconds",
+	Labels:    []string{"resource"},
+}.Build()
+
+// Sample the "some" avg10 percentage of each resource
+type Sample struct {
+	CPU    float64 `json:"cpu"`
+	Memory float64 `json:"memory"`
+	IO     float64 `json:"io"`
+}
+
+// Monitor samples pressure stall information periodically. A nil or disabled
+// monitor never reports pressure
+type Monitor struct {
+	config *Config
+
+	mu        sync.RWMutex
+	sample    Sample
+	pressured bool
+	reason    string
+	stop      chan struct{}
+
+	// OnChange is called when the host enters or leaves pressure
+	OnChange func(pressured bool, reason string, sample Sample)
+}
+
+// Start sample once and keep sampling in background
+func (m *Monitor) Start() error {
+	if !m.config.Enable {
+		return nil
+	}
+	if err := m.update(); err != nil {
+		return err
+	}
+
+	xgo.Go(func() {
+		ticker := time.NewTicker(m.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.update(); err != nil {
+					xlog.Warn("read pressure failed", xlog.FieldErr(err))
+				}
+			case <-m.stop:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// Stop ...
+func (m *Monitor) Stop() {
+	if m.config.Enable {
+		close(m.stop)
+	}
+}
+
+// Pressured reports whether any resource is above its threshold and which one
+func (m *Monitor) Pressured() (bool, string) {
+	if m == nil {
+		return false, ""
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.pressured, m.reason
+}
+
+// Sample returns the latest sample
+func (m *Monitor) Sample() Sample {
+	if m == nil {
+		return Sample{}
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.sample
+}
+
+// Wait blocks until pressure clears, DeferTimeout elapses or done is closed,
+// returns true if pressure has cleared
+func (m *Monitor) Wait(done <-chan struct{}) bool {
+	if pressured, _ := m.Pressured(); !pressured {
+		return true
+	}
+
+	timeout := time.NewTimer(m.config.DeferTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if pressured, _ := m.Pressured(); !pressured {
+				return true
+			}
+		case <-timeout.C:
+			return false
+		case <-done:
+			return false
+		case <-m.stop:
+			return true
+		}
+	}
+}
+
+func (m *Monitor) update() error {
+	sample, err := readSample(m.config.Path)
+	if err != nil {
+		return err
+	}
+	pressureGauge.Set(sample.CPU, "cpu")
+	pressureGauge.Set(sample.Memory, "memory")
+	pressureGauge.Set(sample.IO, "io")
+
+	reason := m.check(sample)
+
+	m.mu.Lock()
+	changed := m.pressured != (reason != "")
+	m.sample = sample
+	m.pressured = reason != ""
+	m.reason = reason
+	m.mu.Unlock()
+
+	if changed && m.OnChange != nil {
+		m.OnChange(reason != "", reason, sample)
+	}
+	return nil
+}
+
+// check returns the first resource above its threshold
+func (m *Monitor) check(sample Sample) string {
+	for _, r := range []struct {
+		name      string
+		value     float64
+		threshold float64
+	}{
+		{"cpu", sample.CPU, m.config.CPU},
+		{"memory", sample.Memory, m.config.Memory},
+		{"io", sample.IO, m.config.IO},
+	} {
+		if r.threshold > 0 && r.value >= r.threshold {
+			return fmt.Sprintf("%s pressure %.2f%% >= %.2f%%", r.name, r.value, r.threshold)
+		}
+	}
+	return ""
+}
+
+func readSample(dir string) (sample Sample, err error) {
+	for _, r := range []struct {
+		file  string
+		value *float64
+	}{
+		{"cpu", &sample.CPU},
+		{"memory", &sample.Memory},
+		{"io", &sample.IO},
+	} {
+		data, err := ioutil.ReadFile(pressureFile(dir, r.file))
+		if err != nil {
+			return sample, err
+		}
+		if *r.value, err = parseSome(data); err != nil {
+			return sample, fmt.Errorf("parse %s pressure: %w", r.file, err)
+		}
+	}
+	return sample, nil
+}
+
+// parseSome extracts avg10 of the "some" line, e.g.
+// some avg10=0.12 avg60=0.05 avg300=0.01 total=123456
+func parseSome(data []byte) (float64, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "some" {
+			continue
+		}
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, "avg10=") {
+				return strconv.ParseFloat(strings.TrimPrefix(field, "avg10="), 64)
+			}
+		}
+	}
+	return 0, fmt.Errorf("avg10 of some not found")
+}
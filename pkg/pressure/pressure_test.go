@@ -0,0 +1,102 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pressure
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writePressure(t *testing.T, dir string, cpu, memory, io string) {
+	for file, avg10 := range map[string]string{"cpu": cpu, "memory": memory, "io": io} {
+		data := "some avg10=" + avg10 + " avg60=0.00 avg300=0.00 total=0\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n"
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, file), []byte(data), 0644))
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pressure")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.Path = dir
+	config.Interval = 10 * time.Millisecond
+	config.DeferTimeout = 50 * time.Millisecond
+	monitor := &Monitor{config: &config, stop: make(chan struct{})}
+
+	var changes []bool
+	monitor.OnChange = func(pressured bool, reason string, sample Sample) {
+		changes = append(changes, pressured)
+	}
+
+	writePressure(t, dir, "1.50", "0.00", "0.00")
+	assert.NoError(t, monitor.update())
+	pressured, _ := monitor.Pressured()
+	assert.False(t, pressured)
+	assert.Equal(t, 1.5, monitor.Sample().CPU)
+
+	writePressure(t, dir, "1.50", "35.20", "0.00")
+	assert.NoError(t, monitor.update())
+	pressured, reason := monitor.Pressured()
+	assert.True(t, pressured)
+	assert.Contains(t, reason, "memory")
+	assert.False(t, monitor.Wait(nil))
+
+	assert.NoError(t, monitor.update())
+	assert.Equal(t, []bool{true}, changes)
+
+	var nilMonitor *Monitor
+	pressured, _ = nilMonitor.Pressured()
+	assert.False(t, pressured)
+	assert.True(t, nilMonitor.Wait(nil))
+}
+
+func TestParseSome(t *testing.T) {
+	_, err := parseSome([]byte("full avg10=1.00 avg60=0.00 avg300=0.00 total=0\n"))
+	assert.Error(t, err)
+}
+
+func TestCgroup2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgroup")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// cgroup v1 or hybrid hosts read /proc/pressure
+	proc := filepath.Join(dir, "cgroup")
+	assert.NoError(t, ioutil.WriteFile(proc, []byte("12:cpu,cpuacct:/system.slice/juno-agent.service\n0::/system.slice/juno-agent.service\n"), 0644))
+	assert.Equal(t, procPressure, detectPath(proc, dir))
+
+	slice := filepath.Join(dir, "system.slice", "juno-agent.service")
+	assert.NoError(t, os.MkdirAll(slice, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte("cpu io memory\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(slice, "cgroup.controllers"), []byte("cpu io memory\n"), 0644))
+	assert.Equal(t, procPressure, detectPath(proc, dir))
+
+	for _, file := range []string{"cpu", "memory", "io"} {
+		data := "some avg10=2.50 avg60=0.00 avg300=0.00 total=0\n"
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(slice, file+".pressure"), []byte(data), 0644))
+	}
+	assert.Equal(t, slice, detectPath(proc, dir))
+
+	sample, err := readSample(slice)
+	assert.NoError(t, err)
+	assert.Equal(t, 2.5, sample.Memory)
+}
@@ -16,6 +16,7 @@ package process
 
 import (
 	"fmt"
+	"github.com/douyu/juno-agent/pkg/platform"
 	"github.com/douyu/juno-agent/pkg/structs"
 	"github.com/douyu/jupiter/pkg/conf"
 	"github.com/douyu/jupiter/pkg/flag"
@@ -48,6 +49,10 @@ func DefaultConfig() Config {
 
 // Build new a instance
 func (s *Config) Build() *Scanner {
+	if s.Enable && !platform.Supported(platform.ProcessScan) {
+		xlog.Warn("plugin", xlog.String("process", "disabled"), xlog.FieldErr(platform.ErrNotSupported))
+		s.Enable = false
+	}
 	if s.Enable {
 		xlog.Info("plugin", xlog.String("process", "start"))
 	}
@@ -15,10 +15,9 @@
 package process
 
 import (
-	"os/exec"
-	"strings"
 	"time"
 
+	"github.com/douyu/juno-agent/pkg/pressure"
 	"github.com/douyu/juno-agent/pkg/structs"
 	"github.com/douyu/jupiter/pkg/util/xgo"
 )
@@ -28,6 +27,9 @@ type Scanner struct {
 	enable        bool
 	chanProcesses chan []structs.ProcessStatus
 	stop          chan struct{}
+
+	// Pressure skips periodic scans while the host is under pressure
+	Pressure *pressure.Monitor
 }
 
 //Start after a delay of the specified time,
@@ -56,37 +58,10 @@ func (ps *Scanner) Scan() ([]structs.ProcessStatus, error) {
 
 // Scan the process state and returns
 func (ps *Scanner) scan() ([]structs.ProcessStatus, error) {
-	processList := make([]structs.ProcessStatus, 0)
-	if ps.enable {
-		const statusCmdStr = "ps aux | grep \"go/bin\" | grep -v \"grep\" | tr -s \" \""
-		cmd := exec.Command("/bin/bash", "-c", statusCmdStr)
-		resp, err := cmd.CombinedOutput()
-		if err != nil {
-			return nil, err
-		}
-		lines := strings.Split(string(resp), "\n")
-		for _, line := range lines {
-			items := strings.SplitAfterN(line, " ", 11)
-
-			if len(items) != 11 {
-				continue
-			}
-			processList = append(processList, structs.ProcessStatus{
-				User:    items[0],
-				PID:     items[1],
-				CPU:     items[2],
-				MEM:     items[3],
-				VSZ:     items[4],
-				RSS:     items[5],
-				TTY:     items[6],
-				Stat:    items[7],
-				Start:   items[8],
-				Time:    items[9],
-				Command: items[10],
-			})
-		}
+	if !ps.enable {
+		return make([]structs.ProcessStatus, 0), nil
 	}
-	return processList, nil
+	return listProcesses()
 }
 
 // GetProcessStatus ...
@@ -101,6 +76,9 @@ func (ps *Scanner) monitor() {
 	for {
 		select {
 		case <-ticker.C:
+			if pressured, _ := ps.Pressure.Pressured(); pressured {
+				continue
+			}
 			processes, err := ps.scan()
 			if err != nil {
 				// log.Errord("scan process")
@@ -0,0 +1,58 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package process
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+)
+
+// listProcesses list go processes with ps
+func listProcesses() ([]structs.ProcessStatus, error) {
+	processList := make([]structs.ProcessStatus, 0)
+	const statusCmdStr = "ps aux | grep \"go/bin\" | grep -v \"grep\" | tr -s \" \""
+	cmd := exec.Command("/bin/bash", "-c", statusCmdStr)
+	resp, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(resp), "\n")
+	for _, line := range lines {
+		items := strings.SplitAfterN(line, " ", 11)
+
+		if len(items) != 11 {
+			continue
+		}
+		processList = append(processList, structs.ProcessStatus{
+			User:    items[0],
+			PID:     items[1],
+			CPU:     items[2],
+			MEM:     items[3],
+			VSZ:     items[4],
+			RSS:     items[5],
+			TTY:     items[6],
+			Stat:    items[7],
+			Start:   items[8],
+			Time:    items[9],
+			Command: items[10],
+		})
+	}
+	return processList, nil
+}
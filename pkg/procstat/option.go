@@ -0,0 +1,69 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procstat
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/platform"
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config per-process resource usage collector config
+type Config struct {
+	Enable   bool          `json:"enable"`
+	Path     string        `json:"path"`     // mount point of procfs
+	Interval time.Duration `json:"interval"` // how often processes are sampled
+	History  int           `json:"history"`  // samples kept for each process, served as time series
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadProcstatConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable:   false,
+		Path:     "/proc",
+		Interval: 15 * time.Second,
+		History:  240, // an hour at the default interval
+	}
+}
+
+// Build new a instance
+func (c *Config) Build() *Collector {
+	if c.Enable && !platform.Supported(platform.ProcFS) {
+		xlog.Warn("plugin", xlog.String("procstat", "disabled"), xlog.FieldErr(platform.ErrNotSupported))
+		c.Enable = false
+	}
+	if c.Enable {
+		xlog.Info("plugin", xlog.String("procstat", "start"))
+	}
+	return &Collector{
+		config: c,
+		prev:   make(map[string]cpuTimes),
+		series: make(map[string][]Sample),
+		stop:   make(chan struct{}),
+	}
+}
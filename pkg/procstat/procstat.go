@@ -0,0 +1,287 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procstat
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/metric"
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// kinds of targets
+const (
+	KindApp = "app" // process of a managed application
+	KindJob = "job" // running task of a job, Name is <job id>/<task id>
+)
+
+// clockTicks USER_HZ, utime and stime in /proc/<pid>/stat are counted in it
+const clockTicks = 100
+
+var (
+	cpuGauge = metric.GaugeVecOpts{
+		Namespace: "juno",
+		Subsystem: "agent",
+		Name:      "process_cpu_percent",
+		Help:      "cpu usage of a managed process since the previous sample, 100 is one core",
+		Labels:    []string{"kind", "name"},
+	}.Build()
+	rssGauge = metric.GaugeVecOpts{
+		Namespace: "juno",
+		Subsystem: "agent",
+		Name:      "process_rss_bytes",
+		Help:      "resident set size of a managed process",
+		Labels:    []string{"kind", "name"},
+	}.Build()
+	fdsGauge = metric.GaugeVecOpts{
+		Namespace: "juno",
+		Subsystem: "agent",
+		Name:      "process_open_fds",
+		Help:      "open file descriptors of a managed process",
+		Labels:    []string{"kind", "name"},
+	}.Build()
+	threadsGauge = metric.GaugeVecOpts{
+		Namespace: "juno",
+		Subsystem: "agent",
+		Name:      "process_threads",
+		Help:      "threads of a managed process",
+		Labels:    []string{"kind", "name"},
+	}.Build()
+)
+
+// Target a process to sample
+type Target struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	PID  int    `json:"pid"`
+}
+
+// Sample resource usage of a process at Time
+type Sample struct {
+	Target
+	Time       time.Time `json:"time"`
+	CPUPercent float64   `json:"cpu_percent"` // since the previous sample, 0 for the first one
+	RSS        uint64    `json:"rss"`         // bytes
+	OpenFDs    int       `json:"open_fds"`    // -1 if fd can not be read
+	Threads    int       `json:"threads"`
+}
+
+// cpuTimes cpu ticks used by a process, start tells a reused pid apart
+type cpuTimes struct {
+	pid   int
+	start uint64
+	ticks uint64
+	at    time.Time
+}
+
+// Collector samples the processes returned by Targets periodically
+type Collector struct {
+	config *Config
+
+	mu     sync.RWMutex
+	prev   map[string]cpuTimes // target key -> cpu ticks of the previous sample
+	series map[string][]Sample // target key -> latest samples, oldest first
+	stop   chan struct{}
+
+	// Targets returns the processes to sample, set before Start
+	Targets func() []Target
+}
+
+// Start keep sampling in background
+func (c *Collector) Start() error {
+	if !c.config.Enable {
+		return nil
+	}
+	xgo.Go(func() {
+		ticker := time.NewTicker(c.config.Interval)
+		defer ticker.Stop()
+		for {
+			c.Collect()
+			select {
+			case <-ticker.C:
+			case <-c.stop:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// Stop ...
+func (c *Collector) Stop() {
+	if c.config.Enable {
+		close(c.stop)
+	}
+}
+
+// Collect sample every target once, targets that are gone are forgotten
+func (c *Collector) Collect() []Sample {
+	var targets []Target
+	if c.Targets != nil {
+		targets = c.Targets()
+	}
+	now := time.Now()
+	samples := make([]Sample, 0, len(targets))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seen := make(map[string]struct{}, len(targets))
+	for _, target := range targets {
+		key := target.Kind + "/" + target.Name
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		sample, times, err := c.sample(target, now)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				xlog.Warn("sample process failed", xlog.String("name", target.Name), xlog.Int("pid", target.PID), xlog.FieldErr(err))
+			}
+			continue
+		}
+		seen[key] = struct{}{}
+		if prev, ok := c.prev[key]; ok && prev.pid == times.pid && prev.start == times.start && times.at.After(prev.at) {
+			sample.CPUPercent = float64(times.ticks-prev.ticks) / clockTicks / times.at.Sub(prev.at).Seconds() * 100
+		}
+		c.prev[key] = times
+
+		series := append(c.series[key], sample)
+		if len(series) > c.config.History {
+			series = series[len(series)-c.config.History:]
+		}
+		c.series[key] = series
+		samples = append(samples, sample)
+
+		cpuGauge.Set(sample.CPUPercent, target.Kind, target.Name)
+		rssGauge.Set(float64(sample.RSS), target.Kind, target.Name)
+		fdsGauge.Set(float64(sample.OpenFDs), target.Kind, target.Name)
+		threadsGauge.Set(float64(sample.Threads), target.Kind, target.Name)
+	}
+	for key := range c.series {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		kind, name := splitKey(key)
+		cpuGauge.DeleteLabelValues(kind, name)
+		rssGauge.DeleteLabelValues(kind, name)
+		fdsGauge.DeleteLabelValues(kind, name)
+		threadsGauge.DeleteLabelValues(kind, name)
+		delete(c.series, key)
+		delete(c.prev, key)
+	}
+	return samples
+}
+
+// Latest the latest sample of every process, sorted by kind and name
+func (c *Collector) Latest() []Sample {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	samples := make([]Sample, 0, len(c.series))
+	for _, series := range c.series {
+		samples = append(samples, series[len(series)-1])
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].Kind != samples[j].Kind {
+			return samples[i].Kind < samples[j].Kind
+		}
+		return samples[i].Name < samples[j].Name
+	})
+	return samples
+}
+
+// Series samples of a process kept in history, oldest first
+func (c *Collector) Series(kind, name string) []Sample {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	series := c.series[kind+"/"+name]
+	return append(make([]Sample, 0, len(series)), series...)
+}
+
+// sample reads /proc/<pid>/stat and counts /proc/<pid>/fd
+func (c *Collector) sample(target Target, now time.Time) (Sample, cpuTimes, error) {
+	dir := filepath.Join(c.config.Path, strconv.Itoa(target.PID))
+	data, err := ioutil.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return Sample{}, cpuTimes{}, err
+	}
+	stat, err := parseStat(string(data))
+	if err != nil {
+		return Sample{}, cpuTimes{}, err
+	}
+	sample := Sample{
+		Target:  target,
+		Time:    now,
+		RSS:     stat.rssPages * uint64(os.Getpagesize()),
+		Threads: stat.threads,
+		OpenFDs: -1,
+	}
+	// fd of processes run by other users is only readable by root
+	if fds, err := ioutil.ReadDir(filepath.Join(dir, "fd")); err == nil {
+		sample.OpenFDs = len(fds)
+	}
+	return sample, cpuTimes{pid: target.PID, start: stat.start, ticks: stat.utime + stat.stime, at: now}, nil
+}
+
+type procStat struct {
+	utime, stime uint64
+	threads      int
+	start        uint64
+	rssPages     uint64
+}
+
+// parseStat fields of /proc/<pid>/stat, see proc(5). comm may contain spaces
+// and parentheses, so fields are counted after its last ')'
+func parseStat(data string) (procStat, error) {
+	end := strings.LastIndexByte(data, ')')
+	if end < 0 {
+		return procStat{}, errors.New("malformed stat")
+	}
+	// fields[0] is state, the 3rd field
+	fields := strings.Fields(data[end+1:])
+	if len(fields) < 22 {
+		return procStat{}, errors.New("malformed stat")
+	}
+	var (
+		stat procStat
+		err  error
+	)
+	parse := func(i int) uint64 {
+		if err != nil {
+			return 0
+		}
+		var n uint64
+		n, err = strconv.ParseUint(fields[i-3], 10, 64)
+		return n
+	}
+	stat.utime = parse(14)
+	stat.stime = parse(15)
+	stat.threads = int(parse(20))
+	stat.start = parse(22)
+	stat.rssPages = parse(24)
+	return stat, err
+}
+
+func splitKey(key string) (string, string) {
+	i := strings.IndexByte(key, '/')
+	return key[:i], key[i+1:]
+}
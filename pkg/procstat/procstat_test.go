@@ -0,0 +1,73 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procstat
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeStat(t *testing.T, dir string, pid int, ticks, rss int) {
+	path := filepath.Join(dir, fmt.Sprint(pid))
+	assert.NoError(t, os.MkdirAll(filepath.Join(path, "fd"), 0755))
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(path, "fd", fmt.Sprint(i)), nil, 0644))
+	}
+	// comm with spaces and parentheses
+	stat := fmt.Sprintf("%d (demo (api) x) S 1 1 1 0 -1 4194560 100 0 0 0 %d 0 0 0 20 0 7 0 5000 1000000 %d 18446744073709551615", pid, ticks, rss)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(path, "stat"), []byte(stat), 0644))
+}
+
+func TestCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "procstat")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.Path = dir
+	config.History = 2
+	collector := config.Build()
+	targets := []Target{{Kind: KindApp, Name: "demo", PID: 42}, {Kind: KindJob, Name: "backup/1", PID: 43}}
+	collector.Targets = func() []Target { return targets }
+
+	writeStat(t, dir, 42, 100, 10)
+	samples := collector.Collect()
+	// the job task has exited already
+	if assert.Len(t, samples, 1) {
+		assert.Equal(t, uint64(10*os.Getpagesize()), samples[0].RSS)
+		assert.Equal(t, 7, samples[0].Threads)
+		assert.Equal(t, 3, samples[0].OpenFDs)
+		assert.Equal(t, float64(0), samples[0].CPUPercent)
+	}
+
+	writeStat(t, dir, 42, 150, 10)
+	collector.Collect()
+	series := collector.Series(KindApp, "demo")
+	if assert.Len(t, series, 2) {
+		assert.True(t, series[1].CPUPercent > 0)
+	}
+	collector.Collect()
+	assert.Len(t, collector.Series(KindApp, "demo"), 2)
+
+	targets = nil
+	collector.Collect()
+	assert.Empty(t, collector.Latest())
+	assert.Empty(t, collector.Series(KindApp, "demo"))
+}
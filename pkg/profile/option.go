@@ -0,0 +1,78 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/report"
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config host profile sync config
+type Config struct {
+	Enable   bool          `json:"enable"`
+	Repo     string        `json:"repo"`      // repository of the profiles
+	Ref      string        `json:"ref"`       // pinned branch or tag
+	Dir      string        `json:"dir"`       // directory of the profiles in the repository
+	CacheDir string        `json:"cache_dir"` // local checkout, the last synced profiles are used when the repository is unreachable at startup
+	Interval time.Duration `json:"interval"`  // how often the repository is polled for changes
+	Verify   bool          `json:"verify"`    // verify the gpg signature of the commit or tag
+	HostName string        `json:"host_name"` // selects hosts/<host>.json, defaults to the hostname
+	Groups   []string      `json:"groups"`    // selects groups/<group>.json, merged in order
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadProfileConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable:   false,
+		Ref:      "master",
+		Dir:      "profiles",
+		CacheDir: "/var/lib/juno-agent/profiles",
+		Interval: time.Minute,
+	}
+}
+
+// Build new a instance
+func (c *Config) Build() *Syncer {
+	if c.HostName == "" {
+		c.HostName = report.ReturnHostName()
+	}
+	if c.Interval < 10*time.Second {
+		c.Interval = 10 * time.Second
+	}
+	if c.Enable {
+		xlog.Info("plugin", xlog.String("profile", "start"))
+	}
+	return &Syncer{
+		config:  c,
+		stop:    make(chan struct{}),
+		running: make(map[string]interface{}),
+		Running: conf.Get,
+		Apply:   apply,
+	}
+}
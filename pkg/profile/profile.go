@@ -0,0 +1,329 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/gitsync"
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/metric"
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+var driftGauge = metric.GaugeVecOpts{
+	Namespace: "juno",
+	Subsystem: "agent",
+	Name:      "profile_drift_settings",
+	Help:      "declared plugin settings not in effect until the agent restarts",
+}.Build()
+
+// Drift a declared setting that differs from the value the plugins are running with
+type Drift struct {
+	Key      string      `json:"key"`
+	Declared interface{} `json:"declared"`
+	Running  interface{} `json:"running"`
+}
+
+// Status result of the latest sync
+type Status struct {
+	Commit     string    `json:"commit"`
+	Sources    []string  `json:"sources"` // profile files merged, in order
+	SyncedAt   time.Time `json:"synced_at"`
+	Reconciled []string  `json:"reconciled"` // local settings overridden by the profiles at startup
+	Drift      []Drift   `json:"drift"`      // settings changed after startup, in effect after the agent restarts
+	Error      string    `json:"error,omitempty"`
+}
+
+// Syncer reconciles plugin settings to the profiles declared in a git repository.
+// Profiles are json documents under the "plugin" key, default.json, groups/<group>.json
+// and hosts/<host>.json are merged in order, later ones override earlier ones.
+type Syncer struct {
+	config *Config
+	stop   chan struct{}
+
+	mu      sync.RWMutex
+	status  Status
+	running map[string]interface{} // values the plugins started with
+
+	// Running returns the value of a setting currently in the agent configuration
+	Running func(key string) interface{}
+	// Apply merges the declared settings into the agent configuration
+	Apply func(settings map[string]interface{}) error
+	// OnDrift is called when the drifted settings change
+	OnDrift func(status Status)
+}
+
+// Start applies the declared profiles before plugins are started, then polls the repository for changes
+func (s *Syncer) Start() error {
+	if s == nil || !s.config.Enable {
+		return nil
+	}
+	// plugins start with the local settings if no profiles could be loaded
+	if err := s.sync(true); err != nil {
+		xlog.Error("sync host profile failed", xlog.String("repo", s.config.Repo), xlog.FieldErr(err))
+	}
+	xgo.Go(s.loop)
+	return nil
+}
+
+// Stop stop polling
+func (s *Syncer) Stop() {
+	if s == nil || !s.config.Enable {
+		return
+	}
+	close(s.stop)
+}
+
+// Status returns the latest sync, false if profile sync is disabled
+func (s *Syncer) Status() (Status, bool) {
+	if s == nil || !s.config.Enable {
+		return Status{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status, true
+}
+
+func (s *Syncer) loop() {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.sync(false); err != nil {
+				xlog.Error("sync host profile failed", xlog.String("repo", s.config.Repo), xlog.FieldErr(err))
+			}
+		}
+	}
+}
+
+// sync fetches and applies the profiles, at startup the values declared become the values plugins run with
+func (s *Syncer) sync(startup bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Interval)
+	defer cancel()
+
+	commit, fetchErr := gitsync.Fetch(ctx, gitsync.Source{
+		Repo:   s.config.Repo,
+		Ref:    s.config.Ref,
+		Dir:    s.config.CacheDir,
+		Verify: s.config.Verify,
+	})
+	if fetchErr != nil {
+		if !startup {
+			return s.fail(fetchErr)
+		}
+		// a host rebooted while the repository is unreachable still comes up with the last synced profiles
+		var err error
+		if commit, err = gitsync.Head(ctx, s.config.CacheDir); err != nil {
+			return s.fail(fetchErr)
+		}
+		xlog.Warn("host profile repository unreachable, use last synced profiles", xlog.String("commit", commit), xlog.FieldErr(fetchErr))
+	}
+
+	s.mu.RLock()
+	unchanged := commit == s.status.Commit && s.status.Error == ""
+	s.mu.RUnlock()
+	if unchanged && !startup {
+		return nil
+	}
+
+	settings, sources, err := load(filepath.Join(s.config.CacheDir, s.config.Dir), s.config.HostName, s.config.Groups)
+	if err != nil {
+		return s.fail(err)
+	}
+	declared := make(map[string]interface{})
+	flatten("", settings, declared)
+
+	s.mu.Lock()
+	for key := range declared {
+		if _, ok := s.running[key]; !ok {
+			s.running[key] = s.Running(key)
+		}
+	}
+	status := Status{
+		Commit:     commit,
+		Sources:    sources,
+		SyncedAt:   time.Now(),
+		Reconciled: s.status.Reconciled,
+	}
+	if startup {
+		status.Reconciled = nil
+		for key, value := range declared {
+			if !equal(s.running[key], value) {
+				status.Reconciled = append(status.Reconciled, key)
+			}
+			s.running[key] = value
+		}
+		sort.Strings(status.Reconciled)
+	}
+	status.Drift = s.drift(declared)
+	if fetchErr != nil {
+		status.Error = fetchErr.Error()
+	}
+	changed := !sameDrift(s.status.Drift, status.Drift)
+	s.status = status
+	s.mu.Unlock()
+
+	if err := s.Apply(settings); err != nil {
+		return s.fail(err)
+	}
+
+	driftGauge.Set(float64(len(status.Drift)))
+	if changed && s.OnDrift != nil {
+		s.OnDrift(status)
+	}
+	xlog.Info("host profile synced", xlog.String("commit", commit), xlog.Any("sources", sources), xlog.Int("drift", len(status.Drift)))
+	return nil
+}
+
+// drift declared settings that differ from the values plugins started with, must be called with lock held
+func (s *Syncer) drift(declared map[string]interface{}) []Drift {
+	drift := make([]Drift, 0)
+	for key, value := range declared {
+		if !equal(s.running[key], value) {
+			drift = append(drift, Drift{Key: key, Declared: value, Running: s.running[key]})
+		}
+	}
+	sort.Slice(drift, func(i, j int) bool {
+		return drift[i].Key < drift[j].Key
+	})
+	return drift
+}
+
+func (s *Syncer) fail(err error) error {
+	s.mu.Lock()
+	s.status.Error = err.Error()
+	s.mu.Unlock()
+	return err
+}
+
+// load merges the profiles selected by host and groups, missing profiles are skipped
+func load(dir, host string, groups []string) (map[string]interface{}, []string, error) {
+	files := []string{"default.json"}
+	for _, group := range groups {
+		files = append(files, filepath.Join("groups", group+".json"))
+	}
+	files = append(files, filepath.Join("hosts", host+".json"))
+
+	settings := make(map[string]interface{})
+	sources := make([]string, 0, len(files))
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var profile map[string]interface{}
+		if err := json.Unmarshal(data, &profile); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if err := validate(profile); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", file, err)
+		}
+		merge(settings, profile)
+		sources = append(sources, file)
+	}
+	return settings, sources, nil
+}
+
+// validate profiles only declare plugin settings, and can not change where profiles come from
+func validate(profile map[string]interface{}) error {
+	for key, value := range profile {
+		if key != "plugin" {
+			return fmt.Errorf("unexpected setting %q, only plugin settings are allowed", key)
+		}
+		plugins, ok := value.(map[string]interface{})
+		if !ok {
+			return errors.New("plugin settings must be an object")
+		}
+		for name := range plugins {
+			if strings.EqualFold(name, "profile") {
+				return errors.New("profile settings can not be declared by profiles")
+			}
+		}
+	}
+	return nil
+}
+
+// merge src into dst, nested objects are merged and other values are replaced
+func merge(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if child, ok := value.(map[string]interface{}); ok {
+			if parent, ok := dst[key].(map[string]interface{}); ok {
+				merge(parent, child)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// flatten nested objects into dotted keys
+func flatten(prefix string, settings map[string]interface{}, out map[string]interface{}) {
+	for key, value := range settings {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if child, ok := value.(map[string]interface{}); ok {
+			flatten(key, child, out)
+			continue
+		}
+		out[key] = value
+	}
+}
+
+// equal compares by formatted value, numbers decoded from json and from the config file differ in type
+func equal(a, b interface{}) bool {
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func sameDrift(a, b []Drift) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Key != b[i].Key || !equal(a[i].Declared, b[i].Declared) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply merges settings into the jupiter configuration, watchers registered by conf.OnChange are notified
+func apply(settings map[string]interface{}) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return conf.LoadFromReader(bytes.NewReader(data), json.Unmarshal)
+}
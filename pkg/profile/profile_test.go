@@ -0,0 +1,109 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/douyu/juno-agent/pkg/gitsync"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncer(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir, err := ioutil.TempDir("", "profile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	repo := filepath.Join(dir, "repo")
+	commit := func(files map[string]string) {
+		for name, content := range files {
+			path := filepath.Join(repo, "profiles", name)
+			assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		}
+		for _, args := range [][]string{
+			{"add", "-A"},
+			{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "update profiles"},
+		} {
+			_, err := gitsync.Run(context.Background(), repo, args...)
+			assert.NoError(t, err)
+		}
+	}
+	assert.NoError(t, os.MkdirAll(repo, 0755))
+	_, err = gitsync.Run(context.Background(), repo, "init", "-q")
+	assert.NoError(t, err)
+	commit(map[string]string{
+		"default.json":      `{"plugin":{"process":{"enable":true},"pressure":{"enable":false,"cpu":40}}}`,
+		"groups/web.json":   `{"plugin":{"pressure":{"enable":true}}}`,
+		"hosts/host-a.json": `{"plugin":{"pressure":{"cpu":60}}}`,
+	})
+	branch, err := gitsync.Run(context.Background(), repo, "rev-parse", "--abbrev-ref", "HEAD")
+	assert.NoError(t, err)
+
+	local := map[string]interface{}{
+		"plugin.process.enable":  false,
+		"plugin.pressure.enable": true,
+		"plugin.pressure.cpu":    int64(60),
+	}
+	config := DefaultConfig()
+	config.Enable = true
+	config.Repo = repo
+	config.Ref = branch
+	config.CacheDir = filepath.Join(dir, "cache")
+	config.HostName = "host-a"
+	config.Groups = []string{"web"}
+	s := config.Build()
+	s.Running = func(key string) interface{} {
+		return local[key]
+	}
+	s.Apply = func(settings map[string]interface{}) error {
+		flatten("", settings, local)
+		return nil
+	}
+	var drifted []Drift
+	s.OnDrift = func(status Status) {
+		drifted = status.Drift
+	}
+
+	assert.NoError(t, s.sync(true))
+	status, ok := s.Status()
+	assert.True(t, ok)
+	assert.Equal(t, []string{"default.json", "groups/web.json", "hosts/host-a.json"}, status.Sources)
+	assert.Equal(t, []string{"plugin.process.enable"}, status.Reconciled)
+	assert.Empty(t, status.Drift)
+	assert.Equal(t, true, local["plugin.process.enable"])
+
+	// changes after startup are applied, and reported as drift until the agent restarts
+	commit(map[string]string{"hosts/host-a.json": `{"plugin":{"pressure":{"cpu":80}}}`})
+	assert.NoError(t, s.sync(false))
+	assert.Equal(t, []Drift{{Key: "plugin.pressure.cpu", Declared: float64(80), Running: float64(60)}}, drifted)
+	assert.Equal(t, float64(80), local["plugin.pressure.cpu"])
+
+	// invalid profiles are not applied
+	commit(map[string]string{"default.json": `{"plugin":{"profile":{"repo":"elsewhere"}}}`})
+	assert.Error(t, s.sync(false))
+	status, _ = s.Status()
+	assert.NotEmpty(t, status.Error)
+	assert.Equal(t, float64(80), local["plugin.pressure.cpu"])
+}
@@ -0,0 +1,320 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apollo
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/source"
+)
+
+const (
+	// DefaultCluster 未指定集群时使用的集群
+	DefaultCluster = "default"
+	// 服务端挂起通知请求 60s，客户端需要等待更久
+	notificationTimeout = 90 * time.Second
+)
+
+// Config apollo 数据源配置
+type Config struct {
+	Enable  bool
+	Addr    string        `json:"addr"`    // config service 地址，如 http://127.0.0.1:8080
+	Cluster string        `json:"cluster"` // 为空时使用 default
+	Secret  string        `json:"secret"`  // 应用开启访问密钥时的 secret
+	Timeout time.Duration `json:"timeout"` // 拉取配置的超时时间
+	Files   []FileConfig  `json:"files"`
+}
+
+// FileConfig 需要拉取的配置
+type FileConfig struct {
+	App       string `json:"app"`       // apollo 中的 appId
+	Namespace string `json:"namespace"` // 如 application、config.yaml，properties 格式的写入 <namespace>.properties
+	Path      string `json:"path"`      // 写入的本地路径，为空时写入配置目录下的 <app>/<文件名>
+	Format    string `json:"format"`    // 为空时按 namespace 的扩展名
+	// 内容为 go 模板，写入前用节点信息渲染
+	Template bool `json:"template"`
+}
+
+// Source 通过 apollo config service 的 http 接口拉取配置
+type Source struct {
+	config *Config
+	files  []source.File
+	client *http.Client
+
+	mu            sync.Mutex
+	notifications map[source.File]int64 // 各 namespace 最近收到的通知 id
+}
+
+// New 配置文件未指定路径时写入 dir 下
+func New(config *Config, dir string) (*Source, error) {
+	if config.Addr == "" {
+		return nil, errors.New("apollo addr is required")
+	}
+	s := &Source{
+		config:        config,
+		client:        &http.Client{},
+		notifications: make(map[source.File]int64),
+	}
+	for _, fc := range config.Files {
+		if fc.App == "" || fc.Namespace == "" {
+			return nil, errors.New("apollo file requires app and namespace")
+		}
+		// properties 格式的 namespace 在 apollo 中不带扩展名
+		namespace := strings.TrimSuffix(fc.Namespace, ".properties")
+		name := fc.Namespace
+		if source.Format(namespace) == "properties" {
+			name = namespace + ".properties"
+		}
+		format := fc.Format
+		if format == "" {
+			format = source.Format(namespace)
+		}
+		s.files = append(s.files, source.File{
+			App:      fc.App,
+			Name:     name,
+			Key:      namespace,
+			Format:   format,
+			Path:     source.Path(dir, fc.App, name, fc.Path),
+			Template: fc.Template,
+		})
+	}
+	return s, nil
+}
+
+// Name ...
+func (s *Source) Name() string {
+	return "apollo"
+}
+
+// Files ...
+func (s *Source) Files() []source.File {
+	return s.files
+}
+
+func (s *Source) cluster() string {
+	if s.config.Cluster == "" {
+		return DefaultCluster
+	}
+	return s.config.Cluster
+}
+
+// Fetch properties 格式的 namespace 按 key 排序生成文件内容，其他格式的内容在 content 中
+func (s *Source) Fetch(ctx context.Context, file source.File) (*source.Content, error) {
+	if s.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.Timeout)
+		defer cancel()
+	}
+	path := "/configs/" + url.PathEscape(file.App) + "/" + url.PathEscape(s.cluster()) + "/" + url.PathEscape(file.Key)
+	resp, err := s.do(ctx, file.App, path)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s/%s: %w", file.App, file.Key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil, fmt.Errorf("fetch %s/%s: apollo responded %s", file.App, file.Key, resp.Status)
+	}
+
+	var config struct {
+		ReleaseKey     string            `json:"releaseKey"`
+		Configurations map[string]string `json:"configurations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return nil, fmt.Errorf("fetch %s/%s: %w", file.App, file.Key, err)
+	}
+	content := config.Configurations["content"]
+	if source.Format(file.Key) == "properties" {
+		content = renderProperties(config.Configurations)
+	}
+	return &source.Content{Content: content, Version: config.ReleaseKey}, nil
+}
+
+// Watch 每个应用一个通知请求，任意一个应用的 namespace 发布后返回。
+// 还没有写入的文件立即返回
+func (s *Source) Watch(ctx context.Context, versions map[source.File]string) ([]source.File, error) {
+	apps := make(map[string][]source.File)
+	var pending []source.File
+	for file, version := range versions {
+		if version == "" {
+			pending = append(pending, file)
+		}
+		apps[file.App] = append(apps[file.App], file)
+	}
+	if len(pending) > 0 {
+		return pending, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		files []source.File
+		err   error
+	}
+	results := make(chan result, len(apps))
+	for app, files := range apps {
+		go func(app string, files []source.File) {
+			changed, err := s.notify(ctx, app, files)
+			results <- result{changed, err}
+		}(app, files)
+	}
+	for range apps {
+		r := <-results
+		if r.err != nil || len(r.files) > 0 {
+			return r.files, r.err
+		}
+	}
+	return nil, nil
+}
+
+// notify 服务端在 namespace 发布后或 60s 后返回，没有变化时返回 304
+func (s *Source) notify(ctx context.Context, app string, files []source.File) ([]source.File, error) {
+	type notification struct {
+		NamespaceName  string `json:"namespaceName"`
+		NotificationID int64  `json:"notificationId"`
+	}
+	s.mu.Lock()
+	var notifications []notification
+	for _, file := range files {
+		id, ok := s.notifications[file]
+		if !ok {
+			id = -1
+		}
+		notifications = append(notifications, notification{NamespaceName: file.Key, NotificationID: id})
+	}
+	s.mu.Unlock()
+	data, _ := json.Marshal(notifications)
+
+	ctx, cancel := context.WithTimeout(ctx, notificationTimeout)
+	defer cancel()
+	query := url.Values{"appId": {app}, "cluster": {s.cluster()}, "notifications": {string(data)}}
+	resp, err := s.do(ctx, app, "/notifications/v2?"+query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("notifications of %s: %w", app, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil, fmt.Errorf("notifications of %s: apollo responded %s", app, resp.Status)
+	}
+
+	var changed []notification
+	if err := json.NewDecoder(resp.Body).Decode(&changed); err != nil {
+		return nil, fmt.Errorf("notifications of %s: %w", app, err)
+	}
+	var result []source.File
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, n := range changed {
+		for _, file := range files {
+			if file.Key == n.NamespaceName {
+				s.notifications[file] = n.NotificationID
+				result = append(result, file)
+			}
+		}
+	}
+	return result, nil
+}
+
+// do pathWithQuery 同时用于访问密钥的签名
+func (s *Source) do(ctx context.Context, app, pathWithQuery string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(s.config.Addr, "/")+pathWithQuery, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if s.config.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		req.Header.Set("Authorization", "Apollo "+app+":"+signature(timestamp, pathWithQuery, s.config.Secret))
+		req.Header.Set("Timestamp", timestamp)
+	}
+	return s.client.Do(req)
+}
+
+// signature base64(hmac-sha1(timestamp + "\n" + pathWithQuery))
+func signature(timestamp, pathWithQuery, secret string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + pathWithQuery))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// renderProperties 按 key 排序，转义后每行一个 key = value
+func renderProperties(configurations map[string]string) string {
+	keys := make([]string, 0, len(configurations))
+	for key := range configurations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(escapeProperty(key, true))
+		b.WriteString(" = ")
+		b.WriteString(escapeProperty(configurations[key], false))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// escapeProperty key 中的空格、= 及 : 需要转义，value 只需要转义开头的空格
+func escapeProperty(s string, isKey bool) string {
+	var b strings.Builder
+	for i, c := range s {
+		switch c {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\f':
+			b.WriteString(`\f`)
+		case ' ':
+			if isKey || i == 0 {
+				b.WriteString(`\ `)
+			} else {
+				b.WriteRune(c)
+			}
+		case '=', ':', '#', '!':
+			if isKey {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apollo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Apollo orders:"+signature(r.Header.Get("Timestamp"), r.URL.RequestURI(), "secret") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/configs/orders/default/application":
+			w.Write([]byte(`{"releaseKey":"r1","configurations":{"server.port":"9091","server.name":" orders\nv2","a b":"c"}}`))
+		case "/configs/orders/default/config.yaml":
+			w.Write([]byte(`{"releaseKey":"r2","configurations":{"content":"port: 9091\n"}}`))
+		case "/notifications/v2":
+			var notifications []map[string]interface{}
+			assert.NoError(t, json.Unmarshal([]byte(r.FormValue("notifications")), &notifications))
+			for _, n := range notifications {
+				if n["namespaceName"] == "config.yaml" && n["notificationId"].(float64) < 7 {
+					w.Write([]byte(`[{"namespaceName":"config.yaml","notificationId":7}]`))
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNotModified)
+		}
+	}))
+	defer server.Close()
+
+	s, err := New(&Config{
+		Addr:   server.URL,
+		Secret: "secret",
+		Files: []FileConfig{
+			{App: "orders", Namespace: "application"},
+			{App: "orders", Namespace: "config.yaml", Path: "/etc/orders.yaml"},
+		},
+	}, "/tmp/juno-agent")
+	assert.NoError(t, err)
+	files := s.Files()
+	assert.Equal(t, source.File{App: "orders", Name: "application.properties", Key: "application", Format: "properties", Path: "/tmp/juno-agent/orders/application.properties"}, files[0])
+	assert.Equal(t, source.File{App: "orders", Name: "config.yaml", Key: "config.yaml", Format: "yaml", Path: "/etc/orders.yaml"}, files[1])
+
+	content, err := s.Fetch(context.Background(), files[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "a\\ b = c\nserver.name = \\ orders\\nv2\nserver.port = 9091\n", content.Content)
+	assert.Equal(t, "r1", content.Version)
+	content, err = s.Fetch(context.Background(), files[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "port: 9091\n", content.Content)
+
+	// 还没有写入的文件立即返回
+	versions := map[source.File]string{files[0]: "r1", files[1]: ""}
+	changed, err := s.Watch(context.Background(), versions)
+	assert.NoError(t, err)
+	assert.Equal(t, []source.File{files[1]}, changed)
+
+	versions[files[1]] = "r2"
+	changed, err = s.Watch(context.Background(), versions)
+	assert.NoError(t, err)
+	assert.Equal(t, []source.File{files[1]}, changed)
+	// 通知 id 已更新，没有新的发布
+	changed, err = s.Watch(context.Background(), versions)
+	assert.NoError(t, err)
+	assert.Empty(t, changed)
+}
@@ -15,6 +15,8 @@
 package confProxy
 
 import (
+	"context"
+
 	"github.com/douyu/juno-agent/pkg/structs"
 	"github.com/labstack/echo/v4"
 )
@@ -25,6 +27,12 @@ type DataSource interface {
 	GetValues(ctx echo.Context, keys ...string) (map[string]string, error)
 	GetRawValues(ctx echo.Context, rawKey string) (map[string]string, error)
 	AppConfigScanner() []*structs.ConfNode
+	Explain(path string) (*structs.ConfExplanation, bool)
+	History(path string) ([]structs.ConfVersion, error)
+	Rollback(path, version string) (string, error)
+	Diff(app, file, from, to string) (*structs.ConfDiff, error)
+	WatchVersion(ctx context.Context, app, file, version string) (*structs.ConfNode, error)
+	Write(node *structs.ConfNode, paths []string) error
 	Reload() error
 	Stop()
 }
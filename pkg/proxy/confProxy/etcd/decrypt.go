@@ -0,0 +1,59 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"errors"
+
+	"github.com/douyu/juno-agent/pkg/keyring"
+)
+
+const (
+	// DecryptFile 加密的配置解密后写入文件
+	DecryptFile = "file"
+	// DecryptAPI 文件中保留密文，只有本地接口返回明文
+	DecryptAPI = "api"
+)
+
+var (
+	// ErrNoKeyring 收到加密的配置但没有开启 keyring
+	ErrNoKeyring = errors.New("config is encrypted but keyring is not enabled")
+	// 加密配置的格式错误只上报行号，错误信息中可能带有明文
+	errRedacted = errors.New("details are hidden for encrypted config")
+)
+
+// plaintext 解密管理端用 keyring 信封加密的配置内容，未加密的内容原样返回
+func (d *DataSource) plaintext(content string) (string, bool, error) {
+	if !keyring.IsEnvelope(content) {
+		return content, false, nil
+	}
+	if d.keyring == nil {
+		return "", true, ErrNoKeyring
+	}
+	plain, _, err := d.keyring.Decrypt(content)
+	if err != nil {
+		return "", true, err
+	}
+	return string(plain), true, nil
+}
+
+// redact 去掉格式错误中可能带有明文的信息
+func redact(err error) error {
+	var syntaxErr *SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return &SyntaxError{Format: syntaxErr.Format, Line: syntaxErr.Line, Err: errRedacted}
+	}
+	return errRedacted
+}
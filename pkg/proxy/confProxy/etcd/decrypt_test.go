@@ -0,0 +1,80 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/douyu/juno-agent/pkg/keyring"
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteEncrypted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "confdecrypt")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	master, err := keyring.NewLocalMaster([]byte("12341234123412341234123412341234"))
+	assert.NoError(t, err)
+	ring, err := keyring.New(filepath.Join(dir, "keyring.json"), master)
+	assert.NoError(t, err)
+
+	node := func(content string) *structs.ConfNode {
+		encrypted, err := ring.Encrypt("app", []byte(content))
+		assert.NoError(t, err)
+		return &structs.ConfNode{
+			AppName:       "app",
+			FileName:      "config.toml",
+			Configuration: &structs.AppConfiguration{Content: encrypted, Metadata: structs.Metadata{Format: "toml", Version: content}},
+		}
+	}
+	read := func(path string) string {
+		data, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		return string(data)
+	}
+
+	// 没有开启 keyring 时拒绝
+	d := &DataSource{versions: newConfigVersions(), managed: newManagedFiles()}
+	assert.Equal(t, ErrNoKeyring, d.Write(node(`password = "123"`), []string{filepath.Join(dir, "none.toml")}))
+
+	d = &DataSource{versions: newConfigVersions(), managed: newManagedFiles(), keyring: ring, decrypt: DecryptFile}
+	n := node(`password = "123"`)
+	assert.NoError(t, d.Write(n, []string{filepath.Join(dir, "file.toml")}))
+	assert.Equal(t, `password = "123"`, read(filepath.Join(dir, "file.toml")))
+	assert.Equal(t, `password = "123"`, n.Configuration.Content)
+
+	// 文件中保留密文，长轮询返回明文
+	d = &DataSource{versions: newConfigVersions(), managed: newManagedFiles(), keyring: ring, decrypt: DecryptAPI}
+	assert.NoError(t, d.Write(node(`password = "123"`), []string{filepath.Join(dir, "api.toml")}))
+	assert.True(t, keyring.IsEnvelope(read(filepath.Join(dir, "api.toml"))))
+	got, err := d.WatchVersion(context.Background(), "app", "config.toml", "")
+	assert.NoError(t, err)
+	assert.Equal(t, `password = "123"`, got.Configuration.Content)
+
+	// 格式错误只带行号
+	err = d.Write(node("a = 1\npassword = \"123"), []string{filepath.Join(dir, "api.toml")})
+	var syntaxErr *SyntaxError
+	if assert.True(t, errors.As(err, &syntaxErr)) {
+		assert.Equal(t, 2, syntaxErr.Line)
+		assert.False(t, strings.Contains(err.Error(), "123"), err.Error())
+	}
+}
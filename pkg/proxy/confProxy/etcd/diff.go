@@ -0,0 +1,102 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// CurrentVersion 比较时表示配置文件当前的内容
+const CurrentVersion = "current"
+
+// ErrNotManaged 应用的配置文件不是由 agent 写入的
+var ErrNotManaged = errors.New("config file is not written by agent")
+
+// Diff 比较应用配置文件的两个历史版本，from 为空时为最近的历史版本，to 为空时为当前内容
+func (d *DataSource) Diff(app, file, from, to string) (*structs.ConfDiff, error) {
+	path, ok := d.managed.path(app, file)
+	if !ok {
+		return nil, ErrNotManaged
+	}
+	return diffVersions(path, from, to)
+}
+
+// diffVersions 返回 unified diff，内容相同时 diff 为空
+func diffVersions(path, from, to string) (*structs.ConfDiff, error) {
+	if from == "" {
+		versions, err := listHistory(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) == 0 {
+			return nil, ErrNoHistory
+		}
+		from = versions[0].Version
+	}
+	if to == "" {
+		to = CurrentVersion
+	}
+
+	a, err := readVersion(path, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := readVersion(path, to)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(string(a)),
+		B:        splitLines(string(b)),
+		FromFile: path + "@" + from,
+		ToFile:   path + "@" + to,
+		Context:  3,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &structs.ConfDiff{Path: path, From: from, To: to, Diff: diff}, nil
+}
+
+// readVersion 读取历史版本或当前的内容，版本号只能是保存时的纳秒时间戳，避免通过版本号读取其他文件
+func readVersion(path, version string) ([]byte, error) {
+	if version == CurrentVersion {
+		return ioutil.ReadFile(path)
+	}
+	if nano, err := strconv.ParseInt(version, 10, 64); err != nil || nano <= 0 || strconv.FormatInt(nano, 10) != version {
+		return nil, fmt.Errorf("%w: %s", ErrNoHistory, version)
+	}
+	content, err := ioutil.ReadFile(historyFile(path, version))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoHistory, version)
+	}
+	return content, nil
+}
+
+// splitLines 每行保留换行符，difflib.SplitLines 会在末尾多出一个空行
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
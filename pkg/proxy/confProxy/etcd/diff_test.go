@@ -0,0 +1,66 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "confdiff")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+
+	d := &DataSource{versions: newConfigVersions(), managed: newManagedFiles(), history: 5}
+	_, err = d.Diff("app", "config.toml", "", "")
+	assert.Equal(t, ErrNotManaged, err)
+
+	for _, content := range []string{"a = 1\nb = 2\n", "a = 1\nb = 3\n", "a = 1\nb = 3\nc = 4\n"} {
+		assert.NoError(t, d.Write(&structs.ConfNode{
+			AppName:       "app",
+			FileName:      "config.toml",
+			Configuration: &structs.AppConfiguration{Content: content, Metadata: structs.Metadata{Format: "toml"}},
+		}, []string{path}))
+	}
+	versions, err := listHistory(path)
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+
+	// 默认比较最近的历史版本与当前内容
+	diff, err := d.Diff("app", "config.toml", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, CurrentVersion, diff.To)
+	assert.Equal(t, "--- "+path+"@"+versions[0].Version+"\n+++ "+path+"@current\n@@ -1,2 +1,3 @@\n a = 1\n b = 3\n+c = 4\n", diff.Diff)
+
+	diff, err = d.Diff("app", "config.toml", versions[1].Version, versions[0].Version)
+	assert.NoError(t, err)
+	assert.Contains(t, diff.Diff, "-b = 2\n+b = 3\n")
+
+	_, err = d.Diff("app", "config.toml", "1", "")
+	assert.True(t, errors.Is(err, ErrNoHistory))
+
+	// 版本号不是时间戳时不读取文件
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("secret\n"), 0600))
+	_, err = d.Diff("app", "config.toml", "/../../secret", "")
+	assert.True(t, errors.Is(err, ErrNoHistory))
+}
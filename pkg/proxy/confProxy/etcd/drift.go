@@ -0,0 +1,218 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/logging"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// 配置文件与写入的内容不一致的原因
+const (
+	DriftModified  = "modified"
+	DriftTruncated = "truncated"
+	DriftMissing   = "missing"
+)
+
+// DriftConfig 定期检查 agent 写入的配置文件是否被修改
+type DriftConfig struct {
+	Interval time.Duration `json:"interval"` // 检查间隔，为 0 时不检查
+	AutoHeal bool          `json:"autoHeal"` // 发现不一致时重新写入应有的内容
+	// 发现不一致或恢复一致时回调
+	OnDrift func(drift Drift) `json:"-"`
+}
+
+// Drift 配置文件与 agent 写入的内容不一致
+type Drift struct {
+	Path     string `json:"path"`
+	AppName  string `json:"app_name"`
+	FileName string `json:"file_name"`
+	Version  string `json:"version"`
+	Expected string `json:"expected"` // 写入内容的 md5
+	Actual   string `json:"actual"`   // 文件当前内容的 md5，文件不存在时为空
+	Reason   string `json:"reason"`   // 为空时表示已恢复一致
+	Healed   bool   `json:"healed"`   // 已重新写入应有的内容
+}
+
+// managedFile agent 写入的配置文件及应有的内容
+type managedFile struct {
+	path     string
+	appName  string
+	fileName string
+	version  string
+	content  []byte
+	md5      string
+	// 下发配置的 etcd key、value，上报检查结果时使用，其他配置中心拉取的配置为空
+	key, value string
+	// 最近一次检查的结果，只在结果变化时上报
+	drift string
+}
+
+// managedFiles 路径 -> 写入的配置文件
+type managedFiles struct {
+	mu    sync.Mutex
+	files map[string]*managedFile
+}
+
+func newManagedFiles() *managedFiles {
+	return &managedFiles{files: make(map[string]*managedFile)}
+}
+
+func (m *managedFiles) store(file *managedFile) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[filepath.Clean(file.path)] = file
+}
+
+// path 应用配置文件写入的路径，写入了多个路径时返回排序后的第一个
+func (m *managedFiles) path(app, file string) (string, bool) {
+	for _, f := range m.list() {
+		if f.appName == app && f.fileName == file {
+			return f.path, true
+		}
+	}
+	return "", false
+}
+
+// update agent 再次写入配置文件后更新应有的内容，之后的检查以新内容为准
+func (m *managedFiles) update(path string, content []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if file, ok := m.files[filepath.Clean(path)]; ok {
+		file.content = content
+		file.md5 = checksum(content)
+		file.drift = ""
+	}
+}
+
+// has 是否为 agent 写入的配置文件
+func (m *managedFiles) has(path string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.files[filepath.Clean(path)]
+	return ok
+}
+
+// list 按路径排序
+func (m *managedFiles) list() []*managedFile {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	files := make([]*managedFile, 0, len(m.files))
+	for _, file := range m.files {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files
+}
+
+func checksum(content []byte) string {
+	sum := md5.Sum(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// checkDrift 返回文件当前内容的 md5 及与应有内容不一致的原因，一致时原因为空
+func checkDrift(file *managedFile) (string, string, error) {
+	content, err := ioutil.ReadFile(file.path)
+	if os.IsNotExist(err) {
+		return "", DriftMissing, nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	actual := checksum(content)
+	switch {
+	case actual == file.md5:
+		return actual, "", nil
+	case len(content) < len(file.content) && bytes.HasPrefix(file.content, content):
+		return actual, DriftTruncated, nil
+	default:
+		return actual, DriftModified, nil
+	}
+}
+
+// watchDrift 定期检查写入的配置文件，直到 stop 关闭
+func (d *DataSource) watchDrift(stop <-chan struct{}) {
+	ticker := time.NewTicker(d.drift.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.checkDrift()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// checkDrift 检查一轮，结果变化时上报，开启 AutoHeal 时重新写入
+func (d *DataSource) checkDrift() []Drift {
+	var drifts []Drift
+	for _, file := range d.managed.list() {
+		actual, reason, err := checkDrift(file)
+		if err != nil {
+			logging.Logger("proxy").Error("check config drift", xlog.String("path", file.path), xlog.FieldErr(err))
+			continue
+		}
+		drift := Drift{
+			Path:     file.path,
+			AppName:  file.appName,
+			FileName: file.fileName,
+			Version:  file.version,
+			Expected: file.md5,
+			Actual:   actual,
+			Reason:   reason,
+		}
+		if reason != "" && d.drift.AutoHeal {
+			if err := writeConfig(file.path, file.content, d.history); err != nil {
+				logging.Logger("proxy").Error("heal config drift", xlog.String("path", file.path), xlog.FieldErr(err))
+			} else {
+				drift.Healed = true
+			}
+		}
+
+		d.managed.mu.Lock()
+		changed := file.drift != reason || drift.Healed
+		file.drift = reason
+		if drift.Healed {
+			file.drift = ""
+		}
+		d.managed.mu.Unlock()
+		if !changed {
+			continue
+		}
+
+		drifts = append(drifts, drift)
+		logging.Logger("proxy").Warn("config drift", xlog.String("path", file.path), xlog.String("reason", reason), xlog.String("expected", file.md5), xlog.String("actual", actual), xlog.Any("healed", drift.Healed))
+		if file.key != "" {
+			if err := d.putReport(file.key, file.value, nil, &drift); err != nil {
+				logging.Logger("proxy").Error("report config drift", xlog.String("key", file.key), xlog.FieldErr(err))
+			}
+		}
+		if d.drift.OnDrift != nil {
+			d.drift.OnDrift(drift)
+		}
+	}
+	return drifts
+}
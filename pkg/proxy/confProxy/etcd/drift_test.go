@@ -0,0 +1,87 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDrift(t *testing.T) {
+	dir, err := ioutil.TempDir("", "confdrift")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+
+	var drifts []Drift
+	d := &DataSource{versions: newConfigVersions(), managed: newManagedFiles(), history: 2}
+	d.drift.OnDrift = func(drift Drift) { drifts = append(drifts, drift) }
+	assert.NoError(t, d.Write(&structs.ConfNode{
+		AppName:       "app",
+		FileName:      "config.toml",
+		Configuration: &structs.AppConfiguration{Content: "port = 9091\nhost = \"a\"\n", Metadata: structs.Metadata{Format: "toml", Version: "v1"}},
+	}, []string{path}))
+	assert.Empty(t, d.checkDrift())
+
+	cases := []struct {
+		content string
+		reason  string
+	}{
+		{"port = 9092\nhost = \"a\"\n", DriftModified},
+		{"port = 9091\n", DriftTruncated},
+		{"", DriftMissing},
+	}
+	for _, c := range cases {
+		if c.reason == DriftMissing {
+			assert.NoError(t, os.Remove(path))
+		} else {
+			assert.NoError(t, ioutil.WriteFile(path, []byte(c.content), 0644))
+		}
+		result := d.checkDrift()
+		if assert.Len(t, result, 1) {
+			assert.Equal(t, c.reason, result[0].Reason)
+		}
+		// 结果未变时不重复上报
+		assert.Empty(t, d.checkDrift())
+	}
+
+	// 开启 AutoHeal 后重新写入应有的内容
+	d.drift.AutoHeal = true
+	result := d.checkDrift()
+	if assert.Len(t, result, 1) {
+		assert.True(t, result[0].Healed)
+	}
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "port = 9091\nhost = \"a\"\n", string(data))
+	assert.Empty(t, d.checkDrift())
+	assert.Len(t, drifts, 4)
+
+	// 回滚写入的内容成为应有的内容，不会被当作不一致恢复
+	assert.NoError(t, d.Write(&structs.ConfNode{
+		AppName:       "app",
+		FileName:      "config.toml",
+		Configuration: &structs.AppConfiguration{Content: "port = 9093\n", Metadata: structs.Metadata{Format: "toml", Version: "v2"}},
+	}, []string{path}))
+	_, err = d.Rollback(path, "")
+	assert.NoError(t, err)
+	assert.Empty(t, d.checkDrift())
+	data, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "port = 9091\nhost = \"a\"\n", string(data))
+}
@@ -24,18 +24,21 @@ import (
 	"sync"
 	"time"
 
-	"github.com/coreos/etcd/clientv3"
-	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/douyu/juno-agent/pkg/envelope"
+	"github.com/douyu/juno-agent/pkg/etcdv3"
+	"github.com/douyu/juno-agent/pkg/keyring"
+	"github.com/douyu/juno-agent/pkg/logging"
 	"github.com/douyu/juno-agent/pkg/report"
 	"github.com/douyu/juno-agent/pkg/structs"
 	"github.com/douyu/juno-agent/util"
-	"github.com/douyu/jupiter/pkg/client/etcdv3"
 	"github.com/douyu/jupiter/pkg/util/xgo"
 	"github.com/douyu/jupiter/pkg/util/xnet"
 	"github.com/douyu/jupiter/pkg/xlog"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
 var (
@@ -51,6 +54,42 @@ type DataSource struct {
 	// 用于记录长轮训的应用信息
 	jm list.List // *job
 	mu sync.Mutex
+	// 配置文件路径 -> 各段落的来源
+	explanations sync.Map
+	// 每个配置文件保留的历史版本数
+	history int
+	// 应用配置文件的最新版本，供长轮询等待
+	versions *configVersions
+	// 解密加密下发的配置，decrypt 为 DecryptFile 或 DecryptAPI
+	keyring *keyring.Keyring
+	decrypt string
+	// 写入的配置文件，定期检查是否被修改
+	managed *managedFiles
+	drift   DriftConfig
+	stop    chan struct{}
+	// 渲染配置模板的节点信息
+	facts Facts
+	// 不为空时配置写入 target 而不写入文件
+	target Target
+}
+
+// Target 代替配置文件接收下发的配置，如 kubernetes 的 ConfigMap
+type Target interface {
+	// Apply content 为校验后的明文，secret 为 true 时配置是加密下发的
+	Apply(node *structs.ConfNode, content []byte, secret bool) error
+}
+
+// Options 数据源的可选配置
+type Options struct {
+	History int // 每个配置文件保留的历史版本数
+	// 解密加密下发的配置，Decrypt 为 DecryptFile 或 DecryptAPI
+	Keyring *keyring.Keyring
+	Decrypt string
+	Drift   DriftConfig
+	// 渲染声明为模板的配置
+	Facts Facts
+	// 配置写入 Target 而不写入文件
+	Target Target
 }
 
 // configNode etcd node chan info
@@ -60,13 +99,25 @@ type configNode struct {
 }
 
 // NewETCDDataSource ...
-func NewETCDDataSource(prefix string) *DataSource {
+func NewETCDDataSource(prefix string, options Options) *DataSource {
 	dataSource := &DataSource{
 		etcdClient:       etcdv3.StdConfig("default").Build(),
 		etcdClientReport: etcdv3.StdConfig("default").Build(),
 		prefix:           prefix,
+		history:          options.History,
+		versions:         newConfigVersions(),
+		keyring:          options.Keyring,
+		decrypt:          options.Decrypt,
+		managed:          newManagedFiles(),
+		drift:            options.Drift,
+		stop:             make(chan struct{}),
+		facts:            options.Facts,
+		target:           options.Target,
 	}
 	xgo.Go(dataSource.watch)
+	if options.Drift.Interval > 0 {
+		xgo.Go(func() { dataSource.watchDrift(dataSource.stop) })
+	}
 	return dataSource
 }
 
@@ -92,25 +143,25 @@ func (d *DataSource) GetValues(ctx echo.Context, keys ...string) (map[string]str
 	hostKey := fmt.Sprintf("/juno-agent/%s/%s/%s/static/%s/%d", report.ReturnHostName(), appName, appEnv, target, portInt)
 	appKey := fmt.Sprintf("/juno-agent/%s/%s/%s/static/%s", "cluster", appName, appEnv, target)
 	commonKey := fmt.Sprintf("%s/%s/%s/%s", appName, appEnv, target, port)
-	data, err := d.etcdClient.GetValues(context.Background(), hostKey, appKey)
+	data, err := d.getValues(hostKey, appKey)
 	if err != nil {
 		return res, err
 	}
 	if _, ok := data[hostKey]; ok {
 		if err := jsoniter.Unmarshal([]byte(data[hostKey]), &config); err == nil {
-			res[commonKey] = config.Content
+			res[commonKey], _, err = d.plaintext(config.Content)
 			return res, err
 		}
 	}
 
 	if _, ok := data[appKey]; ok {
 		if err := jsoniter.Unmarshal([]byte(data[appKey]), &config); err == nil {
-			res[commonKey] = config.Content
-			return res, nil
+			res[commonKey], _, err = d.plaintext(config.Content)
+			return res, err
 		}
 	}
 
-	xlog.Info("getAppConfigContent", xlog.String("appKey", appKey), xlog.Any("data", data))
+	logging.Logger("proxy").Info("getAppConfigContent", xlog.String("appKey", appKey), xlog.Any("data", data))
 	return res, errors.New("no etcd config is found")
 }
 
@@ -120,21 +171,17 @@ func (d *DataSource) GetRawValues(ctx echo.Context, rawKey string) (map[string]s
 		config = structs.ServiceConf{}
 	)
 
-	data, err := d.etcdClient.GetValues(context.Background(), rawKey)
+	data, err := d.getValues(rawKey)
 	if err != nil {
 		return res, err
 	}
 	if _, ok := data[rawKey]; ok {
 		if err := jsoniter.Unmarshal([]byte(data[rawKey]), &config); err == nil {
-			res[rawKey] = config.Content
+			res[rawKey], _, err = d.plaintext(config.Content)
 			return res, err
 		}
-		if err := jsoniter.Unmarshal([]byte(data[rawKey]), &config); err == nil {
-			res[rawKey] = config.Content
-			return res, nil
-		}
 	}
-	xlog.Info("getAppConfigContent", xlog.String("rawKey", rawKey), xlog.Any("data", data))
+	logging.Logger("proxy").Info("getAppConfigContent", xlog.String("rawKey", rawKey), xlog.Any("data", data))
 	return res, errors.New("no etcd config is found")
 }
 
@@ -146,26 +193,32 @@ func (d *DataSource) AppConfigScanner() []*structs.ConfNode {
 	defer cancel()
 	resp, err := d.etcdClient.Get(ctx, hostKey, clientv3.WithPrefix())
 	if err != nil {
-		xlog.Error("init get hostKey error", xlog.String("plugin", "confgo"), xlog.String("msg", err.Error()), xlog.String("hostKey", hostKey))
+		logging.Logger("proxy").Error("init get hostKey error", xlog.String("plugin", "confgo"), xlog.String("msg", err.Error()), xlog.String("hostKey", hostKey))
 		return confuNodes
 	}
 	for _, kv := range resp.Kvs {
 		key, value := string(kv.Key), string(kv.Value)
+		value, rerr := d.readValue(key, value)
+		if rerr != nil {
+			logging.Logger("proxy").Error("init get read error", xlog.String("plugin", "confgo"), xlog.String("key", key), xlog.String("err", rerr.Error()))
+			continue
+		}
 		if confuNode, rr := d.update(key, value); rr != nil {
 			if err == ErrEnvPass { //环境过滤
-				xlog.Info("init get update env pass", xlog.String("plugin", "confgo"), xlog.String("key", key))
+				logging.Logger("proxy").Info("init get update env pass", xlog.String("plugin", "confgo"), xlog.String("key", key))
 			} else {
-				xlog.Error("init get update error", xlog.String("plugin", "confProxy"), xlog.String("msg", rr.Error()), xlog.String("key", key), xlog.String("err", rr.Error()))
+				logging.Logger("proxy").Error("init get update error", xlog.String("plugin", "confProxy"), xlog.String("msg", rr.Error()), xlog.String("key", key), xlog.String("err", rr.Error()))
+				d.reportRejected(key, value, rr)
 			}
 			continue
 		} else {
 			confuNodes = append(confuNodes, confuNode)
 		}
 		if err := d.report(key, value); err != nil {
-			xlog.Error("init get report error", xlog.String("plugin", "confgo"), xlog.String("msg", err.Error()), xlog.String("hostKey", hostKey))
+			logging.Logger("proxy").Error("init get report error", xlog.String("plugin", "confgo"), xlog.String("msg", err.Error()), xlog.String("hostKey", hostKey))
 			continue
 		}
-		xlog.Debug("init update success", xlog.String("plugin", "confgo"), xlog.String("hostKey", hostKey))
+		logging.Logger("proxy").Debug("init update success", xlog.String("plugin", "confgo"), xlog.String("hostKey", hostKey))
 	}
 	return confuNodes
 }
@@ -188,13 +241,19 @@ func (d *DataSource) watch() {
 				case mvccpb.DELETE:
 				case mvccpb.PUT:
 					key, value := string(event.Kv.Key), string(event.Kv.Value)
+					value, err := d.readValue(key, value)
+					if err != nil {
+						logging.Logger("proxy").Error("watch read error", xlog.String("plugin", "confgo"), xlog.String("msg", err.Error()), xlog.String("key", key))
+						continue
+					}
 					// 用于检测该key是否存在于长轮训map中
-					xlog.Info("watch put", xlog.String("plugin", "confgo"), xlog.String("key", key), xlog.String("val", value))
+					logging.Logger("proxy").Info("watch put", xlog.String("plugin", "confgo"), xlog.String("key", key), xlog.String("val", value))
 					if confuNode, err := d.update(key, value); err != nil {
 						if err == ErrEnvPass {
-							xlog.Info("watch update env pass", xlog.String("plugin", "confgo"), xlog.String("key", key), xlog.String("val", value))
+							logging.Logger("proxy").Info("watch update env pass", xlog.String("plugin", "confgo"), xlog.String("key", key), xlog.String("val", value))
 						} else {
-							xlog.Error("watch update error", xlog.String("plugin", "confgo"), xlog.String("msg", err.Error()), xlog.String("key", key))
+							logging.Logger("proxy").Error("watch update error", xlog.String("plugin", "confgo"), xlog.String("msg", err.Error()), xlog.String("key", key))
+							d.reportRejected(key, value, err)
 						}
 						continue
 					} else {
@@ -203,10 +262,10 @@ func (d *DataSource) watch() {
 					}
 
 					if err := d.report(key, value); err != nil {
-						xlog.Error("watch report error", xlog.String("plugin", "confgo"), xlog.String("msg", err.Error()), xlog.String("key", key))
+						logging.Logger("proxy").Error("watch report error", xlog.String("plugin", "confgo"), xlog.String("msg", err.Error()), xlog.String("key", key))
 						continue
 					}
-					xlog.Info("watch update success", xlog.String("key", key), xlog.String("val", value))
+					logging.Logger("proxy").Info("watch update success", xlog.String("key", key), xlog.String("val", value))
 				}
 			}
 		}
@@ -215,7 +274,7 @@ func (d *DataSource) watch() {
 
 // ListenAppConfig listen the app config change
 func (d *DataSource) ListenAppConfig(ctx echo.Context, key string) chan *structs.ConfNode {
-	xlog.Info("confProxy", xlog.String("listenConfig", key))
+	logging.Logger("proxy").Info("confProxy", xlog.String("listenConfig", key))
 	node := &configNode{
 		key: key,
 		ch:  make(chan *structs.ConfNode),
@@ -226,6 +285,28 @@ func (d *DataSource) ListenAppConfig(ctx echo.Context, key string) chan *structs
 	return node.ch
 }
 
+// readValue 读取完整的配置内容，超过 etcd 限制的配置以分块的 envelope 写入
+func (d *DataSource) readValue(key, value string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	data, err := envelope.Read(ctx, d.etcdClient, key, []byte(value))
+	return string(data), err
+}
+
+// getValues 读取多个 key 的配置，分块写入的配置会被还原
+func (d *DataSource) getValues(keys ...string) (map[string]string, error) {
+	data, err := d.etcdClient.GetValues(context.Background(), keys...)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range data {
+		if data[key], err = d.readValue(key, value); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
 // update 更新本地文件
 func (d *DataSource) update(key, value string) (*structs.ConfNode, error) {
 	confNode := &structs.ConfNode{}
@@ -237,7 +318,7 @@ func (d *DataSource) update(key, value string) (*structs.ConfNode, error) {
 	if err := confuKeys.CheckValid(); err != nil {
 		return confNode, fmt.Errorf("key check: %s", err.Error())
 	}
-	xlog.Debug("file update content", xlog.String("plugin", "confgo"), xlog.Any("confuKeys", confuKeys), xlog.String("key", key), xlog.String("value", value))
+	logging.Logger("proxy").Debug("file update content", xlog.String("plugin", "confgo"), xlog.Any("confuKeys", confuKeys), xlog.String("key", key), xlog.String("value", value))
 
 	// value check
 	confuValue, err := structs.ParserConfValue(value)
@@ -247,15 +328,7 @@ func (d *DataSource) update(key, value string) (*structs.ConfNode, error) {
 	if err := confuValue.CheckValid(); err != nil {
 		return confNode, fmt.Errorf("value check: %s", err.Error())
 	}
-
-	for _, path := range confuValue.Metadata.Paths {
-		// write file
-		if err := util.WriteFile(path, confuValue.Content); err != nil {
-			return confNode, err
-		}
-	}
-
-	confNode = &structs.ConfNode{
+	node := &structs.ConfNode{
 		AppName:  confuKeys.AppName,
 		AppEnvi:  confuKeys.EnvName,
 		IP:       "",
@@ -263,14 +336,98 @@ func (d *DataSource) update(key, value string) (*structs.ConfNode, error) {
 		Port:     confuKeys.Port,
 		Configuration: &structs.AppConfiguration{
 			Content:  confuValue.Content,
-			Metadata: structs.Metadata{Format: confuValue.Metadata.Format, Timestamp: confuValue.Metadata.Timestamp, Version: confuValue.Metadata.Version},
+			Metadata: structs.Metadata{Format: confuValue.Metadata.Format, Timestamp: confuValue.Metadata.Timestamp, Version: confuValue.Metadata.Version, Template: confuValue.Metadata.Template},
 		},
 	}
-	return confNode, nil
+	if err := d.write(node, confuValue.Metadata.Paths, key, value); err != nil {
+		return confNode, err
+	}
+	// 段落的行号按解密后的内容查找
+	confuValue.Content = node.Configuration.Content
+	d.storeExplanation(confuKeys, confuValue)
+	return node, nil
+}
+
+// Write 检查格式后原子写入配置文件并保留历史版本，写入成功后唤醒等待该版本的长轮询。
+// 其他配置中心拉取的配置也经由这里写入。加密的配置在写入前解密，node 中保存明文供本地接口返回
+func (d *DataSource) Write(node *structs.ConfNode, paths []string) error {
+	return d.write(node, paths, "", "")
+}
+
+// write key、value 为下发配置的 etcd key 及内容，文件被修改时用于上报
+func (d *DataSource) write(node *structs.ConfNode, paths []string, key, value string) error {
+	content := node.Configuration.Content
+	plain, encrypted, err := d.plaintext(content)
+	if err != nil {
+		return err
+	}
+	if node.Configuration.Metadata.Template {
+		if plain, err = renderTemplate(node.FileName, plain, d.facts); err != nil {
+			if encrypted {
+				return redact(err)
+			}
+			return err
+		}
+	}
+	// 格式错误的配置不写入文件，应用继续使用之前的配置
+	if err := validateContent(node.Configuration.Metadata.Format, plain); err != nil {
+		if encrypted {
+			return redact(err)
+		}
+		return err
+	}
+	if d.target != nil {
+		if err := d.target.Apply(node, []byte(plain), encrypted); err != nil {
+			return err
+		}
+		node.Configuration.Content = plain
+		d.versions.store(node)
+		return nil
+	}
+	// 加密的模板在 api 模式下文件中保留未渲染的密文
+	if d.decrypt != DecryptAPI || !encrypted {
+		content = plain
+	}
+
+	for _, path := range paths {
+		// 原子写入，应用不会读到写了一半的配置
+		if err := writeConfig(path, []byte(content), d.history); err != nil {
+			return err
+		}
+		d.managed.store(&managedFile{
+			path:     path,
+			appName:  node.AppName,
+			fileName: node.FileName,
+			version:  node.Configuration.Metadata.Version,
+			content:  []byte(content),
+			md5:      checksum([]byte(content)),
+			key:      key,
+			value:    value,
+		})
+	}
+	node.Configuration.Content = plain
+	d.versions.store(node)
+	return nil
 }
 
 // report 上报配置下发状态
 func (d *DataSource) report(key, value string) error {
+	return d.putReport(key, value, nil, nil)
+}
+
+// reportRejected 上报因格式错误被拒绝的配置，管理端据此展示解析错误，其他错误只记录日志
+func (d *DataSource) reportRejected(key, value string, err error) {
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return
+	}
+	if rerr := d.putReport(key, value, syntaxErr, nil); rerr != nil {
+		logging.Logger("proxy").Error("report rejected config error", xlog.String("key", key), xlog.String("err", rerr.Error()))
+	}
+}
+
+// putReport syntaxErr 不为空时上报被拒绝的版本，drift 不为空时上报文件被修改
+func (d *DataSource) putReport(key, value string, syntaxErr *SyntaxError, drift *Drift) error {
 
 	confuKeys, err := structs.ParserConfKey(key)
 	if err != nil {
@@ -285,7 +442,7 @@ func (d *DataSource) report(key, value string) error {
 
 	ip, err := xnet.GetLocalIP()
 	if err != nil {
-		xlog.Error("checkEffectMD5", xlog.String("xnetGetLocalIPError", err.Error()))
+		logging.Logger("proxy").Error("checkEffectMD5", xlog.String("xnetGetLocalIPError", err.Error()))
 	}
 
 	reportKey := strings.Join([]string{d.prefix + "/callback", confuKeys.AppName, confuKeys.FileName, confuKeys.Hostname}, "/")
@@ -298,6 +455,18 @@ func (d *DataSource) report(key, value string) error {
 		IP:         ip,
 		HealthPort: confuKeys.Port,
 	}
+	if syntaxErr != nil {
+		reportValue.RejectedMD5 = reportValue.MD5
+		reportValue.MD5 = ""
+		reportValue.Error = syntaxErr.Error()
+		reportValue.ErrorLine = syntaxErr.Line
+	}
+	if drift != nil && drift.Reason != "" {
+		reportValue.Drift = drift.Reason
+		reportValue.DriftPath = drift.Path
+		reportValue.DriftMD5 = drift.Actual
+		reportValue.Healed = drift.Healed
+	}
 	if _, err := d.etcdClientReport.Put(ctx, reportKey, reportValue.JSONString()); err != nil {
 		//if err == auth.ErrInvalidAuthToken {
 		d.etcdClientReport = etcdv3.RawConfig("plugin.confProxy.etcd").Build()
@@ -343,7 +512,7 @@ func (d *DataSource) Reload() error {
 
 // Stop 进程退出停止监听变化
 func (d *DataSource) Stop() {
-	//
+	close(d.stop)
 	if err := d.etcdClient.Watcher.Close(); err != nil {
 		log.Error("confgo stop watcher error", "msg", err.Error())
 		return
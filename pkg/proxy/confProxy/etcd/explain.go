@@ -0,0 +1,99 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+)
+
+var (
+	tomlSectionRegexp = regexp.MustCompile(`^\s*\[{1,2}\s*([^\[\]]+?)\s*\]{1,2}`)
+	yamlSectionRegexp = regexp.MustCompile(`^([A-Za-z0-9_.\-]+)\s*:`)
+)
+
+// Explain 查询写入 path 的配置各段落的来源
+func (d *DataSource) Explain(path string) (*structs.ConfExplanation, bool) {
+	value, ok := d.explanations.Load(path)
+	if !ok {
+		return nil, false
+	}
+	return value.(*structs.ConfExplanation), true
+}
+
+// storeExplanation 记录管理端下发的段落来源，并按配置格式找出各段落的行号
+func (d *DataSource) storeExplanation(keys structs.ConfKey, value structs.ConfValue) {
+	sections := explainSections(value.Content, value.Metadata.Format, value.Metadata.Provenance)
+	for _, path := range value.Metadata.Paths {
+		d.explanations.Store(path, &structs.ConfExplanation{
+			Path:     path,
+			AppName:  keys.AppName,
+			Env:      keys.EnvName,
+			FileName: keys.FileName,
+			Version:  value.Metadata.Version,
+			Sections: sections,
+		})
+	}
+}
+
+type lineRange struct {
+	start, end int
+}
+
+func explainSections(content, format string, provenance []structs.SectionSource) []structs.SectionExplain {
+	ranges := sectionRanges(content, format)
+	sections := make([]structs.SectionExplain, 0, len(provenance))
+	for _, source := range provenance {
+		r := ranges[source.Section]
+		sections = append(sections, structs.SectionExplain{
+			SectionSource: source,
+			StartLine:     r.start,
+			EndLine:       r.end,
+		})
+	}
+	return sections
+}
+
+// sectionRanges 按 toml/ini 的 [section] 或 yaml 的顶层 key 划分段落，json 等格式不划分
+func sectionRanges(content, format string) map[string]lineRange {
+	var re *regexp.Regexp
+	switch strings.ToLower(format) {
+	case "toml", "ini":
+		re = tomlSectionRegexp
+	case "yaml", "yml":
+		re = yamlSectionRegexp
+	}
+
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	ranges := make(map[string]lineRange)
+	current, start := "", 1
+	for i, line := range lines {
+		if re == nil {
+			break
+		}
+		match := re.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if i > 0 {
+			ranges[current] = lineRange{start: start, end: i}
+		}
+		current, start = match[1], i+1
+	}
+	ranges[current] = lineRange{start: start, end: len(lines)}
+	return ranges
+}
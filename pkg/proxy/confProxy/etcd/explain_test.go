@@ -0,0 +1,48 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"testing"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainSections(t *testing.T) {
+	content := `# rendered by juno-admin
+[jupiter.server.http]
+    port = 9091
+[jupiter.mysql.default]
+    dsn = "root:***@tcp(10.0.0.1:3306)/app"
+    maxIdleConns = 10
+`
+	sections := explainSections(content, "toml", []structs.SectionSource{
+		{Section: "jupiter.server.http", Template: "server.tpl", Facts: map[string]string{"ip": "10.0.0.2"}},
+		{Section: "jupiter.mysql.default", Template: "mysql.tpl", Secrets: []string{"mysql_password"}},
+		{Section: "jupiter.redis", Template: "redis.tpl"},
+	})
+
+	assert.Len(t, sections, 3)
+	assert.Equal(t, 2, sections[0].StartLine)
+	assert.Equal(t, 3, sections[0].EndLine)
+	assert.Equal(t, 4, sections[1].StartLine)
+	assert.Equal(t, 6, sections[1].EndLine)
+	assert.Equal(t, []string{"mysql_password"}, sections[1].Secrets)
+	assert.Equal(t, 0, sections[2].StartLine)
+
+	ranges := sectionRanges("server:\n  port: 80\nlog:\n  level: info\n", "yaml")
+	assert.Equal(t, lineRange{start: 3, end: 4}, ranges["log"])
+}
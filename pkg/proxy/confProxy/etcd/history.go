@@ -0,0 +1,182 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/juno-agent/util"
+)
+
+// HistoryDir 配置文件所在目录下保存历史版本的目录
+const HistoryDir = ".history"
+
+// DefaultHistory 未配置时每个配置文件保留的历史版本数
+const DefaultHistory = 10
+
+// ErrNoHistory 配置文件没有可回滚的历史版本
+var ErrNoHistory = errors.New("no history version")
+
+// writeConfig 原子写入配置文件，覆盖前将原有内容保存到 .history 目录，每个文件保留最近 keep 个版本
+// 内容未变时不写入，应用不会收到多余的文件变更
+func writeConfig(path string, content []byte, keep int) error {
+	current, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil:
+		if bytes.Equal(current, content) {
+			return nil
+		}
+		if err := saveHistory(path, current, keep); err != nil {
+			return err
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+	return util.WriteFileAtomic(path, content)
+}
+
+// saveHistory 保存一个历史版本，权限与配置文件相同，并删除超出 keep 的旧版本
+func saveHistory(path string, content []byte, keep int) error {
+	if keep <= 0 {
+		keep = DefaultHistory
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	version := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := util.WriteFileAtomicPerm(historyFile(path, version), content, stat.Mode().Perm()); err != nil {
+		return err
+	}
+
+	versions, err := listHistory(path)
+	if err != nil {
+		return err
+	}
+	if len(versions) > keep {
+		for _, v := range versions[keep:] {
+			_ = os.Remove(historyFile(path, v.Version))
+		}
+	}
+	return nil
+}
+
+// listHistory 配置文件的历史版本，按时间倒序
+func listHistory(path string) ([]structs.ConfVersion, error) {
+	dir := filepath.Join(filepath.Dir(path), HistoryDir)
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := filepath.Base(path) + "."
+	versions := make([]structs.ConfVersion, 0)
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		version := strings.TrimPrefix(name, prefix)
+		nano, err := strconv.ParseInt(version, 10, 64)
+		if err != nil {
+			// 同目录下名称带有相同前缀的其他文件，如 app.toml 与 app.toml.bak
+			continue
+		}
+		versions = append(versions, structs.ConfVersion{
+			Version: version,
+			Time:    time.Unix(0, nano),
+			Size:    info.Size(),
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Time.After(versions[j].Time) })
+	return versions, nil
+}
+
+// History 配置文件保存在 .history 目录下的版本，按时间倒序，只能查看 agent 写入的配置文件
+func (d *DataSource) History(path string) ([]structs.ConfVersion, error) {
+	if !d.managed.has(path) {
+		return nil, ErrNotManaged
+	}
+	return listHistory(path)
+}
+
+// Rollback 将配置文件恢复为历史版本，version 为空时恢复为最近的版本，只能回滚 agent 写入的配置文件
+func (d *DataSource) Rollback(path, version string) (string, error) {
+	if !d.managed.has(path) {
+		return "", ErrNotManaged
+	}
+	version, err := rollback(path, version, d.history)
+	if err != nil {
+		return "", err
+	}
+	// 回滚后的内容成为应有的内容，否则会被当作不一致，开启 AutoHeal 时还会被恢复
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	d.managed.update(path, content)
+	return version, nil
+}
+
+// rollback 将配置文件恢复为指定的历史版本，version 为空时恢复为最近的版本，返回恢复的版本
+// 回滚前的内容同样保存为历史版本，回滚本身可以再次回滚
+func rollback(path, version string, keep int) (string, error) {
+	versions, err := listHistory(path)
+	if err != nil {
+		return "", err
+	}
+	if len(versions) == 0 {
+		return "", ErrNoHistory
+	}
+	if version == "" {
+		version = versions[0].Version
+	}
+	found := false
+	for _, v := range versions {
+		if v.Version == version {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("%w: %s", ErrNoHistory, version)
+	}
+
+	content, err := ioutil.ReadFile(historyFile(path, version))
+	if err != nil {
+		return "", err
+	}
+	if err := writeConfig(path, content, keep); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+func historyFile(path, version string) string {
+	return filepath.Join(filepath.Dir(path), HistoryDir, filepath.Base(path)+"."+version)
+}
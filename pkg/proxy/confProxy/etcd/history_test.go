@@ -0,0 +1,101 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteConfigHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "confhistory")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app", "config.toml")
+	read := func() string {
+		data, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		return string(data)
+	}
+
+	_, err = rollback(path, "", 2)
+	assert.True(t, errors.Is(err, ErrNoHistory))
+
+	for _, content := range []string{"v1", "v2", "v2", "v3", "v4"} {
+		assert.NoError(t, writeConfig(path, []byte(content), 2))
+	}
+	assert.Equal(t, "v4", read())
+
+	// 内容未变的写入不产生版本，只保留最近 2 个
+	versions, err := listHistory(path)
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+	data, _ := ioutil.ReadFile(historyFile(path, versions[0].Version))
+	assert.Equal(t, "v3", string(data))
+
+	// 没有遗留的临时文件
+	files, _ := ioutil.ReadDir(filepath.Dir(path))
+	assert.Len(t, files, 2)
+
+	version, err := rollback(path, "", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, versions[0].Version, version)
+	assert.Equal(t, "v3", read())
+
+	// 回滚前的内容成为最新的版本，可以再回滚回去
+	versions, _ = listHistory(path)
+	_, err = rollback(path, versions[0].Version, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "v4", read())
+
+	_, err = rollback(path, "1", 2)
+	assert.Error(t, err)
+}
+
+func TestHistoryPermission(t *testing.T) {
+	dir, err := ioutil.TempDir("", "confhistory")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+
+	// 历史版本与配置文件的权限相同，覆盖后权限不变
+	assert.NoError(t, ioutil.WriteFile(path, []byte("v1"), 0600))
+	assert.NoError(t, writeConfig(path, []byte("v2"), 2))
+	versions, err := listHistory(path)
+	assert.NoError(t, err)
+	assert.Len(t, versions, 1)
+	for _, name := range []string{path, historyFile(path, versions[0].Version)} {
+		stat, err := os.Stat(name)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+	}
+
+	// 只能查看、回滚 agent 写入的配置文件
+	d := &DataSource{versions: newConfigVersions(), managed: newManagedFiles(), history: 2}
+	_, err = d.History(path)
+	assert.Equal(t, ErrNotManaged, err)
+	_, err = d.Rollback("/etc/shadow", "")
+	assert.Equal(t, ErrNotManaged, err)
+	d.managed.store(&managedFile{path: path})
+	_, err = d.Rollback(path, "")
+	assert.NoError(t, err)
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "v1", string(data))
+}
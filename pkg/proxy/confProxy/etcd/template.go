@@ -0,0 +1,68 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Facts 渲染配置模板时可用的节点信息，如 {{ .IP }}、{{ .Labels.rack }}
+type Facts struct {
+	IP       string
+	Hostname string
+	Env      string
+	Region   string
+	Zone     string
+	Labels   map[string]string
+}
+
+// 模板的错误信息中带有行号，如 template: config.toml:3: ...、template: config.toml:3:12: ...
+var templateLineRegexp = regexp.MustCompile(`^template: [^:]*:(\d+):`)
+
+// renderTemplate 用节点信息渲染配置内容，引用不存在的字段时报错，
+// 可以用 {{ label "rack" "default" }} 读取可能不存在的标签
+func renderTemplate(name, content string, facts Facts) (string, error) {
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{
+			"label": func(key string, defaults ...string) string {
+				if value, ok := facts.Labels[key]; ok {
+					return value
+				}
+				return strings.Join(defaults, "")
+			},
+		}).
+		Parse(content)
+	if err != nil {
+		return "", templateError(err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, facts); err != nil {
+		return "", templateError(err)
+	}
+	return b.String(), nil
+}
+
+// templateError 模板错误与格式错误一样上报管理端
+func templateError(err error) error {
+	line := 0
+	if match := templateLineRegexp.FindStringSubmatch(err.Error()); match != nil {
+		line, _ = strconv.Atoi(match[1])
+	}
+	return &SyntaxError{Format: "template", Line: line, Err: err}
+}
@@ -0,0 +1,43 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	facts := Facts{IP: "10.0.0.1", Hostname: "node-1", Env: "live", Labels: map[string]string{"rack": "r1"}}
+
+	content, err := renderTemplate("config.toml", "[server]\nhost = \"{{ .IP }}\"\nname = \"{{ .Hostname }}-{{ .Env }}\"\nrack = \"{{ .Labels.rack }}\"\nzone = \"{{ label \"zone\" \"z0\" }}\"\n", facts)
+	assert.NoError(t, err)
+	assert.Equal(t, "[server]\nhost = \"10.0.0.1\"\nname = \"node-1-live\"\nrack = \"r1\"\nzone = \"z0\"\n", content)
+
+	// 引用不存在的标签及语法错误都带有行号
+	for content, line := range map[string]int{
+		"a = 1\nrack = \"{{ .Labels.zone }}\"\n": 2,
+		"a = 1\nb = 2\nc = \"{{ .IP \"\n":        3,
+	} {
+		_, err := renderTemplate("config.toml", content, facts)
+		var syntaxErr *SyntaxError
+		if assert.True(t, errors.As(err, &syntaxErr), content) {
+			assert.Equal(t, "template", syntaxErr.Format)
+			assert.Equal(t, line, syntaxErr.Line, syntaxErr.Error())
+		}
+	}
+}
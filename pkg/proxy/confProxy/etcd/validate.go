@@ -0,0 +1,138 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v3"
+)
+
+// toml、yaml 的错误信息中带有行号，如 Near line 3 (last key parsed 'a'): ...、yaml: line 3: ...
+var errorLineRegexp = regexp.MustCompile(`(?i)\bline (\d+)`)
+
+// SyntaxError 配置内容不符合声明的格式，拒绝写入文件
+type SyntaxError struct {
+	Format string
+	Line   int // 出错的行号，从 1 开始，无法确定时为 0
+	Err    error
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("invalid %s at line %d: %s", e.Format, e.Line, e.Err)
+	}
+	return fmt.Sprintf("invalid %s: %s", e.Format, e.Err)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// validateContent 按声明的格式解析配置内容，未知的格式不检查
+func validateContent(format, content string) error {
+	var (
+		line int
+		err  error
+	)
+	switch strings.ToLower(format) {
+	case "toml":
+		var v map[string]interface{}
+		_, err = toml.Decode(content, &v)
+	case "yaml", "yml":
+		var v interface{}
+		err = yaml.Unmarshal([]byte(content), &v)
+	case "json":
+		var v interface{}
+		if err = json.Unmarshal([]byte(content), &v); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				line = strings.Count(content[:syntaxErr.Offset], "\n") + 1
+			}
+		}
+	case "ini":
+		_, err = ini.Load([]byte(content))
+	case "properties":
+		line, err = validateProperties(content)
+	default:
+		return nil
+	}
+	if err == nil {
+		return nil
+	}
+
+	if line == 0 {
+		if match := errorLineRegexp.FindStringSubmatch(err.Error()); match != nil {
+			line, _ = strconv.Atoi(match[1])
+		}
+	}
+	return &SyntaxError{Format: strings.ToLower(format), Line: line, Err: err}
+}
+
+// validateProperties java properties 文件，每行为 key=value、key: value 或 key value，
+// 行尾的 \ 表示续行，# 及 ! 开头的行为注释，返回出错的行号
+func validateProperties(content string) (int, error) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), len(content)+1)
+	continued := false
+	for no := 1; scanner.Scan(); no++ {
+		line := strings.TrimLeft(scanner.Text(), " \t\f")
+		if !continued && (line == "" || line[0] == '#' || line[0] == '!') {
+			continue
+		}
+		if !continued && (line[0] == '=' || line[0] == ':') {
+			return no, errors.New("missing key")
+		}
+		if err := validateEscapes(line); err != nil {
+			return no, err
+		}
+		// 行尾奇数个 \ 时续行
+		trimmed := strings.TrimRight(line, `\`)
+		continued = (len(line)-len(trimmed))%2 == 1
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// validateEscapes \u 后需要 4 位十六进制数
+func validateEscapes(line string) error {
+	for i := 0; i < len(line); i++ {
+		if line[i] != '\\' || i+1 >= len(line) {
+			continue
+		}
+		i++
+		if line[i] != 'u' {
+			continue
+		}
+		if len(line)-i-1 < 4 {
+			return errors.New("malformed \\uxxxx encoding")
+		}
+		if _, err := strconv.ParseUint(line[i+1:i+5], 16, 16); err != nil {
+			return errors.New("malformed \\uxxxx encoding")
+		}
+		i += 4
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateContent(t *testing.T) {
+	cases := []struct {
+		format  string
+		content string
+		line    int // 0 为合法的内容
+	}{
+		{"toml", "[server]\nport = 9091\n", 0},
+		{"toml", "[server]\nport = 9091\nhost = \n", 3},
+		{"yaml", "server:\n  port: 9091\n", 0},
+		{"yaml", "server:\n\tport: 9091\n", 2},
+		{"json", "{\n\"port\": 9091\n}", 0},
+		{"json", "{\n\"port\": 9091,\n}", 3},
+		{"ini", "[server]\nport = 9091\n", 0},
+		{"properties", "# comment\nserver.port=9091\nserver.name = a \\\n  b\n", 0},
+		{"properties", "server.port=9091\nname=\\u00zz\n", 2},
+		{"properties", "server.port=9091\n=9092\n", 2},
+		// 未知的格式不检查
+		{"xml", "<server", 0},
+	}
+	for _, c := range cases {
+		err := validateContent(c.format, c.content)
+		if c.line == 0 {
+			assert.NoError(t, err, c.content)
+			continue
+		}
+		var syntaxErr *SyntaxError
+		if assert.True(t, errors.As(err, &syntaxErr), c.content) {
+			assert.Equal(t, c.line, syntaxErr.Line, syntaxErr.Error())
+		}
+	}
+}
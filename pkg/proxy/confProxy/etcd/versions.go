@@ -0,0 +1,86 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"sync"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+)
+
+// configVersions 应用各配置文件最新写入的版本，版本变化时唤醒等待中的长轮询
+type configVersions struct {
+	mu      sync.Mutex
+	nodes   map[string]*structs.ConfNode
+	changed map[string]chan struct{} // 版本变化时关闭，等待的请求随之返回
+}
+
+func newConfigVersions() *configVersions {
+	return &configVersions{
+		nodes:   make(map[string]*structs.ConfNode),
+		changed: make(map[string]chan struct{}),
+	}
+}
+
+func versionKey(app, file string) string {
+	return app + "/" + file
+}
+
+// store 记录写入成功的配置，版本未变时不唤醒
+func (v *configVersions) store(node *structs.ConfNode) {
+	key := versionKey(node.AppName, node.FileName)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if prev, ok := v.nodes[key]; ok && prev.Configuration.Metadata.Version == node.Configuration.Metadata.Version {
+		return
+	}
+	v.nodes[key] = node
+	if ch, ok := v.changed[key]; ok {
+		close(ch)
+		delete(v.changed, key)
+	}
+}
+
+// wait 当前版本与 version 不同时立即返回，否则等待新的版本写入或 ctx 结束，ctx 结束时返回 ctx 的错误
+// 应用还没有写入过配置时等待第一个版本
+func (v *configVersions) wait(ctx context.Context, app, file, version string) (*structs.ConfNode, error) {
+	key := versionKey(app, file)
+	for {
+		v.mu.Lock()
+		node, ok := v.nodes[key]
+		if ok && node.Configuration.Metadata.Version != version {
+			v.mu.Unlock()
+			return node, nil
+		}
+		ch, ok := v.changed[key]
+		if !ok {
+			ch = make(chan struct{})
+			v.changed[key] = ch
+		}
+		v.mu.Unlock()
+
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// WatchVersion 长轮询应用配置文件的版本，版本与 version 不同时返回最新的配置
+func (d *DataSource) WatchVersion(ctx context.Context, app, file, version string) (*structs.ConfNode, error) {
+	return d.versions.wait(ctx, app, file, version)
+}
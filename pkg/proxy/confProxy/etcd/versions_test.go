@@ -0,0 +1,62 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigVersionsWait(t *testing.T) {
+	versions := newConfigVersions()
+	node := func(version string) *structs.ConfNode {
+		return &structs.ConfNode{
+			AppName:       "app",
+			FileName:      "config.toml",
+			Configuration: &structs.AppConfiguration{Content: version, Metadata: structs.Metadata{Version: version}},
+		}
+	}
+
+	// 还没有写入过配置时等待
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	_, err := versions.wait(ctx, "app", "config.toml", "")
+	cancel()
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	versions.store(node("v1"))
+	got, err := versions.wait(context.Background(), "app", "config.toml", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", got.Configuration.Metadata.Version)
+
+	// 已是最新版本时等待新的版本写入
+	done := make(chan *structs.ConfNode)
+	go func() {
+		got, _ := versions.wait(context.Background(), "app", "config.toml", "v1")
+		done <- got
+	}()
+	time.Sleep(10 * time.Millisecond)
+	versions.store(node("v1"))
+	versions.store(node("v2"))
+	select {
+	case got := <-done:
+		assert.Equal(t, "v2", got.Configuration.Metadata.Version)
+	case <-time.After(time.Second):
+		t.Fatal("wait is not woken up by the new version")
+	}
+}
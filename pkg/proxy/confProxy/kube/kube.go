@@ -0,0 +1,201 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+)
+
+const (
+	// KindConfigMap 配置写入 ConfigMap
+	KindConfigMap = "configmap"
+	// KindSecret 配置写入 Secret
+	KindSecret = "secret"
+
+	// 集群内 pod 的 service account
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	managedBy         = "juno-agent"
+)
+
+// Config 将配置写入 kubernetes 的 ConfigMap 或 Secret，代替写入文件
+type Config struct {
+	Enable    bool
+	Addr      string        `json:"addr"`      // api server 地址，为空时使用集群内的 KUBERNETES_SERVICE_HOST
+	Namespace string        `json:"namespace"` // 为空时使用 service account 所在的 namespace
+	Kind      string        `json:"kind"`      // configmap 或 secret，加密下发的配置总是写入 secret
+	Name      string        `json:"name"`      // 对象名称，{app} 替换为应用名称
+	TokenFile string        `json:"tokenFile"` // 为空时使用 service account 的 token
+	CAFile    string        `json:"caFile"`    // 为空时使用 service account 的 ca
+	Timeout   time.Duration `json:"timeout"`
+}
+
+// Target 每个应用一个对象，配置文件名为其中的 key，只修改下发的 key，对象不存在时创建
+type Target struct {
+	config *Config
+	client *http.Client
+}
+
+// New 读取 service account 的 ca，token 在每次请求时读取，轮换后的 token 随之生效
+func New(config *Config) (*Target, error) {
+	c := *config
+	if c.Addr == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("kubernetes addr is required outside of a cluster")
+		}
+		c.Addr = "https://" + net.JoinHostPort(host, port)
+	}
+	if c.TokenFile == "" {
+		c.TokenFile = serviceAccountDir + "/token"
+	}
+	if c.Namespace == "" {
+		namespace, err := ioutil.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes namespace is required: %w", err)
+		}
+		c.Namespace = strings.TrimSpace(string(namespace))
+	}
+	if c.Kind != KindConfigMap && c.Kind != KindSecret {
+		return nil, fmt.Errorf("unknown kubernetes kind: %s", c.Kind)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if strings.HasPrefix(c.Addr, "https://") {
+		caFile := c.CAFile
+		if caFile == "" {
+			caFile = serviceAccountDir + "/ca.crt"
+		}
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &Target{
+		config: &c,
+		client: &http.Client{Timeout: c.Timeout, Transport: transport},
+	}, nil
+}
+
+// Apply 将配置写入应用对应的对象，secret 为 true 时写入 Secret
+func (t *Target) Apply(node *structs.ConfNode, content []byte, secret bool) error {
+	kind := t.config.Kind
+	if secret {
+		kind = KindSecret
+	}
+	name := ObjectName(t.config.Name, node.AppName)
+
+	data := map[string]string{node.FileName: string(content)}
+	if kind == KindSecret {
+		data[node.FileName] = base64.StdEncoding.EncodeToString(content)
+	}
+	object := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": t.config.Namespace,
+			"labels":    map[string]string{"app.kubernetes.io/managed-by": managedBy},
+			"annotations": map[string]string{
+				managedBy + "/version." + node.FileName: node.Configuration.Metadata.Version,
+			},
+		},
+		"data": data,
+	}
+
+	resource := "configmaps"
+	if kind == KindSecret {
+		resource = "secrets"
+	}
+	collection := fmt.Sprintf("/api/v1/namespaces/%s/%s", t.config.Namespace, resource)
+	// 合并修改，对象中其他配置文件的 key 保持不变
+	status, err := t.do(http.MethodPatch, collection+"/"+name, "application/merge-patch+json", object)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound {
+		object["apiVersion"], object["kind"] = "v1", map[string]string{KindConfigMap: "ConfigMap", KindSecret: "Secret"}[kind]
+		if status, err = t.do(http.MethodPost, collection, "application/json", object); err != nil {
+			return err
+		}
+	}
+	if status != http.StatusOK && status != http.StatusCreated {
+		return fmt.Errorf("apply %s %s/%s: kubernetes responded %d", kind, t.config.Namespace, name, status)
+	}
+	return nil
+}
+
+func (t *Target) do(method, path, contentType string, object interface{}) (int, error) {
+	body, err := json.Marshal(object)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(t.config.Addr, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	if t.config.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), t.config.Timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	token, err := ioutil.ReadFile(t.config.TokenFile)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+var invalidNameRegexp = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// ObjectName 替换 {app} 并转为合法的对象名称，小写字母、数字、- 及 .
+func ObjectName(pattern, app string) string {
+	if pattern == "" {
+		pattern = "{app}"
+	}
+	name := strings.ReplaceAll(pattern, "{app}", app)
+	name = invalidNameRegexp.ReplaceAllString(strings.ToLower(name), "-")
+	return strings.Trim(name, "-.")
+}
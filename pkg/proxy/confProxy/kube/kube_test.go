@@ -0,0 +1,83 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		objects = make(map[string]map[string]interface{})
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var object map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&object))
+		switch r.Method {
+		case http.MethodPatch:
+			assert.Equal(t, "application/merge-patch+json", r.Header.Get("Content-Type"))
+			current, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			for k, v := range object["data"].(map[string]interface{}) {
+				current["data"].(map[string]interface{})[k] = v
+			}
+		case http.MethodPost:
+			name := object["metadata"].(map[string]interface{})["name"].(string)
+			objects[r.URL.Path+"/"+name] = object
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+
+	target, err := New(&Config{Addr: server.URL, Namespace: "default", Kind: KindConfigMap, Name: "{app}-config", TokenFile: "testdata/missing"})
+	assert.NoError(t, err)
+	node := func(file, version string) *structs.ConfNode {
+		return &structs.ConfNode{
+			AppName:       "Demo_App",
+			FileName:      file,
+			Configuration: &structs.AppConfiguration{Metadata: structs.Metadata{Version: version}},
+		}
+	}
+
+	// 对象不存在时创建，之后只合并下发的 key
+	assert.NoError(t, target.Apply(node("config.toml", "v1"), []byte("a = 1\n"), false))
+	assert.NoError(t, target.Apply(node("app.yaml", "v1"), []byte("b: 2\n"), false))
+	object := objects["/api/v1/namespaces/default/configmaps/demo-app-config"]
+	if assert.NotNil(t, object) {
+		assert.Equal(t, "ConfigMap", object["kind"])
+		assert.Equal(t, map[string]interface{}{"config.toml": "a = 1\n", "app.yaml": "b: 2\n"}, object["data"])
+	}
+
+	// 加密下发的配置写入 secret，内容 base64 编码
+	assert.NoError(t, target.Apply(node("secret.toml", "v1"), []byte("password = 1\n"), true))
+	object = objects["/api/v1/namespaces/default/secrets/demo-app-config"]
+	if assert.NotNil(t, object) {
+		assert.Equal(t, "Secret", object["kind"])
+		assert.Equal(t, map[string]interface{}{"secret.toml": "cGFzc3dvcmQgPSAxCg=="}, object["data"])
+	}
+}
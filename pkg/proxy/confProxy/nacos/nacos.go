@@ -0,0 +1,266 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nacos
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/source"
+)
+
+const (
+	// DefaultGroup 未指定 group 时使用的分组
+	DefaultGroup = "DEFAULT_GROUP"
+	// 长轮询时服务端挂起请求的时长
+	longPollingTimeout = 30 * time.Second
+)
+
+// Config nacos 数据源配置
+type Config struct {
+	Enable    bool
+	Addr      string        `json:"addr"`      // nacos 地址，如 http://127.0.0.1:8848
+	Namespace string        `json:"namespace"` // 命名空间 id，为空时使用 public
+	Username  string        `json:"username"`  // 开启鉴权时的用户名
+	Password  string        `json:"password"`
+	Timeout   time.Duration `json:"timeout"` // 拉取配置的超时时间
+	Files     []FileConfig  `json:"files"`
+}
+
+// FileConfig 需要拉取的配置
+type FileConfig struct {
+	App    string `json:"app"`
+	DataID string `json:"dataId"`
+	Group  string `json:"group"`  // 为空时使用 DEFAULT_GROUP
+	Path   string `json:"path"`   // 写入的本地路径，为空时写入配置目录下的 <app>/<dataId>
+	Format string `json:"format"` // 为空时按 dataId 的扩展名
+	// 内容为 go 模板，写入前用节点信息渲染
+	Template bool `json:"template"`
+}
+
+// Source 通过 nacos open api 拉取配置
+type Source struct {
+	config *Config
+	files  []source.File
+	client *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpire time.Time
+}
+
+// New 配置文件未指定路径时写入 dir 下
+func New(config *Config, dir string) (*Source, error) {
+	if config.Addr == "" {
+		return nil, errors.New("nacos addr is required")
+	}
+	s := &Source{
+		config: config,
+		client: &http.Client{},
+	}
+	for _, fc := range config.Files {
+		if fc.App == "" || fc.DataID == "" {
+			return nil, errors.New("nacos file requires app and dataId")
+		}
+		group := fc.Group
+		if group == "" {
+			group = DefaultGroup
+		}
+		format := fc.Format
+		if format == "" {
+			format = source.Format(fc.DataID)
+		}
+		s.files = append(s.files, source.File{
+			App:      fc.App,
+			Name:     fc.DataID,
+			Key:      group + "/" + fc.DataID,
+			Format:   format,
+			Path:     source.Path(dir, fc.App, fc.DataID, fc.Path),
+			Template: fc.Template,
+		})
+	}
+	return s, nil
+}
+
+// Name ...
+func (s *Source) Name() string {
+	return "nacos"
+}
+
+// Files ...
+func (s *Source) Files() []source.File {
+	return s.files
+}
+
+// Fetch ...
+func (s *Source) Fetch(ctx context.Context, file source.File) (*source.Content, error) {
+	group, dataID := splitKey(file.Key)
+	query := url.Values{"dataId": {dataID}, "group": {group}}
+	if s.config.Namespace != "" {
+		query.Set("tenant", s.config.Namespace)
+	}
+
+	if s.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.Timeout)
+		defer cancel()
+	}
+	body, err := s.do(ctx, http.MethodGet, "/nacos/v1/cs/configs", query, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", file.Key, err)
+	}
+	sum := md5.Sum(body)
+	return &source.Content{Content: string(body), Version: hex.EncodeToString(sum[:])}, nil
+}
+
+// Watch 内容的 md5 与 versions 不同的配置会立即返回，否则服务端挂起请求直到配置变化或超时
+func (s *Source) Watch(ctx context.Context, versions map[source.File]string) ([]source.File, error) {
+	var listening strings.Builder
+	for file, version := range versions {
+		group, dataID := splitKey(file.Key)
+		listening.WriteString(dataID + "\x02" + group + "\x02" + version)
+		if s.config.Namespace != "" {
+			listening.WriteString("\x02" + s.config.Namespace)
+		}
+		listening.WriteString("\x01")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, longPollingTimeout+10*time.Second)
+	defer cancel()
+	header := http.Header{"Long-Pulling-Timeout": {strconv.Itoa(int(longPollingTimeout / time.Millisecond))}}
+	body, err := s.do(ctx, http.MethodPost, "/nacos/v1/cs/configs/listener", url.Values{"Listening-Configs": {listening.String()}}, header)
+	if err != nil {
+		return nil, fmt.Errorf("listen configs: %w", err)
+	}
+
+	// 返回 dataId%02group%02tenant%01 形式的变化列表
+	changed, err := url.QueryUnescape(strings.TrimSpace(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	var files []source.File
+	for _, item := range strings.Split(changed, "\x01") {
+		parts := strings.Split(item, "\x02")
+		if len(parts) < 2 {
+			continue
+		}
+		for file := range versions {
+			if file.Key == parts[1]+"/"+parts[0] {
+				files = append(files, file)
+			}
+		}
+	}
+	return files, nil
+}
+
+// do GET 请求参数放在 query 中，POST 请求放在表单中
+func (s *Source) do(ctx context.Context, method, path string, params url.Values, header http.Header) ([]byte, error) {
+	token, err := s.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		params.Set("accessToken", token)
+	}
+
+	u := strings.TrimRight(s.config.Addr, "/") + path
+	var body io.Reader
+	if method == http.MethodGet {
+		u += "?" + params.Encode()
+	} else {
+		body = strings.NewReader(params.Encode())
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if method != http.MethodGet {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil, fmt.Errorf("nacos responded %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// accessToken 开启鉴权时登录获取 token，过期前重新登录
+func (s *Source) accessToken(ctx context.Context) (string, error) {
+	if s.config.Username == "" {
+		return "", nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.tokenExpire) {
+		return s.token, nil
+	}
+
+	form := url.Values{"username": {s.config.Username}, "password": {s.config.Password}}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(s.config.Addr, "/")+"/nacos/v1/auth/login", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("nacos login: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return "", fmt.Errorf("nacos login responded %s", resp.Status)
+	}
+
+	var login struct {
+		AccessToken string `json:"accessToken"`
+		TokenTTL    int64  `json:"tokenTtl"` // 秒
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+		return "", fmt.Errorf("nacos login: %w", err)
+	}
+	s.token = login.AccessToken
+	// 提前 10% 的时间刷新
+	s.tokenExpire = time.Now().Add(time.Duration(login.TokenTTL) * time.Second * 9 / 10)
+	return s.token, nil
+}
+
+// splitKey group 中不能包含 /，第一个 / 之后都是 dataId
+func splitKey(key string) (group, dataID string) {
+	i := strings.Index(key, "/")
+	return key[:i], key[i+1:]
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nacos
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/source"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSource(t *testing.T) {
+	var listening string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nacos/v1/auth/login":
+			w.Write([]byte(`{"accessToken":"token","tokenTtl":18000}`))
+		case "/nacos/v1/cs/configs":
+			if r.FormValue("accessToken") != "token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			assert.Equal(t, "app.yaml", r.FormValue("dataId"))
+			assert.Equal(t, "orders", r.FormValue("group"))
+			assert.Equal(t, "dev", r.FormValue("tenant"))
+			w.Write([]byte("port: 9091\n"))
+		case "/nacos/v1/cs/configs/listener":
+			assert.Equal(t, "30000", r.Header.Get("Long-Pulling-Timeout"))
+			listening = r.FormValue("Listening-Configs")
+			w.Write([]byte(url.QueryEscape("app.yaml\x02orders\x02dev\x01")))
+		}
+	}))
+	defer server.Close()
+
+	s, err := New(&Config{
+		Addr:      server.URL,
+		Namespace: "dev",
+		Username:  "nacos",
+		Files:     []FileConfig{{App: "orders", DataID: "app.yaml", Group: "orders"}},
+	}, "/tmp/juno-agent")
+	assert.NoError(t, err)
+	file := s.Files()[0]
+	assert.Equal(t, source.File{App: "orders", Name: "app.yaml", Key: "orders/app.yaml", Format: "yaml", Path: "/tmp/juno-agent/orders/app.yaml"}, file)
+
+	content, err := s.Fetch(context.Background(), file)
+	assert.NoError(t, err)
+	assert.Equal(t, "port: 9091\n", content.Content)
+	assert.Equal(t, "5e2f7123e425ef4b7b9a43fa17330d66", content.Version)
+
+	changed, err := s.Watch(context.Background(), map[source.File]string{file: content.Version})
+	assert.NoError(t, err)
+	assert.Equal(t, []source.File{file}, changed)
+	assert.Equal(t, "app.yaml\x02orders\x02"+content.Version+"\x02dev\x01", listening)
+}
@@ -18,7 +18,12 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/douyu/juno-agent/pkg/keyring"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/apollo"
 	"github.com/douyu/juno-agent/pkg/proxy/confProxy/etcd"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/kube"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/nacos"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/source"
 	"github.com/douyu/jupiter/pkg/conf"
 	"github.com/douyu/jupiter/pkg/flag"
 	"github.com/douyu/jupiter/pkg/util/xtime"
@@ -37,6 +42,16 @@ type Config struct {
 	Secure  bool
 	Enable  bool                    // 是否开启开插件
 	Mysql   ConfDataSourceMysql     `json:"mysql"`
+	History int                     `json:"history"` // 每个配置文件在 .history 目录下保留的历史版本数
+	Nacos   nacos.Config            `json:"nacos"`   // 同时从 nacos 拉取配置
+	Apollo  apollo.Config           `json:"apollo"`  // 同时从 apollo 拉取配置
+	Decrypt string                  `json:"decrypt"` // 加密下发的配置 file 解密后写入文件，api 文件中保留密文只由本地接口返回明文
+	Drift   etcd.DriftConfig        `json:"drift"`   // 定期检查写入的配置文件是否被修改
+	Kube    kube.Config             `json:"kube"`    // 配置写入 kubernetes 的 ConfigMap 或 Secret，不再写入文件
+	// 解密加密下发的配置，为空时拒绝加密的配置
+	Keyring *keyring.Keyring `json:"-"`
+	// 渲染配置模板的节点信息
+	Facts etcd.Facts `json:"-"`
 }
 
 // ConfDataSourceMysql mysql dataSource
@@ -79,6 +94,20 @@ func DefaultConfig() Config {
 		Dir:     DefaultConfDir,
 		Timeout: xtime.Duration("1s"),
 		Enable:  false,
+		History: etcd.DefaultHistory,
+		Decrypt: etcd.DecryptFile,
+		Nacos: nacos.Config{
+			Timeout: xtime.Duration("3s"),
+		},
+		Apollo: apollo.Config{
+			Cluster: apollo.DefaultCluster,
+			Timeout: xtime.Duration("3s"),
+		},
+		Kube: kube.Config{
+			Kind:    kube.KindConfigMap,
+			Name:    "{app}",
+			Timeout: xtime.Duration("3s"),
+		},
 		Mysql: ConfDataSourceMysql{
 			Enable: false,
 			Dsn:    "127.0.0.1:6379",
@@ -89,7 +118,47 @@ func DefaultConfig() Config {
 // Build  new the instance
 func (c *Config) Build() *ConfProxy {
 	if c.Enable {
-		return NewConfProxy(c.Enable, etcd.NewETCDDataSource(c.Prefix))
+		return NewConfProxy(c.Enable, etcd.NewETCDDataSource(c.Prefix, etcd.Options{
+			History: c.History,
+			Keyring: c.Keyring,
+			Decrypt: c.Decrypt,
+			Drift:   c.Drift,
+			Facts:   c.Facts,
+			Target:  c.target(),
+		}), c.sources()...)
 	}
 	return nil
 }
+
+// target 开启 kube 时配置写入 kubernetes，配置错误时仍写入文件
+func (c *Config) target() etcd.Target {
+	if !c.Kube.Enable {
+		return nil
+	}
+	target, err := kube.New(&c.Kube)
+	if err != nil {
+		xlog.Error("confProxy", xlog.String("target", "kube"), xlog.FieldErr(err))
+		return nil
+	}
+	return target
+}
+
+// sources 开启的其他配置中心，配置错误时不启动该数据源
+func (c *Config) sources() []source.ConfigSource {
+	var sources []source.ConfigSource
+	if c.Nacos.Enable {
+		if src, err := nacos.New(&c.Nacos, c.Dir); err != nil {
+			xlog.Error("confProxy", xlog.String("source", "nacos"), xlog.FieldErr(err))
+		} else {
+			sources = append(sources, src)
+		}
+	}
+	if c.Apollo.Enable {
+		if src, err := apollo.New(&c.Apollo, c.Dir); err != nil {
+			xlog.Error("confProxy", xlog.String("source", "apollo"), xlog.FieldErr(err))
+		} else {
+			sources = append(sources, src)
+		}
+	}
+	return sources
+}
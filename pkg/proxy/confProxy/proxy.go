@@ -15,11 +15,15 @@
 package confProxy
 
 import (
+	"context"
 	"errors"
 	"github.com/douyu/juno-agent/util"
 	"github.com/labstack/echo/v4"
+	"sync"
 	"time"
 
+	"github.com/douyu/juno-agent/pkg/logging"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/source"
 	"github.com/douyu/juno-agent/pkg/structs"
 	"github.com/douyu/jupiter/pkg/xlog"
 )
@@ -29,14 +33,19 @@ type ConfProxy struct {
 	enable     bool
 	dataSource DataSource
 	nodeInput  chan *structs.ConfNode
+	// config centers other than juno, files pulled from them are written through dataSource
+	sources []source.ConfigSource
+	cancel  context.CancelFunc
+	pullers sync.WaitGroup
 }
 
 // NewConfProxy new instance
-func NewConfProxy(enable bool, confClient DataSource) *ConfProxy {
+func NewConfProxy(enable bool, confClient DataSource, sources ...source.ConfigSource) *ConfProxy {
 	return &ConfProxy{
 		enable:     enable,
 		dataSource: confClient,
 		nodeInput:  make(chan *structs.ConfNode, 100),
+		sources:    sources,
 	}
 }
 
@@ -47,14 +56,28 @@ func (cp *ConfProxy) Start() {
 			select {
 			case cp.nodeInput <- node:
 			default:
-				xlog.Warn("ConfProxy.AppConfigScanner", xlog.String("nodeInput chan", "err"))
+				logging.Logger("proxy").Warn("ConfProxy.AppConfigScanner", xlog.String("nodeInput chan", "err"))
 			}
 		}
+
+		var ctx context.Context
+		ctx, cp.cancel = context.WithCancel(context.Background())
+		for _, src := range cp.sources {
+			cp.pullers.Add(1)
+			go func(src source.ConfigSource) {
+				defer cp.pullers.Done()
+				cp.pull(ctx, src)
+			}(src)
+		}
 	}
 }
 
 // Close ...
 func (cp *ConfProxy) Close() {
+	if cp.cancel != nil {
+		cp.cancel()
+		cp.pullers.Wait()
+	}
 	close(cp.nodeInput)
 }
 
@@ -149,6 +172,55 @@ func (cp *ConfProxy) ListenRawKeyAppConfig(ctx echo.Context, rawKey string, watc
 	}
 }
 
+// Explain returns where each section of the config file written to path comes from,
+// only the section containing line is returned if line is greater than 0
+func (cp *ConfProxy) Explain(path string, line int) (*structs.ConfExplanation, bool) {
+	explanation, ok := cp.dataSource.Explain(path)
+	if !ok || line <= 0 {
+		return explanation, ok
+	}
+
+	filtered := *explanation
+	filtered.Sections = nil
+	for _, section := range explanation.Sections {
+		if section.StartLine <= line && line <= section.EndLine {
+			filtered.Sections = append(filtered.Sections, section)
+		}
+	}
+	return &filtered, true
+}
+
+// History returns the versions of the config file saved before it was overwritten, newest first
+func (cp *ConfProxy) History(path string) ([]structs.ConfVersion, error) {
+	return cp.dataSource.History(path)
+}
+
+// Rollback restores the config file written to path to a saved version, the latest one if version is empty
+func (cp *ConfProxy) Rollback(path, version string) (string, error) {
+	return cp.dataSource.Rollback(path, version)
+}
+
+// Diff returns the unified diff between two saved versions of the app config file,
+// from defaults to the latest saved version and to defaults to the current content
+func (cp *ConfProxy) Diff(app, file, from, to string) (*structs.ConfDiff, error) {
+	return cp.dataSource.Diff(app, file, from, to)
+}
+
+// WatchConfig waits up to timeout for a version of the app config file other than version,
+// the latest one is returned at once if it already differs. ok is false when nothing changed before timeout
+func (cp *ConfProxy) WatchConfig(ctx context.Context, app, file, version string, timeout time.Duration) (node *structs.ConfNode, ok bool) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	node, err := cp.dataSource.WatchVersion(ctx, app, file, version)
+	return node, err == nil
+}
+
+// NextConfig waits until a version of the app config file other than version is written,
+// the latest one is returned at once if it already differs. ctx's error is returned when ctx is done
+func (cp *ConfProxy) NextConfig(ctx context.Context, app, file, version string) (*structs.ConfNode, error) {
+	return cp.dataSource.WatchVersion(ctx, app, file, version)
+}
+
 // Reload ...
 func (cp *ConfProxy) Reload() error {
 	return cp.dataSource.Reload()
@@ -159,7 +231,7 @@ func (cp *ConfProxy) extractConfNode(appName, appEnv string, ip string) {
 	select {
 	case cp.nodeInput <- &structs.ConfNode{AppName: appName, AppEnvi: appEnv, IP: ip}:
 	default:
-		xlog.Warn("extract conf node timeout",
+		logging.Logger("proxy").Warn("extract conf node timeout",
 			xlog.String("appName", appName),
 			xlog.String("appEnv", appEnv),
 			xlog.Any("chan size", len(cp.nodeInput)),
@@ -0,0 +1,99 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package confProxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/logging"
+	"github.com/douyu/juno-agent/pkg/proxy/confProxy/source"
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// pullRetryInterval waits before pulling again after a config center failed
+var pullRetryInterval = 5 * time.Second
+
+// pull writes every file of src onto disk, then keeps them up to date until ctx is done.
+// all files are fetched again after a failure, changes missed meanwhile are picked up that way
+func (cp *ConfProxy) pull(ctx context.Context, src source.ConfigSource) {
+	versions := make(map[source.File]string)
+	for _, file := range src.Files() {
+		versions[file] = ""
+	}
+
+	changed := src.Files()
+	for {
+		failed := false
+		for _, file := range changed {
+			if err := cp.pullFile(ctx, src, file, versions); err != nil {
+				failed = true
+				logging.Logger("proxy").Error("pull config", xlog.String("source", src.Name()), xlog.String("app", file.App), xlog.String("file", file.Name), xlog.FieldErr(err))
+			}
+		}
+
+		var err error
+		if !failed {
+			changed, err = src.Watch(ctx, versions)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if failed || err != nil {
+			if err != nil {
+				logging.Logger("proxy").Error("watch config", xlog.String("source", src.Name()), xlog.FieldErr(err))
+			}
+			select {
+			case <-time.After(pullRetryInterval):
+			case <-ctx.Done():
+				return
+			}
+			changed = src.Files()
+		}
+	}
+}
+
+// pullFile fetches file and writes it when its version differs from the one written
+func (cp *ConfProxy) pullFile(ctx context.Context, src source.ConfigSource, file source.File, versions map[source.File]string) error {
+	content, err := src.Fetch(ctx, file)
+	if err != nil {
+		return err
+	}
+	if content.Version == versions[file] {
+		return nil
+	}
+
+	node := &structs.ConfNode{
+		AppName:  file.App,
+		FileName: file.Name,
+		Configuration: &structs.AppConfiguration{
+			Content:  content.Content,
+			Metadata: structs.Metadata{Format: file.Format, Timestamp: time.Now().Unix(), Version: content.Version, FileName: file.Name, AppName: file.App, Template: file.Template},
+		},
+	}
+	if err := cp.dataSource.Write(node, []string{file.Path}); err != nil {
+		return err
+	}
+	versions[file] = content.Version
+	logging.Logger("proxy").Info("config pulled", xlog.String("source", src.Name()), xlog.String("app", file.App), xlog.String("file", file.Path), xlog.String("version", content.Version))
+
+	select {
+	case cp.nodeInput <- node:
+	default:
+		logging.Logger("proxy").Warn("config pulled, nodeInput chan is full", xlog.String("app", file.App), xlog.String("file", file.Name))
+	}
+	return nil
+}
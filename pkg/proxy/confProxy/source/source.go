@@ -0,0 +1,68 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigSource 除 juno 以外的配置中心，agent 从中拉取应用配置并按相同的目录约定写入文件
+type ConfigSource interface {
+	// Name 配置中心名称，如 nacos、apollo
+	Name() string
+	// Files 需要拉取的配置文件
+	Files() []File
+	// Fetch 拉取配置文件的最新内容
+	Fetch(ctx context.Context, file File) (*Content, error)
+	// Watch 长轮询，直到部分文件可能发生变化或 ctx 结束，返回可能变化的文件。
+	// versions 为各文件当前已写入的版本，还未写入的文件为空
+	Watch(ctx context.Context, versions map[File]string) ([]File, error)
+}
+
+// File 从配置中心拉取并写入本地的配置文件
+type File struct {
+	App    string // 应用名称
+	Name   string // 配置文件名称，如 config.toml
+	Key    string // 配置中心中的定位，nacos 为 group/dataId，apollo 为 namespace
+	Format string // 配置格式，写入前按格式检查内容
+	Path   string // 写入的本地路径
+	// 内容为 go 模板，写入前用节点信息渲染
+	Template bool
+}
+
+// Content 配置文件的内容
+type Content struct {
+	Content string
+	Version string // 配置中心中的版本，nacos 为内容的 md5，apollo 为 releaseKey
+}
+
+// Format 按文件扩展名返回配置格式，没有扩展名时为 properties
+func Format(name string) string {
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	if ext == "" {
+		return "properties"
+	}
+	return strings.ToLower(ext)
+}
+
+// Path 未指定路径时写入配置目录 dir 下的 <app>/<name>
+func Path(dir, app, name, path string) string {
+	if path != "" {
+		return path
+	}
+	return filepath.Join(dir, app, name)
+}
@@ -0,0 +1,215 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regProxy
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/logging"
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/registry"
+	"github.com/douyu/jupiter/pkg/xlog"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// bridge is a registration of a bridged app, kept alive in its registry
+// for as long as the etcd lease it was put with
+type bridge struct {
+	registry registry.Registry
+	instance *registry.Instance
+	lease    int64
+	stop     chan struct{}
+}
+
+// registryOf returns the registry the app of key is bridged to, nil for apps registered in etcd
+func (proxy *RegProxy) registryOf(key []byte) registry.Registry {
+	return proxy.registries[registry.App(string(key))]
+}
+
+// putBridged registers the instance in the registry instead of etcd.
+// Apps keep granting and refreshing leases through the proxy as usual,
+// the registration is removed once its lease expires
+func (proxy *RegProxy) putBridged(ctx context.Context, reg registry.Registry, in *pb.PutRequest) (*pb.PutResponse, error) {
+	ins, err := registry.NewInstance(string(in.GetKey()), in.GetValue())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := reg.Register(ctx, ins); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "register to %s: %v", reg.Name(), err)
+	}
+
+	b := &bridge{registry: reg, instance: ins, lease: in.GetLease(), stop: make(chan struct{})}
+	proxy.bridgesMu.Lock()
+	if prev, ok := proxy.bridges[ins.Key]; ok {
+		close(prev.stop)
+	}
+	proxy.bridges[ins.Key] = b
+	proxy.bridgesMu.Unlock()
+	go proxy.keepBridged(b)
+
+	return &pb.PutResponse{Header: &pb.ResponseHeader{}}, nil
+}
+
+// keepBridged sends heartbeats to the registry until the lease expires or the registration is replaced
+func (proxy *RegProxy) keepBridged(b *bridge) {
+	ticker := time.NewTicker(proxy.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), proxy.heartbeat)
+		proxy.bridgesMu.Lock()
+		ins := b.instance // replaced when the health of the instance changes
+		proxy.bridgesMu.Unlock()
+		if b.lease != 0 && !proxy.leaseAlive(ctx, b.lease) {
+			cancel()
+			if proxy.removeBridge(b) {
+				logging.Logger("proxy").Info("lease of bridged registration expired", xlog.String("key", ins.Key), xlog.String("registry", b.registry.Name()))
+			}
+			return
+		}
+		if err := b.registry.Heartbeat(ctx, ins); err != nil {
+			logging.Logger("proxy").Warn("heartbeat bridged registration", xlog.String("key", ins.Key), xlog.String("registry", b.registry.Name()), xlog.FieldErr(err))
+		}
+		cancel()
+	}
+}
+
+// leaseAlive an unreachable etcd keeps the registration, only an expired lease removes it
+func (proxy *RegProxy) leaseAlive(ctx context.Context, lease int64) bool {
+	resp, err := proxy.Client.TimeToLive(ctx, clientv3.LeaseID(lease))
+	if err != nil {
+		logging.Logger("proxy").Warn("lease ttl of bridged registration", xlog.Int64("lease", lease), xlog.FieldErr(err))
+		return true
+	}
+	return resp.TTL > 0
+}
+
+// removeBridge deregisters b unless it has been replaced or removed already
+func (proxy *RegProxy) removeBridge(b *bridge) bool {
+	proxy.bridgesMu.Lock()
+	if proxy.bridges[b.instance.Key] != b {
+		proxy.bridgesMu.Unlock()
+		return false
+	}
+	delete(proxy.bridges, b.instance.Key)
+	close(b.stop)
+	proxy.bridgesMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), proxy.heartbeat)
+	defer cancel()
+	// Deregister only needs the address, which never changes
+	if err := b.registry.Deregister(ctx, b.instance); err != nil {
+		logging.Logger("proxy").Error("deregister bridged registration", xlog.String("key", b.instance.Key), xlog.String("registry", b.registry.Name()), xlog.FieldErr(err))
+	}
+	return true
+}
+
+// removeBridges deregisters the bridged registrations in [key, rangeEnd)
+func (proxy *RegProxy) removeBridges(key, rangeEnd []byte) int64 {
+	var matched []*bridge
+	proxy.bridgesMu.Lock()
+	for k, b := range proxy.bridges {
+		if inRange([]byte(k), key, rangeEnd) {
+			matched = append(matched, b)
+		}
+	}
+	proxy.bridgesMu.Unlock()
+
+	var removed int64
+	for _, b := range matched {
+		if proxy.removeBridge(b) {
+			removed++
+		}
+	}
+	return removed
+}
+
+// rangeBridged adds the instances of bridged apps to the keys in etcd, in the same form apps registered them.
+// Watches are still served by etcd only, consumers of bridged apps see the instances on every range
+func (proxy *RegProxy) rangeBridged(ctx context.Context, in *pb.RangeRequest) (*pb.RangeResponse, error) {
+	out, err := proxy.KVServer.Range(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	reg := proxy.registryOf(in.GetKey())
+	if reg == nil {
+		return out, nil
+	}
+
+	instances, err := reg.Instances(ctx, registry.App(string(in.GetKey())))
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "discover from %s: %v", reg.Name(), err)
+	}
+	seen := make(map[string]bool, len(out.Kvs))
+	for _, kv := range out.Kvs {
+		seen[string(kv.Key)] = true
+	}
+	for _, ins := range instances {
+		key := []byte(ins.Key)
+		if seen[ins.Key] || !inRange(key, in.GetKey(), in.GetRangeEnd()) {
+			continue
+		}
+		out.Count++
+		if in.GetCountOnly() {
+			continue
+		}
+		kv := &mvccpb.KeyValue{Key: key}
+		if !in.GetKeysOnly() {
+			kv.Value = ins.Value
+		}
+		out.Kvs = append(out.Kvs, kv)
+	}
+	return out, nil
+}
+
+// DeleteRange deregisters the bridged registrations in the range as well,
+// and stops tracking the deleted ones in etcd
+func (proxy *RegProxy) DeleteRange(ctx context.Context, in *pb.DeleteRangeRequest) (*pb.DeleteRangeResponse, error) {
+	removed := proxy.removeBridges(in.GetKey(), in.GetRangeEnd())
+	proxy.registrations.Range(func(key, _ interface{}) bool {
+		if inRange([]byte(key.(string)), in.GetKey(), in.GetRangeEnd()) {
+			proxy.registrations.Delete(key)
+		}
+		return true
+	})
+	out, err := proxy.KVServer.DeleteRange(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	out.Deleted += removed
+	return out, nil
+}
+
+// inRange follows etcd: an empty rangeEnd is the key itself, "\x00" is every key from key on
+func inRange(k, key, rangeEnd []byte) bool {
+	switch {
+	case len(rangeEnd) == 0:
+		return bytes.Equal(k, key)
+	case bytes.Equal(rangeEnd, []byte{0}):
+		return bytes.Compare(k, key) >= 0
+	default:
+		return bytes.Compare(k, key) >= 0 && bytes.Compare(k, rangeEnd) < 0
+	}
+}
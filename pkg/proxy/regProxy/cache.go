@@ -0,0 +1,218 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regProxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/logging"
+	"github.com/douyu/jupiter/pkg/xlog"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Response header metadata of ranges served from the discovery cache
+const (
+	HeaderStale     = "juno-discovery-stale"      // "true" when etcd could not be reached
+	HeaderUpdatedAt = "juno-discovery-updated-at" // RFC3339 time the result was read from etcd
+	HeaderAge       = "juno-discovery-age"        // seconds since the result was read from etcd
+)
+
+var discoveryPrefix = []byte("/reg/")
+
+// CacheConfig caches discovery results so apps still get the last known endpoints while etcd is unreachable
+type CacheConfig struct {
+	Enable        bool
+	Path          string        // snapshot file, loaded on start so the cache survives agent restarts
+	TTL           time.Duration // results younger than ttl are served without reading etcd, 0 always reads etcd
+	Timeout       time.Duration // etcd read timeout before falling back to the cache
+	FlushInterval time.Duration // interval of writing the snapshot when the cache has changed
+}
+
+// cachedRange a discovery result as read from etcd
+type cachedRange struct {
+	Kvs       []*mvccpb.KeyValue `json:"kvs"`
+	Count     int64              `json:"count"`
+	More      bool               `json:"more"`
+	Revision  int64              `json:"revision"`
+	UpdatedAt time.Time          `json:"updatedAt"`
+}
+
+// discoveryCache results of discovery ranges, keyed by the range requested
+type discoveryCache struct {
+	config *CacheConfig
+
+	mu      sync.RWMutex
+	entries map[string]*cachedRange
+	dirty   bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newDiscoveryCache(config *CacheConfig) *discoveryCache {
+	c := &discoveryCache{
+		config:  config,
+		entries: make(map[string]*cachedRange),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := c.load(); err != nil && !os.IsNotExist(err) {
+		logging.Logger("proxy").Warn("load discovery cache", xlog.String("path", config.Path), xlog.FieldErr(err))
+	}
+	go c.flushLoop()
+	return c
+}
+
+// cacheable only discovery ranges at the latest revision are cached
+func cacheable(in *pb.RangeRequest) bool {
+	return bytes.HasPrefix(in.GetKey(), discoveryPrefix) && in.GetRevision() == 0
+}
+
+func cacheKey(in *pb.RangeRequest) string {
+	key, _ := json.Marshal([]interface{}{string(in.GetKey()), string(in.GetRangeEnd()), in.GetLimit(), in.GetKeysOnly(), in.GetCountOnly()})
+	return string(key)
+}
+
+func (c *discoveryCache) get(key string) (*cachedRange, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+func (c *discoveryCache) put(key string, out *pb.RangeResponse) {
+	entry := &cachedRange{Kvs: out.Kvs, Count: out.Count, More: out.More, UpdatedAt: time.Now()}
+	if out.Header != nil {
+		entry.Revision = out.Header.Revision
+	}
+	c.mu.Lock()
+	c.entries[key] = entry
+	c.dirty = true
+	c.mu.Unlock()
+}
+
+func (c *discoveryCache) load() error {
+	data, err := ioutil.ReadFile(c.config.Path)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return json.Unmarshal(data, &c.entries)
+}
+
+// flush writes the snapshot if the cache has changed since the last flush
+func (c *discoveryCache) flush() error {
+	c.mu.Lock()
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(c.entries)
+	c.dirty = false
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.config.Path), 0755); err != nil {
+		return err
+	}
+	tmp := c.config.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.config.Path)
+}
+
+func (c *discoveryCache) flushLoop() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+		if err := c.flush(); err != nil {
+			logging.Logger("proxy").Warn("flush discovery cache", xlog.String("path", c.config.Path), xlog.FieldErr(err))
+		}
+	}
+}
+
+// close stops the flush loop and writes the final snapshot
+func (c *discoveryCache) close() error {
+	close(c.stop)
+	<-c.done
+	return c.flush()
+}
+
+// response copies the entry, the cached kvs are shared and must not be modified
+func (entry *cachedRange) response() *pb.RangeResponse {
+	return &pb.RangeResponse{
+		Header: &pb.ResponseHeader{Revision: entry.Revision},
+		Kvs:    entry.Kvs,
+		Count:  entry.Count,
+		More:   entry.More,
+	}
+}
+
+func (entry *cachedRange) header(stale bool) metadata.MD {
+	return metadata.Pairs(
+		HeaderStale, strconv.FormatBool(stale),
+		HeaderUpdatedAt, entry.UpdatedAt.Format(time.RFC3339),
+		HeaderAge, strconv.FormatInt(int64(time.Since(entry.UpdatedAt)/time.Second), 10),
+	)
+}
+
+// Range reads discovery results through the cache: a failed etcd read is answered
+// with the last known result, marked stale in the response header
+func (proxy *RegProxy) Range(ctx context.Context, in *pb.RangeRequest) (*pb.RangeResponse, error) {
+	if proxy.cache == nil || !cacheable(in) {
+		return proxy.rangeBridged(ctx, in)
+	}
+	key := cacheKey(in)
+	entry, cached := proxy.cache.get(key)
+	if cached && time.Since(entry.UpdatedAt) < proxy.cache.config.TTL {
+		_ = grpc.SetHeader(ctx, entry.header(false))
+		return entry.response(), nil
+	}
+
+	readCtx, cancel := context.WithTimeout(ctx, proxy.cache.config.Timeout)
+	out, err := proxy.rangeBridged(readCtx, in)
+	cancel()
+	if err == nil {
+		proxy.cache.put(key, out)
+		return out, nil
+	}
+	// the app has given up, there is no one to answer
+	if !cached || ctx.Err() != nil {
+		return nil, err
+	}
+	logging.Logger("proxy").Warn("serve stale discovery result", xlog.String("key", string(in.GetKey())), xlog.String("updatedAt", entry.UpdatedAt.Format(time.RFC3339)), xlog.FieldErr(err))
+	_ = grpc.SetHeader(ctx, entry.header(true))
+	return entry.response(), nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regProxy
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+type flakyKV struct {
+	pb.KVServer
+	err error
+}
+
+func (kv *flakyKV) Range(ctx context.Context, in *pb.RangeRequest) (*pb.RangeResponse, error) {
+	if kv.err != nil {
+		return nil, kv.err
+	}
+	return &pb.RangeResponse{
+		Header: &pb.ResponseHeader{Revision: 7},
+		Kvs:    []*mvccpb.KeyValue{{Key: []byte("/reg/user-svc/providers/grpc://10.0.0.1:9091"), Value: []byte("{}")}},
+		Count:  1,
+	}, nil
+}
+
+func TestDiscoveryCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config := &CacheConfig{Path: filepath.Join(dir, "discovery.json"), Timeout: time.Second, FlushInterval: time.Hour}
+	kv := &flakyKV{}
+	proxy := &RegProxy{KVServer: kv, cache: newDiscoveryCache(config)}
+	in := &pb.RangeRequest{Key: []byte("/reg/user-svc/"), RangeEnd: []byte("/reg/user-svc0")}
+
+	// etcd 不可用且没有缓存时返回错误
+	kv.err = errors.New("etcd unavailable")
+	_, err = proxy.Range(context.Background(), in)
+	assert.Error(t, err)
+
+	kv.err = nil
+	out, err := proxy.Range(context.Background(), in)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), out.Count)
+
+	// etcd 不可用时返回最近一次的结果
+	kv.err = errors.New("etcd unavailable")
+	out, err = proxy.Range(context.Background(), in)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(7), out.Header.Revision)
+		assert.Len(t, out.Kvs, 1)
+	}
+	// 不是服务发现的 key 不缓存
+	_, err = proxy.Range(context.Background(), &pb.RangeRequest{Key: []byte("/prometheus/job")})
+	assert.Error(t, err)
+
+	// 重启后从快照恢复
+	assert.NoError(t, proxy.cache.close())
+	proxy = &RegProxy{KVServer: kv, cache: newDiscoveryCache(config)}
+	out, err = proxy.Range(context.Background(), in)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/reg/user-svc/providers/grpc://10.0.0.1:9091", string(out.Kvs[0].Key))
+	}
+	assert.NoError(t, proxy.cache.close())
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consul
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/registry"
+	"github.com/hashicorp/consul/api"
+)
+
+const (
+	// consul 限制元数据的值不超过 512 个字符，注册信息分段保存
+	metaValueMaxLength = 512
+	metaRegInfo        = "regInfo"
+	metaScheme         = "scheme"
+)
+
+// Config consul 注册中心配置
+type Config struct {
+	Enable     bool
+	Address    string        `json:"address"` // consul agent 地址，为空时使用 CONSUL_HTTP_ADDR 或 127.0.0.1:8500
+	Scheme     string        `json:"scheme"`
+	Datacenter string        `json:"datacenter"`
+	Token      string        `json:"token"`
+	TTL        time.Duration `json:"ttl"`      // 实例 ttl 检查的时长，超过 ttl 未收到心跳时不健康，4 倍 ttl 后注销
+	Services   []string      `json:"services"` // 经由 consul 注册发现的应用
+}
+
+// Registry 实例注册到本机的 consul agent，使用 ttl 检查
+type Registry struct {
+	config *Config
+	agent  *api.Agent
+	health *api.Health
+}
+
+// New ...
+func New(config *Config) (*Registry, error) {
+	apiConfig := api.DefaultConfig()
+	if config.Address != "" {
+		apiConfig.Address = config.Address
+	}
+	if config.Scheme != "" {
+		apiConfig.Scheme = config.Scheme
+	}
+	apiConfig.Datacenter = config.Datacenter
+	apiConfig.Token = config.Token
+
+	client, err := api.NewClient(apiConfig)
+	if err != nil {
+		return nil, err
+	}
+	c := *config
+	if c.TTL < time.Second {
+		c.TTL = 15 * time.Second
+	}
+	return &Registry{config: &c, agent: client.Agent(), health: client.Health()}, nil
+}
+
+// Name ...
+func (r *Registry) Name() string {
+	return "consul"
+}
+
+// Register ...
+func (r *Registry) Register(ctx context.Context, ins *registry.Instance) error {
+	meta := map[string]string{metaScheme: ins.Scheme}
+	value := string(ins.Value)
+	for i := 0; len(value) > 0; i++ {
+		n := len(value)
+		if n > metaValueMaxLength {
+			// 不在多字节字符中间截断
+			for n = metaValueMaxLength; !utf8.RuneStart(value[n]); n-- {
+			}
+		}
+		meta[metaRegInfo+strconv.Itoa(i)] = value[:n]
+		value = value[n:]
+	}
+	return r.agent.ServiceRegister(&api.AgentServiceRegistration{
+		ID:      ins.ID(),
+		Name:    ins.App,
+		Address: ins.IP,
+		Port:    ins.Port,
+		Meta:    meta,
+		Check: &api.AgentServiceCheck{
+			CheckID:                        checkID(ins),
+			TTL:                            r.config.TTL.String(),
+			Status:                         api.HealthPassing,
+			DeregisterCriticalServiceAfter: (4 * r.config.TTL).String(),
+		},
+	})
+}
+
+// Heartbeat consul agent 重启后检查不存在，重新注册
+func (r *Registry) Heartbeat(ctx context.Context, ins *registry.Instance) error {
+	if err := r.agent.UpdateTTL(checkID(ins), "", api.HealthPassing); err != nil {
+		return r.Register(ctx, ins)
+	}
+	return nil
+}
+
+// Deregister ...
+func (r *Registry) Deregister(ctx context.Context, ins *registry.Instance) error {
+	return r.agent.ServiceDeregister(ins.ID())
+}
+
+// Instances ...
+func (r *Registry) Instances(ctx context.Context, app string) ([]*registry.Instance, error) {
+	entries, _, err := r.health.Service(app, "", true, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]*registry.Instance, 0, len(entries))
+	for _, entry := range entries {
+		address := entry.Service.Address
+		if address == "" {
+			address = entry.Node.Address
+		}
+		scheme := entry.Service.Meta[metaScheme]
+		if scheme == "" {
+			scheme = "grpc"
+		}
+		instances = append(instances, &registry.Instance{
+			Key:    registry.Key(app, scheme, address, entry.Service.Port),
+			Value:  []byte(regInfo(entry.Service.Meta)),
+			App:    app,
+			Scheme: scheme,
+			IP:     address,
+			Port:   entry.Service.Port,
+		})
+	}
+	return instances, nil
+}
+
+func checkID(ins *registry.Instance) string {
+	return "service:" + ins.ID()
+}
+
+// regInfo 拼接分段保存的注册信息
+func regInfo(meta map[string]string) string {
+	var b strings.Builder
+	for i := 0; ; i++ {
+		part, ok := meta[metaRegInfo+strconv.Itoa(i)]
+		if !ok {
+			return b.String()
+		}
+		b.WriteString(part)
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/logging"
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/registry"
+	"github.com/douyu/jupiter/pkg/xlog"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// udp 响应不超过 512 字节，超过时设置 TC 由客户端改用 tcp 重试
+	maxUDPSize = 512
+	maxTCPSize = 65535
+)
+
+// Config dns 服务配置，未使用 sdk 的应用在 resolv.conf 中指向 agent 即可发现服务
+type Config struct {
+	Enable    bool
+	Addr      string        `json:"addr"`      // 同时监听 udp 及 tcp
+	Domain    string        `json:"domain"`    // 服务域名的后缀，<service>.service.<domain>
+	TTL       time.Duration `json:"ttl"`       // 响应中记录的 ttl
+	Upstreams []string      `json:"upstreams"` // 其他域名转发的上游 dns，为空时拒绝
+	Timeout   time.Duration `json:"timeout"`   // 发现服务及转发的超时时间
+}
+
+// Server 应答 A、AAAA 及 SRV 查询：
+//
+//	<service>.service.<domain>                 A/AAAA 为实例的 ip，SRV 为全部实例
+//	_<scheme>._tcp.<service>.service.<domain>  SRV 为该协议的实例
+//	<hex ip>.addr.<domain>                     SRV 记录的 target
+type Server struct {
+	config   *Config
+	resolver registry.Resolver
+	suffix   string // .<domain>.
+
+	udp net.PacketConn
+	tcp net.Listener
+	wg  sync.WaitGroup
+}
+
+// New ...
+func New(config *Config, resolver registry.Resolver) *Server {
+	return &Server{
+		config:   config,
+		resolver: resolver,
+		suffix:   "." + strings.Trim(strings.ToLower(config.Domain), ".") + ".",
+	}
+}
+
+// Start 监听 udp 及 tcp
+func (s *Server) Start() error {
+	udp, err := net.ListenPacket("udp", s.config.Addr)
+	if err != nil {
+		return err
+	}
+	tcp, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		udp.Close()
+		return err
+	}
+	s.udp, s.tcp = udp, tcp
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+	return nil
+}
+
+// Close ...
+func (s *Server) Close() error {
+	if s.udp == nil {
+		return nil
+	}
+	s.udp.Close()
+	s.tcp.Close()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+	buf := make([]byte, maxTCPSize)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			if resp := s.handle(query, maxUDPSize); resp != nil {
+				_, _ = s.udp.WriteTo(resp, addr)
+			}
+		}()
+	}
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn tcp 消息前有 2 字节的长度
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return
+		}
+		query := make([]byte, length)
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		resp := s.handle(query, maxTCPSize)
+		if resp == nil {
+			return
+		}
+		if err := binary.Write(conn, binary.BigEndian, uint16(len(resp))); err != nil {
+			return
+		}
+		if _, err := conn.Write(resp); err != nil {
+			return
+		}
+	}
+}
+
+// handle 返回 nil 时不响应
+func (s *Server) handle(query []byte, maxSize int) []byte {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil || msg.Header.Response {
+		return nil
+	}
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               msg.Header.ID,
+			Response:         true,
+			OpCode:           msg.Header.OpCode,
+			RecursionDesired: msg.Header.RecursionDesired,
+		},
+		Questions: msg.Questions,
+	}
+	if len(msg.Questions) != 1 {
+		resp.Header.RCode = dnsmessage.RCodeFormatError
+		return s.pack(&resp, maxSize)
+	}
+
+	q := msg.Questions[0]
+	name := strings.ToLower(q.Name.String())
+	if !strings.HasSuffix(name, s.suffix) {
+		return s.forward(query, &resp, maxSize)
+	}
+	resp.Header.Authoritative = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+	if err := s.answer(ctx, q, strings.TrimSuffix(name, s.suffix), &resp); err != nil {
+		logging.Logger("proxy").Warn("dns answer", xlog.String("name", name), xlog.FieldErr(err))
+		resp.Header.RCode = dnsmessage.RCodeServerFailure
+		resp.Answers, resp.Additionals = nil, nil
+	}
+	return s.pack(&resp, maxSize)
+}
+
+var errNameNotFound = errors.New("name not found")
+
+func (s *Server) answer(ctx context.Context, q dnsmessage.Question, name string, resp *dnsmessage.Message) error {
+	labels := strings.Split(name, ".")
+	switch {
+	case len(labels) == 2 && labels[1] == "addr":
+		ip, err := hex.DecodeString(labels[0])
+		if err != nil || (len(ip) != net.IPv4len && len(ip) != net.IPv6len) {
+			resp.Header.RCode = dnsmessage.RCodeNameError
+			return nil
+		}
+		resp.Answers = s.addressRecords(q.Name, q.Type, []net.IP{ip})
+		return nil
+	case len(labels) == 2 && labels[1] == "service":
+		return s.answerService(ctx, q, labels[0], "", resp)
+	case len(labels) == 4 && labels[3] == "service" && labels[1] == "_tcp" && strings.HasPrefix(labels[0], "_"):
+		if q.Type != dnsmessage.TypeSRV {
+			return nil
+		}
+		return s.answerService(ctx, q, labels[2], labels[0][1:], resp)
+	}
+	resp.Header.RCode = dnsmessage.RCodeNameError
+	return nil
+}
+
+// answerService 服务没有实例时为 NXDOMAIN
+func (s *Server) answerService(ctx context.Context, q dnsmessage.Question, service, scheme string, resp *dnsmessage.Message) error {
+	endpoints, err := s.resolver.Resolve(ctx, service)
+	if err != nil {
+		return err
+	}
+	if scheme != "" {
+		filtered := endpoints[:0]
+		for _, endpoint := range endpoints {
+			if endpoint.Scheme == scheme {
+				filtered = append(filtered, endpoint)
+			}
+		}
+		endpoints = filtered
+	}
+	if len(endpoints) == 0 {
+		resp.Header.RCode = dnsmessage.RCodeNameError
+		return nil
+	}
+
+	if q.Type != dnsmessage.TypeSRV {
+		var ips []net.IP
+		seen := make(map[string]bool)
+		for _, endpoint := range endpoints {
+			if !seen[endpoint.IP.String()] {
+				seen[endpoint.IP.String()] = true
+				ips = append(ips, endpoint.IP)
+			}
+		}
+		resp.Answers = s.addressRecords(q.Name, q.Type, ips)
+		return nil
+	}
+
+	for _, endpoint := range endpoints {
+		target, err := dnsmessage.NewName(addrName(endpoint.IP) + s.suffix)
+		if err != nil {
+			return err
+		}
+		resp.Answers = append(resp.Answers, dnsmessage.Resource{
+			Header: s.header(q.Name, dnsmessage.TypeSRV),
+			Body:   &dnsmessage.SRVResource{Priority: 1, Weight: 1, Port: uint16(endpoint.Port), Target: target},
+		})
+		resp.Additionals = append(resp.Additionals, s.addressRecords(target, 0, []net.IP{endpoint.IP})...)
+	}
+	return nil
+}
+
+// addressRecords typ 为 0 时 ipv4 返回 A，ipv6 返回 AAAA
+func (s *Server) addressRecords(name dnsmessage.Name, typ dnsmessage.Type, ips []net.IP) []dnsmessage.Resource {
+	var records []dnsmessage.Resource
+	for _, ip := range ips {
+		if v4 := ip.To4(); v4 != nil {
+			if typ == 0 || typ == dnsmessage.TypeA {
+				var a dnsmessage.AResource
+				copy(a.A[:], v4)
+				records = append(records, dnsmessage.Resource{Header: s.header(name, dnsmessage.TypeA), Body: &a})
+			}
+		} else if typ == 0 || typ == dnsmessage.TypeAAAA {
+			var aaaa dnsmessage.AAAAResource
+			copy(aaaa.AAAA[:], ip.To16())
+			records = append(records, dnsmessage.Resource{Header: s.header(name, dnsmessage.TypeAAAA), Body: &aaaa})
+		}
+	}
+	return records
+}
+
+func (s *Server) header(name dnsmessage.Name, typ dnsmessage.Type) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{Name: name, Type: typ, Class: dnsmessage.ClassINET, TTL: uint32(s.config.TTL / time.Second)}
+}
+
+// addrName SRV 的 target，ip 的十六进制
+func addrName(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return hex.EncodeToString(ip) + ".addr"
+}
+
+// forward 其他域名转发给上游，依次尝试
+func (s *Server) forward(query []byte, resp *dnsmessage.Message, maxSize int) []byte {
+	buf := make([]byte, maxTCPSize)
+	for _, upstream := range s.config.Upstreams {
+		conn, err := net.DialTimeout("udp", upstream, s.config.Timeout)
+		if err != nil {
+			continue
+		}
+		_ = conn.SetDeadline(time.Now().Add(s.config.Timeout))
+		_, err = conn.Write(query)
+		if err == nil {
+			var n int
+			if n, err = conn.Read(buf); err == nil {
+				conn.Close()
+				return buf[:n]
+			}
+		}
+		conn.Close()
+		logging.Logger("proxy").Warn("dns forward", xlog.String("upstream", upstream), xlog.FieldErr(err))
+	}
+	if len(s.config.Upstreams) == 0 {
+		resp.Header.RCode = dnsmessage.RCodeRefused
+	} else {
+		resp.Header.RCode = dnsmessage.RCodeServerFailure
+	}
+	return s.pack(resp, maxSize)
+}
+
+// pack 超过 maxSize 时只保留问题并设置 TC
+func (s *Server) pack(resp *dnsmessage.Message, maxSize int) []byte {
+	packed, err := resp.Pack()
+	if err == nil && len(packed) <= maxSize {
+		return packed
+	}
+	resp.Header.Truncated = err == nil
+	if err != nil {
+		resp.Header.RCode = dnsmessage.RCodeServerFailure
+	}
+	resp.Answers, resp.Additionals = nil, nil
+	packed, _ = resp.Pack()
+	return packed
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/registry"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type staticResolver map[string][]registry.Endpoint
+
+func (r staticResolver) Resolve(ctx context.Context, service string) ([]registry.Endpoint, error) {
+	return r[service], nil
+}
+
+func query(t *testing.T, s *Server, name string, typ dnsmessage.Type) *dnsmessage.Message {
+	q := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: 1, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(name), Type: typ, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := q.Pack()
+	assert.NoError(t, err)
+	var resp dnsmessage.Message
+	assert.NoError(t, resp.Unpack(s.handle(packed, maxUDPSize)))
+	assert.Equal(t, uint16(1), resp.Header.ID)
+	return &resp
+}
+
+func TestServer(t *testing.T) {
+	s := New(&Config{Domain: "juno", TTL: 5 * time.Second, Timeout: time.Second}, staticResolver{
+		"user-svc": {
+			{Scheme: "grpc", IP: net.ParseIP("10.0.0.1"), Port: 9091},
+			{Scheme: "http", IP: net.ParseIP("10.0.0.1"), Port: 9090},
+			{Scheme: "grpc", IP: net.ParseIP("10.0.0.2"), Port: 9091},
+		},
+	})
+
+	// 同一 ip 的多个实例只返回一条 A 记录
+	resp := query(t, s, "User-Svc.service.juno.", dnsmessage.TypeA)
+	if assert.Len(t, resp.Answers, 2) {
+		assert.Equal(t, [4]byte{10, 0, 0, 1}, resp.Answers[0].Body.(*dnsmessage.AResource).A)
+		assert.Equal(t, uint32(5), resp.Answers[0].Header.TTL)
+	}
+
+	resp = query(t, s, "_grpc._tcp.user-svc.service.juno.", dnsmessage.TypeSRV)
+	if assert.Len(t, resp.Answers, 2) && assert.Len(t, resp.Additionals, 2) {
+		srv := resp.Answers[0].Body.(*dnsmessage.SRVResource)
+		assert.Equal(t, uint16(9091), srv.Port)
+		assert.Equal(t, "0a000001.addr.juno.", srv.Target.String())
+	}
+	// SRV 的 target 可以解析
+	resp = query(t, s, "0a000001.addr.juno.", dnsmessage.TypeA)
+	assert.Len(t, resp.Answers, 1)
+
+	resp = query(t, s, "order-svc.service.juno.", dnsmessage.TypeA)
+	assert.Equal(t, dnsmessage.RCodeNameError, resp.Header.RCode)
+	// 没有上游时拒绝其他域名
+	resp = query(t, s, "example.com.", dnsmessage.TypeA)
+	assert.Equal(t, dnsmessage.RCodeRefused, resp.Header.RCode)
+}
@@ -18,8 +18,8 @@ import (
 	"container/list"
 	"errors"
 
+	"github.com/douyu/juno-agent/pkg/etcdv3"
 	"github.com/douyu/juno-agent/pkg/structs"
-	"github.com/douyu/jupiter/pkg/client/etcdv3"
 	"github.com/douyu/jupiter/pkg/util/xgo"
 )
 
@@ -6,10 +6,11 @@ import (
 	"strings"
 	"time"
 
-	"github.com/coreos/etcd/clientv3"
-	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/douyu/juno-agent/pkg/logging"
 	"github.com/douyu/juno-agent/util"
 	"github.com/douyu/jupiter/pkg/xlog"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
 func (d *DataSource) watchPrometheus(path string) {
@@ -30,7 +31,7 @@ func (d *DataSource) watchPrometheus(path string) {
 					key, value := string(event.Kv.Key), string(event.Kv.Value)
 					keyArr := strings.Split(key, "/")
 					if len(keyArr) != 5 && len(keyArr) != 6 {
-						xlog.Error("watchPrometheus", xlog.String("key", key), xlog.String("value", value))
+						logging.Logger("proxy").Error("watchPrometheus", xlog.String("key", key), xlog.String("value", value))
 						break
 					}
 					filename := keyArr[3] + "_" + value
@@ -39,7 +40,7 @@ func (d *DataSource) watchPrometheus(path string) {
 					key, value := string(event.Kv.Key), string(event.Kv.Value)
 					keyArr := strings.Split(key, "/")
 					if len(keyArr) != 5 && len(keyArr) != 6 {
-						xlog.Error("watchPrometheus", xlog.String("key", key), xlog.String("value", value))
+						logging.Logger("proxy").Error("watchPrometheus", xlog.String("key", key), xlog.String("value", value))
 						break
 					}
 					filename := keyArr[3] + "_" + value
@@ -66,14 +67,14 @@ func (d *DataSource) PrometheusConfigScanner(path string) {
 	defer cancel()
 	resp, err := d.etcdClient.Get(ctx, hostKey, clientv3.WithPrefix())
 	if err != nil {
-		xlog.Error("init get hostKey error", xlog.String("plugin", "confgo"), xlog.String("msg", err.Error()), xlog.String("hostKey", hostKey))
+		logging.Logger("proxy").Error("init get hostKey error", xlog.String("plugin", "confgo"), xlog.String("msg", err.Error()), xlog.String("hostKey", hostKey))
 		return
 	}
 	for _, kv := range resp.Kvs {
 		key, value := string(kv.Key), string(kv.Value)
 		keyArr := strings.Split(key, "/")
 		if len(keyArr) != 5 && len(keyArr) != 6 {
-			xlog.Error("PrometheusConfigScanner", xlog.String("key", key), xlog.String("value", value))
+			logging.Logger("proxy").Error("PrometheusConfigScanner", xlog.String("key", key), xlog.String("value", value))
 			continue
 		}
 		filename := keyArr[3] + "_" + value
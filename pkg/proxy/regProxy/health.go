@@ -0,0 +1,303 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regProxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/logging"
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/registry"
+	"github.com/douyu/jupiter/pkg/xlog"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Health states written to the "health" label of the registration
+const (
+	HealthPassing  = registry.HealthPassing
+	HealthCritical = registry.HealthCritical
+)
+
+// HealthConfig probes the instances registered through the proxy, so that dead instances
+// are marked critical before their lease expires. registrations are never deleted by probes,
+// they go away with the lease of the app
+type HealthConfig struct {
+	Enable   bool
+	Interval time.Duration
+	Timeout  time.Duration
+	Failures int           // consecutive failures after which the instance is marked critical, 0 marks it at the first failure
+	Checks   []HealthCheck // services without a check are not probed
+}
+
+// HealthCheck how the instances of a service are probed
+type HealthCheck struct {
+	Service string
+	Type    string // http, tcp or grpc, the scheme of the instance by default
+	Path    string // path of http checks, e.g. /healthz
+	Name    string // service name of grpc health checks, empty for the whole server
+}
+
+// InstanceHealth result of the latest probe of an instance
+type InstanceHealth struct {
+	Key       string    `json:"key"`
+	App       string    `json:"app"`
+	Addr      string    `json:"addr"`
+	Check     string    `json:"check"`
+	Status    string    `json:"status"`
+	Failures  int       `json:"failures"`
+	Output    string    `json:"output"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// healthChecker probe states of the registrations, keyed by registration key
+type healthChecker struct {
+	config *HealthConfig
+	checks map[string]HealthCheck
+
+	mu     sync.Mutex
+	states map[string]*InstanceHealth
+	stop   chan struct{}
+}
+
+func newHealthChecker(config *HealthConfig) *healthChecker {
+	checks := make(map[string]HealthCheck, len(config.Checks))
+	for _, check := range config.Checks {
+		checks[check.Service] = check
+	}
+	return &healthChecker{
+		config: config,
+		checks: checks,
+		states: make(map[string]*InstanceHealth),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Health results of the latest probes, sorted by key
+func (proxy *RegProxy) Health() []InstanceHealth {
+	if proxy.health == nil {
+		return nil
+	}
+	proxy.health.mu.Lock()
+	defer proxy.health.mu.Unlock()
+	states := make([]InstanceHealth, 0, len(proxy.health.states))
+	for _, state := range proxy.health.states {
+		states = append(states, *state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Key < states[j].Key })
+	return states
+}
+
+// watchHealth probes every interval until the proxy is closed
+func (proxy *RegProxy) watchHealth() {
+	ticker := time.NewTicker(proxy.health.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-proxy.health.stop:
+			return
+		case <-ticker.C:
+		}
+		proxy.probeAll()
+	}
+}
+
+// probeAll probes the registrations having a check concurrently
+func (proxy *RegProxy) probeAll() {
+	registrations := proxy.registrationValues()
+	var wg sync.WaitGroup
+	for key, value := range registrations {
+		check, ok := proxy.health.checks[registry.App(key)]
+		if !ok {
+			continue
+		}
+		ins, err := registry.NewInstance(key, value)
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(ins *registry.Instance, check HealthCheck) {
+			defer wg.Done()
+			proxy.probeInstance(ins, check)
+		}(ins, check)
+	}
+	wg.Wait()
+
+	// forget the states of instances deregistered in the meantime
+	proxy.health.mu.Lock()
+	for key := range proxy.health.states {
+		if _, ok := registrations[key]; !ok {
+			delete(proxy.health.states, key)
+		}
+	}
+	proxy.health.mu.Unlock()
+}
+
+func (proxy *RegProxy) probeInstance(ins *registry.Instance, check HealthCheck) {
+	ctx, cancel := context.WithTimeout(context.Background(), proxy.health.config.Timeout)
+	defer cancel()
+	checkType := check.Type
+	if checkType == "" {
+		checkType = ins.Scheme
+	}
+	err := probe(ctx, checkType, net.JoinHostPort(ins.IP, strconv.Itoa(ins.Port)), check)
+
+	proxy.health.mu.Lock()
+	state, ok := proxy.health.states[ins.Key]
+	if !ok {
+		state = &InstanceHealth{Key: ins.Key, App: ins.App, Addr: net.JoinHostPort(ins.IP, strconv.Itoa(ins.Port)), Status: HealthPassing}
+		proxy.health.states[ins.Key] = state
+	}
+	prev := state.Status
+	state.Check, state.CheckedAt = checkType, time.Now()
+	if err != nil {
+		state.Status, state.Output = HealthCritical, err.Error()
+		state.Failures++
+	} else {
+		state.Status, state.Output, state.Failures = HealthPassing, "", 0
+	}
+	// a single failed probe is tolerated until the limit is reached
+	if limit := proxy.health.config.Failures; err != nil && state.Failures < limit {
+		state.Status = prev
+	}
+	current := *state
+	proxy.health.mu.Unlock()
+
+	if current.Status != prev {
+		logging.Logger("proxy").Info("instance health changed", xlog.String("key", ins.Key), xlog.String("status", current.Status), xlog.Int("failures", current.Failures), xlog.String("output", current.Output))
+		proxy.markHealth(ins, current.Status)
+	}
+}
+
+// probe an error for a failed check
+func probe(ctx context.Context, checkType, addr string, check HealthCheck) error {
+	switch checkType {
+	case "http":
+		req, err := http.NewRequest(http.MethodGet, "http://"+addr+check.Path, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("http check responded %s", resp.Status)
+		}
+		return nil
+	case "grpc":
+		conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: check.Name})
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("grpc check responded %s", resp.GetStatus())
+		}
+		return nil
+	default:
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// registrationValues registrations put through the proxy, in etcd or bridged
+func (proxy *RegProxy) registrationValues() map[string][]byte {
+	registrations := make(map[string][]byte)
+	proxy.registrations.Range(func(key, value interface{}) bool {
+		registrations[key.(string)] = value.([]byte)
+		return true
+	})
+	proxy.bridgesMu.Lock()
+	for key, b := range proxy.bridges {
+		registrations[key] = b.instance.Value
+	}
+	proxy.bridgesMu.Unlock()
+	return registrations
+}
+
+// markHealth rewrites the registration with the health label, keeping its lease
+func (proxy *RegProxy) markHealth(ins *registry.Instance, status string) {
+	value := withHealthLabel(ins.Value, status)
+	ctx, cancel := context.WithTimeout(context.Background(), proxy.health.config.Timeout)
+	defer cancel()
+
+	proxy.bridgesMu.Lock()
+	b, bridged := proxy.bridges[ins.Key]
+	var updated registry.Instance
+	if bridged {
+		updated = *b.instance
+	}
+	proxy.bridgesMu.Unlock()
+	if bridged {
+		updated.Value = value
+		if err := b.registry.Register(ctx, &updated); err != nil {
+			logging.Logger("proxy").Error("mark health of bridged instance", xlog.String("key", ins.Key), xlog.FieldErr(err))
+			return
+		}
+		proxy.bridgesMu.Lock()
+		b.instance = &updated
+		proxy.bridgesMu.Unlock()
+		return
+	}
+
+	// a registration whose lease has expired is gone, ignoring the lease keeps it from being put back
+	if _, err := proxy.Client.Put(ctx, ins.Key, string(value), clientv3.WithIgnoreLease()); err != nil {
+		if err == rpctypes.ErrKeyNotFound {
+			proxy.registrations.Delete(ins.Key)
+			return
+		}
+		logging.Logger("proxy").Error("mark health of instance", xlog.String("key", ins.Key), xlog.FieldErr(err))
+		return
+	}
+	proxy.registrations.Store(ins.Key, value)
+}
+
+// withHealthLabel sets labels.health of the registration info, values which are not json are kept
+func withHealthLabel(value []byte, status string) []byte {
+	var info map[string]interface{}
+	if err := json.Unmarshal(value, &info); err != nil || info == nil {
+		return value
+	}
+	labels, _ := info["labels"].(map[string]interface{})
+	if labels == nil {
+		labels = make(map[string]interface{})
+	}
+	labels["health"] = status
+	info["labels"] = labels
+	updated, err := json.Marshal(info)
+	if err != nil {
+		return value
+	}
+	return updated
+}
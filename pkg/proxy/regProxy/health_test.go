@@ -0,0 +1,99 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regProxy
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingRegistry struct {
+	mu           sync.Mutex
+	registered   [][]byte
+	deregistered int
+}
+
+func (r *recordingRegistry) Name() string { return "recording" }
+
+func (r *recordingRegistry) Register(ctx context.Context, ins *registry.Instance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.registered = append(r.registered, ins.Value)
+	return nil
+}
+
+func (r *recordingRegistry) Heartbeat(ctx context.Context, ins *registry.Instance) error { return nil }
+
+func (r *recordingRegistry) Deregister(ctx context.Context, ins *registry.Instance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deregistered++
+	return nil
+}
+
+func (r *recordingRegistry) Instances(ctx context.Context, app string) ([]*registry.Instance, error) {
+	return nil, nil
+}
+
+func TestProbeBridgedInstance(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := lis.Addr().(*net.TCPAddr)
+
+	reg := &recordingRegistry{}
+	ins, _ := registry.NewInstance(registry.Key("user-svc", "grpc", "127.0.0.1", addr.Port), []byte(`{"name":"user-svc"}`))
+	proxy := &RegProxy{
+		heartbeat: time.Second,
+		bridges:   map[string]*bridge{ins.Key: {registry: reg, instance: ins, stop: make(chan struct{})}},
+		health: newHealthChecker(&HealthConfig{
+			Timeout:  time.Second,
+			Failures: 2,
+			Checks:   []HealthCheck{{Service: "user-svc", Type: "tcp"}},
+		}),
+	}
+
+	proxy.probeAll()
+	if health := proxy.Health(); assert.Len(t, health, 1) {
+		assert.Equal(t, HealthPassing, health[0].Status)
+	}
+	assert.Len(t, reg.registered, 0)
+
+	// 连续失败达到次数后标记为 critical，注册信息保留到应用的 lease 过期
+	lis.Close()
+	proxy.probeAll()
+	if health := proxy.Health(); assert.Len(t, health, 1) {
+		assert.Equal(t, HealthPassing, health[0].Status)
+		assert.Equal(t, 1, health[0].Failures)
+	}
+	assert.Len(t, reg.registered, 0)
+	for i := 0; i < 3; i++ {
+		proxy.probeAll()
+	}
+	if health := proxy.Health(); assert.Len(t, health, 1) {
+		assert.Equal(t, HealthCritical, health[0].Status)
+		assert.Equal(t, 4, health[0].Failures)
+	}
+	if assert.Len(t, reg.registered, 1) {
+		assert.JSONEq(t, `{"name":"user-svc","labels":{"health":"critical"}}`, string(reg.registered[0]))
+	}
+	assert.Equal(t, 0, reg.deregistered)
+	assert.Len(t, proxy.bridges, 1)
+}
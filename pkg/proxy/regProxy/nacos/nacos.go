@@ -0,0 +1,259 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nacos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/registry"
+)
+
+const (
+	// DefaultGroup 未指定 group 时使用的分组
+	DefaultGroup = "DEFAULT_GROUP"
+	// 心跳时 nacos 中实例已不存在
+	codeResourceNotFound = 20404
+)
+
+// Config nacos 注册中心配置
+type Config struct {
+	Enable    bool
+	Addr      string        `json:"addr"`      // nacos 地址，如 http://127.0.0.1:8848
+	Namespace string        `json:"namespace"` // 命名空间 id，为空时使用 public
+	Group     string        `json:"group"`     // 为空时使用 DEFAULT_GROUP
+	Username  string        `json:"username"`  // 开启鉴权时的用户名
+	Password  string        `json:"password"`
+	Timeout   time.Duration `json:"timeout"`
+	Services  []string      `json:"services"` // 经由 nacos 注册发现的应用
+}
+
+// Registry 实例注册为临时实例，由代理定期发送心跳
+type Registry struct {
+	config *Config
+	client *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpire time.Time
+}
+
+// New ...
+func New(config *Config) (*Registry, error) {
+	if config.Addr == "" {
+		return nil, errors.New("nacos addr is required")
+	}
+	c := *config
+	if c.Group == "" {
+		c.Group = DefaultGroup
+	}
+	return &Registry{
+		config: &c,
+		client: &http.Client{Timeout: c.Timeout},
+	}, nil
+}
+
+// Name ...
+func (r *Registry) Name() string {
+	return "nacos"
+}
+
+// Register 注册信息保存在实例的元数据中
+func (r *Registry) Register(ctx context.Context, ins *registry.Instance) error {
+	params := r.instanceParams(ins)
+	params.Set("metadata", string(encodeMetadata(ins)))
+	params.Set("enabled", "true")
+	params.Set("healthy", "true")
+	params.Set("weight", "1")
+	_, err := r.do(ctx, http.MethodPost, "/nacos/v1/ns/instance", params)
+	return err
+}
+
+// Heartbeat ...
+func (r *Registry) Heartbeat(ctx context.Context, ins *registry.Instance) error {
+	beat, err := json.Marshal(map[string]interface{}{
+		"serviceName": r.config.Group + "@@" + ins.App,
+		"ip":          ins.IP,
+		"port":        ins.Port,
+		"cluster":     "DEFAULT",
+		"scheduled":   true,
+		"metadata":    json.RawMessage(encodeMetadata(ins)),
+	})
+	if err != nil {
+		return err
+	}
+	params := r.instanceParams(ins)
+	params.Set("beat", string(beat))
+	body, err := r.do(ctx, http.MethodPut, "/nacos/v1/ns/instance/beat", params)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Code int `json:"code"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("nacos beat: %w", err)
+	}
+	// nacos 重启或实例超时被摘除
+	if resp.Code == codeResourceNotFound {
+		return r.Register(ctx, ins)
+	}
+	return nil
+}
+
+// Deregister ...
+func (r *Registry) Deregister(ctx context.Context, ins *registry.Instance) error {
+	_, err := r.do(ctx, http.MethodDelete, "/nacos/v1/ns/instance", r.instanceParams(ins))
+	return err
+}
+
+// Instances 不是经由代理注册的实例没有注册信息，按 nacos 中的地址还原
+func (r *Registry) Instances(ctx context.Context, app string) ([]*registry.Instance, error) {
+	params := url.Values{
+		"serviceName": {app},
+		"groupName":   {r.config.Group},
+		"healthyOnly": {"true"},
+	}
+	if r.config.Namespace != "" {
+		params.Set("namespaceId", r.config.Namespace)
+	}
+	body, err := r.do(ctx, http.MethodGet, "/nacos/v1/ns/instance/list", params)
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Hosts []struct {
+			IP       string            `json:"ip"`
+			Port     int               `json:"port"`
+			Metadata map[string]string `json:"metadata"`
+		} `json:"hosts"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("nacos instances of %s: %w", app, err)
+	}
+
+	instances := make([]*registry.Instance, 0, len(list.Hosts))
+	for _, host := range list.Hosts {
+		scheme := host.Metadata["scheme"]
+		if scheme == "" {
+			scheme = "grpc"
+		}
+		instances = append(instances, &registry.Instance{
+			Key:    registry.Key(app, scheme, host.IP, host.Port),
+			Value:  []byte(host.Metadata["regInfo"]),
+			App:    app,
+			Scheme: scheme,
+			IP:     host.IP,
+			Port:   host.Port,
+		})
+	}
+	return instances, nil
+}
+
+func (r *Registry) instanceParams(ins *registry.Instance) url.Values {
+	params := url.Values{
+		"serviceName": {ins.App},
+		"groupName":   {r.config.Group},
+		"ip":          {ins.IP},
+		"port":        {strconv.Itoa(ins.Port)},
+		"ephemeral":   {"true"},
+	}
+	if r.config.Namespace != "" {
+		params.Set("namespaceId", r.config.Namespace)
+	}
+	return params
+}
+
+func encodeMetadata(ins *registry.Instance) []byte {
+	metadata, _ := json.Marshal(map[string]string{
+		"scheme":  ins.Scheme,
+		"regInfo": string(ins.Value),
+	})
+	return metadata
+}
+
+// do 参数都放在 query 中，nacos 的 PUT、DELETE 接口不读取表单
+func (r *Registry) do(ctx context.Context, method, path string, params url.Values) ([]byte, error) {
+	token, err := r.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		params.Set("accessToken", token)
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(r.config.Addr, "/")+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil, fmt.Errorf("nacos responded %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// accessToken 开启鉴权时登录获取 token，过期前重新登录
+func (r *Registry) accessToken(ctx context.Context) (string, error) {
+	if r.config.Username == "" {
+		return "", nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.token != "" && time.Now().Before(r.tokenExpire) {
+		return r.token, nil
+	}
+
+	form := url.Values{"username": {r.config.Username}, "password": {r.config.Password}}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(r.config.Addr, "/")+"/nacos/v1/auth/login", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("nacos login: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return "", fmt.Errorf("nacos login responded %s", resp.Status)
+	}
+
+	var login struct {
+		AccessToken string `json:"accessToken"`
+		TokenTTL    int64  `json:"tokenTtl"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+		return "", fmt.Errorf("nacos login: %w", err)
+	}
+	r.token = login.AccessToken
+	r.tokenExpire = time.Now().Add(time.Duration(login.TokenTTL) * time.Second * 9 / 10)
+	return r.token, nil
+}
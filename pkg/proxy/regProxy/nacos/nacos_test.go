@@ -0,0 +1,86 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nacos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		instances = make(map[string]map[string]interface{})
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		q := r.URL.Query()
+		assert.Equal(t, "user-svc", q.Get("serviceName"))
+		assert.Equal(t, DefaultGroup, q.Get("groupName"))
+		id := q.Get("ip") + ":" + q.Get("port")
+		switch r.Method + " " + r.URL.Path {
+		case "POST /nacos/v1/ns/instance":
+			var metadata map[string]string
+			assert.NoError(t, json.Unmarshal([]byte(q.Get("metadata")), &metadata))
+			port, _ := strconv.Atoi(q.Get("port"))
+			instances[id] = map[string]interface{}{"ip": q.Get("ip"), "port": port, "metadata": metadata}
+		case "PUT /nacos/v1/ns/instance/beat":
+			if _, ok := instances[id]; !ok {
+				fmt.Fprint(w, `{"code":20404}`)
+				return
+			}
+			fmt.Fprint(w, `{"code":10200}`)
+		case "DELETE /nacos/v1/ns/instance":
+			delete(instances, id)
+		case "GET /nacos/v1/ns/instance/list":
+			hosts := make([]map[string]interface{}, 0, len(instances))
+			for _, ins := range instances {
+				hosts = append(hosts, ins)
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"hosts": hosts})
+		}
+	}))
+	defer server.Close()
+
+	r, err := New(&Config{Addr: server.URL})
+	assert.NoError(t, err)
+	ctx := context.Background()
+	ins, _ := registry.NewInstance("/reg/user-svc/providers/grpc://10.0.0.1:9091", []byte(`{"name":"user-svc"}`))
+
+	assert.NoError(t, r.Register(ctx, ins))
+	got, err := r.Instances(ctx, "user-svc")
+	if assert.NoError(t, err) && assert.Len(t, got, 1) {
+		// 还原应用写入的注册信息
+		assert.Equal(t, ins, got[0])
+	}
+
+	assert.NoError(t, r.Deregister(ctx, ins))
+	got, _ = r.Instances(ctx, "user-svc")
+	assert.Len(t, got, 0)
+	// 实例已被摘除时心跳重新注册
+	assert.NoError(t, r.Heartbeat(ctx, ins))
+	got, _ = r.Instances(ctx, "user-svc")
+	assert.Len(t, got, 1)
+}
@@ -16,8 +16,14 @@ package regProxy
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/consul"
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/dns"
 	"github.com/douyu/juno-agent/pkg/proxy/regProxy/etcd"
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/nacos"
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/registry"
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/xds"
 	"github.com/douyu/jupiter/pkg/conf"
 	"github.com/douyu/jupiter/pkg/flag"
 	"github.com/douyu/jupiter/pkg/xlog"
@@ -27,6 +33,14 @@ import (
 type Config struct {
 	Enable     bool // Whether to open the open plug-in
 	Prometheus etcd.PluginRegProxyPrometheus
+	// Registrations of the services listed in Nacos or Consul are bridged to that registry instead of etcd
+	Nacos     nacos.Config
+	Consul    consul.Config
+	Heartbeat time.Duration // heartbeat interval of bridged registrations
+	Cache     CacheConfig
+	DNS       dns.Config // answers service queries for apps discovering through resolv.conf
+	Health    HealthConfig
+	XDS       xds.Config // serves discovery to envoy sidecars as CDS and EDS
 }
 
 // StdConfig returns standard configuration information
@@ -52,13 +66,85 @@ func DefaultConfig() Config {
 			Enable: false,
 			Path:   "/home/www/server/prometheus/conf",
 		},
+		Nacos: nacos.Config{
+			Timeout: 3 * time.Second,
+		},
+		Consul: consul.Config{
+			TTL: 15 * time.Second,
+		},
+		Heartbeat: 5 * time.Second,
+		Cache: CacheConfig{
+			Enable:        false,
+			Path:          "/home/www/.cache/juno-agent/discovery.json",
+			Timeout:       3 * time.Second,
+			FlushInterval: 5 * time.Second,
+		},
+		DNS: dns.Config{
+			Enable:  false,
+			Addr:    "127.0.0.1:53",
+			Domain:  "juno",
+			TTL:     5 * time.Second,
+			Timeout: 2 * time.Second,
+		},
+		Health: HealthConfig{
+			Enable:   false,
+			Interval: 10 * time.Second,
+			Timeout:  3 * time.Second,
+			Failures: 3,
+		},
+		XDS: xds.Config{
+			Enable:         false,
+			Addr:           "127.0.0.1:15010",
+			ClusterName:    "juno-agent",
+			RefreshDelay:   time.Second,
+			ConnectTimeout: time.Second,
+			Timeout:        3 * time.Second,
+		},
 	}
 }
 
 // Build  new the instance
 func (c *Config) Build() *RegProxy {
 	if c.Enable {
-		return NewRegProxy(etcd.NewETCDDataSource(c.Prometheus))
+		proxy := NewRegProxy(etcd.NewETCDDataSource(c.Prometheus), c.registries(), c.Heartbeat)
+		if c.Cache.Enable {
+			proxy.cache = newDiscoveryCache(&c.Cache)
+		}
+		if c.Health.Enable {
+			proxy.health = newHealthChecker(&c.Health)
+		}
+		if c.DNS.Enable {
+			proxy.dns = dns.New(&c.DNS, proxy)
+		}
+		if c.XDS.Enable {
+			proxy.xds = xds.New(&c.XDS, proxy)
+		}
+		return proxy
 	}
 	return nil
 }
+
+// registries maps the services bridged to Nacos or Consul to their registry,
+// a registry failing to build leaves its services in etcd
+func (c *Config) registries() map[string]registry.Registry {
+	registries := make(map[string]registry.Registry)
+	if c.Nacos.Enable {
+		if reg, err := nacos.New(&c.Nacos); err != nil {
+			xlog.Error("regProxy", xlog.String("registry", "nacos"), xlog.FieldErr(err))
+		} else {
+			for _, service := range c.Nacos.Services {
+				registries[service] = reg
+			}
+		}
+	}
+	if c.Consul.Enable {
+		if reg, err := consul.New(&c.Consul); err != nil {
+			xlog.Error("regProxy", xlog.String("registry", "consul"), xlog.FieldErr(err))
+		} else {
+			for _, service := range c.Consul.Services {
+				registries[service] = reg
+			}
+		}
+	}
+	return registries
+}
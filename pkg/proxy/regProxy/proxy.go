@@ -23,16 +23,25 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	pb "github.com/coreos/etcd/etcdserver/etcdserverpb"
-	"github.com/coreos/etcd/proxy/grpcproxy"
+	"github.com/douyu/juno-agent/pkg/etcdv3"
+	"github.com/douyu/juno-agent/pkg/logging"
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/dns"
 	"github.com/douyu/juno-agent/pkg/proxy/regProxy/etcd"
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/registry"
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/xds"
 	"github.com/douyu/juno-agent/pkg/structs"
-	"github.com/douyu/jupiter/pkg/client/etcdv3"
 	"github.com/douyu/jupiter/pkg/util/xdebug"
 	"github.com/douyu/jupiter/pkg/util/xstring"
 	"github.com/douyu/jupiter/pkg/xlog"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/server/v3/proxy/grpcproxy"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/grpc/status"
 )
 
 // RegProxy ...
@@ -40,18 +49,35 @@ type RegProxy struct {
 	pb.KVServer
 	pb.LeaseServer
 	pb.WatchServer
+	helloworld.UnimplementedGreeterServer
 
 	*etcdv3.Client
 	nodeChan chan *structs.ServiceNode
 
 	serviceConfigurations sync.Map
+	registrations         sync.Map // key -> value of service registrations put through the proxy
+	draining              int32
+
+	registries map[string]registry.Registry // app name -> registry the app is bridged to instead of etcd
+	heartbeat  time.Duration
+	bridgesMu  sync.Mutex
+	bridges    map[string]*bridge // registration key -> bridged registration
+
+	cache  *discoveryCache // nil when the discovery cache is disabled
+	dns    *dns.Server     // nil when the DNS server is disabled
+	health *healthChecker  // nil when instances are not probed
+	xds    *xds.Server     // nil when the xDS server is disabled
 }
 
-// NewRegProxy ...
-func NewRegProxy(confClient *etcd.DataSource) *RegProxy {
+// NewRegProxy registrations of the apps in registries are bridged to those registries,
+// heartbeat is the interval of their heartbeats
+func NewRegProxy(confClient *etcd.DataSource, registries map[string]registry.Registry, heartbeat time.Duration) *RegProxy {
 	proxy := &RegProxy{
-		Client:   confClient.GetClient(),
-		nodeChan: make(chan *structs.ServiceNode, 100),
+		Client:     confClient.GetClient(),
+		nodeChan:   make(chan *structs.ServiceNode, 100),
+		registries: registries,
+		heartbeat:  heartbeat,
+		bridges:    make(map[string]*bridge),
 	}
 	return proxy
 }
@@ -67,13 +93,44 @@ func (proxy *RegProxy) SayHello(ctx context.Context, request *helloworld.HelloRe
 // Start ...
 func (proxy *RegProxy) Start() error {
 	proxy.KVServer, _ = grpcproxy.NewKvProxy(proxy.Client.Client)
-	proxy.LeaseServer, _ = grpcproxy.NewLeaseProxy(proxy.Client.Client)
-	proxy.WatchServer, _ = grpcproxy.NewWatchProxy(proxy.Client.Client)
+	proxy.LeaseServer, _ = grpcproxy.NewLeaseProxy(context.Background(), proxy.Client.Client)
+	proxy.WatchServer, _ = grpcproxy.NewWatchProxy(context.Background(), zap.NewNop(), proxy.Client.Client)
+	if proxy.health != nil {
+		go proxy.watchHealth()
+	}
+	if proxy.xds != nil {
+		if err := proxy.xds.Start(); err != nil {
+			return err
+		}
+	}
+	if proxy.dns != nil {
+		return proxy.dns.Start()
+	}
 	return nil
 }
 
-// Close ...
+// Close stops the heartbeats of bridged registrations, the registries expire them
 func (proxy *RegProxy) Close() {
+	if proxy.dns != nil {
+		_ = proxy.dns.Close()
+	}
+	if proxy.xds != nil {
+		_ = proxy.xds.Close()
+	}
+	if proxy.health != nil {
+		close(proxy.health.stop)
+	}
+	proxy.bridgesMu.Lock()
+	for key, b := range proxy.bridges {
+		close(b.stop)
+		delete(proxy.bridges, key)
+	}
+	proxy.bridgesMu.Unlock()
+	if proxy.cache != nil {
+		if err := proxy.cache.close(); err != nil {
+			logging.Logger("proxy").Error("flush discovery cache", xlog.FieldErr(err))
+		}
+	}
 	close(proxy.nodeChan)
 }
 
@@ -100,7 +157,7 @@ func (proxy *RegProxy) StoreServiceConfiguration(key string, conf *structs.AppCo
 
 // Put Intercept the service registration request, register and rewrite the registration information
 func (proxy *RegProxy) Put(ctx context.Context, in *pb.PutRequest) (out *pb.PutResponse, err error) {
-	xlog.Info("put", xlog.Any("in", in))
+	logging.Logger("proxy").Info("put", xlog.Any("in", in))
 	var node *structs.ServiceNode
 	switch {
 	// The registration information is parsed and cached
@@ -116,10 +173,17 @@ func (proxy *RegProxy) Put(ctx context.Context, in *pb.PutRequest) (out *pb.PutR
 	}
 
 	if node != nil && err == nil {
+		if atomic.LoadInt32(&proxy.draining) == 1 {
+			return nil, status.Error(codes.Unavailable, "agent is draining, registration rejected")
+		}
 		select {
 		case proxy.nodeChan <- node:
 		default:
 		}
+		if reg := proxy.registryOf(in.GetKey()); reg != nil {
+			return proxy.putBridged(ctx, reg, in)
+		}
+		proxy.registrations.Store(string(in.GetKey()), in.GetValue())
 	}
 
 	if xdebug.IsDevelopmentMode() {
@@ -132,6 +196,35 @@ func (proxy *RegProxy) Put(ctx context.Context, in *pb.PutRequest) (out *pb.PutR
 	return proxy.KVServer.Put(ctx, in)
 }
 
+// Deregister deletes the registrations put through the proxy and rejects new ones,
+// so that consumers stop calling services on this host before it goes down
+func (proxy *RegProxy) Deregister(ctx context.Context) (int, error) {
+	atomic.StoreInt32(&proxy.draining, 1)
+
+	var keys []string
+	proxy.registrations.Range(func(key, _ interface{}) bool {
+		keys = append(keys, key.(string))
+		return true
+	})
+
+	// "\x00" to "\x00" ranges over every key
+	deleted := int(proxy.removeBridges([]byte{0}, []byte{0}))
+	for _, key := range keys {
+		if _, err := proxy.Client.Delete(ctx, key); err != nil {
+			return deleted, err
+		}
+		proxy.registrations.Delete(key)
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Resume accepts registrations again after the host is not going down anymore,
+// services put their registrations back on their next keepalive
+func (proxy *RegProxy) Resume() {
+	atomic.StoreInt32(&proxy.draining, 0)
+}
+
 // extractRegInfoV1 ...
 func extractRegInfoV1(key, val []byte) (node *structs.ServiceNode, err error) {
 	// grpc service with 'grpc:' prefix
@@ -154,7 +247,7 @@ func extractRegInfoV1(key, val []byte) (node *structs.ServiceNode, err error) {
 // extractRegInfoV2 ...
 func extractRegInfoV2(key []byte, val []byte) (node *structs.ServiceNode, err error) {
 	appName, addr := xstring.Split(strings.TrimLeft(string(key), "/reg/"), "/providers/").Head2()
-	xlog.Info("extractRegInfoV2", xlog.String("appName", appName), xlog.String("addr", addr))
+	logging.Logger("proxy").Info("extractRegInfoV2", xlog.String("appName", appName), xlog.String("addr", addr))
 	uri, err := url.Parse(addr)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,118 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const keyPrefix = "/reg/"
+
+// 代理探测实例后写入注册信息 labels.health 的健康状态
+const (
+	HealthPassing  = "passing"
+	HealthCritical = "critical"
+)
+
+// Registry 代替 etcd 保存经由代理注册的服务，如 nacos、consul
+type Registry interface {
+	// Name 注册中心名称
+	Name() string
+	// Register 注册实例，已注册时覆盖
+	Register(ctx context.Context, ins *Instance) error
+	// Heartbeat 续约实例，注册中心中实例已不存在时重新注册
+	Heartbeat(ctx context.Context, ins *Instance) error
+	// Deregister 注销实例
+	Deregister(ctx context.Context, ins *Instance) error
+	// Instances 应用当前健康的实例
+	Instances(ctx context.Context, app string) ([]*Instance, error)
+}
+
+// Endpoint 经由代理发现的实例地址
+type Endpoint struct {
+	Scheme string
+	IP     net.IP
+	Port   int
+	Health string // 探测结果，注册信息的 labels.health，没有探测时为空
+}
+
+// Resolver 查询服务的实例
+type Resolver interface {
+	Resolve(ctx context.Context, service string) ([]Endpoint, error)
+}
+
+// Instance 服务实例，Key、Value 为应用写入 etcd 的注册信息，发现时原样还原
+type Instance struct {
+	Key    string // /reg/<app>/providers/<scheme>://<ip>:<port>
+	Value  []byte
+	App    string
+	Scheme string
+	IP     string
+	Port   int
+}
+
+// ID 实例在注册中心中的唯一标识
+func (ins *Instance) ID() string {
+	return fmt.Sprintf("%s-%s-%s-%d", ins.App, ins.Scheme, ins.IP, ins.Port)
+}
+
+// App 注册 key 所属的应用，不是服务注册的 key 时返回空
+func App(key string) string {
+	if !strings.HasPrefix(key, keyPrefix) {
+		return ""
+	}
+	app := strings.TrimPrefix(key, keyPrefix)
+	if i := strings.Index(app, "/"); i >= 0 {
+		app = app[:i]
+	}
+	return app
+}
+
+// NewInstance 解析应用写入的注册 key
+func NewInstance(key string, value []byte) (*Instance, error) {
+	app := App(key)
+	addr := strings.TrimPrefix(key, ProvidersPrefix(app))
+	if app == "" || addr == key {
+		return nil, fmt.Errorf("not a provider key: %s", key)
+	}
+	uri, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	host, portStr, err := net.SplitHostPort(uri.Host)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in %s", key)
+	}
+	return &Instance{Key: key, Value: value, App: app, Scheme: uri.Scheme, IP: host, Port: port}, nil
+}
+
+// Key 还原注册 key
+func Key(app, scheme, ip string, port int) string {
+	return ProvidersPrefix(app) + scheme + "://" + net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+// ProvidersPrefix 应用全部实例注册 key 的前缀
+func ProvidersPrefix(app string) string {
+	return keyPrefix + app + "/providers/"
+}
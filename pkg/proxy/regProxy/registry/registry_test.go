@@ -0,0 +1,37 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewInstance(t *testing.T) {
+	key := "/reg/user-svc/providers/grpc://10.0.0.1:9091"
+	ins, err := NewInstance(key, []byte(`{"name":"user-svc"}`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "user-svc", ins.App)
+		assert.Equal(t, "grpc", ins.Scheme)
+		assert.Equal(t, "10.0.0.1", ins.IP)
+		assert.Equal(t, 9091, ins.Port)
+		assert.Equal(t, key, Key(ins.App, ins.Scheme, ins.IP, ins.Port))
+	}
+
+	_, err = NewInstance("/reg/user-svc/configurators/grpc://10.0.0.1:9091", nil)
+	assert.Error(t, err)
+	assert.Equal(t, "", App("/dubbo/user-svc"))
+}
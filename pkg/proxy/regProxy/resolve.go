@@ -0,0 +1,69 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regProxy
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/registry"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+// Resolve returns the providers of service the way apps discover them through the proxy,
+// so that the discovery cache and bridged registries apply to DNS queries as well
+func (proxy *RegProxy) Resolve(ctx context.Context, service string) ([]registry.Endpoint, error) {
+	prefix := registry.ProvidersPrefix(service)
+	out, err := proxy.Range(ctx, &pb.RangeRequest{Key: []byte(prefix), RangeEnd: prefixEnd([]byte(prefix))})
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make([]registry.Endpoint, 0, len(out.Kvs))
+	for _, kv := range out.Kvs {
+		ins, err := registry.NewInstance(string(kv.Key), kv.Value)
+		if err != nil {
+			continue
+		}
+		ip := net.ParseIP(ins.IP)
+		if ip == nil {
+			continue
+		}
+		endpoints = append(endpoints, registry.Endpoint{Scheme: ins.Scheme, IP: ip, Port: ins.Port, Health: healthLabel(kv.Value)})
+	}
+	return endpoints, nil
+}
+
+// prefixEnd the range end covering every key with prefix
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return []byte{0}
+}
+
+// healthLabel the health label written by the probes, empty for instances not probed
+func healthLabel(value []byte) string {
+	var info struct {
+		Labels map[string]string `json:"labels"`
+	}
+	_ = json.Unmarshal(value, &info)
+	return info.Labels["health"]
+}
@@ -0,0 +1,265 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/logging"
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/registry"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// xDS v3 资源类型
+const (
+	TypeCluster  = "type.googleapis.com/envoy.config.cluster.v3.Cluster"
+	TypeEndpoint = "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"
+)
+
+// Config REST-JSON 形式的 xDS 服务，envoy 以 api_type REST 轮询 CDS 及 EDS
+//
+// envoy 的 bootstrap 中 cds_config 指向 agent 所在的集群即可：
+//
+//	dynamic_resources:
+//	  cds_config:
+//	    resource_api_version: V3
+//	    api_config_source: {api_type: REST, transport_api_version: V3, cluster_names: [juno-agent], refresh_delay: 5s}
+type Config struct {
+	Enable         bool
+	Addr           string          `json:"addr"`
+	ClusterName    string          `json:"clusterName"`    // bootstrap 中指向 agent 的静态集群，下发的集群经由它拉取 EDS
+	RefreshDelay   time.Duration   `json:"refreshDelay"`   // envoy 轮询 EDS 的间隔
+	ConnectTimeout time.Duration   `json:"connectTimeout"` // 下发集群的连接超时
+	Timeout        time.Duration   `json:"timeout"`        // 查询实例的超时时间
+	Clusters       []ClusterConfig `json:"clusters"`
+}
+
+// ClusterConfig 下发给 envoy 的集群
+type ClusterConfig struct {
+	Service string `json:"service"`
+	Scheme  string `json:"scheme"` // 只包含该协议的实例，为空时为 grpc
+	Name    string `json:"name"`   // 集群名称，为空时为服务名
+}
+
+// Server ...
+type Server struct {
+	config   *Config
+	resolver registry.Resolver
+	clusters map[string]ClusterConfig // 集群名称 -> 集群
+	names    []string
+
+	server *http.Server
+}
+
+// New ...
+func New(config *Config, resolver registry.Resolver) *Server {
+	s := &Server{config: config, resolver: resolver, clusters: make(map[string]ClusterConfig)}
+	for _, cluster := range config.Clusters {
+		if cluster.Scheme == "" {
+			cluster.Scheme = "grpc"
+		}
+		if cluster.Name == "" {
+			cluster.Name = cluster.Service
+		}
+		if _, ok := s.clusters[cluster.Name]; !ok {
+			s.names = append(s.names, cluster.Name)
+		}
+		s.clusters[cluster.Name] = cluster
+	}
+	return s
+}
+
+// Start ...
+func (s *Server) Start() error {
+	lis, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return err
+	}
+	s.server = &http.Server{Handler: s.handler()}
+	go func() {
+		if err := s.server.Serve(lis); err != nil && err != http.ErrServerClosed {
+			logging.Logger("proxy").Error("xds serve", xlog.FieldErr(err))
+		}
+	}()
+	return nil
+}
+
+// Close ...
+func (s *Server) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/discovery:clusters", s.discovery(TypeCluster, s.clusterResources))
+	mux.HandleFunc("/v3/discovery:endpoints", s.discovery(TypeEndpoint, s.endpointResources))
+	return mux
+}
+
+// discoveryRequest envoy 的 DiscoveryRequest，只用到其中的版本及资源名称
+type discoveryRequest struct {
+	VersionInfo   string   `json:"version_info"`
+	ResourceNames []string `json:"resource_names"`
+	TypeURL       string   `json:"type_url"`
+}
+
+type discoveryResponse struct {
+	VersionInfo string        `json:"version_info"`
+	Resources   []interface{} `json:"resources"`
+	TypeURL     string        `json:"type_url"`
+	Nonce       string        `json:"nonce"`
+}
+
+// discovery 版本为资源内容的摘要，与 envoy 已有的版本相同时返回 304
+func (s *Server) discovery(typeURL string, resources func(ctx context.Context, names []string) ([]interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req discoveryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), s.config.Timeout)
+		defer cancel()
+		items, err := resources(ctx, req.ResourceNames)
+		if err != nil {
+			logging.Logger("proxy").Warn("xds resources", xlog.String("type", typeURL), xlog.FieldErr(err))
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		content, err := json.Marshal(items)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sum := sha1.Sum(content)
+		version := hex.EncodeToString(sum[:8])
+		if version == req.VersionInfo {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(discoveryResponse{
+			VersionInfo: version,
+			Resources:   items,
+			TypeURL:     typeURL,
+			Nonce:       version,
+		})
+	}
+}
+
+// clusterResources CDS 总是下发全部集群
+func (s *Server) clusterResources(ctx context.Context, _ []string) ([]interface{}, error) {
+	resources := make([]interface{}, 0, len(s.names))
+	for _, name := range s.names {
+		cluster := map[string]interface{}{
+			"@type":           TypeCluster,
+			"name":            name,
+			"type":            "EDS",
+			"connect_timeout": duration(s.config.ConnectTimeout),
+			"lb_policy":       "ROUND_ROBIN",
+			"eds_cluster_config": map[string]interface{}{
+				"service_name": name,
+				"eds_config": map[string]interface{}{
+					"resource_api_version": "V3",
+					"api_config_source": map[string]interface{}{
+						"api_type":              "REST",
+						"transport_api_version": "V3",
+						"cluster_names":         []string{s.config.ClusterName},
+						"refresh_delay":         duration(s.config.RefreshDelay),
+					},
+				},
+			},
+		}
+		if s.clusters[name].Scheme == "grpc" {
+			cluster["http2_protocol_options"] = map[string]interface{}{}
+		}
+		resources = append(resources, cluster)
+	}
+	return resources, nil
+}
+
+// endpointResources 未知的集群不下发
+func (s *Server) endpointResources(ctx context.Context, names []string) ([]interface{}, error) {
+	if len(names) == 0 {
+		names = s.names
+	}
+	resources := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		cluster, ok := s.clusters[name]
+		if !ok {
+			continue
+		}
+		endpoints, err := s.resolver.Resolve(ctx, cluster.Service)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %s: %w", cluster.Service, err)
+		}
+		lbEndpoints := make([]interface{}, 0, len(endpoints))
+		for _, endpoint := range endpoints {
+			if endpoint.Scheme != cluster.Scheme {
+				continue
+			}
+			lbEndpoints = append(lbEndpoints, map[string]interface{}{
+				"endpoint": map[string]interface{}{
+					"address": map[string]interface{}{
+						"socket_address": map[string]interface{}{
+							"address":    endpoint.IP.String(),
+							"port_value": endpoint.Port,
+						},
+					},
+				},
+				"health_status": healthStatus(endpoint.Health),
+			})
+		}
+		resources = append(resources, map[string]interface{}{
+			"@type":        TypeEndpoint,
+			"cluster_name": name,
+			"endpoints":    []interface{}{map[string]interface{}{"lb_endpoints": lbEndpoints}},
+		})
+	}
+	return resources, nil
+}
+
+// healthStatus 探测结果对应 envoy 的健康状态，没有探测的实例由 envoy 自行判断
+func healthStatus(health string) string {
+	switch health {
+	case registry.HealthPassing:
+		return "HEALTHY"
+	case registry.HealthCritical:
+		return "UNHEALTHY"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// duration proto3 json 中的 Duration
+func duration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/proxy/regProxy/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+type staticResolver map[string][]registry.Endpoint
+
+func (r staticResolver) Resolve(ctx context.Context, service string) ([]registry.Endpoint, error) {
+	return r[service], nil
+}
+
+func TestEndpointDiscovery(t *testing.T) {
+	s := New(&Config{ClusterName: "juno-agent", RefreshDelay: time.Second, ConnectTimeout: time.Second, Timeout: time.Second,
+		Clusters: []ClusterConfig{{Service: "user-svc"}},
+	}, staticResolver{
+		"user-svc": {
+			{Scheme: "grpc", IP: net.ParseIP("10.0.0.1"), Port: 9091, Health: registry.HealthCritical},
+			{Scheme: "http", IP: net.ParseIP("10.0.0.1"), Port: 9090},
+		},
+	})
+	server := httptest.NewServer(s.handler())
+	defer server.Close()
+
+	discover := func(path, version string) (*http.Response, map[string]interface{}) {
+		body := `{"version_info":"` + version + `","resource_names":["user-svc"]}`
+		resp, err := http.Post(server.URL+path, "application/json", strings.NewReader(body))
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		var out map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp, out
+	}
+
+	resp, out := discover("/v3/discovery:endpoints", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, TypeEndpoint, out["type_url"])
+	resource := out["resources"].([]interface{})[0].(map[string]interface{})
+	lbEndpoints := resource["endpoints"].([]interface{})[0].(map[string]interface{})["lb_endpoints"].([]interface{})
+	// 只包含 grpc 的实例，探测失败的实例为 UNHEALTHY
+	if assert.Len(t, lbEndpoints, 1) {
+		assert.Equal(t, "UNHEALTHY", lbEndpoints[0].(map[string]interface{})["health_status"])
+	}
+
+	// 版本未变时返回 304
+	resp, _ = discover("/v3/discovery:endpoints", out["version_info"].(string))
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	_, out = discover("/v3/discovery:clusters", "")
+	cluster := out["resources"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "user-svc", cluster["name"])
+	assert.Equal(t, "1s", cluster["connect_timeout"])
+	assert.Contains(t, cluster, "http2_protocol_options")
+}
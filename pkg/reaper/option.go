@@ -0,0 +1,76 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reaper
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/platform"
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config zombie reaper config. The reaper runs when the agent is PID 1, e.g. the
+// entrypoint of a container, or when Subreaper is set
+type Config struct {
+	// register the agent as child subreaper, so orphaned descendants of jobs are
+	// reparented to the agent instead of PID 1 and reaped here
+	Subreaper bool          `json:"subreaper"`
+	Interval  time.Duration `json:"interval"` // how often children are scanned besides on SIGCHLD
+	// how long a zombie child is left to the code that started it before it is
+	// reaped, so exit statuses of commands waited by their owners are not stolen
+	Grace time.Duration `json:"grace"`
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadReaperConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Interval: 30 * time.Second,
+		Grace:    5 * time.Second,
+	}
+}
+
+// Build new a instance
+func (c *Config) Build() *Reaper {
+	if c.Interval <= 0 {
+		c.Interval = 30 * time.Second
+	}
+	if c.Grace < 0 {
+		c.Grace = 0
+	}
+	enabled := os.Getpid() == 1 || c.Subreaper
+	if enabled && !platform.Supported(platform.ProcFS) {
+		xlog.Warn("plugin", xlog.String("reaper", "disabled"), xlog.FieldErr(platform.ErrNotSupported))
+		enabled = false
+	}
+	return &Reaper{
+		config:  c,
+		enabled: enabled,
+		pending: make(map[int]time.Time),
+		stop:    make(chan struct{}),
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reaper
+
+import (
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/metric"
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+var reapedCounter = metric.CounterVecOpts{
+	Namespace: "juno",
+	Subsystem: "agent",
+	Name:      "reaped_zombies_total",
+	Help:      "zombie children reaped because nobody else waited for them",
+	Labels:    []string{},
+}.Build()
+
+// Reaper collects exited children that nobody waits for. Without it a job that
+// leaves background processes behind fills the process table with zombies when
+// the agent is PID 1, since orphans are reparented to the agent
+type Reaper struct {
+	config  *Config
+	enabled bool
+
+	mu      sync.Mutex
+	pending map[int]time.Time // pid of zombie child -> first seen
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// Start reap on SIGCHLD and on every interval in background
+func (r *Reaper) Start() error {
+	if !r.enabled {
+		return nil
+	}
+	signals, err := watch(r.config.Subreaper)
+	if err != nil {
+		return err
+	}
+	xlog.Info("plugin", xlog.String("reaper", "start"), xlog.Any("subreaper", r.config.Subreaper))
+
+	xgo.Go(func() {
+		defer signal.Stop(signals)
+		ticker := time.NewTicker(r.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-signals:
+			case <-ticker.C:
+			case <-r.stop:
+				return
+			}
+			if n := r.Reap(time.Now()); n > 0 {
+				xlog.Info("reaped zombie children", xlog.Int("count", n))
+			}
+		}
+	})
+	return nil
+}
+
+// Stop stops reaping in background, it can be called more than once
+func (r *Reaper) Stop() {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+}
+
+// Reap waits for zombie children that have been zombies for longer than Grace,
+// returns how many were reaped
+func (r *Reaper) Reap(now time.Time) int {
+	zombies, err := zombieChildren()
+	if err != nil {
+		xlog.Warn("list zombie children failed", xlog.FieldErr(err))
+		return 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := make(map[int]time.Time, len(zombies))
+	reaped := 0
+	for _, pid := range zombies {
+		first, ok := r.pending[pid]
+		if !ok {
+			first = now
+		}
+		if now.Sub(first) < r.config.Grace {
+			seen[pid] = first
+			continue
+		}
+		if reap(pid) {
+			reaped++
+			reapedCounter.Inc()
+		}
+	}
+	// children reaped by their owners are forgotten
+	r.pending = seen
+	return reaped
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reaper
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStat(t *testing.T) {
+	state, ppid, ok := parseStat([]byte("1234 (sh) Z 1 1234 1234 0 -1 4194308"))
+	assert.True(t, ok)
+	assert.Equal(t, byte('Z'), state)
+	assert.Equal(t, 1, ppid)
+
+	// comm with spaces and parentheses
+	state, ppid, ok = parseStat([]byte("99 (a) b (c)) S 42 99 99"))
+	assert.True(t, ok)
+	assert.Equal(t, byte('S'), state)
+	assert.Equal(t, 42, ppid)
+
+	_, _, ok = parseStat([]byte("garbage"))
+	assert.False(t, ok)
+}
+
+func TestReap(t *testing.T) {
+	config := DefaultConfig()
+	config.Grace = time.Minute
+	r := config.Build()
+
+	// started but never waited, becomes a zombie child of the test process
+	cmd := exec.Command("true")
+	assert.Nil(t, cmd.Start())
+	pid := cmd.Process.Pid
+	assert.Eventually(t, func() bool {
+		zombies, err := zombieChildren()
+		assert.Nil(t, err)
+		for _, zombie := range zombies {
+			if zombie == pid {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+
+	now := time.Now()
+	assert.Equal(t, 0, r.Reap(now), "zombie is left to its owner within grace")
+	assert.Equal(t, 1, r.Reap(now.Add(time.Minute)))
+	assert.Empty(t, r.pending)
+}
+
+func TestStop(t *testing.T) {
+	config := DefaultConfig()
+	config.Subreaper = true
+	r := config.Build()
+	assert.Nil(t, r.Start())
+
+	// stopped by the engine on shutdown, stopping twice must not panic
+	r.Stop()
+	r.Stop()
+}
@@ -0,0 +1,36 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package reaper
+
+import (
+	"os"
+
+	"github.com/douyu/juno-agent/pkg/platform"
+)
+
+func watch(subreaper bool) (chan os.Signal, error) {
+	return nil, platform.ErrNotSupported
+}
+
+func zombieChildren() ([]int, error) {
+	return nil, platform.ErrNotSupported
+}
+
+func reap(pid int) bool {
+	return false
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reboot
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config reboot workflow config
+type Config struct {
+	Enable        bool          `json:"enable"`
+	StatePath     string        `json:"state_path"`     // survives the reboot, must not be on tmpfs
+	Command       []string      `json:"command"`        // command that reboots the host
+	Delay         time.Duration `json:"delay"`          // wait between drain finished and reboot
+	DrainTimeout  time.Duration `json:"drain_timeout"`  // running jobs still running after timeout are interrupted by the reboot
+	VerifyTimeout time.Duration `json:"verify_timeout"` // services not recovered within timeout fail the workflow
+	ReportAddr    string        `json:"report_addr"`    // state changes are posted to the address if not empty
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadRebootConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable:        false,
+		StatePath:     "/var/lib/juno-agent/reboot.json",
+		Command:       []string{"shutdown", "-r", "now"},
+		Delay:         10 * time.Second,
+		DrainTimeout:  10 * time.Minute,
+		VerifyTimeout: 10 * time.Minute,
+	}
+}
+
+// Build new a instance
+func (c *Config) Build() *Orchestrator {
+	if c.Enable {
+		xlog.Info("plugin", xlog.String("reboot", "start"))
+	}
+	return &Orchestrator{
+		config:  c,
+		bootID:  readBootID,
+		execute: execute,
+	}
+}
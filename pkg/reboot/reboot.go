@@ -0,0 +1,330 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reboot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/go-resty/resty/v2"
+)
+
+// phases of a reboot workflow
+const (
+	PhaseDraining  = "draining"  // jobs and registrations are being drained
+	PhaseRebooting = "rebooting" // reboot command is scheduled
+	PhaseVerifying = "verifying" // host is back, waiting for services to recover
+	PhaseCompleted = "completed"
+	PhaseFailed    = "failed"
+)
+
+var (
+	// ErrDisabled is returned when reboot is requested but the plugin is not enabled
+	ErrDisabled = errors.New("reboot workflow is disabled")
+	// ErrInProgress is returned when a reboot is requested during another one
+	ErrInProgress = errors.New("reboot is already in progress")
+)
+
+// interval of checking whether services have recovered
+var verifyInterval = 5 * time.Second
+
+// State of a reboot workflow, persisted so that it can be resumed after the host comes back
+type State struct {
+	Phase        string     `json:"phase"`
+	Reason       string     `json:"reason"`
+	RequestedAt  time.Time  `json:"requested_at"`
+	ExpectedBack time.Time  `json:"expected_back"` // maintenance is expected to end before this time
+	BootID       string     `json:"boot_id"`       // boot id before reboot, tells whether the host has rebooted
+	Services     []string   `json:"services"`      // services running before reboot, verified after restart
+	Missing      []string   `json:"missing,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+// Active reports whether the host is under maintenance of the workflow
+func (s State) Active() bool {
+	return s.Phase != "" && s.Phase != PhaseCompleted && s.Phase != PhaseFailed
+}
+
+// Orchestrator drains the host, reboots it and verifies services after restart
+type Orchestrator struct {
+	config *Config
+
+	mu    sync.Mutex
+	state *State
+
+	// Drain stops jobs and service registrations on current host
+	Drain func(ctx context.Context) error
+	// Undrain resumes jobs and registrations when the host does not go down after Drain
+	Undrain func()
+	// Services returns services running on current host
+	Services func() []string
+	// OnChange is called after each phase transition
+	OnChange func(state State)
+
+	bootID  func() string
+	execute func(command []string) error
+}
+
+// Start resume the workflow interrupted by the reboot
+func (o *Orchestrator) Start() error {
+	if !o.config.Enable {
+		return nil
+	}
+
+	state, err := o.load()
+	if err != nil || state == nil {
+		return err
+	}
+	o.state = state
+	if !state.Active() {
+		return nil
+	}
+
+	if state.BootID != "" && state.BootID == o.bootID() {
+		o.finish(PhaseFailed, "agent restarted before the host rebooted", nil)
+		return nil
+	}
+
+	o.transition(PhaseVerifying)
+	xgo.Go(o.verify)
+	return nil
+}
+
+// Request drain the host and reboot it in background, downtime is the expected
+// time the host takes to come back after the reboot command
+func (o *Orchestrator) Request(reason string, downtime time.Duration) (State, error) {
+	if !o.config.Enable {
+		return State{}, ErrDisabled
+	}
+
+	o.mu.Lock()
+	if o.state != nil && o.state.Active() {
+		o.mu.Unlock()
+		return State{}, ErrInProgress
+	}
+
+	now := time.Now()
+	o.state = &State{
+		Phase:        PhaseDraining,
+		Reason:       reason,
+		RequestedAt:  now,
+		ExpectedBack: now.Add(o.config.DrainTimeout + o.config.Delay + downtime),
+		BootID:       o.bootID(),
+		Services:     o.services(),
+	}
+	state := *o.state
+	o.mu.Unlock()
+
+	o.changed(state)
+	xgo.Go(o.run)
+	return state, nil
+}
+
+// Status returns the latest workflow, false if no reboot has been requested
+func (o *Orchestrator) Status() (State, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.state == nil {
+		return State{}, false
+	}
+	return *o.state, true
+}
+
+func (o *Orchestrator) run() {
+	if o.Drain != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), o.config.DrainTimeout)
+		if err := o.Drain(ctx); err != nil {
+			// reboot anyway, the maintenance window has been announced
+			xlog.Warn("drain before reboot not finished", xlog.FieldErr(err))
+		}
+		cancel()
+	}
+
+	o.transition(PhaseRebooting)
+	time.Sleep(o.config.Delay)
+
+	xlog.Info("reboot host", xlog.Any("command", o.config.Command))
+	if err := o.execute(o.config.Command); err != nil {
+		o.finish(PhaseFailed, "reboot command failed: "+err.Error(), nil)
+		o.undrain()
+		return
+	}
+
+	// the agent is still running when the host should have been back,
+	// the reboot was cancelled or ignored, do not leave the host drained
+	o.mu.Lock()
+	wait := time.Until(o.state.ExpectedBack)
+	o.mu.Unlock()
+	time.Sleep(wait)
+	o.mu.Lock()
+	rebooting := o.state.Phase == PhaseRebooting
+	o.mu.Unlock()
+	if rebooting {
+		o.finish(PhaseFailed, "host did not reboot before the expected time", nil)
+		o.undrain()
+	}
+}
+
+func (o *Orchestrator) undrain() {
+	if o.Undrain != nil {
+		o.Undrain()
+	}
+}
+
+func (o *Orchestrator) verify() {
+	deadline := time.Now().Add(o.config.VerifyTimeout)
+	for {
+		missing := o.missing()
+		if len(missing) == 0 {
+			o.finish(PhaseCompleted, "", nil)
+			return
+		}
+		if time.Now().After(deadline) {
+			o.finish(PhaseFailed, "services not recovered: "+strings.Join(missing, ","), missing)
+			return
+		}
+		time.Sleep(verifyInterval)
+	}
+}
+
+// missing returns services running before reboot but not running now
+func (o *Orchestrator) missing() []string {
+	running := make(map[string]struct{})
+	for _, service := range o.services() {
+		running[service] = struct{}{}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var missing []string
+	for _, service := range o.state.Services {
+		if _, ok := running[service]; !ok {
+			missing = append(missing, service)
+		}
+	}
+	return missing
+}
+
+func (o *Orchestrator) services() []string {
+	if o.Services == nil {
+		return nil
+	}
+	return o.Services()
+}
+
+func (o *Orchestrator) transition(phase string) {
+	o.mu.Lock()
+	o.state.Phase = phase
+	state := *o.state
+	o.mu.Unlock()
+
+	o.changed(state)
+}
+
+func (o *Orchestrator) finish(phase string, reason string, missing []string) {
+	now := time.Now()
+
+	o.mu.Lock()
+	o.state.Phase = phase
+	o.state.Error = reason
+	o.state.Missing = missing
+	o.state.FinishedAt = &now
+	state := *o.state
+	o.mu.Unlock()
+
+	o.changed(state)
+}
+
+// changed persist and report the state
+func (o *Orchestrator) changed(state State) {
+	xlog.Info("reboot", xlog.String("phase", state.Phase), xlog.String("reason", state.Reason), xlog.String("error", state.Error))
+	if err := o.save(state); err != nil {
+		xlog.Error("save reboot state failed", xlog.FieldErr(err))
+	}
+	if o.OnChange != nil {
+		o.OnChange(state)
+	}
+	if o.config.ReportAddr != "" {
+		if _, err := resty.New().SetTimeout(10 * time.Second).R().SetBody(state).Post(o.config.ReportAddr); err != nil {
+			xlog.Warn("report reboot state failed", xlog.FieldErr(err))
+		}
+	}
+}
+
+func (o *Orchestrator) load() (*State, error) {
+	data, err := ioutil.ReadFile(o.config.StatePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := &State{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// save write to a temporary file then rename, the host may go down at any time
+func (o *Orchestrator) save(state State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(o.config.StatePath), 0755); err != nil {
+		return err
+	}
+
+	tmp := o.config.StatePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, o.config.StatePath)
+}
+
+// readBootID changes on every boot, empty if not available on current platform
+func readBootID() string {
+	data, err := ioutil.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func execute(command []string) error {
+	if len(command) == 0 {
+		return errors.New("empty reboot command")
+	}
+	output, err := exec.Command(command[0], command[1:]...).CombinedOutput()
+	if err != nil {
+		return errors.New(err.Error() + ": " + strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reboot
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReboot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reboot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	verifyInterval = 10 * time.Millisecond
+	config := DefaultConfig()
+	config.Enable = true
+	config.StatePath = filepath.Join(dir, "reboot.json")
+	config.Delay = 0
+
+	rebooted := make(chan []string, 1)
+	drained := false
+	o := config.Build()
+	o.bootID = func() string { return "boot-1" }
+	o.execute = func(command []string) error {
+		rebooted <- command
+		return nil
+	}
+	o.Drain = func(ctx context.Context) error {
+		drained = true
+		return nil
+	}
+	o.Services = func() []string { return []string{"app-a", "app-b"} }
+
+	state, err := o.Request("kernel patch", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, PhaseDraining, state.Phase)
+	assert.Equal(t, []string{"app-a", "app-b"}, state.Services)
+
+	_, err = o.Request("again", time.Minute)
+	assert.Equal(t, ErrInProgress, err)
+
+	assert.Equal(t, []string{"shutdown", "-r", "now"}, <-rebooted)
+	assert.True(t, drained)
+
+	// the host comes back with a new boot id, app-b recovers later
+	var running atomic.Value
+	running.Store([]string{"app-a"})
+	resumed := config.Build()
+	resumed.bootID = func() string { return "boot-2" }
+	resumed.Services = func() []string { return running.Load().([]string) }
+	done := make(chan State, 1)
+	resumed.OnChange = func(state State) {
+		if !state.Active() {
+			done <- state
+		}
+	}
+	assert.NoError(t, resumed.Start())
+	state, _ = resumed.Status()
+	assert.Equal(t, PhaseVerifying, state.Phase)
+
+	running.Store([]string{"app-a", "app-b"})
+	state = <-done
+	assert.Equal(t, PhaseCompleted, state.Phase)
+	assert.NotNil(t, state.FinishedAt)
+}
+
+func TestRebootNotHappened(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reboot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.Enable = true
+	config.StatePath = filepath.Join(dir, "reboot.json")
+
+	o := config.Build()
+	o.bootID = func() string { return "boot-1" }
+	assert.NoError(t, o.save(State{Phase: PhaseRebooting, BootID: "boot-1"}))
+
+	assert.NoError(t, o.Start())
+	state, ok := o.Status()
+	assert.True(t, ok)
+	assert.Equal(t, PhaseFailed, state.Phase)
+}
+
+func TestRebootFailedUndrain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reboot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.Enable = true
+	config.StatePath = filepath.Join(dir, "reboot.json")
+	config.Delay = 0
+	config.DrainTimeout = 0
+
+	undrained := make(chan struct{}, 1)
+	o := config.Build()
+	o.bootID = func() string { return "boot-1" }
+	o.Drain = func(ctx context.Context) error { return nil }
+	o.Undrain = func() { undrained <- struct{}{} }
+
+	// the reboot command fails
+	o.execute = func(command []string) error { return errors.New("permission denied") }
+	_, err = o.Request("kernel patch", 0)
+	assert.NoError(t, err)
+	<-undrained
+	state, _ := o.Status()
+	assert.Equal(t, PhaseFailed, state.Phase)
+
+	// the reboot command succeeds but the host never goes down
+	o.execute = func(command []string) error { return nil }
+	_, err = o.Request("kernel patch", 10*time.Millisecond)
+	assert.NoError(t, err)
+	<-undrained
+	state, _ = o.Status()
+	assert.Equal(t, PhaseFailed, state.Phase)
+	assert.Contains(t, state.Error, "did not reboot")
+}
@@ -15,8 +15,11 @@
 package report
 
 import (
-	"github.com/douyu/juno-agent/pkg/model"
+	"runtime"
 	"time"
+
+	"github.com/douyu/juno-agent/pkg/model"
+	"github.com/douyu/juno-agent/pkg/platform"
 )
 
 // ReporterResp ...
@@ -35,6 +38,18 @@ type Reporter interface {
 type Report struct {
 	config *Config
 	Reporter
+	// app containers on the node, included in the status report when set
+	containers func() []model.ContainerStatus
+}
+
+// Config returns the node information resolved from environment variables
+func (r *Report) Config() Config {
+	return *r.config
+}
+
+// SetContainers include app containers in the status report, call it before ReportAgentStatus
+func (r *Report) SetContainers(containers func() []model.ContainerStatus) {
+	r.containers = containers
 }
 
 // ReportAgentStatus report agent status
@@ -54,6 +69,12 @@ func (r *Report) ReportAgentStatus() error {
 				ZoneCode:     r.config.ZoneCode,
 				ZoneName:     r.config.ZoneName,
 				Env:          r.config.Env,
+				OS:           runtime.GOOS,
+				Arch:         runtime.GOARCH,
+				Capabilities: platform.Map(),
+			}
+			if r.containers != nil {
+				req.Containers = r.containers()
 			}
 			r.Reporter.Report(req)
 			time.Sleep(time.Duration(r.config.Internal))
@@ -0,0 +1,82 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secret
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+const (
+	BackendEtcd  = "etcd"  // encrypted values under the job store secret prefix
+	BackendVault = "vault" // HashiCorp Vault KV engine, v1 or v2
+)
+
+// Config secret store used to resolve secret:// references in job env
+type Config struct {
+	Backend string      `json:"backend"`
+	Vault   VaultConfig `json:"vault"`
+}
+
+// VaultConfig vault server and credentials, Token is read from TokenFile if empty
+type VaultConfig struct {
+	Addr      string        `json:"addr"`       // e.g. https://vault.example.com:8200
+	Token     string        `json:"token"`      // token with read access to the referenced paths
+	TokenFile string        `json:"token_file"` // e.g. a file rendered by vault agent
+	Namespace string        `json:"namespace"`  // enterprise namespace, sent as X-Vault-Namespace
+	Timeout   time.Duration `json:"timeout"`
+	// paths under /v1 that can be read, the token may read much more, e.g. sys/ and auth/.
+	// {team} and {owner} are replaced with those of the job, prefixes using them are skipped if they are empty
+	Prefixes []string `json:"prefixes"`
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadSecretConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Backend: BackendEtcd,
+		Vault: VaultConfig{
+			Addr:     "http://127.0.0.1:8200",
+			Timeout:  5 * time.Second,
+			Prefixes: []string{"secret/data/juno/{team}/"},
+		},
+	}
+}
+
+// Build returns the provider of the configured backend,
+// nil is returned for the etcd backend which is served by the job store itself
+func (c *Config) Build() (Provider, error) {
+	switch c.Backend {
+	case "", BackendEtcd:
+		return nil, nil
+	case BackendVault:
+		xlog.Info("plugin", xlog.String("secret", "vault"), xlog.String("addr", c.Vault.Addr))
+		return newVault(&c.Vault)
+	default:
+		return nil, fmt.Errorf("unknown secret backend: %s", c.Backend)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secret
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Scheme prefix of values referring to a secret, e.g. secret://db/orders#password
+const Scheme = "secret://"
+
+// Ref points to a key of the secret stored at Path
+type Ref struct {
+	Path string
+	Key  string
+}
+
+func (r Ref) String() string {
+	return Scheme + r.Path + "#" + r.Key
+}
+
+// Scope the job a secret is read for, providers may limit the paths it can read
+type Scope struct {
+	Team  string
+	Owner string
+}
+
+// Provider reads all key/value pairs of a secret
+type Provider interface {
+	Get(ctx context.Context, scope Scope, path string) (map[string]string, error)
+}
+
+// IsRef reports whether value refers to a secret
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, Scheme)
+}
+
+// ParseRef parses a secret://path#key reference
+func ParseRef(value string) (Ref, error) {
+	if !IsRef(value) {
+		return Ref{}, fmt.Errorf("secret reference should start with %s", Scheme)
+	}
+	ref := strings.TrimPrefix(value, Scheme)
+	i := strings.LastIndex(ref, "#")
+	if i <= 0 || i == len(ref)-1 {
+		return Ref{}, errors.New("secret reference should be secret://path#key")
+	}
+	path := strings.Trim(ref[:i], "/")
+	if err := validPath(path); err != nil {
+		return Ref{}, err
+	}
+	return Ref{Path: path, Key: ref[i+1:]}, nil
+}
+
+// validPath refuses dot segments and characters changing the request url,
+// so that a path can not leave the prefixes it is checked against
+func validPath(path string) error {
+	if strings.ContainsAny(path, "?#%\\") {
+		return fmt.Errorf("invalid secret path %q", path)
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("invalid secret path %q", path)
+		}
+	}
+	return nil
+}
+
+// Resolve reads the value of ref for scope from provider, errors never contain secret values
+func Resolve(ctx context.Context, provider Provider, scope Scope, ref Ref) (string, error) {
+	values, err := provider.Get(ctx, scope, ref.Path)
+	if err != nil {
+		return "", fmt.Errorf("read secret %s: %w", ref.Path, err)
+	}
+	value, ok := values[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in secret %s", ref.Key, ref.Path)
+	}
+	return value, nil
+}
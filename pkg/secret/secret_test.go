@@ -0,0 +1,89 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secret
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRef(t *testing.T) {
+	ref, err := ParseRef("secret://kv/data/db/orders#password")
+	assert.NoError(t, err)
+	assert.Equal(t, Ref{Path: "kv/data/db/orders", Key: "password"}, ref)
+
+	for _, value := range []string{"password", "secret://db", "secret://#key", "secret://db#", "secret://kv/data/../../sys/seal#x", "secret://kv//db#x", "secret://kv/db?list=true#x"} {
+		_, err := ParseRef(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestVault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/kv/data/db":
+			_, _ = w.Write([]byte(`{"data": {"data": {"password": "p@ss", "port": 3306}, "metadata": {"version": 2}}}`))
+		case "/v1/secret/db":
+			_, _ = w.Write([]byte(`{"data": {"password": "old"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.Backend = BackendVault
+	config.Vault.Addr = server.URL
+	config.Vault.Token = "s.token"
+	config.Vault.Prefixes = []string{"kv/data/", "secret/"}
+	provider, err := config.Build()
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	value, err := Resolve(ctx, provider, Scope{}, Ref{Path: "kv/data/db", Key: "password"})
+	assert.NoError(t, err)
+	assert.Equal(t, "p@ss", value)
+	value, err = Resolve(ctx, provider, Scope{}, Ref{Path: "kv/data/db", Key: "port"})
+	assert.NoError(t, err)
+	assert.Equal(t, "3306", value)
+	value, err = Resolve(ctx, provider, Scope{}, Ref{Path: "secret/db", Key: "password"})
+	assert.NoError(t, err)
+	assert.Equal(t, "old", value)
+
+	_, err = Resolve(ctx, provider, Scope{}, Ref{Path: "secret/db", Key: "user"})
+	assert.Error(t, err)
+	_, err = Resolve(ctx, provider, Scope{}, Ref{Path: "secret/missing", Key: "user"})
+	assert.Error(t, err)
+	// paths outside the prefixes are not requested with the agent token
+	_, err = Resolve(ctx, provider, Scope{}, Ref{Path: "auth/token/lookup-self", Key: "id"})
+	assert.Contains(t, err.Error(), "not under the prefixes")
+}
+
+func TestVaultScope(t *testing.T) {
+	v := &vault{config: &VaultConfig{Prefixes: []string{"kv/data/teams/{team}/", "kv/data/users/{owner}/"}}}
+	assert.True(t, v.allowed(Scope{Team: "ops"}, "kv/data/teams/ops/db"))
+	assert.False(t, v.allowed(Scope{Team: "dev"}, "kv/data/teams/ops/db"))
+	assert.False(t, v.allowed(Scope{}, "kv/data/teams//db"))
+	assert.True(t, v.allowed(Scope{Owner: "alice"}, "kv/data/users/alice/token"))
+	assert.False(t, v.allowed(Scope{Owner: "bob"}, "kv/data/users/alice/token"))
+}
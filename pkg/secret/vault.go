@@ -0,0 +1,136 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// vault reads secrets with the HTTP API, KV v2 responses are unwrapped from data.data
+type vault struct {
+	config *VaultConfig
+	client *http.Client
+}
+
+func newVault(config *VaultConfig) (*vault, error) {
+	if config.Addr == "" {
+		return nil, errors.New("vault addr is required")
+	}
+	if config.Token == "" && config.TokenFile == "" {
+		return nil, errors.New("vault token or token file is required")
+	}
+	if len(config.Prefixes) == 0 {
+		return nil, errors.New("vault prefixes are required")
+	}
+	for _, prefix := range config.Prefixes {
+		if !strings.HasSuffix(prefix, "/") || validPath(strings.TrimSuffix(prefix, "/")) != nil {
+			return nil, fmt.Errorf("invalid vault prefix %q, should be a path ending with /", prefix)
+		}
+	}
+	return &vault{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// token the token file is read on every request so that renewed tokens are picked up
+func (v *vault) token() (string, error) {
+	if v.config.Token != "" {
+		return v.config.Token, nil
+	}
+	data, err := ioutil.ReadFile(v.config.TokenFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// allowed whether path lies under one of the prefixes for scope
+func (v *vault) allowed(scope Scope, path string) bool {
+	for _, prefix := range v.config.Prefixes {
+		if strings.Contains(prefix, "{team}") && scope.Team == "" || strings.Contains(prefix, "{owner}") && scope.Owner == "" {
+			continue
+		}
+		prefix = strings.NewReplacer("{team}", scope.Team, "{owner}", scope.Owner).Replace(prefix)
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *vault) Get(ctx context.Context, scope Scope, path string) (map[string]string, error) {
+	if err := validPath(path); err != nil {
+		return nil, err
+	}
+	if !v.allowed(scope, path) {
+		return nil, fmt.Errorf("path %s is not under the prefixes allowed for team %q", path, scope.Team)
+	}
+	token, err := v.token()
+	if err != nil {
+		return nil, fmt.Errorf("read vault token: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(v.config.Addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("X-Vault-Token", token)
+	if v.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.config.Namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil, fmt.Errorf("vault responded %s", resp.Status)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	data := body.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, v2 := data["metadata"]; v2 {
+			data = inner
+		}
+	}
+
+	values := make(map[string]string, len(data))
+	for key, value := range data {
+		if s, ok := value.(string); ok {
+			values[key] = s
+		} else {
+			raw, _ := json.Marshal(value)
+			values[key] = string(raw)
+		}
+	}
+	return values, nil
+}
@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 )
 
 // ConfNode confuNode 主要代表部署在应用机器上的应用的具体配置信息
@@ -99,6 +100,51 @@ type MetaData struct {
 	Version   string   `json:"version"`
 	Format    string   `json:"format"`
 	Paths     []string `json:"paths"`
+	// content 为 go 模板，写入前用节点信息渲染，如 {{ .IP }}、{{ .Labels.rack }}
+	Template bool `json:"template,omitempty"`
+	// 管理端渲染配置时记录的各段落来源，用于排查配置值的出处
+	Provenance []SectionSource `json:"provenance,omitempty"`
+}
+
+// SectionSource 配置中一个段落由哪个模板、变量、密钥及主机信息生成
+type SectionSource struct {
+	Section   string            `json:"section"`   // 段落名，如 toml 的 jupiter.server，为空时表示第一个段落之前的内容
+	Template  string            `json:"template"`  // 生成该段落的模板
+	Variables map[string]string `json:"variables"` // 引用的变量及取值
+	Secrets   []string          `json:"secrets"`   // 引用的密钥，只有名称
+	Facts     map[string]string `json:"facts"`     // 引用的主机信息，如 hostname、ip
+}
+
+// ConfDiff 配置文件两个版本之间的 unified diff，版本为 current 时表示当前内容
+type ConfDiff struct {
+	Path string `json:"path"`
+	From string `json:"from"`
+	To   string `json:"to"`
+	Diff string `json:"diff"`
+}
+
+// ConfExplanation 配置文件各段落的来源及在文件中的行号
+type ConfExplanation struct {
+	Path     string           `json:"path"`
+	AppName  string           `json:"app_name"`
+	Env      string           `json:"env"`
+	FileName string           `json:"file_name"`
+	Version  string           `json:"version"`
+	Sections []SectionExplain `json:"sections"`
+}
+
+// SectionExplain 段落的来源，行号从 1 开始，段落未在文件中找到时为 0
+type SectionExplain struct {
+	SectionSource
+	StartLine int `json:"start_line"`
+	EndLine   int `json:"end_line"`
+}
+
+// ConfVersion 配置文件被覆盖前保存在 .history 目录下的版本
+type ConfVersion struct {
+	Version string    `json:"version"` // 保存时间的纳秒时间戳，回滚时使用
+	Time    time.Time `json:"time"`
+	Size    int64     `json:"size"`
 }
 
 // CheckValid ...
@@ -135,6 +181,16 @@ type ConfReport struct {
 	Timestamp  int64  `json:"timestamp"`
 	IP         string `json:"ip"`
 	HealthPort string `json:"health_port"`
+	// 配置内容不符合声明的格式时拒绝写入，md5 为空，rejected_md5 为被拒绝的版本
+	RejectedMD5 string `json:"rejected_md5,omitempty"`
+	Error       string `json:"error,omitempty"`
+	ErrorLine   int    `json:"error_line,omitempty"`
+	// agent 写入的文件被修改时为 modified、truncated 或 missing，drift_md5 为文件当前内容的 md5，
+	// healed 为已重新写入应有的内容
+	Drift     string `json:"drift,omitempty"`
+	DriftPath string `json:"drift_path,omitempty"`
+	DriftMD5  string `json:"drift_md5,omitempty"`
+	Healed    bool   `json:"healed,omitempty"`
 }
 
 // JSONString json
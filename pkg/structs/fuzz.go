@@ -0,0 +1,39 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build gofuzz
+// +build gofuzz
+
+package structs
+
+import "bytes"
+
+// Fuzz is the go-fuzz entry of config keys and values written by juno-admin,
+// the first line of data is the key and the rest is the value
+func Fuzz(data []byte) int {
+	key, value := data, []byte(nil)
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		key, value = data[:i], data[i+1:]
+	}
+
+	keyData, err := ParserConfKey(string(key))
+	if err != nil || keyData.CheckValid() != nil {
+		return 0
+	}
+	valueData, err := ParserConfValue(string(value))
+	if err != nil || valueData.CheckValid() != nil {
+		return 0
+	}
+	return 1
+}
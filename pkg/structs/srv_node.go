@@ -78,4 +78,5 @@ type Metadata struct {
 	FileName  string `json:"file_name"` // fileName: config-live/config-trunk
 	Encoded   bool   `json:"encoded"`   // content :Whether the encryption
 	AppName   string `json:"app_name" toml:"app_name" `
+	Template  bool   `json:"template,omitempty"` // content is a go template rendered with node facts before written
 }
@@ -0,0 +1,87 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package terminal
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/audit"
+	"github.com/douyu/juno-agent/pkg/platform"
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/util/xtime"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config web terminal config
+type Config struct {
+	Enable      bool              `json:"enable"`
+	Shell       string            `json:"shell"`
+	Users       map[string]string `json:"users"`        // console user -> local user the shell runs as
+	DefaultUser string            `json:"default_user"` // local user of console users not in Users, refused when empty
+	IdleTimeout time.Duration     `json:"idle_timeout"` // sessions without input for this long are closed
+	MaxSessions int               `json:"max_sessions"`
+	Origins     []string          `json:"origins"`    // allowed Origin of the websocket handshake, every connection is refused when empty
+	TicketKey   string            `json:"ticket_key"` // hmac key of the tickets the admin signs for console users
+	TicketTTL   time.Duration     `json:"ticket_ttl"` // longest lifetime of a ticket accepted
+	RecordDir   string            `json:"record_dir"` // sessions are recorded there in asciicast v2 format
+	RecordAddr  string            `json:"record_addr"`
+	// Audit records the start and end of every session
+	Audit *audit.Log `json:"-"`
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadTerminalConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable:      false,
+		Shell:       "/bin/bash",
+		IdleTimeout: xtime.Duration("10m"),
+		MaxSessions: 5,
+		TicketTTL:   xtime.Duration("1m"),
+		RecordDir:   "/var/log/juno-agent/terminal",
+	}
+}
+
+// Build new a instance
+func (c *Config) Build() *Server {
+	if c.Enable && !ptySupported {
+		xlog.Warn("plugin", xlog.String("terminal", "disabled"), xlog.FieldErr(platform.ErrNotSupported))
+		c.Enable = false
+	}
+	if c.Enable && (c.TicketKey == "" || len(c.Origins) == 0) {
+		xlog.Warn("plugin", xlog.String("terminal", "disabled"), xlog.String("reason", "ticketKey and origins are required"))
+		c.Enable = false
+	}
+	if c.Enable {
+		xlog.Info("plugin", xlog.String("terminal", "start"), xlog.String("shell", c.Shell))
+	}
+	return &Server{
+		config:   c,
+		client:   &http.Client{Timeout: time.Minute},
+		sessions: make(map[string]*Session),
+		tickets:  newTickets(c.TicketKey, c.TicketTTL),
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package terminal
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// ptySupported pseudo terminals are opened through /dev/ptmx
+const ptySupported = true
+
+// startShell run shell as the local user with a new pseudo terminal as its controlling terminal,
+// returns the master side of the terminal
+func startShell(shell string, local *user.User, cols, rows uint16) (*exec.Cmd, *os.File, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer slave.Close()
+	if err := setSize(master, cols, rows); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	cmd := exec.Command(shell, "-l")
+	cmd.Dir = local.HomeDir
+	cmd.Env = []string{
+		"HOME=" + local.HomeDir,
+		"USER=" + local.Username,
+		"LOGNAME=" + local.Username,
+		"SHELL=" + shell,
+		"TERM=xterm-256color",
+		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	attr := &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	uid, err := strconv.ParseUint(local.Uid, 10, 32)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	gid, err := strconv.ParseUint(local.Gid, 10, 32)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	if int(uid) != os.Getuid() {
+		attr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	}
+	cmd.SysProcAttr = attr
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return cmd, master, nil
+}
+
+// stopShell hang up the session like a closed terminal, kill it if it is still running after grace
+func stopShell(cmd *exec.Cmd, exited <-chan struct{}, grace time.Duration) {
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGHUP)
+	select {
+	case <-exited:
+	case <-time.After(grace):
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+func openPTY() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	var n uint32
+	if err := ioctl(master, syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	slave, err := os.OpenFile("/dev/pts/"+strconv.Itoa(int(n)), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+func setSize(f *os.File, cols, rows uint16) error {
+	size := struct{ rows, cols, x, y uint16 }{rows, cols, 0, 0}
+	return ioctl(f, syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&size)))
+}
+
+func ioctl(f *os.File, req, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
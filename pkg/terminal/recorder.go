@@ -0,0 +1,117 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package terminal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// recorder writes a session in asciicast v2 format: a header line followed by
+// [seconds, "i"|"o"|"r", data] events, "i" is keystrokes, "o" is output and "r" is resize
+type recorder struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	w       *bufio.Writer
+	started time.Time
+	pending []byte // incomplete utf-8 character at the end of the last output
+}
+
+func newRecorder(dir, id string, cols, rows uint16, title string) (*recorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, id+".cast")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder{path: path, file: file, w: bufio.NewWriter(file), started: time.Now()}
+	header, _ := json.Marshal(map[string]interface{}{
+		"version":   2,
+		"width":     cols,
+		"height":    rows,
+		"timestamp": r.started.Unix(),
+		"title":     title,
+		"env":       map[string]string{"TERM": "xterm-256color"},
+	})
+	r.w.Write(append(header, '\n'))
+	return r, nil
+}
+
+func (r *recorder) input(data string) {
+	r.event("i", data)
+}
+
+// output a multi-byte character may be split between two reads of the terminal
+func (r *recorder) output(data []byte) {
+	r.mu.Lock()
+	data = append(r.pending, data...)
+	n := completePrefix(data)
+	r.pending = append([]byte(nil), data[n:]...)
+	r.mu.Unlock()
+	if n > 0 {
+		r.event("o", string(data[:n]))
+	}
+}
+
+func (r *recorder) resize(cols, rows uint16) {
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// completePrefix length of data without the trailing incomplete character
+func completePrefix(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(data)
+}
+
+func (r *recorder) event(kind, data string) {
+	line, _ := json.Marshal([]interface{}{time.Since(r.started).Seconds(), kind, data})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return
+	}
+	r.w.Write(append(line, '\n'))
+}
+
+// close flush the recording, events after close are dropped
+func (r *recorder) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.w.Flush()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.file = nil
+	return err
+}
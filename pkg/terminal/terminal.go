@@ -0,0 +1,328 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package terminal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/audit"
+	"github.com/douyu/jupiter/pkg/xlog"
+	"golang.org/x/net/websocket"
+)
+
+// stopGrace time a hung up shell has to exit before its process group is killed
+const stopGrace = 5 * time.Second
+
+var (
+	// ErrDisabled terminal is not enabled
+	ErrDisabled = errors.New("terminal is disabled")
+	// ErrTooManySessions max sessions are running
+	ErrTooManySessions = errors.New("too many terminal sessions")
+)
+
+// Session a running shell
+type Session struct {
+	ID        string    `json:"id"`
+	User      string    `json:"user"`       // console user
+	LocalUser string    `json:"local_user"` // user the shell runs as
+	Client    string    `json:"client"`
+	Started   time.Time `json:"started"`
+	Recording string    `json:"recording"`
+}
+
+// message sent by the console, data of input is written to the shell as is
+type message struct {
+	Type string `json:"type"` // input or resize
+	Data string `json:"data"`
+	Cols uint16 `json:"cols"`
+	Rows uint16 `json:"rows"`
+}
+
+// Server serves shells over websocket, output is sent as binary frames
+// and every keystroke and output is recorded
+type Server struct {
+	config   *Config
+	client   *http.Client
+	tickets  *tickets
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// Sessions running sessions, oldest first
+func (s *Server) Sessions() []Session {
+	s.mu.Lock()
+	sessions := make([]Session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, *sess)
+	}
+	s.mu.Unlock()
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Started.Before(sessions[j].Started)
+	})
+	return sessions
+}
+
+// Handler websocket endpoint of a new session, query: ticket (signed by the admin for the console user), cols and rows
+func (s *Server) Handler() http.Handler {
+	return websocket.Server{Handshake: s.handshake, Handler: s.serve}
+}
+
+// handshake refuse when disabled or the page is not served by an allowed origin
+func (s *Server) handshake(config *websocket.Config, req *http.Request) error {
+	if !s.config.Enable {
+		return ErrDisabled
+	}
+	origin := req.Header.Get("Origin")
+	for _, allowed := range s.config.Origins {
+		if origin == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %q is not allowed", origin)
+}
+
+func (s *Server) serve(ws *websocket.Conn) {
+	defer ws.Close()
+	ws.PayloadType = websocket.BinaryFrame
+
+	req := ws.Request()
+	query := req.URL.Query()
+	cols, rows := parseSize(query.Get("cols"), 80), parseSize(query.Get("rows"), 24)
+	sess := &Session{
+		ID:      newID(),
+		Client:  clientIP(req),
+		Started: time.Now(),
+	}
+
+	name, err := s.tickets.verify(query.Get("ticket"), sess.Started)
+	var local *user.User
+	if err == nil {
+		sess.User = name
+		local, err = s.localUser(sess.User)
+	}
+	if err == nil {
+		sess.LocalUser = local.Username
+		err = s.add(sess)
+	}
+	if err != nil {
+		s.record(audit.ActionTerminalOpen, sess, err.Error())
+		_ = websocket.Message.Send(ws, err.Error()+"\r\n")
+		return
+	}
+	defer s.remove(sess.ID)
+
+	rec, err := newRecorder(s.config.RecordDir, sess.ID, cols, rows, sess.User+"@"+sess.LocalUser)
+	if err != nil {
+		s.record(audit.ActionTerminalOpen, sess, "record: "+err.Error())
+		_ = websocket.Message.Send(ws, "session can not be recorded\r\n")
+		return
+	}
+	sess.Recording = rec.path
+
+	cmd, master, err := startShell(s.config.Shell, local, cols, rows)
+	if err != nil {
+		_ = rec.close()
+		s.record(audit.ActionTerminalOpen, sess, err.Error())
+		_ = websocket.Message.Send(ws, err.Error()+"\r\n")
+		return
+	}
+	s.record(audit.ActionTerminalOpen, sess, "")
+	xlog.Info("terminal open", xlog.String("session", sess.ID), xlog.String("user", sess.User), xlog.String("localUser", sess.LocalUser))
+
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+	// output ends once the shell and everything it started closed the terminal,
+	// the connection is then closed to end the input loop
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		defer ws.Close()
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := master.Read(buf)
+			if n > 0 {
+				rec.output(buf[:n])
+				if websocket.Message.Send(ws, buf[:n]) != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	reason := s.input(ws, master, rec, drained)
+
+	stopShell(cmd, exited, stopGrace)
+	<-exited
+	master.Close()
+	<-drained
+	if err := rec.close(); err != nil {
+		xlog.Error("terminal record", xlog.String("session", sess.ID), xlog.FieldErr(err))
+	}
+	if s.config.RecordAddr != "" {
+		if err := s.upload(sess); err != nil {
+			xlog.Error("terminal upload", xlog.String("session", sess.ID), xlog.FieldErr(err))
+		}
+	}
+	s.record(audit.ActionTerminalClose, sess, reason)
+	xlog.Info("terminal close", xlog.String("session", sess.ID), xlog.String("reason", reason))
+}
+
+// input forward keystrokes to the shell until the connection is closed or idle, returns why it ended
+func (s *Server) input(ws *websocket.Conn, master *os.File, rec *recorder, drained <-chan struct{}) string {
+	last := time.Now()
+	for {
+		if s.config.IdleTimeout > 0 {
+			_ = ws.SetReadDeadline(last.Add(s.config.IdleTimeout))
+		}
+		var msg message
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			select {
+			case <-drained:
+				return "shell exited"
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				_ = websocket.Message.Send(ws, "\r\nidle timeout\r\n")
+				return "idle timeout"
+			}
+			return "closed by client"
+		}
+
+		switch msg.Type {
+		case "input":
+			last = time.Now()
+			rec.input(msg.Data)
+			if _, err := master.WriteString(msg.Data); err != nil {
+				return "shell exited"
+			}
+		case "resize":
+			if msg.Cols == 0 || msg.Rows == 0 {
+				continue
+			}
+			if err := setSize(master, msg.Cols, msg.Rows); err == nil {
+				rec.resize(msg.Cols, msg.Rows)
+			}
+		}
+	}
+}
+
+// localUser map a console user to the local user its shell runs as
+func (s *Server) localUser(name string) (*user.User, error) {
+	if name == "" {
+		return nil, errors.New("user is required")
+	}
+	local, ok := s.config.Users[name]
+	if !ok {
+		local = s.config.DefaultUser
+	}
+	if local == "" {
+		return nil, fmt.Errorf("user %s is not mapped to a local user", name)
+	}
+	return user.Lookup(local)
+}
+
+func (s *Server) add(sess *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.config.MaxSessions > 0 && len(s.sessions) >= s.config.MaxSessions {
+		return ErrTooManySessions
+	}
+	s.sessions[sess.ID] = sess
+	return nil
+}
+
+func (s *Server) remove(id string) {
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+}
+
+// record audit entry of a session, Key is the session id
+func (s *Server) record(action string, sess *Session, reason string) {
+	entry := audit.Entry{Action: action, Source: audit.SourceAPI, Key: sess.ID, Reason: reason}
+	entry.After, _ = json.Marshal(sess)
+	s.config.Audit.Record(entry)
+}
+
+// upload post the recording to the admin
+func (s *Server) upload(sess *Session) error {
+	file, err := os.Open(sess.Recording)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	req, err := http.NewRequest(http.MethodPost, s.config.RecordAddr, file)
+	if err != nil {
+		return err
+	}
+	query := req.URL.Query()
+	query.Set("session", sess.ID)
+	query.Set("user", sess.User)
+	req.URL.RawQuery = query.Encode()
+	req.Header.Set("Content-Type", "application/x-asciicast")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// newID session id starting with the start time, so recordings sort by time
+func newID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+func parseSize(value string, def uint16) uint16 {
+	n, err := strconv.ParseUint(value, 10, 16)
+	if err != nil || n == 0 {
+		return def
+	}
+	return uint16(n)
+}
+
+// clientIP peer address of the connection, forwarding headers are set by the client and not trusted
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
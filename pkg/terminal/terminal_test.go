@@ -0,0 +1,175 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package terminal
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terminal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	rec, err := newRecorder(dir, "s1", 80, 24, "admin@www")
+	assert.NoError(t, err)
+	rec.input("ls\r")
+	// "中" split between two reads is recorded as one event
+	rec.output([]byte("a\xe4\xb8"))
+	rec.output([]byte("\xad"))
+	rec.resize(120, 40)
+	assert.NoError(t, rec.close())
+	rec.input("dropped")
+
+	file, err := os.Open(filepath.Join(dir, "s1.cast"))
+	assert.NoError(t, err)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	assert.Len(t, lines, 5)
+
+	var header map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &header))
+	assert.Equal(t, float64(2), header["version"])
+	assert.Equal(t, float64(80), header["width"])
+	var events []string
+	for _, line := range lines[1:] {
+		var event []interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &event))
+		events = append(events, event[1].(string)+":"+event[2].(string))
+	}
+	assert.Equal(t, []string{"i:ls\r", "o:a", "o:中", "r:120x40"}, events)
+}
+
+func TestLocalUser(t *testing.T) {
+	current, err := user.Current()
+	assert.NoError(t, err)
+
+	config := DefaultConfig()
+	config.Users = map[string]string{"admin": current.Username}
+	server := config.Build()
+	local, err := server.localUser("admin")
+	assert.NoError(t, err)
+	assert.Equal(t, current.Uid, local.Uid)
+	_, err = server.localUser("guest")
+	assert.Error(t, err)
+	_, err = server.localUser("")
+	assert.Error(t, err)
+
+	config.DefaultUser = current.Username
+	_, err = server.localUser("guest")
+	assert.NoError(t, err)
+}
+
+func TestTickets(t *testing.T) {
+	now := time.Now()
+	tickets := newTickets("key", time.Minute)
+	user, err := tickets.verify(SignTicket("key", "admin", "n1", now.Add(time.Minute)), now)
+	assert.NoError(t, err)
+	assert.Equal(t, "admin", user)
+
+	_, err = tickets.verify(SignTicket("key", "admin", "n1", now.Add(time.Minute)), now)
+	assert.EqualError(t, err, "ticket already used")
+	_, err = tickets.verify(SignTicket("other", "admin", "n2", now.Add(time.Minute)), now)
+	assert.EqualError(t, err, "invalid ticket signature")
+	_, err = tickets.verify(SignTicket("key", "admin", "n3", now.Add(-time.Second)), now)
+	assert.EqualError(t, err, "ticket expired")
+	_, err = tickets.verify(SignTicket("key", "admin", "n4", now.Add(time.Hour)), now)
+	assert.EqualError(t, err, "ticket expires too late")
+	_, err = tickets.verify("admin", now)
+	assert.Error(t, err)
+}
+
+func TestSession(t *testing.T) {
+	if !ptySupported {
+		t.Skip("pseudo terminal is not supported")
+	}
+	current, err := user.Current()
+	assert.NoError(t, err)
+	dir, err := ioutil.TempDir("", "terminal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.Enable = true
+	config.Shell = "/bin/sh"
+	config.Users = map[string]string{"admin": current.Username}
+	config.RecordDir = dir
+	config.MaxSessions = 1
+	config.TicketKey = "key"
+	config.Origins = []string{"http://console"}
+	server := config.Build()
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	base := "ws" + strings.TrimPrefix(ts.URL, "http") + "/?cols=100&rows=30&ticket="
+	expires := time.Now().Add(time.Minute)
+	_, err = websocket.Dial(base+SignTicket("key", "admin", "n0", expires), "", "http://evil")
+	assert.Error(t, err)
+	url := base + SignTicket("key", "admin", "n1", expires)
+	ws, err := websocket.Dial(url, "", "http://console")
+	assert.NoError(t, err)
+	defer ws.Close()
+	assert.NoError(t, websocket.JSON.Send(ws, message{Type: "input", Data: "echo juno-$((1+1))\n"}))
+	var output string
+	_ = ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for !strings.Contains(output, "juno-2") {
+		var data []byte
+		if !assert.NoError(t, websocket.Message.Receive(ws, &data)) {
+			return
+		}
+		output += string(data)
+	}
+	sessions := server.Sessions()
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, current.Username, sessions[0].LocalUser)
+
+	// a second session is refused while the first is running
+	second, err := websocket.Dial(base+SignTicket("key", "admin", "n2", expires), "", "http://console")
+	assert.NoError(t, err)
+	var msg string
+	assert.NoError(t, websocket.Message.Receive(second, &msg))
+	assert.Contains(t, msg, ErrTooManySessions.Error())
+	second.Close()
+
+	assert.NoError(t, websocket.JSON.Send(ws, message{Type: "input", Data: "exit\n"}))
+	for {
+		var data []byte
+		if websocket.Message.Receive(ws, &data) != nil {
+			break
+		}
+	}
+	assert.Eventually(t, func() bool { return len(server.Sessions()) == 0 }, 5*time.Second, 10*time.Millisecond)
+
+	recording, err := ioutil.ReadFile(sessions[0].Recording)
+	assert.NoError(t, err)
+	assert.Contains(t, string(recording), `"i","echo juno-$((1+1))\n"`)
+	assert.Contains(t, string(recording), "juno-2")
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package terminal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ticket the console user a session is opened for, issued and signed by the admin
+// after it authenticated the user. the websocket carries it in the ticket query
+// as base64url(json).base64url(hmac-sha256(json)), since browsers can not set
+// headers on a websocket handshake
+type ticket struct {
+	User    string `json:"user"`
+	Expires int64  `json:"exp"`   // unix seconds
+	Nonce   string `json:"nonce"` // a ticket opens one session only
+}
+
+// tickets verifies tickets and remembers used nonces until they expire
+type tickets struct {
+	key    []byte
+	maxTTL time.Duration
+
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+func newTickets(key string, maxTTL time.Duration) *tickets {
+	return &tickets{key: []byte(key), maxTTL: maxTTL, used: make(map[string]time.Time)}
+}
+
+// SignTicket sign a ticket for user, used by the admin and by tests
+func SignTicket(key, user, nonce string, expires time.Time) string {
+	payload, _ := json.Marshal(ticket{User: user, Expires: expires.Unix(), Nonce: nonce})
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify returns the console user of a valid, unexpired and unused ticket
+func (t *tickets) verify(value string, now time.Time) (string, error) {
+	if len(t.key) == 0 {
+		return "", errors.New("ticket key is not configured")
+	}
+	index := strings.IndexByte(value, '.')
+	if index < 0 {
+		return "", errors.New("malformed ticket")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(value[:index])
+	if err != nil {
+		return "", errors.New("malformed ticket")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(value[index+1:])
+	if err != nil {
+		return "", errors.New("malformed ticket")
+	}
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return "", errors.New("invalid ticket signature")
+	}
+
+	var tk ticket
+	if err := json.Unmarshal(payload, &tk); err != nil {
+		return "", errors.New("malformed ticket")
+	}
+	expires := time.Unix(tk.Expires, 0)
+	switch {
+	case tk.User == "" || tk.Nonce == "":
+		return "", errors.New("ticket without user or nonce")
+	case !now.Before(expires):
+		return "", errors.New("ticket expired")
+	case expires.Sub(now) > t.maxTTL:
+		return "", errors.New("ticket expires too late")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for nonce, exp := range t.used {
+		if !now.Before(exp) {
+			delete(t.used, nonce)
+		}
+	}
+	if _, ok := t.used[tk.Nonce]; ok {
+		return "", errors.New("ticket already used")
+	}
+	t.used[tk.Nonce] = expires
+	return tk.User, nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeline
+
+import (
+	"fmt"
+
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config timeline config
+type Config struct {
+	Enable    bool   `json:"enable"`
+	Path      string `json:"path"`       // file which events are appended to
+	MaxEvents int    `json:"max_events"` // events kept in the store, older ones are dropped on compaction
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadTimelineConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable:    false,
+		Path:      "/tmp/juno-agent/timeline.log",
+		MaxEvents: 10000,
+	}
+}
+
+// Build new a instance
+func (c *Config) Build() *Timeline {
+	if c.Enable {
+		xlog.Info("plugin", xlog.String("timeline", "start"))
+	}
+	return &Timeline{
+		config: c,
+		events: make([]Event, 0),
+	}
+}
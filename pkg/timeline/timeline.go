@@ -0,0 +1,212 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// event kinds
+const (
+	KindAgentStart   = "agent_start"
+	KindAppUp        = "app_up"
+	KindAppDown      = "app_down"
+	KindProgram      = "program"
+	KindConfigChange = "config_change"
+	KindConfigDrift  = "config_drift"
+	KindMaintenance  = "maintenance"
+	KindIncident     = "incident"
+	KindPressure     = "pressure"
+	KindProfile      = "profile"
+	KindJobAnomaly   = "job_anomaly"
+)
+
+// Event a host state transition
+type Event struct {
+	Time    time.Time         `json:"time"`
+	Kind    string            `json:"kind"`
+	Target  string            `json:"target"` // app name, program name, etc...
+	Message string            `json:"message"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// Timeline records host state transitions in a local append-only file
+type Timeline struct {
+	config *Config
+
+	mu      sync.RWMutex
+	events  []Event
+	file    *os.File
+	written int // lines in file, used to decide when to compact
+}
+
+// Start load history events and open the store for appending
+func (t *Timeline) Start() error {
+	if !t.config.Enable {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.config.Path), 0755); err != nil {
+		return err
+	}
+
+	if err := t.load(); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(t.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	t.file = file
+	return nil
+}
+
+// Close ...
+func (t *Timeline) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.file == nil {
+		return nil
+	}
+	return t.file.Close()
+}
+
+// Record append an event, time defaults to now
+func (t *Timeline) Record(event Event) {
+	if !t.config.Enable {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.events = append(t.events, event)
+	if len(t.events) > t.config.MaxEvents {
+		t.events = t.events[len(t.events)-t.config.MaxEvents:]
+	}
+
+	if t.file == nil {
+		return
+	}
+
+	if t.written >= 2*t.config.MaxEvents {
+		if err := t.compact(); err != nil {
+			xlog.Error("timeline compact", xlog.FieldErr(err))
+		}
+		return
+	}
+
+	line, _ := json.Marshal(event)
+	if _, err := t.file.Write(append(line, '\n')); err != nil {
+		xlog.Error("timeline record", xlog.FieldErr(err))
+		return
+	}
+	t.written++
+}
+
+// Query returns events in [from, to), filtered by kind if not empty.
+// zero from or to means no limit
+func (t *Timeline) Query(from, to time.Time, kind string) []Event {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	events := make([]Event, 0)
+	for _, event := range t.events {
+		if !from.IsZero() && event.Time.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !event.Time.Before(to) {
+			continue
+		}
+		if kind != "" && event.Kind != kind {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// load read the latest events from store file
+func (t *Timeline) load() error {
+	file, err := os.Open(t.config.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		t.events = append(t.events, event)
+		t.written++
+	}
+	if len(t.events) > t.config.MaxEvents {
+		t.events = t.events[len(t.events)-t.config.MaxEvents:]
+	}
+	return scanner.Err()
+}
+
+// compact rewrite store file with events kept in memory
+func (t *Timeline) compact() error {
+	tmp := t.config.Path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	for _, event := range t.events {
+		line, _ := json.Marshal(event)
+		_, _ = writer.Write(append(line, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, t.config.Path); err != nil {
+		return err
+	}
+
+	_ = t.file.Close()
+	t.file, err = os.OpenFile(t.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.file = nil
+		return err
+	}
+	t.written = len(t.events)
+	return nil
+}
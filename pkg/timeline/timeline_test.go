@@ -0,0 +1,54 @@
+package timeline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "timeline")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.Enable = true
+	config.Path = filepath.Join(dir, "timeline.log")
+	config.MaxEvents = 3
+
+	base := time.Date(2020, 8, 1, 3, 0, 0, 0, time.Local)
+
+	tl := config.Build()
+	assert.NoError(t, tl.Start())
+	tl.Record(Event{Time: base, Kind: KindAgentStart})
+	tl.Record(Event{Time: base.Add(10 * time.Minute), Kind: KindAppDown, Target: "app-a"})
+	tl.Record(Event{Time: base.Add(12 * time.Minute), Kind: KindConfigChange, Target: "app-a"})
+	assert.NoError(t, tl.Close())
+
+	// reopen and make sure events are loaded from store
+	tl = config.Build()
+	assert.NoError(t, tl.Start())
+	defer tl.Close()
+
+	events := tl.Query(base.Add(5*time.Minute), base.Add(15*time.Minute), "")
+	assert.Len(t, events, 2)
+	assert.Equal(t, KindAppDown, events[0].Kind)
+
+	events = tl.Query(time.Time{}, time.Time{}, KindConfigChange)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "app-a", events[0].Target)
+
+	// older events are dropped when exceeding max events, and store is compacted
+	for i := 0; i < 5; i++ {
+		tl.Record(Event{Kind: KindMaintenance})
+	}
+	events = tl.Query(time.Time{}, time.Time{}, "")
+	assert.Len(t, events, 3)
+	for _, event := range events {
+		assert.Equal(t, KindMaintenance, event.Kind)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/util/xtime"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config tracing config, spans are exported with OTLP/HTTP in JSON encoding
+type Config struct {
+	Enable        bool              `json:"enable"`
+	Endpoint      string            `json:"endpoint"`     // OTLP traces endpoint, e.g. http://127.0.0.1:4318/v1/traces
+	ServiceName   string            `json:"service_name"` // service.name of the exported resource
+	Headers       map[string]string `json:"headers"`      // extra headers sent with each export, e.g. authentication
+	BatchSize     int               `json:"batch_size"`   // max spans in one export request
+	QueueSize     int               `json:"queue_size"`   // spans waiting for export, new spans are dropped when full
+	FlushInterval time.Duration     `json:"flush_interval"`
+	Timeout       time.Duration     `json:"timeout"`
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadTracingConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable:        false,
+		Endpoint:      "http://127.0.0.1:4318/v1/traces",
+		ServiceName:   "juno-agent",
+		BatchSize:     512,
+		QueueSize:     2048,
+		FlushInterval: xtime.Duration("5s"),
+		Timeout:       xtime.Duration("10s"),
+	}
+}
+
+// Build new a instance, nil is returned if tracing is disabled
+func (c *Config) Build() *Tracer {
+	if !c.Enable {
+		return nil
+	}
+	xlog.Info("plugin", xlog.String("tracing", "start"), xlog.String("endpoint", c.Endpoint))
+	return newTracer(c)
+}
@@ -0,0 +1,190 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/util/xgo"
+)
+
+// EnvTraceParent env var which carries the W3C trace context into spawned processes
+const EnvTraceParent = "TRACEPARENT"
+
+// StatusCode status of a finished span, values follow OTLP
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+// Tracer creates spans and exports them in background.
+// all methods are safe on a nil Tracer, which means tracing is disabled
+type Tracer struct {
+	config *Config
+	queue  chan *Span
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newTracer(config *Config) *Tracer {
+	t := &Tracer{
+		config: config,
+		queue:  make(chan *Span, config.QueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	xgo.Go(t.run)
+	return t
+}
+
+// Start starts a span, it continues the trace of traceParent if it is a valid W3C traceparent,
+// otherwise a new trace is started
+func (t *Tracer) Start(name string, traceParent string) *Span {
+	if t == nil {
+		return nil
+	}
+
+	span := &Span{
+		tracer: t,
+		name:   name,
+		start:  time.Now(),
+	}
+	if traceID, parentID, ok := ParseTraceParent(traceParent); ok {
+		span.traceID = traceID
+		span.parentID = parentID
+	} else {
+		_, _ = rand.Read(span.traceID[:])
+	}
+	_, _ = rand.Read(span.spanID[:])
+	return span
+}
+
+// Close exports pending spans and stops the tracer
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.once.Do(func() {
+		close(t.stop)
+		<-t.done
+	})
+	return nil
+}
+
+// Span a single operation within a trace
+type Span struct {
+	tracer   *Tracer
+	traceID  TraceID
+	spanID   SpanID
+	parentID SpanID
+	name     string
+	start    time.Time
+	end      time.Time
+
+	mu            sync.Mutex
+	attributes    map[string]interface{}
+	statusCode    StatusCode
+	statusMessage string
+	ended         bool
+}
+
+// SetAttribute sets an attribute, value should be a string, bool, integer or float
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.attributes == nil {
+		s.attributes = make(map[string]interface{})
+	}
+	s.attributes[key] = value
+}
+
+// SetStatus sets status of the span, message is only kept for StatusError
+func (s *Span) SetStatus(code StatusCode, message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.statusCode = code
+	if code == StatusError {
+		s.statusMessage = message
+	}
+}
+
+// End finishes the span and queues it for export, only the first call takes effect
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	select {
+	case s.tracer.queue <- s:
+	default:
+		// queue is full, drop the span rather than blocking the caller
+	}
+}
+
+// TraceParent returns W3C traceparent of the span, empty for a nil span
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(s.traceID[:]), hex.EncodeToString(s.spanID[:]))
+}
+
+// ParseTraceParent parses a W3C traceparent header value of version 00
+func ParseTraceParent(value string) (traceID TraceID, spanID SpanID, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, spanID, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return traceID, spanID, false
+	}
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil {
+		return traceID, spanID, false
+	}
+	if traceID == (TraceID{}) || spanID == (SpanID{}) {
+		return traceID, spanID, false
+	}
+	return traceID, spanID, true
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	traceID, spanID, ok := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.True(t, ok)
+	assert.Equal(t, byte(0x4b), traceID[0])
+	assert.Equal(t, byte(0xb7), spanID[7])
+
+	for _, v := range []string{"", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "00-xyz-00f067aa0ba902b7-01"} {
+		_, _, ok := ParseTraceParent(v)
+		assert.False(t, ok, v)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	requests := make(chan otlpRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "token", r.Header.Get("Authorization"))
+		requests <- req
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.Enable = true
+	config.Endpoint = server.URL
+	config.Headers = map[string]string{"Authorization": "token"}
+	config.FlushInterval = time.Hour
+	tracer := config.Build()
+
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	span := tracer.Start("job", parent)
+	span.SetAttribute("job.id", "1")
+	span.SetAttribute("process.exit_code", 2)
+	span.SetStatus(StatusError, "exit status 2")
+	span.End()
+	assert.True(t, strings.HasPrefix(span.TraceParent(), "00-4bf92f3577b34da6a3ce929d0e0e4736-"))
+	assert.Nil(t, tracer.Close())
+
+	req := <-requests
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].ParentSpanID)
+	assert.Equal(t, StatusError, spans[0].Status.Code)
+	assert.Equal(t, "process.exit_code", spans[0].Attributes[1].Key)
+	assert.Equal(t, "2", *spans[0].Attributes[1].Value.IntValue)
+
+	// a nil tracer is safe to use when tracing is disabled
+	var disabled *Tracer
+	span = disabled.Start("job", "")
+	span.SetAttribute("job.id", "1")
+	span.End()
+	assert.Equal(t, "", span.TraceParent())
+}
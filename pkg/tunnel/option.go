@@ -0,0 +1,111 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/douyu/jupiter/pkg/util/xtime"
+	"github.com/douyu/jupiter/pkg/xlog"
+)
+
+// Config tunnel config
+type Config struct {
+	Enable             bool          `json:"enable"`
+	Relay              string        `json:"relay"`              // tcp address of the relay, e.g. relay.juno.example.com:50030
+	Name               string        `json:"name"`               // name registered on the relay, hostname by default
+	Token              string        `json:"token"`              // presented to the relay in handshake
+	Plaintext          bool          `json:"plaintext"`          // connect without tls, the token and api traffic are sent in clear
+	CaCert             string        `json:"caCert"`             // verify the relay with this ca instead of the system roots
+	ServerName         string        `json:"serverName"`         // name in the certificate of the relay, host of relay by default
+	InsecureSkipVerify bool          `json:"insecureSkipVerify"` // skip verifying certificate of the relay
+	DialTimeout        time.Duration `json:"dialTimeout"`        // timeout of dialing and handshake
+	KeepAlive          time.Duration `json:"keepAlive"`          // interval of yamux keepalive pings
+	MinBackoff         time.Duration `json:"minBackoff"`         // first reconnect delay, doubled after each failure
+	MaxBackoff         time.Duration `json:"maxBackoff"`
+}
+
+// StdConfig returns standard configuration information
+func StdConfig(key string) *Config {
+	var config = DefaultConfig()
+	if err := conf.UnmarshalKey(fmt.Sprintf("plugin.%s", key), &config, conf.TagName("toml")); err != nil {
+		xlog.Error("loadTunnelConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	return &config
+}
+
+// DefaultConfig return default config
+func DefaultConfig() Config {
+	return Config{
+		Enable:      false,
+		DialTimeout: xtime.Duration("10s"),
+		KeepAlive:   xtime.Duration("30s"),
+		MinBackoff:  xtime.Duration("1s"),
+		MaxBackoff:  xtime.Duration("1m"),
+	}
+}
+
+// Build new a instance, nil is returned if tunnel is disabled
+func (c *Config) Build() *Tunnel {
+	if !c.Enable {
+		return nil
+	}
+	if c.Name == "" {
+		c.Name, _ = os.Hostname()
+	}
+	if c.MaxBackoff < c.MinBackoff {
+		c.MaxBackoff = c.MinBackoff
+	}
+	if c.Plaintext {
+		xlog.Warn("plugin", xlog.String("tunnel", "plaintext, token and api traffic are not encrypted"), xlog.String("relay", c.Relay))
+	}
+	tun, err := New(c)
+	if err != nil {
+		xlog.Error("loadTunnelConfig", xlog.Any("err", err))
+		panic(err)
+	}
+	xlog.Info("plugin", xlog.String("tunnel", "start"), xlog.String("relay", c.Relay), xlog.String("name", c.Name))
+	return tun
+}
+
+// tlsConfig the relay is always dialed with tls unless plaintext is set explicitly
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	if c.Plaintext {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CaCert != "" {
+		pem, err := ioutil.ReadFile(c.CaCert)
+		if err != nil {
+			return nil, fmt.Errorf("tunnel: read ca cert: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tunnel: no certificate found in %s", c.CaCert)
+		}
+	}
+	return config, nil
+}
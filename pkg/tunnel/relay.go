@@ -0,0 +1,79 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/yamux"
+)
+
+// Accept performs the relay side of the handshake on a connection from an agent.
+// authorize decides whether the agent may register, the rejection reason is sent back to the agent.
+// requests are sent to the agent through the returned session, see Transport
+func Accept(conn net.Conn, timeout time.Duration, authorize func(Hello) error) (*yamux.Session, Hello, error) {
+	var hello Hello
+
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	if err := readMessage(conn, &hello); err != nil {
+		return nil, hello, err
+	}
+
+	err := authorize(hello)
+	if err == nil && hello.Version != ProtocolVersion {
+		err = fmt.Errorf("unsupported protocol version %d", hello.Version)
+	}
+	if err != nil {
+		writeMessage(conn, Ack{Error: err.Error()})
+		return nil, hello, err
+	}
+
+	if err := writeMessage(conn, Ack{OK: true}); err != nil {
+		return nil, hello, err
+	}
+
+	session, err := yamux.Client(conn, yamuxConfig(0))
+	return session, hello, err
+}
+
+// TokenAuth authorizes agents presenting the token
+func TokenAuth(token string) func(Hello) error {
+	return func(hello Hello) error {
+		if subtle.ConstantTimeCompare([]byte(hello.Token), []byte(token)) != 1 {
+			return errors.New("invalid token")
+		}
+		return nil
+	}
+}
+
+// Transport returns a RoundTripper sending requests to the agent behind session.
+// the host of request url is ignored
+func Transport(session *yamux.Session) http.RoundTripper {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return session.Open()
+		},
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/douyu/jupiter/pkg/util/xgo"
+	"github.com/douyu/jupiter/pkg/xlog"
+	"github.com/hashicorp/yamux"
+)
+
+// ProtocolVersion version of the handshake, the relay rejects agents of other versions
+const ProtocolVersion = 1
+
+// max length of a handshake message
+const maxHandshakeLine = 4096
+
+// ErrRejected the relay refused the agent, e.g. invalid token
+var ErrRejected = errors.New("tunnel rejected by relay")
+
+// Hello is sent by the agent right after connecting to the relay
+type Hello struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Token   string `json:"token,omitempty"`
+}
+
+// Ack is the relay's reply to Hello. after a successful ack the connection is
+// multiplexed by yamux, the relay opens a stream for each http request to the agent api
+type Ack struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Tunnel keeps an outbound connection to the relay and serves the agent api over it,
+// so that juno-admin can reach agents behind NAT or firewalls without inbound ports
+type Tunnel struct {
+	config *Config
+	tls    *tls.Config // nil for plaintext
+
+	mu      sync.Mutex
+	session *yamux.Session
+	closed  bool
+	done    chan struct{}
+}
+
+// New fails if the tls config of the relay can not be loaded
+func New(config *Config) (*Tunnel, error) {
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &Tunnel{
+		config: config,
+		tls:    tlsConfig,
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// Start serves handler over the tunnel in background, reconnecting until Close
+func (t *Tunnel) Start(handler http.Handler) {
+	if t == nil {
+		return
+	}
+	xgo.Go(func() {
+		t.run(handler)
+	})
+}
+
+// Connected reports whether the tunnel is established
+func (t *Tunnel) Connected() bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.session != nil && !t.session.IsClosed()
+}
+
+// Close disconnects from the relay and stops reconnecting
+func (t *Tunnel) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	close(t.done)
+	if t.session != nil {
+		return t.session.Close()
+	}
+	return nil
+}
+
+func (t *Tunnel) run(handler http.Handler) {
+	backoff := t.config.MinBackoff
+	for {
+		session, err := t.connect()
+		if err == nil {
+			xlog.Info("tunnel established", xlog.String("relay", t.config.Relay), xlog.String("name", t.config.Name))
+			backoff = t.config.MinBackoff
+			err = t.serve(session, handler)
+		}
+
+		select {
+		case <-t.done:
+			return
+		default:
+		}
+		xlog.Warn("tunnel disconnected", xlog.String("relay", t.config.Relay), xlog.Duration("retry", backoff), xlog.FieldErr(err))
+
+		select {
+		case <-t.done:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > t.config.MaxBackoff {
+			backoff = t.config.MaxBackoff
+		}
+	}
+}
+
+// serve blocks until the session is closed
+func (t *Tunnel) serve(session *yamux.Session, handler http.Handler) error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return session.Close()
+	}
+	t.session = session
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		t.session = nil
+		t.mu.Unlock()
+	}()
+
+	server := &http.Server{Handler: handler}
+	err := server.Serve(session)
+	session.Close()
+	return err
+}
+
+func (t *Tunnel) connect() (*yamux.Session, error) {
+	dialer := &net.Dialer{Timeout: t.config.DialTimeout}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if t.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", t.config.Relay, t.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", t.config.Relay)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.handshake(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	session, err := yamux.Server(conn, yamuxConfig(t.config.KeepAlive))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return session, nil
+}
+
+func (t *Tunnel) handshake(conn net.Conn) error {
+	if t.config.DialTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(t.config.DialTimeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	hello := Hello{Version: ProtocolVersion, Name: t.config.Name, Token: t.config.Token}
+	if err := writeMessage(conn, hello); err != nil {
+		return err
+	}
+
+	var ack Ack
+	if err := readMessage(conn, &ack); err != nil {
+		return err
+	}
+	if !ack.OK {
+		return fmt.Errorf("%w: %s", ErrRejected, ack.Error)
+	}
+	return nil
+}
+
+func yamuxConfig(keepAlive time.Duration) *yamux.Config {
+	config := yamux.DefaultConfig()
+	config.LogOutput = ioutil.Discard
+	if keepAlive > 0 {
+		config.KeepAliveInterval = keepAlive
+	} else {
+		config.EnableKeepAlive = false
+	}
+	return config
+}
+
+// writeMessage writes v as a json line
+func writeMessage(conn net.Conn, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(append(data, '\n'))
+	return err
+}
+
+// readMessage reads a json line into v. it reads byte by byte, so that
+// the yamux frames following the handshake are not consumed by a buffer
+func readMessage(conn net.Conn, v interface{}) error {
+	line := make([]byte, 0, 128)
+	b := make([]byte, 1)
+	for {
+		if _, err := conn.Read(b); err != nil {
+			return err
+		}
+		if b[0] == '\n' {
+			break
+		}
+		if len(line) >= maxHandshakeLine {
+			return errors.New("handshake message too long")
+		}
+		line = append(line, b[0])
+	}
+	return json.Unmarshal(line, v)
+}
@@ -0,0 +1,168 @@
+package tunnel
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/yamux"
+	"github.com/stretchr/testify/assert"
+)
+
+type accepted struct {
+	session *yamux.Session
+	hello   Hello
+	err     error
+}
+
+// relayCert self-signed certificate of 127.0.0.1, the ca file trusting it is written to dir
+func relayCert(t *testing.T, dir string) (*tls.Config, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "relay"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	assert.NoError(t, err)
+
+	caCert := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, ioutil.WriteFile(caCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, caCert
+}
+
+// startRelay listens with tls unless tlsConfig is nil
+func startRelay(t *testing.T, token string, tlsConfig *tls.Config) (net.Listener, chan accepted) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	ch := make(chan accepted, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			session, hello, err := Accept(conn, time.Second, TokenAuth(token))
+			ch <- accepted{session, hello, err}
+		}
+	}()
+	return ln, ch
+}
+
+func testConfig(relay, token, caCert string) *Config {
+	config := DefaultConfig()
+	config.Enable = true
+	config.Relay = relay
+	config.Name = "agent-1"
+	config.Token = token
+	config.CaCert = caCert
+	config.MinBackoff = 10 * time.Millisecond
+	return &config
+}
+
+func get(t *testing.T, session *yamux.Session) string {
+	client := &http.Client{Transport: Transport(session), Timeout: time.Second}
+	resp, err := client.Get("http://agent/api/ping")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestTunnel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tunnel")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	tlsConfig, caCert := relayCert(t, dir)
+
+	ln, ch := startRelay(t, "secret", tlsConfig)
+	defer ln.Close()
+
+	tun := testConfig(ln.Addr().String(), "secret", caCert).Build()
+	defer tun.Close()
+	tun.Start(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pong " + r.URL.Path))
+	}))
+
+	first := <-ch
+	assert.NoError(t, first.err)
+	assert.Equal(t, "agent-1", first.hello.Name)
+	assert.Equal(t, "pong /api/ping", get(t, first.session))
+	assert.True(t, tun.Connected())
+
+	// reconnect after the relay drops the session
+	first.session.Close()
+	second := <-ch
+	assert.NoError(t, second.err)
+	assert.Equal(t, "pong /api/ping", get(t, second.session))
+}
+
+func TestTunnelRejected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tunnel")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	tlsConfig, caCert := relayCert(t, dir)
+
+	ln, ch := startRelay(t, "secret", tlsConfig)
+	defer ln.Close()
+
+	tun := testConfig(ln.Addr().String(), "wrong", caCert).Build()
+	defer tun.Close()
+	tun.Start(http.NotFoundHandler())
+
+	rejected := <-ch
+	assert.Error(t, rejected.err)
+	assert.Nil(t, rejected.session)
+	assert.False(t, tun.Connected())
+
+	var nilTunnel *Tunnel
+	nilTunnel.Start(http.NotFoundHandler())
+	assert.NoError(t, nilTunnel.Close())
+}
+
+func TestTunnelRequiresTLS(t *testing.T) {
+	ln, ch := startRelay(t, "secret", nil)
+	defer ln.Close()
+
+	// the token is never sent to a relay without tls
+	config := testConfig(ln.Addr().String(), "secret", "")
+	tun := config.Build()
+	tun.Start(http.NotFoundHandler())
+	refused := <-ch
+	assert.Error(t, refused.err)
+	assert.Empty(t, refused.hello.Token)
+	assert.False(t, tun.Connected())
+	tun.Close()
+
+	config.Plaintext = true
+	tun = config.Build()
+	defer tun.Close()
+	tun.Start(http.NotFoundHandler())
+	assert.NoError(t, (<-ch).err)
+
+	_, err := New(&Config{CaCert: "/nonexistent/ca.pem"})
+	assert.Error(t, err)
+}
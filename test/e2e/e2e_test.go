@@ -0,0 +1,179 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build e2e
+// +build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/job"
+	confetcd "github.com/douyu/juno-agent/pkg/proxy/confProxy/etcd"
+	"github.com/douyu/juno-agent/pkg/report"
+	"github.com/douyu/juno-agent/pkg/structs"
+	"github.com/douyu/jupiter/pkg/conf"
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func everySecond(id, script string, nodes ...string) *job.Job {
+	return &job.Job{
+		ID:     id,
+		Name:   id,
+		Script: script,
+		Timers: []*job.Timer{{ID: "1", Cron: "* * * * * *"}},
+		Enable: true,
+		Nodes:  nodes,
+	}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	c := NewCluster(t)
+	agent := c.StartAgent("node-a")
+
+	c.PutJob(everySecond("lifecycle", c.Script("hello", "echo hello"), "node-a"))
+	c.Eventually(func() bool { return Owns(agent, "lifecycle") }, "job is not scheduled")
+	result := c.WaitResult("lifecycle", Contains("hello"))
+	assert.Equal(t, job.CronTaskStatusSuccess, result.Status)
+	assert.Equal(t, "node-a", result.RunOn)
+
+	c.PutJob(everySecond("lifecycle", c.Script("world", "echo world"), "node-a"))
+	c.WaitResult("lifecycle", Contains("world"))
+
+	// moved to another node
+	c.PutJob(everySecond("lifecycle", c.Script("world", "echo world"), "node-b"))
+	c.Eventually(func() bool { return !Owns(agent, "lifecycle") }, "job is still scheduled after moving to another node")
+
+	c.PutJob(everySecond("lifecycle", c.Script("again", "echo again"), "node-a"))
+	c.WaitResult("lifecycle", Contains("again"))
+
+	c.DeleteJob("lifecycle")
+	c.Eventually(func() bool { return !Owns(agent, "lifecycle") }, "job is still scheduled after deleted")
+}
+
+func TestOnceJob(t *testing.T) {
+	c := NewCluster(t)
+	c.StartAgent("node-a")
+	c.StartAgent("node-b")
+
+	c.RunOnce("node-b", &job.OnceJob{
+		Job:    job.Job{ID: "once", Name: "once", Script: c.Script("once", "echo once"), Enable: true},
+		TaskID: 42,
+	})
+	result := c.WaitResult("once", func(result *job.TaskResult) bool { return result.TaskID == 42 })
+	assert.Equal(t, job.CronTaskStatusSuccess, result.Status)
+	assert.Equal(t, "node-b", result.RunOn)
+	assert.Contains(t, result.Logs, "once")
+	assert.Len(t, c.Results("once"), 1)
+}
+
+func TestKillTask(t *testing.T) {
+	c := NewCluster(t)
+	c.StartAgent("node-a")
+
+	c.RunOnce("node-a", &job.OnceJob{
+		Job:    job.Job{ID: "sleep", Name: "sleep", Script: c.Script("sleep", "sleep 60"), Enable: true},
+		TaskID: 7,
+	})
+	started := time.Now()
+	c.KillTask("sleep", 7)
+
+	result := c.WaitResult("sleep", func(result *job.TaskResult) bool { return result.TaskID == 7 })
+	assert.Equal(t, job.CronTaskStatusFailed, result.Status)
+	assert.True(t, time.Since(started) < 30*time.Second, "task is not killed")
+}
+
+func TestProcLease(t *testing.T) {
+	c := NewCluster(t)
+	c.StartAgent("node-a")
+
+	c.RunOnce("node-a", &job.OnceJob{
+		Job:    job.Job{ID: "lease", Name: "lease", Script: c.Script("lease", "sleep 60"), Enable: true},
+		TaskID: 9,
+	})
+	var lease int64
+	c.Eventually(func() bool {
+		lease = c.ProcLease("lease")
+		return lease != 0
+	}, "proc key is not written")
+
+	// the lease expires as if the agent lost etcd for longer than the ttl
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := c.Client.Revoke(ctx, clientv3.LeaseID(lease))
+	assert.NoError(t, err)
+	c.Eventually(func() bool {
+		renewed := c.ProcLease("lease")
+		return renewed != 0 && renewed != lease
+	}, "proc key is not written again with a new lease")
+
+	c.KillTask("lease", 9)
+	c.Eventually(func() bool { return c.ProcLease("lease") == 0 }, "proc key is not deleted after the task finished")
+}
+
+func TestFailover(t *testing.T) {
+	c := NewCluster(t)
+	agents := map[string]Worker{
+		"node-a": c.StartAgent("node-a"),
+		"node-b": c.StartAgent("node-b"),
+	}
+
+	alone := everySecond("alone", c.Script("alone", "echo alone"), "node-a", "node-b")
+	alone.JobType = job.TypeAlone
+	c.PutJob(alone)
+
+	var owner string
+	c.Eventually(func() bool {
+		owner = ""
+		for name, agent := range agents {
+			if Owns(agent, "alone") {
+				if owner != "" {
+					t.Fatalf("alone job is scheduled on both %s and %s", owner, name)
+				}
+				owner = name
+			}
+		}
+		return owner != ""
+	}, "alone job is not scheduled")
+	c.WaitResult("alone", func(result *job.TaskResult) bool { return result.RunOn == owner })
+
+	c.StopAgent(owner)
+	delete(agents, owner)
+	for name, agent := range agents {
+		c.Eventually(func() bool { return Owns(agent, "alone") }, "%s does not take over alone job", name)
+		c.WaitResult("alone", func(result *job.TaskResult) bool { return result.RunOn == name })
+	}
+}
+
+func TestConfigPush(t *testing.T) {
+	c := NewCluster(t)
+	if err := conf.Set("jupiter.etcdv3.default.endpoints", []string{c.Endpoint}); err != nil {
+		t.Fatal(err)
+	}
+	ds := confetcd.NewETCDDataSource("/juno-agent", confetcd.Options{History: confetcd.DefaultHistory})
+
+	key := fmt.Sprintf("/juno-agent/%s/e2e-app/dev/static/config.toml/8080", report.ReturnHostName())
+	for _, content := range []string{"version = 1", "version = 2"} {
+		c.Put(key, &structs.ServiceConf{Content: content})
+		c.Eventually(func() bool {
+			values, err := ds.GetValues(nil, "e2e-app", "dev", "config.toml", "8080")
+			return err == nil && values["e2e-app/dev/config.toml/8080"] == content
+		}, "config %q is not pushed", content)
+	}
+}
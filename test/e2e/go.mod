@@ -0,0 +1,13 @@
+module github.com/douyu/juno-agent/test/e2e
+
+go 1.14
+
+require (
+	github.com/douyu/juno-agent v0.0.0-00010101000000-000000000000
+	github.com/douyu/jupiter v0.2.4
+	github.com/stretchr/testify v1.6.1
+	go.etcd.io/etcd/client/v3 v3.5.9
+	go.etcd.io/etcd/server/v3 v3.5.9
+)
+
+replace github.com/douyu/juno-agent => ../..
@@ -0,0 +1,313 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build e2e
+// +build e2e
+
+// Package e2e runs agents against an embedded etcd and drives them the way
+// juno-admin does, by writing keys. run with `make e2e`
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/douyu/juno-agent/pkg/job"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// DefaultTimeout bounds every wait of a scenario
+var DefaultTimeout = 30 * time.Second
+
+// Worker the part of a job worker driven by scenarios
+type Worker interface {
+	job.Manager
+	Run() error
+	Stop() error
+}
+
+// Cluster an embedded etcd and the agents connected to it
+type Cluster struct {
+	t        *testing.T
+	dir      string
+	etcd     *embed.Etcd
+	Endpoint string
+	Client   *clientv3.Client
+	agents   map[string]Worker
+}
+
+// NewCluster starts an embedded etcd listening on a random local port,
+// everything is torn down when the test finishes
+func NewCluster(t *testing.T) *Cluster {
+	dir, err := ioutil.TempDir("", "juno-agent-e2e")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientURL, peerURL := localURL(t), localURL(t)
+	cfg := embed.NewConfig()
+	cfg.Name = "e2e"
+	cfg.Dir = dir
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{*clientURL}, []url.URL{*clientURL}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{*peerURL}, []url.URL{*peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case err := <-e.Err():
+		e.Close()
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	case <-time.After(DefaultTimeout):
+		e.Server.Stop()
+		os.RemoveAll(dir)
+		t.Fatal("embedded etcd is not ready")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{clientURL.Host},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		e.Close()
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	c := &Cluster{
+		t:        t,
+		dir:      dir,
+		etcd:     e,
+		Endpoint: clientURL.Host,
+		Client:   client,
+		agents:   make(map[string]Worker),
+	}
+	t.Cleanup(c.close)
+	return c
+}
+
+// localURL reserves a free port on the loopback interface
+func localURL(t *testing.T) *url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return &url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+func (c *Cluster) close() {
+	for name := range c.agents {
+		c.StopAgent(name)
+	}
+	c.Client.Close()
+	c.etcd.Close()
+	os.RemoveAll(c.dir)
+}
+
+// StartAgent starts a job worker named name, which is also its node id
+func (c *Cluster) StartAgent(name string) Worker {
+	config := job.DefaultConfig()
+	config.HostName = name
+	config.AppIP = "127.0.0.1"
+	config.EtcdClient.Endpoints = []string{c.Endpoint}
+	config.Etcd.LockTimeout = time.Second
+	config.Etcd.Retries = 1
+	config.Etcd.Backoff = 100 * time.Millisecond
+
+	worker := config.Build()
+	if err := worker.Run(); err != nil {
+		c.t.Fatal(err)
+	}
+	c.agents[name] = worker
+	return worker
+}
+
+// StopAgent stops the agent as if it was shut down, locks it holds are released
+func (c *Cluster) StopAgent(name string) {
+	worker, ok := c.agents[name]
+	if !ok {
+		return
+	}
+	delete(c.agents, name)
+	if err := worker.Stop(); err != nil {
+		c.t.Logf("stop agent %s: %s", name, err)
+	}
+}
+
+func (c *Cluster) put(key string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.Client.Put(ctx, key, string(data)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// Script writes an executable shell script, jobs run their script as a file without arguments
+func (c *Cluster) Script(name, body string) string {
+	path := filepath.Join(c.dir, name+".sh")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		c.t.Fatal(err)
+	}
+	return path
+}
+
+// PutJob creates or updates a job
+func (c *Cluster) PutJob(j *job.Job) {
+	c.put(job.JobsKeyPrefix+j.ID, j)
+}
+
+// DeleteJob deletes a job
+func (c *Cluster) DeleteJob(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.Client.Delete(ctx, job.JobsKeyPrefix+id); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// RunOnce asks node to run the job once
+func (c *Cluster) RunOnce(node string, once *job.OnceJob) {
+	c.put(fmt.Sprintf("%s%s/%s", job.OnceKeyPrefix, node, once.ID), once)
+}
+
+// Put writes a raw value, e.g. a config pushed by juno-admin
+func (c *Cluster) Put(key string, value interface{}) {
+	c.put(key, value)
+}
+
+// list returns values under prefix keyed by key
+func (c *Cluster) list(prefix string) map[string][]byte {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := c.Client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	kvs := make(map[string][]byte, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		kvs[string(kv.Key)] = kv.Value
+	}
+	return kvs
+}
+
+// ProcLease returns the lease of a proc key of the job, 0 if no process is running
+func (c *Cluster) ProcLease(jobID string) int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := c.Client.Get(ctx, job.ProcKeyPrefix+jobID+"/", clientv3.WithPrefix())
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if len(resp.Kvs) == 0 {
+		return 0
+	}
+	return resp.Kvs[0].Lease
+}
+
+// Results task results of the job written by agents
+func (c *Cluster) Results(jobID string) []*job.TaskResult {
+	var results []*job.TaskResult
+	for key, value := range c.list(job.ResultKeyPrefix + jobID + "/") {
+		result := &job.TaskResult{}
+		if err := json.Unmarshal(value, result); err != nil {
+			c.t.Fatalf("invalid result %s: %s", key, err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// WaitResult waits for a finished task of the job matching fn
+func (c *Cluster) WaitResult(jobID string, fn func(*job.TaskResult) bool) *job.TaskResult {
+	var found *job.TaskResult
+	c.Eventually(func() bool {
+		for _, result := range c.Results(jobID) {
+			if result.FinishedAt != nil && fn(result) {
+				found = result
+				return true
+			}
+		}
+		return false
+	}, "no result of job %s", jobID)
+	return found
+}
+
+// KillTask marks running processes of the task as killed, like juno-admin does
+func (c *Cluster) KillTask(jobID string, taskID uint64) {
+	prefix := fmt.Sprintf("%s%s/%d/", job.ProcKeyPrefix, jobID, taskID)
+	var procs map[string][]byte
+	c.Eventually(func() bool {
+		procs = c.list(prefix)
+		return len(procs) > 0
+	}, "task %d of job %s is not running", taskID, jobID)
+
+	for key, value := range procs {
+		val := &job.ProcessVal{}
+		if err := json.Unmarshal(value, val); err != nil {
+			c.t.Fatal(err)
+		}
+		val.Killed = true
+		c.put(key, val)
+	}
+}
+
+// Eventually polls cond until it is true, the test fails after DefaultTimeout
+func (c *Cluster) Eventually(cond func() bool, format string, args ...interface{}) {
+	c.t.Helper()
+	deadline := time.Now().Add(DefaultTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			c.t.Fatalf(format, args...)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Owns reports whether the job is scheduled on the agent
+func Owns(worker Worker, jobID string) bool {
+	for _, j := range worker.Jobs() {
+		if j.ID == jobID {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains reports whether logs of the result contain s
+func Contains(s string) func(*job.TaskResult) bool {
+	return func(result *job.TaskResult) bool {
+		return strings.Contains(result.Logs, s)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 )
 
 func ReadDirFiles(dir string, appName string) (result map[string]string, err error) {
@@ -76,6 +77,74 @@ func WriteFile(filePath string, content string) error {
 	return nil
 }
 
+// WriteFileAtomic 先写入同目录下的临时文件并 fsync，再 rename 覆盖目标文件，读取方不会读到写了一半的内容
+// 目标文件已存在时沿用其权限及属主，否则为 0644
+func WriteFileAtomic(filePath string, content []byte) error {
+	return WriteFileAtomicPerm(filePath, content, 0644)
+}
+
+// WriteFileAtomicPerm 与 WriteFileAtomic 相同，目标文件不存在时权限为 perm
+func WriteFileAtomicPerm(filePath string, content []byte, perm os.FileMode) error {
+	if err := MkdirAll(filePath); err != nil {
+		return err
+	}
+	stat, err := os.Stat(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	dir, name := filepath.Split(filePath)
+	tmp, err := ioutil.TempFile(dir, "."+name+".tmp")
+	if err != nil {
+		return err
+	}
+	// rename 成功后临时文件已不存在，删除失败可以忽略
+	defer os.Remove(tmp.Name())
+
+	if err := writeTemp(tmp, content, stat, perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// writeTemp 临时文件在 rename 前设置好权限及属主，替换后应用仍然可以读取
+func writeTemp(tmp *os.File, content []byte, stat os.FileInfo, perm os.FileMode) error {
+	if _, err := tmp.Write(content); err != nil {
+		return err
+	}
+	if stat != nil {
+		perm = stat.Mode().Perm()
+		if err := chownLike(tmp, stat); err != nil {
+			return err
+		}
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return err
+	}
+	return tmp.Sync()
+}
+
+// syncDir 持久化目录项，保证 rename 在掉电后仍然生效，windows 等不支持的平台忽略错误
+func syncDir(dir string) {
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = f.Sync()
+	_ = f.Close()
+}
+
 // 生成32位MD5
 func MD5(text string) string {
 	ctx := md5.New()